@@ -0,0 +1,255 @@
+// Package backup copies whatsmeow device stores between databases, e.g. to move linked devices
+// from SQLite to Postgres without linking them again.
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+var (
+	ErrSchemaMismatch = errors.New("the schema versions of the stores differ")
+	ErrNoDevice       = errors.New("device not found in the source")
+	ErrDeviceExists   = errors.New("device already exists in the destination")
+	ErrCountMismatch  = errors.New("copied row count differs from the source")
+)
+
+// MigrateOpts configures Migrate.
+type MigrateOpts struct {
+	Devices []types.JID // devices to copy, all devices of the source when empty
+	DryRun  bool        // only report what would be copied
+	Force   bool        // overwrite devices that exist in the destination
+}
+
+// DeviceReport tells what was copied for one device.
+type DeviceReport struct {
+	JID      types.JID
+	Rows     map[string]int // copied rows per table
+	Replaced bool           // the device existed in the destination and was overwritten
+}
+
+// Report tells what Migrate copied, or would copy in a dry-run.
+type Report struct {
+	DryRun  bool
+	Devices []DeviceReport
+}
+
+// table is a table of the whatsmeow store, and its column with the JID of the device.
+type table struct {
+	name   string
+	device string
+}
+
+// tables are copied in this order, the device itself first because the others refer to it.
+var tables = []table{
+	{"whatsmeow_device", "jid"},
+	{"whatsmeow_identity_keys", "our_jid"},
+	{"whatsmeow_pre_keys", "jid"},
+	{"whatsmeow_sessions", "our_jid"},
+	{"whatsmeow_sender_keys", "our_jid"},
+	{"whatsmeow_app_state_sync_keys", "jid"},
+	{"whatsmeow_app_state_version", "jid"},
+	{"whatsmeow_app_state_mutation_macs", "jid"},
+	{"whatsmeow_contacts", "our_jid"},
+	{"whatsmeow_chat_settings", "our_jid"},
+	{"whatsmeow_message_secrets", "our_jid"},
+	{"whatsmeow_privacy_tokens", "our_jid"},
+}
+
+// Migrate copies devices with their keys, sessions, app state and contacts from one store to
+// another. `src` and `dst` are the databases of `sqlstore.Container`s, which don't expose them;
+// both must be at the same schema version, so upgrade them first using
+// `sqlstore.Container.Upgrade`. The dialects may differ.
+//
+// Each device is copied in a transaction of its own, and the row counts are verified before
+// committing. Devices that exist in `dst` are only overwritten when `opts.Force` is set. On
+// error, the report holds the devices that were copied.
+func Migrate(ctx context.Context, src, dst *sql.DB, opts MigrateOpts) (Report, error) {
+	report := Report{DryRun: opts.DryRun}
+
+	srcVersion, err := schemaVersion(ctx, src)
+	if err != nil {
+		return report, fmt.Errorf("backup.Migrate: source: %w", err)
+	}
+	dstVersion, err := schemaVersion(ctx, dst)
+	if err != nil {
+		return report, fmt.Errorf("backup.Migrate: destination: %w", err)
+	}
+	if srcVersion != dstVersion {
+		return report, fmt.Errorf("backup.Migrate: source at %v, destination at %v: %w", srcVersion, dstVersion, ErrSchemaMismatch)
+	}
+
+	devices := opts.Devices
+	if len(devices) == 0 {
+		if devices, err = allDevices(ctx, src); err != nil {
+			return report, fmt.Errorf("backup.Migrate: source: %w", err)
+		}
+	}
+	// Check all devices before copying any, so that a refusal doesn't leave half a migration.
+	replace := make([]bool, len(devices))
+	for i, jid := range devices {
+		ok, err := hasDevice(ctx, src, jid)
+		if err != nil {
+			return report, fmt.Errorf("backup.Migrate: source: %w", err)
+		}
+		if !ok {
+			return report, fmt.Errorf("backup.Migrate: %v: %w", jid, ErrNoDevice)
+		}
+		if replace[i], err = hasDevice(ctx, dst, jid); err != nil {
+			return report, fmt.Errorf("backup.Migrate: destination: %w", err)
+		}
+		if replace[i] && !opts.Force {
+			return report, fmt.Errorf("backup.Migrate: %v: %w", jid, ErrDeviceExists)
+		}
+	}
+
+	for i, jid := range devices {
+		dr, err := copyDevice(ctx, src, dst, jid, replace[i], opts.DryRun)
+		if err != nil {
+			return report, fmt.Errorf("backup.Migrate: %v: %w", jid, err)
+		}
+		report.Devices = append(report.Devices, dr)
+	}
+	return report, nil
+}
+
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, `SELECT version FROM whatsmeow_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+func allDevices(ctx context.Context, db *sql.DB) ([]types.JID, error) {
+	rows, err := db.QueryContext(ctx, `SELECT jid FROM whatsmeow_device ORDER BY jid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []types.JID
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		jid, err := types.ParseJID(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, jid)
+	}
+	return out, rows.Err()
+}
+
+func hasDevice(ctx context.Context, db *sql.DB, jid types.JID) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM whatsmeow_device WHERE jid = $1`, jid.String()).Scan(&n)
+	return n > 0, err
+}
+
+// querier is what a *sql.DB and a *sql.Tx have in common.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func count(ctx context.Context, q querier, t table, jid types.JID) (int, error) {
+	var n int
+	err := q.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s = $1`, t.name, t.device), jid.String()).Scan(&n)
+	return n, err
+}
+
+// copyDevice copies the rows of one device. The source is read in a transaction too, so that
+// the copy is consistent.
+func copyDevice(ctx context.Context, src, dst *sql.DB, jid types.JID, replace, dryRun bool) (DeviceReport, error) {
+	dr := DeviceReport{JID: jid, Rows: map[string]int{}, Replaced: replace}
+
+	if dryRun {
+		for _, t := range tables {
+			n, err := count(ctx, src, t, jid)
+			if err != nil {
+				return dr, fmt.Errorf("counting %s: %w", t.name, err)
+			}
+			dr.Rows[t.name] = n
+		}
+		return dr, nil
+	}
+
+	srcTx, err := src.BeginTx(ctx, nil)
+	if err != nil {
+		return dr, err
+	}
+	defer srcTx.Rollback()
+	dstTx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return dr, err
+	}
+	defer dstTx.Rollback()
+
+	if replace {
+		for i := len(tables) - 1; i >= 0; i-- {
+			t := tables[i]
+			if _, err := dstTx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s = $1`, t.name, t.device), jid.String()); err != nil {
+				return dr, fmt.Errorf("deleting %s: %w", t.name, err)
+			}
+		}
+	}
+	for _, t := range tables {
+		n, err := copyTable(ctx, srcTx, dstTx, t, jid)
+		if err != nil {
+			return dr, fmt.Errorf("copying %s: %w", t.name, err)
+		}
+		copied, err := count(ctx, dstTx, t, jid)
+		if err != nil {
+			return dr, fmt.Errorf("counting %s: %w", t.name, err)
+		}
+		if copied != n {
+			return dr, fmt.Errorf("%s: %v rows in the source, %v copied: %w", t.name, n, copied, ErrCountMismatch)
+		}
+		dr.Rows[t.name] = n
+	}
+	return dr, dstTx.Commit()
+}
+
+// copyTable copies the rows of a device in one table, and returns how many were read. The
+// columns are taken from the source, so that the copy doesn't depend on the schema version.
+func copyTable(ctx context.Context, src, dst *sql.Tx, t table, jid types.JID) (int, error) {
+	rows, err := src.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM %s WHERE %s = $1`, t.name, t.device), jid.String())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	quoted := make([]string, len(cols))
+	placeholders := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = `"` + c + `"`
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	insert := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, t.name, strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+
+	n := 0
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		if _, err := dst.ExecContext(ctx, insert, vals...); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
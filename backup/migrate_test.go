@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func newStore(t *testing.T) (*sql.DB, *sqlstore.Container) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open(_) = %v, need nil error", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	c := sqlstore.NewWithDB(db, "sqlite3", nil)
+	if err := c.Upgrade(); err != nil {
+		t.Fatalf("Upgrade() = %v, need nil error", err)
+	}
+	return db, c
+}
+
+func key(b byte) []byte { return bytes.Repeat([]byte{b}, 32) }
+
+// addDevice inserts a device with an identity key, a pre-key, a session and a contact.
+func addDevice(t *testing.T, db *sql.DB, c *sqlstore.Container, jid types.JID, identity byte) {
+	t.Helper()
+	sig := make([]byte, 64)
+	if _, err := db.Exec(`INSERT INTO whatsmeow_device
+		(jid, registration_id, noise_key, identity_key, signed_pre_key, signed_pre_key_id, signed_pre_key_sig,
+		 adv_key, adv_details, adv_account_sig, adv_account_sig_key, adv_device_sig)
+		VALUES ($1, 42, $2, $3, $4, 1, $5, $6, $7, $8, $9, $10)`,
+		jid.String(), key(1), key(identity), key(3), sig, key(4), []byte{5}, sig, key(6), sig); err != nil {
+		t.Fatalf("inserting device: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO whatsmeow_pre_keys (jid, key_id, key, uploaded) VALUES ($1, 7, $2, true)`, jid.String(), key(7)); err != nil {
+		t.Fatalf("inserting pre-key: %v", err)
+	}
+	dev, err := c.GetDevice(jid)
+	if err != nil || dev == nil {
+		t.Fatalf("GetDevice(%v) = %v, %v, need device and nil error", jid, dev, err)
+	}
+	if err := dev.Identities.PutIdentity("456.0:0", [32]byte{8}); err != nil {
+		t.Fatalf("PutIdentity(_) = %v, need nil error", err)
+	}
+	if err := dev.Sessions.PutSession("456.0:0", []byte("session")); err != nil {
+		t.Fatalf("PutSession(_) = %v, need nil error", err)
+	}
+	// The interface names the arguments (fullName, firstName), but sqlstore takes (firstName,
+	// fullName).
+	if err := dev.Contacts.PutContactName(types.NewJID("456", types.DefaultUserServer), "Jane", "Jane Doe"); err != nil {
+		t.Fatalf("PutContactName(_) = %v, need nil error", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	srcDB, srcC := newStore(t)
+	dstDB, dstC := newStore(t)
+	alice := types.NewADJID("123", 0, 1)
+	bob := types.NewADJID("789", 0, 2)
+	addDevice(t, srcDB, srcC, alice, 2)
+	addDevice(t, srcDB, srcC, bob, 9)
+
+	// A dry-run reports but doesn't copy.
+	report, err := Migrate(ctx, srcDB, dstDB, MigrateOpts{Devices: []types.JID{alice}, DryRun: true})
+	if err != nil {
+		t.Fatalf("Migrate(dry-run) = %v, need nil error", err)
+	}
+	if len(report.Devices) != 1 || report.Devices[0].Rows["whatsmeow_sessions"] != 1 {
+		t.Errorf("Migrate(dry-run) reported %+v, want 1 device with 1 session", report)
+	}
+	if dev, err := dstC.GetDevice(alice); err != nil || dev != nil {
+		t.Errorf("GetDevice(_) after dry-run = %v, %v, want nil device and nil error", dev, err)
+	}
+
+	// Copy one device.
+	report, err = Migrate(ctx, srcDB, dstDB, MigrateOpts{Devices: []types.JID{alice}})
+	if err != nil {
+		t.Fatalf("Migrate(_) = %v, need nil error", err)
+	}
+	want := map[string]int{
+		"whatsmeow_device":        1,
+		"whatsmeow_identity_keys": 1,
+		"whatsmeow_pre_keys":      1,
+		"whatsmeow_sessions":      1,
+		"whatsmeow_contacts":      1,
+	}
+	for table, n := range want {
+		if got := report.Devices[0].Rows[table]; got != n {
+			t.Errorf("Migrate(_) copied %v rows of %v, want %v", got, table, n)
+		}
+	}
+
+	// The destination serves the device.
+	dev, err := dstC.GetDevice(alice)
+	if err != nil || dev == nil {
+		t.Fatalf("GetDevice(%v) = %v, %v, need device and nil error", alice, dev, err)
+	}
+	if dev.RegistrationID != 42 || !bytes.Equal(dev.IdentityKey.Priv[:], key(2)) {
+		t.Errorf("GetDevice(%v) = registration %v, identity %x, want 42 and %x", alice, dev.RegistrationID, dev.IdentityKey.Priv[:], key(2))
+	}
+	if ok, err := dev.Identities.IsTrustedIdentity("456.0:0", [32]byte{8}); err != nil || !ok {
+		t.Errorf("IsTrustedIdentity(copied key) = %v, %v, want true and nil error", ok, err)
+	}
+	if ok, err := dev.Identities.IsTrustedIdentity("456.0:0", [32]byte{9}); err != nil || ok {
+		t.Errorf("IsTrustedIdentity(other key) = %v, %v, want false and nil error", ok, err)
+	}
+	if s, err := dev.Sessions.GetSession("456.0:0"); err != nil || string(s) != "session" {
+		t.Errorf("GetSession(_) = %q, %v, want \"session\" and nil error", s, err)
+	}
+	contacts, err := dev.Contacts.GetAllContacts()
+	if err != nil || contacts[types.NewJID("456", types.DefaultUserServer)].FullName != "Jane Doe" {
+		t.Errorf("GetAllContacts() = %v, %v, want Jane Doe and nil error", contacts, err)
+	}
+	if dev, err := dstC.GetDevice(bob); err != nil || dev != nil {
+		t.Errorf("GetDevice(%v) = %v, %v, want nil device and nil error", bob, dev, err)
+	}
+
+	// Existing devices are only overwritten when forced.
+	if _, err := Migrate(ctx, srcDB, dstDB, MigrateOpts{}); !errors.Is(err, ErrDeviceExists) {
+		t.Errorf("Migrate(all) = %v, want %v", err, ErrDeviceExists)
+	}
+	if dev, err := dstC.GetDevice(bob); err != nil || dev != nil {
+		t.Errorf("GetDevice(%v) after refusal = %v, %v, want nil device and nil error", bob, dev, err)
+	}
+	report, err = Migrate(ctx, srcDB, dstDB, MigrateOpts{Force: true})
+	if err != nil {
+		t.Fatalf("Migrate(forced) = %v, need nil error", err)
+	}
+	if len(report.Devices) != 2 || !report.Devices[0].Replaced || report.Devices[1].Replaced {
+		t.Errorf("Migrate(forced) reported %+v, want alice replaced and bob copied", report)
+	}
+	if dev, err := dstC.GetDevice(bob); err != nil || dev == nil {
+		t.Errorf("GetDevice(%v) = %v, %v, need device and nil error", bob, dev, err)
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	ctx := context.Background()
+	srcDB, _ := newStore(t)
+	dstDB, _ := newStore(t)
+
+	if _, err := Migrate(ctx, srcDB, dstDB, MigrateOpts{Devices: []types.JID{types.NewADJID("123", 0, 1)}}); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("Migrate(unknown device) = %v, want %v", err, ErrNoDevice)
+	}
+	if _, err := dstDB.Exec(`UPDATE whatsmeow_version SET version = version + 1`); err != nil {
+		t.Fatalf("bumping version: %v", err)
+	}
+	if _, err := Migrate(ctx, srcDB, dstDB, MigrateOpts{}); !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("Migrate(other version) = %v, want %v", err, ErrSchemaMismatch)
+	}
+}
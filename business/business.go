@@ -0,0 +1,254 @@
+// Package business fetches the profiles and catalogs of business accounts.
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/waiface"
+
+	"go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ErrNotBusiness is returned when a JID doesn't belong to a business account.
+var ErrNotBusiness = errors.New("not a business account")
+
+// ProfileInfo is the public profile of a business account.
+type ProfileInfo struct {
+	JID          types.JID
+	VerifiedName string            // name that WhatsApp verified for this business
+	Categories   []string          // e.g. "Restaurant"
+	Address      string            // free form
+	Email        string            // contact email address
+	Options      map[string]string // raw profile options, e.g. "cart_enabled"
+	TimeZone     string            // time zone of the business hours
+	Hours        []types.BusinessHoursConfig
+}
+
+// Profile fetches the profile of a business account. When the JID isn't a business account, the
+// error wraps ErrNotBusiness.
+func Profile(ctx context.Context, cli waiface.ProfileAPI, jid types.JID) (*ProfileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	infos, err := cli.GetUserInfo([]types.JID{jid})
+	if err != nil {
+		return nil, fmt.Errorf("business.Profile: user info of %v: %w", jid, err)
+	}
+	vn := infos[jid].VerifiedName
+	if vn == nil || vn.Details.GetVerifiedName() == "" {
+		return nil, fmt.Errorf("business.Profile: %v: %w", jid, ErrNotBusiness)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bp, err := cli.GetBusinessProfile(jid)
+	if err != nil {
+		return nil, fmt.Errorf("business.Profile: business profile of %v: %w", jid, err)
+	}
+	p := &ProfileInfo{
+		JID:          jid,
+		VerifiedName: vn.Details.GetVerifiedName(),
+		Address:      bp.Address,
+		Email:        bp.Email,
+		Options:      bp.ProfileOptions,
+		TimeZone:     bp.BusinessHoursTimeZone,
+		Hours:        bp.BusinessHours,
+	}
+	for _, c := range bp.Categories {
+		p.Categories = append(p.Categories, c.Name)
+	}
+	return p, nil
+}
+
+// Product is an item in the catalog of a business.
+type Product struct {
+	ID          string
+	RetailerID  string // the business' own product ID
+	Name        string
+	Description string
+	Price       int64  // in 1/1000 of the currency unit, 0 when not shown
+	Currency    string // ISO 4217 code
+	URL         string
+	ImageURLs   []string
+	Hidden      bool
+}
+
+// IQSender sends info queries. `go.mau.fi/whatsmeow` doesn't implement catalog queries, so
+// Catalog sends them itself, using `whatsmeow.Client.DangerousInternals()`.
+type IQSender interface {
+	SendIQ(query whatsmeow.DangerousInfoQuery) (*waBinary.Node, error)
+}
+
+// catalogPageSize is the maximum number of products to request in one page.
+const catalogPageSize = 50
+
+// catalogImageSize is the width and height of the product images that are requested, in pixels.
+const catalogImageSize = "100"
+
+// Catalog fetches up to `limit` products of the catalog of a business, following pages until
+// enough products are found or the catalog is exhausted. A limit of 0 or less fetches the whole
+// catalog. Pass `client.DangerousInternals()` as `cli`.
+func Catalog(ctx context.Context, cli IQSender, jid types.JID, limit int) ([]Product, error) {
+	var products []Product
+	after := ""
+	seen := map[string]bool{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return products, err
+		}
+		n := catalogPageSize
+		if limit > 0 && limit-len(products) < n {
+			n = limit - len(products)
+		}
+		page, next, err := catalogPage(ctx, cli, jid, n, after)
+		if err != nil {
+			return products, fmt.Errorf("business.Catalog: page after %q of %v: %w", after, jid, err)
+		}
+		products = append(products, page...)
+		if limit > 0 && len(products) >= limit {
+			return products[:limit], nil
+		}
+		if next == "" || len(page) == 0 {
+			return products, nil
+		}
+		if seen[next] {
+			return products, fmt.Errorf("business.Catalog: cursor %q of %v repeats", next, jid)
+		}
+		seen[next] = true
+		after = next
+	}
+}
+
+// catalogPage fetches one page of a catalog with a `w:biz:catalog` IQ, starting after the cursor
+// `after` (empty for the first page). It returns the cursor of the next page, or an empty string
+// when there are no more pages.
+func catalogPage(ctx context.Context, cli IQSender, jid types.JID, limit int, after string) ([]Product, string, error) {
+	params := []waBinary.Node{
+		{Tag: "limit", Content: []byte(strconv.Itoa(limit))},
+		{Tag: "width", Content: []byte(catalogImageSize)},
+		{Tag: "height", Content: []byte(catalogImageSize)},
+	}
+	if after != "" {
+		params = append(params, waBinary.Node{Tag: "after", Content: []byte(after)})
+	}
+	resp, err := cli.SendIQ(whatsmeow.DangerousInfoQuery{
+		Namespace: "w:biz:catalog",
+		Type:      "get",
+		To:        types.ServerJID,
+		Context:   ctx,
+		Content: []waBinary.Node{{
+			Tag:     "product_catalog",
+			Attrs:   waBinary.Attrs{"jid": jid, "allow_shop_source": "true"},
+			Content: params,
+		}},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	list, ok := resp.GetOptionalChildByTag("product_catalog")
+	if !ok {
+		return nil, "", errors.New("no product_catalog in the response")
+	}
+	var products []Product
+	for _, n := range list.GetChildrenByTag("product") {
+		products = append(products, parseProduct(n))
+	}
+	return products, text(list.GetChildByTag("paging", "after")), nil
+}
+
+// parseProduct converts a `product` node of a catalog. Products without a valid price get 0.
+func parseProduct(n waBinary.Node) Product {
+	p := Product{
+		ID:          text(n.GetChildByTag("id")),
+		RetailerID:  text(n.GetChildByTag("retailer_id")),
+		Name:        text(n.GetChildByTag("name")),
+		Description: text(n.GetChildByTag("description")),
+		Currency:    text(n.GetChildByTag("currency")),
+		URL:         text(n.GetChildByTag("url")),
+		Hidden:      n.Attrs["is_hidden"] == "true",
+	}
+	p.Price, _ = strconv.ParseInt(text(n.GetChildByTag("price")), 10, 64)
+	media := n.GetChildByTag("media")
+	for _, img := range media.GetChildrenByTag("image") {
+		if url := text(img.GetChildByTag("original_image_url")); url != "" {
+			p.ImageURLs = append(p.ImageURLs, url)
+		}
+	}
+	return p
+}
+
+// text returns the text content of a node, or an empty string when it has none.
+func text(n waBinary.Node) string {
+	b, _ := n.Content.([]byte)
+	return string(b)
+}
+
+// Cache holds fetched profiles. When registered, BusinessName events refresh the verified
+// names of cached profiles.
+type Cache struct {
+	mu       sync.Mutex
+	profiles map[types.JID]*ProfileInfo
+}
+
+// NewCache returns an empty cache.
+func NewCache() *Cache {
+	return &Cache{
+		profiles: make(map[types.JID]*ProfileInfo),
+	}
+}
+
+// Register binds the cache to BusinessName events.
+func (c *Cache) Register() {
+	handlers.Register(handlers.BusinessName, c)
+}
+
+// Profile returns the cached profile of a business, or fetches it using Profile. Non-business
+// accounts aren't cached.
+func (c *Cache) Profile(ctx context.Context, cli waiface.ProfileAPI, jid types.JID) (*ProfileInfo, error) {
+	c.mu.Lock()
+	p, ok := c.profiles[jid]
+	c.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	p, err := Profile(ctx, cli, jid)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.profiles[jid] = p
+	return p, nil
+}
+
+// Forget drops a profile from the cache, so that the next lookup fetches it again.
+func (c *Cache) Forget(jid types.JID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.profiles, jid)
+}
+
+// Handle processes BusinessName events: the verified name of a cached profile is updated.
+func (c *Cache) Handle(ev interface{}) error {
+	bn, ok := ev.(*events.BusinessName)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.profiles[bn.JID]; ok {
+		updated := *p
+		updated.VerifiedName = bn.NewBusinessName
+		c.profiles[bn.JID] = &updated
+	}
+	return nil
+}
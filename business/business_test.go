@@ -0,0 +1,193 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/proto/waVnameCert"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	shop   = types.NewJID("111", types.DefaultUserServer)
+	person = types.NewJID("222", types.DefaultUserServer)
+)
+
+type fakeClient struct {
+	profileCalls int
+}
+
+func (f *fakeClient) GetUserInfo(jids []types.JID) (map[types.JID]types.UserInfo, error) {
+	out := map[types.JID]types.UserInfo{}
+	for _, jid := range jids {
+		ui := types.UserInfo{}
+		if jid == shop {
+			ui.VerifiedName = &types.VerifiedName{
+				Details: &waVnameCert.VerifiedNameCertificate_Details{VerifiedName: proto.String("Shop")},
+			}
+		}
+		out[jid] = ui
+	}
+	return out, nil
+}
+
+func (f *fakeClient) GetBusinessProfile(jid types.JID) (*types.BusinessProfile, error) {
+	f.profileCalls++
+	return &types.BusinessProfile{
+		JID:        jid,
+		Address:    "Main Street 1",
+		Categories: []types.Category{{ID: "1", Name: "Bakery"}},
+	}, nil
+}
+
+// TestProfile checks profile fetching and the not-a-business error.
+func TestProfile(t *testing.T) {
+	cli := &fakeClient{}
+	p, err := Profile(context.Background(), cli, shop)
+	if err != nil {
+		t.Fatalf("Profile(_, _, shop) = %v, need nil error", err)
+	}
+	if p.VerifiedName != "Shop" || p.Address != "Main Street 1" || len(p.Categories) != 1 || p.Categories[0] != "Bakery" {
+		t.Errorf("Profile(_, _, shop) = %+v, unexpected", p)
+	}
+	if _, err := Profile(context.Background(), cli, person); !errors.Is(err, ErrNotBusiness) {
+		t.Errorf("Profile(_, _, person) = %v, want ErrNotBusiness", err)
+	}
+}
+
+// TestCache checks that profiles are cached and that BusinessName events update them.
+func TestCache(t *testing.T) {
+	cli := &fakeClient{}
+	c := NewCache()
+	for i := 0; i < 3; i++ {
+		if _, err := c.Profile(context.Background(), cli, shop); err != nil {
+			t.Fatalf("Profile(_) = %v, need nil error", err)
+		}
+	}
+	if cli.profileCalls != 1 {
+		t.Errorf("%v profile fetches, want 1", cli.profileCalls)
+	}
+	c.Handle(&events.BusinessName{JID: shop, NewBusinessName: "Shop & Co"})
+	p, _ := c.Profile(context.Background(), cli, shop)
+	if p.VerifiedName != "Shop & Co" {
+		t.Errorf("VerifiedName = %q after BusinessName event, want %q", p.VerifiedName, "Shop & Co")
+	}
+}
+
+// fakeIQ serves a catalog of n products in pages, like the server answers w:biz:catalog IQs.
+type fakeIQ struct {
+	n     int
+	calls int
+}
+
+func (f *fakeIQ) SendIQ(query whatsmeow.DangerousInfoQuery) (*waBinary.Node, error) {
+	f.calls++
+	req := query.Content.([]waBinary.Node)[0]
+	if query.Namespace != "w:biz:catalog" || req.Tag != "product_catalog" || req.Attrs["jid"] != shop {
+		return nil, fmt.Errorf("unexpected query %+v", query)
+	}
+	limit, err := strconv.Atoi(text(req.GetChildByTag("limit")))
+	if err != nil {
+		return nil, err
+	}
+	start := 0
+	if after := text(req.GetChildByTag("after")); after != "" {
+		start, _ = strconv.Atoi(after)
+	}
+	var nodes []waBinary.Node
+	for i := start; i < start+limit && i < f.n; i++ {
+		nodes = append(nodes, waBinary.Node{Tag: "product", Content: []waBinary.Node{
+			{Tag: "id", Content: []byte(fmt.Sprint(i))},
+		}})
+	}
+	if end := start + len(nodes); end < f.n {
+		nodes = append(nodes, waBinary.Node{Tag: "paging", Content: []waBinary.Node{
+			{Tag: "after", Content: []byte(fmt.Sprint(end))},
+		}})
+	}
+	return &waBinary.Node{Tag: "iq", Content: []waBinary.Node{{Tag: "product_catalog", Content: nodes}}}, nil
+}
+
+// TestCatalogPagination checks that pages are stitched together in order.
+func TestCatalogPagination(t *testing.T) {
+	for _, test := range []struct {
+		n, limit  int
+		wantLen   int
+		wantCalls int
+	}{
+		{n: 120, limit: 0, wantLen: 120, wantCalls: 3},
+		{n: 120, limit: 70, wantLen: 70, wantCalls: 2},
+		{n: 10, limit: 70, wantLen: 10, wantCalls: 1},
+	} {
+		pager := &fakeIQ{n: test.n}
+		products, err := Catalog(context.Background(), pager, shop, test.limit)
+		if err != nil {
+			t.Fatalf("Catalog(_, %v) = %v, need nil error", test.limit, err)
+		}
+		if len(products) != test.wantLen || pager.calls != test.wantCalls {
+			t.Errorf("Catalog(_, %v) of %v products: got %v in %v calls, want %v in %v calls",
+				test.limit, test.n, len(products), pager.calls, test.wantLen, test.wantCalls)
+		}
+		for i, p := range products {
+			if p.ID != fmt.Sprint(i) {
+				t.Errorf("product %v has ID %v, out of order", i, p.ID)
+				break
+			}
+		}
+	}
+}
+
+// TestParseProduct checks the conversion of a product node.
+func TestParseProduct(t *testing.T) {
+	n := waBinary.Node{Tag: "product", Attrs: waBinary.Attrs{"is_hidden": "true"}, Content: []waBinary.Node{
+		{Tag: "id", Content: []byte("42")},
+		{Tag: "retailer_id", Content: []byte("SKU-1")},
+		{Tag: "name", Content: []byte("Bread")},
+		{Tag: "description", Content: []byte("Fresh")},
+		{Tag: "price", Content: []byte("2500")},
+		{Tag: "currency", Content: []byte("EUR")},
+		{Tag: "url", Content: []byte("https://example.com/bread")},
+		{Tag: "media", Content: []waBinary.Node{
+			{Tag: "image", Content: []waBinary.Node{
+				{Tag: "request_image_url", Content: []byte("https://example.com/small.jpg")},
+				{Tag: "original_image_url", Content: []byte("https://example.com/bread.jpg")},
+			}},
+		}},
+	}}
+	want := Product{
+		ID:          "42",
+		RetailerID:  "SKU-1",
+		Name:        "Bread",
+		Description: "Fresh",
+		Price:       2500,
+		Currency:    "EUR",
+		URL:         "https://example.com/bread",
+		ImageURLs:   []string{"https://example.com/bread.jpg"},
+		Hidden:      true,
+	}
+	if got := parseProduct(n); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProduct(_) = %+v, want %+v", got, want)
+	}
+}
+
+// TestCatalogMalformed checks that a response without a catalog is an error.
+func TestCatalogMalformed(t *testing.T) {
+	cli := iqFunc(func(query whatsmeow.DangerousInfoQuery) (*waBinary.Node, error) {
+		return &waBinary.Node{Tag: "iq"}, nil
+	})
+	if _, err := Catalog(context.Background(), cli, shop, 0); err == nil {
+		t.Errorf("Catalog(_) of a response without product_catalog = nil, need error")
+	}
+}
+
+type iqFunc func(query whatsmeow.DangerousInfoQuery) (*waBinary.Node, error)
+
+func (f iqFunc) SendIQ(query whatsmeow.DangerousInfoQuery) (*waBinary.Node, error) { return f(query) }
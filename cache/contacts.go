@@ -0,0 +1,168 @@
+// Package cache keeps information that events carry in memory, so that it is at hand without
+// querying the client's store.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Names is what is known about the names of a contact. Empty fields are unknown.
+type Names struct {
+	PushName     string // that the contact chose for themselves
+	BusinessName string // the verified name of a business account
+	FullName     string // in the address book of this account
+	FirstName    string // in the address book of this account
+}
+
+// merge returns the names, updated with the fields of `u` that are known.
+func (n Names) merge(u Names) Names {
+	if u.PushName != "" {
+		n.PushName = u.PushName
+	}
+	if u.BusinessName != "" {
+		n.BusinessName = u.BusinessName
+	}
+	if u.FullName != "" {
+		n.FullName = u.FullName
+	}
+	if u.FirstName != "" {
+		n.FirstName = u.FirstName
+	}
+	return n
+}
+
+// Store persists the names of a Contacts cache, so that they survive a restart.
+type Store interface {
+	// Load returns all stored names.
+	Load() (map[types.JID]Names, error)
+	// Save stores the names of a contact, replacing what was stored for it.
+	Save(jid types.JID, n Names) error
+}
+
+// Contacts caches the names of contacts from PushName, BusinessName, Contact and PairSuccess
+// events. Updates are merged: an event with one name doesn't erase the others. Contacts are keyed
+// by their JIDs without the device. The zero value isn't usable, use NewContacts.
+type Contacts struct {
+	store Store
+
+	mu    sync.RWMutex
+	names map[types.JID]Names
+}
+
+// NewContacts returns a cache of contact names. When `store` isn't nil, the cache starts out with
+// the names that it loads, and saves the names that change.
+//
+//	contacts, err := cache.NewContacts(nil)
+//	if err != nil { ... }
+//	contacts.Register()
+//	fmt.Printf("Message from %v\n", contacts.Name(msg.Info.Sender))
+func NewContacts(store Store) (*Contacts, error) {
+	c := &Contacts{store: store, names: map[types.JID]Names{}}
+	if store == nil {
+		return c, nil
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("cache.NewContacts: %w", err)
+	}
+	for jid, n := range loaded {
+		c.names[jid.ToNonAD()] = n
+	}
+	return c, nil
+}
+
+// ContactEvents returns the event types that a Contacts cache handles.
+func ContactEvents() []handlers.EventType {
+	return []handlers.EventType{handlers.PushName, handlers.BusinessName, handlers.Contact, handlers.PairSuccess}
+}
+
+// Register registers the cache for its events, see ContactEvents.
+func (c *Contacts) Register() {
+	handlers.RegisterMany(ContactEvents(), c)
+}
+
+// Handle implements handlers.handler for the events of ContactEvents.
+func (c *Contacts) Handle(ev interface{}) error {
+	var jid types.JID
+	var u Names
+	switch v := ev.(type) {
+	case *events.PushName:
+		jid, u.PushName = v.JID, v.NewPushName
+	case *events.BusinessName:
+		jid, u.BusinessName = v.JID, v.NewBusinessName
+	case *events.Contact:
+		jid, u.FullName, u.FirstName = v.JID, v.Action.GetFullName(), v.Action.GetFirstName()
+	case *events.PairSuccess:
+		jid, u.BusinessName = v.ID, v.BusinessName // of this account
+	default:
+		return fmt.Errorf("cache.Contacts.Handle: unexpected event %T", ev)
+	}
+	if err := c.update(jid, u); err != nil {
+		return fmt.Errorf("cache.Contacts.Handle: %w", err)
+	}
+	return nil
+}
+
+// Update merges names into what is known about a contact, e.g. from a source other than events,
+// and saves them when they changed.
+func (c *Contacts) Update(jid types.JID, u Names) error {
+	if err := c.update(jid, u); err != nil {
+		return fmt.Errorf("cache.Contacts.Update: %w", err)
+	}
+	return nil
+}
+
+// update merges names into what is known about a contact, and saves them when they changed.
+func (c *Contacts) update(jid types.JID, u Names) error {
+	if jid.IsEmpty() {
+		return errors.New("no JID")
+	}
+	jid = jid.ToNonAD()
+	c.mu.Lock()
+	old := c.names[jid]
+	n := old.merge(u)
+	if n == old {
+		c.mu.Unlock()
+		return nil
+	}
+	c.names[jid] = n
+	c.mu.Unlock()
+
+	if c.store != nil {
+		if err := c.store.Save(jid, n); err != nil {
+			return fmt.Errorf("saving the names of %v: %w", jid, err)
+		}
+	}
+	return nil
+}
+
+// Get returns what is known about the names of a contact, or false when nothing is.
+func (c *Contacts) Get(jid types.JID) (Names, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n, ok := c.names[jid.ToNonAD()]
+	return n, ok
+}
+
+// Name returns the best known name of a contact, for display: the name in the address book, the
+// business name or the push name, in that order. Without any, it is the phone number for users,
+// e.g. "+31612345678", and the JID for others.
+func (c *Contacts) Name(jid types.JID) string {
+	n, _ := c.Get(jid)
+	for _, name := range []string{n.FullName, n.FirstName, n.BusinessName, n.PushName} {
+		if name != "" {
+			return name
+		}
+	}
+	if jid.Server == types.DefaultUserServer && jid.User != "" {
+		return "+" + jid.User
+	}
+	return jid.ToNonAD().String()
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waSyncAction"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// memStore is a Store in memory.
+type memStore struct {
+	names   map[types.JID]Names
+	saves   int
+	loadErr error
+	saveErr error
+}
+
+func (m *memStore) Load() (map[types.JID]Names, error) {
+	return m.names, m.loadErr
+}
+
+func (m *memStore) Save(jid types.JID, n Names) error {
+	m.saves++
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	m.names[jid] = n
+	return nil
+}
+
+func TestContacts(t *testing.T) {
+	alice := types.NewJID("31611111111", types.DefaultUserServer)
+	aliceDevice := types.NewADJID("31611111111", 0, 2)
+	shop := types.NewJID("31622222222", types.DefaultUserServer)
+	me := types.NewADJID("31633333333", 0, 7)
+	group := types.NewJID("120363000000000000", types.GroupServer)
+
+	store := &memStore{names: map[types.JID]Names{}}
+	c, err := NewContacts(store)
+	if err != nil {
+		t.Fatalf("NewContacts(_) = _, %v, need nil error", err)
+	}
+	for _, test := range []struct {
+		description string
+		event       interface{}
+		jid         types.JID
+		want        string
+		wantNames   Names
+		wantSaves   int
+	}{
+		{
+			description: "unknown user",
+			jid:         alice,
+			want:        "+31611111111",
+		},
+		{
+			description: "unknown group",
+			jid:         group,
+			want:        "120363000000000000@g.us",
+		},
+		{
+			description: "push name",
+			event:       &events.PushName{JID: aliceDevice, NewPushName: "Ally"},
+			jid:         alice,
+			want:        "Ally",
+			wantNames:   Names{PushName: "Ally"},
+			wantSaves:   1,
+		},
+		{
+			description: "full name wins",
+			event: &events.Contact{JID: alice, Action: &waSyncAction.ContactAction{
+				FullName: proto.String("Alice Smith"), FirstName: proto.String("Alice"),
+			}},
+			jid:       aliceDevice,
+			want:      "Alice Smith",
+			wantNames: Names{PushName: "Ally", FullName: "Alice Smith", FirstName: "Alice"},
+			wantSaves: 2,
+		},
+		{
+			description: "push name doesn't erase the full name",
+			event:       &events.PushName{JID: alice, OldPushName: "Ally", NewPushName: "Al"},
+			jid:         alice,
+			want:        "Alice Smith",
+			wantNames:   Names{PushName: "Al", FullName: "Alice Smith", FirstName: "Alice"},
+			wantSaves:   3,
+		},
+		{
+			description: "unchanged names aren't saved",
+			event:       &events.PushName{JID: alice, NewPushName: "Al"},
+			jid:         alice,
+			want:        "Alice Smith",
+			wantNames:   Names{PushName: "Al", FullName: "Alice Smith", FirstName: "Alice"},
+			wantSaves:   3,
+		},
+		{
+			description: "business name over push name",
+			event:       &events.BusinessName{JID: shop, NewBusinessName: "Corner Shop B.V."},
+			jid:         shop,
+			want:        "Corner Shop B.V.",
+			wantNames:   Names{BusinessName: "Corner Shop B.V."},
+			wantSaves:   4,
+		},
+		{
+			description: "own business name after pairing",
+			event:       &events.PairSuccess{ID: me, BusinessName: "My Desk"},
+			jid:         me.ToNonAD(),
+			want:        "My Desk",
+			wantNames:   Names{BusinessName: "My Desk"},
+			wantSaves:   5,
+		},
+		{
+			description: "pairing without business name",
+			event:       &events.PairSuccess{ID: alice},
+			jid:         alice,
+			want:        "Alice Smith",
+			wantNames:   Names{PushName: "Al", FullName: "Alice Smith", FirstName: "Alice"},
+			wantSaves:   5,
+		},
+	} {
+		if test.event != nil {
+			if err := c.Handle(test.event); err != nil {
+				t.Errorf("%v: Handle(%T) = %v, need nil error", test.description, test.event, err)
+			}
+		}
+		if got := c.Name(test.jid); got != test.want {
+			t.Errorf("%v: Name(%v) = %q, want %q", test.description, test.jid, got, test.want)
+		}
+		if got, _ := c.Get(test.jid); got != test.wantNames {
+			t.Errorf("%v: Get(%v) = %+v, want %+v", test.description, test.jid, got, test.wantNames)
+		}
+		if store.saves != test.wantSaves {
+			t.Errorf("%v: %d saves, want %d", test.description, store.saves, test.wantSaves)
+		}
+	}
+
+	reloaded, err := NewContacts(store)
+	if err != nil {
+		t.Fatalf("NewContacts(_) = _, %v, need nil error", err)
+	}
+	if got := reloaded.Name(aliceDevice); got != "Alice Smith" {
+		t.Errorf("Name(%v) = %q after reloading, want %q", aliceDevice, got, "Alice Smith")
+	}
+}
+
+func TestContactsStoreErrors(t *testing.T) {
+	if _, err := NewContacts(&memStore{loadErr: errors.New("corrupt")}); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("NewContacts(_) = _, %v, want the load error", err)
+	}
+	c, _ := NewContacts(&memStore{names: map[types.JID]Names{}, saveErr: errors.New("disk full")})
+	jid := types.NewJID("31611111111", types.DefaultUserServer)
+	if err := c.Handle(&events.PushName{JID: jid, NewPushName: "Ally"}); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Handle(_) = %v, want the save error", err)
+	}
+	if got := c.Name(jid); got != "Ally" {
+		t.Errorf("Name(%v) = %q after a failed save, want %q", jid, got, "Ally")
+	}
+	if err := c.Update(types.EmptyJID, Names{PushName: "nobody"}); err == nil {
+		t.Errorf("Update(EmptyJID, _) = nil, want an error")
+	}
+}
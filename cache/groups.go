@@ -0,0 +1,207 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// FetchFunc fetches the metadata of a group, such as the GetGroupInfo method of a
+// *whatsmeow.Client.
+type FetchFunc func(jid types.JID) (*types.GroupInfo, error)
+
+// Groups caches the metadata of groups, so that handlers don't have to fetch it for every event,
+// which is slow and rate limited. A group is fetched when it is first asked for, and then kept up
+// to date by the GroupInfo and JoinedGroup events. When an update can't be applied, because the
+// group isn't cached or an update was missed, the group is fetched again. The zero value isn't
+// usable, use NewGroups.
+type Groups struct {
+	fetch FetchFunc
+
+	mu     sync.Mutex
+	groups map[types.JID]*types.GroupInfo
+}
+
+// NewGroups returns a cache of group metadata that fetches groups with `fetch`, typically
+// client.GetGroupInfo.
+//
+//	groups := cache.NewGroups(client.GetGroupInfo)
+//	groups.Register()
+//	if admin, err := groups.IsAdmin(msg.Info.Chat, msg.Info.Sender); err == nil && admin { ... }
+func NewGroups(fetch FetchFunc) *Groups {
+	return &Groups{fetch: fetch, groups: map[types.JID]*types.GroupInfo{}}
+}
+
+// GroupEvents returns the event types that a Groups cache handles.
+func GroupEvents() []handlers.EventType {
+	return []handlers.EventType{handlers.GroupInfo, handlers.JoinedGroup}
+}
+
+// Register registers the cache for its events, see GroupEvents.
+func (g *Groups) Register() {
+	handlers.RegisterMany(GroupEvents(), g)
+}
+
+// Handle implements handlers.handler for the events of GroupEvents.
+func (g *Groups) Handle(ev interface{}) error {
+	switch v := ev.(type) {
+	case *events.JoinedGroup:
+		info := v.GroupInfo
+		info.Participants = slices.Clone(info.Participants)
+		g.mu.Lock()
+		g.groups[info.JID] = &info
+		g.mu.Unlock()
+	case *events.GroupInfo:
+		if v.Delete != nil {
+			g.Forget(v.JID)
+			return nil
+		}
+		g.mu.Lock()
+		applied := g.apply(v)
+		g.mu.Unlock()
+		if !applied {
+			if _, err := g.refetch(v.JID); err != nil {
+				return fmt.Errorf("cache.Groups.Handle: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("cache.Groups.Handle: unexpected event %T", ev)
+	}
+	return nil
+}
+
+// apply applies an update to a cached group. It returns false when the group isn't cached, or
+// when the update doesn't follow the cached participant version, i.e. an update was missed. The
+// caller holds g.mu.
+func (g *Groups) apply(ev *events.GroupInfo) bool {
+	info, ok := g.groups[ev.JID]
+	if !ok {
+		return false
+	}
+	if ev.PrevParticipantVersionID != "" && info.ParticipantVersionID != "" &&
+		ev.PrevParticipantVersionID != info.ParticipantVersionID {
+		return false
+	}
+	if ev.Name != nil {
+		info.GroupName = *ev.Name
+	}
+	if ev.Topic != nil {
+		info.GroupTopic = *ev.Topic
+	}
+	if ev.Locked != nil {
+		info.GroupLocked = *ev.Locked
+	}
+	if ev.Announce != nil {
+		info.GroupAnnounce = *ev.Announce
+	}
+	if ev.Ephemeral != nil {
+		info.GroupEphemeral = *ev.Ephemeral
+	}
+	for _, jid := range ev.Join {
+		if participant(info, jid) == nil {
+			info.Participants = append(info.Participants, types.GroupParticipant{JID: jid.ToNonAD()})
+		}
+	}
+	for _, jid := range ev.Leave {
+		info.Participants = slices.DeleteFunc(info.Participants, func(p types.GroupParticipant) bool {
+			return same(p, jid)
+		})
+	}
+	for _, jid := range ev.Promote {
+		if p := participant(info, jid); p != nil {
+			p.IsAdmin = true
+		}
+	}
+	for _, jid := range ev.Demote {
+		if p := participant(info, jid); p != nil {
+			p.IsAdmin, p.IsSuperAdmin = false, false
+		}
+	}
+	if ev.ParticipantVersionID != "" {
+		info.ParticipantVersionID = ev.ParticipantVersionID
+	}
+	return true
+}
+
+// same returns whether a participant is a user, by phone number or LID.
+func same(p types.GroupParticipant, user types.JID) bool {
+	user = user.ToNonAD()
+	return p.JID.ToNonAD() == user || !p.LID.IsEmpty() && p.LID.ToNonAD() == user
+}
+
+// participant returns a user in a group, or nil when they aren't a participant.
+func participant(info *types.GroupInfo, user types.JID) *types.GroupParticipant {
+	for i := range info.Participants {
+		if same(info.Participants[i], user) {
+			return &info.Participants[i]
+		}
+	}
+	return nil
+}
+
+// refetch fetches a group, and caches it.
+func (g *Groups) refetch(jid types.JID) (*types.GroupInfo, error) {
+	info, err := g.fetch(jid)
+	if err != nil {
+		return nil, fmt.Errorf("fetching group %v: %w", jid, err)
+	}
+	g.mu.Lock()
+	g.groups[jid] = info
+	g.mu.Unlock()
+	return info, nil
+}
+
+// Forget drops a group from the cache, so that it is fetched again when it is asked for.
+func (g *Groups) Forget(jid types.JID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.groups, jid)
+}
+
+// Info returns a copy of the metadata of a group, which is fetched when it isn't cached.
+func (g *Groups) Info(jid types.JID) (types.GroupInfo, error) {
+	g.mu.Lock()
+	info, ok := g.groups[jid]
+	g.mu.Unlock()
+	if !ok {
+		if _, err := g.refetch(jid); err != nil {
+			return types.GroupInfo{}, fmt.Errorf("cache.Groups.Info: %w", err)
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if info, ok = g.groups[jid]; !ok {
+		return types.GroupInfo{}, fmt.Errorf("cache.Groups.Info: group %v was deleted meanwhile", jid)
+	}
+	c := *info
+	c.Participants = slices.Clone(info.Participants)
+	return c, nil
+}
+
+// Subject returns the subject of a group.
+func (g *Groups) Subject(jid types.JID) (string, error) {
+	info, err := g.Info(jid)
+	return info.Name, err
+}
+
+// Participants returns the participants of a group.
+func (g *Groups) Participants(jid types.JID) ([]types.GroupParticipant, error) {
+	info, err := g.Info(jid)
+	return info.Participants, err
+}
+
+// IsAdmin returns whether a user is an admin (or the super admin) of a group. Users that aren't
+// participants aren't admins.
+func (g *Groups) IsAdmin(jid, user types.JID) (bool, error) {
+	info, err := g.Info(jid)
+	if err != nil {
+		return false, err
+	}
+	p := participant(&info, user)
+	return p != nil && (p.IsAdmin || p.IsSuperAdmin), nil
+}
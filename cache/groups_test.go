@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// fakeServer serves group metadata, and counts the fetches.
+type fakeServer struct {
+	groups  map[types.JID]types.GroupInfo
+	fetches int
+}
+
+func (s *fakeServer) fetch(jid types.JID) (*types.GroupInfo, error) {
+	s.fetches++
+	info, ok := s.groups[jid]
+	if !ok {
+		return nil, errors.New("item-not-found")
+	}
+	info.Participants = append([]types.GroupParticipant(nil), info.Participants...)
+	return &info, nil
+}
+
+func user(n string) types.JID {
+	return types.NewJID(n, types.DefaultUserServer)
+}
+
+// members returns the participants of a group as "user" or "user*" for admins, sorted.
+func members(ps []types.GroupParticipant) string {
+	var ms []string
+	for _, p := range ps {
+		m := p.JID.User
+		if p.IsAdmin || p.IsSuperAdmin {
+			m += "*"
+		}
+		ms = append(ms, m)
+	}
+	sort.Strings(ms)
+	return strings.Join(ms, " ")
+}
+
+func TestGroups(t *testing.T) {
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	info := types.GroupInfo{JID: group, ParticipantVersionID: "v1", Participants: []types.GroupParticipant{
+		{JID: user("1"), IsSuperAdmin: true},
+		{JID: user("2")},
+		{JID: user("3"), LID: types.NewJID("9003", types.HiddenUserServer)},
+	}}
+	info.Name = "Book club"
+	server := &fakeServer{groups: map[types.JID]types.GroupInfo{group: info}}
+	g := NewGroups(server.fetch)
+
+	for _, test := range []struct {
+		description string
+		event       *events.GroupInfo
+		wantSubject string
+		wantMembers string
+		wantFetches int
+	}{
+		{
+			description: "fetched lazily",
+			wantSubject: "Book club",
+			wantMembers: "1* 2 3",
+			wantFetches: 1,
+		},
+		{
+			description: "renamed",
+			event:       &events.GroupInfo{JID: group, Name: &types.GroupName{Name: "Book & wine club"}},
+			wantSubject: "Book & wine club",
+			wantMembers: "1* 2 3",
+			wantFetches: 1,
+		},
+		{
+			description: "joined",
+			event: &events.GroupInfo{
+				JID: group, PrevParticipantVersionID: "v1", ParticipantVersionID: "v2",
+				Join: []types.JID{user("4"), types.NewADJID("5", 0, 3), user("2")},
+			},
+			wantSubject: "Book & wine club",
+			wantMembers: "1* 2 3 4 5",
+			wantFetches: 1,
+		},
+		{
+			description: "promoted, by phone number and LID",
+			event: &events.GroupInfo{
+				JID: group, PrevParticipantVersionID: "v2", ParticipantVersionID: "v3",
+				Promote: []types.JID{user("2"), types.NewJID("9003", types.HiddenUserServer)},
+			},
+			wantSubject: "Book & wine club",
+			wantMembers: "1* 2* 3* 4 5",
+			wantFetches: 1,
+		},
+		{
+			description: "demoted and left",
+			event: &events.GroupInfo{
+				JID: group, PrevParticipantVersionID: "v3", ParticipantVersionID: "v4",
+				Demote: []types.JID{user("1"), user("3")}, Leave: []types.JID{user("2"), user("6")},
+			},
+			wantSubject: "Book & wine club",
+			wantMembers: "1 3 4 5",
+			wantFetches: 1,
+		},
+		{
+			description: "missed update refetches",
+			event: &events.GroupInfo{
+				JID: group, PrevParticipantVersionID: "v7", ParticipantVersionID: "v8", Leave: []types.JID{user("1")},
+			},
+			wantSubject: "Book club",
+			wantMembers: "1* 2 3",
+			wantFetches: 2,
+		},
+		{
+			description: "deleted",
+			event:       &events.GroupInfo{JID: group, Delete: &types.GroupDelete{Deleted: true}},
+			wantSubject: "Book club",
+			wantMembers: "1* 2 3",
+			wantFetches: 3,
+		},
+	} {
+		if test.event != nil {
+			if err := g.Handle(test.event); err != nil {
+				t.Errorf("%v: Handle(_) = %v, need nil error", test.description, err)
+			}
+		}
+		subject, err := g.Subject(group)
+		if err != nil || subject != test.wantSubject {
+			t.Errorf("%v: Subject(_) = %q, %v, want %q", test.description, subject, err, test.wantSubject)
+		}
+		ps, err := g.Participants(group)
+		if got := members(ps); err != nil || got != test.wantMembers {
+			t.Errorf("%v: Participants(_) = %q, %v, want %q", test.description, got, err, test.wantMembers)
+		}
+		if server.fetches != test.wantFetches {
+			t.Errorf("%v: %d fetches, want %d", test.description, server.fetches, test.wantFetches)
+		}
+	}
+}
+
+func TestGroupsSettings(t *testing.T) {
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	server := &fakeServer{groups: map[types.JID]types.GroupInfo{}}
+	g := NewGroups(server.fetch)
+	joined := &events.JoinedGroup{GroupInfo: types.GroupInfo{JID: group, Participants: []types.GroupParticipant{
+		{JID: user("1"), IsAdmin: true},
+	}}}
+	if err := g.Handle(joined); err != nil {
+		t.Errorf("Handle(JoinedGroup) = %v, need nil error", err)
+	}
+	joined.Participants[0].IsAdmin = false // the cache has its own copy
+	err := g.Handle(&events.GroupInfo{
+		JID:       group,
+		Topic:     &types.GroupTopic{Topic: "No spoilers"},
+		Locked:    &types.GroupLocked{IsLocked: true},
+		Announce:  &types.GroupAnnounce{IsAnnounce: true},
+		Ephemeral: &types.GroupEphemeral{IsEphemeral: true, DisappearingTimer: 86400},
+	})
+	if err != nil {
+		t.Errorf("Handle(GroupInfo) = %v, need nil error", err)
+	}
+	info, err := g.Info(group)
+	if err != nil {
+		t.Fatalf("Info(_) = _, %v, need nil error", err)
+	}
+	got := fmt.Sprintf("%q %v %v %v %v", info.Topic, info.IsLocked, info.IsAnnounce, info.IsEphemeral, info.DisappearingTimer)
+	if want := `"No spoilers" true true true 86400`; got != want {
+		t.Errorf("Info(_) has settings %v, want %v", got, want)
+	}
+	for _, test := range []struct {
+		user types.JID
+		want bool
+	}{
+		{user("1"), true},
+		{types.NewADJID("1", 0, 4), true},
+		{user("2"), false},
+	} {
+		if got, err := g.IsAdmin(group, test.user); err != nil || got != test.want {
+			t.Errorf("IsAdmin(_, %v) = %v, %v, want %v", test.user, got, err, test.want)
+		}
+	}
+	if server.fetches != 0 {
+		t.Errorf("%d fetches, want none after JoinedGroup", server.fetches)
+	}
+}
+
+func TestGroupsUnknown(t *testing.T) {
+	group := types.NewJID("120363000000000000", types.GroupServer)
+	server := &fakeServer{groups: map[types.JID]types.GroupInfo{}}
+	g := NewGroups(server.fetch)
+	if _, err := g.Subject(group); err == nil || !strings.Contains(err.Error(), "item-not-found") {
+		t.Errorf("Subject(_) = _, %v, want the fetch error", err)
+	}
+	if err := g.Handle(&events.GroupInfo{JID: group, Join: []types.JID{user("1")}}); err == nil {
+		t.Errorf("Handle(_) = nil for an unknown group that can't be fetched, want an error")
+	}
+	server.groups[group] = types.GroupInfo{JID: group, Participants: []types.GroupParticipant{{JID: user("1")}}}
+	if err := g.Handle(&events.GroupInfo{JID: group, Join: []types.JID{user("1")}}); err != nil {
+		t.Errorf("Handle(_) = %v, need nil error", err)
+	}
+	if ps, err := g.Participants(group); err != nil || members(ps) != "1" {
+		t.Errorf("Participants(_) = %q, %v, want the fetched participants", members(ps), err)
+	}
+	if server.fetches != 3 {
+		t.Errorf("%d fetches, want 3", server.fetches)
+	}
+}
@@ -0,0 +1,178 @@
+// Package chatsettings manages per-chat settings, such as the timer of disappearing messages.
+package chatsettings
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/send"
+	"github.com/KarelKubat/whatsmeow/waiface"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// AllowedTimers are the durations for disappearing messages that official clients offer.
+// Other durations are accepted by the server, but clients don't display them correctly.
+var AllowedTimers = []time.Duration{
+	whatsmeow.DisappearingTimerOff,
+	whatsmeow.DisappearingTimer24Hours,
+	whatsmeow.DisappearingTimer7Days,
+	whatsmeow.DisappearingTimer90Days,
+}
+
+// SetDisappearing sets the timer for disappearing messages in a chat. The duration must be
+// one of AllowedTimers; `whatsmeow.DisappearingTimerOff` disables disappearing messages.
+// When successful, the default cache (if registered, see Register) is updated.
+func SetDisappearing(ctx context.Context, cli waiface.ChatSettingsAPI, chat types.JID, d time.Duration) error {
+	if !allowed(d) {
+		return fmt.Errorf("chatsettings.SetDisappearing: timer %v is not one of %v", d, AllowedTimers)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := cli.SetDisappearingTimer(chat, d); err != nil {
+		return fmt.Errorf("chatsettings.SetDisappearing: %w", err)
+	}
+	if c := registered(); c != nil {
+		c.Set(chat, d)
+	}
+	return nil
+}
+
+func allowed(d time.Duration) bool {
+	for _, a := range AllowedTimers {
+		if d == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Cache holds the ephemeral (disappearing messages) timer per chat. It is fed from GroupInfo,
+// JoinedGroup and Message events, and can be consulted when sending messages so that these
+// carry the expiration that the chat requires.
+type Cache struct {
+	mu     sync.RWMutex
+	timers map[types.JID]time.Duration
+}
+
+// New returns an empty cache.
+func New() *Cache {
+	return &Cache{
+		timers: make(map[types.JID]time.Duration),
+	}
+}
+
+var defaultCache *Cache
+var defaultCacheMutex sync.Mutex
+
+func registered() *Cache {
+	defaultCacheMutex.Lock()
+	defer defaultCacheMutex.Unlock()
+	return defaultCache
+}
+
+// Register binds the cache to the GroupInfo, JoinedGroup and Message events, and adds a
+// `send` hook so that outgoing messages get the expiration of their chat. The cache also
+// becomes the one that SetDisappearing updates. Only one cache should be registered.
+func (c *Cache) Register() {
+	defaultCacheMutex.Lock()
+	defaultCache = c
+	defaultCacheMutex.Unlock()
+
+	handlers.Register(handlers.GroupInfo, c)
+	handlers.Register(handlers.JoinedGroup, c)
+	handlers.Register(handlers.Message, c)
+	send.AddHook(c.Apply)
+}
+
+// Set stores the timer of a chat. A zero duration means that disappearing messages are off.
+func (c *Cache) Set(chat types.JID, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timers[chat.ToNonAD()] = d
+}
+
+// Timer returns the timer of a chat, and whether the chat's setting is known.
+func (c *Cache) Timer(chat types.JID) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	d, ok := c.timers[chat.ToNonAD()]
+	return d, ok
+}
+
+// Handle processes GroupInfo, JoinedGroup and Message events to update the cache. Other events
+// are ignored.
+func (c *Cache) Handle(ev interface{}) error {
+	switch v := ev.(type) {
+	case *events.GroupInfo:
+		if v.Ephemeral != nil {
+			c.Set(v.JID, groupTimer(v.Ephemeral))
+		}
+	case *events.JoinedGroup:
+		c.Set(v.JID, groupTimer(&v.GroupEphemeral))
+	case *events.Message:
+		if pm := v.Message.GetProtocolMessage(); pm != nil {
+			if pm.GetType() == waE2E.ProtocolMessage_EPHEMERAL_SETTING {
+				c.Set(v.Info.Chat, seconds(pm.GetEphemeralExpiration()))
+			}
+			return nil
+		}
+		// A message that carries an expiration tells us what the sender thinks the timer is.
+		// Messages without one don't prove that the timer is off, so those are ignored.
+		if exp := expiration(v.Message); exp > 0 {
+			c.Set(v.Info.Chat, seconds(exp))
+		}
+	}
+	return nil
+}
+
+// Apply is a `send.Hook` that sets the expiration of an outgoing message to the timer of the
+// chat. Messages to chats without a (known) timer are left alone.
+func (c *Cache) Apply(to types.JID, msg *waE2E.Message) error {
+	d, ok := c.Timer(to)
+	if !ok || d == 0 {
+		return nil
+	}
+	if ci := send.ContextInfo(msg); ci != nil {
+		ci.Expiration = proto.Uint32(uint32(d / time.Second))
+	}
+	return nil
+}
+
+func groupTimer(e *types.GroupEphemeral) time.Duration {
+	if !e.IsEphemeral {
+		return 0
+	}
+	return seconds(e.DisappearingTimer)
+}
+
+func seconds(s uint32) time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+// expiration returns the expiration in the context info of a received message, or 0.
+func expiration(msg *waE2E.Message) uint32 {
+	for _, ci := range []*waE2E.ContextInfo{
+		msg.GetExtendedTextMessage().GetContextInfo(),
+		msg.GetImageMessage().GetContextInfo(),
+		msg.GetVideoMessage().GetContextInfo(),
+		msg.GetAudioMessage().GetContextInfo(),
+		msg.GetDocumentMessage().GetContextInfo(),
+		msg.GetStickerMessage().GetContextInfo(),
+		msg.GetLocationMessage().GetContextInfo(),
+		msg.GetContactMessage().GetContextInfo(),
+	} {
+		if exp := ci.GetExpiration(); exp > 0 {
+			return exp
+		}
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package chatsettings
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+type fakeClient struct {
+	timers map[types.JID]time.Duration
+}
+
+func (f *fakeClient) SetDisappearingTimer(chat types.JID, timer time.Duration) error {
+	f.timers[chat] = timer
+	return nil
+}
+
+// TestSetDisappearing checks that only allowed durations are passed to the client.
+func TestSetDisappearing(t *testing.T) {
+	cli := &fakeClient{timers: map[types.JID]time.Duration{}}
+	chat := types.NewJID("123", types.DefaultUserServer)
+
+	for _, test := range []struct {
+		d       time.Duration
+		wantErr bool
+	}{
+		{d: whatsmeow.DisappearingTimer7Days},
+		{d: whatsmeow.DisappearingTimerOff},
+		{d: time.Hour, wantErr: true},
+	} {
+		err := SetDisappearing(context.Background(), cli, chat, test.d)
+		if (err != nil) != test.wantErr {
+			t.Errorf("SetDisappearing(_, _, _, %v) = %v, want error: %v", test.d, err, test.wantErr)
+		}
+		if !test.wantErr && cli.timers[chat] != test.d {
+			t.Errorf("SetDisappearing(_, _, _, %v): client got timer %v", test.d, cli.timers[chat])
+		}
+	}
+}
+
+// TestCacheFeeding checks that events update the cache.
+func TestCacheFeeding(t *testing.T) {
+	c := New()
+	group := types.NewJID("456", types.GroupServer)
+	chat := types.NewJID("123", types.DefaultUserServer)
+
+	c.Handle(&events.GroupInfo{
+		JID:       group,
+		Ephemeral: &types.GroupEphemeral{IsEphemeral: true, DisappearingTimer: 86400},
+	})
+	if d, ok := c.Timer(group); !ok || d != whatsmeow.DisappearingTimer24Hours {
+		t.Errorf("group timer = %v, %v; want 24h, true", d, ok)
+	}
+
+	c.Handle(&events.Message{
+		Info: types.MessageInfo{MessageSource: types.MessageSource{Chat: chat}},
+		Message: &waE2E.Message{
+			ProtocolMessage: &waE2E.ProtocolMessage{
+				Type:                waE2E.ProtocolMessage_EPHEMERAL_SETTING.Enum(),
+				EphemeralExpiration: proto.Uint32(7776000),
+			},
+		},
+	})
+	if d, _ := c.Timer(chat); d != whatsmeow.DisappearingTimer90Days {
+		t.Errorf("chat timer = %v, want 90 days", d)
+	}
+}
+
+// TestApply checks that an outgoing message to a chat with a 7-day timer gets the expiration.
+func TestApply(t *testing.T) {
+	c := New()
+	chat := types.NewJID("123", types.DefaultUserServer)
+	other := types.NewJID("789", types.DefaultUserServer)
+	c.Set(chat, whatsmeow.DisappearingTimer7Days)
+
+	msg := &waE2E.Message{Conversation: proto.String("hello")}
+	if err := c.Apply(chat, msg); err != nil {
+		t.Fatalf("Apply(_) = %v, need nil error", err)
+	}
+	if got := msg.GetExtendedTextMessage().GetContextInfo().GetExpiration(); got != 604800 {
+		t.Errorf("expiration = %v, want 604800", got)
+	}
+	if got := msg.GetExtendedTextMessage().GetText(); got != "hello" {
+		t.Errorf("text = %q, want %q", got, "hello")
+	}
+
+	img := &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Caption: proto.String("pic")}}
+	c.Apply(chat, img)
+	if got := img.GetImageMessage().GetContextInfo().GetExpiration(); got != 604800 {
+		t.Errorf("image expiration = %v, want 604800", got)
+	}
+
+	plain := &waE2E.Message{Conversation: proto.String("hello")}
+	c.Apply(other, plain)
+	if plain.GetConversation() != "hello" || plain.ExtendedTextMessage != nil {
+		t.Errorf("message to chat without timer was modified: %v", plain)
+	}
+}
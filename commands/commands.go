@@ -0,0 +1,121 @@
+// Package commands routes text messages such as "!help" or "!remind 10m tea" to the functions
+// that handle them.
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// CommandFunc handles a command. `args` are the words after the command; quoted words may
+// contain spaces.
+type CommandFunc func(m *events.Message, args []string) error
+
+// FallbackFunc handles a command that no CommandFunc was registered for. `cmd` is in lower case.
+type FallbackFunc func(m *events.Message, cmd string, args []string) error
+
+// Router routes the messages that start with a prefix to the function of their command. Commands
+// are matched case-insensitively. Messages without text or without the prefix are ignored. The
+// zero value isn't usable, use NewCommandRouter.
+type Router struct {
+	prefix string
+
+	mu       sync.RWMutex
+	commands map[string]CommandFunc
+	fallback FallbackFunc
+}
+
+// NewCommandRouter returns a router for commands that start with `prefix`, e.g. "!".
+func NewCommandRouter(prefix string) *Router {
+	return &Router{
+		prefix:   prefix,
+		commands: map[string]CommandFunc{},
+	}
+}
+
+// Command registers the function of a command, such as "help" for "!help". A later registration
+// of the same command replaces the earlier one.
+func (r *Router) Command(name string, f CommandFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands[strings.ToLower(name)] = f
+}
+
+// Fallback registers the function for commands that have no function of their own. Without a
+// fallback, unknown commands are ignored.
+func (r *Router) Fallback(f FallbackFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = f
+}
+
+// Register registers the router for Message events.
+func (r *Router) Register() {
+	handlers.Register(handlers.Message, r)
+}
+
+// Handle implements handlers.handler for Message events.
+func (r *Router) Handle(ev interface{}) error {
+	m, ok := ev.(*events.Message)
+	if !ok {
+		return fmt.Errorf("commands.Router.Handle: unexpected event %T", ev)
+	}
+	text := m.Message.GetConversation()
+	if text == "" {
+		text = m.Message.GetExtendedTextMessage().GetText()
+	}
+	if !strings.HasPrefix(text, r.prefix) {
+		return nil
+	}
+	words := Split(strings.TrimPrefix(text, r.prefix))
+	if len(words) == 0 {
+		return nil
+	}
+	cmd, args := strings.ToLower(words[0]), words[1:]
+
+	r.mu.RLock()
+	f, fallback := r.commands[cmd], r.fallback
+	r.mu.RUnlock()
+	switch {
+	case f != nil:
+		return f(m, args)
+	case fallback != nil:
+		return fallback(m, cmd, args)
+	}
+	return nil
+}
+
+// Split splits a text into words at white space. Double quotes group words with spaces into
+// one: `remind "buy tea" 10m` is "remind", "buy tea" and "10m". An unterminated quote runs to
+// the end of the text.
+func Split(text string) []string {
+	var words []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, c := range text {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(c) && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRouter(t *testing.T) {
+	r := NewCommandRouter("!")
+	var got []string
+	r.Command("help", func(m *events.Message, args []string) error {
+		got = append(got, fmt.Sprintf("help %q", args))
+		return nil
+	})
+	r.Command("Remind", func(m *events.Message, args []string) error {
+		got = append(got, fmt.Sprintf("remind %q from %v", args, m.Info.ID))
+		return nil
+	})
+
+	conversation := func(text string) *events.Message {
+		m := &events.Message{Message: &waE2E.Message{Conversation: proto.String(text)}}
+		m.Info.ID = "C"
+		return m
+	}
+	extended := func(text string) *events.Message {
+		m := &events.Message{Message: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: proto.String(text)}}}
+		m.Info.ID = "E"
+		return m
+	}
+	image := &events.Message{Message: &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Caption: proto.String("!help")}}}
+
+	for _, test := range []struct {
+		description string
+		m           *events.Message
+		want        string
+	}{
+		{"command", conversation("!help"), `[help []]`},
+		{"arguments", conversation("!help  me   now"), `[help ["me" "now"]]`},
+		{"case-insensitive", extended("!REMIND \"buy tea\" 10m"), `[remind ["buy tea" "10m"] from E]`},
+		{"no prefix", conversation("help"), `[]`},
+		{"prefix only", conversation("! "), `[]`},
+		{"unknown command without fallback", conversation("!nope"), `[]`},
+		{"not a text", image, `[]`},
+	} {
+		got = nil
+		if err := r.Handle(test.m); err != nil {
+			t.Errorf("%v: Handle(_) = %v, need nil error", test.description, err)
+		}
+		if fmt.Sprint(got) != test.want {
+			t.Errorf("%v: routed %v, want %v", test.description, got, test.want)
+		}
+	}
+
+	r.Fallback(func(m *events.Message, cmd string, args []string) error {
+		got = append(got, fmt.Sprintf("unknown %v %q", cmd, args))
+		return nil
+	})
+	got = nil
+	r.Handle(conversation("!Nope x"))
+	if want := `[unknown nope ["x"]]`; fmt.Sprint(got) != want {
+		t.Errorf("routed %v, want %v", got, want)
+	}
+
+	if err := r.Handle(&events.Receipt{}); err == nil {
+		t.Errorf("Handle(*events.Receipt) = nil, need error")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want string
+	}{
+		{"", `[]`},
+		{"a b\tc\nd", `["a" "b" "c" "d"]`},
+		{`say "hello world" now`, `["say" "hello world" "now"]`},
+		{`empty "" arg`, `["empty" "" "arg"]`},
+		{`open "quote`, `["open" "quote"]`},
+	} {
+		if got := fmt.Sprintf("%q", Split(test.text)); got != test.want {
+			t.Errorf("Split(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package connmetrics keeps trend data about the connection to WhatsApp: keepalive latencies,
+// keepalive outages, disconnects and the time it takes to reconnect, over the last hour and the
+// last day.
+package connmetrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Spans of the windows that are reported.
+const (
+	Hour = time.Hour
+	Day  = 24 * time.Hour
+)
+
+var now = time.Now
+
+// Percentiles summarizes a set of durations.
+type Percentiles struct {
+	Count int
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// Window holds the metrics of a span of time that ends now.
+type Window struct {
+	Span              time.Duration
+	Disconnects       int         // Disconnected events
+	KeepAliveTimeouts int         // keepalive outages that started, not the individual failed keepalives
+	Latency           Percentiles // keepalive round-trips, see Metrics.ObserveLatency
+	Outage            Percentiles // from the last successful keepalive until KeepAliveRestored
+	Reconnect         Percentiles // from Disconnected until Connected
+}
+
+// Totals are counts since New, which are never pruned. They suit monitoring systems that compute
+// rates themselves.
+type Totals struct {
+	Disconnects       int64
+	Reconnects        int64
+	KeepAliveTimeouts int64
+}
+
+// Stats is a snapshot of the metrics.
+type Stats struct {
+	Connected bool
+	LastHour  Window
+	LastDay   Window
+	Totals    Totals
+}
+
+// sample is a duration that was observed at a point in time.
+type sample struct {
+	at time.Time
+	d  time.Duration
+}
+
+// Metrics collects connection metrics. The zero value isn't usable, use New.
+type Metrics struct {
+	mu             sync.Mutex
+	connected      bool
+	disconnectedAt time.Time // zero when connected, or when the disconnect wasn't seen
+	lastSuccess    time.Time // of the keepalive, zero when keepalives don't time out
+	disconnects    []time.Time
+	timeouts       []time.Time
+	latencies      []sample
+	outages        []sample
+	reconnects     []sample
+	totals         Totals
+}
+
+// New returns an empty set of metrics.
+func New() *Metrics {
+	return &Metrics{}
+}
+
+// Register registers the metrics for the events that they feed from.
+func (m *Metrics) Register() {
+	handlers.Register(handlers.Connected, m)
+	handlers.Register(handlers.Disconnected, m)
+	handlers.Register(handlers.KeepAliveTimeout, m)
+	handlers.Register(handlers.KeepAliveRestored, m)
+}
+
+// Handle implements handlers.handler for Connected, Disconnected, KeepAliveTimeout and
+// KeepAliveRestored events.
+func (m *Metrics) Handle(ev interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	switch v := ev.(type) {
+	case *events.Connected:
+		if !m.disconnectedAt.IsZero() {
+			m.reconnects = append(m.reconnects, sample{at: t, d: t.Sub(m.disconnectedAt)})
+			m.totals.Reconnects++
+		}
+		m.connected = true
+		m.disconnectedAt = time.Time{}
+		m.lastSuccess = time.Time{}
+	case *events.Disconnected:
+		m.disconnects = append(m.disconnects, t)
+		m.totals.Disconnects++
+		if m.connected || m.disconnectedAt.IsZero() {
+			m.disconnectedAt = t
+		}
+		m.connected = false
+	case *events.KeepAliveTimeout:
+		if m.lastSuccess.IsZero() {
+			m.timeouts = append(m.timeouts, t)
+			m.totals.KeepAliveTimeouts++
+			m.lastSuccess = v.LastSuccess
+			if m.lastSuccess.IsZero() {
+				m.lastSuccess = t
+			}
+		}
+	case *events.KeepAliveRestored:
+		if !m.lastSuccess.IsZero() {
+			m.outages = append(m.outages, sample{at: t, d: t.Sub(m.lastSuccess)})
+			m.lastSuccess = time.Time{}
+		}
+	default:
+		return fmt.Errorf("connmetrics.Metrics.Handle: unexpected event %T", ev)
+	}
+	m.prune(t)
+	return nil
+}
+
+// ObserveLatency records the round-trip time of a keepalive. whatsmeow doesn't report these,
+// so they come from a probe of the caller, see Time.
+func (m *Metrics) ObserveLatency(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	m.latencies = append(m.latencies, sample{at: t, d: d})
+	m.prune(t)
+}
+
+// Time runs a round-trip to the server, such as `client.GetUserDevices` for the own JID, and
+// records how long it took as a keepalive latency. Failed round-trips aren't recorded.
+func (m *Metrics) Time(roundTrip func() error) error {
+	start := now()
+	if err := roundTrip(); err != nil {
+		return err
+	}
+	m.ObserveLatency(now().Sub(start))
+	return nil
+}
+
+// Stats returns a snapshot of the metrics.
+func (m *Metrics) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	m.prune(t)
+	return Stats{
+		Connected: m.connected,
+		LastHour:  m.window(t, Hour),
+		LastDay:   m.window(t, Day),
+		Totals:    m.totals,
+	}
+}
+
+// Publish publishes the stats as an expvar, e.g. under "connection". Like `expvar.Publish`,
+// it panics when the name is already taken.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.Stats()
+	}))
+}
+
+// ServeHTTP serves the stats as JSON, so that they can be added to a health or status page.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.Stats()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// prune drops what is older than the longest window.
+func (m *Metrics) prune(t time.Time) {
+	cutoff := t.Add(-Day)
+	m.disconnects = pruneTimes(m.disconnects, cutoff)
+	m.timeouts = pruneTimes(m.timeouts, cutoff)
+	m.latencies = pruneSamples(m.latencies, cutoff)
+	m.outages = pruneSamples(m.outages, cutoff)
+	m.reconnects = pruneSamples(m.reconnects, cutoff)
+}
+
+func (m *Metrics) window(t time.Time, span time.Duration) Window {
+	cutoff := t.Add(-span)
+	return Window{
+		Span:              span,
+		Disconnects:       len(pruneTimes(m.disconnects, cutoff)),
+		KeepAliveTimeouts: len(pruneTimes(m.timeouts, cutoff)),
+		Latency:           percentiles(pruneSamples(m.latencies, cutoff)),
+		Outage:            percentiles(pruneSamples(m.outages, cutoff)),
+		Reconnect:         percentiles(pruneSamples(m.reconnects, cutoff)),
+	}
+}
+
+// pruneTimes returns the times after the cutoff. The times are in the order of occurrence.
+func pruneTimes(ts []time.Time, cutoff time.Time) []time.Time {
+	i := sort.Search(len(ts), func(i int) bool { return ts[i].After(cutoff) })
+	return ts[i:]
+}
+
+// pruneSamples returns the samples after the cutoff. The samples are in the order of occurrence.
+func pruneSamples(ss []sample, cutoff time.Time) []sample {
+	i := sort.Search(len(ss), func(i int) bool { return ss[i].at.After(cutoff) })
+	return ss[i:]
+}
+
+// percentiles computes nearest-rank percentiles.
+func percentiles(ss []sample) Percentiles {
+	if len(ss) == 0 {
+		return Percentiles{}
+	}
+	ds := make([]time.Duration, len(ss))
+	for i, s := range ss {
+		ds[i] = s.d
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	rank := func(p float64) time.Duration {
+		return ds[int(math.Ceil(p/100*float64(len(ds))))-1]
+	}
+	return Percentiles{
+		Count: len(ds),
+		P50:   rank(50),
+		P90:   rank(90),
+		P99:   rank(99),
+		Max:   ds[len(ds)-1],
+	}
+}
@@ -0,0 +1,172 @@
+package connmetrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// fakeClock is swapped in for `now`, and advanced by the tests.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func withFakeClock(t *testing.T) *fakeClock {
+	c := &fakeClock{t: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}
+	old := now
+	now = c.now
+	t.Cleanup(func() { now = old })
+	return c
+}
+
+func TestPercentiles(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		durations   []time.Duration
+		want        Percentiles
+	}{
+		{
+			description: "empty",
+		},
+		{
+			description: "single",
+			durations:   []time.Duration{5},
+			want:        Percentiles{Count: 1, P50: 5, P90: 5, P99: 5, Max: 5},
+		},
+		{
+			description: "unsorted",
+			durations:   []time.Duration{10, 1, 9, 2, 8, 3, 7, 4, 6, 5},
+			want:        Percentiles{Count: 10, P50: 5, P90: 9, P99: 10, Max: 10},
+		},
+	} {
+		var ss []sample
+		for _, d := range test.durations {
+			ss = append(ss, sample{d: d})
+		}
+		if got := percentiles(ss); got != test.want {
+			t.Errorf("%v: percentiles(%v) = %+v, want %+v", test.description, test.durations, got, test.want)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	c := withFakeClock(t)
+	m := New()
+	feed := func(ev interface{}) {
+		t.Helper()
+		if err := m.Handle(ev); err != nil {
+			t.Fatalf("Handle(%T) = %v, need nil error", ev, err)
+		}
+	}
+
+	// A day ago: connected, one disconnect with a 30s reconnect, and some latencies.
+	feed(&events.Connected{})
+	for i := 1; i <= 10; i++ {
+		m.ObserveLatency(time.Duration(i) * 100 * time.Millisecond)
+	}
+	feed(&events.Disconnected{})
+	c.t = c.t.Add(30 * time.Second)
+	feed(&events.Connected{})
+
+	// 22 hours later: two keepalive failures of one outage, restored after 20s in total.
+	c.t = c.t.Add(22 * time.Hour)
+	lastSuccess := c.t.Add(-5 * time.Second)
+	feed(&events.KeepAliveTimeout{ErrorCount: 1, LastSuccess: lastSuccess})
+	c.t = c.t.Add(10 * time.Second)
+	feed(&events.KeepAliveTimeout{ErrorCount: 2, LastSuccess: lastSuccess})
+	c.t = c.t.Add(5 * time.Second)
+	feed(&events.KeepAliveRestored{})
+
+	// Within the last hour: a disconnect with a 2 minute reconnect, and one latency. Repeated
+	// Disconnected events while reconnecting count as disconnects, but the reconnect time runs
+	// from the first one.
+	c.t = c.t.Add(time.Hour)
+	feed(&events.Disconnected{})
+	c.t = c.t.Add(time.Minute)
+	feed(&events.Disconnected{})
+	c.t = c.t.Add(time.Minute)
+	feed(&events.Connected{})
+	m.ObserveLatency(2 * time.Second)
+
+	got := m.Stats()
+	want := Stats{
+		Connected: true,
+		LastHour: Window{
+			Span:        Hour,
+			Disconnects: 2,
+			Latency:     Percentiles{Count: 1, P50: 2 * time.Second, P90: 2 * time.Second, P99: 2 * time.Second, Max: 2 * time.Second},
+			Reconnect:   Percentiles{Count: 1, P50: 2 * time.Minute, P90: 2 * time.Minute, P99: 2 * time.Minute, Max: 2 * time.Minute},
+		},
+		LastDay: Window{
+			Span:              Day,
+			Disconnects:       3,
+			KeepAliveTimeouts: 1,
+			Latency:           Percentiles{Count: 11, P50: 600 * time.Millisecond, P90: time.Second, P99: 2 * time.Second, Max: 2 * time.Second},
+			Outage:            Percentiles{Count: 1, P50: 20 * time.Second, P90: 20 * time.Second, P99: 20 * time.Second, Max: 20 * time.Second},
+			Reconnect:         Percentiles{Count: 2, P50: 30 * time.Second, P90: 2 * time.Minute, P99: 2 * time.Minute, Max: 2 * time.Minute},
+		}, Totals: Totals{Disconnects: 3, Reconnects: 2, KeepAliveTimeouts: 1},
+	}
+	if got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	// An hour later, the first day has passed.
+	c.t = c.t.Add(time.Hour)
+	got = m.Stats()
+	if got.LastHour != (Window{Span: Hour}) {
+		t.Errorf("Stats().LastHour = %+v, want an empty window", got.LastHour)
+	}
+	if got.LastDay.Disconnects != 2 || got.LastDay.Latency.Count != 1 || got.LastDay.Reconnect.Count != 1 {
+		t.Errorf("Stats().LastDay = %+v, want 2 disconnects, 1 latency and 1 reconnect", got.LastDay)
+	}
+	if got.Totals.Disconnects != 3 {
+		t.Errorf("Stats().Totals = %+v, want 3 disconnects", got.Totals)
+	}
+}
+
+func TestTime(t *testing.T) {
+	c := withFakeClock(t)
+	errTest := errors.New("test error")
+	m := New()
+	if err := m.Time(func() error {
+		c.t = c.t.Add(300 * time.Millisecond)
+		return nil
+	}); err != nil {
+		t.Fatalf("Time(_) = %v, need nil error", err)
+	}
+	if err := m.Time(func() error { return errTest }); err != errTest {
+		t.Fatalf("Time(_) = %v, want %v", err, errTest)
+	}
+	if got := m.Stats().LastHour.Latency; got.Count != 1 || got.Max != 300*time.Millisecond {
+		t.Errorf("Stats().LastHour.Latency = %+v, want one latency of 300ms", got)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	withFakeClock(t)
+	m := New()
+	m.Handle(&events.Connected{})
+	m.Handle(&events.Disconnected{})
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/connection", nil))
+	var got Stats
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+	if got.Connected || got.LastHour.Disconnects != 1 {
+		t.Errorf("served %+v, want disconnected with 1 disconnect", got)
+	}
+}
+
+func TestHandleUnexpected(t *testing.T) {
+	if err := New().Handle(&events.Message{}); err == nil {
+		t.Errorf("Handle(*events.Message) = nil, need error")
+	}
+}
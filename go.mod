@@ -1,12 +1,26 @@
 module github.com/KarelKubat/whatsmeow
 
-go 1.19
+go 1.21
 
-require go.mau.fi/whatsmeow v0.0.0-20220912085258-5c8577b8ac6f
+require (
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	go.mau.fi/whatsmeow v0.0.0-20240625083845-6acab596dd8c
+	golang.org/x/crypto v0.23.0
+	golang.org/x/image v0.18.0
+	golang.org/x/time v0.5.0
+	google.golang.org/protobuf v1.33.0
+)
 
 require (
 	filippo.io/edwards25519 v1.0.0 // indirect
-	go.mau.fi/libsignal v0.0.0-20220628090436-4d18b66b087e // indirect
-	golang.org/x/crypto v0.0.0-20220622213112-05595931fe9d // indirect
-	google.golang.org/protobuf v1.28.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/websocket v1.5.0 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/rs/zerolog v1.32.0 // indirect
+	go.mau.fi/libsignal v0.1.0 // indirect
+	go.mau.fi/util v0.4.1 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
 )
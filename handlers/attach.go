@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/KarelKubat/whatsmeow/waiface"
+
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// AttachOption configures Attach.
+type AttachOption func(*attachment)
+
+// attachment is the configuration of Attach.
+type attachment struct {
+	onError         func(evt interface{}, err *DispatchError)
+	log             waLog.Logger
+	ignoreUnhandled bool
+}
+
+// AttachOnError sets a callback for the dispatch errors.
+func AttachOnError(f func(evt interface{}, err *DispatchError)) AttachOption {
+	return func(a *attachment) { a.onError = f }
+}
+
+// AttachLogger logs the dispatch errors: NoHandlerFound at debug level, and the others as
+// errors.
+func AttachLogger(log waLog.Logger) AttachOption {
+	return func(a *attachment) { a.log = log }
+}
+
+// AttachIgnoreUnhandled leaves out the NoHandlerFound errors, of events without handlers.
+func AttachIgnoreUnhandled() AttachOption {
+	return func(a *attachment) { a.ignoreUnhandled = true }
+}
+
+// Attach registers the dispatcher as an event handler of a client, such as a *whatsmeow.Client,
+// so that the events of the client are dispatched, and returns a function that removes it again.
+// Without options, dispatch errors are dropped; see AttachOnError and AttachLogger.
+//
+//	detach := d.Attach(client, handlers.AttachLogger(log), handlers.AttachIgnoreUnhandled())
+//	defer detach()
+func (d *Dispatcher) Attach(client waiface.EventSource, opts ...AttachOption) (detach func()) {
+	var a attachment
+	for _, o := range opts {
+		o(&a)
+	}
+	id := client.AddEventHandler(func(evt interface{}) {
+		err := d.Dispatch(evt)
+		if err == nil || (a.ignoreUnhandled && err.Type == NoHandlerFound) {
+			return
+		}
+		if a.log != nil {
+			if err.Type == NoHandlerFound {
+				a.log.Debugf("%v", err)
+			} else {
+				a.log.Errorf("%v", err)
+			}
+		}
+		if a.onError != nil {
+			a.onError(evt, err)
+		}
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() { client.RemoveEventHandler(id) })
+	}
+}
+
+// Attach registers the default dispatcher as an event handler of a client, see
+// Dispatcher.Attach.
+func Attach(client waiface.EventSource, opts ...AttachOption) (detach func()) {
+	return defaultDispatcher.Attach(client, opts...)
+}
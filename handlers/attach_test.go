@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/waifacetest"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestAttach(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		opts        func(log memLogger, errs *[]string) []AttachOption
+		wantLog     string
+		wantErrs    string
+	}{
+		{
+			description: "without options",
+			opts:        func(memLogger, *[]string) []AttachOption { return nil },
+		},
+		{
+			description: "logged",
+			opts: func(log memLogger, _ *[]string) []AttachOption {
+				return []AttachOption{AttachLogger(log)}
+			},
+			wantLog: "ERROR handler 0 (persistence.Store) for Message failed: disk full|" +
+				"DEBUG no handler for event Connected (*events.Connected)",
+		},
+		{
+			description: "callback, ignoring unhandled events",
+			opts: func(_ memLogger, errs *[]string) []AttachOption {
+				return []AttachOption{AttachIgnoreUnhandled(), AttachOnError(func(evt interface{}, err *DispatchError) {
+					*errs = append(*errs, err.Type.String()+" "+evt.(*events.Message).Info.ID)
+				})}
+			},
+			wantErrs: "HandlerFailed M1",
+		},
+	} {
+		var lines, errs []string
+		d := New()
+		d.Register(Message, namedHandler{})
+		fake := waifacetest.New()
+		detach := d.Attach(fake, test.opts(memLogger{lines: &lines}, &errs)...)
+
+		fake.Inject(message("M1"), &events.Connected{})
+		if got := strings.Join(lines, "|"); got != test.wantLog {
+			t.Errorf("%v: logged %q, want %q", test.description, got, test.wantLog)
+		}
+		if got := strings.Join(errs, "|"); got != test.wantErrs {
+			t.Errorf("%v: errors %q, want %q", test.description, got, test.wantErrs)
+		}
+
+		detach()
+		detach()
+		lines, errs = nil, nil
+		fake.Inject(message("M2"))
+		if s := d.Stats()[Message]; s.Dispatched != 1 {
+			t.Errorf("%v: Stats()[Message].Dispatched = %d after detaching, want 1", test.description, s.Dispatched)
+		}
+	}
+}
+
+func TestAttachDefault(t *testing.T) {
+	t.Cleanup(func() { UnregisterAll(Connected) })
+	var got []interface{}
+	Register(Connected, handlerFunc(func(ev interface{}) error {
+		got = append(got, ev)
+		return nil
+	}))
+	fake := waifacetest.New()
+	detach := Attach(fake, AttachOnError(func(evt interface{}, err *DispatchError) {
+		t.Errorf("dispatching %T failed: %v", evt, errors.Unwrap(err))
+	}))
+	defer detach()
+	fake.Inject(&events.Connected{})
+	if len(got) != 1 {
+		t.Errorf("handler saw %v, want a Connected event", got)
+	}
+}
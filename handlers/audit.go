@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// DefaultAuditPayload is the length to which an audit handler truncates the payload summary,
+// unless set with AuditPayload.
+const DefaultAuditPayload = 200
+
+// AuditOption configures an audit handler, see NewAuditHandler.
+type AuditOption func(*AuditHandler)
+
+// AuditRedact makes an audit handler leave out the payload of the events that carry message
+// content, such as messages, edits and history syncs, so that their bodies don't end up in the
+// log.
+func AuditRedact() AuditOption {
+	return func(a *AuditHandler) { a.redact = true }
+}
+
+// AuditSkip makes an audit handler skip events of noisy types, such as Presence.
+func AuditSkip(types ...EventType) AuditOption {
+	return func(a *AuditHandler) {
+		for _, t := range types {
+			a.skip[t] = true
+		}
+	}
+}
+
+// AuditPayload sets the length to which the payload summary is truncated; zero leaves out the
+// payload.
+func AuditPayload(n int) AuditOption {
+	return func(a *AuditHandler) { a.payload = n }
+}
+
+// AuditHandler logs every event that it gets at debug level: the event type, the chat and sender
+// and the message IDs when the event has them, and a truncated summary of the payload. It is
+// meant to be registered as a catch-all. Use NewAuditHandler.
+type AuditHandler struct {
+	log     waLog.Logger
+	redact  bool
+	skip    map[EventType]bool
+	payload int
+}
+
+// NewAuditHandler returns an audit handler that logs to any waLog.Logger, such as one of package
+// logger with Verbose set, or a Sub of the client's logger:
+//
+//	handlers.Register(handlers.AnyEvent, handlers.NewAuditHandler(log, handlers.AuditRedact(),
+//		handlers.AuditSkip(handlers.Presence, handlers.ChatPresence)))
+func NewAuditHandler(log waLog.Logger, opts ...AuditOption) *AuditHandler {
+	a := &AuditHandler{
+		log:     log,
+		skip:    map[EventType]bool{},
+		payload: DefaultAuditPayload,
+	}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// Handle implements handlers.handler for events of any type.
+func (a *AuditHandler) Handle(ev interface{}) error {
+	t, _ := EventTypeOf(ev)
+	return a.HandleTyped(t, ev)
+}
+
+// HandleTyped implements TypedHandler, so that derived events are logged under their own type.
+func (a *AuditHandler) HandleTyped(t EventType, ev interface{}) error {
+	if a.skip[t] {
+		return nil
+	}
+	a.log.Debugf("%s", a.line(t, ev))
+	return nil
+}
+
+// line returns the log line of an event.
+func (a *AuditHandler) line(t EventType, ev interface{}) string {
+	var b strings.Builder
+	b.WriteString(t.String())
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, " %s=%s", name, value)
+		}
+	}
+	field("chat", ChatKey(ev))
+	field("sender", SenderKey(ev))
+	switch v := ev.(type) {
+	case *events.Message:
+		field("id", v.Info.ID)
+	case *events.Receipt:
+		field("ids", strings.Join(v.MessageIDs, ","))
+	}
+	if a.payload <= 0 {
+		return b.String()
+	}
+	payload := fmt.Sprintf("%+v", ev)
+	if a.redact && carriesContent(ev) {
+		payload = "[redacted]"
+	}
+	if r := []rune(payload); len(r) > a.payload {
+		payload = string(r[:a.payload]) + "..."
+	}
+	field("payload", payload)
+	return b.String()
+}
+
+// carriesContent returns whether an event carries the content of messages.
+func carriesContent(ev interface{}) bool {
+	switch ev.(type) {
+	case *events.Message, *events.FBMessage, *events.HistorySync, *Edit, *Revoke, *Sticker:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// memLogger is a waLog.Logger that keeps the lines in memory.
+type memLogger struct {
+	lines *[]string
+}
+
+func (l memLogger) add(level, msg string, args ...interface{}) {
+	*l.lines = append(*l.lines, level+" "+fmt.Sprintf(msg, args...))
+}
+
+func (l memLogger) Warnf(msg string, args ...interface{})  { l.add("WARN", msg, args...) }
+func (l memLogger) Errorf(msg string, args ...interface{}) { l.add("ERROR", msg, args...) }
+func (l memLogger) Infof(msg string, args ...interface{})  { l.add("INFO", msg, args...) }
+func (l memLogger) Debugf(msg string, args ...interface{}) { l.add("DEBUG", msg, args...) }
+func (l memLogger) Sub(module string) waLog.Logger         { return l }
+
+func TestAuditHandler(t *testing.T) {
+	chat := types.NewJID("123", types.GroupServer)
+	sender := types.NewJID("456", types.DefaultUserServer)
+	m := &events.Message{Message: &waE2E.Message{Conversation: proto.String("secret plans")}}
+	m.Info.Chat, m.Info.Sender, m.Info.ID = chat, sender, "M1"
+	r := &events.Receipt{MessageIDs: []types.MessageID{"M1", "M2"}, Type: types.ReceiptTypeRead}
+	r.Chat, r.Sender = chat, sender
+
+	for _, test := range []struct {
+		description string
+		opts        []AuditOption
+		want        []string
+	}{
+		{
+			description: "without payload",
+			opts:        []AuditOption{AuditPayload(0)},
+			want: []string{
+				"DEBUG Message chat=123@g.us sender=456@s.whatsapp.net id=M1",
+				"DEBUG Receipt chat=123@g.us sender=456@s.whatsapp.net ids=M1,M2",
+				"DEBUG Presence",
+			},
+		},
+		{
+			description: "redacted, without presences",
+			opts:        []AuditOption{AuditRedact(), AuditSkip(Presence), AuditPayload(20)},
+			want: []string{
+				"DEBUG Message chat=123@g.us sender=456@s.whatsapp.net id=M1 payload=[redacted]",
+				"DEBUG Receipt chat=123@g.us sender=456@s.whatsapp.net ids=M1,M2 payload=" + fmt.Sprintf("%+v", r)[:20] + "...",
+			},
+		},
+	} {
+		var lines []string
+		d := New()
+		d.Register(AnyEvent, NewAuditHandler(memLogger{&lines}, test.opts...))
+		for _, evt := range []interface{}{m, r, &events.Presence{}} {
+			if err := d.Dispatch(evt); err != nil {
+				t.Errorf("%v: Dispatch(%T) = %v, need nil error", test.description, evt, err)
+			}
+		}
+		if got, want := strings.Join(lines, "\n"), strings.Join(test.want, "\n"); got != want {
+			t.Errorf("%v: logged\n%v\nwant\n%v", test.description, got, want)
+		}
+	}
+
+	// Without redaction, message bodies are in the payload.
+	var lines []string
+	NewAuditHandler(memLogger{&lines}, AuditPayload(1000)).Handle(m)
+	if len(lines) != 1 || !strings.Contains(lines[0], "secret plans") {
+		t.Errorf("logged %q, want the message body in the payload", lines)
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// The benchmarks of the hot path of Dispatch; a history sync dispatches tens of thousands of
+// events. Run with `go test -bench . -benchmem ./handlers`.
+
+func BenchmarkDispatchHandled(b *testing.B) {
+	d := New()
+	d.Register(Message, handlerFunc(func(ev interface{}) error { return nil }))
+	m := &events.Message{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d.Dispatch(m)
+	}
+}
+
+func BenchmarkDispatchUnhandled(b *testing.B) {
+	d := New()
+	hs := &events.HistorySync{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d.Dispatch(hs)
+	}
+}
+
+func BenchmarkDispatchMultiHandler(b *testing.B) {
+	d := New()
+	ok := handlerFunc(func(ev interface{}) error { return nil })
+	d.Register(AnyEvent, ok)
+	for i := 0; i < 4; i++ {
+		d.Register(Message, ok)
+	}
+	m := &events.Message{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d.Dispatch(m)
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker, see RegisterWithBreaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // the handler runs
+	BreakerOpen                         // the handler is skipped, until the cooldown is over
+	BreakerHalfOpen                     // the next event is a trial
+)
+
+// String returns the string representation of a BreakerState.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerConfig configures a circuit breaker, see RegisterWithBreaker.
+type BreakerConfig struct {
+	Failures int           // consecutive failures that trip the breaker; below 1 is taken as 1
+	Window   time.Duration // in which the failures must occur; 0 for no limit
+	Cooldown time.Duration // during which the tripped handler is skipped
+
+	// OnTrip is invoked when the breaker trips, with the event type, the name of the handler
+	// (see Named) and its last error. Optional.
+	OnTrip func(t EventType, name string, err error)
+}
+
+// BreakerStatus is the state of the circuit breaker of a handler, see Breakers.
+type BreakerStatus struct {
+	EventType EventType
+	Handler   string       // name, see Named
+	State     BreakerState // as of the last event: an open breaker turns half-open at an event
+	Failures  int          // consecutive failures
+	OpenedAt  time.Time    // when the breaker last tripped
+	Skipped   int64        // events that skipped the handler since it was registered
+}
+
+// breaker wraps a handler that is skipped for a while after failing repeatedly.
+type breaker struct {
+	t   EventType
+	cfg BreakerConfig
+	h   handler
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	first    time.Time // of the consecutive failures
+	openedAt time.Time
+	trial    bool // a half-open trial is running
+	skipped  int64
+}
+
+func (b *breaker) Handle(ev interface{}) error {
+	return b.HandleCtx(context.Background(), ev)
+}
+
+func (b *breaker) HandleCtx(ctx context.Context, ev interface{}) error {
+	if !b.admit() {
+		return nil
+	}
+	err := callSafely(ctx, b.h, ev) // a panic is a failure too
+	if errors.Is(err, ErrStopPropagation) {
+		b.record(nil)
+	} else {
+		b.record(err)
+	}
+	return err
+}
+
+func (b *breaker) unwrap() handler { return b.h }
+
+// admit returns whether the handler may run, and starts a trial when the cooldown is over.
+func (b *breaker) admit() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && now().Sub(b.openedAt) >= b.cfg.Cooldown {
+		b.state = BreakerHalfOpen
+	}
+	switch {
+	case b.state == BreakerOpen, b.state == BreakerHalfOpen && b.trial:
+		b.skipped++
+		return false
+	case b.state == BreakerHalfOpen:
+		b.trial = true
+	}
+	return true
+}
+
+// record records the outcome of running the handler, and trips the breaker when needed.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	t := now()
+	if err == nil {
+		b.state, b.failures, b.trial = BreakerClosed, 0, false
+		b.mu.Unlock()
+		return
+	}
+	if b.failures == 0 || b.cfg.Window > 0 && t.Sub(b.first) > b.cfg.Window {
+		b.failures, b.first = 0, t
+	}
+	b.failures++
+	tripped := b.state == BreakerHalfOpen || b.failures >= b.cfg.Failures
+	if tripped {
+		b.state, b.openedAt, b.trial = BreakerOpen, t, false
+	}
+	b.mu.Unlock()
+
+	if tripped && b.cfg.OnTrip != nil {
+		b.cfg.OnTrip(b.t, handlerName(b.h), err)
+	}
+}
+
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStatus{
+		EventType: b.t,
+		Handler:   handlerName(b.h),
+		State:     b.state,
+		Failures:  b.failures,
+		OpenedAt:  b.openedAt,
+		Skipped:   b.skipped,
+	}
+}
+
+// RegisterWithBreaker registers a handler behind a circuit breaker, so that a handler that keeps
+// failing doesn't flood the logs, or starve the handlers after it. After `cfg.Failures`
+// consecutive failures (within `cfg.Window`), the breaker trips: OnTrip is invoked, and the
+// handler is skipped for `cfg.Cooldown`. The first event after the cooldown is a trial: when the
+// handler succeeds, the breaker closes, and when it fails, the breaker trips again. Skipping a
+// handler isn't a failure. The failures themselves are still returned by Dispatch.
+//
+//	d.RegisterWithBreaker(Message, store, BreakerConfig{Failures: 5, Window: time.Minute, Cooldown: 5 * time.Minute})
+func (d *Dispatcher) RegisterWithBreaker(t EventType, h handler, cfg BreakerConfig) {
+	if cfg.Failures < 1 {
+		cfg.Failures = 1
+	}
+	d.Register(t, &breaker{t: t, cfg: cfg, h: h})
+}
+
+// RegisterWithBreaker registers a handler behind a circuit breaker with the default dispatcher,
+// see Dispatcher.RegisterWithBreaker.
+func RegisterWithBreaker(t EventType, h handler, cfg BreakerConfig) {
+	defaultDispatcher.RegisterWithBreaker(t, h, cfg)
+}
+
+// Breakers returns the states of the circuit breakers of the registered handlers, e.g. for a
+// status page, ordered by event type and then by order of registration.
+func (d *Dispatcher) Breakers() []BreakerStatus {
+	d.mu.RLock()
+	var bs []*breaker
+	for _, hs := range d.registry {
+		for _, h := range hs {
+			if b, ok := h.(*breaker); ok {
+				bs = append(bs, b)
+			}
+		}
+	}
+	d.mu.RUnlock()
+
+	var states []BreakerStatus
+	for _, b := range bs {
+		states = append(states, b.status())
+	}
+	sort.SliceStable(states, func(i, j int) bool { return states[i].EventType < states[j].EventType })
+	return states
+}
+
+// Breakers returns the states of the circuit breakers of the default dispatcher, see
+// Dispatcher.Breakers.
+func Breakers() []BreakerStatus {
+	return defaultDispatcher.Breakers()
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// flaky is a handler that fails while `fail` is set.
+type flaky struct {
+	fail  bool
+	calls int
+}
+
+func (f *flaky) Handle(ev interface{}) error {
+	f.calls++
+	if f.fail {
+		return errors.New("flaky")
+	}
+	return nil
+}
+
+func TestBreaker(t *testing.T) {
+	clock := withFakeClock(t)
+	d := New()
+	h := &flaky{fail: true}
+	var trips []string
+	d.RegisterWithBreaker(Message, h, BreakerConfig{
+		Failures: 3,
+		Window:   time.Minute,
+		Cooldown: 10 * time.Minute,
+		OnTrip: func(t EventType, name string, err error) {
+			trips = append(trips, fmt.Sprintf("%v %v %v", t, name, err))
+		},
+	})
+	after := handlerFunc(func(ev interface{}) error { return nil })
+	d.Register(Message, after)
+
+	for _, test := range []struct {
+		description string
+		advance     time.Duration
+		fail        bool
+		wantErr     bool
+		wantCalls   int
+		wantState   BreakerState
+		wantTrips   int
+	}{
+		{"failure 1", 0, true, true, 1, BreakerClosed, 0},
+		{"failure 2", time.Second, true, true, 2, BreakerClosed, 0},
+		{"failure 3 outside the window starts over", 2 * time.Minute, true, true, 3, BreakerClosed, 0},
+		{"failure 2 of the new window", time.Second, true, true, 4, BreakerClosed, 0},
+		{"failure 3 trips", time.Second, true, true, 5, BreakerOpen, 1},
+		{"skipped while open", time.Minute, true, false, 5, BreakerOpen, 1},
+		{"failing trial trips again", 10 * time.Minute, true, true, 6, BreakerOpen, 2},
+		{"skipped after the new trip", time.Second, false, false, 6, BreakerOpen, 2},
+		{"succeeding trial closes", 10 * time.Minute, false, false, 7, BreakerClosed, 2},
+		{"failure after closing counts from 1", time.Second, true, true, 8, BreakerClosed, 2},
+		{"success resets", time.Second, false, false, 9, BreakerClosed, 2},
+		{"failure 1 after reset", time.Second, true, true, 10, BreakerClosed, 2},
+	} {
+		*clock = clock.Add(test.advance)
+		h.fail = test.fail
+		err := d.Dispatch(&events.Message{})
+		if (err != nil) != test.wantErr {
+			t.Errorf("%v: Dispatch(_) = %v, want error: %v", test.description, err, test.wantErr)
+		}
+		if h.calls != test.wantCalls {
+			t.Errorf("%v: handler ran %v times, want %v", test.description, h.calls, test.wantCalls)
+		}
+		bs := d.Breakers()
+		if len(bs) != 1 || bs[0].State != test.wantState {
+			t.Errorf("%v: Breakers() = %+v, want one in state %v", test.description, bs, test.wantState)
+		}
+		if len(trips) != test.wantTrips {
+			t.Errorf("%v: tripped %v times, want %v", test.description, len(trips), test.wantTrips)
+		}
+	}
+	if want := "Message *handlers.flaky flaky"; len(trips) == 0 || trips[0] != want {
+		t.Errorf("OnTrip got %q, want %q first", trips, want)
+	}
+	if bs := d.Breakers(); len(bs) != 1 || bs[0].Skipped != 2 || bs[0].Failures != 1 || bs[0].Handler != "*handlers.flaky" {
+		t.Errorf("Breakers() = %+v, want 2 skipped and 1 failure of *handlers.flaky", bs)
+	}
+}
+
+// TestBreakerSkipDoesntStarve checks that the handlers after an open breaker run, also when
+// stopping at errors.
+func TestBreakerSkipDoesntStarve(t *testing.T) {
+	withFakeClock(t)
+	d := New()
+	d.RegisterWithBreaker(Presence, &flaky{fail: true}, BreakerConfig{Failures: 1, Cooldown: time.Hour})
+	later := &flaky{}
+	d.Register(Presence, later)
+
+	if err := d.Dispatch(&events.Presence{}); err == nil || err.Type != HandlerFailed {
+		t.Errorf("Dispatch(_) = %v, want HandlerFailed that trips the breaker", err)
+	}
+	if err := d.Dispatch(&events.Presence{}); err != nil {
+		t.Errorf("Dispatch(_) = %v, need nil error with the breaker open", err)
+	}
+	if later.calls != 1 {
+		t.Errorf("later handler ran %v times, want 1", later.calls)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+)
+
+// concurrent wraps a handler that runs concurrently with the other concurrent handlers of an
+// event, see RegisterConcurrent.
+type concurrent struct {
+	h handler
+}
+
+func (c *concurrent) Handle(ev interface{}) error {
+	return invoke(context.Background(), c.h, ev)
+}
+
+func (c *concurrent) HandleCtx(ctx context.Context, ev interface{}) error {
+	return invoke(ctx, c.h, ev)
+}
+
+func (c *concurrent) unwrap() handler { return c.h }
+
+// RegisterConcurrent registers a handler that is independent of the other handlers of an event,
+// such as one for metrics or an archiver, so that it may run in parallel with them. Dispatch first
+// runs the other handlers in order, as usual, and then the concurrent handlers together, each in
+// a goroutine of its own, and waits for them. When the other handlers stop the chain, by failing
+// or with ErrStopPropagation, the concurrent ones don't run. The concurrent handlers all run,
+// also when some of them fail; a failure is returned like that of any handler, and more failures
+// are joined (see SetContinueOnError). A panic only fails the handler that panicked.
+// ErrStopPropagation of a concurrent handler means nothing.
+//
+//	d.RegisterConcurrent(Message, metrics)
+//	d.RegisterConcurrent(Message, archiver)
+func (d *Dispatcher) RegisterConcurrent(t EventType, h handler) {
+	d.Register(t, &concurrent{h: h})
+}
+
+// RegisterConcurrent registers a concurrent handler with the default dispatcher, see
+// Dispatcher.RegisterConcurrent.
+func RegisterConcurrent(t EventType, h handler) {
+	defaultDispatcher.RegisterConcurrent(t, h)
+}
+
+// splitConcurrent splits a chain (see Dispatcher.chain) into the handlers that run in order, and
+// the concurrent ones that the chain ends with.
+func splitConcurrent(hs []handler) (seq, conc []handler) {
+	for i, h := range hs {
+		if _, ok := h.(*concurrent); ok {
+			return hs[:i], hs[i:]
+		}
+	}
+	return hs, nil
+}
+
+// runConcurrent runs handlers in parallel, and returns their errors, in the order of the
+// handlers.
+func runConcurrent(ctx context.Context, tr *Trace, t EventType, hs []handler, ev interface{}) []error {
+	errs := make([]error, len(hs))
+	var wg sync.WaitGroup
+	for i, h := range hs {
+		wg.Add(1)
+		go func(i int, h handler) {
+			defer wg.Done()
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+			} else if tr != nil {
+				errs[i] = tr.call(ctx, t, h, ev)
+			} else {
+				errs[i] = call(ctx, h, ev) // recovers panics in this goroutine
+			}
+		}(i, h)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegisterConcurrent(t *testing.T) {
+	d := New()
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, s)
+	}
+	// The concurrent handlers wait for each other, so they only finish when they overlap.
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	all := make(chan struct{})
+	go func() {
+		arrived.Wait()
+		close(all)
+	}()
+	barrier := func(name string) handler {
+		return handlerFunc(func(ev interface{}) error {
+			arrived.Done()
+			select {
+			case <-all:
+			case <-time.After(5 * time.Second):
+				return errors.New(name + " ran alone")
+			}
+			record(name)
+			return nil
+		})
+	}
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		record("first")
+		return nil
+	}))
+	d.RegisterConcurrent(Message, barrier("metrics"))
+	d.RegisterConcurrent(Message, barrier("archiver"))
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		record("last")
+		return nil
+	}))
+
+	if err := d.Dispatch(message("M")); err != nil {
+		t.Fatalf("Dispatch(_) = %v, need nil error", err)
+	}
+	if len(got) != 4 || got[0] != "first" || got[1] != "last" {
+		t.Errorf("handlers ran as %q, want first and last, then the concurrent ones", got)
+	}
+}
+
+func TestRegisterConcurrentErrors(t *testing.T) {
+	errBoom := errors.New("boom")
+	failing := handlerFunc(func(ev interface{}) error { return errBoom })
+	ok := handlerFunc(func(ev interface{}) error { return nil })
+	panicking := handlerFunc(func(ev interface{}) error { panic("oops") })
+
+	for _, test := range []struct {
+		description string
+		concurrent  []handler
+		wantType    dispatchErrorType
+		wantHandler string // in the error
+	}{
+		{"one fails", []handler{ok, failing, ok}, HandlerFailed, "handler 2 (handlers.handlerFunc) for Message failed: boom"},
+		{"two fail", []handler{failing, ok, failing}, HandlerFailed, "handler 1 (handlers.handlerFunc): boom\nhandler 3 (handlers.handlerFunc): boom"},
+		{"one panics", []handler{ok, panicking}, HandlerPanicked, "handler panicked: oops"},
+	} {
+		d := New()
+		d.Register(Message, ok)
+		for _, h := range test.concurrent {
+			d.RegisterConcurrent(Message, h)
+		}
+		err := d.Dispatch(message("M"))
+		if err == nil || err.Type != test.wantType {
+			t.Errorf("%v: Dispatch(_) = %v, want %v", test.description, err, test.wantType)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.wantHandler) {
+			t.Errorf("%v: Dispatch(_) = %q, want it to have %q", test.description, err, test.wantHandler)
+		}
+	}
+
+	// A sequential handler that stops the chain skips the concurrent ones.
+	d := New()
+	d.Register(Message, handlerFunc(func(ev interface{}) error { return ErrStopPropagation }))
+	d.RegisterConcurrent(Message, failing)
+	if err := d.Dispatch(message("M")); err != nil {
+		t.Errorf("Dispatch(_) = %v, need nil error", err)
+	}
+}
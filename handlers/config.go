@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Handler is the method of every handler (see Register), so that a Factory can return one.
+type Handler interface {
+	Handle(evt interface{}) error
+}
+
+// Factory builds a handler from the parameters in a Config, see RegisterFactory.
+type Factory func(params map[string]interface{}) (Handler, error)
+
+// factories holds the factories of RegisterFactory, by name.
+var factories = struct {
+	mu sync.RWMutex
+	m  map[string]Factory
+}{m: map[string]Factory{}}
+
+// RegisterFactory registers a factory for the handlers that a Config names, typically from the
+// init func of the package of the handler, like `database/sql` drivers. It panics when the name is
+// taken or the factory is nil, so that programming errors show at start-up.
+//
+//	func init() {
+//		handlers.RegisterFactory("autoreply", func(params map[string]interface{}) (handlers.Handler, error) {
+//			text, ok := params["text"].(string)
+//			if !ok {
+//				return nil, errors.New(`need a string "text"`)
+//			}
+//			return &autoReply{text: text}, nil
+//		})
+//	}
+func RegisterFactory(name string, f Factory) {
+	factories.mu.Lock()
+	defer factories.mu.Unlock()
+	if f == nil {
+		panic(fmt.Sprintf("handlers.RegisterFactory: nil factory for %q", name))
+	}
+	if _, taken := factories.m[name]; taken {
+		panic(fmt.Sprintf("handlers.RegisterFactory: %q is registered already", name))
+	}
+	factories.m[name] = f
+}
+
+// HandlerConfig names a factory (see RegisterFactory), with the parameters for the handler. In
+// JSON, it is an object with a "name" and optional "params", or just the name as a string.
+type HandlerConfig struct {
+	Name   string                 `json:"name"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, so that a handler without parameters can be just its
+// name.
+func (hc *HandlerConfig) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*hc = HandlerConfig{Name: name}
+		return nil
+	}
+	type plain HandlerConfig // without this method
+	return json.Unmarshal(data, (*plain)(hc))
+}
+
+// Config declares the handlers of event types, by the names of the types (see ParseEventType),
+// e.g. to enable the features of a binary per instance:
+//
+//	{
+//	  "Message": ["logger", {"name": "autoreply", "params": {"text": "I'm away"}}],
+//	  "Receipt": ["tracker"]
+//	}
+type Config map[string][]HandlerConfig
+
+// BuildFromConfig builds the handlers of a config with their factories, and registers them for
+// their event types, in the order of the config per type. All handlers are built before any is
+// registered: when an event type or factory is unknown, or a factory fails, nothing is
+// registered, and the errors of all of them are returned.
+func (d *Dispatcher) BuildFromConfig(cfg Config) error {
+	type built struct {
+		t EventType
+		h Handler
+	}
+	var (
+		hs   []built
+		errs []error
+	)
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names) // for repeatable errors and registrations
+
+	factories.mu.RLock()
+	defer factories.mu.RUnlock()
+	for _, name := range names {
+		t, err := ParseEventType(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for i, hc := range cfg[name] {
+			f, ok := factories.m[hc.Name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%v: handler %d: unknown factory %q", t, i, hc.Name))
+				continue
+			}
+			h, err := f(hc.Params)
+			if err == nil && h == nil {
+				err = errors.New("factory returned no handler")
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v: handler %d (%s): %w", t, i, hc.Name, err))
+				continue
+			}
+			hs = append(hs, built{t: t, h: h})
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("handlers.BuildFromConfig: %w", errors.Join(errs...))
+	}
+	for _, b := range hs {
+		d.Register(b.t, b.h)
+	}
+	return nil
+}
+
+// BuildFromConfig builds and registers the handlers of a config with the default dispatcher, see
+// Dispatcher.BuildFromConfig.
+func BuildFromConfig(cfg Config) error {
+	return defaultDispatcher.BuildFromConfig(cfg)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// wired records what the handlers that the factories of the test build see.
+var wired []string
+
+func init() {
+	RegisterFactory("logger", func(params map[string]interface{}) (Handler, error) {
+		return handlerFunc(func(ev interface{}) error {
+			wired = append(wired, fmt.Sprintf("logger %T", ev))
+			return nil
+		}), nil
+	})
+	RegisterFactory("autoreply", func(params map[string]interface{}) (Handler, error) {
+		text, ok := params["text"].(string)
+		if !ok {
+			return nil, errors.New(`need a string "text"`)
+		}
+		return handlerFunc(func(ev interface{}) error {
+			wired = append(wired, "autoreply "+text)
+			return nil
+		}), nil
+	})
+	RegisterFactory("tracker", func(params map[string]interface{}) (Handler, error) {
+		return handlerFunc(func(ev interface{}) error {
+			wired = append(wired, fmt.Sprintf("tracker %T", ev))
+			return nil
+		}), nil
+	})
+}
+
+func TestBuildFromConfig(t *testing.T) {
+	data, err := os.ReadFile("testdata/wiring.json")
+	if err != nil {
+		t.Fatalf("ReadFile(_) = _, %v, need nil error", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("Unmarshal(_) = %v, need nil error", err)
+	}
+	d := New()
+	if err := d.BuildFromConfig(cfg); err != nil {
+		t.Fatalf("BuildFromConfig(_) = %v, need nil error", err)
+	}
+	wired = nil
+	for _, evt := range []interface{}{&events.Message{}, &events.Receipt{}} {
+		if err := d.Dispatch(evt); err != nil {
+			t.Errorf("Dispatch(%T) = %v, need nil error", evt, err)
+		}
+	}
+	if want := "[logger *events.Message autoreply I'm away tracker *events.Receipt]"; fmt.Sprint(wired) != want {
+		t.Errorf("handlers saw %v, want %v", wired, want)
+	}
+
+	for _, test := range []struct {
+		description string
+		cfg         Config
+		want        []string // in the error
+	}{
+		{
+			description: "unknown event type",
+			cfg:         Config{"Mesage": {{Name: "logger"}}},
+			want:        []string{`unknown event type "Mesage"`},
+		},
+		{
+			description: "unknown factory and bad parameters",
+			cfg: Config{
+				"Message": {{Name: "logger"}, {Name: "autoreplay"}},
+				"Receipt": {{Name: "autoreply", Params: map[string]interface{}{"text": 42}}},
+			},
+			want: []string{
+				`Message: handler 1: unknown factory "autoreplay"`,
+				`Receipt: handler 0 (autoreply): need a string "text"`,
+			},
+		},
+	} {
+		d := New()
+		err := d.BuildFromConfig(test.cfg)
+		if err == nil {
+			t.Errorf("%v: BuildFromConfig(_) = nil, need error", test.description)
+			continue
+		}
+		for _, w := range test.want {
+			if !strings.Contains(err.Error(), w) {
+				t.Errorf("%v: BuildFromConfig(_) = %q, want it to have %q", test.description, err, w)
+			}
+		}
+		if reg := d.Registered(); len(reg) != 0 {
+			t.Errorf("%v: registered %v, want nothing after an error", test.description, reg)
+		}
+	}
+}
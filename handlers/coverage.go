@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+)
+
+// eventsPkg is the package of the events that Dispatch handles.
+const eventsPkg = "go.mau.fi/whatsmeow/types/events"
+
+// notEvents are the exported struct types in the events package that are parts of events, rather
+// than events.
+var notEvents = map[string]bool{
+	"BlocklistChange":       true,
+	"MediaRetryError":       true,
+	"NewsletterMessageMeta": true,
+}
+
+// VerifyEventCoverage returns the names of the exported struct types in the events package that
+// Dispatch doesn't handle, e.g. after a whatsmeow upgrade that added events. Go can't list the
+// types of a package at run time, so the source of the package is parsed; it is found like the go
+// command finds it, so this is meant for tests and tooling rather than for production binaries.
+// When the source can't be read, the error is returned as the only entry.
+func VerifyEventCoverage() []string {
+	pkg, err := build.Import(eventsPkg, ".", 0)
+	if err != nil {
+		return []string{fmt.Sprintf("handlers.VerifyEventCoverage: %v", err)}
+	}
+	handled := map[string]bool{}
+	for rt := range eventTypes {
+		if rt.PkgPath() == eventsPkg {
+			handled[rt.Name()] = true
+		}
+	}
+	var missing []string
+	fset := token.NewFileSet()
+	for _, name := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), nil, 0)
+		if err != nil {
+			return []string{fmt.Sprintf("handlers.VerifyEventCoverage: %v", err)}
+		}
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if _, ok := ts.Type.(*ast.StructType); !ok || !ts.Name.IsExported() {
+					continue
+				}
+				if !handled[ts.Name.Name] && !notEvents[ts.Name.Name] {
+					missing = append(missing, ts.Name.Name)
+				}
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
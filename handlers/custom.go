@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// MaxCustomTypes is the number of custom event types that RegisterCustomType can register.
+const MaxCustomTypes = 64
+
+// numEventTypes bounds the values of the event types, custom ones included.
+const numEventTypes = lastEventType + MaxCustomTypes
+
+// custom holds the custom event types. Their values follow those of the built-in types.
+var custom struct {
+	mu     sync.RWMutex
+	types  map[reflect.Type]EventType
+	names  []string // indexed by value - lastEventType
+	byName map[string]EventType
+}
+
+// RegisterCustomType registers the type of an event that isn't one of whatsmeow, such as an
+// event that a handler emits (see Emit), and returns its EventType. The sample is a value, or a
+// pointer to a value, of the type; like whatsmeow's events, events of the type are dispatched as
+// pointers. The EventType is named after the Go type, e.g. "MediaDownloaded", or
+// "media.Downloaded" when the name is taken. Registering a type again returns the same EventType.
+// RegisterCustomType panics when the sample is nil, or when MaxCustomTypes types are registered
+// already, so that programming errors show at start-up.
+//
+//	var MediaDownloaded = handlers.RegisterCustomType(Downloaded{})
+func RegisterCustomType(sample interface{}) EventType {
+	rt := reflect.TypeOf(sample)
+	if rt == nil {
+		panic("handlers.RegisterCustomType: nil sample")
+	}
+	if rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if t, ok := eventTypes[rt]; ok {
+		return t
+	}
+
+	custom.mu.Lock()
+	defer custom.mu.Unlock()
+	if t, ok := custom.types[rt]; ok {
+		return t
+	}
+	if len(custom.names) == MaxCustomTypes {
+		panic(fmt.Sprintf("handlers.RegisterCustomType: can't register %v, there are %d custom types already", rt, MaxCustomTypes))
+	}
+	name := rt.Name()
+	if _, taken := lookupName(name); taken || name == "" {
+		name = rt.String()
+	}
+	if custom.types == nil {
+		custom.types = map[reflect.Type]EventType{}
+		custom.byName = map[string]EventType{}
+	}
+	t := lastEventType + EventType(len(custom.names))
+	custom.types[rt] = t
+	custom.names = append(custom.names, name)
+	custom.byName[strings.ToLower(name)] = t
+	return t
+}
+
+// lookupType returns the EventType of a Go type of events, built-in or custom.
+func lookupType(rt reflect.Type) (EventType, bool) {
+	if t, ok := eventTypes[rt]; ok {
+		return t, true
+	}
+	custom.mu.RLock()
+	defer custom.mu.RUnlock()
+	t, ok := custom.types[rt]
+	return t, ok
+}
+
+// lookupName returns the EventType of a lower-case name, built-in or custom. The caller must
+// hold custom.mu.
+func lookupName(name string) (EventType, bool) {
+	name = strings.ToLower(name)
+	if t, ok := eventTypesByName[name]; ok {
+		return t, true
+	}
+	t, ok := custom.byName[name]
+	return t, ok
+}
+
+// customName returns the name of a custom event type.
+func customName(t EventType) (string, bool) {
+	custom.mu.RLock()
+	defer custom.mu.RUnlock()
+	if i := int(t - lastEventType); i >= 0 && i < len(custom.names) {
+		return custom.names[i], true
+	}
+	return "", false
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestDeadLetter(t *testing.T) {
+	errFail := errors.New("fail")
+	for _, test := range []struct {
+		description string
+		install     bool
+		failures    bool
+		evt         interface{}
+		wantErr     dispatchErrorType // 0 when nil
+		wantLetters string
+	}{
+		{"no handler, without hook", false, false, &events.Picture{}, NoHandlerFound, "[]"},
+		{"no handler, with hook", true, false, &events.Picture{}, 0, "[Picture NoHandlerFound]"},
+		{"derived event without handlers", true, false, &events.DeleteForMe{}, 0, "[DeleteForMe NoHandlerFound]"},
+		{"handled", true, true, &events.Message{}, 0, "[]"},
+		{"failed, without hook", false, true, &events.Receipt{}, HandlerFailed, "[]"},
+		{"failed, without opt-in", true, false, &events.Receipt{}, HandlerFailed, "[]"},
+		{"failed, with opt-in", true, true, &events.Receipt{}, HandlerFailed, "[Receipt HandlerFailed fail]"},
+		{"panicked, with opt-in", true, true, &events.Presence{}, HandlerPanicked, "[Presence HandlerPanicked]"},
+		{"unknown event", true, true, &struct{}{}, UnknownEvent, "[]"},
+	} {
+		d := New()
+		d.Register(Message, handlerFunc(func(ev interface{}) error { return nil }))
+		d.Register(Receipt, handlerFunc(func(ev interface{}) error { return errFail }))
+		d.Register(Presence, handlerFunc(func(ev interface{}) error { panic("boom") }))
+		var letters []string
+		if test.install {
+			d.SetDeadLetterHandler(func(tp EventType, evt interface{}, reason DispatchErrorType, err error) {
+				letter := fmt.Sprintf("%v %v", tp, reason)
+				if errors.Is(err, errFail) {
+					letter += " fail"
+				}
+				if got, want := fmt.Sprintf("%T", evt), fmt.Sprintf("%T", test.evt); got != want {
+					t.Errorf("%v: dead letter has a %v, want %v", test.description, got, want)
+				}
+				letters = append(letters, letter)
+			})
+		}
+		d.SetDeadLetterFailures(test.failures)
+
+		err := d.Dispatch(test.evt)
+		switch {
+		case test.wantErr == 0 && err != nil:
+			t.Errorf("%v: Dispatch(_) = %v, need nil error", test.description, err)
+		case test.wantErr != 0 && (err == nil || err.Type != test.wantErr):
+			t.Errorf("%v: Dispatch(_) = %v, want %v", test.description, err, test.wantErr)
+		}
+		if got := fmt.Sprint(letters); got != test.wantLetters {
+			t.Errorf("%v: dead letters = %v, want %v", test.description, got, test.wantLetters)
+		}
+	}
+}
+
+// TestDeadLetterDebounced checks that the failures of debounced handlers reach the dead-letter
+// handler, since there is no dispatch to return them.
+func TestDeadLetterDebounced(t *testing.T) {
+	ft := withFakeTimers(t)
+	d := New()
+	var letters []string
+	d.SetDeadLetterHandler(func(tp EventType, evt interface{}, reason DispatchErrorType, err error) {
+		letters = append(letters, fmt.Sprintf("%v %v %v", tp, reason, err))
+	})
+	d.SetDeadLetterFailures(true)
+	d.Debounce(Presence, time.Second, nil, handlerFunc(func(ev interface{}) error { return errors.New("fail") }))
+
+	if err := d.Dispatch(&events.Presence{}); err != nil {
+		t.Errorf("Dispatch(_) = %v, need nil error", err)
+	}
+	ft.advance(time.Second)
+	if got, want := fmt.Sprint(letters), "[Presence HandlerFailed fail]"; got != want {
+		t.Errorf("dead letters = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// stopper is a scheduled func, such as a *time.Timer.
+type stopper interface {
+	Stop() bool
+}
+
+// afterFunc is swapped in tests.
+var afterFunc = func(d time.Duration, f func()) stopper { return time.AfterFunc(d, f) }
+
+// pendingEvent is the latest event of a key, waiting for the window of quiet.
+type pendingEvent struct {
+	evt   interface{}
+	timer stopper
+	gen   uint64 // tells the current timer from stopped ones that fired anyway
+}
+
+// debouncer wraps a handler that only gets the latest of a burst of events per key.
+type debouncer struct {
+	d      *Dispatcher
+	t      EventType
+	window time.Duration
+	key    KeyFunc
+	h      handler
+
+	// deliver is held while an event is taken out of pending and delivered, so that deliveries
+	// don't overtake each other.
+	deliver sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]*pendingEvent
+	gen     uint64
+}
+
+func (b *debouncer) Handle(ev interface{}) error {
+	k := b.key(ev)
+	b.mu.Lock()
+	b.gen++
+	gen := b.gen
+	p, ok := b.pending[k]
+	if !ok {
+		p = &pendingEvent{}
+		b.pending[k] = p
+	} else {
+		p.timer.Stop()
+	}
+	p.evt, p.gen = ev, gen
+	p.timer = afterFunc(b.window, func() { b.fire(k, gen) })
+	b.mu.Unlock()
+	return nil
+}
+
+// fire delivers the pending event of a key, unless a later event rescheduled it.
+func (b *debouncer) fire(k string, gen uint64) {
+	b.deliver.Lock()
+	defer b.deliver.Unlock()
+	b.mu.Lock()
+	p, ok := b.pending[k]
+	if !ok || p.gen != gen {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, k)
+	b.mu.Unlock()
+	b.call(p.evt)
+}
+
+// call delivers a held back event. Since Dispatch returned long ago, errors can only go to the
+// dead-letter handler.
+func (b *debouncer) call(ev interface{}) {
+	err := callSafely(context.WithValue(context.Background(), eventTypeKey{}, b.t), b.h, ev)
+	if err == nil {
+		return
+	}
+	tp := HandlerFailed
+	if _, ok := err.(*PanicError); ok {
+		tp = HandlerPanicked
+	}
+	b.d.toDeadLetter(b.t, ev, &DispatchError{Type: tp, Err: err, EventType: b.t})
+}
+
+// flush delivers all pending events.
+func (b *debouncer) flush() {
+	b.deliver.Lock()
+	defer b.deliver.Unlock()
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = map[string]*pendingEvent{}
+	b.mu.Unlock()
+	for _, p := range pending {
+		p.timer.Stop()
+		b.call(p.evt)
+	}
+}
+
+// Debounce registers a handler that only gets the latest event per key of a burst: an event is
+// held back until no event with the same key came in for `window`, and a later event replaces
+// it. Bursts of e.g. Presence or ChatPresence events thus collapse into their final state. Keys
+// come from `key`, ChatKey when nil; events without a key (an empty string) share one.
+//
+// The handler runs on a timer, after Dispatch returned, so its errors only reach the dead-letter
+// handler (see SetDeadLetterFailures), and panics are recovered. It isn't invoked concurrently,
+// and gets the events of a key in order. Close delivers the events that are held back, before it
+// closes the handlers.
+//
+//	d.Debounce(ChatPresence, 2*time.Second, nil, h)
+func (d *Dispatcher) Debounce(t EventType, window time.Duration, key KeyFunc, h handler) {
+	if key == nil {
+		key = ChatKey
+	}
+	b := &debouncer{
+		d:       d,
+		t:       t,
+		window:  window,
+		key:     key,
+		h:       h,
+		pending: map[string]*pendingEvent{},
+	}
+	d.mu.Lock()
+	d.flushers = append(d.flushers, b.flush)
+	d.mu.Unlock()
+	d.Register(t, b)
+}
+
+// Debounce registers a debounced handler with the default dispatcher, see Dispatcher.Debounce.
+func Debounce(t EventType, window time.Duration, key KeyFunc, h handler) {
+	defaultDispatcher.Debounce(t, window, key, h)
+}
+
+func (b *debouncer) unwrap() handler { return b.h }
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// fakeTimers is swapped in for `afterFunc`, and fires the funcs that are due when the test
+// advances it.
+type fakeTimers struct {
+	mu     sync.Mutex
+	now    time.Duration
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Duration
+	f       func()
+	stopped bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	was := !t.stopped
+	t.stopped = true
+	return was
+}
+
+func withFakeTimers(t *testing.T) *fakeTimers {
+	ft := &fakeTimers{}
+	old := afterFunc
+	afterFunc = func(d time.Duration, f func()) stopper {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		timer := &fakeTimer{at: ft.now + d, f: f}
+		ft.timers = append(ft.timers, timer)
+		return timer
+	}
+	t.Cleanup(func() { afterFunc = old })
+	return ft
+}
+
+func (ft *fakeTimers) advance(d time.Duration) {
+	ft.mu.Lock()
+	ft.now += d
+	var due, later []*fakeTimer
+	for _, timer := range ft.timers {
+		switch {
+		case timer.stopped:
+		case timer.at <= ft.now:
+			due = append(due, timer)
+		default:
+			later = append(later, timer)
+		}
+	}
+	ft.timers = later
+	ft.mu.Unlock()
+	for _, timer := range due {
+		timer.stopped = true
+		timer.f()
+	}
+}
+
+func chatPresence(user string, state types.ChatPresence) *events.ChatPresence {
+	cp := &events.ChatPresence{State: state}
+	cp.Chat = types.NewJID(user, types.DefaultUserServer)
+	return cp
+}
+
+// collector records the chats and states that a debounced handler gets.
+type collector struct {
+	mu  sync.Mutex
+	got []string
+}
+
+func (c *collector) Handle(ev interface{}) error {
+	cp := ev.(*events.ChatPresence)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.got = append(c.got, cp.Chat.User+" "+string(cp.State))
+	return nil
+}
+
+func (c *collector) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sort.Strings(c.got)
+	return fmt.Sprint(c.got)
+}
+
+func TestDebounce(t *testing.T) {
+	ft := withFakeTimers(t)
+	d := New()
+	c := &collector{}
+	d.Debounce(ChatPresence, time.Second, nil, c)
+
+	for i := 0; i < 10; i++ {
+		state := types.ChatPresenceComposing
+		if i == 9 {
+			state = types.ChatPresencePaused
+		}
+		if err := d.Dispatch(chatPresence("1", state)); err != nil {
+			t.Fatalf("Dispatch(_) = %v, need nil error", err)
+		}
+		ft.advance(100 * time.Millisecond)
+	}
+	if got := c.String(); got != "[]" {
+		t.Errorf("during the burst, handler got %v, want nothing", got)
+	}
+	ft.advance(900 * time.Millisecond)
+	if got, want := c.String(), "[1 paused]"; got != want {
+		t.Errorf("after the burst, handler got %v, want %v", got, want)
+	}
+
+	// Interleaving keys are debounced separately.
+	c.got = nil
+	for i := 0; i < 5; i++ {
+		d.Dispatch(chatPresence("2", types.ChatPresenceComposing))
+		d.Dispatch(chatPresence("3", types.ChatPresenceComposing))
+		ft.advance(500 * time.Millisecond)
+	}
+	d.Dispatch(chatPresence("3", types.ChatPresencePaused))
+	ft.advance(time.Second)
+	if got, want := c.String(), "[2 composing 3 paused]"; got != want {
+		t.Errorf("after interleaved bursts, handler got %v, want %v", got, want)
+	}
+}
+
+func TestDebounceClose(t *testing.T) {
+	ft := withFakeTimers(t)
+	d := New()
+	c := &collector{}
+	d.Debounce(ChatPresence, time.Second, nil, c)
+
+	d.Dispatch(chatPresence("1", types.ChatPresenceComposing))
+	d.Dispatch(chatPresence("2", types.ChatPresencePaused))
+	if err := d.Close(); err != nil {
+		t.Errorf("Close() = %v, need nil error", err)
+	}
+	if got, want := c.String(), "[1 composing 2 paused]"; got != want {
+		t.Errorf("after Close, handler got %v, want %v", got, want)
+	}
+
+	c.got = nil
+	ft.advance(time.Second) // the stopped timers don't deliver again
+	if err := d.Dispatch(chatPresence("3", types.ChatPresenceComposing)); err == nil || err.Type != DispatcherClosed {
+		t.Errorf("Dispatch(_) after Close = %v, want DispatcherClosed", err)
+	}
+	if got := c.String(); got != "[]" {
+		t.Errorf("after Close, handler got %v, want nothing", got)
+	}
+}
+
+// TestDebounceConcurrent checks that many keys can be debounced concurrently, with real timers.
+func TestDebounceConcurrent(t *testing.T) {
+	d := New()
+	c := &collector{}
+	d.Debounce(ChatPresence, time.Millisecond, nil, c)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				d.Dispatch(chatPresence(user, types.ChatPresenceComposing))
+			}
+			d.Dispatch(chatPresence(user, types.ChatPresencePaused))
+		}(fmt.Sprint(i))
+	}
+	wg.Wait()
+	d.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := map[string]string{}
+	for _, s := range c.got {
+		var user, state string
+		fmt.Sscan(s, &user, &state)
+		last[user] = state
+	}
+	if len(last) != 20 {
+		t.Errorf("handler got events of %v users, want 20", len(last))
+	}
+	for user, state := range last {
+		if state != "paused" {
+			t.Errorf("last state of %v = %v, want paused", user, state)
+		}
+	}
+}
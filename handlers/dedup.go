@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// dedupEntry is a key that Dedup has seen, and when it was first seen.
+type dedupEntry struct {
+	key string
+	at  time.Time
+}
+
+// dedup is an LRU of the keys of dispatched events, whose entries expire after a TTL.
+type dedup struct {
+	capacity int
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	order *list.List // of *dedupEntry, the most recently seen first
+	keys  map[string]*list.Element
+}
+
+// seen returns whether a key was seen within the TTL, and records it when it wasn't.
+func (d *dedup) seen(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	t := now()
+	if el, ok := d.keys[key]; ok {
+		d.order.MoveToFront(el)
+		e := el.Value.(*dedupEntry)
+		if d.ttl <= 0 || t.Sub(e.at) < d.ttl {
+			return true
+		}
+		e.at = t // expired, so this is a new event
+		return false
+	}
+	d.keys[key] = d.order.PushFront(&dedupEntry{key: key, at: t})
+	if d.order.Len() > d.capacity {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.keys, oldest.Value.(*dedupEntry).key)
+	}
+	return false
+}
+
+// dedupKey returns the key under which Dedup remembers an event: its type, chat, message ID(s)
+// and sender. The synthetic events that are derived from a message or receipt, such as
+// EditMessage and ReceiptRead, are keyed by that message or receipt.
+func dedupKey(t EventType, ev interface{}) (string, bool) {
+	if r, ok := ev.(*events.Receipt); ok {
+		// A receipt's type is part of the key, so that a read receipt isn't taken for a
+		// duplicate of the delivery receipt of the same message.
+		return strings.Join([]string{t.String(), r.Chat.String(), strings.Join(r.MessageIDs, ","),
+			r.Sender.String(), string(r.Type)}, "|"), true
+	}
+	m := messageOf(ev)
+	if m == nil {
+		return "", false
+	}
+	return strings.Join([]string{t.String(), m.Info.Chat.String(), m.Info.ID, m.Info.Sender.String()}, "|"), true
+}
+
+// Dedup returns middleware that drops events that were dispatched before, such as the messages
+// that whatsmeow redelivers after a reconnect with offline sync. Message and Receipt events, and
+// the synthetic events that are derived from them, are keyed by their chat, message ID(s) and
+// sender; other events pass through. The keys are kept in an LRU of `capacity` entries (at least
+// 1), and expire after `ttl` (never when 0). A duplicate doesn't reach the handlers, and isn't a
+// failure: `onDuplicate` is invoked instead when it isn't nil.
+//
+//	d.Use(Dedup(10000, time.Hour, func(t EventType, ev interface{}) { duplicates.Add(1) }))
+func Dedup(capacity int, ttl time.Duration, onDuplicate func(t EventType, ev interface{})) Middleware {
+	if capacity < 1 {
+		capacity = 1
+	}
+	dd := &dedup{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		keys:     map[string]*list.Element{},
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(t EventType, ev interface{}) error {
+			key, ok := dedupKey(t, ev)
+			if !ok || !dd.seen(key) {
+				return next(t, ev)
+			}
+			if onDuplicate != nil {
+				onDuplicate(t, ev)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestDedup(t *testing.T) {
+	clock := withFakeClock(t)
+	d := New()
+	var duplicates []string
+	d.Use(Dedup(2, time.Minute, func(t EventType, ev interface{}) {
+		duplicates = append(duplicates, t.String())
+	}))
+	var handled []string
+	d.Register(AnyEvent, handlerFunc(func(ev interface{}) error {
+		switch v := ev.(type) {
+		case *events.Message:
+			handled = append(handled, v.Info.ID)
+		case *events.Receipt:
+			handled = append(handled, string(v.Type)+v.MessageIDs[0])
+		default:
+			handled = append(handled, "other")
+		}
+		return nil
+	}))
+	receipt := func(tp types.ReceiptType, id string) *events.Receipt {
+		return &events.Receipt{Type: tp, MessageIDs: []types.MessageID{id}}
+	}
+
+	for _, test := range []struct {
+		description string
+		evts        []interface{}
+		advance     time.Duration
+		want        string
+	}{
+		{"same message twice", []interface{}{message("M1"), message("M1")}, 0, "M1"},
+		{"other events pass", []interface{}{&events.Presence{}, &events.Presence{}}, 0, "other other"},
+		{"receipts by type", []interface{}{receipt("", "M1"), receipt("read", "M1"), receipt("read", "M1")}, 0, "M1 readM1"},
+		{"evicted", []interface{}{message("M1"), message("M2"), message("M3"), message("M1")}, 0, "M1 M2 M3 M1"},
+		{"still there", []interface{}{message("M3")}, 0, ""},
+		{"expired", []interface{}{message("M3"), message("M3")}, time.Minute, "M3"},
+	} {
+		handled = nil
+		*clock = clock.Add(test.advance)
+		for _, evt := range test.evts {
+			if err := d.Dispatch(evt); err != nil {
+				t.Errorf("%v: Dispatch(%T) = %v, need nil error", test.description, evt, err)
+			}
+		}
+		if got := strings.Join(handled, " "); got != test.want {
+			t.Errorf("%v: handled %q, want %q", test.description, got, test.want)
+		}
+	}
+	if got, want := strings.Join(duplicates, " "), "Message Receipt Message Message"; got != want {
+		t.Errorf("reported duplicates %q, want %q", got, want)
+	}
+}
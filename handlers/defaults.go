@@ -0,0 +1,99 @@
+package handlers
+
+// RegisterDefault registers a default handler for an event type: a fallback that Dispatch only
+// invokes for events of the type when no handlers are registered for it, e.g. to log and ack the
+// chat settings that have no handlers yet. Once a handler is registered for the type, its
+// defaults don't run anymore; after the handlers are unregistered, they run again. With defaults,
+// Dispatch doesn't return NoHandlerFound for the type. Like with Register, more than one default
+// may be registered for a type, and they are invoked in order.
+//
+// A default that is registered for AnyEvent is the global default: it is invoked for events of
+// the types that have neither handlers nor defaults, except for the synthetic types that are
+// derived from other events (such as EditMessage and ReceiptRead), since their events are seen
+// under the type of the event that they are derived from. Catch-alls (see Register) run before
+// the handlers of a type, and so before its defaults too. Defaults don't count as handlers for
+// HasHandler and Registered.
+//
+//	d.RegisterDefault(AnyEvent, logAndAck)
+//	d.RegisterDefault(Archive, settingsTodo)
+func (d *Dispatcher) RegisterDefault(t EventType, h handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.defaults == nil {
+		d.defaults = map[EventType][]handler{}
+	}
+	d.defaults[t] = append(d.defaults[t], h)
+	d.order = append(d.order, h)
+	d.rebuildChains(t)
+}
+
+// RegisterDefault registers a default handler with the default dispatcher, see
+// Dispatcher.RegisterDefault.
+func RegisterDefault(t EventType, h handler) {
+	defaultDispatcher.RegisterDefault(t, h)
+}
+
+// fallback returns the defaults of an event type that has no handlers. The caller must hold mu.
+func (d *Dispatcher) fallback(t EventType) []handler {
+	if hs := d.defaults[t]; len(hs) > 0 {
+		return hs
+	}
+	if t == AnyEvent || isDerived(t) {
+		return nil
+	}
+	return d.defaults[AnyEvent]
+}
+
+// chain returns the handlers that Dispatch runs for events of a type: the catch-alls, and then
+// the handlers of the type, or else its defaults, with the concurrent ones (see
+// RegisterConcurrent) moved to the end. The caller must hold mu.
+func (d *Dispatcher) chain(t EventType) []handler {
+	hs := d.registry[t]
+	if len(hs) == 0 {
+		hs = d.fallback(t)
+	}
+	if all := d.registry[AnyEvent]; len(all) > 0 && !isReceiptKind(t) {
+		hs = append(all[:len(all):len(all)], hs...) // a new slice, all stays intact
+	}
+	var seq, conc []handler
+	for _, h := range hs {
+		if _, ok := h.(*concurrent); ok {
+			conc = append(conc, h)
+		} else {
+			seq = append(seq, h)
+		}
+	}
+	if len(conc) == 0 {
+		return hs
+	}
+	return append(seq, conc...)
+}
+
+// rebuildChains rebuilds the chains that a change of the handlers or defaults of a type affects,
+// so that Dispatch takes a chain without allocating: all of them for AnyEvent. The caller must
+// hold mu.
+func (d *Dispatcher) rebuildChains(t EventType) {
+	switch {
+	case t == AnyEvent:
+		for ct := range d.chains {
+			d.chains[ct] = d.chain(EventType(ct))
+		}
+	case t >= 0 && t < numEventTypes:
+		d.chains[t] = d.chain(t)
+	}
+}
+
+// hasDefault returns whether an event type has defaults of its own.
+func (d *Dispatcher) hasDefault(t EventType) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return len(d.defaults[t]) > 0
+}
+
+// isDerived returns whether an event type is the synthetic type of events that are derived from
+// other events.
+func isDerived(t EventType) bool {
+	return t == EditMessage || t == MessageRevoked || t == StickerMessage || isReceiptKind(t)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestRegisterDefault(t *testing.T) {
+	d := New()
+	var got []string
+	named := func(name string) handler {
+		return handlerFunc(func(ev interface{}) error {
+			got = append(got, fmt.Sprintf("%s %T", name, ev))
+			return nil
+		})
+	}
+	d.RegisterDefault(Archive, named("archive default"))
+	d.RegisterDefault(AnyEvent, named("global default"))
+	d.Register(AnyEvent, named("catch-all"))
+	specific := named("archive")
+
+	for _, test := range []struct {
+		description string
+		setup       func()
+		evts        []interface{}
+		want        []string
+	}{
+		{
+			description: "defaults fire",
+			evts:        []interface{}{&events.Archive{}, &events.Pin{}},
+			want: []string{
+				"catch-all *events.Archive", "archive default *events.Archive",
+				"catch-all *events.Pin", "global default *events.Pin",
+			},
+		},
+		{
+			description: "not for derived events",
+			evts:        []interface{}{&events.Receipt{Type: types.ReceiptTypeRead}},
+			want:        []string{"catch-all *events.Receipt", "global default *events.Receipt"},
+		},
+		{
+			description: "not with a handler",
+			setup:       func() { d.Register(Archive, specific) },
+			evts:        []interface{}{&events.Archive{}},
+			want:        []string{"catch-all *events.Archive", "archive *events.Archive"},
+		},
+		{
+			description: "again after unregistering",
+			setup:       func() { d.UnregisterAll(Archive) },
+			evts:        []interface{}{&events.Archive{}},
+			want:        []string{"catch-all *events.Archive", "archive default *events.Archive"},
+		},
+	} {
+		if test.setup != nil {
+			test.setup()
+		}
+		got = nil
+		for _, evt := range test.evts {
+			if err := d.Dispatch(evt); err != nil {
+				t.Errorf("%v: Dispatch(%T) = %v, need nil error", test.description, evt, err)
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%v: handlers saw\n%v\nwant\n%v", test.description, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+
+	// Without a catch-all, a default suppresses NoHandlerFound.
+	d = New()
+	d.RegisterDefault(Pin, named("pin default"))
+	if err := d.Dispatch(&events.Pin{}); err != nil {
+		t.Errorf("Dispatch(*events.Pin) = %v, need nil error", err)
+	}
+	if err := d.Dispatch(&events.Mute{}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(*events.Mute) = %v, want NoHandlerFound", err)
+	}
+	if d.HasHandler(Pin) {
+		t.Errorf("HasHandler(Pin) = true, want false for a default")
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultMaxEmitDepth is the depth to which emitted events may emit events, unless set with
+// SetMaxEmitDepth.
+const DefaultMaxEmitDepth = 8
+
+// ErrEmitDepth is returned by Emit when an emitted event would be too deep, which usually means
+// that handlers emit events in a cycle.
+var ErrEmitDepth = errors.New("emit depth exceeded")
+
+// emitted is an event that is queued by Emit, with its depth: 1 when it was emitted by the
+// handlers of a dispatched event, 2 when by the handlers of an event of depth 1, and so on.
+type emitted struct {
+	evt   interface{}
+	depth int
+}
+
+// emitQueue holds the events that are emitted, until the dispatch that is running completes.
+type emitQueue struct {
+	mu          sync.Mutex
+	queue       []emitted
+	maxDepth    int
+	depth       int  // of the emitted event that is being dispatched, 0 when none
+	dispatching int  // dispatches that are running
+	draining    bool // a dispatch is dispatching the queue
+}
+
+// enter and leave count the dispatches that are running.
+func (q *emitQueue) enter() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dispatching++
+}
+
+func (q *emitQueue) leave() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dispatching--
+}
+
+// Emit queues an event for dispatch after the dispatch of the current event, so that a handler
+// can publish an event that other handlers consume, such as a custom MediaDownloaded event (see
+// RegisterCustomType), without dispatching from inside a handler. Emitted events are dispatched
+// breadth-first, in the order in which they were emitted: the events that their handlers emit
+// come after them. When no dispatch is running, the event is dispatched right away.
+//
+// To catch cycles, an emitted event may only emit events to a depth of SetMaxEmitDepth; deeper
+// events aren't queued, and ErrEmitDepth is returned. The dispatch errors of emitted events
+// don't reach the dispatch whose handlers emitted them; they are counted, and go to the dispatch
+// hooks and the dead-letter handler, like those of any dispatch. With concurrent dispatches,
+// e.g. with Lanes, the events are dispatched by whichever dispatch completes first, and their
+// depth is approximate.
+func (d *Dispatcher) Emit(evt interface{}) error {
+	if _, ok := EventTypeOf(evt); !ok {
+		return fmt.Errorf("handlers.Dispatcher.Emit: unknown event %T, see RegisterCustomType", evt)
+	}
+	q := &d.emit
+	q.mu.Lock()
+	depth := q.depth + 1
+	if depth > q.maxDepth {
+		q.mu.Unlock()
+		return fmt.Errorf("handlers.Dispatcher.Emit: %T at depth %d: %w", evt, depth, ErrEmitDepth)
+	}
+	q.queue = append(q.queue, emitted{evt: evt, depth: depth})
+	idle := q.dispatching == 0
+	q.mu.Unlock()
+
+	if idle {
+		d.drainEmitted(context.Background())
+	}
+	return nil
+}
+
+// Emit queues an event for dispatch by the default dispatcher, see Dispatcher.Emit.
+func Emit(evt interface{}) error {
+	return defaultDispatcher.Emit(evt)
+}
+
+// SetMaxEmitDepth sets the depth to which emitted events may emit events, see Emit. Below 1,
+// handlers can't emit events.
+func (d *Dispatcher) SetMaxEmitDepth(n int) {
+	d.emit.mu.Lock()
+	defer d.emit.mu.Unlock()
+	d.emit.maxDepth = n
+}
+
+// SetMaxEmitDepth sets the emit depth of the default dispatcher, see Dispatcher.SetMaxEmitDepth.
+func SetMaxEmitDepth(n int) {
+	defaultDispatcher.SetMaxEmitDepth(n)
+}
+
+// drainEmitted dispatches the emitted events, unless another dispatch is doing so already. They
+// are dispatched under the values of the context, but not its deadline.
+func (d *Dispatcher) drainEmitted(ctx context.Context) {
+	q := &d.emit
+	q.mu.Lock()
+	if q.draining {
+		q.mu.Unlock()
+		return
+	}
+	q.draining = true
+	if len(q.queue) > 0 {
+		ctx = context.WithoutCancel(ctx)
+	}
+	for len(q.queue) > 0 {
+		e := q.queue[0]
+		q.queue = q.queue[1:]
+		q.depth = e.depth
+		q.mu.Unlock()
+		d.DispatchCtx(ctx, e.evt) // counts itself, and can't drain while this one does
+		q.mu.Lock()
+	}
+	q.draining, q.depth = false, 0
+	q.mu.Unlock()
+}
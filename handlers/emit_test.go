@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mediaDownloaded is a custom event.
+type mediaDownloaded struct {
+	id string
+}
+
+// cycle is a custom event whose handler emits it again.
+type cycle struct{}
+
+func TestRegisterCustomType(t *testing.T) {
+	tp := RegisterCustomType(mediaDownloaded{})
+	if tp < lastEventType {
+		t.Errorf("RegisterCustomType(mediaDownloaded{}) = %d, want a value from %d", tp, lastEventType)
+	}
+	if again := RegisterCustomType(&mediaDownloaded{}); again != tp {
+		t.Errorf("RegisterCustomType(&mediaDownloaded{}) = %v, want %v", again, tp)
+	}
+	if got := tp.String(); got != "mediaDownloaded" {
+		t.Errorf("String() = %q, want %q", got, "mediaDownloaded")
+	}
+	if got, err := ParseEventType("MediaDownloaded"); err != nil || got != tp {
+		t.Errorf("ParseEventType(%q) = %v, %v, want %v, nil", "MediaDownloaded", got, err, tp)
+	}
+	if got, ok := EventTypeOf(&mediaDownloaded{}); !ok || got != tp {
+		t.Errorf("EventTypeOf(*mediaDownloaded) = %v, %v, want %v, true", got, ok, tp)
+	}
+	if got := RegisterCustomType(&Edit{}); got != EditMessage {
+		t.Errorf("RegisterCustomType(&Edit{}) = %v, want %v", got, EditMessage)
+	}
+
+	d := New()
+	var got []string
+	d.Register(tp, handlerFunc(func(ev interface{}) error {
+		got = append(got, ev.(*mediaDownloaded).id)
+		return nil
+	}))
+	if err := d.Dispatch(&mediaDownloaded{id: "M1"}); err != nil {
+		t.Errorf("Dispatch(*mediaDownloaded) = %v, need nil error", err)
+	}
+	if len(got) != 1 || got[0] != "M1" {
+		t.Errorf("handler saw %q, want [M1]", got)
+	}
+	if s := d.Stats()[tp]; s.Dispatched != 1 {
+		t.Errorf("Stats()[%v].Dispatched = %d, want 1", tp, s.Dispatched)
+	}
+}
+
+func TestEmit(t *testing.T) {
+	media := RegisterCustomType(mediaDownloaded{})
+	d := New()
+	var got []string
+	emit := func(ids ...string) {
+		for _, id := range ids {
+			if err := d.Emit(&mediaDownloaded{id: id}); err != nil {
+				t.Errorf("Emit(%v) = %v, need nil error", id, err)
+			}
+		}
+	}
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		got = append(got, "message")
+		emit("A", "B")
+		got = append(got, "message done")
+		return nil
+	}))
+	d.Register(media, handlerFunc(func(ev interface{}) error {
+		id := ev.(*mediaDownloaded).id
+		got = append(got, id)
+		switch id {
+		case "A":
+			emit("A1", "A2")
+		case "B":
+			emit("B1")
+		}
+		return nil
+	}))
+
+	if err := d.Dispatch(message("M")); err != nil {
+		t.Errorf("Dispatch(_) = %v, need nil error", err)
+	}
+	if got, want := strings.Join(got, " "), "message message done A B A1 A2 B1"; got != want {
+		t.Errorf("handlers saw %q, want %q", got, want)
+	}
+
+	// Outside of a dispatch, an event is dispatched right away.
+	got = nil
+	emit("X")
+	if got, want := strings.Join(got, " "), "X"; got != want {
+		t.Errorf("handlers saw %q, want %q", got, want)
+	}
+
+	if err := d.Emit(struct{}{}); err == nil {
+		t.Errorf("Emit(struct{}{}) = nil, need error")
+	}
+}
+
+func TestEmitCycle(t *testing.T) {
+	tp := RegisterCustomType(cycle{})
+	d := New()
+	d.SetMaxEmitDepth(3)
+	handled := 0
+	d.Register(tp, handlerFunc(func(ev interface{}) error {
+		handled++
+		return d.Emit(&cycle{})
+	}))
+	var errs []error
+	d.AddDispatchHook(func(_ EventType, _ time.Duration, err *DispatchError) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	})
+
+	if err := d.Dispatch(&cycle{}); err != nil {
+		t.Errorf("Dispatch(_) = %v, need nil error", err)
+	}
+	if handled != 4 { // the dispatched event, and 3 deep
+		t.Errorf("handled %d events, want 4", handled)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrEmitDepth) {
+		t.Errorf("dispatch errors %v, want one with ErrEmitDepth", errs)
+	}
+}
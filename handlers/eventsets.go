@@ -0,0 +1,37 @@
+package handlers
+
+// The sets of related event types, e.g. to register a handler for all of them with RegisterMany.
+// Each returns a new slice, which the caller may change.
+
+// CallEvents returns the event types of calls.
+//
+//	handlers.RegisterMany(handlers.CallEvents(), calls)
+func CallEvents() []EventType {
+	return []EventType{
+		CallOffer, CallOfferNotice, CallPreAccept, CallAccept, CallTransport, CallRelayLatency,
+		CallTerminate, UnknownCallEvent,
+	}
+}
+
+// ChatSettingEvents returns the event types of the settings of chats that are synced from other
+// devices.
+func ChatSettingEvents() []EventType {
+	return []EventType{Archive, Pin, Mute, Star, MarkChatAsRead}
+}
+
+// ConnectionEvents returns the event types of the state of the connection, including the
+// keepalives and the reasons why the connection can't go on.
+func ConnectionEvents() []EventType {
+	return []EventType{
+		Connected, Disconnected, ConnectFailure, StreamError, StreamReplaced, LoggedOut,
+		ClientOutdated, TemporaryBan, KeepAliveTimeout, KeepAliveRestored, CATRefreshError,
+	}
+}
+
+// SyncEvents returns the event types of syncing the app state, the history and the events that
+// came in while offline.
+func SyncEvents() []EventType {
+	return []EventType{
+		AppState, AppStateSyncComplete, HistorySync, OfflineSyncPreview, OfflineSyncCompleted,
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// TestEventSets checks that every event type is in the set that this table says, so that a new
+// event type can't be added without deciding on its set.
+func TestEventSets(t *testing.T) {
+	sets := map[string][]EventType{
+		"call":        CallEvents(),
+		"chatSetting": ChatSettingEvents(),
+		"connection":  ConnectionEvents(),
+		"sync":        SyncEvents(),
+	}
+	want := map[EventType]string{
+		AppState: "sync", AppStateSyncComplete: "sync", Archive: "chatSetting", BusinessName: "",
+		CallAccept: "call", CallOffer: "call", CallOfferNotice: "call", CallRelayLatency: "call",
+		CallTerminate: "call", ChatPresence: "", ClientOutdated: "connection", Connected: "connection",
+		ConnectFailure: "connection", Contact: "", DeleteChat: "", DeleteForMe: "",
+		Disconnected: "connection", GroupInfo: "", HistorySync: "sync", IdentityChange: "",
+		JoinedGroup: "", KeepAliveRestored: "connection", KeepAliveTimeout: "connection",
+		LoggedOut: "connection", MarkChatAsRead: "chatSetting", MediaRetry: "", Message: "",
+		Mute: "chatSetting", OfflineSyncCompleted: "sync", OfflineSyncPreview: "sync", PairError: "",
+		PairSuccess: "", Picture: "", Pin: "chatSetting", Presence: "", PrivacySettings: "",
+		PushName: "", PushNameSetting: "", QR: "", QRScannedWithoutMultidevice: "", Receipt: "",
+		Star: "chatSetting", StreamError: "connection", StreamReplaced: "connection",
+		TemporaryBan: "connection", UnarchiveChatSetting: "", UndecryptableMessage: "",
+		UnknownCallEvent: "call", Blocklist: "", EditMessage: "", MessageRevoked: "",
+		StickerMessage: "", AnyEvent: "", ReceiptDelivered: "", ReceiptRead: "", ReceiptPlayed: "",
+		ReceiptRetry: "", NewsletterJoin: "", NewsletterLeave: "", NewsletterMuteChange: "",
+		NewsletterLiveUpdate: "", LabelEdit: "", LabelAssociationChat: "",
+		LabelAssociationMessage: "", CallPreAccept: "call", CallTransport: "call", FBMessage: "",
+		CATRefreshError: "connection", ClearChat: "", UserStatusMute: "",
+	}
+
+	got := map[EventType]string{}
+	for name, types := range sets {
+		for _, tp := range types {
+			if other, ok := got[tp]; ok {
+				t.Errorf("%v is in the sets %v and %v", tp, other, name)
+			}
+			got[tp] = name
+		}
+	}
+	for tp := firstEventType + 1; tp < lastEventType; tp++ {
+		w, ok := want[tp]
+		if !ok {
+			t.Errorf("%v isn't in the table of this test; add it, with its set", tp)
+			continue
+		}
+		if got[tp] != w {
+			t.Errorf("%v is in set %q, want %q", tp, got[tp], w)
+		}
+	}
+}
+
+func TestRegisterMany(t *testing.T) {
+	d := New()
+	var got []string
+	named := func(name string) handler {
+		return handlerFunc(func(ev interface{}) error {
+			got = append(got, fmt.Sprintf("%v %T", name, ev))
+			return nil
+		})
+	}
+	d.Register(Pin, named("first"))
+	d.RegisterMany(ChatSettingEvents(), named("many"))
+	d.Register(Pin, named("last"))
+
+	for _, evt := range []interface{}{&events.Pin{}, &events.Mute{}} {
+		if err := d.Dispatch(evt); err != nil {
+			t.Errorf("Dispatch(%T) = %v, need nil error", evt, err)
+		}
+	}
+	if want := "[first *events.Pin many *events.Pin last *events.Pin many *events.Mute]"; fmt.Sprint(got) != want {
+		t.Errorf("handlers saw %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Predicate selects the events that a handler of RegisterFiltered is invoked for.
+type Predicate func(evt interface{}) bool
+
+// filtered wraps a handler that is only invoked for the events that a predicate accepts.
+type filtered struct {
+	pred Predicate
+	h    handler
+}
+
+func (f *filtered) Handle(ev interface{}) error {
+	return f.HandleCtx(context.Background(), ev)
+}
+
+func (f *filtered) HandleCtx(ctx context.Context, ev interface{}) error {
+	if !f.pred(ev) {
+		markFiltered(ctx)
+		return nil
+	}
+	return invoke(ctx, f.h, ev)
+}
+
+// RegisterFiltered registers a handler that is only invoked for the events that `pred` accepts.
+// A filtered handler counts as a handler for the event type, also for the events that it skips:
+// Dispatch doesn't return NoHandlerFound for them.
+//
+//	d.RegisterFiltered(Message, NotFromMe(), h)
+func (d *Dispatcher) RegisterFiltered(t EventType, pred Predicate, h handler) {
+	d.Register(t, &filtered{pred: pred, h: h})
+}
+
+// RegisterFiltered registers a filtered handler with the default dispatcher, see
+// Dispatcher.RegisterFiltered.
+func RegisterFiltered(t EventType, pred Predicate, h handler) {
+	defaultDispatcher.RegisterFiltered(t, pred, h)
+}
+
+// ByChat accepts the Message events of a chat.
+func ByChat(chat types.JID) Predicate {
+	return func(evt interface{}) bool {
+		m, ok := evt.(*events.Message)
+		return ok && m.Info.Chat == chat
+	}
+}
+
+// NotFromMe accepts the Message events that weren't sent by me.
+func NotFromMe() Predicate {
+	return func(evt interface{}) bool {
+		m, ok := evt.(*events.Message)
+		return ok && !m.Info.IsFromMe
+	}
+}
+
+// HasText accepts the Message events with a text: a plain text, or the text of an extended text
+// message. Media captions don't count.
+func HasText() Predicate {
+	return func(evt interface{}) bool {
+		m, ok := evt.(*events.Message)
+		return ok && (m.Message.GetConversation() != "" || m.Message.GetExtendedTextMessage().GetText() != "")
+	}
+}
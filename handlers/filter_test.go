@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRegisterFiltered(t *testing.T) {
+	group := types.NewJID("123", types.GroupServer)
+	other := types.NewJID("456", types.GroupServer)
+	d := New()
+	var got []string
+	d.RegisterFiltered(Message, ByChat(group), handlerFunc(func(ev interface{}) error {
+		got = append(got, ev.(*events.Message).Info.ID)
+		return nil
+	}))
+
+	for _, test := range []struct {
+		description string
+		chat        types.JID
+		wantHandled bool
+	}{
+		{description: "accepted", chat: group, wantHandled: true},
+		{description: "rejected", chat: other},
+	} {
+		got = nil
+		m := &events.Message{}
+		m.Info.Chat = test.chat
+		m.Info.ID = test.description
+		// A rejected event counts as handled: there is a handler for the type.
+		if err := d.Dispatch(m); err != nil {
+			t.Errorf("%v: Dispatch(_) = %v, need nil error", test.description, err)
+		}
+		if handled := len(got) == 1; handled != test.wantHandled {
+			t.Errorf("%v: handled = %v, want %v", test.description, handled, test.wantHandled)
+		}
+	}
+
+	// Without any handler, there is still NoHandlerFound.
+	if err := d.Dispatch(&events.Receipt{}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(*events.Receipt) = %v, want NoHandlerFound", err)
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	chat := types.NewJID("123", types.GroupServer)
+	message := func(fromMe bool, msg *waE2E.Message) *events.Message {
+		m := &events.Message{Message: msg}
+		m.Info.Chat = chat
+		m.Info.IsFromMe = fromMe
+		return m
+	}
+	text := &waE2E.Message{Conversation: proto.String("hi")}
+	extended := &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: proto.String("hi")}}
+	image := &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Caption: proto.String("look")}}
+
+	for _, test := range []struct {
+		description string
+		pred        Predicate
+		evt         interface{}
+		want        bool
+	}{
+		{"ByChat, same chat", ByChat(chat), message(false, text), true},
+		{"ByChat, other chat", ByChat(types.NewJID("456", types.GroupServer)), message(false, text), false},
+		{"NotFromMe, from peer", NotFromMe(), message(false, text), true},
+		{"NotFromMe, from me", NotFromMe(), message(true, text), false},
+		{"HasText, conversation", HasText(), message(false, text), true},
+		{"HasText, extended text", HasText(), message(false, extended), true},
+		{"HasText, caption", HasText(), message(false, image), false},
+		{"not a message", NotFromMe(), &events.Receipt{}, false},
+	} {
+		if got := test.pred(test.evt); got != test.want {
+			t.Errorf("%v: predicate = %v, want %v", test.description, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+)
+
+// grouped wraps a handler of a group. The wrapper is what gets registered, so that the group can
+// unregister handlers that can't be compared, such as funcs.
+type grouped struct {
+	h handler
+}
+
+func (g *grouped) Handle(ev interface{}) error {
+	return g.HandleCtx(context.Background(), ev)
+}
+
+func (g *grouped) HandleCtx(ctx context.Context, ev interface{}) error {
+	return invoke(ctx, g.h, ev)
+}
+
+func (g *grouped) unwrap() handler { return g.h }
+
+// groupEntry is a registration of a group.
+type groupEntry struct {
+	t EventType
+	g *grouped
+}
+
+// Group registers handlers with a dispatcher, and unregisters them all at once, e.g. when a
+// feature of a bot is unloaded. Handlers that were registered outside the group aren't affected.
+// Use NewGroup.
+type Group struct {
+	name string
+	d    *Dispatcher
+
+	mu      sync.Mutex
+	entries []groupEntry
+}
+
+// NewGroup returns a group of handlers of the dispatcher. The name is for the caller's
+// bookkeeping, e.g. the name of a plugin.
+func (d *Dispatcher) NewGroup(name string) *Group {
+	return &Group{name: name, d: d}
+}
+
+// NewGroup returns a group of handlers of the default dispatcher, see Dispatcher.NewGroup.
+func NewGroup(name string) *Group {
+	return defaultDispatcher.NewGroup(name)
+}
+
+// Name returns the name of the group.
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Register registers a handler for an event type with the dispatcher of the group, see
+// Dispatcher.Register.
+func (g *Group) Register(t EventType, h handler) {
+	gh := &grouped{h: h}
+	g.mu.Lock()
+	g.entries = append(g.entries, groupEntry{t: t, g: gh})
+	g.mu.Unlock()
+	g.d.Register(t, gh)
+}
+
+// Close unregisters the handlers of the group, in reverse order of registration. The group may
+// be used again afterwards.
+func (g *Group) Close() {
+	g.mu.Lock()
+	entries := g.entries
+	g.entries = nil
+	g.mu.Unlock()
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		g.d.Unregister(entries[i].t, entries[i].g)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestGroup(t *testing.T) {
+	d := New()
+	var got []string
+	seen := func(name string) handlerFunc {
+		return func(ev interface{}) error {
+			got = append(got, fmt.Sprintf("%v %T", name, ev))
+			return nil
+		}
+	}
+	d.Register(Message, seen("outside"))
+	weather, reminders := d.NewGroup("weather"), d.NewGroup("reminders")
+	weather.Register(Message, seen("weather"))
+	weather.Register(Presence, seen("weather"))
+	reminders.Register(Message, seen("reminders"))
+	reminders.Register(Receipt, seen("reminders"))
+
+	dispatch := func() {
+		got = nil
+		for _, evt := range []interface{}{&events.Message{}, &events.Presence{}, &events.Receipt{}} {
+			d.Dispatch(evt)
+		}
+	}
+	dispatch()
+	want := "[outside *events.Message weather *events.Message reminders *events.Message weather *events.Presence reminders *events.Receipt]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("with both groups, handlers saw %v, want %v", got, want)
+	}
+
+	weather.Close()
+	dispatch()
+	want = "[outside *events.Message reminders *events.Message reminders *events.Receipt]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("after closing %v, handlers saw %v, want %v", weather.Name(), got, want)
+	}
+	if d.HasHandler(Presence) {
+		t.Errorf("HasHandler(Presence) = true after closing the group, want false")
+	}
+
+	reminders.Close()
+	reminders.Close() // does nothing
+	if got, want := d.HandlerCount(), 1; got != want {
+		t.Errorf("HandlerCount() = %v after closing both groups, want %v", got, want)
+	}
+}
@@ -3,131 +3,344 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.mau.fi/whatsmeow/types/events"
 )
 
 // EventType is an enum for whatsmeow events.
+//
+// The values are frozen, so that they can be stored, e.g. in a database: each constant has an
+// explicit value that never changes, and new types get the next values at the end. Even so, names
+// are the better choice for new code, see MarshalText.
 type EventType int
 
 const (
-	firstEventType EventType = iota // Keep at first slot for tests
-
-	AppState
-	AppStateSyncComplete
-	Archive
-	BusinessName
-	CallAccept
-	CallOffer
-	CallOfferNotice
-	CallRelayLatency
-	CallTerminate
-	ChatPresence
-	ClientOutdated
-	Connected
-	ConnectFailure
-	Contact
-	DeleteChat
-	DeleteForMe
-	Disconnected
-	GroupInfo
-	HistorySync
-	IdentityChange
-	JoinedGroup
-	KeepAliveRestored
-	KeepAliveTimeout
-	LoggedOut
-	MarkChatAsRead
-	MediaRetry
-	Message
-	Mute
-	OfflineSyncCompleted
-	OfflineSyncPreview
-	PairError
-	PairSuccess
-	Picture
-	Pin
-	Presence
-	PrivacySettings
-	PushName
-	PushNameSetting
-	QR
-	QRScannedWithoutMultidevice
-	Receipt
-	Star
-	StreamError
-	StreamReplaced
-	TemporaryBan
-	UnarchiveChatSetting
-	UndecryptableMessage
-	UnknownCallEvent
-
-	lastEventType // Keep at last slot for tests
+	firstEventType EventType = 0 // Keep at first slot for tests
+
+	AppState                    EventType = 1
+	AppStateSyncComplete        EventType = 2
+	Archive                     EventType = 3
+	BusinessName                EventType = 4
+	CallAccept                  EventType = 5
+	CallOffer                   EventType = 6
+	CallOfferNotice             EventType = 7
+	CallRelayLatency            EventType = 8
+	CallTerminate               EventType = 9
+	ChatPresence                EventType = 10
+	ClientOutdated              EventType = 11
+	Connected                   EventType = 12
+	ConnectFailure              EventType = 13
+	Contact                     EventType = 14
+	DeleteChat                  EventType = 15
+	DeleteForMe                 EventType = 16
+	Disconnected                EventType = 17
+	GroupInfo                   EventType = 18
+	HistorySync                 EventType = 19
+	IdentityChange              EventType = 20
+	JoinedGroup                 EventType = 21
+	KeepAliveRestored           EventType = 22
+	KeepAliveTimeout            EventType = 23
+	LoggedOut                   EventType = 24
+	MarkChatAsRead              EventType = 25
+	MediaRetry                  EventType = 26
+	Message                     EventType = 27
+	Mute                        EventType = 28
+	OfflineSyncCompleted        EventType = 29
+	OfflineSyncPreview          EventType = 30
+	PairError                   EventType = 31
+	PairSuccess                 EventType = 32
+	Picture                     EventType = 33
+	Pin                         EventType = 34
+	Presence                    EventType = 35
+	PrivacySettings             EventType = 36
+	PushName                    EventType = 37
+	PushNameSetting             EventType = 38
+	QR                          EventType = 39
+	QRScannedWithoutMultidevice EventType = 40
+	Receipt                     EventType = 41
+	Star                        EventType = 42
+	StreamError                 EventType = 43
+	StreamReplaced              EventType = 44
+	TemporaryBan                EventType = 45
+	UnarchiveChatSetting        EventType = 46
+	UndecryptableMessage        EventType = 47
+	UnknownCallEvent            EventType = 48
+
+	// Added later. New types go at the end, with the next values.
+	Blocklist               EventType = 49
+	EditMessage             EventType = 50 // synthetic, see Edit
+	MessageRevoked          EventType = 51 // synthetic, see Revoke
+	StickerMessage          EventType = 52 // synthetic, see Sticker
+	AnyEvent                EventType = 53 // catch-all, see Register
+	ReceiptDelivered        EventType = 54 // synthetic, see ReceiptEventType
+	ReceiptRead             EventType = 55 // synthetic, see ReceiptEventType
+	ReceiptPlayed           EventType = 56 // synthetic, see ReceiptEventType
+	ReceiptRetry            EventType = 57 // synthetic, see ReceiptEventType
+	NewsletterJoin          EventType = 58
+	NewsletterLeave         EventType = 59
+	NewsletterMuteChange    EventType = 60
+	NewsletterLiveUpdate    EventType = 61
+	LabelEdit               EventType = 62
+	LabelAssociationChat    EventType = 63
+	LabelAssociationMessage EventType = 64
+	CallPreAccept           EventType = 65 // see CallEvents
+	CallTransport           EventType = 66
+	FBMessage               EventType = 67
+	CATRefreshError         EventType = 68 // the connection failed, and refreshing its token (client.RefreshCAT) failed too
+	ClearChat               EventType = 69 // a chat was cleared on another device; unlike DeleteChat, the chat stays
+	UserStatusMute          EventType = 70 // the status updates of a user were muted or unmuted
+
+	lastEventType EventType = 71 // Keep at last slot for tests; one more than the last value
 )
 
-// String returns the string representation of a Type.
+// eventTable declares the event types: their names, and the Go types of the events that Dispatch
+// dispatches as them. String, ParseEventType, Dispatch and EventTypeOf all derive from this
+// table, so adding an event type takes a constant and a row. Types without events of their own,
+// such as AnyEvent and the receipt kinds, have no Go type (nil).
+var eventTable = []struct {
+	t    EventType
+	name string
+	evt  interface{} // a zero value of the struct type of the events
+}{
+	{AppState, "AppState", events.AppState{}},
+	{AppStateSyncComplete, "AppStateSyncComplete", events.AppStateSyncComplete{}},
+	{Archive, "Archive", events.Archive{}},
+	{BusinessName, "BusinessName", events.BusinessName{}},
+	{CallAccept, "CallAccept", events.CallAccept{}},
+	{CallOffer, "CallOffer", events.CallOffer{}},
+	{CallOfferNotice, "CallOfferNotice", events.CallOfferNotice{}},
+	{CallRelayLatency, "CallRelayLatency", events.CallRelayLatency{}},
+	{CallTerminate, "CallTerminate", events.CallTerminate{}},
+	{ChatPresence, "ChatPresence", events.ChatPresence{}},
+	{ClientOutdated, "ClientOutdated", events.ClientOutdated{}},
+	{Connected, "Connected", events.Connected{}},
+	{ConnectFailure, "ConnectFailure", events.ConnectFailure{}},
+	{Contact, "Contact", events.Contact{}},
+	{DeleteChat, "DeleteChat", events.DeleteChat{}},
+	{DeleteForMe, "DeleteForMe", events.DeleteForMe{}},
+	{Disconnected, "Disconnected", events.Disconnected{}},
+	{GroupInfo, "GroupInfo", events.GroupInfo{}},
+	{HistorySync, "HistorySync", events.HistorySync{}},
+	{IdentityChange, "IdentityChange", events.IdentityChange{}},
+	{JoinedGroup, "JoinedGroup", events.JoinedGroup{}},
+	{KeepAliveRestored, "KeepAliveRestored", events.KeepAliveRestored{}},
+	{KeepAliveTimeout, "KeepAliveTimeout", events.KeepAliveTimeout{}},
+	{LoggedOut, "LoggedOut", events.LoggedOut{}},
+	{MarkChatAsRead, "MarkChatAsRead", events.MarkChatAsRead{}},
+	{MediaRetry, "MediaRetry", events.MediaRetry{}},
+	{Message, "Message", events.Message{}},
+	{Mute, "Mute", events.Mute{}},
+	{OfflineSyncCompleted, "OfflineSyncCompleted", events.OfflineSyncCompleted{}},
+	{OfflineSyncPreview, "OfflineSyncPreview", events.OfflineSyncPreview{}},
+	{PairError, "PairError", events.PairError{}},
+	{PairSuccess, "PairSuccess", events.PairSuccess{}},
+	{Picture, "Picture", events.Picture{}},
+	{Pin, "Pin", events.Pin{}},
+	{Presence, "Presence", events.Presence{}},
+	{PrivacySettings, "PrivacySettings", events.PrivacySettings{}},
+	{PushName, "PushName", events.PushName{}},
+	{PushNameSetting, "PushNameSetting", events.PushNameSetting{}},
+	{QR, "QR", events.QR{}},
+	{QRScannedWithoutMultidevice, "QRScannedWithoutMultidevice", events.QRScannedWithoutMultidevice{}},
+	{Receipt, "Receipt", events.Receipt{}},
+	{Star, "Star", events.Star{}},
+	{StreamError, "StreamError", events.StreamError{}},
+	{StreamReplaced, "StreamReplaced", events.StreamReplaced{}},
+	{TemporaryBan, "TemporaryBan", events.TemporaryBan{}},
+	{UnarchiveChatSetting, "UnarchiveChatSetting", events.UnarchiveChatsSetting{}},
+	{UndecryptableMessage, "UndecryptableMessage", events.UndecryptableMessage{}},
+	{UnknownCallEvent, "UnknownCallEvent", events.UnknownCallEvent{}},
+	{Blocklist, "Blocklist", events.Blocklist{}},
+	{EditMessage, "EditMessage", Edit{}},
+	{MessageRevoked, "MessageRevoked", Revoke{}},
+	{StickerMessage, "StickerMessage", Sticker{}},
+	{AnyEvent, "AnyEvent", nil},
+	{ReceiptDelivered, "ReceiptDelivered", nil},
+	{ReceiptRead, "ReceiptRead", nil},
+	{ReceiptPlayed, "ReceiptPlayed", nil},
+	{ReceiptRetry, "ReceiptRetry", nil},
+	{NewsletterJoin, "NewsletterJoin", events.NewsletterJoin{}},
+	{NewsletterLeave, "NewsletterLeave", events.NewsletterLeave{}},
+	{NewsletterMuteChange, "NewsletterMuteChange", events.NewsletterMuteChange{}},
+	{NewsletterLiveUpdate, "NewsletterLiveUpdate", events.NewsletterLiveUpdate{}},
+	{LabelEdit, "LabelEdit", events.LabelEdit{}},
+	{LabelAssociationChat, "LabelAssociationChat", events.LabelAssociationChat{}},
+	{LabelAssociationMessage, "LabelAssociationMessage", events.LabelAssociationMessage{}},
+	{CallPreAccept, "CallPreAccept", events.CallPreAccept{}},
+	{CallTransport, "CallTransport", events.CallTransport{}},
+	{FBMessage, "FBMessage", events.FBMessage{}},
+	{CATRefreshError, "CATRefreshError", events.CATRefreshError{}},
+	{ClearChat, "ClearChat", events.ClearChat{}},
+	{UserStatusMute, "UserStatusMute", events.UserStatusMute{}},
+}
+
+// eventTypeNames maps the event types to their names.
+var eventTypeNames = func() map[EventType]string {
+	m := make(map[EventType]string, len(eventTable))
+	for _, row := range eventTable {
+		m[row.t] = row.name
+	}
+	return m
+}()
+
+// String returns the string representation of a Type, or e.g. "EventType(999)" for values that
+// aren't event types.
 func (t EventType) String() string {
-	return []string{
-		"", // unused
-		"AppState",
-		"AppStateSyncComplete",
-		"Archive",
-		"BusinessName",
-		"CallAccept",
-		"CallOffer",
-		"CallOfferNotice",
-		"CallRelayLatency",
-		"CallTerminate",
-		"ChatPresence",
-		"ClientOutdated",
-		"Connected",
-		"ConnectFailure",
-		"Contact",
-		"DeleteChat",
-		"DeleteForMe",
-		"Disconnected",
-		"GroupInfo",
-		"HistorySync",
-		"IdentityChange",
-		"JoinedGroup",
-		"KeepAliveRestored",
-		"KeepAliveTimeout",
-		"LoggedOut",
-		"MarkChatAsRead",
-		"MediaRetry",
-		"Message",
-		"Mute",
-		"OfflineSyncCompleted",
-		"OfflineSyncPreview",
-		"PairError",
-		"PairSuccess",
-		"Picture",
-		"Pin",
-		"Presence",
-		"PrivacySettings",
-		"PushName",
-		"PushNameSetting",
-		"QR",
-		"QRScannedWithoutMultidevice",
-		"Receipt",
-		"Star",
-		"StreamError",
-		"StreamReplaced",
-		"TemporaryBan",
-		"UnarchiveChatSetting",
-		"UndecryptableMessage",
-		"UnknownCallEvent",
-	}[t]
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	if name, ok := customName(t); ok {
+		return name
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// eventTypesByName maps the lower-case names of the event types to their values.
+var eventTypesByName = func() map[string]EventType {
+	m := map[string]EventType{}
+	for t := firstEventType + 1; t < lastEventType; t++ {
+		m[strings.ToLower(t.String())] = t
+	}
+	return m
+}()
+
+// ParseEventType returns the event type of a name, such as "Message" or "receipt", including the
+// names of custom types (see RegisterCustomType). Names are matched case-insensitively.
+func ParseEventType(s string) (EventType, error) {
+	custom.mu.RLock()
+	t, ok := lookupName(strings.TrimSpace(s))
+	custom.mu.RUnlock()
+	if !ok {
+		return firstEventType, fmt.Errorf("handlers.ParseEventType: unknown event type %q", s)
+	}
+	return t, nil
+}
+
+// Set implements flag.Value, so that an event type can be given on the command line:
+//
+//	var t handlers.EventType
+//	flag.Var(&t, "event", "event type to handle")
+func (t *EventType) Set(s string) error {
+	v, err := ParseEventType(s)
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, so that an event type is encoded as its name,
+// e.g. in JSON, and as the key of a map. Values that aren't event types fail.
+func (t EventType) MarshalText() ([]byte, error) {
+	name := t.String()
+	if _, err := ParseEventType(name); err != nil {
+		return nil, fmt.Errorf("handlers.EventType.MarshalText: %d isn't an event type", int(t))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that an event type can be decoded from
+// its name in e.g. JSON or YAML configs.
+func (t *EventType) UnmarshalText(text []byte) error {
+	return t.Set(string(text))
 }
 
 type handler interface {
 	Handle(evt interface{}) error
 }
 
-var registry = make(map[EventType][]handler)
-var registryMutex sync.Mutex
+// ContextHandler is implemented by handlers that want the context of DispatchCtx, e.g. to cancel
+// database queries or HTTP requests. Dispatch calls HandleCtx instead of Handle on them.
+type ContextHandler interface {
+	HandleCtx(ctx context.Context, evt interface{}) error
+}
+
+// TypedHandler is implemented by handlers that want the event type, e.g. one handler that is
+// registered for Archive, Pin, Mute and Star. Dispatch calls HandleTyped instead of Handle on
+// them. A handler that also implements ContextHandler gets HandleCtx, which can get the event type
+// using EventTypeFromContext.
+type TypedHandler interface {
+	HandleTyped(t EventType, evt interface{}) error
+}
+
+// eventTypeKey is the context key of the event type, see EventTypeFromContext.
+type eventTypeKey struct{}
+
+// EventTypeFromContext returns the event type that a handler is invoked for, from the context
+// that HandleCtx gets, and false outside of a dispatch. For catch-alls, it is the type of the
+// event rather than AnyEvent.
+func EventTypeFromContext(ctx context.Context) (EventType, bool) {
+	t, ok := ctx.Value(eventTypeKey{}).(EventType)
+	return t, ok
+}
+
+// invoke runs a handler with the method that it prefers: HandleCtx, HandleTyped or Handle.
+func invoke(ctx context.Context, h handler, ev interface{}) error {
+	if ch, ok := h.(ContextHandler); ok {
+		return ch.HandleCtx(ctx, ev)
+	}
+	if th, ok := h.(TypedHandler); ok {
+		if t, ok := EventTypeFromContext(ctx); ok {
+			return th.HandleTyped(t, ev)
+		}
+	}
+	return h.Handle(ev)
+}
+
+// Dispatcher holds a registry of handlers and dispatches events to them. Independent
+// dispatchers allow e.g. two WhatsApp sessions with different handlers in one process. The
+// package-level functions use a default dispatcher.
+type Dispatcher struct {
+	// mu guards the registry, the hooks and the mode. Dispatch only read-locks it to take the
+	// slice of handlers, and runs them unlocked; slices are appended to or replaced, but never
+	// changed in place, so the taken slice stays intact.
+	mu              sync.RWMutex
+	registry        map[EventType][]handler
+	defaults        map[EventType][]handler  // see RegisterDefault
+	chains          [numEventTypes][]handler // per type: the catch-alls, then the handlers or defaults
+	hooks           []DispatchHook
+	middleware      []ContextMiddleware
+	continueOnError bool
+	timeout         time.Duration
+	flushers        []func() // of debounced handlers, run by Close
+	deadLetter      DeadLetterFunc
+	deadLetterAll   bool // also failures
+	holdMax         int  // see HoldUnhandled
+	held            []interface{}
+	ignored         map[EventType]bool // see Ignore
+	ignoreAll       bool               // see IgnoreUnhandled
+	paused          bool               // see Pause
+	pauseMax        int
+	pauseBuf        []interface{}
+	resuming        sync.Mutex // serializes Resume
+	order           []handler  // in order of registration, see Start
+	closed          bool
+	inFlight        sync.WaitGroup // dispatches, see Close
+	emit            emitQueue      // see Emit; not guarded by mu
+	journal         Journal        // see SetJournal
+
+	stats [numEventTypes]counters // indexed by event type; atomic, not guarded by mu
+}
+
+// New returns a dispatcher without handlers.
+func New() *Dispatcher {
+	return &Dispatcher{
+		registry: map[EventType][]handler{},
+		emit:     emitQueue{maxDepth: DefaultMaxEmitDepth},
+	}
+}
+
+// defaultDispatcher is used by the package-level functions.
+var defaultDispatcher = New()
 
 // Register registers a handler for an event type. The handler must expose a method
 //
@@ -147,42 +360,383 @@ var registryMutex sync.Mutex
 // More than one handlers may be registered for an event. Upon encountering the event,
 // the handlers will be called in-order.
 //
-//	Register(Message, h1)
-//	Register(Message, h2)
+//	d.Register(Message, h1)
+//	d.Register(Message, h2)
 //	// When a `Message` is seen, first `h1.Handle(ev)` is invoked, then `h2.Handle(ev)`.
+//
+// Handlers that are registered for `AnyEvent` are catch-alls: they are invoked for every event
+// that Dispatch recognizes, including the synthetic events, before the handlers of the event
+// type. A receipt is seen once, also when it is dispatched to the handlers of its kind (see
+// ReceiptEventType). A catch-all counts as a handler, so with a catch-all, Dispatch never returns
+// NoHandlerFound.
+func (d *Dispatcher) Register(t EventType, h handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.registry[t] = append(d.registry[t], h)
+	d.order = append(d.order, h)
+	d.rebuildChains(t)
+}
+
+// Register registers a handler with the default dispatcher, see Dispatcher.Register.
 func Register(t EventType, h handler) {
-	registryMutex.Lock()
-	defer registryMutex.Unlock()
+	defaultDispatcher.Register(t, h)
+}
+
+// RegisterMany registers a handler for each of a set of event types, such as CallEvents, like
+// calling Register for each of them in order.
+func (d *Dispatcher) RegisterMany(types []EventType, h handler) {
+	for _, t := range types {
+		d.Register(t, h)
+	}
+}
+
+// RegisterMany registers a handler for a set of event types with the default dispatcher, see
+// Dispatcher.RegisterMany.
+func RegisterMany(types []EventType, h handler) {
+	defaultDispatcher.RegisterMany(types, h)
+}
+
+// once wraps a handler that is removed after its first invocation.
+type once struct {
+	d     *Dispatcher
+	t     EventType
+	h     handler
+	fired atomic.Bool
+}
+
+func (o *once) Handle(ev interface{}) error {
+	return o.HandleCtx(context.Background(), ev)
+}
+
+func (o *once) HandleCtx(ctx context.Context, ev interface{}) error {
+	if !o.fired.CompareAndSwap(false, true) {
+		return nil // a concurrent dispatch was first
+	}
+	o.d.Unregister(o.t, o)
+	return invoke(ctx, o.h, ev)
+}
+
+// RegisterOnce registers a handler that is removed after it was invoked once, whether or not it
+// returned an error, e.g. to wait for the next PairSuccess. When events of the type are
+// dispatched concurrently, the handler is still invoked only once.
+func (d *Dispatcher) RegisterOnce(t EventType, h handler) {
+	d.Register(t, &once{d: d, t: t, h: h})
+}
+
+// RegisterOnce registers a handler with the default dispatcher, see Dispatcher.RegisterOnce.
+func RegisterOnce(t EventType, h handler) {
+	defaultDispatcher.RegisterOnce(t, h)
+}
+
+// DeadLetterFunc gets the events that weren't handled, see SetDeadLetterHandler. `reason` is
+// NoHandlerFound, HandlerFailed or HandlerPanicked, and `err` is the error of the dispatch.
+type DeadLetterFunc func(t EventType, evt interface{}, reason DispatchErrorType, err error)
+
+// SetDeadLetterHandler sets a func that gets the events without handlers, e.g. to store them for
+// later inspection. With a dead-letter handler, Dispatch no longer returns NoHandlerFound. For
+// synthetic events, such as EditMessage, the event that they are derived from is passed. Nil
+// removes the dead-letter handler. See SetDeadLetterFailures to also get failed events.
+func (d *Dispatcher) SetDeadLetterHandler(f DeadLetterFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.deadLetter = f
+}
+
+// SetDeadLetterHandler sets the dead-letter handler of the default dispatcher, see
+// Dispatcher.SetDeadLetterHandler.
+func SetDeadLetterHandler(f DeadLetterFunc) {
+	defaultDispatcher.SetDeadLetterHandler(f)
+}
+
+// SetDeadLetterFailures sets whether the dead-letter handler also gets the events of failing or
+// panicking handlers. Dispatch still returns their errors. Off by default.
+func (d *Dispatcher) SetDeadLetterFailures(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.deadLetterAll = on
+}
+
+// SetDeadLetterFailures sets the mode of the default dispatcher, see
+// Dispatcher.SetDeadLetterFailures.
+func SetDeadLetterFailures(on bool) {
+	defaultDispatcher.SetDeadLetterFailures(on)
+}
+
+// toDeadLetter passes an event that wasn't handled to the dead-letter handler, if any, and
+// returns the error that Dispatch returns.
+func (d *Dispatcher) toDeadLetter(t EventType, evt interface{}, err *DispatchError) *DispatchError {
+	if err == nil {
+		return nil
+	}
+	d.mu.RLock()
+	dl, all := d.deadLetter, d.deadLetterAll
+	d.mu.RUnlock()
+	if dl == nil {
+		return err
+	}
+	switch err.Type {
+	case NoHandlerFound:
+		dl(t, evt, err.Type, err.Err)
+		return nil
+	case HandlerFailed, HandlerPanicked:
+		if all {
+			dl(t, evt, err.Type, err.Err)
+		}
+	}
+	return err
+}
+
+// ErrStopPropagation is returned by a handler that consumed an event, to skip the remaining
+// handlers of the event without failing the dispatch. Handlers may wrap it. It stops the handlers
+// of one event: the synthetic events that are derived from it, such as EditMessage, are still
+// dispatched.
+var ErrStopPropagation = errors.New("stop propagation")
+
+// HandlerFunc handles an event of a type. In a middleware chain, the innermost HandlerFunc runs
+// the handlers of the event; it returns nil or a *DispatchError.
+type HandlerFunc func(t EventType, ev interface{}) error
+
+// Middleware wraps the handling of every event that Dispatch recognizes, e.g. for logging,
+// timing or deduplication. It calls `next` to go on with the chain, or returns without calling
+// it to skip the handlers. It sees the error of `next` on the way out, and may change it: a
+// returned error that isn't a *DispatchError is returned by Dispatch with type HandlerFailed.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Use adds a middleware. The middleware that is added first is the outermost: it is the first
+// to see an event, and the last to see the error.
+func (d *Dispatcher) Use(mw Middleware) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.middleware = append(d.middleware, withoutCtx(mw))
+}
+
+// Use adds a middleware to the default dispatcher, see Dispatcher.Use.
+func Use(mw Middleware) {
+	defaultDispatcher.Use(mw)
+}
+
+// ContextHandlerFunc is HandlerFunc with the context of DispatchCtx.
+type ContextHandlerFunc func(ctx context.Context, t EventType, ev interface{}) error
+
+// ContextMiddleware is Middleware that sees the context of DispatchCtx, and may pass a derived
+// context on to `next`, e.g. with a tracing span. The handlers that implement ContextHandler get
+// the context that the innermost middleware passes on.
+type ContextMiddleware func(next ContextHandlerFunc) ContextHandlerFunc
+
+// UseCtx adds a context middleware. Middleware of Use and UseCtx form one chain, in the order in
+// which it was added.
+func (d *Dispatcher) UseCtx(mw ContextMiddleware) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.middleware = append(d.middleware, mw)
+}
+
+// UseCtx adds a context middleware to the default dispatcher, see Dispatcher.UseCtx.
+func UseCtx(mw ContextMiddleware) {
+	defaultDispatcher.UseCtx(mw)
+}
+
+// withoutCtx adapts a middleware to a context middleware that passes the context through.
+func withoutCtx(mw Middleware) ContextMiddleware {
+	return func(next ContextHandlerFunc) ContextHandlerFunc {
+		return func(ctx context.Context, t EventType, ev interface{}) error {
+			return mw(func(t EventType, ev interface{}) error {
+				return next(ctx, t, ev)
+			})(t, ev)
+		}
+	}
+}
+
+// SetContinueOnError sets whether Dispatch runs all handlers of an event, also when one of them
+// fails or panics. By default, the first failing handler stops the chain. When all handlers run,
+// the error joins the errors of the failing handlers (see `errors.Join`), each stating the
+// position and the type of its handler. Its type is HandlerPanicked when a handler panicked, and
+// HandlerFailed otherwise.
+func (d *Dispatcher) SetContinueOnError(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.continueOnError = on
+}
+
+// SetContinueOnError sets the mode of the default dispatcher, see Dispatcher.SetContinueOnError.
+func SetContinueOnError(on bool) {
+	defaultDispatcher.SetContinueOnError(on)
+}
+
+// SetTimeout sets how long a dispatch may take, so that a stuck handler can't hold up the
+// dispatching of further events. Zero, the default, means no timeout. See DispatchCtx.
+func (d *Dispatcher) SetTimeout(timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.timeout = timeout
+}
+
+// SetTimeout sets the timeout of the default dispatcher, see Dispatcher.SetTimeout.
+func SetTimeout(timeout time.Duration) {
+	defaultDispatcher.SetTimeout(timeout)
+}
+
+// Unregister removes a handler that was registered for an event type, and returns whether it
+// was found. Handlers are compared by identity, so pass the same pointer as to Register. When
+// a handler was registered more than once, the last registration is removed. The order of the
+// remaining handlers is kept, and a Dispatch that is running completes with the handlers that
+// it started with.
+func (d *Dispatcher) Unregister(t EventType, h handler) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hs := d.registry[t]
+	for i := len(hs) - 1; i >= 0; i-- {
+		if !same(hs[i], h) {
+			continue
+		}
+		// Copy, since Dispatch may be iterating over the old slice.
+		kept := make([]handler, 0, len(hs)-1)
+		kept = append(kept, hs[:i]...)
+		kept = append(kept, hs[i+1:]...)
+		if len(kept) == 0 {
+			delete(d.registry, t)
+		} else {
+			d.registry[t] = kept
+		}
+		d.rebuildChains(t)
+		return true
+	}
+	return false
+}
+
+// Unregister removes a handler from the default dispatcher, see Dispatcher.Unregister.
+func Unregister(t EventType, h handler) bool {
+	return defaultDispatcher.Unregister(t, h)
+}
+
+// UnregisterAll removes all handlers for an event type.
+func (d *Dispatcher) UnregisterAll(t EventType) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.registry, t)
+	d.rebuildChains(t)
+}
 
-	if _, ok := registry[t]; !ok {
-		registry[t] = []handler{}
+// UnregisterAll removes all handlers for an event type from the default dispatcher.
+func UnregisterAll(t EventType) {
+	defaultDispatcher.UnregisterAll(t)
+}
+
+// Registered returns the event types that have handlers, with the number of handlers of each,
+// e.g. for a health endpoint. The map is a snapshot that later registrations don't change.
+// Catch-alls are counted under AnyEvent.
+func (d *Dispatcher) Registered() map[EventType]int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	reg := make(map[EventType]int, len(d.registry))
+	for t, hs := range d.registry {
+		reg[t] = len(hs)
+	}
+	return reg
+}
+
+// Registered returns the handler counts of the default dispatcher, see Dispatcher.Registered.
+func Registered() map[EventType]int {
+	return defaultDispatcher.Registered()
+}
+
+// HasHandler returns whether handlers are registered for an event type, not counting
+// catch-alls. For example, startup code can check that the mandatory handlers are wired before
+// connecting.
+func (d *Dispatcher) HasHandler(t EventType) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return len(d.registry[t]) > 0
+}
+
+// HasHandler returns whether the default dispatcher has handlers for an event type, see
+// Dispatcher.HasHandler.
+func HasHandler(t EventType) bool {
+	return defaultDispatcher.HasHandler(t)
+}
+
+// HandlerCount returns the number of registered handlers over all event types, catch-alls
+// included. A handler that is registered for two types counts twice.
+func (d *Dispatcher) HandlerCount() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	n := 0
+	for _, hs := range d.registry {
+		n += len(hs)
 	}
-	registry[t] = append(registry[t], h)
+	return n
+}
+
+// HandlerCount returns the number of handlers of the default dispatcher, see
+// Dispatcher.HandlerCount.
+func HandlerCount() int {
+	return defaultDispatcher.HandlerCount()
+}
+
+// same compares handlers by identity. Handlers of types that can't be compared, such as
+// funcs, are never the same.
+func same(a, b handler) bool {
+	tp := reflect.TypeOf(a)
+	if tp == nil || tp != reflect.TypeOf(b) || !tp.Comparable() {
+		return false
+	}
+	return a == b
 }
 
 type dispatchErrorType int
 
+// DispatchErrorType names the type of DispatchError.Type, e.g. for the argument of a
+// DeadLetterFunc.
+type DispatchErrorType = dispatchErrorType
+
 const (
 	firstDispatchError dispatchErrorType = iota // Keep at first slot for tests
 
 	NoHandlerFound
 	HandlerFailed
 	UnknownEvent
+	HandlerPanicked
+	DispatcherClosed
+	JournalFailed
 
 	lastDispatchError // Keep at last slot for tests
 )
 
+// dispatchErrorTypeNames maps the dispatch error types to their names.
+var dispatchErrorTypeNames = map[dispatchErrorType]string{
+	NoHandlerFound:   "NoHandlerFound",
+	HandlerFailed:    "HandlerFailed",
+	UnknownEvent:     "UnknownEvent",
+	HandlerPanicked:  "HandlerPanicked",
+	DispatcherClosed: "DispatcherClosed",
+	JournalFailed:    "JournalFailed",
+}
+
+// String returns the name of a dispatch error type, or e.g. "dispatchErrorType(9)" for values
+// that aren't dispatch error types.
 func (d dispatchErrorType) String() string {
-	return []string{
-		"",
-		"NoHandlerFound",
-		"HandlerFailed",
-		"UnknownEvent",
-	}[d]
+	if name, ok := dispatchErrorTypeNames[d]; ok {
+		return name
+	}
+	return fmt.Sprintf("dispatchErrorType(%d)", int(d))
 }
 
 // DispatchError enriches the error returned by Dispatch with an error reason, which may be
-// `NoHandlerFound` or `HandlerFailed`. Example:
+// `NoHandlerFound`, `HandlerFailed`, `UnknownEvent`, `HandlerPanicked`, `DispatcherClosed` or
+// `JournalFailed`. It wraps the error of a failing handler, and code that handles a plain `error`
+// can get at it using `errors.As`, or test its type using `errors.Is` (see ErrNoHandler). Example:
 //
 //	 if err := Dispatch(e); err != nil {
 //		  if err.Type == NoHandlerFound {
@@ -193,149 +747,399 @@ func (d dispatchErrorType) String() string {
 //			log.Fatalln(err)
 //		  }
 //	 }
+//
+// When a single handler failed or panicked, the error names it: EventType, Handler and
+// HandlerName are set, and Error reads e.g. "handler 2 (persistence.Store) for Message failed:
+// ...". With SetContinueOnError, the joined errors name their handlers instead.
 type DispatchError struct {
 	Type dispatchErrorType
 	Err  error
+
+	EventType   EventType // of the dispatched event, if known
+	Handler     int       // index of the failing handler among the handlers of the event
+	HandlerName string    // of the failing handler, see Named; empty if not a single handler
+}
+
+// Named is implemented by handlers that have a name for errors, e.g. "persistence.Store".
+// Handlers without one are named by their Go type.
+type Named interface {
+	Name() string
+}
+
+// handlerName returns the name of a handler, see Named. Wrapped handlers, e.g. of
+// RegisterFiltered, go by the name of the handler that was registered.
+func handlerName(h handler) string {
+	for {
+		u, ok := h.(unwrapper)
+		if !ok {
+			break
+		}
+		h = u.unwrap()
+	}
+	if n, ok := h.(Named); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", h)
+}
+
+// PanicError is the error of a handler that panicked, see HandlerPanicked.
+type PanicError struct {
+	Value interface{} // passed to panic
+	Stack []byte      // of the handler's goroutine when it panicked
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v\n%s", p.Value, p.Stack)
 }
 
 func (d *DispatchError) Error() string {
+	if d.HandlerName != "" {
+		return fmt.Sprintf("handler %d (%s) for %v failed: %v", d.Handler, d.HandlerName, d.EventType, d.Err)
+	}
 	return d.Err.Error()
 }
 
+// Unwrap returns the underlying error, e.g. the error of the failing handler.
+func (d *DispatchError) Unwrap() error {
+	return d.Err
+}
+
+// lazyError is the error of an event without handlers, or of an unknown event. Unhandled events
+// are common, e.g. in a history sync, so its message is only formatted when it is read.
+type lazyError struct {
+	tp dispatchErrorType
+	t  EventType
+	ev interface{}
+}
+
+func (e *lazyError) Error() string {
+	if e.tp == UnknownEvent {
+		return fmt.Sprintf("unknown event %+v, can't dispatch", e.ev)
+	}
+	return fmt.Sprintf("no handler for event %v (%T)", e.t, e.ev)
+}
+
+// newLazyError returns a DispatchError with a lazyError, in one allocation.
+func newLazyError(tp dispatchErrorType, t EventType, ev interface{}) *DispatchError {
+	e := &struct {
+		de  DispatchError
+		err lazyError
+	}{
+		de:  DispatchError{Type: tp, EventType: t},
+		err: lazyError{tp: tp, t: t, ev: ev},
+	}
+	e.de.Err = &e.err
+	return &e.de
+}
+
+// Sentinels that a DispatchError matches by its type, for code that handles a plain `error`:
+// `errors.Is(err, ErrNoHandler)` is like `err.Type == NoHandlerFound`.
+var (
+	ErrNoHandler     = errors.New("no handler")     // matches NoHandlerFound
+	ErrHandlerFailed = errors.New("handler failed") // matches HandlerFailed
+)
+
+// Is matches the sentinel of the type of the error, see ErrNoHandler.
+func (d *DispatchError) Is(target error) bool {
+	switch target {
+	case ErrNoHandler:
+		return d.Type == NoHandlerFound
+	case ErrHandlerFailed:
+		return d.Type == HandlerFailed
+	}
+	return false
+}
+
 // Dispatch invokes registered handlers for any `EventType`. There is a `nil` error return
 // IFF:
 // - One or more handlers for the event type were registered,
 // - They all executed without returning an error.
 //
 // The absence of registered handlers is returned with `err.Type == NoHandlerFound` and
-// `err.Error()` stating the event type and payload.
+// `err.Error()` stating the event type, but not the payload, which can be large. With a
+// dead-letter handler (see SetDeadLetterHandler), the event goes there instead, and when holding
+// events (see HoldUnhandled), the event is held.
 //
 // The failure of a registered handler is returned with `err.Type` == HandlerFailed`,
 // `err.Err` being the underlying error, and `err.Error()` stating the handler's error.
 // Invoking handlers stops when a handler returns an error; i.e., a second handler may not run
-// if the first handler fails.
+// if the first handler fails. See SetContinueOnError to run all handlers. A handler that returns
+// ErrStopPropagation also stops the chain, but it doesn't fail.
+//
+// A handler that panics doesn't take the process down: the panic is recovered and returned with
+// `err.Type == HandlerPanicked`, and `err.Err` wrapping a PanicError with the panic value and
+// the stack trace. Like a failure, a panic stops the remaining handlers, unless
+// SetContinueOnError is on.
 //
 // When `Dispatch()` returns `err.Type == UnknownEvent` then the event couldn't be mapped to
 // an existing type. Probably the code of this module is wrong or `go.mau.fi/whatsmeow/types/events`
 // has a new type that `Dispatch()` is not yet aware of.
-func Dispatch(evt interface{}) *DispatchError {
-	switch v := evt.(type) {
-	case *events.AppState:
-		return dispatch(AppState, v)
-	case *events.AppStateSyncComplete:
-		return dispatch(AppStateSyncComplete, v)
-	case *events.Archive:
-		return dispatch(Archive, v)
-	case *events.BusinessName:
-		return dispatch(BusinessName, v)
-	case *events.CallAccept:
-		return dispatch(CallAccept, v)
-	case *events.CallOffer:
-		return dispatch(CallOffer, v)
-	case *events.CallOfferNotice:
-		return dispatch(CallOfferNotice, v)
-	case *events.CallRelayLatency:
-		return dispatch(CallRelayLatency, v)
-	case *events.CallTerminate:
-		return dispatch(CallTerminate, v)
-	case *events.ChatPresence:
-		return dispatch(ChatPresence, v)
-	case *events.ClientOutdated:
-		return dispatch(ClientOutdated, v)
-	case *events.Connected:
-		return dispatch(Connected, v)
-	case *events.ConnectFailure:
-		return dispatch(ConnectFailure, v)
-	case *events.Contact:
-		return dispatch(Contact, v)
-	case *events.DeleteChat:
-		return dispatch(DeleteChat, v)
-	case *events.DeleteForMe:
-		return dispatch(DeleteForMe, v)
-	case *events.Disconnected:
-		return dispatch(Disconnected, v)
-	case *events.GroupInfo:
-		return dispatch(GroupInfo, v)
-	case *events.HistorySync:
-		return dispatch(HistorySync, v)
-	case *events.JoinedGroup:
-		return dispatch(JoinedGroup, v)
-	case *events.IdentityChange:
-		return dispatch(IdentityChange, v)
-	case *events.KeepAliveRestored:
-		return dispatch(KeepAliveRestored, v)
-	case *events.KeepAliveTimeout:
-		return dispatch(KeepAliveTimeout, v)
-	case *events.LoggedOut:
-		return dispatch(LoggedOut, v)
-	case *events.MarkChatAsRead:
-		return dispatch(MarkChatAsRead, v)
-	case *events.MediaRetry:
-		return dispatch(MediaRetry, v)
-	case *events.Message:
-		return dispatch(Message, v)
-	case *events.OfflineSyncCompleted:
-		return dispatch(OfflineSyncCompleted, v)
-	case *events.OfflineSyncPreview:
-		return dispatch(OfflineSyncPreview, v)
-	case *events.PairError:
-		return dispatch(PairError, v)
-	case *events.PairSuccess:
-		return dispatch(PairSuccess, v)
-	case *events.Picture:
-		return dispatch(Picture, v)
-	case *events.Pin:
-		return dispatch(Pin, v)
-	case *events.Presence:
-		return dispatch(Presence, v)
-	case *events.PrivacySettings:
-		return dispatch(PrivacySettings, v)
-	case *events.PushName:
-		return dispatch(PushName, v)
-	case *events.PushNameSetting:
-		return dispatch(PushNameSetting, v)
-	case *events.QR:
-		return dispatch(QR, v)
-	case *events.QRScannedWithoutMultidevice:
-		return dispatch(QRScannedWithoutMultidevice, v)
-	case *events.Receipt:
-		return dispatch(Receipt, v)
-	case *events.Star:
-		return dispatch(Star, v)
-	case *events.StreamError:
-		return dispatch(StreamError, v)
-	case *events.StreamReplaced:
-		return dispatch(StreamReplaced, v)
-	case *events.TemporaryBan:
-		return dispatch(TemporaryBan, v)
-	case *events.UnarchiveChatsSetting:
-		return dispatch(UnarchiveChatSetting, v)
-	case *events.UndecryptableMessage:
-		return dispatch(UndecryptableMessage, v)
-	case *events.UnknownCallEvent:
-		return dispatch(UnknownCallEvent, v)
-	default:
+func (d *Dispatcher) Dispatch(evt interface{}) *DispatchError {
+	return d.DispatchCtx(context.Background(), evt)
+}
+
+// DispatchCtx is Dispatch with a context, which is passed to the handlers that implement
+// ContextHandler. When the context is done, the remaining handlers don't run, and the error has
+// type HandlerFailed and wraps the error of the context. A dispatcher timeout (see SetTimeout)
+// applies on top of the deadline of the context.
+//
+// A handler that doesn't return when the context is done doesn't hold up the dispatch: it
+// continues in the background, and its result is discarded.
+func (d *Dispatcher) DispatchCtx(ctx context.Context, evt interface{}) *DispatchError {
+	d.mu.RLock()
+	timeout, closed := d.timeout, d.closed
+	if !closed {
+		d.inFlight.Add(1) // under the lock, so that Close can't be waiting yet
+	}
+	d.mu.RUnlock()
+	if closed {
 		return &DispatchError{
-			Type: UnknownEvent,
-			Err:  fmt.Errorf("unknown event %+v, can't dispatch", v),
+			Type: DispatcherClosed,
+			Err:  fmt.Errorf("dispatcher is closed, can't dispatch %T", evt),
+		}
+	}
+	defer d.inFlight.Done()
+	d.emit.enter()
+	defer d.drainEmitted(ctx) // after leave
+	defer d.emit.leave()
+	if _, ok := EventTypeOf(evt); ok && d.buffer(evt) {
+		return nil // paused
+	}
+	return d.dispatchCtx(ctx, evt, timeout)
+}
+
+// dispatchCtx dispatches an event, after the checks of DispatchCtx.
+func (d *Dispatcher) dispatchCtx(ctx context.Context, evt interface{}, timeout time.Duration) *DispatchError {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	t, ok := EventTypeOf(evt)
+	if !ok {
+		err := newLazyError(UnknownEvent, firstEventType, evt)
+		d.runDispatchHooks(firstEventType, 0, err)
+		return err
+	}
+	j, id, jerr := d.journalAppend(ctx, t, evt)
+	var err *DispatchError
+	switch t {
+	case DeleteForMe:
+		v := evt.(*events.DeleteForMe)
+		err = d.dispatchDerived(ctx, DeleteForMe, v, MessageRevoked, deleteForMeRevoke(v))
+	case Message:
+		err = d.dispatchMessage(ctx, evt.(*events.Message))
+	case Receipt:
+		err = d.dispatchReceipt(ctx, evt.(*events.Receipt))
+	default:
+		err = d.dispatch(ctx, t, evt)
+	}
+	err = d.toDeadLetter(t, evt, d.hold(evt, d.ignore(t, err)))
+	if j != nil && handled(err) {
+		if e := j.MarkDone(id); e != nil {
+			jerr = fmt.Errorf("can't mark %v done in the journal: %w", t, e)
 		}
 	}
+	if jerr != nil && err == nil {
+		err = &DispatchError{Type: JournalFailed, Err: jerr, EventType: t}
+	}
+	return err
+}
+
+// Dispatch dispatches an event to the handlers of the default dispatcher, see
+// Dispatcher.Dispatch.
+func Dispatch(evt interface{}) *DispatchError {
+	return defaultDispatcher.Dispatch(evt)
 }
 
-func dispatch(t EventType, ev interface{}) *DispatchError {
-	if handlers, ok := registry[t]; ok {
-		for _, h := range handlers {
-			if err := h.Handle(ev); err != nil {
+// DispatchCtx dispatches an event with a context to the handlers of the default dispatcher, see
+// Dispatcher.DispatchCtx.
+func DispatchCtx(ctx context.Context, evt interface{}) *DispatchError {
+	return defaultDispatcher.DispatchCtx(ctx, evt)
+}
+
+// DispatchHook is invoked after the handlers for an event ran, with the time that they took and
+// the dispatch error, if any. For events that can't be dispatched, the hook is invoked with
+// event type 0 and an error of type UnknownEvent.
+type DispatchHook func(t EventType, d time.Duration, err *DispatchError)
+
+// AddDispatchHook adds a hook that is run for every dispatched event, e.g. to collect metrics.
+// Derived synthetic events (see EditMessage and friends) are reported separately.
+func (d *Dispatcher) AddDispatchHook(h DispatchHook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.hooks = append(d.hooks, h)
+}
+
+// AddDispatchHook adds a hook to the default dispatcher, see Dispatcher.AddDispatchHook.
+func AddDispatchHook(h DispatchHook) {
+	defaultDispatcher.AddDispatchHook(h)
+}
+
+func (d *Dispatcher) runDispatchHooks(t EventType, elapsed time.Duration, err *DispatchError) {
+	d.mu.RLock()
+	hks := d.hooks
+	d.mu.RUnlock()
+
+	for _, h := range hks {
+		h(t, elapsed, err)
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, t EventType, ev interface{}) *DispatchError {
+	start := time.Now()
+	err := d.runMiddleware(ctx, t, ev)
+	elapsed := time.Since(start)
+	d.stats[t].record(elapsed, err)
+	d.runDispatchHooks(t, elapsed, err)
+	return err
+}
+
+// runMiddleware runs the handlers of an event, wrapped in the middleware.
+func (d *Dispatcher) runMiddleware(ctx context.Context, t EventType, ev interface{}) *DispatchError {
+	d.mu.RLock()
+	mws := d.middleware
+	d.mu.RUnlock()
+	if len(mws) == 0 {
+		return d.runHandlers(ctx, t, ev)
+	}
+
+	var h ContextHandlerFunc = func(ctx context.Context, t EventType, ev interface{}) error {
+		if err := d.runHandlers(ctx, t, ev); err != nil {
+			return err
+		}
+		return nil // not a nil *DispatchError in an error
+	}
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	err := h(ctx, t, ev)
+	if err == nil {
+		return nil
+	}
+	if de, ok := err.(*DispatchError); ok {
+		return de
+	}
+	return &DispatchError{
+		Type:      HandlerFailed,
+		Err:       err,
+		EventType: t,
+	}
+}
+
+func (d *Dispatcher) runHandlers(ctx context.Context, t EventType, ev interface{}) *DispatchError {
+	d.mu.RLock()
+	var handlers []handler
+	if t >= 0 && t < numEventTypes {
+		handlers = d.chains[t]
+	} else {
+		handlers = d.chain(t)
+	}
+	continueOnError := d.continueOnError
+	d.mu.RUnlock()
+
+	if len(handlers) > 0 {
+		tr, _ := ctx.Value(traceKey{}).(*Trace) // see DispatchTraced
+		ctx = context.WithValue(ctx, eventTypeKey{}, t)
+		seq, conc := splitConcurrent(handlers)
+		var errs []error
+		errType := HandlerFailed
+		// fail records the failure of handler i; with one failure, it is returned by itself.
+		fail := func(i int, h handler, err error, single bool) *DispatchError {
+			tp := HandlerFailed
+			if _, ok := err.(*PanicError); ok {
+				tp, errType = HandlerPanicked, HandlerPanicked
+			}
+			if single {
 				return &DispatchError{
-					Type: HandlerFailed,
-					Err:  err,
+					Type:        tp,
+					Err:         err,
+					EventType:   t,
+					Handler:     i,
+					HandlerName: handlerName(h),
+				}
+			}
+			errs = append(errs, fmt.Errorf("handler %d (%s): %w", i, handlerName(h), err))
+			return nil
+		}
+		stopped := false
+		for i, h := range seq {
+			err := ctx.Err() // a done context stops the chain, also when continuing on errors
+			stop := err != nil
+			if err == nil && tr != nil {
+				err = tr.call(ctx, t, h, ev)
+			} else if err == nil {
+				err = call(ctx, h, ev)
+			}
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, ErrStopPropagation) {
+				stopped = true
+				break
+			}
+			if de := fail(i, h, err, !continueOnError); de != nil {
+				return de
+			}
+			if stop {
+				stopped = true
+				break
+			}
+		}
+		if len(conc) > 0 && !stopped {
+			results := runConcurrent(ctx, tr, t, conc, ev)
+			failed := 0
+			for _, err := range results {
+				if err != nil && !errors.Is(err, ErrStopPropagation) {
+					failed++
 				}
 			}
+			for j, err := range results {
+				if err != nil && !errors.Is(err, ErrStopPropagation) {
+					if de := fail(len(seq)+j, conc[j], err, failed == 1 && !continueOnError); de != nil {
+						return de
+					}
+				}
+			}
+		}
+		if len(errs) > 0 {
+			return &DispatchError{
+				Type:      errType,
+				Err:       errors.Join(errs...),
+				EventType: t,
+			}
 		}
 		return nil
 	}
-	return &DispatchError{
-		Type: NoHandlerFound,
-		Err:  fmt.Errorf("no handler for event %v (payload: %+v)", t, ev),
+	return newLazyError(NoHandlerFound, t, ev)
+}
+
+// call runs a handler, and returns a PanicError when it panics. When the context can be done,
+// the handler runs in a goroutine that is abandoned when the context is done first.
+func call(ctx context.Context, h handler, ev interface{}) error {
+	if ctx.Done() == nil {
+		return callSafely(ctx, h, ev)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- callSafely(ctx, h, ev)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
+
+// callSafely runs a handler, see invoke, and recovers when it panics.
+func callSafely(ctx context.Context, h handler, ev interface{}) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return invoke(ctx, h, ev)
+}
@@ -1,25 +1,153 @@
 package handlers
 
 import (
+	"context"
+	"encoding"
+	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"go.mau.fi/whatsmeow/types/events"
 )
 
-// TestEventTypeString checks that there are strings for all event types. If not, the test barfs with
-// an index-out-of-range error.
+// TestEventTypeString checks that there are names for all event types, and that other values
+// don't panic.
 func TestEventTypeString(t *testing.T) {
 	for tp := firstEventType + 1; tp < lastEventType; tp++ {
-		t.Log(int(tp), tp.String())
+		if got := tp.String(); strings.HasPrefix(got, "EventType(") {
+			t.Errorf("EventType %d has no name, String() = %q", int(tp), got)
+		}
+	}
+	for _, test := range []struct {
+		tp   EventType
+		want string
+	}{
+		{-1, "EventType(-1)"},
+		{firstEventType, "EventType(0)"},
+		{numEventTypes, fmt.Sprintf("EventType(%d)", int(numEventTypes))}, // lastEventType may be custom
+		{999, "EventType(999)"},
+	} {
+		if got := test.tp.String(); got != test.want {
+			t.Errorf("EventType(%d).String() = %q, want %q", int(test.tp), got, test.want)
+		}
+	}
+}
+
+// TestEventTypeValues pins the values of all event types, which are frozen since they may be
+// stored or logged. New types are added at the end, and to this table.
+func TestEventTypeValues(t *testing.T) {
+	pinned := 0
+	for _, test := range []struct {
+		tp   EventType
+		name string
+		want int
+	}{
+		{AppState, "AppState", 1},
+		{AppStateSyncComplete, "AppStateSyncComplete", 2},
+		{Archive, "Archive", 3},
+		{BusinessName, "BusinessName", 4},
+		{CallAccept, "CallAccept", 5},
+		{CallOffer, "CallOffer", 6},
+		{CallOfferNotice, "CallOfferNotice", 7},
+		{CallRelayLatency, "CallRelayLatency", 8},
+		{CallTerminate, "CallTerminate", 9},
+		{ChatPresence, "ChatPresence", 10},
+		{ClientOutdated, "ClientOutdated", 11},
+		{Connected, "Connected", 12},
+		{ConnectFailure, "ConnectFailure", 13},
+		{Contact, "Contact", 14},
+		{DeleteChat, "DeleteChat", 15},
+		{DeleteForMe, "DeleteForMe", 16},
+		{Disconnected, "Disconnected", 17},
+		{GroupInfo, "GroupInfo", 18},
+		{HistorySync, "HistorySync", 19},
+		{IdentityChange, "IdentityChange", 20},
+		{JoinedGroup, "JoinedGroup", 21},
+		{KeepAliveRestored, "KeepAliveRestored", 22},
+		{KeepAliveTimeout, "KeepAliveTimeout", 23},
+		{LoggedOut, "LoggedOut", 24},
+		{MarkChatAsRead, "MarkChatAsRead", 25},
+		{MediaRetry, "MediaRetry", 26},
+		{Message, "Message", 27},
+		{Mute, "Mute", 28},
+		{OfflineSyncCompleted, "OfflineSyncCompleted", 29},
+		{OfflineSyncPreview, "OfflineSyncPreview", 30},
+		{PairError, "PairError", 31},
+		{PairSuccess, "PairSuccess", 32},
+		{Picture, "Picture", 33},
+		{Pin, "Pin", 34},
+		{Presence, "Presence", 35},
+		{PrivacySettings, "PrivacySettings", 36},
+		{PushName, "PushName", 37},
+		{PushNameSetting, "PushNameSetting", 38},
+		{QR, "QR", 39},
+		{QRScannedWithoutMultidevice, "QRScannedWithoutMultidevice", 40},
+		{Receipt, "Receipt", 41},
+		{Star, "Star", 42},
+		{StreamError, "StreamError", 43},
+		{StreamReplaced, "StreamReplaced", 44},
+		{TemporaryBan, "TemporaryBan", 45},
+		{UnarchiveChatSetting, "UnarchiveChatSetting", 46},
+		{UndecryptableMessage, "UndecryptableMessage", 47},
+		{UnknownCallEvent, "UnknownCallEvent", 48},
+		{Blocklist, "Blocklist", 49},
+		{EditMessage, "EditMessage", 50},
+		{MessageRevoked, "MessageRevoked", 51},
+		{StickerMessage, "StickerMessage", 52},
+		{AnyEvent, "AnyEvent", 53},
+		{ReceiptDelivered, "ReceiptDelivered", 54},
+		{ReceiptRead, "ReceiptRead", 55},
+		{ReceiptPlayed, "ReceiptPlayed", 56},
+		{ReceiptRetry, "ReceiptRetry", 57},
+		{NewsletterJoin, "NewsletterJoin", 58},
+		{NewsletterLeave, "NewsletterLeave", 59},
+		{NewsletterMuteChange, "NewsletterMuteChange", 60},
+		{NewsletterLiveUpdate, "NewsletterLiveUpdate", 61},
+		{LabelEdit, "LabelEdit", 62},
+		{LabelAssociationChat, "LabelAssociationChat", 63},
+		{LabelAssociationMessage, "LabelAssociationMessage", 64},
+		{CallPreAccept, "CallPreAccept", 65},
+		{CallTransport, "CallTransport", 66},
+		{FBMessage, "FBMessage", 67},
+		{CATRefreshError, "CATRefreshError", 68},
+		{ClearChat, "ClearChat", 69},
+		{UserStatusMute, "UserStatusMute", 70},
+	} {
+		if int(test.tp) != test.want || test.tp.String() != test.name {
+			t.Errorf("%v = %v, want %v = %v", test.tp, int(test.tp), test.name, test.want)
+		}
+		pinned++
+	}
+	if pinned != int(lastEventType)-1 {
+		t.Errorf("%d event types are pinned, want all %d", pinned, int(lastEventType)-1)
 	}
 }
 
-// TestDispatchErrorTypeString checks that there are strings for all dispatcher error types.
+// TestDispatchErrorTypeString checks that there are names for all dispatcher error types, and
+// that other values don't panic.
 func TestDispatchErrorTypeString(t *testing.T) {
 	for de := firstDispatchError + 1; de < lastDispatchError; de++ {
-		t.Log(int(de), de.String())
+		if got := de.String(); strings.HasPrefix(got, "dispatchErrorType(") {
+			t.Errorf("dispatchErrorType %d has no name, String() = %q", int(de), got)
+		}
+	}
+	for _, test := range []struct {
+		de   dispatchErrorType
+		want string
+	}{
+		{-1, "dispatchErrorType(-1)"},
+		{firstDispatchError, "dispatchErrorType(0)"},
+		{lastDispatchError, fmt.Sprintf("dispatchErrorType(%d)", int(lastDispatchError))},
+	} {
+		if got := test.de.String(); got != test.want {
+			t.Errorf("dispatchErrorType(%d).String() = %q, want %q", int(test.de), got, test.want)
+		}
 	}
 }
 
@@ -29,25 +157,25 @@ func (d *dummyHandler) Handle(ev interface{}) error { return errors.New("fail")
 
 // TestAsyncRegistration checks that in-parallel registration doesn't break.
 func TestAsyncRegistration(t *testing.T) {
-	registry = make(map[EventType][]handler)
+	d := New()
 	var wg sync.WaitGroup
 	for i := 0; i < 1000; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			Register(UnknownCallEvent, &dummyHandler{})
+			d.Register(UnknownCallEvent, &dummyHandler{})
 		}()
 	}
 	wg.Wait()
-	if l := len(registry[UnknownCallEvent]); l != 1000 {
+	if l := len(d.registry[UnknownCallEvent]); l != 1000 {
 		t.Errorf("TestAsyncRegistration: %v handlers registered, want 1000", l)
 	}
 }
 
-// TestDispatchError checks that Dispatch() returns a correct error type.
+// TestDispatchError checks that d.Dispatch() returns a correct error type.
 func TestDispatchError(t *testing.T) {
-	registry = make(map[EventType][]handler)
-	Register(UndecryptableMessage, &dummyHandler{})
+	d := New()
+	d.Register(UndecryptableMessage, &dummyHandler{})
 
 	for _, test := range []struct {
 		description   string
@@ -70,7 +198,7 @@ func TestDispatchError(t *testing.T) {
 			wantErrorType: UnknownEvent,
 		},
 	} {
-		err := Dispatch(test.event)
+		err := d.Dispatch(test.event)
 		if err == nil {
 			t.Fatalf("%v: Dispatch(_) = nil, need error", test.description)
 		}
@@ -79,3 +207,867 @@ func TestDispatchError(t *testing.T) {
 		}
 	}
 }
+
+// TestDispatchErrorAs checks that a DispatchError can be extracted from a plain error, and that
+// it wraps the error of the failing handler.
+func TestDispatchErrorAs(t *testing.T) {
+	d := New()
+	errBoom := errors.New("boom")
+	d.Register(Message, handlerFunc(func(ev interface{}) error { return fmt.Errorf("storing: %w", errBoom) }))
+
+	var err error = d.Dispatch(&events.Message{})
+	var de *DispatchError
+	if !errors.As(err, &de) || de.Type != HandlerFailed {
+		t.Errorf("errors.As(Dispatch(_), _) = %v, want a DispatchError of type HandlerFailed", err)
+	}
+	if !errors.Is(err, errBoom) {
+		t.Errorf("Dispatch(_) = %v, want it to wrap the handler's error", err)
+	}
+
+	err = d.Dispatch(42)
+	if !errors.As(err, &de) || de.Type != UnknownEvent || !strings.Contains(err.Error(), "42") {
+		t.Errorf("Dispatch(42) = %v, want an UnknownEvent that states the payload", err)
+	}
+}
+
+// TestDispatchErrorIs checks that errors.Is matches the sentinels by the type of the error, and
+// that errors.Is, errors.As and errors.Unwrap reach the handler's error through its wrapping.
+func TestDispatchErrorIs(t *testing.T) {
+	d := New()
+	errBoom := &PanicError{Value: "boom"} // any error type will do for errors.As
+	d.Register(Message, handlerFunc(func(ev interface{}) error { return fmt.Errorf("storing: %w", errBoom) }))
+
+	for _, test := range []struct {
+		description   string
+		event         interface{}
+		wantNoHandler bool
+		wantFailed    bool
+	}{
+		{description: "no handler", event: &events.HistorySync{}, wantNoHandler: true},
+		{description: "handler failed", event: &events.Message{}, wantFailed: true},
+		{description: "unknown event", event: 42},
+	} {
+		var err error = d.Dispatch(test.event)
+		if got := errors.Is(err, ErrNoHandler); got != test.wantNoHandler {
+			t.Errorf("%v: errors.Is(%v, ErrNoHandler) = %v, want %v", test.description, err, got, test.wantNoHandler)
+		}
+		if got := errors.Is(err, ErrHandlerFailed); got != test.wantFailed {
+			t.Errorf("%v: errors.Is(%v, ErrHandlerFailed) = %v, want %v", test.description, err, got, test.wantFailed)
+		}
+	}
+
+	var err error = d.Dispatch(&events.Message{})
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe != errBoom {
+		t.Errorf("errors.As(%v, *PanicError) = %v, want the handler's error", err, pe)
+	}
+	if got := errors.Unwrap(errors.Unwrap(err)); got != errBoom {
+		t.Errorf("errors.Unwrap twice = %v, want the handler's error", got)
+	}
+	wrapped := fmt.Errorf("main loop: %w", err)
+	if !errors.Is(wrapped, ErrHandlerFailed) || !errors.As(wrapped, &pe) {
+		t.Errorf("wrapped %v doesn't match ErrHandlerFailed or the handler's error", wrapped)
+	}
+
+	// The payload, which can be large, isn't in the message.
+	if got, want := d.Dispatch(&events.HistorySync{}).Error(), "no handler for event HistorySync (*events.HistorySync)"; got != want {
+		t.Errorf("Dispatch(_) = %q, want %q", got, want)
+	}
+}
+
+type namedHandler struct{}
+
+func (namedHandler) Handle(ev interface{}) error { return errors.New("disk full") }
+func (namedHandler) Name() string                { return "persistence.Store" }
+
+// TestFailingHandlerName checks that errors name the handler that failed, see Named.
+func TestFailingHandlerName(t *testing.T) {
+	ok := handlerFunc(func(ev interface{}) error { return nil })
+	for _, test := range []struct {
+		description string
+		register    func(d *Dispatcher)
+		wantIndex   int
+		wantName    string
+		wantError   string
+	}{
+		{
+			description: "named",
+			register: func(d *Dispatcher) {
+				d.Register(Message, ok)
+				d.Register(Message, ok)
+				d.Register(Message, namedHandler{})
+			},
+			wantIndex: 2,
+			wantName:  "persistence.Store",
+			wantError: "handler 2 (persistence.Store) for Message failed: disk full",
+		},
+		{
+			description: "unnamed",
+			register:    func(d *Dispatcher) { d.Register(Message, &dummyHandler{}) },
+			wantName:    "*handlers.dummyHandler",
+			wantError:   "handler 0 (*handlers.dummyHandler) for Message failed: fail",
+		},
+		{
+			description: "wrapped",
+			register: func(d *Dispatcher) {
+				d.Register(Message, ok)
+				d.RegisterFiltered(Message, func(interface{}) bool { return true }, namedHandler{})
+			},
+			wantIndex: 1,
+			wantName:  "persistence.Store",
+			wantError: "handler 1 (persistence.Store) for Message failed: disk full",
+		},
+	} {
+		d := New()
+		test.register(d)
+		err := d.Dispatch(&events.Message{})
+		if err == nil {
+			t.Fatalf("%v: Dispatch(_) = nil, need error", test.description)
+		}
+		if err.Type != HandlerFailed || err.EventType != Message || err.Handler != test.wantIndex || err.HandlerName != test.wantName {
+			t.Errorf("%v: Dispatch(_) = %+v, want HandlerFailed of handler %v (%v) for Message",
+				test.description, err, test.wantIndex, test.wantName)
+		}
+		if got := err.Error(); got != test.wantError {
+			t.Errorf("%v: Dispatch(_) = %q, want %q", test.description, got, test.wantError)
+		}
+	}
+}
+
+// TestContinueOnError checks that by default the first failing handler stops the chain, and that
+// with SetContinueOnError all handlers run and the errors are joined.
+func TestContinueOnError(t *testing.T) {
+	errMiddle := errors.New("middle failed")
+	for _, test := range []struct {
+		description     string
+		continueOnError bool
+		wantRan         string
+	}{
+		{
+			description: "stop on the first error",
+			wantRan:     "[first middle]",
+		},
+		{
+			description:     "continue on error",
+			continueOnError: true,
+			wantRan:         "[first middle last]",
+		},
+	} {
+		d := New()
+		d.SetContinueOnError(test.continueOnError)
+		var ran []string
+		d.Register(Message, handlerFunc(func(ev interface{}) error {
+			ran = append(ran, "first")
+			return nil
+		}))
+		d.Register(Message, handlerFunc(func(ev interface{}) error {
+			ran = append(ran, "middle")
+			return errMiddle
+		}))
+		d.Register(Message, handlerFunc(func(ev interface{}) error {
+			ran = append(ran, "last")
+			return nil
+		}))
+
+		err := d.Dispatch(&events.Message{})
+		if err == nil || err.Type != HandlerFailed {
+			t.Fatalf("%v: Dispatch(_) = %v, want HandlerFailed", test.description, err)
+		}
+		if !errors.Is(err, errMiddle) {
+			t.Errorf("%v: Dispatch(_) = %v, want it to wrap the handler's error", test.description, err)
+		}
+		if got := fmt.Sprint(ran); got != test.wantRan {
+			t.Errorf("%v: handlers ran as %v, want %v", test.description, got, test.wantRan)
+		}
+		if test.continueOnError && !strings.Contains(err.Error(), "handler 1 (handlers.handlerFunc)") {
+			t.Errorf("%v: Dispatch(_) = %q, want it to identify the failing handler", test.description, err)
+		}
+	}
+}
+
+// TestHandlerPanicked checks that a panicking handler is recovered, and that the panic value
+// and the stack trace are returned.
+func TestHandlerPanicked(t *testing.T) {
+	for _, continueOnError := range []bool{false, true} {
+		d := New()
+		d.SetContinueOnError(continueOnError)
+		ran := false
+		d.Register(Message, handlerFunc(func(ev interface{}) error {
+			_ = ev.(*events.Receipt) // wrong typecast
+			return nil
+		}))
+		d.Register(Message, handlerFunc(func(ev interface{}) error {
+			ran = true
+			return nil
+		}))
+
+		err := d.Dispatch(&events.Message{})
+		if err == nil || err.Type != HandlerPanicked {
+			t.Fatalf("continue %v: Dispatch(_) = %v, want HandlerPanicked", continueOnError, err)
+		}
+		var pe *PanicError
+		if !errors.As(err, &pe) {
+			t.Fatalf("continue %v: Dispatch(_) = %v, want it to wrap a PanicError", continueOnError, err)
+		}
+		if _, ok := pe.Value.(error); !ok || !strings.Contains(fmt.Sprint(pe.Value), "events.Receipt") {
+			t.Errorf("continue %v: panic value = %v, want the failed typecast", continueOnError, pe.Value)
+		}
+		if !strings.Contains(string(pe.Stack), "TestHandlerPanicked") {
+			t.Errorf("continue %v: stack = %s, want it to show the handler", continueOnError, pe.Stack)
+		}
+		if ran != continueOnError {
+			t.Errorf("continue %v: second handler ran = %v, want %v", continueOnError, ran, continueOnError)
+		}
+	}
+}
+
+// TestStopPropagation checks that a handler can end the chain without failing the dispatch.
+func TestStopPropagation(t *testing.T) {
+	for _, test := range []struct {
+		description     string
+		stop            error
+		continueOnError bool
+	}{
+		{"sentinel", ErrStopPropagation, false},
+		{"wrapped sentinel", fmt.Errorf("command handled: %w", ErrStopPropagation), false},
+		{"continuing on errors", ErrStopPropagation, true},
+	} {
+		d := New()
+		d.SetContinueOnError(test.continueOnError)
+		var ran []int
+		for i := 1; i <= 3; i++ {
+			i := i
+			d.Register(Message, handlerFunc(func(ev interface{}) error {
+				ran = append(ran, i)
+				if i == 2 {
+					return test.stop
+				}
+				return nil
+			}))
+		}
+		if err := d.Dispatch(&events.Message{}); err != nil {
+			t.Errorf("%v: Dispatch(_) = %v, need nil error", test.description, err)
+		}
+		if got, want := fmt.Sprint(ran), "[1 2]"; got != want {
+			t.Errorf("%v: handlers %v ran, want %v", test.description, got, want)
+		}
+	}
+}
+
+// TestMiddleware checks that the first middleware is the outermost, and that middleware sees
+// the error of the handlers on the way out.
+func TestMiddleware(t *testing.T) {
+	d := New()
+	var trace []string
+	for _, name := range []string{"outer", "inner"} {
+		name := name
+		d.Use(func(next HandlerFunc) HandlerFunc {
+			return func(tp EventType, ev interface{}) error {
+				trace = append(trace, name+" "+tp.String())
+				err := next(tp, ev)
+				trace = append(trace, fmt.Sprintf("%v done: %v", name, err))
+				return err
+			}
+		})
+	}
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		trace = append(trace, "handler")
+		return errors.New("boom")
+	}))
+
+	err := d.Dispatch(&events.Message{})
+	if err == nil || err.Type != HandlerFailed {
+		t.Errorf("Dispatch(_) = %v, want HandlerFailed", err)
+	}
+	failed := "handler 0 (handlers.handlerFunc) for Message failed: boom"
+	want := "[outer Message inner Message handler inner done: " + failed + " outer done: " + failed + "]"
+	if got := fmt.Sprint(trace); got != want {
+		t.Errorf("trace = %v, want %v", got, want)
+	}
+
+	trace = nil
+	if err := d.Dispatch(&events.Receipt{}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(_) = %v, want NoHandlerFound", err)
+	}
+	if len(trace) != 4 || trace[1] != "inner Receipt" || !strings.HasPrefix(trace[3], "outer done: no handler") {
+		t.Errorf("trace = %q, want both middlewares to see NoHandlerFound", trace)
+	}
+}
+
+// TestMiddlewareShortCircuit checks that middleware can skip the handlers, and that its own
+// errors are returned as HandlerFailed.
+func TestMiddlewareShortCircuit(t *testing.T) {
+	d := New()
+	errDuplicate := errors.New("duplicate")
+	seen := map[string]bool{}
+	d.Use(func(next HandlerFunc) HandlerFunc { // deduplication
+		return func(tp EventType, ev interface{}) error {
+			id := ev.(*events.Message).Info.ID
+			if seen[id] {
+				return errDuplicate
+			}
+			seen[id] = true
+			return next(tp, ev)
+		}
+	})
+	d.Use(func(next HandlerFunc) HandlerFunc { // drops everything
+		return func(tp EventType, ev interface{}) error {
+			if ev.(*events.Message).Info.ID == "drop" {
+				return nil
+			}
+			return next(tp, ev)
+		}
+	})
+	handled := 0
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		handled++
+		return nil
+	}))
+
+	for _, test := range []struct {
+		id      string
+		wantErr error
+	}{
+		{id: "M1"},
+		{id: "M1", wantErr: errDuplicate},
+		{id: "drop"},
+	} {
+		m := &events.Message{}
+		m.Info.ID = test.id
+		err := d.Dispatch(m)
+		if test.wantErr == nil && err != nil {
+			t.Errorf("Dispatch(%v) = %v, need nil error", test.id, err)
+		}
+		if test.wantErr != nil && (err == nil || err.Type != HandlerFailed || !errors.Is(err, test.wantErr)) {
+			t.Errorf("Dispatch(%v) = %v, want HandlerFailed wrapping %v", test.id, err, test.wantErr)
+		}
+	}
+	if handled != 1 {
+		t.Errorf("handler ran %v times, want 1", handled)
+	}
+}
+
+// TestTimingMiddleware is an example of middleware that times the handling of events.
+func TestTimingMiddleware(t *testing.T) {
+	d := New()
+	took := map[EventType]time.Duration{}
+	d.Use(func(next HandlerFunc) HandlerFunc {
+		return func(tp EventType, ev interface{}) error {
+			start := time.Now()
+			defer func() { took[tp] += time.Since(start) }()
+			return next(tp, ev)
+		}
+	})
+	d.Register(Connected, handlerFunc(func(ev interface{}) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}))
+	if err := d.Dispatch(&events.Connected{}); err != nil {
+		t.Fatalf("Dispatch(_) = %v, need nil error", err)
+	}
+	if took[Connected] < 10*time.Millisecond {
+		t.Errorf("handling Connected took %v, want at least 10ms", took[Connected])
+	}
+}
+
+// ctxHandler implements ContextHandler, and records the value of a context key.
+type ctxHandler struct {
+	seen *[]string
+}
+
+type ctxKey struct{}
+
+func (h ctxHandler) Handle(ev interface{}) error {
+	*h.seen = append(*h.seen, "Handle")
+	return nil
+}
+
+func (h ctxHandler) HandleCtx(ctx context.Context, ev interface{}) error {
+	*h.seen = append(*h.seen, fmt.Sprint("HandleCtx ", ctx.Value(ctxKey{})))
+	return nil
+}
+
+// TestDispatchCtx checks that ContextHandlers get the context, and that legacy handlers still
+// run.
+func TestDispatchCtx(t *testing.T) {
+	d := New()
+	var seen []string
+	d.Register(Message, ctxHandler{seen: &seen})
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		seen = append(seen, "legacy")
+		return nil
+	}))
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	if err := d.DispatchCtx(ctx, &events.Message{}); err != nil {
+		t.Fatalf("DispatchCtx(_) = %v, need nil error", err)
+	}
+	if err := d.Dispatch(&events.Message{}); err != nil {
+		t.Fatalf("Dispatch(_) = %v, need nil error", err)
+	}
+	if got, want := fmt.Sprint(seen), "[HandleCtx v legacy HandleCtx <nil> legacy]"; got != want {
+		t.Errorf("handlers saw %v, want %v", got, want)
+	}
+}
+
+// TestContextMiddleware checks that context middleware can pass a context on to the handlers,
+// also through plain middleware.
+func TestContextMiddleware(t *testing.T) {
+	d := New()
+	var seen []string
+	d.UseCtx(func(next ContextHandlerFunc) ContextHandlerFunc {
+		return func(ctx context.Context, tp EventType, ev interface{}) error {
+			seen = append(seen, fmt.Sprint("outer ", ctx.Value(ctxKey{})))
+			return next(context.WithValue(ctx, ctxKey{}, "traced"), tp, ev)
+		}
+	})
+	d.Use(func(next HandlerFunc) HandlerFunc {
+		return func(tp EventType, ev interface{}) error {
+			seen = append(seen, "plain")
+			return next(tp, ev)
+		}
+	})
+	d.Register(Message, ctxHandler{seen: &seen})
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	if err := d.DispatchCtx(ctx, &events.Message{}); err != nil {
+		t.Fatalf("DispatchCtx(_) = %v, need nil error", err)
+	}
+	if got, want := fmt.Sprint(seen), "[outer v plain HandleCtx traced]"; got != want {
+		t.Errorf("chain saw %v, want %v", got, want)
+	}
+}
+
+// TestDispatchCtxCancel checks that cancelling the context stops the chain.
+func TestDispatchCtxCancel(t *testing.T) {
+	for _, continueOnError := range []bool{false, true} {
+		d := New()
+		d.SetContinueOnError(continueOnError)
+		ctx, cancel := context.WithCancel(context.Background())
+		ran := 0
+		d.Register(Message, handlerFunc(func(ev interface{}) error {
+			ran++
+			cancel()
+			return nil
+		}))
+		d.Register(Message, handlerFunc(func(ev interface{}) error {
+			ran++
+			return nil
+		}))
+		err := d.DispatchCtx(ctx, &events.Message{})
+		if err == nil || err.Type != HandlerFailed || !errors.Is(err, context.Canceled) {
+			t.Errorf("continue %v: DispatchCtx(_) = %v, want HandlerFailed wrapping context.Canceled", continueOnError, err)
+		}
+		if ran != 1 {
+			t.Errorf("continue %v: %v handlers ran, want 1", continueOnError, ran)
+		}
+	}
+}
+
+// TestDispatchTimeout checks that a stuck handler doesn't hold up the dispatch beyond the timeout.
+func TestDispatchTimeout(t *testing.T) {
+	d := New()
+	d.SetTimeout(20 * time.Millisecond)
+	unblock := make(chan struct{})
+	defer close(unblock)
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		<-unblock // ignores the context
+		return nil
+	}))
+	start := time.Now()
+	err := d.Dispatch(&events.Message{})
+	if err == nil || err.Type != HandlerFailed || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Dispatch(_) = %v, want HandlerFailed wrapping context.DeadlineExceeded", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Dispatch(_) took %v, want it to return at the timeout", took)
+	}
+}
+
+// TestRegisterOnce checks that a handler that is registered once runs once, also when events are
+// dispatched concurrently, and is removed afterwards.
+func TestRegisterOnce(t *testing.T) {
+	d := New()
+	var mu sync.Mutex
+	calls := 0
+	d.RegisterOnce(PairSuccess, handlerFunc(func(ev interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return errors.New("fail") // removed anyway
+	}))
+	d.Register(PairSuccess, handlerFunc(func(ev interface{}) error { return nil }))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.Dispatch(&events.PairSuccess{})
+		}()
+	}
+	wg.Wait()
+	if err := d.Dispatch(&events.PairSuccess{}); err != nil {
+		t.Errorf("Dispatch(_) after the first = %v, need nil error", err)
+	}
+	if calls != 1 {
+		t.Errorf("handler invoked %v times, want 1", calls)
+	}
+	if n := len(d.registry[PairSuccess]); n != 1 {
+		t.Errorf("%v handlers left, want 1", n)
+	}
+}
+
+// TestDispatchHook checks that dispatch hooks see every dispatched event type and its outcome.
+func TestDispatchHook(t *testing.T) {
+	d := New()
+	d.Register(UndecryptableMessage, &dummyHandler{})
+	var got []string
+	d.AddDispatchHook(func(tp EventType, d time.Duration, err *DispatchError) {
+		if err == nil {
+			got = append(got, tp.String()+":ok")
+			return
+		}
+		got = append(got, tp.String()+":"+err.Type.String())
+	})
+
+	d.Dispatch(&events.AppState{})
+	d.Dispatch(&events.UndecryptableMessage{})
+	d.Dispatch(&struct{}{})
+	want := []string{"AppState:NoHandlerFound", "UndecryptableMessage:HandlerFailed", "EventType(0):UnknownEvent"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("hooks saw %v, want %v", got, want)
+	}
+}
+
+type orderHandler struct {
+	name string
+	seen *[]string
+}
+
+func (o *orderHandler) Handle(ev interface{}) error {
+	*o.seen = append(*o.seen, o.name)
+	return nil
+}
+
+// TestUnregister checks that removing the middle of three handlers keeps the order of the others.
+func TestUnregister(t *testing.T) {
+	d := New()
+	var seen []string
+	h1, h2, h3 := &orderHandler{"h1", &seen}, &orderHandler{"h2", &seen}, &orderHandler{"h3", &seen}
+	d.Register(Message, h1)
+	d.Register(Message, h2)
+	d.Register(Message, h3)
+
+	if !d.Unregister(Message, h2) {
+		t.Errorf("Unregister(Message, h2) = false, want true")
+	}
+	if d.Unregister(Message, h2) {
+		t.Errorf("Unregister(Message, h2) = true the second time, want false")
+	}
+	if d.Unregister(Message, &orderHandler{"h1", &seen}) {
+		t.Errorf("Unregister(Message, copy of h1) = true, want false")
+	}
+	if err := d.Dispatch(&events.Message{}); err != nil {
+		t.Fatalf("Dispatch(_) = %v, need nil error", err)
+	}
+	if want := "[h1 h3]"; fmt.Sprint(seen) != want {
+		t.Errorf("handlers ran as %v, want %v", seen, want)
+	}
+
+	d.UnregisterAll(Message)
+	if err := d.Dispatch(&events.Message{}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(_) after UnregisterAll = %v, want NoHandlerFound", err)
+	}
+}
+
+// TestRegistered checks the introspection of the registry, and that its map is a snapshot.
+func TestRegistered(t *testing.T) {
+	d := New()
+	h := &dummyHandler{}
+	d.Register(Message, h)
+	d.Register(Message, h)
+	d.Register(Receipt, h)
+	d.Register(AnyEvent, h)
+
+	reg := d.Registered()
+	if got, want := fmt.Sprint(reg), "map[Message:2 Receipt:1 AnyEvent:1]"; got != want {
+		t.Errorf("Registered() = %v, want %v", got, want)
+	}
+	for _, test := range []struct {
+		tp   EventType
+		want bool
+	}{
+		{Message, true},
+		{Receipt, true},
+		{LoggedOut, false},
+	} {
+		if got := d.HasHandler(test.tp); got != test.want {
+			t.Errorf("HasHandler(%v) = %v, want %v", test.tp, got, test.want)
+		}
+	}
+	if got := d.HandlerCount(); got != 4 {
+		t.Errorf("HandlerCount() = %v, want 4", got)
+	}
+
+	d.Register(LoggedOut, h)
+	d.UnregisterAll(Message)
+	reg[Receipt] = 99
+	if got, want := fmt.Sprint(reg), "map[Message:2 Receipt:99 AnyEvent:1]"; got != want {
+		t.Errorf("snapshot changed to %v, want %v", got, want)
+	}
+	if got, want := fmt.Sprint(d.Registered()), "map[LoggedOut:1 Receipt:1 AnyEvent:1]"; got != want {
+		t.Errorf("Registered() = %v, want %v", got, want)
+	}
+}
+
+// TestUnregisterWhileDispatching checks that unregistering doesn't race with dispatching.
+func TestUnregisterWhileDispatching(t *testing.T) {
+	d := New()
+	var hs []*okHandler
+	for i := 0; i < 100; i++ {
+		h := &okHandler{}
+		hs = append(hs, h)
+		d.Register(Receipt, h)
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			d.Dispatch(&events.Receipt{})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for _, h := range hs {
+			d.Unregister(Receipt, h)
+		}
+	}()
+	wg.Wait()
+	if l := len(d.registry[Receipt]); l != 0 {
+		t.Errorf("%v handlers left, want 0", l)
+	}
+}
+
+// okHandler isn't empty, so that distinct handlers have distinct pointers.
+type okHandler struct{ n int }
+
+func (o *okHandler) Handle(ev interface{}) error { return nil }
+
+// TestRegisterWhileDispatching checks that registering doesn't race with dispatching. Run with
+// -race.
+func TestRegisterWhileDispatching(t *testing.T) {
+	d := New()
+	d.Register(Receipt, &okHandler{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := d.Dispatch(&events.Receipt{}); err != nil {
+					t.Errorf("Dispatch(_) = %v, need nil error", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				d.Register(Receipt, &okHandler{})
+			}
+		}()
+	}
+	wg.Wait()
+	if l := len(d.registry[Receipt]); l != 401 {
+		t.Errorf("%v handlers registered, want 401", l)
+	}
+}
+
+// TestAnyEvent checks that catch-alls see all recognized events, before the handlers of the
+// event type.
+func TestAnyEvent(t *testing.T) {
+	d := New()
+	var seen []string
+	d.Register(AnyEvent, &orderHandler{"all", &seen})
+	d.Register(Receipt, &orderHandler{"receipt", &seen})
+
+	for _, test := range []struct {
+		description string
+		event       interface{}
+		want        string
+	}{
+		{
+			description: "event with a handler",
+			event:       &events.Receipt{},
+			want:        "[all receipt]",
+		},
+		{
+			description: "event without a handler",
+			event:       &events.Connected{},
+			want:        "[all]",
+		},
+		{
+			description: "synthetic event",
+			event:       &Revoke{},
+			want:        "[all]",
+		},
+	} {
+		seen = nil
+		if err := d.Dispatch(test.event); err != nil {
+			t.Errorf("%v: Dispatch(_) = %v, need nil error", test.description, err)
+		}
+		if fmt.Sprint(seen) != test.want {
+			t.Errorf("%v: handlers ran as %v, want %v", test.description, seen, test.want)
+		}
+	}
+
+	seen = nil
+	if err := d.Dispatch(&struct{}{}); err == nil || err.Type != UnknownEvent {
+		t.Errorf("Dispatch(unknown) = %v, want UnknownEvent", err)
+	}
+	if len(seen) != 0 {
+		t.Errorf("handlers ran as %v for an unknown event, want none", seen)
+	}
+}
+
+// TestDispatchers checks that dispatchers with their own handlers don't interfere, and that
+// the package-level functions use a dispatcher of their own.
+func TestDispatchers(t *testing.T) {
+	var seen []string
+	d1, d2 := New(), New()
+	d1.Register(Message, &orderHandler{"d1", &seen})
+	d2.Register(Receipt, &orderHandler{"d2", &seen})
+	Register(Message, &orderHandler{"default", &seen})
+	defer UnregisterAll(Message)
+
+	if err := d1.Dispatch(&events.Message{}); err != nil {
+		t.Errorf("d1.Dispatch(Message) = %v, need nil error", err)
+	}
+	if err := d2.Dispatch(&events.Message{}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("d2.Dispatch(Message) = %v, want NoHandlerFound", err)
+	}
+	if err := d2.Dispatch(&events.Receipt{}); err != nil {
+		t.Errorf("d2.Dispatch(Receipt) = %v, need nil error", err)
+	}
+	if err := d1.Dispatch(&events.Receipt{}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("d1.Dispatch(Receipt) = %v, want NoHandlerFound", err)
+	}
+	if err := Dispatch(&events.Message{}); err != nil {
+		t.Errorf("Dispatch(Message) = %v, need nil error", err)
+	}
+	if want := "[d1 d2 default]"; fmt.Sprint(seen) != want {
+		t.Errorf("handlers ran as %v, want %v", seen, want)
+	}
+}
+
+// TestParseEventType checks that all event types survive a round trip through their names, so
+// that parsing doesn't drift from String().
+func TestParseEventType(t *testing.T) {
+	for tp := firstEventType + 1; tp < lastEventType; tp++ {
+		for _, s := range []string{tp.String(), strings.ToLower(tp.String()), strings.ToUpper(tp.String())} {
+			got, err := ParseEventType(s)
+			if err != nil || got != tp {
+				t.Errorf("ParseEventType(%q) = %v, %v, want %v, nil", s, got, err, tp)
+			}
+		}
+	}
+	for _, s := range []string{"", "NoSuchEvent", "Message,Receipt"} {
+		if _, err := ParseEventType(s); err == nil {
+			t.Errorf("ParseEventType(%q) = _, nil, need error", s)
+		}
+	}
+}
+
+func TestEventTypeFlagAndText(t *testing.T) {
+	var _ flag.Value = new(EventType)
+	var _ encoding.TextUnmarshaler = new(EventType)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var tp EventType
+	fs.Var(&tp, "event", "event type")
+	if err := fs.Parse([]string{"-event", "groupinfo"}); err != nil || tp != GroupInfo {
+		t.Errorf("Parse(-event groupinfo) = %v, event %v, want nil, GroupInfo", err, tp)
+	}
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse([]string{"-event", "nope"}); err == nil {
+		t.Errorf("Parse(-event nope) = nil, need error")
+	}
+
+	var cfg struct {
+		Enable []EventType
+	}
+	if err := json.Unmarshal([]byte(`{"Enable": ["Message", "receipt", "GroupInfo"]}`), &cfg); err != nil {
+		t.Fatalf("json.Unmarshal(_) = %v, need nil error", err)
+	}
+	if got, want := fmt.Sprint(cfg.Enable), "[Message Receipt GroupInfo]"; got != want {
+		t.Errorf("json.Unmarshal(_) decoded %v, want %v", got, want)
+	}
+	if err := json.Unmarshal([]byte(`{"Enable": ["Nope"]}`), &cfg); err == nil {
+		t.Errorf("json.Unmarshal(unknown type) = nil, need error")
+	}
+
+	// Names persist instead of numbers, also as map keys.
+	var _ encoding.TextMarshaler = Message
+	js, err := json.Marshal(map[EventType][]EventType{Message: {Receipt, GroupInfo}})
+	if want := `{"Message":["Receipt","GroupInfo"]}`; err != nil || string(js) != want {
+		t.Errorf("json.Marshal(_) = %s, %v, want %s, nil", js, err, want)
+	}
+	if _, err := json.Marshal([]EventType{numEventTypes}); err == nil {
+		t.Errorf("json.Marshal(not an event type) = _, nil, need error")
+	}
+}
+
+// settingsHandler is one handler for several event types.
+type settingsHandler struct {
+	got []string
+}
+
+func (s *settingsHandler) Handle(ev interface{}) error {
+	s.got = append(s.got, "untyped")
+	return nil
+}
+
+func (s *settingsHandler) HandleTyped(t EventType, ev interface{}) error {
+	s.got = append(s.got, fmt.Sprintf("%v %T", t, ev))
+	return nil
+}
+
+// ctxHandlerFunc adapts a func to a ContextHandler.
+type ctxHandlerFunc func(ctx context.Context, ev interface{}) error
+
+func (f ctxHandlerFunc) Handle(ev interface{}) error { return f(context.Background(), ev) }
+
+func (f ctxHandlerFunc) HandleCtx(ctx context.Context, ev interface{}) error { return f(ctx, ev) }
+
+// TestTypedHandler checks that TypedHandlers get the event type, also when wrapped or registered
+// as a catch-all, and that ContextHandlers can get it from the context.
+func TestTypedHandler(t *testing.T) {
+	d := New()
+	s := &settingsHandler{}
+	d.Register(Archive, s)
+	d.Register(Pin, s)
+	d.RegisterFiltered(Mute, func(interface{}) bool { return true }, s)
+	for _, evt := range []interface{}{&events.Archive{}, &events.Pin{}, &events.Mute{}} {
+		if err := d.Dispatch(evt); err != nil {
+			t.Errorf("Dispatch(%T) = %v, need nil error", evt, err)
+		}
+	}
+	if want := "[Archive *events.Archive Pin *events.Pin Mute *events.Mute]"; fmt.Sprint(s.got) != want {
+		t.Errorf("handler got %v, want %v", s.got, want)
+	}
+
+	d = New()
+	var got []string
+	d.Register(AnyEvent, ctxHandlerFunc(func(ctx context.Context, ev interface{}) error {
+		tp, ok := EventTypeFromContext(ctx)
+		got = append(got, fmt.Sprint(tp, ok))
+		return nil
+	}))
+	d.Dispatch(&events.Star{})
+	if want := "[Star true]"; fmt.Sprint(got) != want {
+		t.Errorf("catch-all context handler got %v, want %v", got, want)
+	}
+	if _, ok := EventTypeFromContext(context.Background()); ok {
+		t.Errorf("EventTypeFromContext(context.Background()) = _, true, want false")
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HoldUnhandled makes the dispatcher hold events without handlers, instead of failing them with
+// NoHandlerFound, until ReplayUnhandled. whatsmeow may emit events such as Connected or Message
+// right after connecting, before the handlers are registered; held events aren't lost. At most
+// `limit` events are held; beyond that, the oldest are dropped. Held events don't go to the
+// dead-letter handler. Zero stops holding, and keeps the held events.
+//
+//	d.HoldUnhandled(1000)
+//	client.Connect()
+//	... // register handlers
+//	d.ReplayUnhandled()
+func (d *Dispatcher) HoldUnhandled(limit int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.holdMax = limit
+	d.trimHeld()
+}
+
+// HoldUnhandled makes the default dispatcher hold events, see Dispatcher.HoldUnhandled.
+func HoldUnhandled(limit int) {
+	defaultDispatcher.HoldUnhandled(limit)
+}
+
+// trimHeld drops the oldest held events beyond the maximum. The caller holds d.mu.
+func (d *Dispatcher) trimHeld() {
+	if d.holdMax > 0 && len(d.held) > d.holdMax {
+		d.held = append([]interface{}(nil), d.held[len(d.held)-d.holdMax:]...)
+	}
+}
+
+// hold holds the event of a NoHandlerFound error when holding is on, and returns the error that
+// remains.
+func (d *Dispatcher) hold(evt interface{}, err *DispatchError) *DispatchError {
+	if err == nil || err.Type != NoHandlerFound {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.holdMax <= 0 {
+		return err
+	}
+	d.held = append(d.held, evt)
+	d.trimHeld()
+	return nil
+}
+
+// Unhandled returns the held events, oldest first, see HoldUnhandled.
+func (d *Dispatcher) Unhandled() []interface{} {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]interface{}(nil), d.held...)
+}
+
+// Unhandled returns the events that the default dispatcher holds, see Dispatcher.Unhandled.
+func Unhandled() []interface{} {
+	return defaultDispatcher.Unhandled()
+}
+
+// ClearUnhandled drops the held events.
+func (d *Dispatcher) ClearUnhandled() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.held = nil
+}
+
+// ClearUnhandled drops the events that the default dispatcher holds, see
+// Dispatcher.ClearUnhandled.
+func ClearUnhandled() {
+	defaultDispatcher.ClearUnhandled()
+}
+
+// ReplayUnhandled stops holding events, and dispatches the held events in the order in which
+// they came in. The errors of their dispatches are joined, each stating the event type; events
+// that still have no handler fail with NoHandlerFound, or go to the dead-letter handler.
+func (d *Dispatcher) ReplayUnhandled() error {
+	d.mu.Lock()
+	held := d.held
+	d.held, d.holdMax = nil, 0
+	d.mu.Unlock()
+
+	var errs []error
+	for _, evt := range held {
+		if err := d.Dispatch(evt); err != nil {
+			t, _ := EventTypeOf(evt)
+			errs = append(errs, fmt.Errorf("%v: %w", t, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ReplayUnhandled replays the events that the default dispatcher holds, see
+// Dispatcher.ReplayUnhandled.
+func ReplayUnhandled() error {
+	return defaultDispatcher.ReplayUnhandled()
+}
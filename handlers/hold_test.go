@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestHoldUnhandled(t *testing.T) {
+	d := New()
+	d.HoldUnhandled(10)
+	connected := &events.Connected{}
+	var msgs []*events.Message
+	for i := 0; i < 3; i++ {
+		m := &events.Message{}
+		m.Info.ID = fmt.Sprint("M", i)
+		msgs = append(msgs, m)
+	}
+	for _, evt := range []interface{}{connected, msgs[0], msgs[1], msgs[2]} {
+		if err := d.Dispatch(evt); err != nil {
+			t.Errorf("Dispatch(%T) = %v, need nil error while holding", evt, err)
+		}
+	}
+	if got := len(d.Unhandled()); got != 4 {
+		t.Errorf("Unhandled() has %v events, want 4", got)
+	}
+
+	var seen []interface{}
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		seen = append(seen, ev)
+		return nil
+	}))
+	err := d.ReplayUnhandled()
+	if err == nil {
+		t.Errorf("ReplayUnhandled() = nil, want the NoHandlerFound of Connected")
+	}
+	if len(seen) != 3 || seen[0] != msgs[0] || seen[1] != msgs[1] || seen[2] != msgs[2] {
+		t.Errorf("handler saw %v, want the original messages in order", seen)
+	}
+	if got := len(d.Unhandled()); got != 0 {
+		t.Errorf("after ReplayUnhandled(), Unhandled() has %v events, want 0", got)
+	}
+	// Replaying ended the holding.
+	if err := d.Dispatch(connected); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(_) after replay = %v, want NoHandlerFound", err)
+	}
+}
+
+func TestHoldUnhandledLimit(t *testing.T) {
+	d := New()
+	d.Register(Message, handlerFunc(func(ev interface{}) error { return nil }))
+	d.HoldUnhandled(3)
+	for i := 0; i < 5; i++ {
+		d.Dispatch(&events.Message{}) // handled, not held
+		d.Dispatch(&events.Receipt{MessageIDs: []string{fmt.Sprint(i)}})
+	}
+	var ids []string
+	for _, evt := range d.Unhandled() {
+		ids = append(ids, evt.(*events.Receipt).MessageIDs[0])
+	}
+	if got, want := fmt.Sprint(ids), "[2 3 4]"; got != want {
+		t.Errorf("Unhandled() = %v, want the newest %v", got, want)
+	}
+
+	d.HoldUnhandled(2)
+	if got := len(d.Unhandled()); got != 2 {
+		t.Errorf("after lowering the limit, Unhandled() has %v events, want 2", got)
+	}
+	d.ClearUnhandled()
+	if got := len(d.Unhandled()); got != 0 {
+		t.Errorf("after ClearUnhandled(), Unhandled() has %v events, want 0", got)
+	}
+	if err := d.ReplayUnhandled(); err != nil {
+		t.Errorf("ReplayUnhandled() = %v, need nil error", err)
+	}
+}
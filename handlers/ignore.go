@@ -0,0 +1,52 @@
+package handlers
+
+// Ignore makes Dispatch return nil, rather than NoHandlerFound, for events of the types when they
+// have no handlers, e.g. for the dozens of types that a bot doesn't care about. Handlers that are
+// registered for the types still run. Ignored events are counted in EventStats.Ignored (see
+// Stats), and they aren't held (see HoldUnhandled) or passed to the dead-letter handler.
+func (d *Dispatcher) Ignore(types ...EventType) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.ignored == nil {
+		d.ignored = map[EventType]bool{}
+	}
+	for _, t := range types {
+		d.ignored[t] = true
+	}
+}
+
+// Ignore ignores event types without handlers in the default dispatcher, see Dispatcher.Ignore.
+func Ignore(types ...EventType) {
+	defaultDispatcher.Ignore(types...)
+}
+
+// IgnoreUnhandled ignores the events without handlers of all types, like Ignore, when `on` is
+// true. Setting it back to false leaves the types of Ignore ignored.
+func (d *Dispatcher) IgnoreUnhandled(on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.ignoreAll = on
+}
+
+// IgnoreUnhandled ignores all events without handlers in the default dispatcher, see
+// Dispatcher.IgnoreUnhandled.
+func IgnoreUnhandled(on bool) {
+	defaultDispatcher.IgnoreUnhandled(on)
+}
+
+// ignore returns nil for a NoHandlerFound error of an ignored type, and the error otherwise.
+func (d *Dispatcher) ignore(t EventType, err *DispatchError) *DispatchError {
+	if err == nil || err.Type != NoHandlerFound {
+		return err
+	}
+	d.mu.RLock()
+	ignored := d.ignoreAll || d.ignored[t]
+	d.mu.RUnlock()
+	if !ignored {
+		return err
+	}
+	d.stats[t].ignored.Add(1)
+	return nil
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestIgnore(t *testing.T) {
+	d := New()
+	d.Ignore(Presence, ChatPresence)
+	var dead []EventType
+	d.SetDeadLetterHandler(func(t EventType, evt interface{}, reason DispatchErrorType, err error) {
+		dead = append(dead, t)
+	})
+
+	// Ignored, without handler.
+	if err := d.Dispatch(&events.Presence{}); err != nil {
+		t.Errorf("Dispatch(*events.Presence) = %v, need nil error for an ignored type", err)
+	}
+	if len(dead) > 0 {
+		t.Errorf("dead-letter handler got %v, want nothing for an ignored type", dead)
+	}
+	if got := d.Stats()[Presence]; got.Ignored != 1 || got.NoHandler != 1 {
+		t.Errorf("Stats()[Presence] = %+v, want 1 ignored without handler", got)
+	}
+
+	// Ignored, with handler.
+	handled := 0
+	d.Register(ChatPresence, handlerFunc(func(ev interface{}) error {
+		handled++
+		return nil
+	}))
+	if err := d.Dispatch(&events.ChatPresence{}); err != nil || handled != 1 {
+		t.Errorf("Dispatch(*events.ChatPresence) = %v with %v handled, want nil error and 1 handled", err, handled)
+	}
+
+	// Not ignored.
+	d.SetDeadLetterHandler(nil)
+	if err := d.Dispatch(&events.Picture{}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(*events.Picture) = %v, want NoHandlerFound", err)
+	}
+
+	// All ignored.
+	d.IgnoreUnhandled(true)
+	if err := d.Dispatch(&events.Picture{}); err != nil {
+		t.Errorf("Dispatch(*events.Picture) = %v, need nil error after IgnoreUnhandled(true)", err)
+	}
+	d.IgnoreUnhandled(false)
+	if err := d.Dispatch(&events.Picture{}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(*events.Picture) = %v, want NoHandlerFound after IgnoreUnhandled(false)", err)
+	}
+	if err := d.Dispatch(&events.Presence{}); err != nil {
+		t.Errorf("Dispatch(*events.Presence) = %v, need nil error after IgnoreUnhandled(false)", err)
+	}
+}
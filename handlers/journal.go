@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// JournalEntry is an event in a Journal: the name of its type (see ParseEventType) and its JSON.
+type JournalEntry struct {
+	ID   int64
+	Type string
+	Data []byte
+}
+
+// Journal is a write-ahead log of the dispatched events, see SetJournal. SQLJournal is one.
+type Journal interface {
+	// Append stores an event, and returns its ID. IDs increase in the order of appending.
+	Append(typ string, data []byte) (int64, error)
+
+	// MarkDone marks an event as handled, so that it isn't replayed.
+	MarkDone(id int64) error
+
+	// Pending returns the events that aren't marked done, in the order of appending.
+	Pending() ([]JournalEntry, error)
+}
+
+// SetJournal makes the dispatcher journal each event before its handlers run, and mark it done
+// once they succeeded, or when there are no handlers for it. Events whose handlers fail, or that
+// were being handled when the process crashed, stay pending, and ReplayPending dispatches them
+// again at the next start-up. A nil journal stops the journaling.
+//
+// Events are journaled as JSON, so fields that JSON can't restore, such as interfaces, are lost
+// in a replay. Derived synthetic events (see EditMessage and friends) aren't journaled, since the
+// event that they are derived from is. Events that are buffered while paused (see Pause) are
+// journaled when they are dispatched. Failing to journal doesn't stop the dispatch, but when the
+// dispatch succeeds, it returns an error of type JournalFailed.
+func (d *Dispatcher) SetJournal(j Journal) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.journal = j
+}
+
+// SetJournal sets the journal of the default dispatcher, see Dispatcher.SetJournal.
+func SetJournal(j Journal) {
+	defaultDispatcher.SetJournal(j)
+}
+
+// replayKey is the context key of the entry that ReplayPending dispatches.
+type replayKey struct{}
+
+// replayed is an entry that ReplayPending dispatches; taken is set when the dispatch found it,
+// and marks it done itself.
+type replayed struct {
+	id    int64
+	evt   interface{}
+	taken atomic.Bool
+}
+
+// sameEvent returns whether a and b are the same event, without panicking for events that can't
+// be compared.
+func sameEvent(a, b interface{}) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// journalAppend journals an event when there is a journal, and returns the journal and the ID of
+// the event's entry. The event that ReplayPending dispatches keeps its entry; events that its
+// handlers emit (see Emit) get their own.
+func (d *Dispatcher) journalAppend(ctx context.Context, t EventType, evt interface{}) (Journal, int64, error) {
+	d.mu.RLock()
+	j := d.journal
+	d.mu.RUnlock()
+	if j == nil {
+		return nil, 0, nil
+	}
+	if r, ok := ctx.Value(replayKey{}).(*replayed); ok && sameEvent(r.evt, evt) && r.taken.CompareAndSwap(false, true) {
+		return j, r.id, nil
+	}
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't journal %v: %w", t, err)
+	}
+	id, err := j.Append(t.String(), data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't journal %v: %w", t, err)
+	}
+	return j, id, nil
+}
+
+// handled returns whether a dispatch is done with its event: when it succeeded, or when there
+// are no handlers for it.
+func handled(err *DispatchError) bool {
+	return err == nil || err.Type == NoHandlerFound
+}
+
+// goType returns the Go type of the events of an event type, built-in or custom.
+func goType(t EventType) (reflect.Type, bool) {
+	for _, row := range eventTable {
+		if row.t == t && row.evt != nil {
+			return reflect.TypeOf(row.evt), true
+		}
+	}
+	custom.mu.RLock()
+	defer custom.mu.RUnlock()
+	for rt, ct := range custom.types {
+		if ct == t {
+			return rt, true
+		}
+	}
+	return nil, false
+}
+
+// decodeEntry returns the event of a journal entry, as a pointer, as it was dispatched.
+func decodeEntry(e JournalEntry) (interface{}, error) {
+	t, err := ParseEventType(e.Type)
+	if err != nil {
+		return nil, err
+	}
+	rt, ok := goType(t)
+	if !ok {
+		return nil, fmt.Errorf("%v has no events of its own", t)
+	}
+	evt := reflect.New(rt).Interface()
+	if err := json.Unmarshal(e.Data, evt); err != nil {
+		return nil, err
+	}
+	return evt, nil
+}
+
+// ReplayPending dispatches the pending events of the journal (see SetJournal), in the order in
+// which they came in, using `dispatch`, which is usually d.DispatchCtx. Call it at start-up, once
+// the handlers are registered, and before connecting. The replayed events aren't journaled again:
+// an event is marked done when its dispatch succeeds, or finds no handler, and otherwise stays
+// pending. Entries that can't be decoded, e.g. because their custom type (see RegisterCustomType)
+// isn't registered, stay pending too. The errors are joined, each stating the entry.
+//
+//	d.SetJournal(journal)
+//	if err := d.ReplayPending(ctx, d.DispatchCtx); err != nil {
+//		log.Println(err)
+//	}
+func (d *Dispatcher) ReplayPending(ctx context.Context, dispatch func(context.Context, interface{}) *DispatchError) error {
+	d.mu.RLock()
+	j := d.journal
+	d.mu.RUnlock()
+	if j == nil {
+		return errors.New("handlers.ReplayPending: no journal, see SetJournal")
+	}
+	entries, err := j.Pending()
+	if err != nil {
+		return fmt.Errorf("handlers.ReplayPending: %w", err)
+	}
+	var errs []error
+	for _, e := range entries {
+		evt, err := decodeEntry(e)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("entry %d (%s): %w", e.ID, e.Type, err))
+			continue
+		}
+		r := &replayed{id: e.ID, evt: evt}
+		derr := dispatch(context.WithValue(ctx, replayKey{}, r), evt)
+		if !handled(derr) {
+			errs = append(errs, fmt.Errorf("entry %d (%s): %w", e.ID, e.Type, derr))
+			continue
+		}
+		// When the dispatch didn't take the entry, e.g. when the event was buffered while paused,
+		// the event was journaled anew, or `dispatch` doesn't journal.
+		if !r.taken.Load() {
+			if err := j.MarkDone(e.ID); err != nil {
+				errs = append(errs, fmt.Errorf("entry %d (%s): %w", e.ID, e.Type, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("handlers.ReplayPending: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// ReplayPending replays the pending events of the journal of the default dispatcher, see
+// Dispatcher.ReplayPending.
+func ReplayPending(ctx context.Context, dispatch func(context.Context, interface{}) *DispatchError) error {
+	return defaultDispatcher.ReplayPending(ctx, dispatch)
+}
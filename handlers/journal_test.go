@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func openJournal(t *testing.T) *SQLJournal {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open(_) = _, %v; need nil error", err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own in-memory database
+	t.Cleanup(func() { db.Close() })
+	j, err := NewSQLJournal(context.Background(), db)
+	if err != nil {
+		t.Fatalf("NewSQLJournal(_) = _, %v; need nil error", err)
+	}
+	return j
+}
+
+// crashed is a journal of a process that crashed before it marked its events done.
+type crashed struct {
+	Journal
+}
+
+func (crashed) MarkDone(id int64) error { return nil }
+
+// failingJournal fails to append.
+type failingJournal struct {
+	Journal
+}
+
+func (failingJournal) Append(typ string, data []byte) (int64, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestJournalReplay(t *testing.T) {
+	ctx := context.Background()
+	j := openJournal(t)
+
+	// Before the crash, the handlers run, but the events aren't marked done.
+	before := New()
+	before.SetJournal(crashed{j})
+	before.Register(Message, handlerFunc(func(ev interface{}) error { return nil }))
+	for _, id := range []string{"A", "B", "C"} {
+		m := message(id)
+		m.Message = &waE2E.Message{Conversation: proto.String("text of " + id)}
+		if err := before.Dispatch(m); err != nil {
+			t.Errorf("Dispatch(%v) = %v, need nil error", id, err)
+		}
+	}
+
+	// After the restart, the events are replayed in order; B fails again and stays pending.
+	after := New()
+	after.SetJournal(j)
+	var got []string
+	after.Register(Message, handlerFunc(func(ev interface{}) error {
+		m := ev.(*events.Message)
+		got = append(got, m.Info.ID+":"+m.Message.GetConversation())
+		if m.Info.ID == "B" {
+			return errors.New("still failing")
+		}
+		return nil
+	}))
+	err := after.ReplayPending(ctx, after.DispatchCtx)
+	if err == nil || !strings.Contains(err.Error(), "still failing") {
+		t.Errorf("ReplayPending(_) = %v, want the error of B", err)
+	}
+	if got, want := strings.Join(got, " "), "A:text of A B:text of B C:text of C"; got != want {
+		t.Errorf("replayed %q, want %q", got, want)
+	}
+
+	// Events that come in now are journaled, and marked done; unhandled ones too.
+	for _, evt := range []interface{}{message("D"), &events.Connected{}} {
+		if err := after.Dispatch(evt); err != nil && !errors.Is(err, ErrNoHandler) {
+			t.Errorf("Dispatch(%T) = %v, need nil error or ErrNoHandler", evt, err)
+		}
+	}
+
+	got = nil
+	if err := after.ReplayPending(ctx, after.DispatchCtx); err == nil {
+		t.Errorf("ReplayPending(_) = nil, want the error of B")
+	}
+	if got, want := strings.Join(got, " "), "B:text of B"; got != want {
+		t.Errorf("replayed %q, want %q", got, want)
+	}
+	pending, err := j.Pending()
+	if err != nil || len(pending) != 1 || pending[0].Type != "Message" {
+		t.Errorf("Pending() = %v, %v, want B", pending, err)
+	}
+}
+
+func TestJournalReplayOtherDispatch(t *testing.T) {
+	j := openJournal(t)
+	d := New()
+	d.SetJournal(crashed{j})
+	d.Register(Connected, handlerFunc(func(ev interface{}) error { return nil }))
+	if err := d.Dispatch(&events.Connected{}); err != nil {
+		t.Errorf("Dispatch(_) = %v, need nil error", err)
+	}
+
+	// A dispatch function that doesn't journal has its events marked done by ReplayPending.
+	d.SetJournal(j)
+	var got []interface{}
+	err := d.ReplayPending(context.Background(), func(ctx context.Context, evt interface{}) *DispatchError {
+		got = append(got, evt)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("ReplayPending(_) = %v, need nil error", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("replayed %v, want a Connected event", got)
+	}
+	if _, ok := got[0].(*events.Connected); !ok {
+		t.Errorf("replayed %T, want *events.Connected", got[0])
+	}
+	if pending, err := j.Pending(); err != nil || len(pending) != 0 {
+		t.Errorf("Pending() = %v, %v, want none", pending, err)
+	}
+}
+
+func TestJournalErrors(t *testing.T) {
+	j := openJournal(t)
+	d := New()
+	if err := d.ReplayPending(context.Background(), d.DispatchCtx); err == nil {
+		t.Errorf("ReplayPending(_) without a journal = nil, need error")
+	}
+
+	d.SetJournal(failingJournal{j})
+	handled := 0
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		handled++
+		return nil
+	}))
+	err := d.Dispatch(message("A"))
+	if err == nil || err.Type != JournalFailed || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Dispatch(_) = %v, want JournalFailed", err)
+	}
+	if handled != 1 {
+		t.Errorf("handled %d events, want 1", handled)
+	}
+
+	if _, err := j.Append("NoSuchType", []byte("{}")); err != nil {
+		t.Fatalf("Append(_) = _, %v, need nil error", err)
+	}
+	d.SetJournal(j)
+	if err := d.ReplayPending(context.Background(), d.DispatchCtx); err == nil {
+		t.Errorf("ReplayPending(_) with an unknown type = nil, need error")
+	}
+	if pending, err := j.Pending(); err != nil || len(pending) != 1 {
+		t.Errorf("Pending() = %v, %v, want the entry of the unknown type", pending, err)
+	}
+}
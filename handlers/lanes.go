@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// KeyFunc returns the key of an event for Lanes and Debounce. For Lanes, events with the same key
+// are handled in order; events without a key (an empty string) go to the default lane.
+type KeyFunc func(evt interface{}) string
+
+// ChatKey is the default KeyFunc: Message, Receipt and ChatPresence events are keyed by their
+// chat.
+func ChatKey(evt interface{}) string {
+	switch v := evt.(type) {
+	case *events.Message:
+		return v.Info.Chat.String()
+	case *events.Receipt:
+		return v.Chat.String()
+	case *events.ChatPresence:
+		return v.Chat.String()
+	}
+	return ""
+}
+
+// SenderKey is a KeyFunc that keys Message, Receipt, ChatPresence and Presence events by their
+// sender, e.g. to handle the messages of a user in order across chats.
+func SenderKey(evt interface{}) string {
+	switch v := evt.(type) {
+	case *events.Message:
+		return v.Info.Sender.ToNonAD().String()
+	case *events.Receipt:
+		return v.Sender.ToNonAD().String()
+	case *events.ChatPresence:
+		return v.Sender.ToNonAD().String()
+	case *events.Presence:
+		return v.From.ToNonAD().String()
+	}
+	return ""
+}
+
+// LaneOpts configures Lanes.
+type LaneOpts struct {
+	Lanes   int                                       // serial lanes for keyed events, 8 when zero
+	Buffer  int                                       // events that a lane holds before Dispatch blocks, 100 when zero
+	Key     KeyFunc                                   // ChatKey when nil
+	OnError func(evt interface{}, err *DispatchError) // called with dispatch errors, which are dropped when nil
+}
+
+// Lanes dispatches events concurrently, but in order per key: events are hashed by their key to
+// one of a number of serial lanes, so that e.g. the messages of a chat are handled in the order
+// in which they came in, while different chats are handled in parallel. Events without a key
+// share a default lane. The zero value isn't usable, use Dispatcher.NewLanes.
+type Lanes struct {
+	d     *Dispatcher
+	opts  LaneOpts
+	lanes []chan interface{} // the last one is the default lane
+	wg    sync.WaitGroup
+}
+
+// NewLanes returns lanes that dispatch to `d`. The lanes run until Close is called.
+func (d *Dispatcher) NewLanes(opts LaneOpts) *Lanes {
+	if opts.Lanes <= 0 {
+		opts.Lanes = 8
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 100
+	}
+	if opts.Key == nil {
+		opts.Key = ChatKey
+	}
+	l := &Lanes{d: d, opts: opts}
+	for i := 0; i <= opts.Lanes; i++ {
+		ch := make(chan interface{}, opts.Buffer)
+		l.lanes = append(l.lanes, ch)
+		l.wg.Add(1)
+		go l.run(ch)
+	}
+	return l
+}
+
+// NewLanes returns lanes that dispatch to the default dispatcher, see Dispatcher.NewLanes.
+func NewLanes(opts LaneOpts) *Lanes {
+	return defaultDispatcher.NewLanes(opts)
+}
+
+func (l *Lanes) run(ch chan interface{}) {
+	defer l.wg.Done()
+	for evt := range ch {
+		if err := l.d.Dispatch(evt); err != nil && l.opts.OnError != nil {
+			l.opts.OnError(evt, err)
+		}
+	}
+}
+
+// lane returns the index of the lane for a key.
+func (l *Lanes) lane(key string) int {
+	if key == "" {
+		return l.opts.Lanes
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(l.opts.Lanes))
+}
+
+// Dispatch queues an event on its lane. It blocks while the lane is full. Since the event is
+// handled later, dispatch errors are passed to LaneOpts.OnError. Dispatch must not be called
+// after Close.
+func (l *Lanes) Dispatch(evt interface{}) {
+	l.lanes[l.lane(l.opts.Key(evt))] <- evt
+}
+
+// Close stops accepting events, and waits until the queued events are handled.
+func (l *Lanes) Close() {
+	for _, ch := range l.lanes {
+		close(ch)
+	}
+	l.wg.Wait()
+}
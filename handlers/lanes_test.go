@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func chatMessage(chat types.JID, id string) *events.Message {
+	m := &events.Message{}
+	m.Info.Chat = chat
+	m.Info.ID = id
+	return m
+}
+
+// TestLanes checks that the events of a chat are handled in order, while another chat is
+// handled meanwhile.
+func TestLanes(t *testing.T) {
+	d := New()
+	l := d.NewLanes(LaneOpts{Lanes: 2})
+
+	// Two chats on different lanes.
+	a := types.NewJID("a", types.DefaultUserServer)
+	var b types.JID
+	for i := 0; ; i++ {
+		b = types.NewJID(fmt.Sprint("b", i), types.DefaultUserServer)
+		if l.lane(b.String()) != l.lane(a.String()) {
+			break
+		}
+	}
+
+	var mu sync.Mutex
+	got := map[types.JID][]string{}
+	bDone := make(chan struct{})
+	overlapped := false
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		m := ev.(*events.Message)
+		if m.Info.Chat == a && m.Info.ID == "a0" {
+			// Chat b is handled while chat a is busy.
+			select {
+			case <-bDone:
+				overlapped = true
+			case <-time.After(5 * time.Second):
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		got[m.Info.Chat] = append(got[m.Info.Chat], m.Info.ID)
+		if m.Info.Chat == b && len(got[b]) == 3 {
+			close(bDone)
+		}
+		return nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		l.Dispatch(chatMessage(a, fmt.Sprint("a", i)))
+		l.Dispatch(chatMessage(b, fmt.Sprint("b", i)))
+	}
+	l.Close()
+
+	if fmt.Sprint(got[a]) != "[a0 a1 a2]" || fmt.Sprint(got[b]) != "[b0 b1 b2]" {
+		t.Errorf("handled %v, want each chat in order", got)
+	}
+	if !overlapped {
+		t.Errorf("chat b wasn't handled while chat a was busy")
+	}
+}
+
+// TestLanesErrorsAndKeys checks that dispatch errors are reported, and that unkeyed events go
+// to the default lane.
+func TestLanesErrorsAndKeys(t *testing.T) {
+	var mu sync.Mutex
+	var failed []EventType
+	d := New()
+	l := d.NewLanes(LaneOpts{
+		Lanes: 4,
+		Key:   SenderKey,
+		OnError: func(evt interface{}, err *DispatchError) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err.Type == NoHandlerFound {
+				failed = append(failed, Connected)
+			}
+		},
+	})
+	if got := l.lane(SenderKey(&events.Connected{})); got != 4 {
+		t.Errorf("lane of an unkeyed event = %v, want the default lane 4", got)
+	}
+	m := &events.Message{}
+	m.Info.Sender = types.NewADJID("123", 0, 3)
+	if got, want := SenderKey(m), "123@s.whatsapp.net"; got != want {
+		t.Errorf("SenderKey(_) = %v, want %v", got, want)
+	}
+	l.Dispatch(&events.Connected{})
+	l.Close()
+	if len(failed) != 1 {
+		t.Errorf("OnError saw %v, want the unhandled Connected", failed)
+	}
+}
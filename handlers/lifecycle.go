@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Initer is implemented by handlers that need to be set up before events come in, such as
+// opening a database. See Start.
+type Initer interface {
+	Init(ctx context.Context) error
+}
+
+// Closer is implemented by handlers that hold resources, such as database connections or
+// tickers. See Close.
+type Closer interface {
+	Close() error
+}
+
+// unwrapper is implemented by the handlers that wrap a registered handler, such as those of
+// RegisterOnce and RegisterFiltered, so that Start and Close reach the registered handler.
+type unwrapper interface {
+	unwrap() handler
+}
+
+func (o *once) unwrap() handler        { return o.h }
+func (f *filtered) unwrap() handler    { return f.h }
+func (r *rateLimited) unwrap() handler { return r.h }
+
+// lifecycleHandlers returns the registered handlers, unwrapped, once each and in the order in
+// which they were first registered. Handlers are compared by identity, see Unregister.
+func (d *Dispatcher) lifecycleHandlers() []handler {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	registered := func(h handler) bool {
+		if !reflect.TypeOf(h).Comparable() {
+			return true // can't be unregistered
+		}
+		for _, reg := range []map[EventType][]handler{d.registry, d.defaults} {
+			for _, hs := range reg {
+				for _, rh := range hs {
+					if same(rh, h) {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+	var hs []handler
+	for i, h := range d.order {
+		if !registered(h) {
+			continue // unregistered since
+		}
+		dup := false
+		for _, earlier := range d.order[:i] {
+			dup = dup || same(earlier, h)
+		}
+		if dup {
+			continue
+		}
+		for {
+			u, ok := h.(unwrapper)
+			if !ok {
+				break
+			}
+			h = u.unwrap()
+		}
+		hs = append(hs, h)
+	}
+	return hs
+}
+
+// Start calls Init on the registered handlers that implement Initer, in the order in which they
+// were registered, once per handler also when it is registered for more than one event type.
+// It stops at the first handler that fails, and returns its error, stating its position and
+// name (see Named). Handlers that are wrapped, e.g. by RegisterFiltered, are initialized too.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	for i, h := range d.lifecycleHandlers() {
+		in, ok := h.(Initer)
+		if !ok {
+			continue
+		}
+		if err := in.Init(ctx); err != nil {
+			return fmt.Errorf("handlers.Dispatcher.Start: handler %d (%s): %w", i, handlerName(h), err)
+		}
+	}
+	return nil
+}
+
+// Start starts the handlers of the default dispatcher, see Dispatcher.Start.
+func Start(ctx context.Context) error {
+	return defaultDispatcher.Start(ctx)
+}
+
+// Close shuts the dispatcher down, e.g. before the program exits. It stops accepting events:
+// later dispatches fail with DispatcherClosed. It waits until the running dispatches are done,
+// delivers the events that debounced handlers hold back (see Debounce), and then calls Close on
+// the registered handlers that implement Closer, once per handler. The errors of the handlers
+// are joined, each stating the position and the name of its handler. Closing again does
+// nothing. A handler must not call Close, since Close would wait for the handler.
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	flushers := d.flushers
+	d.flushers = nil
+	d.mu.Unlock()
+
+	d.inFlight.Wait()
+	for _, f := range flushers {
+		f()
+	}
+	var errs []error
+	for i, h := range d.lifecycleHandlers() {
+		c, ok := h.(Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("handler %d (%s): %w", i, handlerName(h), err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("handlers.Dispatcher.Close: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Close closes the default dispatcher, see Dispatcher.Close.
+func Close() error {
+	return defaultDispatcher.Close()
+}
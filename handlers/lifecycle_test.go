@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// resource is a handler with Init and Close, which logs its calls.
+type resource struct {
+	name     string
+	log      *[]string
+	initErr  error
+	closeErr error
+}
+
+func (r *resource) Handle(ev interface{}) error { return nil }
+
+func (r *resource) Init(ctx context.Context) error {
+	*r.log = append(*r.log, "init "+r.name)
+	return r.initErr
+}
+
+func (r *resource) Close() error {
+	*r.log = append(*r.log, "close "+r.name)
+	return r.closeErr
+}
+
+func TestLifecycle(t *testing.T) {
+	var log []string
+	d := New()
+	a := &resource{name: "a", log: &log}
+	b := &resource{name: "b", log: &log}
+	gone := &resource{name: "gone", log: &log}
+	d.Register(Message, a)
+	d.Register(Receipt, a) // same handler, initialized and closed once
+	d.RegisterFiltered(Presence, NotFromMe(), b)
+	d.Register(Message, gone)
+	d.Register(Message, handlerFunc(func(ev interface{}) error { return nil })) // neither
+	d.Unregister(Message, gone)
+
+	if err := d.Start(context.Background()); err != nil {
+		t.Errorf("Start(_) = %v, need nil error", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Errorf("Close() = %v, need nil error", err)
+	}
+	if got, want := fmt.Sprint(log), "[init a init b close a close b]"; got != want {
+		t.Errorf("lifecycle calls = %v, want %v", got, want)
+	}
+
+	log = nil
+	if err := d.Close(); err != nil || len(log) > 0 {
+		t.Errorf("second Close() = %v and calls %v, want nil error and no calls", err, log)
+	}
+	if err := d.Dispatch(&events.Message{}); err == nil || err.Type != DispatcherClosed {
+		t.Errorf("Dispatch(_) after Close = %v, want DispatcherClosed", err)
+	}
+}
+
+func TestLifecycleErrors(t *testing.T) {
+	var log []string
+	errInit, errClose := errors.New("no database"), errors.New("flush failed")
+	d := New()
+	d.Register(Message, &resource{name: "a", log: &log, closeErr: errClose})
+	d.Register(Message, &resource{name: "b", log: &log, initErr: errInit})
+	d.Register(Message, &resource{name: "c", log: &log, closeErr: errClose})
+
+	err := d.Start(context.Background())
+	if !errors.Is(err, errInit) || !strings.Contains(err.Error(), "handler 1 (*handlers.resource)") {
+		t.Errorf("Start(_) = %v, want %v of handler 1", err, errInit)
+	}
+	if got, want := fmt.Sprint(log), "[init a init b]"; got != want {
+		t.Errorf("after failing Start, calls = %v, want %v", got, want)
+	}
+
+	err = d.Close()
+	if !errors.Is(err, errClose) || !strings.Contains(err.Error(), "handler 0") || !strings.Contains(err.Error(), "handler 2") {
+		t.Errorf("Close() = %v, want %v of handlers 0 and 2", err, errClose)
+	}
+}
+
+// TestCloseWaits checks that Close waits for a running dispatch before closing the handlers.
+func TestCloseWaits(t *testing.T) {
+	var log []string
+	started, release := make(chan struct{}), make(chan struct{})
+	d := New()
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		close(started)
+		<-release
+		log = append(log, "handled")
+		return nil
+	}))
+	d.Register(Message, &resource{name: "r", log: &log})
+
+	go d.Dispatch(&events.Message{})
+	<-started
+	closed := make(chan error)
+	go func() { closed <- d.Close() }()
+	select {
+	case <-closed:
+		t.Fatalf("Close() returned during a dispatch")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	if err := <-closed; err != nil {
+		t.Errorf("Close() = %v, need nil error", err)
+	}
+	if got, want := fmt.Sprint(log), "[handled close r]"; got != want {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/sticker"
+	"github.com/KarelKubat/whatsmeow/waiface"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// MessageRef identifies a message: the chat it's in, who sent it and its ID.
+type MessageRef struct {
+	Chat      types.JID
+	Sender    types.JID
+	ID        types.MessageID
+	FromMe    bool
+	Timestamp time.Time // when the message was sent, zero when unknown
+}
+
+// RefOf returns the reference to a received message.
+func RefOf(m *events.Message) MessageRef {
+	return MessageRef{
+		Chat:      m.Info.Chat,
+		Sender:    m.Info.Sender,
+		ID:        m.Info.ID,
+		FromMe:    m.Info.IsFromMe,
+		Timestamp: m.Info.Timestamp,
+	}
+}
+
+// Edit is a synthetic event that is dispatched as `EditMessage` when a received message edits
+// an earlier message. The `Message` handlers see the raw edit too.
+type Edit struct {
+	Target     MessageRef     // the edited message
+	NewContent *waE2E.Message // the new content, e.g. with a Conversation
+	Editor     types.JID      // who edited the message
+	Timestamp  time.Time      // when the message was edited
+	Event      *events.Message
+}
+
+// AsEdit returns the edit that a received message carries, if it is an edit.
+func AsEdit(m *events.Message) (*Edit, bool) {
+	pm := m.Message.GetProtocolMessage()
+	if pm.GetType() != waE2E.ProtocolMessage_MESSAGE_EDIT {
+		return nil, false
+	}
+	target := MessageRef{
+		Chat:   m.Info.Chat,
+		Sender: m.Info.Sender,
+		ID:     pm.GetKey().GetID(),
+		FromMe: m.Info.IsFromMe,
+	}
+	ts := m.Info.Timestamp
+	if ms := pm.GetTimestampMS(); ms > 0 {
+		ts = time.UnixMilli(ms)
+	}
+	return &Edit{
+		Target:     target,
+		NewContent: pm.GetEditedMessage(),
+		Editor:     m.Info.Sender,
+		Timestamp:  ts,
+		Event:      m,
+	}, true
+}
+
+// Revoke is a synthetic event that is dispatched as `MessageRevoked` when a message is deleted.
+// A received revoke (delete for everyone) has ForEveryone set; a DeleteForMe event (deleted on
+// one of my own devices) doesn't. The raw events are dispatched to their own handlers too.
+type Revoke struct {
+	Target      MessageRef  // the deleted message
+	Actor       types.JID   // who deleted the message, empty for DeleteForMe
+	ForEveryone bool        // true for revokes, false for DeleteForMe
+	Timestamp   time.Time   // when the message was deleted
+	Event       interface{} // *events.Message or *events.DeleteForMe
+}
+
+// AsRevoke returns the revoke that a received message carries, if it is a revoke.
+func AsRevoke(m *events.Message) (*Revoke, bool) {
+	pm := m.Message.GetProtocolMessage()
+	if pm == nil || pm.GetType() != waE2E.ProtocolMessage_REVOKE {
+		return nil, false
+	}
+	// The key is from the point of view of the revoker: its FromMe is about them, not about me.
+	key := pm.GetKey()
+	target := MessageRef{
+		Chat:   m.Info.Chat,
+		Sender: m.Info.Sender, // in a 1:1 chat, only the sender can revoke
+		ID:     key.GetID(),
+		FromMe: m.Info.IsFromMe,
+	}
+	if p := key.GetParticipant(); p != "" {
+		// In a group, an admin may revoke someone else's message. Whether that message is mine
+		// can't be told without the own JID, so FromMe is then false; compare Target.Sender.
+		if jid, err := types.ParseJID(p); err == nil && jid.ToNonAD() != m.Info.Sender.ToNonAD() {
+			target.Sender = jid
+			target.FromMe = false
+		}
+	}
+	return &Revoke{
+		Target:      target,
+		Actor:       m.Info.Sender,
+		ForEveryone: true,
+		Timestamp:   m.Info.Timestamp,
+		Event:       m,
+	}, true
+}
+
+// Reaction is the reaction that a received message carries, see AsReaction. Reactions are
+// dispatched as Message events; msgkind dispatches them by kind.
+type Reaction struct {
+	Target    MessageRef // the message reacted to
+	Emoji     string     // empty when the reaction is removed
+	Removed   bool       // the reactor took back their reaction
+	Reactor   types.JID  // who reacted
+	Timestamp time.Time  // when the reaction was sent
+	Event     *events.Message
+}
+
+// AsReaction returns the reaction that a received message carries, if it is a reaction. Adding
+// and removing a reaction are both reactions; a removal has an empty emoji.
+func AsReaction(m *events.Message) (*Reaction, bool) {
+	rm := m.Message.GetReactionMessage()
+	if rm == nil {
+		return nil, false
+	}
+	// The key is from the point of view of the reactor: its FromMe is about them, not about me.
+	// Its RemoteJID doesn't help either: in a DM, that is me.
+	key := rm.GetKey()
+	target := MessageRef{
+		Chat: m.Info.Chat,
+		ID:   key.GetID(),
+	}
+	switch {
+	case key.GetFromMe():
+		// A reaction to their own message.
+		target.Sender = m.Info.Sender
+		target.FromMe = m.Info.IsFromMe
+	case key.GetParticipant() != "":
+		// In a group, the participant sent the message. Whether that message is mine can't be
+		// told without the own JID, so FromMe is then false; compare Target.Sender.
+		if jid, err := types.ParseJID(key.GetParticipant()); err == nil {
+			target.Sender = jid
+		}
+	case m.Info.IsFromMe:
+		// I reacted in a DM to the message of the other party.
+		target.Sender = m.Info.Chat
+	default:
+		// The other party reacted in a DM to my message. My JID isn't known here, so the
+		// sender is empty.
+		target.FromMe = true
+	}
+	ts := m.Info.Timestamp
+	if ms := rm.GetSenderTimestampMS(); ms > 0 {
+		ts = time.UnixMilli(ms)
+	}
+	return &Reaction{
+		Target:    target,
+		Emoji:     rm.GetText(),
+		Removed:   rm.GetText() == "",
+		Reactor:   m.Info.Sender,
+		Timestamp: ts,
+		Event:     m,
+	}, true
+}
+
+// Sticker is a synthetic event that is dispatched as `StickerMessage` when a sticker is received.
+// The `Message` handlers see the raw message too. The pack metadata is stored in the image, so
+// it can only be read after downloading, see Meta.
+type Sticker struct {
+	Ref      MessageRef
+	Animated bool
+	Message  *waE2E.StickerMessage
+	Event    *events.Message
+}
+
+// AsSticker returns the sticker that a received message carries, if it is a sticker.
+func AsSticker(m *events.Message) (*Sticker, bool) {
+	sm := m.Message.GetStickerMessage()
+	if sm == nil {
+		return nil, false
+	}
+	return &Sticker{
+		Ref:      RefOf(m),
+		Animated: sm.GetIsAnimated(),
+		Message:  sm,
+		Event:    m,
+	}, true
+}
+
+// Meta downloads the sticker and returns its pack metadata. `cli` is typically the
+// `*whatsmeow.Client`.
+func (s *Sticker) Meta(cli waiface.Downloader) (sticker.Meta, error) {
+	data, err := cli.Download(s.Message)
+	if err != nil {
+		return sticker.Meta{}, fmt.Errorf("handlers.Sticker.Meta: downloading: %w", err)
+	}
+	meta, err := sticker.MetaOf(data)
+	if err != nil {
+		return sticker.Meta{}, fmt.Errorf("handlers.Sticker.Meta: %w", err)
+	}
+	return meta, nil
+}
+
+func deleteForMeRevoke(d *events.DeleteForMe) *Revoke {
+	return &Revoke{
+		Target: MessageRef{
+			Chat:   d.ChatJID,
+			Sender: d.SenderJID,
+			ID:     d.MessageID,
+			FromMe: d.IsFromMe,
+		},
+		Timestamp: d.Timestamp,
+		Event:     d,
+	}
+}
+
+// messageOf returns the message that an event is, or that a synthetic event is derived from; nil
+// when there is none.
+func messageOf(ev interface{}) *events.Message {
+	switch v := ev.(type) {
+	case *events.Message:
+		return v
+	case *Edit:
+		return v.Event
+	case *Sticker:
+		return v.Event
+	case *Revoke:
+		m, _ := v.Event.(*events.Message)
+		return m
+	}
+	return nil
+}
+
+// dispatchMessage dispatches a Message event, and the synthetic events that are derived from it.
+func (d *Dispatcher) dispatchMessage(ctx context.Context, m *events.Message) *DispatchError {
+	if e, ok := AsEdit(m); ok {
+		return d.dispatchDerived(ctx, Message, m, EditMessage, e)
+	}
+	if r, ok := AsRevoke(m); ok {
+		return d.dispatchDerived(ctx, Message, m, MessageRevoked, r)
+	}
+	if st, ok := AsSticker(m); ok {
+		return d.dispatchDerived(ctx, Message, m, StickerMessage, st)
+	}
+	return d.dispatch(ctx, Message, m)
+}
+
+// dispatchDerived dispatches an event and then a synthetic event that is derived from it.
+// NoHandlerFound is only returned when neither of the two has handlers.
+func (d *Dispatcher) dispatchDerived(ctx context.Context, t EventType, ev interface{}, dt EventType, dev interface{}) *DispatchError {
+	err := d.dispatch(ctx, t, ev)
+	if err != nil && err.Type != NoHandlerFound {
+		return err
+	}
+	derr := d.dispatch(ctx, dt, dev)
+	if derr == nil || derr.Type != NoHandlerFound {
+		return derr
+	}
+	return err
+}
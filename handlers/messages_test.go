@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/sticker"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+type recordingHandler struct {
+	seen []interface{}
+}
+
+func (r *recordingHandler) Handle(ev interface{}) error {
+	r.seen = append(r.seen, ev)
+	return nil
+}
+
+func editEvent() *events.Message {
+	chat := types.NewJID("123", types.DefaultUserServer)
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+			ID:            "edit-id",
+			Edit:          types.EditAttributeMessageEdit,
+		},
+		Message: &waE2E.Message{
+			ProtocolMessage: &waE2E.ProtocolMessage{
+				Type:          waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+				Key:           &waCommon.MessageKey{ID: proto.String("original-id")},
+				EditedMessage: &waE2E.Message{Conversation: proto.String("new text")},
+			},
+		},
+	}
+}
+
+// TestAsEdit checks the classification of incoming edits.
+func TestAsEdit(t *testing.T) {
+	e, ok := AsEdit(editEvent())
+	if !ok {
+		t.Fatalf("AsEdit(edit) = _, false; want true")
+	}
+	if e.Target.ID != "original-id" || e.NewContent.GetConversation() != "new text" {
+		t.Errorf("AsEdit(edit) = %+v, unexpected", e)
+	}
+	if _, ok := AsEdit(&events.Message{Message: &waE2E.Message{Conversation: proto.String("hi")}}); ok {
+		t.Errorf("AsEdit(text) = _, true; want false")
+	}
+}
+
+// TestEditDispatch checks that an incoming edit reaches both Message and EditMessage handlers,
+// and that either one suffices to not return NoHandlerFound.
+func TestEditDispatch(t *testing.T) {
+	d := New()
+	edits := &recordingHandler{}
+	d.Register(EditMessage, edits)
+	if err := d.Dispatch(editEvent()); err != nil {
+		t.Fatalf("Dispatch(edit) = %v, need nil error", err)
+	}
+	if len(edits.seen) != 1 {
+		t.Fatalf("EditMessage handler saw %v events, want 1", len(edits.seen))
+	}
+	if _, ok := edits.seen[0].(*Edit); !ok {
+		t.Errorf("EditMessage handler got %T, want *Edit", edits.seen[0])
+	}
+
+	messages := &recordingHandler{}
+	d.Register(Message, messages)
+	d.Dispatch(editEvent())
+	if len(messages.seen) != 1 || len(edits.seen) != 2 {
+		t.Errorf("Message handler saw %v, EditMessage handler saw %v events; want 1 and 2", len(messages.seen), len(edits.seen))
+	}
+
+	d = New()
+	if err := d.Dispatch(editEvent()); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(edit) without handlers = %v, want NoHandlerFound", err)
+	}
+}
+
+// TestRevokes checks that revokes and DeleteForMe events are unified as Revoke.
+func TestRevokes(t *testing.T) {
+	me := types.NewJID("1", types.DefaultUserServer)
+	other := types.NewJID("2", types.DefaultUserServer)
+	admin := types.NewJID("3", types.DefaultUserServer)
+	group := types.NewJID("4", types.GroupServer)
+
+	revoke := func(chat, sender types.JID, key *waCommon.MessageKey) *events.Message {
+		return &events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: chat, Sender: sender, IsFromMe: sender == me},
+			},
+			Message: &waE2E.Message{
+				ProtocolMessage: &waE2E.ProtocolMessage{
+					Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+					Key:  key,
+				},
+			},
+		}
+	}
+
+	for _, test := range []struct {
+		description string
+		event       interface{}
+		want        Revoke
+	}{
+		{
+			description: "own revoke",
+			event:       revoke(other, me, &waCommon.MessageKey{ID: proto.String("a"), FromMe: proto.Bool(true)}),
+			want:        Revoke{Target: MessageRef{Chat: other, Sender: me, ID: "a", FromMe: true}, Actor: me, ForEveryone: true},
+		},
+		{
+			description: "peer revoke in 1:1 chat",
+			event:       revoke(other, other, &waCommon.MessageKey{ID: proto.String("d"), FromMe: proto.Bool(true)}),
+			want:        Revoke{Target: MessageRef{Chat: other, Sender: other, ID: "d"}, Actor: other, ForEveryone: true},
+		},
+		{
+			description: "member revokes own message in group",
+			event:       revoke(group, other, &waCommon.MessageKey{ID: proto.String("e"), FromMe: proto.Bool(true), Participant: proto.String(other.String())}),
+			want:        Revoke{Target: MessageRef{Chat: group, Sender: other, ID: "e"}, Actor: other, ForEveryone: true},
+		},
+		{
+			description: "own revoke in group",
+			event:       revoke(group, me, &waCommon.MessageKey{ID: proto.String("f"), FromMe: proto.Bool(true), Participant: proto.String(me.String())}),
+			want:        Revoke{Target: MessageRef{Chat: group, Sender: me, ID: "f", FromMe: true}, Actor: me, ForEveryone: true},
+		},
+		{
+			description: "admin revoke in group",
+			event:       revoke(group, admin, &waCommon.MessageKey{ID: proto.String("b"), Participant: proto.String(other.String())}),
+			want:        Revoke{Target: MessageRef{Chat: group, Sender: other, ID: "b"}, Actor: admin, ForEveryone: true},
+		},
+		{
+			description: "delete for me",
+			event:       &events.DeleteForMe{ChatJID: other, SenderJID: other, MessageID: "c"},
+			want:        Revoke{Target: MessageRef{Chat: other, Sender: other, ID: "c"}},
+		},
+	} {
+		d := New()
+		revokes := &recordingHandler{}
+		d.Register(MessageRevoked, revokes)
+		if err := d.Dispatch(test.event); err != nil {
+			t.Errorf("%v: Dispatch(_) = %v, need nil error", test.description, err)
+			continue
+		}
+		if len(revokes.seen) != 1 {
+			t.Errorf("%v: MessageRevoked handler saw %v events, want 1", test.description, len(revokes.seen))
+			continue
+		}
+		got := revokes.seen[0].(*Revoke)
+		if got.Target != test.want.Target || got.Actor != test.want.Actor || got.ForEveryone != test.want.ForEveryone {
+			t.Errorf("%v: got %+v, want %+v", test.description, got, test.want)
+		}
+	}
+
+	if _, ok := AsRevoke(&events.Message{Message: &waE2E.Message{Conversation: proto.String("hi")}}); ok {
+		t.Errorf("AsRevoke(text) = _, true; want false")
+	}
+}
+
+type fakeDownloader struct {
+	data []byte
+}
+
+func (f *fakeDownloader) Download(msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	return f.data, nil
+}
+
+// TestSticker checks that stickers are classified and that their metadata can be read.
+func TestSticker(t *testing.T) {
+	d := New()
+	stickers := &recordingHandler{}
+	d.Register(StickerMessage, stickers)
+	ev := &events.Message{
+		Info:    types.MessageInfo{ID: "s"},
+		Message: &waE2E.Message{StickerMessage: &waE2E.StickerMessage{IsAnimated: proto.Bool(true)}},
+	}
+	if err := d.Dispatch(ev); err != nil {
+		t.Fatalf("Dispatch(sticker) = %v, need nil error", err)
+	}
+	if len(stickers.seen) != 1 {
+		t.Fatalf("StickerMessage handler saw %v events, want 1", len(stickers.seen))
+	}
+	st := stickers.seen[0].(*Sticker)
+	if st.Ref.ID != "s" || !st.Animated {
+		t.Errorf("Sticker = %+v, want ID s and animated", st)
+	}
+
+	// 512x512 lossless WebP with an empty bitstream.
+	webp := []byte{
+		'R', 'I', 'F', 'F', 18, 0, 0, 0, 'W', 'E', 'B', 'P',
+		'V', 'P', '8', 'L', 5, 0, 0, 0, 0x2f, 0xff, 0xc1, 0x7f, 0x10, 0,
+	}
+	withMeta, err := sticker.WithMeta(webp, sticker.Meta{Pack: "Cats", Author: "Karel"})
+	if err != nil {
+		t.Fatalf("sticker.WithMeta(_) = _, %v; need nil error", err)
+	}
+	meta, err := st.Meta(&fakeDownloader{data: withMeta})
+	if err != nil || meta.Pack != "Cats" || meta.Author != "Karel" {
+		t.Errorf("Meta(_) = %+v, %v; want pack Cats by Karel", meta, err)
+	}
+}
+
+func TestAsReaction(t *testing.T) {
+	me := types.NewJID("1", types.DefaultUserServer)
+	other := types.NewJID("2", types.DefaultUserServer)
+	third := types.NewJID("3", types.DefaultUserServer)
+	group := types.NewJID("4", types.GroupServer)
+
+	reaction := func(chat, sender types.JID, emoji string, key *waCommon.MessageKey) *events.Message {
+		return &events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: chat, Sender: sender, IsFromMe: sender == me, IsGroup: chat == group},
+			},
+			Message: &waE2E.Message{
+				ReactionMessage: &waE2E.ReactionMessage{Key: key, Text: proto.String(emoji), SenderTimestampMS: proto.Int64(1717243200000)},
+			},
+		}
+	}
+
+	for _, test := range []struct {
+		description string
+		event       *events.Message
+		want        Reaction
+	}{
+		{
+			description: "I react in a DM",
+			event:       reaction(other, me, "👍", &waCommon.MessageKey{ID: proto.String("a"), RemoteJID: proto.String(other.String())}),
+			want:        Reaction{Target: MessageRef{Chat: other, Sender: other, ID: "a"}, Emoji: "👍", Reactor: me},
+		},
+		{
+			description: "they react to my message in a DM",
+			event:       reaction(other, other, "❤️", &waCommon.MessageKey{ID: proto.String("b"), RemoteJID: proto.String(me.String())}),
+			want:        Reaction{Target: MessageRef{Chat: other, ID: "b", FromMe: true}, Emoji: "❤️", Reactor: other},
+		},
+		{
+			description: "they react to their own message in a DM",
+			event:       reaction(other, other, "😂", &waCommon.MessageKey{ID: proto.String("c"), FromMe: proto.Bool(true), RemoteJID: proto.String(me.String())}),
+			want:        Reaction{Target: MessageRef{Chat: other, Sender: other, ID: "c"}, Emoji: "😂", Reactor: other},
+		},
+		{
+			description: "they remove their reaction in a DM",
+			event:       reaction(other, other, "", &waCommon.MessageKey{ID: proto.String("b"), RemoteJID: proto.String(me.String())}),
+			want:        Reaction{Target: MessageRef{Chat: other, ID: "b", FromMe: true}, Removed: true, Reactor: other},
+		},
+		{
+			description: "I react in a group",
+			event:       reaction(group, me, "👍", &waCommon.MessageKey{ID: proto.String("d"), RemoteJID: proto.String(group.String()), Participant: proto.String(other.String())}),
+			want:        Reaction{Target: MessageRef{Chat: group, Sender: other, ID: "d"}, Emoji: "👍", Reactor: me},
+		},
+		{
+			description: "they react to someone else in a group",
+			event:       reaction(group, other, "🎉", &waCommon.MessageKey{ID: proto.String("e"), RemoteJID: proto.String(group.String()), Participant: proto.String(third.String())}),
+			want:        Reaction{Target: MessageRef{Chat: group, Sender: third, ID: "e"}, Emoji: "🎉", Reactor: other},
+		},
+		{
+			description: "they react to my message in a group",
+			event:       reaction(group, other, "🎉", &waCommon.MessageKey{ID: proto.String("f"), RemoteJID: proto.String(group.String()), Participant: proto.String(me.String())}),
+			want:        Reaction{Target: MessageRef{Chat: group, Sender: me, ID: "f"}, Emoji: "🎉", Reactor: other},
+		},
+		{
+			description: "I react to my own message in a group",
+			event:       reaction(group, me, "✅", &waCommon.MessageKey{ID: proto.String("g"), FromMe: proto.Bool(true), RemoteJID: proto.String(group.String())}),
+			want:        Reaction{Target: MessageRef{Chat: group, Sender: me, ID: "g", FromMe: true}, Emoji: "✅", Reactor: me},
+		},
+	} {
+		got, ok := AsReaction(test.event)
+		if !ok {
+			t.Errorf("%v: AsReaction(_) = _, false; want true", test.description)
+			continue
+		}
+		if got.Target != test.want.Target || got.Emoji != test.want.Emoji || got.Removed != test.want.Removed || got.Reactor != test.want.Reactor {
+			t.Errorf("%v: AsReaction(_) = %+v, want %+v", test.description, got, test.want)
+		}
+		if got.Timestamp.UnixMilli() != 1717243200000 || got.Event != test.event {
+			t.Errorf("%v: AsReaction(_) has timestamp %v and event %p, want the sender's timestamp and %p", test.description, got.Timestamp, got.Event, test.event)
+		}
+	}
+
+	if _, ok := AsReaction(&events.Message{Message: &waE2E.Message{Conversation: proto.String("hi")}}); ok {
+		t.Errorf("AsReaction(text) = _, true; want false")
+	}
+}
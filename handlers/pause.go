@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DefaultPauseLimit is the number of events that a paused dispatcher buffers, unless set with
+// SetPauseLimit.
+const DefaultPauseLimit = 10000
+
+// Pause stops running handlers, e.g. during a database migration, without losing events: until
+// Resume, Dispatch buffers the events and returns nil. Events that can't be dispatched still fail
+// with UnknownEvent. At most the pause limit of events are buffered (see SetPauseLimit); beyond
+// that, the oldest are dropped. Pausing while paused does nothing. Close doesn't deliver the
+// buffered events, so Resume first.
+func (d *Dispatcher) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.paused = true
+}
+
+// Pause pauses the default dispatcher, see Dispatcher.Pause.
+func Pause() {
+	defaultDispatcher.Pause()
+}
+
+// SetPauseLimit sets the number of events that are buffered while paused; zero or less is
+// DefaultPauseLimit.
+func (d *Dispatcher) SetPauseLimit(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pauseMax = n
+	d.trimPaused()
+}
+
+// SetPauseLimit sets the pause limit of the default dispatcher, see Dispatcher.SetPauseLimit.
+func SetPauseLimit(n int) {
+	defaultDispatcher.SetPauseLimit(n)
+}
+
+// trimPaused drops the oldest buffered events beyond the limit. The caller holds d.mu.
+func (d *Dispatcher) trimPaused() {
+	limit := d.pauseMax
+	if limit <= 0 {
+		limit = DefaultPauseLimit
+	}
+	if len(d.pauseBuf) > limit {
+		d.pauseBuf = append([]interface{}(nil), d.pauseBuf[len(d.pauseBuf)-limit:]...)
+	}
+}
+
+// buffer buffers an event when paused, and returns whether it did.
+func (d *Dispatcher) buffer(evt interface{}) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.paused {
+		return false
+	}
+	d.pauseBuf = append(d.pauseBuf, evt)
+	d.trimPaused()
+	return true
+}
+
+// Buffered returns the number of events that are buffered while paused, see Pause.
+func (d *Dispatcher) Buffered() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return len(d.pauseBuf)
+}
+
+// Buffered returns the number of events that the default dispatcher buffers, see
+// Dispatcher.Buffered.
+func Buffered() int {
+	return defaultDispatcher.Buffered()
+}
+
+// Resume dispatches the buffered events in the order in which they came in, and then returns to
+// dispatching right away. Events that come in during the replay are buffered behind the others,
+// so that the order holds. The buffered events are dispatched without the contexts that they came
+// with. The errors of their dispatches are joined, each stating the event type. Resuming while
+// not paused does nothing.
+func (d *Dispatcher) Resume() error {
+	d.resuming.Lock()
+	defer d.resuming.Unlock()
+
+	var errs []error
+	for {
+		d.mu.Lock()
+		buf, timeout := d.pauseBuf, d.timeout
+		d.pauseBuf = nil
+		if len(buf) == 0 {
+			d.paused = false
+			d.mu.Unlock()
+			return errors.Join(errs...)
+		}
+		d.mu.Unlock()
+
+		for _, evt := range buf {
+			if err := d.dispatchCtx(context.Background(), evt, timeout); err != nil {
+				t, _ := EventTypeOf(evt)
+				errs = append(errs, fmt.Errorf("%v: %w", t, err))
+			}
+		}
+	}
+}
+
+// Resume resumes the default dispatcher, see Dispatcher.Resume.
+func Resume() error {
+	return defaultDispatcher.Resume()
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestPause(t *testing.T) {
+	d := New()
+	var got []string
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		got = append(got, ev.(*events.Message).Info.ID)
+		return nil
+	}))
+
+	if err := d.Resume(); err != nil { // not paused: nothing happens
+		t.Errorf("Resume() = %v, need nil error", err)
+	}
+	d.Pause()
+	d.Pause() // does nothing
+	for i := 0; i < 10; i++ {
+		if err := d.Dispatch(message(fmt.Sprint(i))); err != nil {
+			t.Errorf("Dispatch(%v) = %v, need nil error while paused", i, err)
+		}
+	}
+	if err := d.Dispatch(42); err == nil || err.Type != UnknownEvent {
+		t.Errorf("Dispatch(42) = %v, want UnknownEvent while paused", err)
+	}
+	if len(got) > 0 || d.Buffered() != 10 {
+		t.Errorf("while paused, handler saw %v and %v are buffered, want nothing and 10", got, d.Buffered())
+	}
+
+	if err := d.Resume(); err != nil {
+		t.Errorf("Resume() = %v, need nil error", err)
+	}
+	if want := "[0 1 2 3 4 5 6 7 8 9]"; fmt.Sprint(got) != want || d.Buffered() != 0 {
+		t.Errorf("after Resume, handler saw %v with %v buffered, want %v and none", got, d.Buffered(), want)
+	}
+
+	got = nil
+	d.Dispatch(message("10"))
+	if want := "[10]"; fmt.Sprint(got) != want {
+		t.Errorf("after Resume, handler saw %v, want %v right away", got, want)
+	}
+}
+
+func TestPauseLimit(t *testing.T) {
+	d := New()
+	d.SetPauseLimit(3)
+	d.Pause()
+	for i := 0; i < 5; i++ {
+		d.Dispatch(message(fmt.Sprint(i)))
+	}
+	d.Dispatch(&events.Presence{}) // no handler
+	if got := d.Buffered(); got != 3 {
+		t.Errorf("Buffered() = %v, want 3", got)
+	}
+	var got []string
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		got = append(got, ev.(*events.Message).Info.ID)
+		return nil
+	}))
+	err := d.Resume()
+	if want := "[3 4]"; fmt.Sprint(got) != want {
+		t.Errorf("after Resume, handler saw %v, want the newest %v", got, want)
+	}
+	if err == nil {
+		t.Errorf("Resume() = nil, want the NoHandlerFound of the Presence event")
+	}
+}
+
+// TestPauseResumeDuringReplay checks that events that come in while replaying wait for the
+// replay.
+func TestPauseResumeDuringReplay(t *testing.T) {
+	d := New()
+	var got []string
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		id := ev.(*events.Message).Info.ID
+		got = append(got, id)
+		if id == "0" {
+			d.Dispatch(message("late")) // during the replay
+		}
+		return nil
+	}))
+	d.Pause()
+	d.Dispatch(message("0"))
+	d.Dispatch(message("1"))
+	d.Resume()
+	if want := "[0 1 late]"; fmt.Sprint(got) != want {
+		t.Errorf("handler saw %v, want %v", got, want)
+	}
+}
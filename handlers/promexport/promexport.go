@@ -0,0 +1,92 @@
+// Package promexport exports the activity of a handlers.Dispatcher as a prometheus.Collector,
+// for programs that already serve metrics with the Prometheus client library. It is a module of
+// its own, so that the client library isn't a dependency of package handlers. For an exporter
+// without the client library, see package metrics.
+//
+// The metric names and labels are:
+//
+//	whatsmeow_events_total{type, result}         counter    dispatched events; result is "ok",
+//	                                                        "no_handler", "handler_failed",
+//	                                                        "handler_panicked" or
+//	                                                        "unknown_event" (with type "")
+//	whatsmeow_handler_duration_seconds{type}     histogram  time taken by the handlers of an event
+package promexport
+
+import (
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector collects the metrics of a dispatcher. The zero value isn't usable, use New.
+type Collector struct {
+	events   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// New returns a collector for a dispatcher. It adds a dispatch hook to the dispatcher, so call it
+// once per dispatcher, since hooks can't be removed. The histogram has the buckets of package
+// metrics.
+//
+//	prometheus.MustRegister(promexport.New(d))
+func New(d *handlers.Dispatcher) *Collector {
+	c := newCollector()
+	d.AddDispatchHook(c.observe)
+	return c
+}
+
+// NewDefault returns a collector for the default dispatcher of package handlers, see New.
+func NewDefault() *Collector {
+	c := newCollector()
+	handlers.AddDispatchHook(c.observe)
+	return c
+}
+
+func newCollector() *Collector {
+	return &Collector{
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "whatsmeow_events_total",
+			Help: "Dispatched events.",
+		}, []string{"type", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "whatsmeow_handler_duration_seconds",
+			Help:    "Time taken by the handlers of an event.",
+			Buckets: metrics.Buckets,
+		}, []string{"type"}),
+	}
+}
+
+func (c *Collector) observe(t handlers.EventType, d time.Duration, err *handlers.DispatchError) {
+	result := "ok"
+	if err != nil {
+		switch err.Type {
+		case handlers.NoHandlerFound:
+			result = "no_handler"
+		case handlers.HandlerFailed:
+			result = "handler_failed"
+		case handlers.HandlerPanicked:
+			result = "handler_panicked"
+		case handlers.UnknownEvent:
+			// The event has no type, and no handlers ran.
+			c.events.WithLabelValues("", "unknown_event").Inc()
+			return
+		}
+	}
+	c.events.WithLabelValues(t.String(), result).Inc()
+	c.duration.WithLabelValues(t.String()).Observe(d.Seconds())
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.events.Describe(ch)
+	c.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.events.Collect(ch)
+	c.duration.Collect(ch)
+}
@@ -0,0 +1,72 @@
+package promexport
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+type handlerFunc func(ev interface{}) error
+
+func (f handlerFunc) Handle(ev interface{}) error { return f(ev) }
+
+func TestCollector(t *testing.T) {
+	d := handlers.New()
+	d.Register(handlers.Message, handlerFunc(func(ev interface{}) error { return nil }))
+	d.Register(handlers.Receipt, handlerFunc(func(ev interface{}) error { return errors.New("fail") }))
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(New(d)); err != nil {
+		t.Fatalf("Register(_) = %v, need nil error", err)
+	}
+	for _, evt := range []interface{}{
+		&events.Message{}, &events.Message{}, &events.Receipt{}, &events.Picture{}, &struct{}{},
+	} {
+		d.Dispatch(evt)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() = _, %v, need nil error", err)
+	}
+	got := map[string]float64{} // series to value or sample count
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			series := mf.GetName() + "{"
+			for i, l := range m.GetLabel() {
+				if i > 0 {
+					series += ","
+				}
+				series += l.GetName() + "=" + l.GetValue()
+			}
+			series += "}"
+			switch {
+			case m.GetCounter() != nil:
+				got[series] = m.GetCounter().GetValue()
+			case m.GetHistogram() != nil:
+				got[series] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	for _, test := range []struct {
+		series string
+		want   float64
+	}{
+		{"whatsmeow_events_total{result=ok,type=Message}", 2},
+		{"whatsmeow_events_total{result=handler_failed,type=Receipt}", 1},
+		{"whatsmeow_events_total{result=no_handler,type=Picture}", 1},
+		{"whatsmeow_events_total{result=unknown_event,type=}", 1},
+		{"whatsmeow_handler_duration_seconds{type=Message}", 2},
+		{"whatsmeow_handler_duration_seconds{type=Receipt}", 1},
+	} {
+		if v, ok := got[test.series]; !ok || v != test.want {
+			t.Errorf("%v = %v (present: %v), want %v", test.series, v, ok, test.want)
+		}
+	}
+	if len(got) != 7 {
+		t.Errorf("gathered %v series, want 7: %v", len(got), got)
+	}
+}
@@ -0,0 +1,46 @@
+package publish
+
+import (
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/nats-io/nats.go"
+)
+
+// natsPublisher publishes on a NATS connection.
+type natsPublisher struct {
+	nc *nats.Conn
+}
+
+// NATS returns a publisher on a NATS connection. Like nats.Conn.Publish, publishing only buffers
+// the message; failures to deliver it later are reported to the connection's error handler.
+func NATS(nc *nats.Conn) Publisher {
+	return natsPublisher{nc: nc}
+}
+
+func (p natsPublisher) Publish(subject string, payload []byte) error {
+	return p.nc.Publish(subject, payload)
+}
+
+// mqttPublisher publishes with an MQTT client.
+type mqttPublisher struct {
+	c       mqtt.Client
+	qos     byte
+	timeout time.Duration
+}
+
+// MQTT returns a publisher with an MQTT client, which publishes at a QoS level (0, 1 or 2) and
+// waits up to `timeout` for the publish to complete. MQTT separates the levels of topics with
+// slashes, so consider Subject("wa/events/{type}").
+func MQTT(c mqtt.Client, qos byte, timeout time.Duration) Publisher {
+	return mqttPublisher{c: c, qos: qos, timeout: timeout}
+}
+
+func (p mqttPublisher) Publish(subject string, payload []byte) error {
+	tok := p.c.Publish(subject, p.qos, false, payload)
+	if !tok.WaitTimeout(p.timeout) {
+		return fmt.Errorf("publishing on %q timed out after %v", subject, p.timeout)
+	}
+	return tok.Error()
+}
@@ -0,0 +1,32 @@
+module github.com/KarelKubat/whatsmeow/handlers/publish
+
+go 1.22
+
+require (
+	github.com/KarelKubat/whatsmeow v0.0.0
+	github.com/eclipse/paho.mqtt.golang v1.4.3
+	github.com/nats-io/nats.go v1.37.0
+	go.mau.fi/whatsmeow v0.0.0-20240625083845-6acab596dd8c
+)
+
+require (
+	filippo.io/edwards25519 v1.0.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/websocket v1.5.0 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/nats-io/nkeys v0.4.7 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/rs/zerolog v1.32.0 // indirect
+	go.mau.fi/libsignal v0.1.0 // indirect
+	go.mau.fi/util v0.4.1 // indirect
+	golang.org/x/crypto v0.23.0 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/time v0.5.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
+
+replace github.com/KarelKubat/whatsmeow => ../..
@@ -0,0 +1,138 @@
+// Package publish is a handler that publishes events to a message bus, such as NATS or MQTT, for
+// services that consume WhatsApp events from the bus. It is a module of its own, so that the
+// clients of the buses aren't dependencies of package handlers. For an HTTP service, see
+// handlers.NewWebhookHandler.
+//
+// By default, an event is published as its JSON, with the subject "wa.events." and the lower-case
+// name of its event type, e.g. "wa.events.message".
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+)
+
+// Defaults of a handler, unless set with its options.
+const (
+	DefaultSubject  = "wa.events.{type}"
+	DefaultAttempts = 3
+	DefaultBackoff  = 100 * time.Millisecond
+)
+
+// Publisher publishes a payload on a bus. NATS and MQTT return one.
+type Publisher interface {
+	Publish(subject string, payload []byte) error
+}
+
+// Option configures a handler, see New.
+type Option func(*Handler)
+
+// Subject sets the pattern of the subjects, in which "{type}" stands for the lower-case name of
+// the event type, e.g. "wa/events/{type}" for MQTT.
+func Subject(pattern string) Option {
+	return func(h *Handler) {
+		h.subject = func(t handlers.EventType) string {
+			return strings.ReplaceAll(pattern, "{type}", strings.ToLower(t.String()))
+		}
+	}
+}
+
+// SubjectFunc sets the function that returns the subject of an event type.
+func SubjectFunc(f func(t handlers.EventType) string) Option {
+	return func(h *Handler) { h.subject = f }
+}
+
+// Encoder sets the function that serializes an event into the payload, e.g. to add an envelope
+// or to use protobuf.
+func Encoder(f func(t handlers.EventType, ev interface{}) ([]byte, error)) Option {
+	return func(h *Handler) { h.encode = f }
+}
+
+// Retries sets the number of attempts to publish in all, and the backoff before the first retry,
+// which doubles at every retry.
+func Retries(attempts int, backoff time.Duration) Option {
+	return func(h *Handler) { h.attempts, h.backoff = attempts, backoff }
+}
+
+// Handler publishes the events that it gets. Use New.
+type Handler struct {
+	pub      Publisher
+	subject  func(t handlers.EventType) string
+	encode   func(t handlers.EventType, ev interface{}) ([]byte, error)
+	attempts int
+	backoff  time.Duration
+}
+
+// New returns a handler that publishes events with `pub`, for any event type, e.g. as a
+// catch-all. Failing publishes are retried; when the last attempt fails, the handler fails.
+//
+//	nc, err := nats.Connect(nats.DefaultURL)
+//	...
+//	handlers.Register(handlers.AnyEvent, publish.New(publish.NATS(nc)))
+func New(pub Publisher, opts ...Option) *Handler {
+	h := &Handler{
+		pub: pub,
+		encode: func(_ handlers.EventType, ev interface{}) ([]byte, error) {
+			return json.Marshal(ev)
+		},
+		attempts: DefaultAttempts,
+		backoff:  DefaultBackoff,
+	}
+	Subject(DefaultSubject)(h)
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+// Name implements handlers.Named.
+func (h *Handler) Name() string {
+	return "publish.Handler"
+}
+
+// Handle implements handlers.handler for events of any type.
+func (h *Handler) Handle(ev interface{}) error {
+	return h.HandleCtx(context.Background(), ev)
+}
+
+// HandleCtx implements handlers.ContextHandler, so that derived events are published under their
+// own type, and the retries stop with the dispatch.
+func (h *Handler) HandleCtx(ctx context.Context, ev interface{}) error {
+	t, ok := handlers.EventTypeFromContext(ctx)
+	if !ok {
+		t, _ = handlers.EventTypeOf(ev)
+	}
+	payload, err := h.encode(t, ev)
+	if err != nil {
+		return fmt.Errorf("publish.Handler: %v: %w", t, err)
+	}
+	subject := h.subject(t)
+	delay := h.backoff
+	for i := 1; ; i++ {
+		err = h.pub.Publish(subject, payload)
+		if err == nil {
+			return nil
+		}
+		if i >= h.attempts || wait(ctx, delay) != nil {
+			return fmt.Errorf("publish.Handler: %v on %q: %w", t, subject, err)
+		}
+		delay *= 2
+	}
+}
+
+// wait waits for a delay, or until the context is done.
+func wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,186 @@
+package publish
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// published is a message on the fake bus.
+type published struct {
+	subject string
+	payload []byte
+}
+
+// fakeBus is an in-memory Publisher that fails the first `failures` publishes.
+type fakeBus struct {
+	failures int
+	attempts int
+	got      []published
+}
+
+func (b *fakeBus) Publish(subject string, payload []byte) error {
+	b.attempts++
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("bus unavailable")
+	}
+	b.got = append(b.got, published{subject, payload})
+	return nil
+}
+
+func message(id string) *events.Message {
+	return &events.Message{Info: types.MessageInfo{ID: id}}
+}
+
+func TestHandler(t *testing.T) {
+	for _, test := range []struct {
+		description  string
+		opts         []Option
+		failures     int
+		evt          interface{}
+		wantSubject  string
+		wantPayload  string
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			description:  "defaults",
+			evt:          message("M1"),
+			wantSubject:  "wa.events.message",
+			wantPayload:  `"ID":"M1"`,
+			wantAttempts: 1,
+		},
+		{
+			description:  "subject pattern",
+			opts:         []Option{Subject("wa/{type}/in")},
+			evt:          &events.Connected{},
+			wantSubject:  "wa/connected/in",
+			wantPayload:  `{}`,
+			wantAttempts: 1,
+		},
+		{
+			description: "subject func and encoder",
+			opts: []Option{
+				SubjectFunc(func(t handlers.EventType) string { return "bot." + t.String() }),
+				Encoder(func(t handlers.EventType, ev interface{}) ([]byte, error) {
+					return []byte(t.String() + " " + ev.(*events.Message).Info.ID), nil
+				}),
+			},
+			evt:          message("M2"),
+			wantSubject:  "bot.Message",
+			wantPayload:  "Message M2",
+			wantAttempts: 1,
+		},
+		{
+			description:  "retried",
+			opts:         []Option{Retries(3, time.Millisecond)},
+			failures:     2,
+			evt:          message("M3"),
+			wantSubject:  "wa.events.message",
+			wantPayload:  `"ID":"M3"`,
+			wantAttempts: 3,
+		},
+		{
+			description:  "failing",
+			opts:         []Option{Retries(2, time.Millisecond)},
+			failures:     2,
+			evt:          message("M4"),
+			wantAttempts: 2,
+			wantErr:      true,
+		},
+	} {
+		bus := &fakeBus{failures: test.failures}
+		d := handlers.New()
+		d.Register(handlers.AnyEvent, New(bus, test.opts...))
+
+		err := d.Dispatch(test.evt)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%v: Dispatch(_) = %v, want error: %v", test.description, err, test.wantErr)
+		}
+		if bus.attempts != test.wantAttempts {
+			t.Errorf("%v: %d attempts to publish, want %d", test.description, bus.attempts, test.wantAttempts)
+		}
+		if test.wantErr {
+			if len(bus.got) != 0 {
+				t.Errorf("%v: published %v, want nothing", test.description, bus.got)
+			}
+			continue
+		}
+		if len(bus.got) != 1 {
+			t.Fatalf("%v: published %d messages, want 1", test.description, len(bus.got))
+		}
+		if got := bus.got[0].subject; got != test.wantSubject {
+			t.Errorf("%v: subject %q, want %q", test.description, got, test.wantSubject)
+		}
+		if got := string(bus.got[0].payload); !strings.Contains(got, test.wantPayload) {
+			t.Errorf("%v: payload %s, want it to contain %s", test.description, got, test.wantPayload)
+		}
+	}
+}
+
+func TestHandlerPayload(t *testing.T) {
+	bus := &fakeBus{}
+	d := handlers.New()
+	d.Register(handlers.Message, New(bus))
+	if err := d.Dispatch(message("M1")); err != nil {
+		t.Fatalf("Dispatch(_) = %v, need nil error", err)
+	}
+	var m events.Message
+	if err := json.Unmarshal(bus.got[0].payload, &m); err != nil || m.Info.ID != "M1" {
+		t.Errorf("json.Unmarshal(%s) = %v, want message M1", bus.got[0].payload, err)
+	}
+}
+
+// fakeToken is a completed MQTT token, or one that never completes.
+type fakeToken struct {
+	mqtt.Token
+	done bool
+	err  error
+}
+
+func (t fakeToken) WaitTimeout(time.Duration) bool { return t.done }
+func (t fakeToken) Error() error                   { return t.err }
+
+// fakeClient is an MQTT client that records what it publishes.
+type fakeClient struct {
+	mqtt.Client
+	tok    fakeToken
+	topic  string
+	qos    byte
+	stored interface{}
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.topic, c.qos, c.stored = topic, qos, payload
+	return c.tok
+}
+
+func TestMQTT(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		tok         fakeToken
+		wantErr     bool
+	}{
+		{description: "published", tok: fakeToken{done: true}},
+		{description: "failed", tok: fakeToken{done: true, err: errors.New("not connected")}, wantErr: true},
+		{description: "timed out", tok: fakeToken{}, wantErr: true},
+	} {
+		c := &fakeClient{tok: test.tok}
+		err := MQTT(c, 1, time.Second).Publish("wa/events/message", []byte("payload"))
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%v: Publish(_) = %v, want error: %v", test.description, err, test.wantErr)
+		}
+		if c.topic != "wa/events/message" || c.qos != 1 || string(c.stored.([]byte)) != "payload" {
+			t.Errorf("%v: published %q at QoS %d: %v", test.description, c.topic, c.qos, c.stored)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// now is swapped in tests.
+var now = time.Now
+
+// rateLimited wraps a handler that is invoked at most at a rate.
+type rateLimited struct {
+	limiter *rate.Limiter
+	onDrop  func(evt interface{})
+	h       handler
+
+	// now is the clock, taken from the package's when the handler is registered. A dispatch
+	// that timed out leaves its handler running, and that must not read the package's clock
+	// while a test swaps it.
+	now func() time.Time
+}
+
+func (r *rateLimited) Handle(ev interface{}) error {
+	return r.HandleCtx(context.Background(), ev)
+}
+
+func (r *rateLimited) HandleCtx(ctx context.Context, ev interface{}) error {
+	if r.onDrop != nil {
+		if !r.limiter.AllowN(r.now(), 1) {
+			r.onDrop(ev)
+			return nil
+		}
+	} else if err := r.wait(ctx); err != nil {
+		return err
+	}
+	return invoke(ctx, r.h, ev)
+}
+
+// wait waits for a token, or until the context is done.
+func (r *rateLimited) wait(ctx context.Context) error {
+	t := r.now()
+	res := r.limiter.ReserveN(t, 1)
+	if !res.OK() {
+		return fmt.Errorf("handlers.RegisterRateLimited: burst %d allows no events", r.limiter.Burst())
+	}
+	delay := res.DelayFrom(t)
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		res.CancelAt(r.now()) // give the token back
+		return ctx.Err()
+	}
+}
+
+// RegisterRateLimited registers a handler that is invoked for at most `limit` events per second,
+// with bursts of up to `burst` events (see `rate.NewLimiter`), e.g. to spare a downstream API.
+// The events over the limit are either dropped or delayed.
+//
+// With an `onDrop` func, they are dropped: the handler isn't invoked, and onDrop is invoked
+// instead. A dropped event isn't a failure.
+//
+// Without one (nil), they are delayed until the rate allows them. The delay holds up the
+// dispatch, and the handlers after this one, so consider SetTimeout or Lanes. When the dispatch
+// context is done first, the event fails with the context error.
+//
+//	d.RegisterRateLimited(Presence, h, 5, 1, func(evt interface{}) { dropped.Add(1) })
+func (d *Dispatcher) RegisterRateLimited(t EventType, h handler, limit rate.Limit, burst int, onDrop func(evt interface{})) {
+	d.Register(t, &rateLimited{
+		limiter: rate.NewLimiter(limit, burst),
+		onDrop:  onDrop,
+		h:       h,
+		now:     now,
+	})
+}
+
+// RegisterRateLimited registers a rate-limited handler with the default dispatcher, see
+// Dispatcher.RegisterRateLimited.
+func RegisterRateLimited(t EventType, h handler, limit rate.Limit, burst int, onDrop func(evt interface{})) {
+	defaultDispatcher.RegisterRateLimited(t, h, limit, burst, onDrop)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// withFakeClock swaps in a clock for `now` that only moves when the test says so.
+func withFakeClock(t *testing.T) *time.Time {
+	c := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now
+	now = func() time.Time { return c }
+	t.Cleanup(func() { now = old })
+	return &c
+}
+
+func TestRateLimitedDrop(t *testing.T) {
+	clock := withFakeClock(t)
+	d := New()
+	var handled, dropped int
+	d.RegisterRateLimited(Presence, handlerFunc(func(ev interface{}) error {
+		handled++
+		return nil
+	}), 1, 2, func(evt interface{}) { dropped++ })
+
+	for _, test := range []struct {
+		description string
+		advance     time.Duration
+		events      int
+		wantHandled int
+		wantDropped int
+	}{
+		{"burst", 0, 5, 2, 3},
+		{"half a token later", 500 * time.Millisecond, 1, 2, 4},
+		{"a token later", 500 * time.Millisecond, 2, 3, 5},
+		{"two tokens later", 2 * time.Second, 3, 5, 6},
+	} {
+		*clock = clock.Add(test.advance)
+		for i := 0; i < test.events; i++ {
+			if err := d.Dispatch(&events.Presence{}); err != nil {
+				t.Errorf("%v: Dispatch(_) = %v, need nil error", test.description, err)
+			}
+		}
+		if handled != test.wantHandled || dropped != test.wantDropped {
+			t.Errorf("%v: handled %v and dropped %v, want %v and %v",
+				test.description, handled, dropped, test.wantHandled, test.wantDropped)
+		}
+	}
+}
+
+func TestRateLimitedDelay(t *testing.T) {
+	withFakeClock(t)
+	d := New()
+	handled := 0
+	d.RegisterRateLimited(Presence, handlerFunc(func(ev interface{}) error {
+		handled++
+		return nil
+	}), 50, 1, nil)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := d.Dispatch(&events.Presence{}); err != nil {
+			t.Errorf("Dispatch(_) = %v, need nil error", err)
+		}
+	}
+	// The clock stands still, so the second event waits 20ms and the third 40ms.
+	if took := time.Since(start); took < 60*time.Millisecond {
+		t.Errorf("3 events at 50/s with a burst of 1 took %v, want at least 60ms", took)
+	}
+	if handled != 3 {
+		t.Errorf("handled %v events, want 3", handled)
+	}
+}
+
+func TestRateLimitedDelayCancel(t *testing.T) {
+	withFakeClock(t)
+	d := New()
+	handled := 0
+	d.RegisterRateLimited(Presence, handlerFunc(func(ev interface{}) error {
+		handled++
+		return nil
+	}), 1, 1, nil)
+	d.Dispatch(&events.Presence{}) // takes the token
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := d.DispatchCtx(ctx, &events.Presence{})
+	if err == nil || err.Type != HandlerFailed || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DispatchCtx(_) = %v, want HandlerFailed with DeadlineExceeded", err)
+	}
+	if handled != 1 {
+		t.Errorf("handled %v events, want 1", handled)
+	}
+}
+
+func TestRateLimitedZeroBurst(t *testing.T) {
+	d := New()
+	d.RegisterRateLimited(Presence, handlerFunc(func(ev interface{}) error { return nil }), 1, 0, nil)
+	if err := d.Dispatch(&events.Presence{}); err == nil || err.Type != HandlerFailed {
+		t.Errorf("Dispatch(_) = %v, want HandlerFailed", err)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ReceiptEventType returns the synthetic event type of a receipt's kind: ReceiptDelivered,
+// ReceiptRead, ReceiptPlayed or ReceiptRetry. The receipts of my own reads and plays on other
+// devices count as reads and plays. Other kinds, such as sender or server-error receipts, have no
+// synthetic type.
+//
+// Receipts are dispatched to the Receipt handlers, and then to the handlers of their kind, as the
+// same *events.Receipt. So a handler for ReceiptRead needs no switch on `evt.Type`, and
+// Receipt handlers still see all receipts, including those of unrecognized kinds. Since the
+// event is the same, catch-alls see it once, as a Receipt; and when there are no handlers for
+// its kind, middleware and dispatch hooks also see it only as a Receipt.
+func ReceiptEventType(r *events.Receipt) (EventType, bool) {
+	switch r.Type {
+	case types.ReceiptTypeDelivered:
+		return ReceiptDelivered, true
+	case types.ReceiptTypeRead, types.ReceiptTypeReadSelf:
+		return ReceiptRead, true
+	case types.ReceiptTypePlayed, types.ReceiptTypePlayedSelf:
+		return ReceiptPlayed, true
+	case types.ReceiptTypeRetry:
+		return ReceiptRetry, true
+	}
+	return firstEventType, false
+}
+
+// dispatchReceipt dispatches a Receipt event, and the synthetic event of its kind.
+func (d *Dispatcher) dispatchReceipt(ctx context.Context, r *events.Receipt) *DispatchError {
+	if t, ok := ReceiptEventType(r); ok && (d.HasHandler(t) || d.hasDefault(t)) {
+		return d.dispatchDerived(ctx, Receipt, r, t, r)
+	}
+	return d.dispatch(ctx, Receipt, r)
+}
+
+// isReceiptKind returns whether an event type is the synthetic type of a receipt kind.
+func isReceiptKind(t EventType) bool {
+	return t >= ReceiptDelivered && t <= ReceiptRetry
+}
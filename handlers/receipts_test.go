@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestReceiptKinds(t *testing.T) {
+	d := New()
+	var got []EventType
+	for _, et := range []EventType{Receipt, ReceiptDelivered, ReceiptRead, ReceiptPlayed, ReceiptRetry} {
+		et := et
+		d.Register(et, handlerFunc(func(ev interface{}) error {
+			got = append(got, et)
+			return nil
+		}))
+	}
+
+	for _, test := range []struct {
+		tp   types.ReceiptType
+		want EventType
+	}{
+		{types.ReceiptTypeDelivered, ReceiptDelivered},
+		{types.ReceiptTypeRead, ReceiptRead},
+		{types.ReceiptTypeReadSelf, ReceiptRead},
+		{types.ReceiptTypePlayed, ReceiptPlayed},
+		{types.ReceiptTypePlayedSelf, ReceiptPlayed},
+		{types.ReceiptTypeRetry, ReceiptRetry},
+		{types.ReceiptTypeSender, firstEventType}, // only the Receipt handler
+		{types.ReceiptTypeServerError, firstEventType},
+	} {
+		got = nil
+		if err := d.Dispatch(&events.Receipt{Type: test.tp}); err != nil {
+			t.Errorf("Dispatch(%q receipt) = %v, need nil error", test.tp, err)
+		}
+		want := []EventType{Receipt}
+		if test.want != firstEventType {
+			want = append(want, test.want)
+		}
+		if len(got) != len(want) || got[0] != want[0] || got[len(got)-1] != want[len(want)-1] {
+			t.Errorf("Dispatch(%q receipt) reached %v, want %v", test.tp, got, want)
+		}
+	}
+}
+
+// TestReceiptKindsWithoutGenericHandler checks that a receipt kind handler suffices: there is no
+// NoHandlerFound for the missing Receipt handler.
+func TestReceiptKindsWithoutGenericHandler(t *testing.T) {
+	d := New()
+	var seen *events.Receipt
+	d.Register(ReceiptRead, handlerFunc(func(ev interface{}) error {
+		seen = ev.(*events.Receipt)
+		return nil
+	}))
+	r := &events.Receipt{Type: types.ReceiptTypeRead}
+	if err := d.Dispatch(r); err != nil {
+		t.Errorf("Dispatch(read receipt) = %v, need nil error", err)
+	}
+	if seen != r {
+		t.Errorf("ReceiptRead handler saw %v, want %v", seen, r)
+	}
+	if err := d.Dispatch(&events.Receipt{Type: types.ReceiptTypePlayed}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(played receipt) = %v, want NoHandlerFound", err)
+	}
+}
+
+// TestReceiptKindsCatchAll checks that catch-alls see a receipt once.
+func TestReceiptKindsCatchAll(t *testing.T) {
+	d := New()
+	var seen []string
+	d.Register(AnyEvent, &orderHandler{"all", &seen})
+	d.Register(ReceiptRead, &orderHandler{"read", &seen})
+	if err := d.Dispatch(&events.Receipt{Type: types.ReceiptTypeRead}); err != nil {
+		t.Errorf("Dispatch(read receipt) = %v, need nil error", err)
+	}
+	if got, want := strings.Join(seen, " "), "all read"; got != want {
+		t.Errorf("handlers ran as [%v], want [%v]", got, want)
+	}
+}
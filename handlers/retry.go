@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// retrying wraps a handler that is invoked again when it fails transiently.
+type retrying struct {
+	h         handler
+	attempts  int
+	backoff   time.Duration
+	retryable func(error) bool
+}
+
+func (r *retrying) Handle(ev interface{}) error {
+	return r.HandleCtx(context.Background(), ev)
+}
+
+func (r *retrying) HandleCtx(ctx context.Context, ev interface{}) error {
+	var err error
+	for i := 0; i < r.attempts; i++ {
+		if i > 0 {
+			if werr := r.wait(ctx, i); werr != nil {
+				return err // the context is done, give up with the handler's error
+			}
+		}
+		err = invoke(ctx, r.h, ev)
+		if err == nil || !r.transient(ctx, err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (r *retrying) unwrap() handler { return r.h }
+
+// transient returns whether a failure may be retried.
+func (r *retrying) transient(ctx context.Context, err error) bool {
+	switch {
+	case errors.Is(err, ErrStopPropagation), errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded), ctx.Err() != nil:
+		return false
+	case r.retryable == nil:
+		return true
+	}
+	return r.retryable(err)
+}
+
+// wait waits before retry `i` (from 1): the backoff doubles at every retry, and is jittered
+// between half and all of it, so that handlers that failed together don't retry together.
+func (r *retrying) wait(ctx context.Context, i int) error {
+	delay := r.backoff << (i - 1)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WithRetry wraps a handler that is invoked again when it fails transiently, e.g. when a
+// webhook returns a 503, up to `attempts` invocations in all. Before each retry, it waits
+// `backoff`, doubled at every retry, with jitter. An error is retried when `retryable` says so;
+// a nil `retryable` retries all errors. ErrStopPropagation, and failures after the dispatch
+// context is done, aren't retried. When it gives up, the last error is returned.
+//
+//	d.Register(Message, WithRetry(webhook, 4, 100*time.Millisecond, isUnavailable))
+//
+// The retries hold up the dispatch, and the handlers after this one, so consider SetTimeout or
+// Lanes.
+func WithRetry(h handler, attempts int, backoff time.Duration, retryable func(error) bool) handler {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &retrying{h: h, attempts: attempts, backoff: backoff, retryable: retryable}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	errUnavailable := errors.New("503")
+	errBadRequest := errors.New("400")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, test := range []struct {
+		description string
+		errs        []error // returned by the calls, then nil
+		ctx         context.Context
+		wantCalls   int
+		wantErr     error
+	}{
+		{
+			description: "fails twice, then succeeds",
+			errs:        []error{errUnavailable, errUnavailable},
+			wantCalls:   3,
+		},
+		{
+			description: "fails permanently",
+			errs:        []error{errUnavailable, errUnavailable, errUnavailable, errUnavailable},
+			wantCalls:   3,
+			wantErr:     errUnavailable,
+		},
+		{
+			description: "not retryable",
+			errs:        []error{errBadRequest},
+			wantCalls:   1,
+			wantErr:     errBadRequest,
+		},
+		{
+			description: "stop propagation",
+			errs:        []error{ErrStopPropagation},
+			wantCalls:   1,
+			wantErr:     ErrStopPropagation,
+		},
+		{
+			description: "context done",
+			errs:        []error{errUnavailable},
+			ctx:         cancelled,
+			wantCalls:   1,
+			wantErr:     errUnavailable,
+		},
+	} {
+		calls := 0
+		h := WithRetry(handlerFunc(func(ev interface{}) error {
+			calls++
+			if calls <= len(test.errs) {
+				return test.errs[calls-1]
+			}
+			return nil
+		}), 3, time.Millisecond, func(err error) bool { return err != errBadRequest })
+
+		ctx := test.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if err := invoke(ctx, h, message("M")); !errors.Is(err, test.wantErr) || test.wantErr == nil && err != nil {
+			t.Errorf("%v: HandleCtx(_) = %v, want %v", test.description, err, test.wantErr)
+		}
+		if calls != test.wantCalls {
+			t.Errorf("%v: %d calls, want %d", test.description, calls, test.wantCalls)
+		}
+	}
+}
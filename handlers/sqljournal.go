@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/KarelKubat/whatsmeow/internal/sqlmigrate"
+)
+
+// journalMigrations are the schema of SQLJournal, see sqlmigrate.
+var journalMigrations = []string{
+	`CREATE TABLE event_journal (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		type        TEXT    NOT NULL,
+		data        BLOB    NOT NULL,
+		appended_at INTEGER NOT NULL
+	);`,
+}
+
+// SQLJournal is a Journal in an SQLite database. Events that are marked done are deleted.
+type SQLJournal struct {
+	db *sql.DB
+}
+
+// NewSQLJournal returns a journal in `db`, which must be an SQLite database. The tables are
+// created or migrated when needed.
+func NewSQLJournal(ctx context.Context, db *sql.DB) (*SQLJournal, error) {
+	if err := sqlmigrate.Up(ctx, db, "event_journal_version", journalMigrations); err != nil {
+		return nil, fmt.Errorf("handlers.NewSQLJournal: %w", err)
+	}
+	return &SQLJournal{db: db}, nil
+}
+
+// Append implements Journal.
+func (j *SQLJournal) Append(typ string, data []byte) (int64, error) {
+	res, err := j.db.Exec(`INSERT INTO event_journal (type, data, appended_at) VALUES (?, ?, ?)`,
+		typ, data, now().UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("handlers.SQLJournal.Append: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("handlers.SQLJournal.Append: %w", err)
+	}
+	return id, nil
+}
+
+// MarkDone implements Journal.
+func (j *SQLJournal) MarkDone(id int64) error {
+	if _, err := j.db.Exec(`DELETE FROM event_journal WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("handlers.SQLJournal.MarkDone: %w", err)
+	}
+	return nil
+}
+
+// Pending implements Journal.
+func (j *SQLJournal) Pending() ([]JournalEntry, error) {
+	rows, err := j.db.Query(`SELECT id, type, data FROM event_journal ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("handlers.SQLJournal.Pending: %w", err)
+	}
+	defer rows.Close()
+	var out []JournalEntry
+	for rows.Next() {
+		var e JournalEntry
+		if err := rows.Scan(&e.ID, &e.Type, &e.Data); err != nil {
+			return nil, fmt.Errorf("handlers.SQLJournal.Pending: %w", err)
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("handlers.SQLJournal.Pending: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// StaleOpts configures MaxEventAge.
+type StaleOpts struct {
+	// OnStale is invoked with the events that are dropped, e.g. to persist them. Optional.
+	OnStale func(t EventType, ev interface{})
+
+	// UntilSynced stops the dropping once OfflineSyncCompleted is dispatched, so that the backlog
+	// of a reconnect is dropped, but live events are handled whatever their age.
+	UntilSynced bool
+}
+
+// eventTime returns when the message or receipt of an event was sent, zero when unknown.
+func eventTime(ev interface{}) time.Time {
+	if r, ok := ev.(*events.Receipt); ok {
+		return r.Timestamp
+	}
+	if m := messageOf(ev); m != nil {
+		return m.Info.Timestamp
+	}
+	return time.Time{}
+}
+
+// MaxEventAge returns middleware that drops Message and Receipt events (and the synthetic events
+// derived from them) that are older than `age`, such as the backlog that floods in after a
+// reconnect, so that a bot doesn't reply to day-old messages. Events without a timestamp, and
+// other events, pass through. A dropped event doesn't reach the handlers, and isn't a failure.
+//
+//	d.Use(MaxEventAge(5*time.Minute, StaleOpts{OnStale: archive, UntilSynced: true}))
+func MaxEventAge(age time.Duration, opts StaleOpts) Middleware {
+	var synced atomic.Bool
+	return func(next HandlerFunc) HandlerFunc {
+		return func(t EventType, ev interface{}) error {
+			if t == OfflineSyncCompleted && opts.UntilSynced {
+				synced.Store(true)
+			}
+			ts := eventTime(ev)
+			if synced.Load() || ts.IsZero() || now().Sub(ts) <= age {
+				return next(t, ev)
+			}
+			if opts.OnStale != nil {
+				opts.OnStale(t, ev)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestMaxEventAge(t *testing.T) {
+	clock := withFakeClock(t)
+	aged := func(id string, age time.Duration) *events.Message {
+		m := message(id)
+		m.Info.Timestamp = clock.Add(-age)
+		return m
+	}
+	receipt := &events.Receipt{MessageIDs: []types.MessageID{"R"}, Timestamp: clock.Add(-time.Hour)}
+
+	for _, test := range []struct {
+		description string
+		untilSynced bool
+		want        string
+		wantStale   string
+	}{
+		{
+			description: "always",
+			want:        "fresh untimed OfflineSyncCompleted fresh",
+			wantStale:   "old R old",
+		},
+		{
+			description: "until synced",
+			untilSynced: true,
+			want:        "fresh untimed OfflineSyncCompleted old fresh",
+			wantStale:   "old R",
+		},
+	} {
+		d := New()
+		var stale []string
+		d.Use(MaxEventAge(time.Minute, StaleOpts{
+			OnStale: func(t EventType, ev interface{}) {
+				if r, ok := ev.(*events.Receipt); ok {
+					stale = append(stale, r.MessageIDs[0])
+					return
+				}
+				stale = append(stale, ev.(*events.Message).Info.ID)
+			},
+			UntilSynced: test.untilSynced,
+		}))
+		var handled []string
+		d.Register(AnyEvent, handlerFunc(func(ev interface{}) error {
+			if m, ok := ev.(*events.Message); ok {
+				handled = append(handled, m.Info.ID)
+			} else {
+				handled = append(handled, mustEventType(t, ev).String())
+			}
+			return nil
+		}))
+
+		for _, evt := range []interface{}{
+			aged("fresh", time.Minute), aged("old", time.Hour), message("untimed"), receipt,
+			&events.OfflineSyncCompleted{}, aged("old", time.Hour), aged("fresh", 0),
+		} {
+			if err := d.Dispatch(evt); err != nil {
+				t.Errorf("%v: Dispatch(%T) = %v, need nil error", test.description, evt, err)
+			}
+		}
+		if got := strings.Join(handled, " "); got != test.want {
+			t.Errorf("%v: handled %q, want %q", test.description, got, test.want)
+		}
+		if got := strings.Join(stale, " "); got != test.wantStale {
+			t.Errorf("%v: stale %q, want %q", test.description, got, test.wantStale)
+		}
+	}
+}
+
+// mustEventType returns the type of an event, and fails the test when it has none.
+func mustEventType(t *testing.T, ev interface{}) EventType {
+	tp, ok := EventTypeOf(ev)
+	if !ok {
+		t.Fatalf("EventTypeOf(%T) = _, false, need true", ev)
+	}
+	return tp
+}
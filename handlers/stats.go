@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EventStats are the dispatch statistics of an event type, see Stats.
+type EventStats struct {
+	Dispatched int64 // events of the type
+	Succeeded  int64 // events that all handlers handled
+	Failed     int64 // events with a failing or panicking handler
+	NoHandler  int64 // events without handlers
+	Dropped    int64 // events that subscribers missed, see Subscribe
+	Ignored    int64 // events without handlers that weren't an error, see Ignore
+
+	TotalLatency time.Duration // time taken by the dispatches, including middleware
+	MaxLatency   time.Duration // of the slowest dispatch
+}
+
+// MeanLatency returns the mean time that a dispatch took.
+func (s EventStats) MeanLatency() time.Duration {
+	if s.Dispatched == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Dispatched)
+}
+
+// counters are the atomic counterpart of EventStats. Dispatchers keep them per event type in an
+// array, so recording needs no lock and no allocation.
+type counters struct {
+	dispatched, succeeded, failed, noHandler atomic.Int64
+	dropped, ignored                         atomic.Int64
+	totalNanos, maxNanos                     atomic.Int64
+}
+
+func (c *counters) record(elapsed time.Duration, err *DispatchError) {
+	c.dispatched.Add(1)
+	switch {
+	case err == nil:
+		c.succeeded.Add(1)
+	case err.Type == NoHandlerFound:
+		c.noHandler.Add(1)
+	default:
+		c.failed.Add(1)
+	}
+	ns := int64(elapsed)
+	c.totalNanos.Add(ns)
+	for {
+		cur := c.maxNanos.Load()
+		if ns <= cur || c.maxNanos.CompareAndSwap(cur, ns) {
+			break
+		}
+	}
+}
+
+func (c *counters) snapshot() EventStats {
+	return EventStats{
+		Dispatched:   c.dispatched.Load(),
+		Succeeded:    c.succeeded.Load(),
+		Failed:       c.failed.Load(),
+		NoHandler:    c.noHandler.Load(),
+		Dropped:      c.dropped.Load(),
+		Ignored:      c.ignored.Load(),
+		TotalLatency: time.Duration(c.totalNanos.Load()),
+		MaxLatency:   time.Duration(c.maxNanos.Load()),
+	}
+}
+
+func (c *counters) reset() {
+	for _, v := range []*atomic.Int64{&c.dispatched, &c.succeeded, &c.failed, &c.noHandler, &c.dropped, &c.ignored, &c.totalNanos, &c.maxNanos} {
+		v.Store(0)
+	}
+}
+
+// Stats returns the dispatch statistics of the event types that were dispatched, or that
+// subscribers missed events of, since the dispatcher was created or reset, see ResetStats.
+// Derived synthetic events are counted separately, like for dispatch hooks. Events that can't be
+// dispatched aren't counted. The counters are read one by one, so a snapshot that is taken during
+// dispatching may be off by the events in flight.
+func (d *Dispatcher) Stats() map[EventType]EventStats {
+	stats := map[EventType]EventStats{}
+	for t := range d.stats {
+		if s := d.stats[t].snapshot(); s.Dispatched > 0 || s.Dropped > 0 {
+			stats[EventType(t)] = s
+		}
+	}
+	return stats
+}
+
+// Stats returns the dispatch statistics of the default dispatcher, see Dispatcher.Stats.
+func Stats() map[EventType]EventStats {
+	return defaultDispatcher.Stats()
+}
+
+// ResetStats sets the dispatch statistics back to zero.
+func (d *Dispatcher) ResetStats() {
+	for t := range d.stats {
+		d.stats[t].reset()
+	}
+}
+
+// ResetStats resets the dispatch statistics of the default dispatcher, see
+// Dispatcher.ResetStats.
+func ResetStats() {
+	defaultDispatcher.ResetStats()
+}
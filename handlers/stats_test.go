@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestStats(t *testing.T) {
+	d := New()
+	d.Register(Message, handlerFunc(func(ev interface{}) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}))
+	d.Register(Receipt, handlerFunc(func(ev interface{}) error { return errors.New("fail") }))
+	d.Register(Presence, handlerFunc(func(ev interface{}) error { panic("boom") }))
+
+	for _, evt := range []interface{}{
+		&events.Message{}, &events.Message{}, &events.Message{}, // handled
+		&events.Receipt{Type: "sender"}, &events.Receipt{Type: "sender"}, // failing
+		&events.Presence{},                   // panicking
+		&events.Picture{}, &events.Picture{}, // unhandled
+		&struct{}{}, // unknown, not counted
+	} {
+		d.Dispatch(evt)
+	}
+
+	stats := d.Stats()
+	if len(stats) != 4 {
+		t.Errorf("Stats() has %v types, want 4: %v", len(stats), stats)
+	}
+	for _, test := range []struct {
+		tp   EventType
+		want EventStats
+	}{
+		{Message, EventStats{Dispatched: 3, Succeeded: 3}},
+		{Receipt, EventStats{Dispatched: 2, Failed: 2}},
+		{Presence, EventStats{Dispatched: 1, Failed: 1}},
+		{Picture, EventStats{Dispatched: 2, NoHandler: 2}},
+	} {
+		got := stats[test.tp]
+		if got.Dispatched != test.want.Dispatched || got.Succeeded != test.want.Succeeded ||
+			got.Failed != test.want.Failed || got.NoHandler != test.want.NoHandler {
+			t.Errorf("Stats()[%v] = %+v, want counts of %+v", test.tp, got, test.want)
+		}
+	}
+	if m := stats[Message]; m.MaxLatency < time.Millisecond || m.MeanLatency() < time.Millisecond || m.TotalLatency < 3*time.Millisecond {
+		t.Errorf("Stats()[Message] latencies = %+v, want at least 1ms per dispatch", m)
+	}
+
+	d.ResetStats()
+	if stats := d.Stats(); len(stats) != 0 {
+		t.Errorf("Stats() after ResetStats() = %v, want empty", stats)
+	}
+	if got := (EventStats{}).MeanLatency(); got != 0 {
+		t.Errorf("MeanLatency() of no dispatches = %v, want 0", got)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// subscription is a handler that sends events to a channel, see Subscribe.
+type subscription struct {
+	dropped *atomic.Int64 // of the stats of the event type
+
+	mu     sync.Mutex // guards sending against closing
+	ch     chan interface{}
+	closed bool
+}
+
+// Handle sends the event without blocking. When the buffer is full, the oldest event in it makes
+// room.
+func (s *subscription) Handle(ev interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil // unsubscribed during the dispatch
+	}
+	for {
+		select {
+		case s.ch <- ev:
+			return nil
+		default:
+		}
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default: // the receiver made room meanwhile
+		}
+	}
+}
+
+// Close implements Closer: closing the dispatcher closes the channel.
+func (s *subscription) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+	return nil
+}
+
+// Subscribe returns a channel that receives the events of a type, for code that would rather
+// select on a channel than implement a handler. Sending never holds up the dispatch: when the
+// channel's buffer is full, the oldest event in it is dropped to make room for the newest, and
+// counted in EventStats.Dropped (see Stats). A buffer below 1 is taken as 1.
+//
+// A subscription counts as a handler: its events aren't NoHandlerFound. The returned func
+// unsubscribes and closes the channel; so does Close. Calling it again does nothing.
+//
+//	ch, unsubscribe := d.Subscribe(Presence, 16)
+//	defer unsubscribe()
+//	for ev := range ch { ... }
+func (d *Dispatcher) Subscribe(t EventType, buffer int) (<-chan interface{}, func()) {
+	if buffer < 1 {
+		buffer = 1
+	}
+	s := &subscription{ch: make(chan interface{}, buffer)}
+	if t >= 0 && t < numEventTypes {
+		s.dropped = &d.stats[t].dropped
+	} else {
+		s.dropped = &atomic.Int64{} // not counted
+	}
+	d.Register(t, s)
+	return s.ch, func() {
+		d.Unregister(t, s)
+		s.Close()
+	}
+}
+
+// Subscribe subscribes to the events of a type of the default dispatcher, see
+// Dispatcher.Subscribe.
+func Subscribe(t EventType, buffer int) (<-chan interface{}, func()) {
+	return defaultDispatcher.Subscribe(t, buffer)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func message(id string) *events.Message {
+	m := &events.Message{}
+	m.Info.ID = id
+	return m
+}
+
+// received returns the IDs of the messages that are waiting in a channel.
+func received(ch <-chan interface{}) string {
+	var ids []string
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return fmt.Sprint(ids, " closed")
+			}
+			ids = append(ids, ev.(*events.Message).Info.ID)
+		default:
+			return fmt.Sprint(ids)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	d := New()
+	ch, unsubscribe := d.Subscribe(Message, 4)
+	all, unsubscribeAll := d.Subscribe(AnyEvent, 4)
+	defer unsubscribeAll()
+
+	for _, id := range []string{"1", "2"} {
+		if err := d.Dispatch(message(id)); err != nil {
+			t.Errorf("Dispatch(%v) = %v, need nil error", id, err)
+		}
+	}
+	if got, want := received(ch), "[1 2]"; got != want {
+		t.Errorf("subscriber received %v, want %v", got, want)
+	}
+	if got, want := received(all), "[1 2]"; got != want {
+		t.Errorf("catch-all subscriber received %v, want %v", got, want)
+	}
+
+	unsubscribe()
+	unsubscribe() // does nothing
+	d.Dispatch(message("3"))
+	if got, want := received(ch), "[] closed"; got != want {
+		t.Errorf("after unsubscribe, subscriber received %v, want %v", got, want)
+	}
+	unsubscribeAll()
+	if err := d.Dispatch(message("4")); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(_) without subscribers = %v, want NoHandlerFound", err)
+	}
+}
+
+func TestSubscribeOverflow(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		buffer      int
+		want        string
+		wantDropped int64
+	}{
+		{"room to spare", 8, "[1 2 3 4 5]", 0},
+		{"oldest dropped", 2, "[4 5]", 3},
+		{"unbuffered", 0, "[5]", 4},
+	} {
+		d := New()
+		ch, unsubscribe := d.Subscribe(Message, test.buffer)
+		for i := 1; i <= 5; i++ {
+			d.Dispatch(message(fmt.Sprint(i)))
+		}
+		if got := received(ch); got != test.want {
+			t.Errorf("%v: subscriber received %v, want %v", test.description, got, test.want)
+		}
+		if got := d.Stats()[Message]; got.Dropped != test.wantDropped || got.Succeeded != 5 {
+			t.Errorf("%v: Stats()[Message] = %+v, want 5 succeeded and %v dropped", test.description, got, test.wantDropped)
+		}
+		unsubscribe()
+	}
+}
+
+func TestSubscribeClose(t *testing.T) {
+	d := New()
+	ch, _ := d.Subscribe(Message, 1)
+	d.Dispatch(message("1"))
+	if err := d.Close(); err != nil {
+		t.Errorf("Close() = %v, need nil error", err)
+	}
+	if got, want := received(ch), "[1] closed"; got != want {
+		t.Errorf("after Close, subscriber received %v, want %v", got, want)
+	}
+}
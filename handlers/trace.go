@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Trace lists the handlers that ran for a dispatched event, see DispatchTraced.
+type Trace struct {
+	Event    interface{}
+	Duration time.Duration // of the whole dispatch
+
+	mu      sync.Mutex
+	entries []TraceEntry
+}
+
+// TraceEntry is a handler that ran for an event. The handlers of derived synthetic events (see
+// EditMessage and friends) and of emitted events (see Emit) have entries too, under their own
+// event types.
+type TraceEntry struct {
+	EventType EventType
+	Handler   string        // name, see Named
+	Duration  time.Duration // that the handler took
+	Err       error         // that the handler returned; ErrStopPropagation when it ended the chain
+	Filtered  bool          // the handler was skipped by the predicate of RegisterFiltered
+}
+
+// Entries returns the entries of a trace, in the order in which the handlers ran.
+func (tr *Trace) Entries() []TraceEntry {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append([]TraceEntry(nil), tr.entries...)
+}
+
+// String returns the trace with a line per handler, for debugging.
+func (tr *Trace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%T in %v", tr.Event, tr.Duration)
+	for i, e := range tr.Entries() {
+		fmt.Fprintf(&b, "\n%d: %v %s %v", i, e.EventType, e.Handler, e.Duration)
+		switch {
+		case e.Filtered:
+			b.WriteString(" filtered")
+		case e.Err != nil:
+			fmt.Fprintf(&b, " error: %v", e.Err)
+		}
+	}
+	return b.String()
+}
+
+// traceKey is the context key of the trace of a dispatch, and traceMarkKey that of the mark of
+// the handler that runs.
+type traceKey struct{}
+type traceMarkKey struct{}
+
+// traceMark is set by wrappers, which may run after the handler was abandoned (see call).
+type traceMark struct {
+	filtered atomic.Bool
+}
+
+// markFiltered marks the traced handler of a context as skipped by its filter.
+func markFiltered(ctx context.Context) {
+	if m, ok := ctx.Value(traceMarkKey{}).(*traceMark); ok {
+		m.filtered.Store(true)
+	}
+}
+
+// call runs a handler, see the func call, and adds its entry to the trace.
+func (tr *Trace) call(ctx context.Context, t EventType, h handler, ev interface{}) error {
+	m := &traceMark{}
+	start := time.Now()
+	err := call(context.WithValue(ctx, traceMarkKey{}, m), h, ev)
+	e := TraceEntry{
+		EventType: t,
+		Handler:   handlerName(h),
+		Duration:  time.Since(start),
+		Err:       err,
+		Filtered:  m.filtered.Load(),
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.entries = append(tr.entries, e)
+	return err
+}
+
+// DispatchTraced dispatches an event like Dispatch, and returns the trace of the handlers that
+// ran: which ones, in what order, how long each took, what each returned, and which ones their
+// filter skipped. Tracing is opt-in: other dispatches aren't traced, and cost no more.
+//
+//	tr, err := d.DispatchTraced(evt)
+//	log.Printf("%v: %v", err, tr)
+func (d *Dispatcher) DispatchTraced(evt interface{}) (*Trace, error) {
+	tr := &Trace{Event: evt}
+	start := time.Now()
+	err := d.DispatchCtx(context.WithValue(context.Background(), traceKey{}, tr), evt)
+	tr.Duration = time.Since(start)
+	if err != nil {
+		return tr, err
+	}
+	return tr, nil
+}
+
+// DispatchTraced dispatches a traced event to the handlers of the default dispatcher, see
+// Dispatcher.DispatchTraced.
+func DispatchTraced(evt interface{}) (*Trace, error) {
+	return defaultDispatcher.DispatchTraced(evt)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDispatchTraced(t *testing.T) {
+	ok := handlerFunc(func(ev interface{}) error { return nil })
+	stop := handlerFunc(func(ev interface{}) error { return ErrStopPropagation })
+	fromMe := message("M")
+	fromMe.Info.IsFromMe = true
+
+	for _, test := range []struct {
+		description string
+		register    func(d *Dispatcher)
+		wantErr     bool
+		want        []string
+	}{
+		{
+			description: "filter, success and failure",
+			register: func(d *Dispatcher) {
+				d.RegisterFiltered(Message, NotFromMe(), ok)
+				d.Register(Message, ok)
+				d.Register(Message, namedHandler{})
+			},
+			wantErr: true,
+			want: []string{
+				"Message handlers.handlerFunc filtered",
+				"Message handlers.handlerFunc",
+				"Message persistence.Store error: disk full",
+			},
+		},
+		{
+			description: "short-circuit",
+			register: func(d *Dispatcher) {
+				d.Register(Message, stop)
+				d.Register(Message, namedHandler{})
+			},
+			want: []string{"Message handlers.handlerFunc error: stop propagation"},
+		},
+	} {
+		d := New()
+		test.register(d)
+		tr, err := d.DispatchTraced(fromMe)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%v: DispatchTraced(_) = _, %v, want error: %v", test.description, err, test.wantErr)
+		}
+		var got []string
+		for _, e := range tr.Entries() {
+			line := fmt.Sprintf("%v %s", e.EventType, e.Handler)
+			switch {
+			case e.Filtered:
+				line += " filtered"
+			case e.Err != nil:
+				line += " error: " + e.Err.Error()
+			}
+			got = append(got, line)
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%v: trace\n%v\nwant\n%v", test.description, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+		if tr.Event != fromMe {
+			t.Errorf("%v: trace of %v, want of the message", test.description, tr.Event)
+		}
+	}
+
+	// Untraced dispatches and nil errors aren't traced or wrapped.
+	d := New()
+	d.Register(Message, ok)
+	tr, err := d.DispatchTraced(fromMe)
+	if err != nil || len(tr.Entries()) != 1 {
+		t.Errorf("DispatchTraced(_) = %v, %v, want 1 entry and nil error", tr, err)
+	}
+	if err := d.Dispatch(fromMe); err != nil {
+		t.Errorf("Dispatch(_) = %v, need nil error", err)
+	}
+	if len(tr.Entries()) != 1 {
+		t.Errorf("an untraced dispatch added to a trace: %v", tr)
+	}
+}
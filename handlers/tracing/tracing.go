@@ -0,0 +1,111 @@
+// Package tracing traces the dispatching of events with OpenTelemetry: every event gets a span,
+// such as "dispatch Message", that the spans of its handlers are children of. It is a module of
+// its own, so that OpenTelemetry isn't a dependency of package handlers.
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/types/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation is the name of the tracer.
+const instrumentation = "github.com/KarelKubat/whatsmeow/handlers/tracing"
+
+// Use adds a tracing middleware to a dispatcher. Events that are dispatched with
+// `DispatchCtx` get spans that are children of the span in the context, and handlers that
+// implement `handlers.ContextHandler` get a context with the span of their event.
+//
+//	tracing.Use(d, otel.GetTracerProvider())
+//
+// The span of an event has the attributes:
+//
+//	whatsmeow.event       the event type, e.g. "Message"
+//	whatsmeow.handlers    the number of handlers of the type, catch-alls included
+//	whatsmeow.chat        the chat of messages and receipts
+//	whatsmeow.sender      the sender of messages and receipts
+//	whatsmeow.message.id  the ID of messages; a list of IDs for receipts
+//
+// The errors of the handlers are recorded as span events, and make the status of the span
+// Error. Events without handlers aren't errors.
+func Use(d *handlers.Dispatcher, tp trace.TracerProvider) {
+	d.UseCtx(middleware(tp, d.Registered))
+}
+
+// UseDefault adds a tracing middleware to the default dispatcher of package handlers, see Use.
+func UseDefault(tp trace.TracerProvider) {
+	handlers.UseCtx(middleware(tp, handlers.Registered))
+}
+
+func middleware(tp trace.TracerProvider, registered func() map[handlers.EventType]int) handlers.ContextMiddleware {
+	tracer := tp.Tracer(instrumentation)
+	return func(next handlers.ContextHandlerFunc) handlers.ContextHandlerFunc {
+		return func(ctx context.Context, t handlers.EventType, ev interface{}) error {
+			reg := registered()
+			ctx, span := tracer.Start(ctx, "dispatch "+t.String(), trace.WithAttributes(
+				attribute.String("whatsmeow.event", t.String()),
+				attribute.Int("whatsmeow.handlers", reg[t]+reg[handlers.AnyEvent]),
+			))
+			defer span.End()
+			span.SetAttributes(eventAttributes(ev)...)
+
+			err := next(ctx, t, ev)
+			var de *handlers.DispatchError
+			if err == nil || errors.As(err, &de) && de.Type == handlers.NoHandlerFound {
+				return err
+			}
+			for _, e := range handlerErrors(err) {
+				span.RecordError(e)
+			}
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+	}
+}
+
+// handlerErrors returns the errors of the failing handlers: one, or more when the dispatcher
+// continues on errors.
+func handlerErrors(err error) []error {
+	var de *handlers.DispatchError
+	if errors.As(err, &de) {
+		err = de.Err
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// eventAttributes returns the chat, sender and message IDs of an event, when it has them.
+func eventAttributes(ev interface{}) []attribute.KeyValue {
+	ref := func(r handlers.MessageRef) []attribute.KeyValue {
+		return []attribute.KeyValue{
+			attribute.String("whatsmeow.chat", r.Chat.String()),
+			attribute.String("whatsmeow.sender", r.Sender.String()),
+			attribute.String("whatsmeow.message.id", r.ID),
+		}
+	}
+	switch v := ev.(type) {
+	case *events.Message:
+		return ref(handlers.RefOf(v))
+	case *events.Receipt:
+		return []attribute.KeyValue{
+			attribute.String("whatsmeow.chat", v.Chat.String()),
+			attribute.String("whatsmeow.sender", v.Sender.String()),
+			attribute.StringSlice("whatsmeow.message.id", v.MessageIDs),
+		}
+	case *handlers.Edit:
+		return ref(v.Target)
+	case *handlers.Revoke:
+		return ref(v.Target)
+	case *handlers.Sticker:
+		return ref(v.Ref)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// childHandler starts a span of its own, which must be a child of the dispatch span.
+type childHandler struct {
+	tp  *sdktrace.TracerProvider
+	err error
+}
+
+func (h *childHandler) Handle(ev interface{}) error {
+	return h.HandleCtx(context.Background(), ev)
+}
+
+func (h *childHandler) HandleCtx(ctx context.Context, ev interface{}) error {
+	_, span := h.tp.Tracer("test").Start(ctx, "handler")
+	defer span.End()
+	return h.err
+}
+
+func attr(s sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	d := handlers.New()
+	d.SetContinueOnError(true)
+	Use(d, tp)
+	d.Register(handlers.Message, &childHandler{tp: tp})
+	d.Register(handlers.Receipt, &childHandler{tp: tp, err: errors.New("db down")})
+	d.Register(handlers.Receipt, &childHandler{tp: tp, err: errors.New("http down")})
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	chat := types.NewJID("123", types.GroupServer)
+	m := &events.Message{}
+	m.Info.Chat = chat
+	m.Info.ID = "M1"
+	if err := d.DispatchCtx(ctx, m); err != nil {
+		t.Fatalf("DispatchCtx(message) = %v, need nil error", err)
+	}
+	r := &events.Receipt{MessageIDs: []types.MessageID{"M1", "M2"}}
+	r.Chat = chat
+	if err := d.DispatchCtx(ctx, r); err == nil {
+		t.Fatalf("DispatchCtx(receipt) = nil, need error")
+	}
+	if err := d.DispatchCtx(ctx, &events.Picture{}); err == nil || err.Type != handlers.NoHandlerFound {
+		t.Fatalf("DispatchCtx(picture) = %v, want NoHandlerFound", err)
+	}
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	var handlerSpans []sdktrace.ReadOnlySpan
+	for _, s := range sr.Ended() {
+		if s.Name() == "handler" {
+			handlerSpans = append(handlerSpans, s)
+		} else {
+			spans[s.Name()] = s
+		}
+	}
+
+	msg, ok := spans["dispatch Message"]
+	if !ok {
+		t.Fatalf("no span dispatch Message in %v", spans)
+	}
+	if msg.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("dispatch Message isn't a child of the parent span")
+	}
+	for key, want := range map[string]string{
+		"whatsmeow.event":      "Message",
+		"whatsmeow.handlers":   "1",
+		"whatsmeow.chat":       chat.String(),
+		"whatsmeow.message.id": "M1",
+	} {
+		if got := attr(msg, key); got != want {
+			t.Errorf("dispatch Message: %v = %q, want %q", key, got, want)
+		}
+	}
+	if msg.Status().Code != codes.Unset {
+		t.Errorf("dispatch Message: status %v, want Unset", msg.Status())
+	}
+	if len(handlerSpans) != 3 || handlerSpans[0].Parent().SpanID() != msg.SpanContext().SpanID() {
+		t.Errorf("the first of %v handler spans isn't a child of dispatch Message", len(handlerSpans))
+	}
+
+	rcpt := spans["dispatch Receipt"]
+	if rcpt == nil {
+		t.Fatalf("no span dispatch Receipt in %v", spans)
+	}
+	if rcpt.Status().Code != codes.Error || len(rcpt.Events()) != 2 {
+		t.Errorf("dispatch Receipt: status %v with %v events, want Error with 2", rcpt.Status(), len(rcpt.Events()))
+	}
+	if got, want := attr(rcpt, "whatsmeow.message.id"), "[M1 M2]"; got != want {
+		t.Errorf("dispatch Receipt: message IDs = %v, want %v", got, want)
+	}
+
+	pic := spans["dispatch Picture"]
+	if pic == nil {
+		t.Fatalf("no span dispatch Picture in %v", spans)
+	}
+	if pic.Status().Code != codes.Unset || attr(pic, "whatsmeow.handlers") != "0" {
+		t.Errorf("dispatch Picture: status %v, handlers %v, want Unset, 0", pic.Status(), attr(pic, "whatsmeow.handlers"))
+	}
+}
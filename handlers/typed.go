@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrUnsupportedType is returned by RegisterTyped for types that Dispatch doesn't dispatch.
+var ErrUnsupportedType = errors.New("unsupported event type")
+
+// eventTypes maps the types of the events that Dispatch handles to their EventType. Dispatch
+// looks events up here, see EventTypeOf.
+var eventTypes = func() map[reflect.Type]EventType {
+	m := map[reflect.Type]EventType{}
+	for _, row := range eventTable {
+		if row.evt != nil {
+			m[reflect.TypeOf(row.evt)] = row.t
+		}
+	}
+	return m
+}()
+
+// EventTypes returns the Go types of the events that Dispatch handles, e.g. events.Message, and
+// the EventType that they are dispatched as, custom types included. The map is a copy.
+func EventTypes() map[reflect.Type]EventType {
+	m := make(map[reflect.Type]EventType, len(eventTypes))
+	for rt, t := range eventTypes {
+		m[rt] = t
+	}
+	custom.mu.RLock()
+	defer custom.mu.RUnlock()
+	for rt, t := range custom.types {
+		m[rt] = t
+	}
+	return m
+}
+
+// EventTypeOf returns the EventType that an event is dispatched as, e.g. Message for an
+// *events.Message, and false when Dispatch doesn't handle the event. Receipts are Receipt,
+// regardless of their kind (see ReceiptEventType).
+func EventTypeOf(evt interface{}) (EventType, bool) {
+	rt := reflect.TypeOf(evt)
+	if rt == nil || rt.Kind() != reflect.Pointer {
+		return firstEventType, false
+	}
+	return lookupType(rt.Elem())
+}
+
+// TypeOf returns the EventType that events of type *T are dispatched as, e.g. Message for
+// events.Message, and false when Dispatch doesn't handle *T.
+func TypeOf[T any]() (EventType, bool) {
+	return lookupType(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// typed adapts a func of a typed event to a handler.
+type typed[T any] struct {
+	f func(*T) error
+}
+
+func (h *typed[T]) Handle(ev interface{}) error {
+	e, ok := ev.(*T)
+	if !ok {
+		return fmt.Errorf("handlers.RegisterTyped: got event %T, want %T", ev, e)
+	}
+	return h.f(e)
+}
+
+// RegisterTyped registers a func for the events of type *T with the default dispatcher, without
+// the typecast of a handler. The event type follows from T:
+//
+//	_, err := RegisterTyped(func(m *events.Message) error {
+//		fmt.Println("Message:", m.Message.GetConversation())
+//		return nil
+//	})
+//
+// The synthetic events are registered by their types, e.g. RegisterTyped(func(e *Edit) error
+// {...}). The returned func unregisters the func again, see Unregister. When Dispatch doesn't
+// handle *T, an error wrapping ErrUnsupportedType is returned.
+func RegisterTyped[T any](f func(*T) error) (unregister func() bool, err error) {
+	return RegisterTypedOn(defaultDispatcher, f)
+}
+
+// RegisterTypedOn is RegisterTyped for a dispatcher. Go methods can't have type parameters.
+func RegisterTypedOn[T any](d *Dispatcher, f func(*T) error) (unregister func() bool, err error) {
+	t, ok := TypeOf[T]()
+	if !ok {
+		var zero *T
+		return nil, fmt.Errorf("handlers.RegisterTyped: %T: %w", zero, ErrUnsupportedType)
+	}
+	h := &typed[T]{f: f}
+	d.Register(t, h)
+	return func() bool { return d.Unregister(t, h) }, nil
+}
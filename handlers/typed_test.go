@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// TestEventTypesMatchDispatch checks that every event type has a Go type, and that Dispatch
+// dispatches that type as the event type.
+func TestEventTypesMatchDispatch(t *testing.T) {
+	if got, want := len(eventTypeNames), len(eventTable); got != want {
+		t.Errorf("eventTable has %v rows but %v event types, want one row per type", want, got)
+	}
+	// Not AnyEvent, and not the receipt kinds, which are *events.Receipt.
+	if got, want := len(eventTypes), int(lastEventType-firstEventType-2-4); got != want {
+		t.Errorf("eventTypes has %v entries, want %v", got, want)
+	}
+	for rt, et := range eventTypes {
+		d := New()
+		var seen interface{}
+		d.Register(et, handlerFunc(func(ev interface{}) error {
+			seen = ev
+			return nil
+		}))
+		ev := reflect.New(rt).Interface()
+		d.Dispatch(ev)
+		if seen != ev {
+			t.Errorf("Dispatch(%T) didn't reach the handler of %v", ev, et)
+		}
+	}
+}
+
+// typedEvent is an event and the type that it is dispatched as.
+type typedEvent struct {
+	tp  EventType
+	evt interface{}
+}
+
+// checkDispatch checks that events without handlers aren't handled, and that the events reach
+// the handlers of their type.
+func checkDispatch(t *testing.T, tests []typedEvent) {
+	t.Helper()
+	for _, test := range tests {
+		d := New()
+		if err := d.Dispatch(test.evt); err == nil || err.Type != NoHandlerFound {
+			t.Errorf("Dispatch(%T) without handler = %v, want NoHandlerFound", test.evt, err)
+		}
+		var seen interface{}
+		d.Register(test.tp, handlerFunc(func(ev interface{}) error {
+			seen = ev
+			return nil
+		}))
+		if err := d.Dispatch(test.evt); err != nil || seen != test.evt {
+			t.Errorf("Dispatch(%T) = %v, want nil error and the %v handler invoked", test.evt, err, test.tp)
+		}
+	}
+}
+
+func TestNewsletterDispatch(t *testing.T) {
+	checkDispatch(t, []typedEvent{
+		{NewsletterJoin, &events.NewsletterJoin{}},
+		{NewsletterLeave, &events.NewsletterLeave{}},
+		{NewsletterMuteChange, &events.NewsletterMuteChange{}},
+		{NewsletterLiveUpdate, &events.NewsletterLiveUpdate{}},
+	})
+}
+
+func TestCallDispatch(t *testing.T) {
+	checkDispatch(t, []typedEvent{
+		{CallPreAccept, &events.CallPreAccept{}},
+		{CallTransport, &events.CallTransport{}},
+	})
+
+	// A handler for all call events gets each of them.
+	d := New()
+	var got []string
+	for _, tp := range CallEvents() {
+		d.Register(tp, handlerFunc(func(ev interface{}) error {
+			got = append(got, fmt.Sprintf("%T", ev))
+			return nil
+		}))
+	}
+	for _, evt := range []interface{}{&events.CallOffer{}, &events.CallPreAccept{}, &events.CallTransport{}, &events.CallTerminate{}} {
+		if err := d.Dispatch(evt); err != nil {
+			t.Errorf("Dispatch(%T) = %v, need nil error", evt, err)
+		}
+	}
+	if want := "[*events.CallOffer *events.CallPreAccept *events.CallTransport *events.CallTerminate]"; fmt.Sprint(got) != want {
+		t.Errorf("call handler got %v, want %v", got, want)
+	}
+	for _, tp := range CallEvents() {
+		if !strings.HasPrefix(tp.String(), "Call") && tp != UnknownCallEvent {
+			t.Errorf("CallEvents() has %v", tp)
+		}
+	}
+}
+
+func TestFBMessageDispatch(t *testing.T) {
+	checkDispatch(t, []typedEvent{{FBMessage, &events.FBMessage{}}})
+
+	// FBMessages aren't Messages, nor UndecryptableMessages.
+	d := New()
+	d.Register(Message, handlerFunc(func(ev interface{}) error { return nil }))
+	d.Register(UndecryptableMessage, handlerFunc(func(ev interface{}) error { return nil }))
+	if err := d.Dispatch(&events.FBMessage{}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(*events.FBMessage) = %v, want NoHandlerFound", err)
+	}
+}
+
+func TestSessionDispatch(t *testing.T) {
+	checkDispatch(t, []typedEvent{
+		{CATRefreshError, &events.CATRefreshError{Error: errors.New("expired")}},
+		{ClearChat, &events.ClearChat{}},
+		{UserStatusMute, &events.UserStatusMute{}},
+	})
+}
+
+func TestLabelDispatch(t *testing.T) {
+	checkDispatch(t, []typedEvent{
+		{LabelEdit, &events.LabelEdit{LabelID: "1"}},
+		{LabelAssociationChat, &events.LabelAssociationChat{LabelID: "1"}},
+		{LabelAssociationMessage, &events.LabelAssociationMessage{LabelID: "1", MessageID: "M"}},
+	})
+}
+
+// TestBlocklistDispatch checks that Blocklist events reach their handlers as they are, changes
+// included.
+func TestBlocklistDispatch(t *testing.T) {
+	d := New()
+	var seen *events.Blocklist
+	d.Register(Blocklist, handlerFunc(func(ev interface{}) error {
+		seen = ev.(*events.Blocklist)
+		return nil
+	}))
+	b := &events.Blocklist{
+		Action: events.BlocklistActionDefault,
+		DHash:  "new",
+		Changes: []events.BlocklistChange{
+			{JID: types.NewJID("123", types.DefaultUserServer), Action: events.BlocklistChangeActionBlock},
+			{JID: types.NewJID("456", types.DefaultUserServer), Action: events.BlocklistChangeActionUnblock},
+		},
+	}
+	if err := d.Dispatch(b); err != nil {
+		t.Fatalf("Dispatch(_) = %v, need nil error", err)
+	}
+	if seen != b {
+		t.Fatalf("handler saw %p, want the dispatched %p", seen, b)
+	}
+	if len(seen.Changes) != 2 || seen.Changes[1].JID.User != "456" || seen.Changes[1].Action != events.BlocklistChangeActionUnblock {
+		t.Errorf("handler saw changes %+v, want them untouched", seen.Changes)
+	}
+}
+
+// TestEventCoverage checks that Dispatch handles every event in the events package, so that new
+// upstream events don't go unnoticed. Parts of events are listed in notEvents.
+func TestEventCoverage(t *testing.T) {
+	if missing := VerifyEventCoverage(); len(missing) > 0 {
+		t.Errorf("VerifyEventCoverage() = %v, want none; add event types, or parts of events to notEvents", missing)
+	}
+}
+
+func TestEventTypeOf(t *testing.T) {
+	for _, evt := range []interface{}{
+		&events.AppState{},
+		&events.AppStateSyncComplete{},
+		&events.Archive{},
+		&events.Blocklist{},
+		&events.BusinessName{},
+		&events.CATRefreshError{},
+		&events.CallAccept{},
+		&events.CallOffer{},
+		&events.CallOfferNotice{},
+		&events.CallPreAccept{},
+		&events.CallRelayLatency{},
+		&events.CallTerminate{},
+		&events.CallTransport{},
+		&events.ChatPresence{},
+		&events.ClearChat{},
+		&events.ClientOutdated{},
+		&events.Connected{},
+		&events.ConnectFailure{},
+		&events.Contact{},
+		&events.DeleteChat{},
+		&events.DeleteForMe{},
+		&events.Disconnected{},
+		&Edit{},
+		&events.FBMessage{},
+		&events.GroupInfo{},
+		&events.HistorySync{},
+		&events.IdentityChange{},
+		&events.JoinedGroup{},
+		&events.KeepAliveRestored{},
+		&events.KeepAliveTimeout{},
+		&events.LabelAssociationChat{},
+		&events.LabelAssociationMessage{},
+		&events.LabelEdit{},
+		&events.LoggedOut{},
+		&events.MarkChatAsRead{},
+		&events.MediaRetry{},
+		&events.Message{},
+		&Revoke{},
+		&events.Mute{},
+		&events.NewsletterJoin{},
+		&events.NewsletterLeave{},
+		&events.NewsletterLiveUpdate{},
+		&events.NewsletterMuteChange{},
+		&events.OfflineSyncCompleted{},
+		&events.OfflineSyncPreview{},
+		&events.PairError{},
+		&events.PairSuccess{},
+		&events.Picture{},
+		&events.Pin{},
+		&events.Presence{},
+		&events.PrivacySettings{},
+		&events.PushName{},
+		&events.PushNameSetting{},
+		&events.QR{},
+		&events.QRScannedWithoutMultidevice{},
+		&events.Receipt{},
+		&events.Star{},
+		&Sticker{},
+		&events.StreamError{},
+		&events.StreamReplaced{},
+		&events.TemporaryBan{},
+		&events.UnarchiveChatsSetting{},
+		&events.UndecryptableMessage{},
+		&events.UnknownCallEvent{},
+		&events.UserStatusMute{},
+	} {
+		if tp, ok := EventTypeOf(evt); !ok || tp == firstEventType {
+			t.Errorf("EventTypeOf(%T) = %v, %v, want a type, true", evt, tp, ok)
+		}
+	}
+
+	type unrelated struct{}
+	for _, evt := range []interface{}{nil, &unrelated{}, events.Message{}, "Message"} {
+		if tp, ok := EventTypeOf(evt); ok {
+			t.Errorf("EventTypeOf(%T) = %v, true, want false", evt, tp)
+		}
+	}
+}
+
+type handlerFunc func(ev interface{}) error
+
+func (f handlerFunc) Handle(ev interface{}) error { return f(ev) }
+
+func TestRegisterTyped(t *testing.T) {
+	d := New()
+	var got []string
+	_, err1 := RegisterTypedOn(d, func(m *events.Message) error {
+		got = append(got, "message "+m.Info.ID)
+		return nil
+	})
+	_, err2 := RegisterTypedOn(d, func(r *events.Receipt) error {
+		got = append(got, "receipt "+r.MessageIDs[0])
+		return nil
+	})
+	_, err3 := RegisterTypedOn(d, func(q *events.QR) error {
+		got = append(got, "qr "+q.Codes[0])
+		return nil
+	})
+	for _, err := range []error{err1, err2, err3} {
+		if err != nil {
+			t.Fatalf("RegisterTyped(_) = _, %v; need nil error", err)
+		}
+	}
+	if tp, ok := TypeOf[events.Receipt](); !ok || tp != Receipt {
+		t.Errorf("TypeOf[events.Receipt]() = %v, %v; want Receipt, true", tp, ok)
+	}
+
+	m := &events.Message{}
+	m.Info.ID = "M1"
+	for _, ev := range []interface{}{
+		m,
+		&events.Receipt{MessageIDs: []string{"M1"}},
+		&events.QR{Codes: []string{"code"}},
+	} {
+		if err := d.Dispatch(ev); err != nil {
+			t.Errorf("Dispatch(%T) = %v, need nil error", ev, err)
+		}
+	}
+	want := []string{"message M1", "receipt M1", "qr code"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("handlers saw %q, want %q", got, want)
+	}
+}
+
+func TestRegisterTypedUnsupported(t *testing.T) {
+	d := New()
+	unregister, err := RegisterTypedOn(d, func(s *struct{ X int }) error { return nil })
+	if !errors.Is(err, ErrUnsupportedType) || unregister != nil {
+		t.Errorf("RegisterTyped(*struct) = %p, %v; want nil, ErrUnsupportedType", unregister, err)
+	}
+	if _, ok := TypeOf[events.Message](); !ok {
+		t.Errorf("TypeOf[events.Message]() = _, false; want true")
+	}
+	if len(d.registry) != 0 {
+		t.Errorf("registry = %v after a failed registration, want empty", d.registry)
+	}
+}
+
+func TestRegisterTypedUnregister(t *testing.T) {
+	d := New()
+	calls := 0
+	unregister, err := RegisterTypedOn(d, func(c *events.Connected) error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterTyped(_) = _, %v; need nil error", err)
+	}
+	if err := d.Dispatch(&events.Connected{}); err != nil {
+		t.Errorf("Dispatch(_) = %v, need nil error", err)
+	}
+	if !unregister() {
+		t.Errorf("unregister() = false, want true")
+	}
+	if unregister() {
+		t.Errorf("unregister() a second time = true, want false")
+	}
+	if err := d.Dispatch(&events.Connected{}); err == nil || err.Type != NoHandlerFound {
+		t.Errorf("Dispatch(_) after unregister() = %v, want NoHandlerFound", err)
+	}
+	if calls != 1 {
+		t.Errorf("%v calls, want 1", calls)
+	}
+}
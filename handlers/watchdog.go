@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// DefaultWatchdogThreshold is the number of consecutive keepalive timeouts after which a watchdog
+// considers the connection dead, unless set with WatchdogThreshold.
+const DefaultWatchdogThreshold = 5
+
+// WatchdogOption configures a keepalive watchdog, see NewKeepAliveWatchdog.
+type WatchdogOption func(*KeepAliveWatchdog)
+
+// WatchdogThreshold sets the number of consecutive keepalive timeouts after which the connection
+// is considered dead; below 1 is taken as 1.
+func WatchdogThreshold(n int) WatchdogOption {
+	return func(w *KeepAliveWatchdog) { w.threshold = max(n, 1) }
+}
+
+// WatchdogOnDead sets the callback that is invoked when the connection is considered dead, with
+// the number of consecutive timeouts and when the last keepalive succeeded, e.g. to force a
+// reconnect, or to page someone.
+func WatchdogOnDead(f func(streak int, lastSuccess time.Time)) WatchdogOption {
+	return func(w *KeepAliveWatchdog) { w.onDead = f }
+}
+
+// WatchdogStatus is the state of a keepalive watchdog, e.g. for a health endpoint.
+type WatchdogStatus struct {
+	Streak       int       // consecutive keepalive timeouts
+	Dead         bool      // the streak reached the threshold
+	LastSuccess  time.Time // of a keepalive, as reported by the last timeout
+	LastRestored time.Time // when the keepalives last started working again, zero if never
+}
+
+// KeepAliveWatchdog counts consecutive KeepAliveTimeout events. A single timeout is noise, but a
+// streak of them means that the connection is dead, even when whatsmeow hasn't noticed: when the
+// streak reaches the threshold, the watchdog logs an error and invokes its callback, once per
+// streak. KeepAliveRestored ends the streak. Use NewKeepAliveWatchdog.
+type KeepAliveWatchdog struct {
+	log       waLog.Logger
+	threshold int
+	onDead    func(streak int, lastSuccess time.Time)
+
+	mu     sync.Mutex
+	status WatchdogStatus
+}
+
+// NewKeepAliveWatchdog returns a watchdog that logs to any waLog.Logger. Register it for the
+// keepalive events:
+//
+//	w := handlers.NewKeepAliveWatchdog(log, handlers.WatchdogOnDead(func(int, time.Time) {
+//		client.Disconnect()
+//	}))
+//	handlers.RegisterMany([]handlers.EventType{handlers.KeepAliveTimeout, handlers.KeepAliveRestored}, w)
+func NewKeepAliveWatchdog(log waLog.Logger, opts ...WatchdogOption) *KeepAliveWatchdog {
+	w := &KeepAliveWatchdog{
+		log:       log,
+		threshold: DefaultWatchdogThreshold,
+	}
+	for _, o := range opts {
+		o(w)
+	}
+	return w
+}
+
+// Name implements Named.
+func (w *KeepAliveWatchdog) Name() string {
+	return "KeepAliveWatchdog"
+}
+
+// Status returns the state of the watchdog.
+func (w *KeepAliveWatchdog) Status() WatchdogStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
+
+// Handle implements handlers.handler for KeepAliveTimeout and KeepAliveRestored.
+func (w *KeepAliveWatchdog) Handle(ev interface{}) error {
+	switch v := ev.(type) {
+	case *events.KeepAliveTimeout:
+		w.timeout(v)
+	case *events.KeepAliveRestored:
+		w.mu.Lock()
+		w.status.Streak, w.status.Dead, w.status.LastRestored = 0, false, now()
+		w.mu.Unlock()
+	default:
+		return fmt.Errorf("handlers.KeepAliveWatchdog.Handle: unexpected event %T", ev)
+	}
+	return nil
+}
+
+// timeout extends the streak, and reports a dead connection when it reaches the threshold.
+func (w *KeepAliveWatchdog) timeout(ev *events.KeepAliveTimeout) {
+	w.mu.Lock()
+	w.status.Streak++
+	if !ev.LastSuccess.IsZero() {
+		w.status.LastSuccess = ev.LastSuccess
+	}
+	dead := !w.status.Dead && w.status.Streak >= w.threshold
+	if dead {
+		w.status.Dead = true
+	}
+	streak, lastSuccess := w.status.Streak, w.status.LastSuccess
+	w.mu.Unlock()
+
+	if !dead {
+		return
+	}
+	w.log.Errorf("handlers.KeepAliveWatchdog: %d keepalive timeouts in a row, last success at %v, the connection is considered dead",
+		streak, lastSuccess.Format(time.RFC3339))
+	if w.onDead != nil {
+		w.onDead(streak, lastSuccess)
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestKeepAliveWatchdog(t *testing.T) {
+	success := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	timeout := &events.KeepAliveTimeout{LastSuccess: success}
+	restored := &events.KeepAliveRestored{}
+	for _, test := range []struct {
+		description string
+		opts        []WatchdogOption
+		events      []interface{}
+		wantDead    string // streaks reported to OnDead
+		wantStreak  int
+		wantIsDead  bool
+	}{
+		{
+			description: "noise",
+			events:      []interface{}{timeout, restored, timeout, timeout, restored, timeout},
+			wantStreak:  1,
+		},
+		{
+			description: "dead at the default threshold",
+			events:      []interface{}{timeout, timeout, timeout, timeout, timeout},
+			wantDead:    "5",
+			wantStreak:  5,
+			wantIsDead:  true,
+		},
+		{
+			description: "reported once per streak",
+			opts:        []WatchdogOption{WatchdogThreshold(2)},
+			events:      []interface{}{timeout, timeout, timeout, timeout, restored, timeout, timeout},
+			wantDead:    "2 2",
+			wantStreak:  2,
+			wantIsDead:  true,
+		},
+		{
+			description: "reset by a restore",
+			opts:        []WatchdogOption{WatchdogThreshold(3)},
+			events:      []interface{}{timeout, timeout, restored, timeout, timeout, restored, timeout},
+			wantStreak:  1,
+		},
+		{
+			description: "threshold below 1",
+			opts:        []WatchdogOption{WatchdogThreshold(0)},
+			events:      []interface{}{timeout},
+			wantDead:    "1",
+			wantStreak:  1,
+			wantIsDead:  true,
+		},
+	} {
+		withFakeClock(t)
+		var lines, dead []string
+		opts := append(test.opts, WatchdogOnDead(func(streak int, last time.Time) {
+			dead = append(dead, strconv.Itoa(streak))
+			if !last.Equal(success) {
+				t.Errorf("%v: OnDead(_, %v), want last success %v", test.description, last, success)
+			}
+		}))
+		w := NewKeepAliveWatchdog(memLogger{&lines}, opts...)
+		d := New()
+		d.RegisterMany([]EventType{KeepAliveTimeout, KeepAliveRestored}, w)
+		for _, ev := range test.events {
+			if err := d.Dispatch(ev); err != nil {
+				t.Errorf("%v: Dispatch(%T) = %v, need nil error", test.description, ev, err)
+			}
+		}
+		if got := strings.Join(dead, " "); got != test.wantDead {
+			t.Errorf("%v: OnDead got streaks %q, want %q", test.description, got, test.wantDead)
+		}
+		if len(lines) != len(dead) {
+			t.Errorf("%v: logged %q, want one line per dead connection", test.description, lines)
+		}
+		for _, l := range lines {
+			if !strings.HasPrefix(l, "ERROR ") || !strings.Contains(l, "keepalive timeouts in a row") {
+				t.Errorf("%v: logged %q, want an error about the timeouts", test.description, l)
+			}
+		}
+		s := w.Status()
+		if s.Streak != test.wantStreak || s.Dead != test.wantIsDead || !s.LastSuccess.Equal(success) {
+			t.Errorf("%v: Status() = %+v, want streak %d, dead %v, last success %v",
+				test.description, s, test.wantStreak, test.wantIsDead, success)
+		}
+	}
+}
+
+func TestKeepAliveWatchdogLastRestored(t *testing.T) {
+	clock := withFakeClock(t)
+	var lines []string
+	w := NewKeepAliveWatchdog(memLogger{&lines})
+	if got := w.Status().LastRestored; !got.IsZero() {
+		t.Errorf("Status().LastRestored = %v before a restore, want zero", got)
+	}
+	w.Handle(&events.KeepAliveTimeout{})
+	restoredAt := *clock
+	w.Handle(&events.KeepAliveRestored{})
+	*clock = clock.Add(time.Minute)
+	w.Handle(&events.KeepAliveTimeout{})
+	if got := w.Status().LastRestored; !got.Equal(restoredAt) {
+		t.Errorf("Status().LastRestored = %v, want %v", got, restoredAt)
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Defaults of a webhook handler, unless set with its options.
+const (
+	DefaultWebhookTimeout  = 10 * time.Second
+	DefaultWebhookAttempts = 3
+	DefaultWebhookBackoff  = 500 * time.Millisecond
+)
+
+// WebhookSignatureHeader is the header with the HMAC signature of a webhook's body, see
+// WebhookSecret.
+const WebhookSignatureHeader = "X-Signature-256"
+
+// WebhookEnvelope is the JSON body that a webhook handler POSTs: the name of the event type (see
+// ParseEventType), when the event was posted, and the event.
+type WebhookEnvelope struct {
+	Type      string          `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// WebhookOption configures a webhook handler, see NewWebhookHandler.
+type WebhookOption func(*WebhookHandler)
+
+// WebhookHeader sets a header of the requests, e.g. for authorization.
+func WebhookHeader(key, value string) WebhookOption {
+	return func(w *WebhookHandler) { w.header.Set(key, value) }
+}
+
+// WebhookTimeout sets the timeout of each request.
+func WebhookTimeout(d time.Duration) WebhookOption {
+	return func(w *WebhookHandler) { w.timeout = d }
+}
+
+// WebhookSecret makes the handler sign the body of each request with HMAC-SHA256, in the header
+// WebhookSignatureHeader as "sha256=" and the hex digest, so that the service can verify it.
+func WebhookSecret(secret []byte) WebhookOption {
+	return func(w *WebhookHandler) { w.secret = secret }
+}
+
+// WebhookRetries sets the number of attempts in all, and the backoff before the first retry,
+// which doubles at every retry, with jitter.
+func WebhookRetries(attempts int, backoff time.Duration) WebhookOption {
+	return func(w *WebhookHandler) { w.attempts, w.backoff = attempts, backoff }
+}
+
+// WebhookClient sets the HTTP client, e.g. for a proxy or TLS settings.
+func WebhookClient(c *http.Client) WebhookOption {
+	return func(w *WebhookHandler) { w.client = c }
+}
+
+// WebhookHandler POSTs the events that it gets to a URL, as JSON in a WebhookEnvelope. Use
+// NewWebhookHandler.
+type WebhookHandler struct {
+	url      string
+	client   *http.Client
+	header   http.Header
+	timeout  time.Duration
+	secret   []byte
+	attempts int
+	backoff  time.Duration
+}
+
+// NewWebhookHandler returns a handler that POSTs events to `url`, for any event type, e.g. as a
+// catch-all. Requests that fail, or get a 5xx response, are retried with backoff; when the last
+// attempt fails, or the response is another non-2xx one, the handler fails with the status.
+//
+//	handlers.Register(handlers.Message, handlers.NewWebhookHandler("https://example.com/wa",
+//		handlers.WebhookSecret(secret), handlers.WebhookHeader("Authorization", "Bearer "+token)))
+//
+// The retries hold up the dispatch, and the handlers after this one, so consider
+// RegisterConcurrent or Lanes.
+func NewWebhookHandler(url string, opts ...WebhookOption) *WebhookHandler {
+	w := &WebhookHandler{
+		url:      url,
+		client:   http.DefaultClient,
+		header:   http.Header{},
+		timeout:  DefaultWebhookTimeout,
+		attempts: DefaultWebhookAttempts,
+		backoff:  DefaultWebhookBackoff,
+	}
+	for _, o := range opts {
+		o(w)
+	}
+	return w
+}
+
+// Name implements Named.
+func (w *WebhookHandler) Name() string {
+	return "webhook " + w.url
+}
+
+// Handle implements handlers.handler for events of any type.
+func (w *WebhookHandler) Handle(ev interface{}) error {
+	return w.HandleCtx(context.Background(), ev)
+}
+
+// HandleCtx implements ContextHandler, so that derived events are posted under their own type,
+// and the requests are cancelled with the dispatch.
+func (w *WebhookHandler) HandleCtx(ctx context.Context, ev interface{}) error {
+	t, ok := EventTypeFromContext(ctx)
+	if !ok {
+		t, _ = EventTypeOf(ev)
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("handlers.WebhookHandler: %v: %w", t, err)
+	}
+	body, err := json.Marshal(WebhookEnvelope{Type: t.String(), Timestamp: now(), Event: data})
+	if err != nil {
+		return fmt.Errorf("handlers.WebhookHandler: %v: %w", t, err)
+	}
+
+	r := retrying{backoff: w.backoff}
+	for i := 0; ; i++ {
+		if i > 0 {
+			if werr := r.wait(ctx, i); werr != nil {
+				return fmt.Errorf("handlers.WebhookHandler: %v: %w", t, err)
+			}
+		}
+		var retry bool
+		retry, err = w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || i+1 >= w.attempts || ctx.Err() != nil {
+			return fmt.Errorf("handlers.WebhookHandler: %v: %w", t, err)
+		}
+	}
+}
+
+// post POSTs a body once, and returns whether a failure may be retried.
+func (w *WebhookHandler) post(ctx context.Context, body []byte) (bool, error) {
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header = w.header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != nil {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // so that the connection is reused
+	switch {
+	case resp.StatusCode >= 500:
+		return true, fmt.Errorf("POST %s: %s", w.url, resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return false, fmt.Errorf("POST %s: %s", w.url, resp.Status)
+	}
+	return false, nil
+}
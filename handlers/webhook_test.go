@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// webhookServer answers with the given statuses in turn, and then with 200, and records the
+// requests.
+type webhookServer struct {
+	statuses []int
+
+	mu       sync.Mutex
+	bodies   [][]byte
+	requests []*http.Request
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bodies = append(s.bodies, body)
+	s.requests = append(s.requests, r)
+	if len(s.statuses) > 0 {
+		w.WriteHeader(s.statuses[0])
+		s.statuses = s.statuses[1:]
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	clock := withFakeClock(t)
+	secret := []byte("s3cret")
+	for _, test := range []struct {
+		description  string
+		statuses     []int
+		wantRequests int
+		wantErr      string
+	}{
+		{
+			description:  "accepted",
+			wantRequests: 1,
+		},
+		{
+			description:  "retried on 5xx",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway},
+			wantRequests: 3,
+		},
+		{
+			description:  "failing on 5xx",
+			statuses:     []int{500, 500, 500},
+			wantRequests: 3,
+			wantErr:      "500 Internal Server Error",
+		},
+		{
+			description:  "not retried on 4xx",
+			statuses:     []int{http.StatusBadRequest},
+			wantRequests: 1,
+			wantErr:      "400 Bad Request",
+		},
+	} {
+		srv := &webhookServer{statuses: test.statuses}
+		ts := httptest.NewServer(srv)
+		d := New()
+		d.Register(AnyEvent, NewWebhookHandler(ts.URL, WebhookSecret(secret),
+			WebhookHeader("Authorization", "Bearer token"), WebhookRetries(3, time.Millisecond)))
+
+		err := d.Dispatch(message("M1"))
+		ts.Close()
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%v: Dispatch(_) = %v, need nil error", test.description, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("%v: Dispatch(_) = %v, want an error with %q", test.description, err, test.wantErr)
+		}
+		if len(srv.requests) != test.wantRequests {
+			t.Fatalf("%v: server got %d requests, want %d", test.description, len(srv.requests), test.wantRequests)
+		}
+
+		req, body := srv.requests[0], srv.bodies[0]
+		if got := req.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("%v: Authorization header = %q, want %q", test.description, got, "Bearer token")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		if got, want := req.Header.Get(WebhookSignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+			t.Errorf("%v: signature = %q, want %q", test.description, got, want)
+		}
+		var env WebhookEnvelope
+		if err := json.Unmarshal(body, &env); err != nil {
+			t.Fatalf("%v: json.Unmarshal(%s) = %v, need nil error", test.description, body, err)
+		}
+		if env.Type != "Message" || !env.Timestamp.Equal(*clock) {
+			t.Errorf("%v: envelope %q at %v, want Message at %v", test.description, env.Type, env.Timestamp, *clock)
+		}
+		var m events.Message
+		if err := json.Unmarshal(env.Event, &m); err != nil || m.Info.ID != "M1" {
+			t.Errorf("%v: event %s, want message M1 (%v)", test.description, env.Event, err)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+// Package history imports the history that WhatsApp syncs to a newly paired device into an SQLite
+// database: conversations, their messages and the push names of contacts.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/internal/sqlmigrate"
+	"github.com/KarelKubat/whatsmeow/msgkind"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// migrations are the schema of the imported history, see sqlmigrate.
+var migrations = []string{
+	`CREATE TABLE history_conversations (
+		jid          TEXT    NOT NULL PRIMARY KEY,
+		name         TEXT    NOT NULL,
+		unread_count INTEGER NOT NULL,
+		timestamp    INTEGER NOT NULL,
+		archived     INTEGER NOT NULL
+	);
+	CREATE TABLE history_messages (
+		chat           TEXT    NOT NULL,
+		id             TEXT    NOT NULL,
+		sender         TEXT    NOT NULL,
+		from_me        INTEGER NOT NULL,
+		timestamp      INTEGER NOT NULL,
+		text           TEXT    NOT NULL,
+		media_kind     TEXT,
+		media_mimetype TEXT,
+		media_size     INTEGER,
+		media_sha256   TEXT,
+		sync_type      TEXT    NOT NULL,
+		PRIMARY KEY (chat, id)
+	);
+	CREATE INDEX history_messages_chat_timestamp ON history_messages (chat, timestamp);
+	CREATE TABLE history_contacts (
+		jid       TEXT NOT NULL PRIMARY KEY,
+		push_name TEXT NOT NULL
+	);`,
+}
+
+// Conversation is an imported conversation.
+type Conversation struct {
+	JID         types.JID
+	Name        string // of groups, empty for DMs
+	UnreadCount int
+	Timestamp   time.Time // of the last activity
+	Archived    bool
+}
+
+// Media describes the media of a message.
+type Media struct {
+	Kind     string // "image", "video", "audio", "document" or "sticker"
+	Mimetype string
+	Size     int64
+	SHA256   string // hex
+}
+
+// Message is an imported message.
+type Message struct {
+	Chat      types.JID
+	ID        types.MessageID
+	Sender    types.JID // empty when FromMe: the history doesn't say which device sent it
+	FromMe    bool
+	Timestamp time.Time
+	Text      string // the text, or the caption of media
+	Media     *Media // nil for text messages
+	SyncType  waHistorySync.HistorySync_HistorySyncType
+}
+
+// Progress reports an imported chunk of the history.
+type Progress struct {
+	SyncType      waHistorySync.HistorySync_HistorySyncType
+	Chunk         int // ChunkOrder of the chunk
+	Percent       int // of the whole sync, as reported by WhatsApp
+	Conversations int // imported from the chunk
+	Messages      int
+	Contacts      int // push names of the chunk's list; those of senders aren't counted
+}
+
+// Opts configures an Importer.
+type Opts struct {
+	// SyncTypes are the types of syncs that are imported, all when empty. E.g. leave out
+	// waHistorySync.HistorySync_FULL to import only the recent history.
+	SyncTypes []waHistorySync.HistorySync_HistorySyncType
+
+	// OnProgress is invoked after each imported chunk. Optional.
+	OnProgress func(Progress)
+}
+
+// Importer is a handler for HistorySync events that imports the history into an SQLite
+// database. Each chunk is imported in one transaction. Chunks may overlap: messages and
+// conversations that are imported again are updated. Protocol messages, reactions and messages
+// without content (such as the stubs of group changes) aren't imported. The zero value isn't
+// usable, use New.
+type Importer struct {
+	db        *sql.DB
+	opts      Opts
+	syncTypes map[waHistorySync.HistorySync_HistorySyncType]bool
+}
+
+// New returns an importer into `db`, which must be an SQLite database. The tables are created or
+// migrated when needed.
+func New(ctx context.Context, db *sql.DB, opts Opts) (*Importer, error) {
+	if err := sqlmigrate.Up(ctx, db, "history_version", migrations); err != nil {
+		return nil, fmt.Errorf("history.New: %w", err)
+	}
+	imp := &Importer{db: db, opts: opts}
+	if len(opts.SyncTypes) > 0 {
+		imp.syncTypes = map[waHistorySync.HistorySync_HistorySyncType]bool{}
+		for _, t := range opts.SyncTypes {
+			imp.syncTypes[t] = true
+		}
+	}
+	return imp, nil
+}
+
+// Register registers the importer for HistorySync events.
+func (imp *Importer) Register() {
+	handlers.Register(handlers.HistorySync, imp)
+}
+
+// Handle implements handlers.handler for HistorySync events.
+func (imp *Importer) Handle(ev interface{}) error {
+	hs, ok := ev.(*events.HistorySync)
+	if !ok {
+		return fmt.Errorf("history.Importer.Handle: unexpected event %T", ev)
+	}
+	if hs.Data == nil || imp.syncTypes != nil && !imp.syncTypes[hs.Data.GetSyncType()] {
+		return nil
+	}
+	p, err := imp.importChunk(hs.Data)
+	if err != nil {
+		return fmt.Errorf("history.Importer.Handle: %v chunk %d: %w", hs.Data.GetSyncType(), hs.Data.GetChunkOrder(), err)
+	}
+	if imp.opts.OnProgress != nil {
+		imp.opts.OnProgress(p)
+	}
+	return nil
+}
+
+// importChunk imports a chunk of the history in one transaction.
+func (imp *Importer) importChunk(data *waHistorySync.HistorySync) (Progress, error) {
+	p := Progress{
+		SyncType: data.GetSyncType(),
+		Chunk:    int(data.GetChunkOrder()),
+		Percent:  int(data.GetProgress()),
+	}
+	tx, err := imp.db.Begin()
+	if err != nil {
+		return p, err
+	}
+	defer tx.Rollback()
+
+	for _, pn := range data.GetPushnames() {
+		jid, err := types.ParseJID(pn.GetID())
+		if err != nil || jid.IsEmpty() || pn.GetPushname() == "" {
+			continue // a bad push name isn't worth failing the chunk
+		}
+		if err := putContact(tx, jid.ToNonAD().String(), pn.GetPushname()); err != nil {
+			return p, err
+		}
+		p.Contacts++
+	}
+	for _, conv := range data.GetConversations() {
+		chat, err := parseChat(conv.GetID())
+		if err != nil {
+			return p, fmt.Errorf("conversation %q: %w", conv.GetID(), err)
+		}
+		_, err = tx.Exec(`INSERT INTO history_conversations (jid, name, unread_count, timestamp, archived)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (jid) DO UPDATE SET
+				name         = CASE WHEN excluded.name = '' THEN name ELSE excluded.name END,
+				unread_count = CASE WHEN ? THEN excluded.unread_count ELSE unread_count END,
+				timestamp    = MAX(timestamp, excluded.timestamp),
+				archived     = CASE WHEN ? THEN excluded.archived ELSE archived END`,
+			chat.String(), conv.GetName(), conv.GetUnreadCount(), int64(conv.GetConversationTimestamp())*1000, conv.GetArchived(),
+			conv.UnreadCount != nil, conv.Archived != nil) // chunks that leave them out don't reset them
+		if err != nil {
+			return p, fmt.Errorf("conversation %v: %w", chat, err)
+		}
+		p.Conversations++
+		for _, hm := range conv.GetMessages() {
+			stored, err := putMessage(tx, chat, hm.GetMessage(), p.SyncType)
+			if err != nil {
+				return p, fmt.Errorf("conversation %v: %w", chat, err)
+			}
+			if stored {
+				p.Messages++
+			}
+		}
+	}
+	return p, tx.Commit()
+}
+
+// chatServers are the servers of the JIDs of chats.
+var chatServers = map[string]bool{
+	types.DefaultUserServer: true,
+	types.GroupServer:       true,
+	types.LegacyUserServer:  true,
+	types.BroadcastServer:   true,
+	types.HiddenUserServer:  true,
+	types.NewsletterServer:  true,
+}
+
+// parseChat parses the JID of a conversation. types.ParseJID accepts about anything with an @,
+// so the user and server are checked too.
+func parseChat(s string) (types.JID, error) {
+	jid, err := types.ParseJID(s)
+	switch {
+	case err != nil:
+		return jid, err
+	case jid.User == "":
+		return jid, fmt.Errorf("no user")
+	case !chatServers[jid.Server]:
+		return jid, fmt.Errorf("unknown server %q", jid.Server)
+	}
+	return jid, nil
+}
+
+// putContact stores the push name of a contact.
+func putContact(tx *sql.Tx, jid, pushName string) error {
+	_, err := tx.Exec(`INSERT INTO history_contacts (jid, push_name) VALUES (?, ?)
+		ON CONFLICT (jid) DO UPDATE SET push_name = excluded.push_name`, jid, pushName)
+	if err != nil {
+		return fmt.Errorf("contact %v: %w", jid, err)
+	}
+	return nil
+}
+
+// putMessage stores a message of a conversation, and the push name of its sender. It returns
+// false for the messages that aren't stored.
+func putMessage(tx *sql.Tx, chat types.JID, wm *waWeb.WebMessageInfo, syncType waHistorySync.HistorySync_HistorySyncType) (bool, error) {
+	msg := msgkind.Unwrap(wm.GetMessage())
+	key := wm.GetKey()
+	if msg == nil || key.GetID() == "" || msg.ProtocolMessage != nil || msg.ReactionMessage != nil {
+		return false, nil
+	}
+	var sender types.JID
+	if !key.GetFromMe() {
+		sender = chat // in DMs
+		participant := key.GetParticipant()
+		if participant == "" {
+			participant = wm.GetParticipant()
+		}
+		if participant != "" {
+			var err error
+			if sender, err = types.ParseJID(participant); err != nil {
+				return false, fmt.Errorf("sender of %v: %w", key.GetID(), err)
+			}
+		}
+		sender = sender.ToNonAD()
+		if wm.GetPushName() != "" {
+			if err := putContact(tx, sender.String(), wm.GetPushName()); err != nil {
+				return false, err
+			}
+		}
+	}
+	var kind, mimetype, sha sql.NullString
+	var size sql.NullInt64
+	if k, md := mediaOf(msg); md != nil {
+		kind = sql.NullString{String: k, Valid: true}
+		mimetype = sql.NullString{String: md.GetMimetype(), Valid: true}
+		size = sql.NullInt64{Int64: int64(md.GetFileLength()), Valid: true}
+		sha = sql.NullString{String: hex.EncodeToString(md.GetFileSHA256()), Valid: true}
+	}
+	senderStr := ""
+	if !sender.IsEmpty() {
+		senderStr = sender.String()
+	}
+	_, err := tx.Exec(`INSERT INTO history_messages
+			(chat, id, sender, from_me, timestamp, text, media_kind, media_mimetype, media_size,
+			 media_sha256, sync_type)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat, id) DO UPDATE SET
+			sender         = excluded.sender,
+			from_me        = excluded.from_me,
+			timestamp      = excluded.timestamp,
+			text           = excluded.text,
+			media_kind     = excluded.media_kind,
+			media_mimetype = excluded.media_mimetype,
+			media_size     = excluded.media_size,
+			media_sha256   = excluded.media_sha256,
+			sync_type      = excluded.sync_type`,
+		chat.String(), key.GetID(), senderStr, key.GetFromMe(), int64(wm.GetMessageTimestamp())*1000,
+		textOf(msg), kind, mimetype, size, sha, syncType.String())
+	if err != nil {
+		return false, fmt.Errorf("message %v: %w", key.GetID(), err)
+	}
+	return true, nil
+}
+
+// Cursor is a position in a chat, in the order of MessagesForChat: by timestamp, and by ID for
+// messages with the same timestamp. The zero Cursor is the position after the newest message.
+type Cursor struct {
+	Timestamp time.Time
+	ID        types.MessageID
+}
+
+// Cursor returns the position of a message, to page back from it.
+func (m Message) Cursor() Cursor {
+	return Cursor{Timestamp: m.Timestamp, ID: m.ID}
+}
+
+// MessagesForChat returns up to `limit` messages of a chat that come before `before`, newest
+// first. A zero `before` starts at the newest message. To page back, pass the Cursor of the
+// oldest returned message; the history has timestamps in seconds, and messages within the same
+// second are neither skipped nor repeated.
+func (imp *Importer) MessagesForChat(chat types.JID, limit int, before Cursor) ([]Message, error) {
+	const columns = `SELECT id, sender, from_me, timestamp, text, media_kind, media_mimetype,
+			media_size, media_sha256, sync_type
+		FROM history_messages`
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if before == (Cursor{}) {
+		rows, err = imp.db.Query(columns+` WHERE chat = ? ORDER BY timestamp DESC, id DESC LIMIT ?`,
+			chat.String(), limit)
+	} else {
+		ts := before.Timestamp.UnixMilli()
+		rows, err = imp.db.Query(columns+` WHERE chat = ? AND (timestamp < ? OR (timestamp = ? AND id < ?))
+			ORDER BY timestamp DESC, id DESC LIMIT ?`,
+			chat.String(), ts, ts, before.ID, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("history.Importer.MessagesForChat: %w", err)
+	}
+	defer rows.Close()
+	var out []Message
+	for rows.Next() {
+		var (
+			id, sender, text, syncType string
+			fromMe                     bool
+			ts                         int64
+			kind, mimetype, sha        sql.NullString
+			size                       sql.NullInt64
+		)
+		if err := rows.Scan(&id, &sender, &fromMe, &ts, &text, &kind, &mimetype, &size, &sha, &syncType); err != nil {
+			return nil, fmt.Errorf("history.Importer.MessagesForChat: %w", err)
+		}
+		m := Message{
+			Chat:      chat,
+			ID:        id,
+			FromMe:    fromMe,
+			Timestamp: time.UnixMilli(ts),
+			Text:      text,
+			SyncType:  waHistorySync.HistorySync_HistorySyncType(waHistorySync.HistorySync_HistorySyncType_value[syncType]),
+		}
+		if sender != "" {
+			if m.Sender, err = types.ParseJID(sender); err != nil {
+				return nil, fmt.Errorf("history.Importer.MessagesForChat: %w", err)
+			}
+		}
+		if kind.Valid {
+			m.Media = &Media{Kind: kind.String, Mimetype: mimetype.String, Size: size.Int64, SHA256: sha.String}
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("history.Importer.MessagesForChat: %w", err)
+	}
+	return out, nil
+}
+
+// Conversations returns the imported conversations, the most recently active first.
+func (imp *Importer) Conversations() ([]Conversation, error) {
+	rows, err := imp.db.Query(`SELECT jid, name, unread_count, timestamp, archived
+		FROM history_conversations ORDER BY timestamp DESC, jid`)
+	if err != nil {
+		return nil, fmt.Errorf("history.Importer.Conversations: %w", err)
+	}
+	defer rows.Close()
+	var out []Conversation
+	for rows.Next() {
+		var (
+			jid, name string
+			unread    int
+			ts        int64
+			archived  bool
+		)
+		if err := rows.Scan(&jid, &name, &unread, &ts, &archived); err != nil {
+			return nil, fmt.Errorf("history.Importer.Conversations: %w", err)
+		}
+		c := Conversation{Name: name, UnreadCount: unread, Timestamp: time.UnixMilli(ts), Archived: archived}
+		if c.JID, err = types.ParseJID(jid); err != nil {
+			return nil, fmt.Errorf("history.Importer.Conversations: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("history.Importer.Conversations: %w", err)
+	}
+	return out, nil
+}
+
+// PushName returns the imported push name of a contact, or "" when there is none.
+func (imp *Importer) PushName(jid types.JID) (string, error) {
+	var name string
+	err := imp.db.QueryRow(`SELECT push_name FROM history_contacts WHERE jid = ?`, jid.ToNonAD().String()).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("history.Importer.PushName: %w", err)
+	}
+	return name, nil
+}
+
+// mediaFile is what the media messages have in common.
+type mediaFile interface {
+	GetMimetype() string
+	GetFileLength() uint64
+	GetFileSHA256() []byte
+}
+
+// mediaOf returns the kind and the media of a message, or nil when it carries none.
+func mediaOf(msg *waE2E.Message) (string, mediaFile) {
+	switch {
+	case msg.ImageMessage != nil:
+		return "image", msg.ImageMessage
+	case msg.VideoMessage != nil:
+		return "video", msg.VideoMessage
+	case msg.AudioMessage != nil:
+		return "audio", msg.AudioMessage
+	case msg.DocumentMessage != nil:
+		return "document", msg.DocumentMessage
+	case msg.StickerMessage != nil:
+		return "sticker", msg.StickerMessage
+	}
+	return "", nil
+}
+
+// textOf returns the text of a message, or the caption of its media.
+func textOf(msg *waE2E.Message) string {
+	switch {
+	case msg.GetConversation() != "":
+		return msg.GetConversation()
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetText()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetCaption()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetCaption()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetCaption()
+	}
+	return ""
+}
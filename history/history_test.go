@@ -0,0 +1,308 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open(_) = _, %v; need nil error", err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own in-memory database
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var (
+	dm    = types.NewJID("31611111111", types.DefaultUserServer)
+	group = types.NewJID("120363000000000000", types.GroupServer)
+	bob   = types.NewJID("31622222222", types.DefaultUserServer)
+	start = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// webMessage returns a message of the history, sent `secs` after start.
+func webMessage(id string, fromMe bool, participant string, secs int, msg *waE2E.Message) *waHistorySync.HistorySyncMsg {
+	wm := &waWeb.WebMessageInfo{
+		Key:              &waCommon.MessageKey{ID: proto.String(id), FromMe: proto.Bool(fromMe)},
+		Message:          msg,
+		MessageTimestamp: proto.Uint64(uint64(start.Unix()) + uint64(secs)),
+	}
+	if participant != "" {
+		wm.Key.Participant = proto.String(participant)
+		wm.PushName = proto.String("Bob")
+	}
+	return &waHistorySync.HistorySyncMsg{Message: wm}
+}
+
+func text(s string) *waE2E.Message {
+	return &waE2E.Message{Conversation: proto.String(s)}
+}
+
+func chunk(typ waHistorySync.HistorySync_HistorySyncType, order uint32, convs ...*waHistorySync.Conversation) *events.HistorySync {
+	return &events.HistorySync{Data: &waHistorySync.HistorySync{
+		SyncType:      typ.Enum(),
+		ChunkOrder:    proto.Uint32(order),
+		Progress:      proto.Uint32(order * 50),
+		Conversations: convs,
+	}}
+}
+
+// summary returns messages as "id:sender:text" lines, with "me" for own messages and a media
+// kind after the text.
+func summary(msgs []Message) string {
+	var lines []string
+	for _, m := range msgs {
+		sender := m.Sender.User
+		if m.FromMe {
+			sender = "me"
+		}
+		line := fmt.Sprintf("%v:%v:%v@%v", m.ID, sender, m.Text, m.Timestamp.Sub(start).Seconds())
+		if m.Media != nil {
+			line += fmt.Sprintf("[%v %v %v %v]", m.Media.Kind, m.Media.Mimetype, m.Media.Size, m.Media.SHA256)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, " ")
+}
+
+func TestImporter(t *testing.T) {
+	var progress []string
+	imp, err := New(context.Background(), openDB(t), Opts{OnProgress: func(p Progress) {
+		progress = append(progress, fmt.Sprintf("%v/%d/%d%%: %d %d %d", p.SyncType, p.Chunk, p.Percent, p.Conversations, p.Messages, p.Contacts))
+	}})
+	if err != nil {
+		t.Fatalf("New(_) = _, %v; need nil error", err)
+	}
+
+	first := chunk(waHistorySync.HistorySync_INITIAL_BOOTSTRAP, 1,
+		&waHistorySync.Conversation{
+			ID:                    proto.String(dm.String()),
+			UnreadCount:           proto.Uint32(2),
+			ConversationTimestamp: proto.Uint64(uint64(start.Unix()) + 3),
+			Messages: []*waHistorySync.HistorySyncMsg{
+				webMessage("D3", false, "", 3, &waE2E.Message{EphemeralMessage: &waE2E.FutureProofMessage{
+					Message: &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+						Caption:    proto.String("look"),
+						Mimetype:   proto.String("image/jpeg"),
+						FileLength: proto.Uint64(1234),
+						FileSHA256: []byte{0xab, 0xcd},
+					}},
+				}}),
+				webMessage("D2", true, "", 2, text("hi")),
+				webMessage("D1", false, "", 1, text("hello")),
+				webMessage("X1", false, "", 1, &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{Text: proto.String("👍")}}),
+				webMessage("S1", false, "", 1, nil), // a stub
+			},
+		},
+		&waHistorySync.Conversation{
+			ID:                    proto.String(group.String()),
+			Name:                  proto.String("Book club"),
+			ConversationTimestamp: proto.Uint64(uint64(start.Unix()) + 10),
+			Messages: []*waHistorySync.HistorySyncMsg{
+				webMessage("G1", false, types.NewADJID(bob.User, 0, 4).String(), 10, text("page 12")),
+			},
+		},
+	)
+	pushNames := &events.HistorySync{Data: &waHistorySync.HistorySync{
+		SyncType:   waHistorySync.HistorySync_PUSH_NAME.Enum(),
+		ChunkOrder: proto.Uint32(1),
+		Pushnames: []*waHistorySync.Pushname{
+			{ID: proto.String(dm.String()), Pushname: proto.String("Ally")},
+			{ID: proto.String("not a jid@"), Pushname: proto.String("Nobody")},
+		},
+	}}
+	// RECENT overlaps with INITIAL_BOOTSTRAP, and has an older message.
+	second := chunk(waHistorySync.HistorySync_RECENT, 2,
+		&waHistorySync.Conversation{
+			ID: proto.String(dm.String()),
+			Messages: []*waHistorySync.HistorySyncMsg{
+				webMessage("D1", false, "", 1, text("hello")),
+				webMessage("D0", false, "", -60, text("earlier")),
+			},
+		},
+	)
+	for _, ev := range []*events.HistorySync{first, pushNames, second} {
+		if err := imp.Handle(ev); err != nil {
+			t.Fatalf("Handle(%v) = %v, need nil error", ev.Data.GetSyncType(), err)
+		}
+	}
+
+	if got, want := strings.Join(progress, ", "),
+		"INITIAL_BOOTSTRAP/1/50%: 2 4 0, PUSH_NAME/1/0%: 0 0 1, RECENT/2/100%: 1 2 0"; got != want {
+		t.Errorf("progress %q, want %q", got, want)
+	}
+
+	for _, test := range []struct {
+		description string
+		chat        types.JID
+		limit       int
+		before      Cursor
+		want        string
+	}{
+		{
+			description: "DM",
+			chat:        dm,
+			limit:       10,
+			want:        "D3:31611111111:look@3[image image/jpeg 1234 abcd] D2:me:hi@2 D1:31611111111:hello@1 D0:31611111111:earlier@-60",
+		},
+		{
+			description: "DM paged",
+			chat:        dm,
+			limit:       2,
+			before:      Cursor{Timestamp: start.Add(2 * time.Second), ID: "D2"},
+			want:        "D1:31611111111:hello@1 D0:31611111111:earlier@-60",
+		},
+		{
+			description: "group, sender without device",
+			chat:        group,
+			limit:       10,
+			want:        "G1:31622222222:page 12@10",
+		},
+		{
+			description: "unknown chat",
+			chat:        bob,
+			limit:       10,
+		},
+	} {
+		msgs, err := imp.MessagesForChat(test.chat, test.limit, test.before)
+		if err != nil {
+			t.Errorf("%v: MessagesForChat(_) = _, %v, need nil error", test.description, err)
+		}
+		if got := summary(msgs); got != test.want {
+			t.Errorf("%v: MessagesForChat(_) = %q, want %q", test.description, got, test.want)
+		}
+		for _, m := range msgs {
+			if m.Chat != test.chat {
+				t.Errorf("%v: message %v in chat %v, want %v", test.description, m.ID, m.Chat, test.chat)
+			}
+		}
+	}
+	msgs, _ := imp.MessagesForChat(dm, 10, Cursor{})
+	if len(msgs) == 4 && (msgs[3].SyncType != waHistorySync.HistorySync_RECENT || msgs[0].SyncType != waHistorySync.HistorySync_INITIAL_BOOTSTRAP) {
+		t.Errorf("sync types %v and %v, want RECENT and INITIAL_BOOTSTRAP", msgs[3].SyncType, msgs[0].SyncType)
+	}
+
+	convs, err := imp.Conversations()
+	if err != nil {
+		t.Fatalf("Conversations() = _, %v, need nil error", err)
+	}
+	var got []string
+	for _, c := range convs {
+		got = append(got, fmt.Sprintf("%v %q %d %v", c.JID, c.Name, c.UnreadCount, c.Timestamp.Sub(start).Seconds()))
+	}
+	if got, want := strings.Join(got, ", "),
+		`120363000000000000@g.us "Book club" 0 10, 31611111111@s.whatsapp.net "" 2 3`; got != want {
+		t.Errorf("Conversations() = %q, want %q", got, want)
+	}
+
+	for _, test := range []struct {
+		jid  types.JID
+		want string
+	}{
+		{dm, "Ally"},
+		{types.NewADJID(bob.User, 0, 4), "Bob"},
+		{group, ""},
+	} {
+		if got, err := imp.PushName(test.jid); err != nil || got != test.want {
+			t.Errorf("PushName(%v) = %q, %v, want %q", test.jid, got, err, test.want)
+		}
+	}
+}
+
+func TestImporterSyncTypes(t *testing.T) {
+	imp, err := New(context.Background(), openDB(t), Opts{SyncTypes: []waHistorySync.HistorySync_HistorySyncType{waHistorySync.HistorySync_RECENT}})
+	if err != nil {
+		t.Fatalf("New(_) = _, %v; need nil error", err)
+	}
+	for _, typ := range []waHistorySync.HistorySync_HistorySyncType{waHistorySync.HistorySync_FULL, waHistorySync.HistorySync_RECENT} {
+		ev := chunk(typ, 1, &waHistorySync.Conversation{
+			ID:       proto.String(dm.String()),
+			Messages: []*waHistorySync.HistorySyncMsg{webMessage(typ.String(), false, "", 1, text("hello"))},
+		})
+		if err := imp.Handle(ev); err != nil {
+			t.Fatalf("Handle(%v) = %v, need nil error", typ, err)
+		}
+	}
+	msgs, err := imp.MessagesForChat(dm, 10, Cursor{})
+	if got := summary(msgs); err != nil || got != "RECENT:31611111111:hello@1" {
+		t.Errorf("MessagesForChat(_) = %q, %v, want only the RECENT message", got, err)
+	}
+}
+
+func TestMessagesForChatSameSecond(t *testing.T) {
+	imp, err := New(context.Background(), openDB(t), Opts{})
+	if err != nil {
+		t.Fatalf("New(_) = _, %v; need nil error", err)
+	}
+	ev := chunk(waHistorySync.HistorySync_FULL, 1, &waHistorySync.Conversation{
+		ID: proto.String(dm.String()),
+		Messages: []*waHistorySync.HistorySyncMsg{
+			webMessage("A", false, "", 1, text("one")),
+			webMessage("B", false, "", 1, text("two")),
+			webMessage("C", false, "", 1, text("three")),
+			webMessage("D", false, "", 0, text("before")),
+		},
+	})
+	if err := imp.Handle(ev); err != nil {
+		t.Fatalf("Handle(_) = %v, need nil error", err)
+	}
+	var (
+		ids    []string
+		cursor Cursor
+	)
+	for page := 0; page < 10; page++ {
+		msgs, err := imp.MessagesForChat(dm, 2, cursor)
+		if err != nil {
+			t.Fatalf("MessagesForChat(_) = _, %v; need nil error", err)
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		for _, m := range msgs {
+			ids = append(ids, m.ID)
+		}
+		cursor = msgs[len(msgs)-1].Cursor()
+	}
+	if got := strings.Join(ids, " "); got != "C B A D" {
+		t.Errorf("paged %q, want %q", got, "C B A D")
+	}
+}
+
+func TestImporterBadChunk(t *testing.T) {
+	imp, err := New(context.Background(), openDB(t), Opts{})
+	if err != nil {
+		t.Fatalf("New(_) = _, %v; need nil error", err)
+	}
+	ev := chunk(waHistorySync.HistorySync_FULL, 1,
+		&waHistorySync.Conversation{
+			ID:       proto.String(dm.String()),
+			Messages: []*waHistorySync.HistorySyncMsg{webMessage("D1", false, "", 1, text("hello"))},
+		},
+		&waHistorySync.Conversation{ID: proto.String("@@@")},
+	)
+	if err := imp.Handle(ev); err == nil {
+		t.Errorf("Handle(_) = nil for a bad conversation, want an error")
+	}
+	if msgs, _ := imp.MessagesForChat(dm, 10, Cursor{}); len(msgs) != 0 {
+		t.Errorf("MessagesForChat(_) = %q after a failed chunk, want nothing", summary(msgs))
+	}
+	if err := imp.Handle(&events.Connected{}); err == nil {
+		t.Errorf("Handle(*events.Connected) = nil, need error")
+	}
+}
@@ -0,0 +1,50 @@
+// Package sqlmigrate brings the SQLite schemas of the packages of this module up to date.
+//
+// A package lists its migrations in order: migration i brings the schema to version i+1. Never
+// change a released migration, add a new one. The version is kept in a table of its own.
+package sqlmigrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Up applies the migrations that `db` doesn't have yet, each in a transaction with the update
+// of the version in `versionTable`, which is created when needed.
+func Up(ctx context.Context, db *sql.DB, versionTable string, migrations []string) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+versionTable+` (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	var version int
+	err := db.QueryRowContext(ctx, `SELECT version FROM `+versionTable).Scan(&version)
+	if err == sql.ErrNoRows {
+		if _, err := db.ExecContext(ctx, `INSERT INTO `+versionTable+` (version) VALUES (0)`); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		if err := migrate(ctx, db, versionTable, version, migrations[version]); err != nil {
+			return fmt.Errorf("migrating to version %v: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+// migrate applies one migration.
+func migrate(ctx context.Context, db *sql.DB, versionTable string, version int, migration string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE `+versionTable+` SET version = ?`, version+1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,52 @@
+package sqlmigrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func version(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var v int
+	if err := db.QueryRow(`SELECT version FROM test_version`).Scan(&v); err != nil {
+		t.Fatalf("reading the version = %v, need nil error", err)
+	}
+	return v
+}
+
+func TestUp(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open(_) = _, %v; need nil error", err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own in-memory database
+	defer db.Close()
+	ctx := context.Background()
+
+	migrations := []string{`CREATE TABLE t (a INTEGER)`}
+	for _, test := range []struct {
+		description string
+		migrations  []string
+		wantErr     bool
+		wantVersion int
+	}{
+		{"new database", migrations, false, 1},
+		{"up to date", migrations, false, 1},
+		{"a new migration", append(migrations, `ALTER TABLE t ADD COLUMN b INTEGER`), false, 2},
+		{"a failing migration", append(migrations, `ALTER TABLE t ADD COLUMN b INTEGER`, `ALTER TABLE nope ADD COLUMN c INTEGER`), true, 2},
+	} {
+		err := Up(ctx, db, "test_version", test.migrations)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%v: Up(_) = %v, want error: %v", test.description, err, test.wantErr)
+		}
+		if v := version(t, db); v != test.wantVersion {
+			t.Errorf("%v: version %v, want %v", test.description, v, test.wantVersion)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO t (a, b) VALUES (1, 2)`); err != nil {
+		t.Errorf("inserting into the migrated table = %v, need nil error", err)
+	}
+}
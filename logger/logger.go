@@ -24,6 +24,14 @@ var (
 	openbits int            // os.OpenFile bitmask
 )
 
+// counts holds the number of logged messages per level, see Count.
+var counts = map[string]int64{}
+
+// Hook is invoked for every logged message, after it was written.
+type Hook func(level, module, msg string)
+
+var hooks []Hook
+
 // Opts allows the caller to configure a logger.
 type Opts struct {
 	Module   string // logged module name
@@ -101,13 +109,37 @@ func (l *logger) Sub(module string) waLog.Logger {
 	}
 }
 
+// Count returns how many messages were logged at a level ("ERROR", "WARN", "INFO" or "DEBUG") by
+// all loggers. Suppressed debug messages aren't counted.
+func Count(level string) int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return counts[level]
+}
+
+// AddHook adds a hook that is run for every message that any logger writes, e.g. to forward
+// errors. Hooks run outside the lock of the logger, so they may log themselves.
+func AddHook(h Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, h)
+}
+
 func output(level, module string, send bool, msg string) {
 	if !send {
 		return
 	}
+	for _, h := range write(level, module, msg) {
+		h(level, module, msg)
+	}
+}
+
+// write writes a message and returns the hooks to run.
+func write(level, module, msg string) []Hook {
 	mu.Lock()
 	defer mu.Unlock()
 
+	counts[level]++
 	_, err := os.Stat(filename)
 	if err != nil || !opened {
 		writer, err = os.OpenFile(filename, openbits, 0644)
@@ -116,4 +148,5 @@ func output(level, module string, send bool, msg string) {
 		}
 	}
 	writer.Write([]byte(fmt.Sprintf("%s [%s %s] %s\n", time.Now().Format(timeFormat), module, level, msg)))
+	return hooks
 }
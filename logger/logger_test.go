@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"fmt"
 	"os"
 	"strings"
 	"sync"
@@ -116,3 +117,57 @@ func TestVerbose(t *testing.T) {
 	}
 	os.Remove("/tmp/logger_test.log")
 }
+
+// TestCount checks that logged messages are counted per level.
+func TestCount(t *testing.T) {
+	l, err := New(Opts{
+		Module:   "Main",
+		Filename: "/tmp/logger_count_test.log",
+	})
+	if err != nil {
+		t.Fatalf("New(_) = %v, need nil error", err)
+	}
+	defer os.Remove("/tmp/logger_count_test.log")
+	defer l.Close()
+
+	errors, debugs := Count("ERROR"), Count("DEBUG")
+	l.Errorf("one")
+	l.Errorf("two")
+	l.Debugf("suppressed")
+	if got := Count("ERROR") - errors; got != 2 {
+		t.Errorf("Count(ERROR) grew by %v, want 2", got)
+	}
+	if got := Count("DEBUG") - debugs; got != 0 {
+		t.Errorf("Count(DEBUG) grew by %v, want 0", got)
+	}
+}
+
+// TestHook checks that hooks see logged messages and may log themselves.
+func TestHook(t *testing.T) {
+	l, err := New(Opts{
+		Module:   "Main",
+		Filename: "/tmp/logger_hook_test.log",
+	})
+	if err != nil {
+		t.Fatalf("New(_) = %v, need nil error", err)
+	}
+	defer os.Remove("/tmp/logger_hook_test.log")
+	defer l.Close()
+
+	var got []string
+	AddHook(func(level, module, msg string) {
+		if module != "Main/Hooked" {
+			return
+		}
+		got = append(got, level+" "+msg)
+		if level == "ERROR" {
+			l.Infof("logged from a hook")
+		}
+	})
+	sub := l.Sub("Hooked")
+	sub.Errorf("boom %d", 1)
+	sub.Debugf("suppressed")
+	if want := "[ERROR boom 1]"; fmt.Sprint(got) != want {
+		t.Errorf("hooks saw %v, want %v", got, want)
+	}
+}
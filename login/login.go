@@ -0,0 +1,194 @@
+// Package login pairs a client without a session by having the user scan QR codes with their
+// phone: it renders the codes as they come in, and reports how the pairing went.
+package login
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"github.com/skip2/go-qrcode"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+var (
+	// ErrTimeout is returned when none of the codes was scanned in time.
+	ErrTimeout = errors.New("login: no QR code was scanned in time")
+
+	// ErrScannedWithoutMultidevice is returned when a code was scanned by a phone without
+	// multidevice. The codes stay valid, so after enabling multidevice, the user can scan again.
+	ErrScannedWithoutMultidevice = errors.New("login: QR code scanned by a phone without multidevice")
+)
+
+// PairError is returned when the phone scanned a code, but finishing the pairing failed.
+type PairError struct {
+	ID  types.JID
+	Err error
+}
+
+func (e *PairError) Error() string {
+	return fmt.Sprintf("login: pairing %v failed: %v", e.ID, e.Err)
+}
+
+func (e *PairError) Unwrap() error {
+	return e.Err
+}
+
+// Defaults of Opts.
+const (
+	DefaultFirstCodeTTL = 60 * time.Second
+	DefaultCodeTTL      = 20 * time.Second
+	DefaultPNGSize      = 256
+)
+
+// Connector connects a client, such as a *whatsmeow.Client, whose events go to the dispatcher.
+type Connector interface {
+	Connect() error
+}
+
+// Opts configures QR.
+type Opts struct {
+	ASCII        io.Writer         // when set, the codes are rendered here as text, e.g. os.Stdout
+	PNG          string            // when set, the codes are saved here as PNG images
+	PNGSize      int               // of the images in pixels, DefaultPNGSize when zero
+	OnCode       func(code string) // when set, invoked with each code, e.g. to render it elsewhere
+	FirstCodeTTL time.Duration     // how long the first code of a batch is valid, DefaultFirstCodeTTL when zero
+	CodeTTL      time.Duration     // how long the other codes are valid, DefaultCodeTTL when zero
+}
+
+// QR connects a client that has no session, and renders the QR codes that WhatsApp sends until
+// the user scans one with their phone. It returns the JID of the paired device, or an error:
+// ErrTimeout, ErrScannedWithoutMultidevice, a *PairError, the error of connecting, or that of the
+// context when it is done. It registers handlers for the QR, PairSuccess, PairError and
+// QRScannedWithoutMultidevice events of `d`, which must get the client's events, and unregisters
+// them before returning. Each code is rendered when the previous one expires, and a new batch of
+// codes replaces the current one.
+//
+//	if client.Store.ID == nil {
+//		jid, err := login.QR(ctx, client, d, login.Opts{ASCII: os.Stdout})
+//		...
+//	}
+func QR(ctx context.Context, client Connector, d *handlers.Dispatcher, opts Opts) (types.JID, error) {
+	if opts.FirstCodeTTL <= 0 {
+		opts.FirstCodeTTL = DefaultFirstCodeTTL
+	}
+	if opts.CodeTTL <= 0 {
+		opts.CodeTTL = DefaultCodeTTL
+	}
+	if opts.PNGSize <= 0 {
+		opts.PNGSize = DefaultPNGSize
+	}
+
+	w, stop := listen(d, handlers.QR, handlers.PairSuccess, handlers.PairError, handlers.QRScannedWithoutMultidevice)
+	defer stop()
+	// Connecting may dispatch events before it returns, so it runs aside.
+	connected := make(chan error, 1)
+	go func() { connected <- client.Connect() }()
+
+	var codes []string
+	expiry := time.NewTimer(time.Hour)
+	expiry.Stop()
+	defer expiry.Stop()
+	// show shows the next code, or fails when there is none.
+	show := func(ttl time.Duration) error {
+		if len(codes) == 0 {
+			return ErrTimeout
+		}
+		code := codes[0]
+		codes = codes[1:]
+		if err := render(code, opts); err != nil {
+			return fmt.Errorf("login.QR: %w", err)
+		}
+		if !expiry.Stop() {
+			select { // drop an expiry that is replaced
+			case <-expiry.C:
+			default:
+			}
+		}
+		expiry.Reset(ttl)
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return types.JID{}, ctx.Err()
+		case err := <-connected:
+			if err != nil {
+				return types.JID{}, fmt.Errorf("login.QR: %w", err)
+			}
+			connected = nil
+		case <-expiry.C:
+			if err := show(opts.CodeTTL); err != nil {
+				return types.JID{}, err
+			}
+		case ev := <-w.events:
+			switch v := ev.(type) {
+			case *events.QR:
+				codes = v.Codes
+				if err := show(opts.FirstCodeTTL); err != nil {
+					return types.JID{}, err
+				}
+			case *events.PairSuccess:
+				return v.ID, nil
+			case *events.PairError:
+				return types.JID{}, &PairError{ID: v.ID, Err: v.Error}
+			case *events.QRScannedWithoutMultidevice:
+				return types.JID{}, ErrScannedWithoutMultidevice
+			}
+		}
+	}
+}
+
+// render renders a code as configured.
+func render(code string, opts Opts) error {
+	if opts.OnCode != nil {
+		opts.OnCode(code)
+	}
+	if opts.ASCII != nil {
+		q, err := qrcode.New(code, qrcode.Low)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(opts.ASCII, q.ToSmallString(false)); err != nil {
+			return err
+		}
+	}
+	if opts.PNG != "" {
+		if err := qrcode.WriteFile(code, qrcode.Medium, opts.PNGSize, opts.PNG); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waiter is a handler that passes the events on, until it is stopped.
+type waiter struct {
+	events chan interface{}
+	done   chan struct{}
+}
+
+// listen registers a waiter for event types, and returns it and the function that stops it.
+func listen(d *handlers.Dispatcher, evTypes ...handlers.EventType) (*waiter, func()) {
+	w := &waiter{events: make(chan interface{}), done: make(chan struct{})}
+	d.RegisterMany(evTypes, w)
+	return w, func() {
+		close(w.done)
+		for _, t := range evTypes {
+			d.Unregister(t, w)
+		}
+	}
+}
+
+// Handle implements handlers.handler.
+func (w *waiter) Handle(ev interface{}) error {
+	select {
+	case w.events <- ev:
+	case <-w.done:
+	}
+	return nil
+}
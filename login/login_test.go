@@ -0,0 +1,139 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// fakeClient dispatches scripted events when it connects, as whatsmeow does.
+type fakeClient struct {
+	d      *handlers.Dispatcher
+	events []interface{}
+	err    error
+}
+
+func (c *fakeClient) Connect() error {
+	if c.err != nil {
+		return c.err
+	}
+	go func() {
+		for _, ev := range c.events {
+			c.d.Dispatch(ev)
+		}
+	}()
+	return nil
+}
+
+func TestQR(t *testing.T) {
+	jid := types.NewJID("31612345678", types.DefaultUserServer)
+	pairErr := errors.New("bad signature")
+	for _, test := range []struct {
+		description string
+		events      []interface{}
+		connectErr  error
+		ttl         time.Duration // of the codes, long unless they should expire
+		wantJID     types.JID
+		wantErr     error
+		wantCodes   string
+	}{
+		{
+			description: "paired",
+			events:      []interface{}{&events.QR{Codes: []string{"c1", "c2"}}, &events.PairSuccess{ID: jid}},
+			wantJID:     jid,
+			wantCodes:   "c1",
+		},
+		{
+			description: "refreshed",
+			events: []interface{}{
+				&events.QR{Codes: []string{"c1", "c2"}}, &events.QR{Codes: []string{"d1"}}, &events.PairSuccess{ID: jid},
+			},
+			wantJID:   jid,
+			wantCodes: "c1 d1",
+		},
+		{
+			description: "expired",
+			events:      []interface{}{&events.QR{Codes: []string{"c1", "c2", "c3"}}},
+			ttl:         10 * time.Millisecond,
+			wantErr:     ErrTimeout,
+			wantCodes:   "c1 c2 c3",
+		},
+		{
+			description: "without multidevice",
+			events:      []interface{}{&events.QR{Codes: []string{"c1"}}, &events.QRScannedWithoutMultidevice{}},
+			wantErr:     ErrScannedWithoutMultidevice,
+			wantCodes:   "c1",
+		},
+		{
+			description: "pair error",
+			events:      []interface{}{&events.QR{Codes: []string{"c1"}}, &events.PairError{ID: jid, Error: pairErr}},
+			wantErr:     pairErr,
+			wantCodes:   "c1",
+		},
+		{
+			description: "not connected",
+			connectErr:  errors.New("no network"),
+			wantErr:     errors.New("no network"),
+		},
+	} {
+		if test.ttl == 0 {
+			test.ttl = time.Minute
+		}
+		d := handlers.New()
+		var codes []string
+		var ascii strings.Builder
+		png := filepath.Join(t.TempDir(), "qr.png")
+		jid, err := QR(context.Background(), &fakeClient{d: d, events: test.events, err: test.connectErr}, d, Opts{
+			ASCII:        &ascii,
+			PNG:          png,
+			OnCode:       func(code string) { codes = append(codes, code) },
+			FirstCodeTTL: test.ttl,
+			CodeTTL:      test.ttl,
+		})
+		switch {
+		case test.wantErr == nil && err != nil:
+			t.Errorf("%v: QR(_) = _, %v, need nil error", test.description, err)
+		case test.wantErr != nil && (err == nil || !errors.Is(err, test.wantErr) && !strings.Contains(err.Error(), test.wantErr.Error())):
+			t.Errorf("%v: QR(_) = _, %v, want %v", test.description, err, test.wantErr)
+		}
+		if jid != test.wantJID {
+			t.Errorf("%v: QR(_) = %v, want %v", test.description, jid, test.wantJID)
+		}
+		if got := strings.Join(codes, " "); got != test.wantCodes {
+			t.Errorf("%v: codes %q, want %q", test.description, got, test.wantCodes)
+		}
+		if test.wantCodes == "" {
+			continue
+		}
+		if ascii.Len() == 0 {
+			t.Errorf("%v: no ASCII rendering", test.description)
+		}
+		if _, err := os.Stat(png); err != nil {
+			t.Errorf("%v: os.Stat(%q) = %v, need nil error", test.description, png, err)
+		}
+		for _, tp := range []handlers.EventType{handlers.QR, handlers.PairSuccess} {
+			if d.HasHandler(tp) {
+				t.Errorf("%v: HasHandler(%v) = true after QR returned, want false", test.description, tp)
+			}
+		}
+	}
+}
+
+func TestQRCancel(t *testing.T) {
+	d := handlers.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &fakeClient{d: d, events: []interface{}{&events.QR{Codes: []string{"c1"}}}}
+	_, err := QR(ctx, client, d, Opts{OnCode: func(string) { cancel() }})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("QR(_) = _, %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,137 @@
+package login
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Defaults of PairOpts.
+const (
+	DefaultPairTimeout = 160 * time.Second // when WhatsApp closes the login websocket
+	DefaultClientName  = "Chrome (Linux)"
+)
+
+// PhonePairer connects a client, such as a *whatsmeow.Client, requests pairing codes, and
+// disconnects the client when pairing fails.
+type PhonePairer interface {
+	Connector
+	Disconnect()
+	PairPhone(phone string, showPushNotification bool, clientType whatsmeow.PairClientType, clientDisplayName string) (string, error)
+}
+
+// PairOpts configures PairCode.
+type PairOpts struct {
+	Timeout            time.Duration            // of waiting for the pairing, DefaultPairTimeout when zero
+	NoPushNotification bool                     // don't notify the phone of the code
+	ClientType         whatsmeow.PairClientType // shown on the phone, whatsmeow.PairClientChrome when zero
+	ClientName         string                   // shown on the phone as "Browser (OS)", DefaultClientName when empty
+}
+
+// normalizePhone returns the digits of a phone number in international format, e.g.
+// "+31 6 1234-5678", or fails.
+func normalizePhone(phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9':
+			return r
+		case r == '+' || r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+			return -1
+		}
+		return 'x'
+	}, phone)
+	switch {
+	case strings.ContainsRune(digits, 'x'):
+		return "", fmt.Errorf("phone number %q has characters other than digits, spaces, dashes and a leading +", phone)
+	case strings.HasPrefix(digits, "0"):
+		return "", fmt.Errorf("phone number %q must be in international format, with the country code but without leading zeros, e.g. +31612345678", phone)
+	case len(digits) < 7 || len(digits) > 15:
+		return "", fmt.Errorf("phone number %q must have 7 to 15 digits, including the country code", phone)
+	}
+	return digits, nil
+}
+
+// PairCode connects a client that has no session, and requests a code for pairing it with the
+// phone of a number in international format, e.g. "+31612345678". The user enters the code on the
+// phone, under Linked devices. The result of the pairing arrives on `done`: nil, a *PairError,
+// ErrTimeout, or the error of the context when it is done. When the code can't be requested,
+// e.g. because the number is invalid, the code is empty and `done` has the error right away.
+// When pairing fails after connecting, the client is disconnected, since it has no session.
+// PairCode registers handlers for the PairSuccess and PairError events of `d`, which must get the
+// client's events, and unregisters them when the pairing is done.
+//
+//	code, done := login.PairCode(ctx, client, d, "+31612345678", login.PairOpts{})
+//	if code != "" {
+//		fmt.Println("Enter this code on your phone:", code)
+//	}
+//	if err := <-done; err != nil {
+//		log.Fatal(err)
+//	}
+func PairCode(ctx context.Context, client PhonePairer, d *handlers.Dispatcher, phone string, opts PairOpts) (code string, done <-chan error) {
+	result := make(chan error, 1)
+	fail := func(err error) (string, <-chan error) {
+		result <- fmt.Errorf("login.PairCode: %w", err)
+		return "", result
+	}
+	digits, err := normalizePhone(phone)
+	if err != nil {
+		return fail(err)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultPairTimeout
+	}
+	if opts.ClientType == whatsmeow.PairClientUnknown {
+		opts.ClientType = whatsmeow.PairClientChrome
+	}
+	if opts.ClientName == "" {
+		opts.ClientName = DefaultClientName
+	}
+
+	w, stop := listen(d, handlers.PairSuccess, handlers.PairError)
+	if err := client.Connect(); err != nil {
+		stop()
+		return fail(err)
+	}
+	code, err = client.PairPhone(digits, !opts.NoPushNotification, opts.ClientType, opts.ClientName)
+	if err != nil {
+		stop()
+		client.Disconnect()
+		return fail(err)
+	}
+	go func() {
+		err := w.pairing(ctx, opts.Timeout)
+		stop()
+		if err != nil {
+			client.Disconnect()
+		}
+		result <- err
+	}()
+	return code, result
+}
+
+// pairing waits for the result of a pairing.
+func (w *waiter) pairing(ctx context.Context, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return ErrTimeout
+		case ev := <-w.events:
+			switch v := ev.(type) {
+			case *events.PairSuccess:
+				return nil
+			case *events.PairError:
+				return &PairError{ID: v.ID, Err: v.Error}
+			}
+		}
+	}
+}
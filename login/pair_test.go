@@ -0,0 +1,123 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// fakePairer records the pairing codes that are requested, and the disconnects.
+type fakePairer struct {
+	err         error
+	phones      []string
+	disconnects int
+}
+
+func (p *fakePairer) Connect() error { return nil }
+
+func (p *fakePairer) Disconnect() { p.disconnects++ }
+
+func (p *fakePairer) PairPhone(phone string, push bool, clientType whatsmeow.PairClientType, name string) (string, error) {
+	p.phones = append(p.phones, phone)
+	if p.err != nil {
+		return "", p.err
+	}
+	return "ABCD-EFGH", nil
+}
+
+func TestPairCode(t *testing.T) {
+	jid := types.NewJID("31612345678", types.DefaultUserServer)
+	pairErr := errors.New("bad signature")
+	for _, test := range []struct {
+		description    string
+		phone          string
+		pairPhone      error
+		event          interface{}
+		wantPhones     string
+		wantCode       string
+		wantErr        string
+		wantDisconnect bool
+	}{
+		{
+			description: "paired",
+			phone:       "+31 6 1234-5678",
+			event:       &events.PairSuccess{ID: jid},
+			wantPhones:  "31612345678",
+			wantCode:    "ABCD-EFGH",
+		},
+		{
+			description:    "pair error",
+			phone:          "+31612345678",
+			event:          &events.PairError{ID: jid, Error: pairErr},
+			wantPhones:     "31612345678",
+			wantCode:       "ABCD-EFGH",
+			wantErr:        "bad signature",
+			wantDisconnect: true,
+		},
+		{
+			description:    "timed out",
+			phone:          "+31612345678",
+			wantPhones:     "31612345678",
+			wantCode:       "ABCD-EFGH",
+			wantErr:        ErrTimeout.Error(),
+			wantDisconnect: true,
+		},
+		{
+			description:    "code refused",
+			phone:          "+31612345678",
+			pairPhone:      errors.New("rate limited"),
+			wantPhones:     "31612345678",
+			wantErr:        "rate limited",
+			wantDisconnect: true,
+		},
+		{description: "national format", phone: "0612345678", wantErr: "international format"},
+		{description: "letters", phone: "+31 6 CALL ME", wantErr: "characters other than digits"},
+		{description: "too short", phone: "+31 6", wantErr: "7 to 15 digits"},
+		{description: "too long", phone: "+31 6123 4567 8901 23", wantErr: "7 to 15 digits"},
+	} {
+		d := handlers.New()
+		client := &fakePairer{err: test.pairPhone}
+		code, done := PairCode(context.Background(), client, d, test.phone, PairOpts{Timeout: 50 * time.Millisecond})
+		if code != test.wantCode {
+			t.Errorf("%v: PairCode(%q) = %q, want %q", test.description, test.phone, code, test.wantCode)
+		}
+		if got := strings.Join(client.phones, " "); got != test.wantPhones {
+			t.Errorf("%v: requested codes for %q, want %q", test.description, got, test.wantPhones)
+		}
+		if test.event != nil {
+			if err := d.Dispatch(test.event); err != nil {
+				t.Errorf("%v: Dispatch(%T) = %v, need nil error", test.description, test.event, err)
+			}
+		}
+		err := <-done
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%v: <-done = %v, need nil error", test.description, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("%v: <-done = %v, want an error with %q", test.description, err, test.wantErr)
+		}
+		if d.HasHandler(handlers.PairSuccess) {
+			t.Errorf("%v: HasHandler(PairSuccess) = true after pairing, want false", test.description)
+		}
+		if got := client.disconnects > 0; got != test.wantDisconnect {
+			t.Errorf("%v: disconnected %v times, want a disconnect: %v", test.description, client.disconnects, test.wantDisconnect)
+		}
+	}
+}
+
+func TestPairCodeCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	_, done := PairCode(ctx, &fakePairer{}, handlers.New(), "+31612345678", PairOpts{})
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("<-done = %v, want %v", err, context.Canceled)
+	}
+}
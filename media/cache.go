@@ -0,0 +1,193 @@
+package media
+
+import (
+	"container/list"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// indexFile is the name of the index in the cache directory.
+const indexFile = "index.json"
+
+// Cache keeps downloaded media in a directory, keyed by the SHA256 of their content, so that the
+// same media are downloaded once, also when they are forwarded to many chats. When the cache
+// grows beyond its size, the least recently used files are removed. The cache survives restarts.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	lru      *list.List               // of *cacheEntry, most recently used at the front
+	entries  map[string]*list.Element // by hash
+	total    int64
+	inflight map[string]*download
+}
+
+type cacheEntry struct {
+	Hash string `json:"sha256"`
+	Size int64  `json:"size"`
+}
+
+// download is a download in progress, which concurrent requests for the same media wait for.
+type download struct {
+	done chan struct{}
+	path string
+	err  error
+}
+
+// NewCache returns a cache in `dir` of at most `maxBytes`, loading its index when present.
+func NewCache(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("media.NewCache: %w", err)
+	}
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		inflight: map[string]*download{},
+	}
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("media.NewCache: %w", err)
+	}
+	var index []cacheEntry // least recently used first
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("media.NewCache: reading index: %w", err)
+	}
+	for i := range index {
+		e := index[i]
+		if st, err := os.Stat(c.path(e.Hash)); err != nil || st.Size() != e.Size {
+			continue // gone or damaged
+		}
+		c.entries[e.Hash] = c.lru.PushFront(&e)
+		c.total += e.Size
+	}
+	return c, nil
+}
+
+// GetOrDownload returns the path of the cached media of a message, downloading them using Save
+// when they're not cached. `f` is the Fetcher for Save; nil means HTTPFetcher. Concurrent
+// requests for the same media share one download.
+func (c *Cache) GetOrDownload(ctx context.Context, f Fetcher, msg whatsmeow.DownloadableMessage) (string, error) {
+	if len(msg.GetFileSHA256()) == 0 {
+		return "", errors.New("media.Cache.GetOrDownload: message has no file hash")
+	}
+	hash := hex.EncodeToString(msg.GetFileSHA256())
+
+	c.mu.Lock()
+	if p, ok := c.hit(hash); ok {
+		c.mu.Unlock()
+		return p, nil
+	}
+	if d, ok := c.inflight[hash]; ok {
+		c.mu.Unlock()
+		select {
+		case <-d.done:
+			return d.path, d.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	d := &download{done: make(chan struct{})}
+	c.inflight[hash] = d
+	c.mu.Unlock()
+
+	d.path, d.err = c.fetch(ctx, f, msg, hash)
+
+	c.mu.Lock()
+	delete(c.inflight, hash)
+	c.mu.Unlock()
+	close(d.done)
+	return d.path, d.err
+}
+
+// Lookup returns the path of cached media by the SHA256 of their content, without downloading
+// them when they're not cached.
+func (c *Cache) Lookup(sha256 []byte) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hit(hex.EncodeToString(sha256))
+}
+
+// hit returns the path of a cached file and marks it as used. The caller holds the lock. The
+// index isn't saved, hits are too frequent for that: the new order is saved with the next
+// download. A damaged file is dropped from the index when it is loaded.
+func (c *Cache) hit(hash string) (string, bool) {
+	el, ok := c.entries[hash]
+	if !ok {
+		return "", false
+	}
+	e := el.Value.(*cacheEntry)
+	p := c.path(hash)
+	if st, err := os.Stat(p); err != nil || st.Size() != e.Size {
+		c.remove(el)
+		return "", false
+	}
+	c.lru.MoveToFront(el)
+	return p, true
+}
+
+// fetch downloads media into the cache.
+func (c *Cache) fetch(ctx context.Context, f Fetcher, msg whatsmeow.DownloadableMessage, hash string) (string, error) {
+	p := c.path(hash)
+	if err := Save(ctx, msg, p, SaveOpts{Fetcher: f}); err != nil {
+		return "", fmt.Errorf("media.Cache.GetOrDownload: %w", err)
+	}
+	st, err := os.Stat(p)
+	if err != nil {
+		return "", fmt.Errorf("media.Cache.GetOrDownload: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &cacheEntry{Hash: hash, Size: st.Size()}
+	c.entries[hash] = c.lru.PushFront(e)
+	c.total += e.Size
+	// Evict, but never what was just downloaded.
+	for c.total > c.maxBytes && c.lru.Len() > 1 {
+		c.remove(c.lru.Back())
+	}
+	c.saveIndex()
+	return p, nil
+}
+
+// remove drops an entry and its file. The caller holds the lock.
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.Hash)
+	c.total -= e.Size
+	os.Remove(c.path(e.Hash))
+}
+
+// saveIndex writes the index, least recently used first. The caller holds the lock. Failing to
+// write the index isn't fatal: the cache then starts empty after a restart.
+func (c *Cache) saveIndex() {
+	var index []cacheEntry
+	for el := c.lru.Back(); el != nil; el = el.Prev() {
+		index = append(index, *el.Value.(*cacheEntry))
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return
+	}
+	tmp := filepath.Join(c.dir, indexFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err == nil {
+		os.Rename(tmp, filepath.Join(c.dir, indexFile))
+	}
+}
+
+func (c *Cache) path(hash string) string {
+	return filepath.Join(c.dir, hash)
+}
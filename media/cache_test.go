@@ -0,0 +1,183 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// countingFetcher serves fixtures by URL and counts the fetches.
+type countingFetcher struct {
+	mu      sync.Mutex
+	data    map[string][]byte
+	fetches map[string]int
+	delay   time.Duration
+}
+
+func (f *countingFetcher) Fetch(ctx context.Context, url string, offset int64) (io.ReadCloser, int64, bool, error) {
+	f.mu.Lock()
+	f.fetches[url]++
+	data, ok := f.data[url]
+	f.mu.Unlock()
+	if !ok {
+		return nil, 0, false, fmt.Errorf("no such URL %v", url)
+	}
+	time.Sleep(f.delay)
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), false, nil
+}
+
+// cacheFixtures returns n fixtures of 1000 bytes and a fetcher that serves them.
+func cacheFixtures(t *testing.T, n int) ([]*fixture, *countingFetcher) {
+	f := &countingFetcher{data: map[string][]byte{}, fetches: map[string]int{}}
+	var fxs []*fixture
+	for i := 0; i < n; i++ {
+		fx := fixtureOf(t, bytes.Repeat([]byte{byte('a' + i)}, 1000))
+		fx.msg.DirectPath = proto.String(fmt.Sprintf("/doc%v", i))
+		f.data[DefaultHost+fx.msg.GetDirectPath()] = fx.enc
+		fxs = append(fxs, fx)
+	}
+	return fxs, f
+}
+
+func (f *countingFetcher) count(fx *fixture) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches[DefaultHost+fx.msg.GetDirectPath()]
+}
+
+func TestCacheHitAndMiss(t *testing.T) {
+	fxs, f := cacheFixtures(t, 1)
+	c, err := NewCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("NewCache(_) = _, %v; need nil error", err)
+	}
+	if p, ok := c.Lookup(fxs[0].msg.GetFileSHA256()); ok {
+		t.Errorf("Lookup(_) = %v, true before downloading, want false", p)
+	}
+	for i := 0; i < 3; i++ {
+		p, err := c.GetOrDownload(context.Background(), f, fxs[0].msg)
+		if err != nil {
+			t.Fatalf("GetOrDownload(_) = _, %v; need nil error", err)
+		}
+		if got, _ := os.ReadFile(p); !bytes.Equal(got, fxs[0].plain) {
+			t.Errorf("GetOrDownload(_) = %v, which has the wrong content", p)
+		}
+	}
+	if n := f.count(fxs[0]); n != 1 {
+		t.Errorf("media fetched %v times, want 1", n)
+	}
+	if _, ok := c.Lookup(fxs[0].msg.GetFileSHA256()); !ok {
+		t.Errorf("Lookup(_) = false after downloading, want true")
+	}
+}
+
+func TestCacheEvictionAndRestart(t *testing.T) {
+	fxs, f := cacheFixtures(t, 3)
+	dir := t.TempDir()
+	c, err := NewCache(dir, 2000) // room for two
+	if err != nil {
+		t.Fatalf("NewCache(_) = _, %v; need nil error", err)
+	}
+	get := func(c *Cache, fx *fixture) {
+		t.Helper()
+		if _, err := c.GetOrDownload(context.Background(), f, fx.msg); err != nil {
+			t.Fatalf("GetOrDownload(_) = _, %v; need nil error", err)
+		}
+	}
+	get(c, fxs[0])
+	get(c, fxs[1])
+	get(c, fxs[0]) // 0 is now more recently used than 1
+	get(c, fxs[2]) // evicts 1
+
+	// Restart: the index must survive.
+	c, err = NewCache(dir, 2000)
+	if err != nil {
+		t.Fatalf("NewCache(_) = _, %v; need nil error", err)
+	}
+	get(c, fxs[0])
+	get(c, fxs[2])
+	get(c, fxs[1])
+	for i, want := range []int{1, 2, 1} {
+		if n := f.count(fxs[i]); n != want {
+			t.Errorf("media %v fetched %v times, want %v", i, n, want)
+		}
+	}
+}
+
+func TestCacheHitDoesntSaveIndex(t *testing.T) {
+	fxs, f := cacheFixtures(t, 1)
+	dir := t.TempDir()
+	c, err := NewCache(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("NewCache(_) = _, %v; need nil error", err)
+	}
+	if _, err := c.GetOrDownload(context.Background(), f, fxs[0].msg); err != nil {
+		t.Fatalf("GetOrDownload(_) = _, %v; need nil error", err)
+	}
+	index := filepath.Join(dir, indexFile)
+	if err := os.Remove(index); err != nil {
+		t.Fatalf("os.Remove(index) = %v, need nil error", err)
+	}
+	if _, err := c.GetOrDownload(context.Background(), f, fxs[0].msg); err != nil {
+		t.Fatalf("GetOrDownload(_) = _, %v; need nil error", err)
+	}
+	c.Lookup(fxs[0].msg.GetFileSHA256())
+	if _, err := os.Stat(index); !os.IsNotExist(err) {
+		t.Errorf("index written by a cache hit: os.Stat(index) = %v, want not exist", err)
+	}
+}
+
+func TestCacheDamagedFile(t *testing.T) {
+	fxs, f := cacheFixtures(t, 1)
+	c, err := NewCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("NewCache(_) = _, %v; need nil error", err)
+	}
+	p, err := c.GetOrDownload(context.Background(), f, fxs[0].msg)
+	if err != nil {
+		t.Fatalf("GetOrDownload(_) = _, %v; need nil error", err)
+	}
+	os.WriteFile(p, []byte("truncated"), 0644)
+	if _, err := c.GetOrDownload(context.Background(), f, fxs[0].msg); err != nil {
+		t.Fatalf("GetOrDownload(_) = _, %v; need nil error", err)
+	}
+	if n := f.count(fxs[0]); n != 2 {
+		t.Errorf("damaged media fetched %v times, want 2", n)
+	}
+}
+
+func TestCacheConcurrentDedup(t *testing.T) {
+	fxs, f := cacheFixtures(t, 1)
+	f.delay = 50 * time.Millisecond
+	c, err := NewCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("NewCache(_) = _, %v; need nil error", err)
+	}
+	var wg sync.WaitGroup
+	paths := make([]string, 10)
+	errs := make([]error, 10)
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			paths[i], errs[i] = c.GetOrDownload(context.Background(), f, fxs[0].msg)
+		}(i)
+	}
+	wg.Wait()
+	for i := range paths {
+		if errs[i] != nil || paths[i] != paths[0] {
+			t.Errorf("GetOrDownload(_) #%v = %v, %v; want %v, nil", i, paths[i], errs[i], paths[0])
+		}
+	}
+	if n := f.count(fxs[0]); n != 1 {
+		t.Errorf("media fetched %v times, want 1", n)
+	}
+}
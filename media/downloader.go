@@ -0,0 +1,284 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/msgkind"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ErrTooLarge is returned when media exceed the maximum size of a Downloader.
+var ErrTooLarge = errors.New("media too large")
+
+// Client downloads the media of a message into memory, such as a *whatsmeow.Client.
+type Client interface {
+	Download(msg whatsmeow.DownloadableMessage) ([]byte, error)
+}
+
+// Meta describes downloaded media to a Storage.
+type Meta struct {
+	Chat      types.JID
+	Sender    types.JID
+	MessageID types.MessageID
+	Timestamp time.Time
+	Kind      msgkind.Kind // ImageMessage, VideoMessage, AudioMessage, DocumentMessage or StickerMessage
+	Mimetype  string
+	Size      int64  // in bytes
+	FileName  string // the message ID with an extension for the mimetype, see FileName
+}
+
+// Storage stores downloaded media.
+type Storage interface {
+	// SaveStream stores the media that `r` reads, and returns where they were stored.
+	SaveStream(ctx context.Context, meta Meta, r io.Reader) (path string, err error)
+}
+
+// FSStorage is a Storage that writes media to files in a directory, named by Meta.FileName.
+type FSStorage struct {
+	Dir string
+}
+
+// SaveStream implements Storage. The file appears when it is complete, so that readers of the
+// directory never see partial media.
+func (s FSStorage) SaveStream(ctx context.Context, meta Meta, r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return "", fmt.Errorf("media.FSStorage.SaveStream: %w", err)
+	}
+	path := filepath.Join(s.Dir, meta.FileName)
+	tmp, err := os.CreateTemp(s.Dir, meta.FileName+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("media.FSStorage.SaveStream: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly after the rename
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("media.FSStorage.SaveStream: writing %v: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("media.FSStorage.SaveStream: writing %v: %w", path, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("media.FSStorage.SaveStream: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("media.FSStorage.SaveStream: %w", err)
+	}
+	return path, nil
+}
+
+// DownloaderOpts configures a Downloader.
+type DownloaderOpts struct {
+	Client  Client      // downloads the media, required
+	MaxSize int64       // in bytes, larger media are rejected with ErrTooLarge; unlimited when zero
+	Chats   []types.JID // whose media are downloaded, all chats when empty
+
+	// OnSaved is invoked after media were stored. Optional.
+	OnSaved func(meta Meta, path string)
+
+	// RequestRetry is invoked when the media are no longer on the server, so that the sender's
+	// phone can be asked to upload them again, typically with client.SendMediaRetryReceipt. The
+	// MediaRetry event that follows carries the new direct path. Optional.
+	RequestRetry func(info *types.MessageInfo, mediaKey []byte) error
+}
+
+// Downloader is a handler for Message events that downloads images, videos, audio, documents
+// and stickers, and stores them in a Storage. The zero value isn't usable, use NewDownloader.
+type Downloader struct {
+	store   Storage
+	opts    DownloaderOpts
+	chats   map[types.JID]bool
+	retries *RetryCoordinator // when set, follows up on the retry requests
+}
+
+// NewDownloader returns a handler that stores the media of incoming messages in `store`.
+//
+//	d := media.NewDownloader(media.FSStorage{Dir: "/var/lib/bot/media"}, media.DownloaderOpts{
+//		Client:       client,
+//		MaxSize:      16 << 20,
+//		RequestRetry: client.SendMediaRetryReceipt,
+//	})
+//	d.Register()
+func NewDownloader(store Storage, opts DownloaderOpts) *Downloader {
+	d := &Downloader{store: store, opts: opts}
+	if len(opts.Chats) > 0 {
+		d.chats = map[types.JID]bool{}
+		for _, c := range opts.Chats {
+			d.chats[c.ToNonAD()] = true
+		}
+	}
+	return d
+}
+
+// Register registers the downloader for Message events.
+func (d *Downloader) Register() {
+	handlers.Register(handlers.Message, d)
+}
+
+// Handle implements handlers.handler for Message events.
+func (d *Downloader) Handle(ev interface{}) error {
+	return d.HandleCtx(context.Background(), ev)
+}
+
+// HandleCtx implements handlers.ContextHandler. Messages without media, and messages in other
+// chats than DownloaderOpts.Chats, are ignored.
+func (d *Downloader) HandleCtx(ctx context.Context, ev interface{}) error {
+	msg, ok := ev.(*events.Message)
+	if !ok {
+		return fmt.Errorf("media.Downloader.HandleCtx: unexpected event %T", ev)
+	}
+	if d.chats != nil && !d.chats[msg.Info.Chat.ToNonAD()] {
+		return nil
+	}
+	kind, m := downloadable(msgkind.Unwrap(msg.Message))
+	if m == nil {
+		return nil
+	}
+	if _, err := d.download(ctx, &msg.Info, kind, m, true); err != nil {
+		return fmt.Errorf("media.Downloader.HandleCtx: %w", err)
+	}
+	return nil
+}
+
+// mediaMessage is the downloadable content of a message, with its mimetype and size.
+type mediaMessage interface {
+	whatsmeow.DownloadableMessage
+	GetMimetype() string
+	GetFileLength() uint64
+}
+
+// downloadable returns the media in the content of a message, or nil when there are none.
+func downloadable(msg *waE2E.Message) (msgkind.Kind, mediaMessage) {
+	switch {
+	case msg.GetImageMessage() != nil:
+		return msgkind.ImageMessage, msg.GetImageMessage()
+	case msg.GetVideoMessage() != nil:
+		return msgkind.VideoMessage, msg.GetVideoMessage()
+	case msg.GetAudioMessage() != nil:
+		return msgkind.AudioMessage, msg.GetAudioMessage()
+	case msg.GetDocumentMessage() != nil:
+		return msgkind.DocumentMessage, msg.GetDocumentMessage()
+	case msg.GetStickerMessage() != nil:
+		return msgkind.StickerMessage, msg.GetStickerMessage()
+	}
+	return msgkind.Unknown, nil
+}
+
+// download downloads and stores the media of a message, and returns where they were stored.
+// When `mayRetry` is set and the media expired, a retry is requested.
+func (d *Downloader) download(ctx context.Context, info *types.MessageInfo, kind msgkind.Kind, m mediaMessage, mayRetry bool) (string, error) {
+	meta := Meta{
+		Chat:      info.Chat,
+		Sender:    info.Sender,
+		MessageID: info.ID,
+		Timestamp: info.Timestamp,
+		Kind:      kind,
+		Mimetype:  m.GetMimetype(),
+		Size:      int64(m.GetFileLength()),
+		FileName:  FileName(info.ID, m.GetMimetype()),
+	}
+	// The announced size is checked before, and the actual size after downloading, since the
+	// sender chooses the former.
+	if d.opts.MaxSize > 0 && meta.Size > d.opts.MaxSize {
+		return "", fmt.Errorf("%v of %v: %d bytes: %w", kind, info.ID, meta.Size, ErrTooLarge)
+	}
+	data, err := d.opts.Client.Download(m)
+	if err != nil {
+		err = fmt.Errorf("downloading %v of %v: %w", kind, info.ID, err)
+		if d.opts.RequestRetry != nil && mayRetry && expired(err) {
+			if rerr := d.opts.RequestRetry(info, m.GetMediaKey()); rerr != nil {
+				err = errors.Join(err, fmt.Errorf("requesting a media retry for %v: %w", info.ID, rerr))
+			} else if d.retries != nil {
+				d.retries.track(info, kind, m)
+			}
+		}
+		return "", err
+	}
+	meta.Size = int64(len(data))
+	if d.opts.MaxSize > 0 && meta.Size > d.opts.MaxSize {
+		return "", fmt.Errorf("%v of %v: %d bytes: %w", kind, info.ID, meta.Size, ErrTooLarge)
+	}
+	path, err := d.store.SaveStream(ctx, meta, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("storing %v of %v: %w", kind, info.ID, err)
+	}
+	if d.opts.OnSaved != nil {
+		d.opts.OnSaved(meta, path)
+	}
+	return path, nil
+}
+
+// expired returns whether a download failed because the media are no longer on the server,
+// which a media retry request fixes.
+func expired(err error) bool {
+	return errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith403) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410)
+}
+
+// extensions maps the mimetypes that WhatsApp uses to file extensions, where the system's
+// mimetype table is missing or ambiguous (e.g. ".jpe" for image/jpeg).
+var extensions = map[string]string{
+	"image/jpeg":         ".jpg",
+	"image/png":          ".png",
+	"image/webp":         ".webp",
+	"image/gif":          ".gif",
+	"video/mp4":          ".mp4",
+	"video/3gpp":         ".3gp",
+	"audio/ogg":          ".ogg",
+	"audio/mpeg":         ".mp3",
+	"audio/mp4":          ".m4a",
+	"audio/aac":          ".aac",
+	"audio/amr":          ".amr",
+	"application/pdf":    ".pdf",
+	"text/plain":         ".txt",
+	"application/zip":    ".zip",
+	"application/msword": ".doc",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         ".xlsx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+}
+
+// Extension returns the file extension for a mimetype, with its dot, and ".bin" for unknown
+// mimetypes. Parameters such as "; codecs=opus" are ignored.
+func Extension(mimetype string) string {
+	mt, _, err := mime.ParseMediaType(mimetype)
+	if err != nil {
+		return ".bin"
+	}
+	if ext, ok := extensions[mt]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mt); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// FileName returns the name of the file for the media of a message: the message ID, with
+// characters other than letters, digits, '-' and '_' replaced, and the extension of the mimetype.
+func FileName(id types.MessageID, mimetype string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, id)
+	if name == "" {
+		name = "_"
+	}
+	return name + Extension(mimetype)
+}
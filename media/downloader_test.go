@@ -0,0 +1,229 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/msgkind"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeClient serves media by their direct path, and fails for paths in errs.
+type fakeClient struct {
+	media     map[string][]byte
+	errs      map[string]error
+	downloads int
+}
+
+func (c *fakeClient) Download(msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	c.downloads++
+	if err := c.errs[msg.GetDirectPath()]; err != nil {
+		return nil, err
+	}
+	return c.media[msg.GetDirectPath()], nil
+}
+
+// memStorage is a Storage in memory.
+type memStorage struct {
+	files map[string]string
+	metas []Meta
+}
+
+func (s *memStorage) SaveStream(ctx context.Context, meta Meta, r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	s.files[meta.FileName] = string(data)
+	s.metas = append(s.metas, meta)
+	return "mem:" + meta.FileName, nil
+}
+
+var (
+	chat  = types.NewJID("31611111111", types.DefaultUserServer)
+	other = types.NewJID("31622222222", types.DefaultUserServer)
+)
+
+func mediaEvent(id string, chat types.JID, msg *waE2E.Message) *events.Message {
+	return &events.Message{
+		Info:    types.MessageInfo{MessageSource: types.MessageSource{Chat: chat, Sender: chat}, ID: id},
+		Message: msg,
+	}
+}
+
+func TestDownloader(t *testing.T) {
+	client := &fakeClient{
+		media: map[string][]byte{"/img": []byte("jpeg"), "/voice": []byte("opus"), "/big": []byte("0123456789"), "/liar": []byte("0123456789")},
+		errs:  map[string]error{"/gone": whatsmeow.ErrMediaDownloadFailedWith410, "/broken": errors.New("connection reset")},
+	}
+	store := &memStorage{files: map[string]string{}}
+	var retries []string
+	var saved []string
+	d := NewDownloader(store, DownloaderOpts{
+		Client:  client,
+		MaxSize: 8,
+		Chats:   []types.JID{chat},
+		OnSaved: func(meta Meta, path string) { saved = append(saved, path) },
+		RequestRetry: func(info *types.MessageInfo, mediaKey []byte) error {
+			retries = append(retries, info.ID+":"+string(mediaKey))
+			return nil
+		},
+	})
+
+	for _, test := range []struct {
+		description   string
+		event         *events.Message
+		wantErr       error // nil when no error is expected
+		wantFile      string
+		wantContent   string
+		wantDownloads int
+		wantRetries   int
+	}{
+		{
+			description: "image",
+			event: mediaEvent("I1", chat, &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+				DirectPath: proto.String("/img"), Mimetype: proto.String("image/jpeg"), FileLength: proto.Uint64(4),
+			}}),
+			wantFile:      "I1.jpg",
+			wantContent:   "jpeg",
+			wantDownloads: 1,
+		},
+		{
+			description: "disappearing voice note",
+			event: mediaEvent("A1", chat, &waE2E.Message{EphemeralMessage: &waE2E.FutureProofMessage{
+				Message: &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+					DirectPath: proto.String("/voice"), Mimetype: proto.String("audio/ogg; codecs=opus"), PTT: proto.Bool(true),
+				}},
+			}}),
+			wantFile:      "A1.ogg",
+			wantContent:   "opus",
+			wantDownloads: 2,
+		},
+		{
+			description:   "text",
+			event:         mediaEvent("T1", chat, &waE2E.Message{Conversation: proto.String("hi")}),
+			wantDownloads: 2,
+		},
+		{
+			description: "other chat",
+			event: mediaEvent("I2", other, &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+				DirectPath: proto.String("/img"), Mimetype: proto.String("image/jpeg"),
+			}}),
+			wantDownloads: 2,
+		},
+		{
+			description: "announced too large",
+			event: mediaEvent("V1", chat, &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+				DirectPath: proto.String("/big"), Mimetype: proto.String("video/mp4"), FileLength: proto.Uint64(10),
+			}}),
+			wantErr:       ErrTooLarge,
+			wantDownloads: 2,
+		},
+		{
+			description: "turned out too large",
+			event: mediaEvent("D1", chat, &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+				DirectPath: proto.String("/liar"), Mimetype: proto.String("application/pdf"), FileLength: proto.Uint64(1),
+			}}),
+			wantErr:       ErrTooLarge,
+			wantDownloads: 3,
+		},
+		{
+			description: "expired requests a retry",
+			event: mediaEvent("S1", chat, &waE2E.Message{StickerMessage: &waE2E.StickerMessage{
+				DirectPath: proto.String("/gone"), Mimetype: proto.String("image/webp"), MediaKey: []byte("key"),
+			}}),
+			wantErr:       whatsmeow.ErrMediaDownloadFailedWith410,
+			wantDownloads: 4,
+			wantRetries:   1,
+		},
+		{
+			description: "other failures don't",
+			event: mediaEvent("S2", chat, &waE2E.Message{StickerMessage: &waE2E.StickerMessage{
+				DirectPath: proto.String("/broken"), Mimetype: proto.String("image/webp"),
+			}}),
+			wantErr:       errors.New("connection reset"),
+			wantDownloads: 5,
+			wantRetries:   1,
+		},
+	} {
+		err := d.Handle(test.event)
+		switch {
+		case test.wantErr == nil && err != nil:
+			t.Errorf("%v: Handle(_) = %v, need nil error", test.description, err)
+		case test.wantErr != nil && (err == nil || !errors.Is(err, test.wantErr) && !strings.Contains(err.Error(), test.wantErr.Error())):
+			t.Errorf("%v: Handle(_) = %v, want %v", test.description, err, test.wantErr)
+		}
+		if test.wantFile != "" && store.files[test.wantFile] != test.wantContent {
+			t.Errorf("%v: stored %q as %v, want %q", test.description, store.files[test.wantFile], test.wantFile, test.wantContent)
+		}
+		if client.downloads != test.wantDownloads {
+			t.Errorf("%v: %d downloads, want %d", test.description, client.downloads, test.wantDownloads)
+		}
+		if len(retries) != test.wantRetries {
+			t.Errorf("%v: retries %v, want %d", test.description, retries, test.wantRetries)
+		}
+	}
+
+	if len(store.files) != 2 || len(saved) != 2 {
+		t.Errorf("stored %v, saved %v, want the image and the voice note", store.files, saved)
+	}
+	if retries[0] != "S1:key" {
+		t.Errorf("retry requested for %v, want S1 with its media key", retries[0])
+	}
+	if m := store.metas[1]; m.Kind != msgkind.AudioMessage || m.Mimetype != "audio/ogg; codecs=opus" || m.Size != 4 || m.MessageID != "A1" || m.Chat != chat {
+		t.Errorf("Meta = %+v, want the voice note", m)
+	}
+	if err := d.Handle(&events.Connected{}); err == nil {
+		t.Errorf("Handle(*events.Connected) = nil, need error")
+	}
+}
+
+func TestFileName(t *testing.T) {
+	for _, test := range []struct {
+		id, mimetype string
+		want         string
+	}{
+		{"3EB0ABC", "image/jpeg", "3EB0ABC.jpg"},
+		{"3EB0ABC", "image/png", "3EB0ABC.png"},
+		{"3EB0ABC", "image/webp", "3EB0ABC.webp"},
+		{"3EB0ABC", "video/mp4", "3EB0ABC.mp4"},
+		{"3EB0ABC", "audio/ogg; codecs=opus", "3EB0ABC.ogg"},
+		{"3EB0ABC", "audio/mpeg", "3EB0ABC.mp3"},
+		{"3EB0ABC", "application/pdf", "3EB0ABC.pdf"},
+		{"3EB0ABC", "APPLICATION/PDF", "3EB0ABC.pdf"},
+		{"3EB0ABC", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "3EB0ABC.docx"},
+		{"3EB0ABC", "application/x-unheard-of", "3EB0ABC.bin"},
+		{"3EB0ABC", "", "3EB0ABC.bin"},
+		{"../../etc/passwd", "text/plain", "______etc_passwd.txt"},
+		{"", "image/jpeg", "_.jpg"},
+	} {
+		if got := FileName(test.id, test.mimetype); got != test.want {
+			t.Errorf("FileName(%q, %q) = %q, want %q", test.id, test.mimetype, got, test.want)
+		}
+	}
+}
+
+func TestFSStorage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "media")
+	s := FSStorage{Dir: dir}
+	path, err := s.SaveStream(context.Background(), Meta{FileName: "I1.jpg"}, strings.NewReader("jpeg"))
+	if err != nil {
+		t.Fatalf("SaveStream(_) = _, %v, need nil error", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "jpeg" || path != filepath.Join(dir, "I1.jpg") {
+		t.Errorf("SaveStream(_) = %v holding %q, %v, want %v holding %q", path, data, err, filepath.Join(dir, "I1.jpg"), "jpeg")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%v holds %d files, want just the media", dir, len(entries))
+	}
+}
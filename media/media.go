@@ -0,0 +1,349 @@
+// Package media downloads WhatsApp media to files, with progress reporting and resuming of
+// interrupted downloads.
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrIntegrity is returned when downloaded media don't match the hashes in the message.
+var ErrIntegrity = errors.New("media integrity check failed")
+
+// DefaultHost serves media when a message has only a direct path.
+const DefaultHost = "https://mmg.whatsapp.net"
+
+// Fetcher fetches encrypted media, starting at an offset.
+type Fetcher interface {
+	// Fetch returns the body from `offset` on when `ranged` is true, and the whole body
+	// otherwise, e.g. when the server doesn't support ranges. `total` is the size of the whole
+	// file, or -1 when unknown.
+	Fetch(ctx context.Context, url string, offset int64) (body io.ReadCloser, total int64, ranged bool, err error)
+}
+
+// HTTPFetcher fetches media using HTTP range requests.
+type HTTPFetcher struct {
+	Client *http.Client // http.DefaultClient when nil
+}
+
+// Fetch implements Fetcher.
+func (h HTTPFetcher) Fetch(ctx context.Context, url string, offset int64) (io.ReadCloser, int64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	req.Header.Set("Origin", "https://web.whatsapp.com")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	cli := h.Client
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.ContentLength, false, nil
+	case http.StatusPartialContent:
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+		return resp.Body, total, true, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset > 0 {
+			// Nothing from the offset on: the download completed before, but wasn't decrypted.
+			// Should the partial download be longer than the file, the integrity check of Save
+			// rejects it.
+			resp.Body.Close()
+			return io.NopCloser(strings.NewReader("")), offset, true, nil
+		}
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusForbidden:
+		return nil, 0, false, whatsmeow.ErrMediaDownloadFailedWith403
+	case http.StatusNotFound:
+		return nil, 0, false, whatsmeow.ErrMediaDownloadFailedWith404
+	case http.StatusGone:
+		return nil, 0, false, whatsmeow.ErrMediaDownloadFailedWith410
+	}
+	return nil, 0, false, fmt.Errorf("download failed with status %v", resp.Status)
+}
+
+// SaveOpts configures Save.
+type SaveOpts struct {
+	Fetcher          Fetcher                 // HTTPFetcher when nil
+	Retries          int                     // number of times an interrupted download is resumed
+	Progress         func(done, total int64) // called during the download, total is -1 when unknown
+	ProgressInterval time.Duration           // minimum time between Progress calls, 250ms when zero, every update when negative
+	Log              waLog.Logger            // when set, restarts are logged as warnings
+}
+
+// Save downloads the media of a message and stores them in `path`. The encrypted data is kept
+// in `path` + ".part" while downloading. When the download is interrupted, it is resumed from
+// where it stopped, also by a later call to Save. Servers that don't support ranges cause the
+// download to start over.
+//
+// The result is checked against the hashes in the message; when that fails, ErrIntegrity is
+// returned and neither `path` nor the partial download remain.
+func Save(ctx context.Context, msg whatsmeow.DownloadableMessage, path string, opts SaveOpts) error {
+	mediaType := whatsmeow.GetMediaType(msg)
+	if mediaType == "" {
+		return fmt.Errorf("media.Save: %w", whatsmeow.ErrUnknownMediaType)
+	}
+	url := DefaultHost + msg.GetDirectPath()
+	if u, ok := msg.(interface{ GetURL() string }); ok && strings.HasPrefix(u.GetURL(), "https://") {
+		url = u.GetURL()
+	}
+	fetcher := opts.Fetcher
+	if fetcher == nil {
+		fetcher = HTTPFetcher{}
+	}
+
+	part := path + ".part"
+	if err := checkPart(part, msg.GetFileEncSHA256()); err != nil {
+		return fmt.Errorf("media.Save: %w", err)
+	}
+	p := &progress{report: opts.Progress, interval: opts.ProgressInterval, total: -1}
+	if l, ok := msg.(interface{ GetFileLength() uint64 }); ok && l.GetFileLength() > 0 {
+		// The encrypted file is padded and has a MAC, so this is an estimate.
+		p.total = int64(l.GetFileLength())
+	}
+
+	var err error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if err = fetch(ctx, fetcher, url, part, p, opts.Log); err == nil || ctx.Err() != nil {
+			break
+		}
+		if opts.Log != nil {
+			opts.Log.Warnf("media.Save: download of %v interrupted: %v", path, err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("media.Save: %w", err)
+	}
+	p.finish()
+
+	if err := decryptPart(part, path, msg, mediaType); err != nil {
+		os.Remove(part)
+		os.Remove(part + ".sha256")
+		return fmt.Errorf("media.Save: %w", err)
+	}
+	os.Remove(part)
+	os.Remove(part + ".sha256")
+	return nil
+}
+
+// checkPart removes a partial download that belongs to another file. The partial download is
+// identified by the encrypted hash, which is stored next to it.
+func checkPart(part string, encSHA256 []byte) error {
+	id := hex.EncodeToString(encSHA256)
+	stored, err := os.ReadFile(part + ".sha256")
+	if err == nil && string(stored) == id {
+		return nil
+	}
+	if err := os.Remove(part); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(part+".sha256", []byte(id), 0644)
+}
+
+// fetch appends to the partial download what is missing.
+func fetch(ctx context.Context, fetcher Fetcher, url, part string, p *progress, log waLog.Logger) error {
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	body, total, ranged, err := fetcher.Fetch(ctx, url, offset)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if total >= 0 {
+		p.total = total
+	}
+	if offset > 0 && !ranged {
+		if log != nil {
+			log.Warnf("media.Save: server doesn't support ranges, restarting download of %v", url)
+		}
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if offset, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	p.update(offset)
+	buf := make([]byte, 64*1024)
+	for {
+		n, rerr := body.Read(buf)
+		if n > 0 {
+			if _, err := f.Write(buf[:n]); err != nil {
+				return err
+			}
+			offset += int64(n)
+			p.update(offset)
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// decryptPart checks and decrypts a complete download into `path`. Encrypted media are AES-256-CBC
+// ciphertext followed by the first 10 bytes of an HMAC-SHA256 over the IV and ciphertext. The
+// file is streamed, since media can be large.
+func decryptPart(part, path string, msg whatsmeow.DownloadableMessage, mediaType whatsmeow.MediaType) error {
+	iv, cipherKey, macKey, err := expandKey(msg.GetMediaKey(), mediaType)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(part)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := st.Size() - 10
+	if size <= 0 || size%aes.BlockSize != 0 {
+		return fmt.Errorf("%w: %v", ErrIntegrity, whatsmeow.ErrTooShortFile)
+	}
+
+	// First pass: hash and MAC.
+	encHash, mac := sha256.New(), hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	if _, err := io.Copy(io.MultiWriter(encHash, mac), io.LimitReader(f, size)); err != nil {
+		return err
+	}
+	wantMAC := make([]byte, 10)
+	if _, err := io.ReadFull(f, wantMAC); err != nil {
+		return err
+	}
+	encHash.Write(wantMAC)
+	if !bytes.Equal(encHash.Sum(nil), msg.GetFileEncSHA256()) {
+		return fmt.Errorf("%w: %v", ErrIntegrity, whatsmeow.ErrInvalidMediaEncSHA256)
+	}
+	if !hmac.Equal(mac.Sum(nil)[:10], wantMAC) {
+		return fmt.Errorf("%w: %v", ErrIntegrity, whatsmeow.ErrInvalidMediaHMAC)
+	}
+
+	// Second pass: decrypt into a temporary file, which becomes `path` when the hash matches.
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(cipherKey)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+	plainHash := sha256.New()
+	w := io.MultiWriter(out, plainHash)
+	cbc := cipher.NewCBCDecrypter(block, iv)
+	buf := make([]byte, 64*1024)
+	for left := size; left > 0; {
+		n := int64(len(buf))
+		if n > left {
+			n = left
+		}
+		if _, err := io.ReadFull(f, buf[:n]); err != nil {
+			return err
+		}
+		cbc.CryptBlocks(buf[:n], buf[:n])
+		left -= n
+		if left == 0 {
+			// Strip the PKCS#7 padding.
+			pad := int64(buf[n-1])
+			if pad == 0 || pad > aes.BlockSize || pad > n {
+				return fmt.Errorf("%w: bad padding", ErrIntegrity)
+			}
+			n -= pad
+		}
+		if _, err := w.Write(buf[:n]); err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(plainHash.Sum(nil), msg.GetFileSHA256()) {
+		return fmt.Errorf("%w: %v", ErrIntegrity, whatsmeow.ErrInvalidMediaSHA256)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// expandKey derives the IV, cipher key and MAC key from a media key.
+func expandKey(mediaKey []byte, mediaType whatsmeow.MediaType) (iv, cipherKey, macKey []byte, err error) {
+	expanded := make([]byte, 112)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, mediaKey, nil, []byte(mediaType)), expanded); err != nil {
+		return nil, nil, nil, err
+	}
+	return expanded[:16], expanded[16:48], expanded[48:80], nil
+}
+
+// progress calls a progress function, at most once per interval.
+type progress struct {
+	report   func(done, total int64)
+	interval time.Duration
+	total    int64
+	done     int64
+	last     time.Time
+}
+
+func (p *progress) update(done int64) {
+	p.done = done
+	if p.report == nil {
+		return
+	}
+	interval := p.interval
+	if interval == 0 {
+		interval = 250 * time.Millisecond
+	}
+	if now := time.Now(); now.Sub(p.last) >= interval {
+		p.last = now
+		p.report(p.done, p.total)
+	}
+}
+
+// finish reports the final state, so that callers always see the download complete.
+func (p *progress) finish() {
+	if p.report != nil {
+		p.report(p.done, p.done)
+	}
+}
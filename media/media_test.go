@@ -0,0 +1,247 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// encrypt is the inverse of decrypt.
+func encrypt(t *testing.T, plain, mediaKey []byte, mediaType whatsmeow.MediaType) []byte {
+	t.Helper()
+	iv, cipherKey, macKey, err := expandKey(mediaKey, mediaType)
+	if err != nil {
+		t.Fatalf("expandKey(_) = %v, need nil error", err)
+	}
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	padded := append(append([]byte(nil), plain...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	block, _ := aes.NewCipher(cipherKey)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	h := hmac.New(sha256.New, macKey)
+	h.Write(iv)
+	h.Write(ciphertext)
+	return append(ciphertext, h.Sum(nil)[:10]...)
+}
+
+// fakeFetcher serves `data`. The first `failures` fetches break off after `failAfter` bytes.
+type fakeFetcher struct {
+	data      []byte
+	ranged    bool
+	failures  int
+	failAfter int
+	offsets   []int64
+}
+
+type failingReader struct {
+	r io.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context, url string, offset int64) (io.ReadCloser, int64, bool, error) {
+	f.offsets = append(f.offsets, offset)
+	data := f.data
+	ranged := f.ranged && offset > 0
+	if ranged {
+		data = data[offset:]
+	}
+	var r io.Reader = bytes.NewReader(data)
+	if f.failures > 0 {
+		f.failures--
+		r = &failingReader{r: io.LimitReader(bytes.NewReader(data), int64(f.failAfter))}
+	}
+	return io.NopCloser(r), int64(len(f.data)), ranged, nil
+}
+
+type fixture struct {
+	plain []byte
+	enc   []byte
+	msg   *waE2E.DocumentMessage
+}
+
+func newFixture(t *testing.T) *fixture {
+	plain := bytes.Repeat([]byte("0123456789abcdef"), 20000) // 320kB
+	return fixtureOf(t, append(plain, "tail"...))
+}
+
+func fixtureOf(t *testing.T, plain []byte) *fixture {
+	mediaKey := bytes.Repeat([]byte{7}, 32)
+	enc := encrypt(t, plain, mediaKey, whatsmeow.MediaDocument)
+	encSum, plainSum := sha256.Sum256(enc), sha256.Sum256(plain)
+	return &fixture{
+		plain: plain,
+		enc:   enc,
+		msg: &waE2E.DocumentMessage{
+			DirectPath:    proto.String("/v/t62/doc"),
+			MediaKey:      mediaKey,
+			FileEncSHA256: encSum[:],
+			FileSHA256:    plainSum[:],
+			FileLength:    proto.Uint64(uint64(len(plain))),
+		},
+	}
+}
+
+func TestSaveResumes(t *testing.T) {
+	fx := newFixture(t)
+
+	for _, test := range []struct {
+		description string
+		ranged      bool
+		wantOffsets []int64
+	}{
+		{
+			description: "ranged resume",
+			ranged:      true,
+			wantOffsets: []int64{0, 100000},
+		},
+		{
+			description: "server without ranges",
+			ranged:      false,
+			wantOffsets: []int64{0, 100000},
+		},
+	} {
+		path := filepath.Join(t.TempDir(), "doc")
+		f := &fakeFetcher{data: fx.enc, ranged: test.ranged, failures: 1, failAfter: 100000}
+		var calls int
+		var last [2]int64
+		opts := SaveOpts{
+			Fetcher:          f,
+			Retries:          1,
+			ProgressInterval: -1, // report every read
+			Progress: func(done, total int64) {
+				calls++
+				last = [2]int64{done, total}
+			},
+		}
+		if err := Save(context.Background(), fx.msg, path, opts); err != nil {
+			t.Errorf("%v: Save(_) = %v, need nil error", test.description, err)
+			continue
+		}
+		got, _ := os.ReadFile(path)
+		if !bytes.Equal(got, fx.plain) {
+			t.Errorf("%v: saved %v bytes, differs from the original", test.description, len(got))
+		}
+		if len(f.offsets) != 2 || f.offsets[0] != test.wantOffsets[0] || f.offsets[1] != test.wantOffsets[1] {
+			t.Errorf("%v: fetched at offsets %v, want %v", test.description, f.offsets, test.wantOffsets)
+		}
+		if calls < 2 || last[0] != int64(len(fx.enc)) || last[1] != int64(len(fx.enc)) {
+			t.Errorf("%v: %v progress calls, last %v; want several ending at %v", test.description, calls, last, len(fx.enc))
+		}
+		if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+			t.Errorf("%v: partial download remains", test.description)
+		}
+	}
+}
+
+func TestSaveResumesLater(t *testing.T) {
+	fx := newFixture(t)
+	path := filepath.Join(t.TempDir(), "doc")
+
+	f := &fakeFetcher{data: fx.enc, ranged: true, failures: 1, failAfter: 50000}
+	if err := Save(context.Background(), fx.msg, path, SaveOpts{Fetcher: f}); err == nil {
+		t.Fatalf("Save(_) without retries = nil, want the download error")
+	}
+	if st, err := os.Stat(path + ".part"); err != nil || st.Size() != 50000 {
+		t.Fatalf("partial download = %v, %v; want 50000 bytes", st, err)
+	}
+	if err := Save(context.Background(), fx.msg, path, SaveOpts{Fetcher: f}); err != nil {
+		t.Fatalf("Save(_) = %v, need nil error", err)
+	}
+	if f.offsets[1] != 50000 {
+		t.Errorf("second Save(_) started at %v, want 50000", f.offsets[1])
+	}
+}
+
+func TestSaveCompletePart(t *testing.T) {
+	fx := newFixture(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "doc", time.Time{}, bytes.NewReader(fx.enc))
+	}))
+	defer srv.Close()
+	msg := proto.Clone(fx.msg).(*waE2E.DocumentMessage)
+	msg.URL = proto.String(srv.URL + "/doc")
+	corrupt := append([]byte(nil), fx.enc...)
+	corrupt[1000] ^= 0xff
+
+	for _, test := range []struct {
+		description string
+		part        []byte
+		wantErr     error // nil when no error is expected
+	}{
+		{
+			description: "crashed before decrypting",
+			part:        fx.enc,
+		},
+		{
+			description: "corrupt",
+			part:        corrupt,
+			wantErr:     ErrIntegrity,
+		},
+		{
+			description: "longer than the file",
+			part:        append(append([]byte(nil), fx.enc...), "junk"...),
+			wantErr:     ErrIntegrity,
+		},
+	} {
+		path := filepath.Join(t.TempDir(), "doc")
+		// A partial download that is complete, left by an earlier Save.
+		if err := checkPart(path+".part", msg.GetFileEncSHA256()); err != nil {
+			t.Fatalf("checkPart(_) = %v, need nil error", err)
+		}
+		if err := os.WriteFile(path+".part", test.part, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := Save(context.Background(), msg, path, SaveOpts{Fetcher: HTTPFetcher{Client: srv.Client()}})
+		switch {
+		case test.wantErr == nil && err != nil:
+			t.Errorf("%v: Save(_) = %v, need nil error", test.description, err)
+		case test.wantErr != nil && !errors.Is(err, test.wantErr):
+			t.Errorf("%v: Save(_) = %v, want %v", test.description, err, test.wantErr)
+		}
+		if got, _ := os.ReadFile(path); test.wantErr == nil && !bytes.Equal(got, fx.plain) {
+			t.Errorf("%v: saved %v bytes, differs from the original", test.description, len(got))
+		}
+		if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+			t.Errorf("%v: partial download remains", test.description)
+		}
+	}
+}
+
+func TestSaveIntegrity(t *testing.T) {
+	fx := newFixture(t)
+	path := filepath.Join(t.TempDir(), "doc")
+	corrupt := append([]byte(nil), fx.enc...)
+	corrupt[1000] ^= 0xff
+
+	f := &fakeFetcher{data: corrupt}
+	if err := Save(context.Background(), fx.msg, path, SaveOpts{Fetcher: f}); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("Save(corrupt) = %v, want ErrIntegrity", err)
+	}
+	for _, p := range []string{path, path + ".part"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("Save(corrupt) left %v", p)
+		}
+	}
+}
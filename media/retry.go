@@ -0,0 +1,223 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/msgkind"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// now is swapped in tests.
+var now = time.Now
+
+var (
+	// ErrRetryFailed is reported when the sender's phone can't upload the media again, e.g.
+	// because they were deleted there.
+	ErrRetryFailed = errors.New("media retry failed")
+	// ErrRetryExpired is reported when no answer to a retry request came in time.
+	ErrRetryExpired = errors.New("media retry expired")
+)
+
+// DefaultRetryTTL is how long a RetryCoordinator waits for the answer to a retry request.
+const DefaultRetryTTL = time.Hour
+
+// DecryptFunc decrypts the answer to a retry request with the media key of the message, such as
+// whatsmeow.DecryptMediaRetryNotification.
+type DecryptFunc func(ev *events.MediaRetry, mediaKey []byte) (*waMmsRetry.MediaRetryNotification, error)
+
+// RetryOpts configures a RetryCoordinator.
+type RetryOpts struct {
+	Decrypt DecryptFunc   // whatsmeow.DecryptMediaRetryNotification when nil
+	TTL     time.Duration // how long to wait for the answer to a retry request, DefaultRetryTTL when zero
+
+	// OnFailure is invoked when media can't be downloaded after all, with an error that wraps
+	// ErrRetryFailed, ErrRetryExpired or the error of the second download. Optional.
+	OnFailure func(info types.MessageInfo, err error)
+}
+
+// retryKey identifies a retry request: message IDs are unique per chat.
+type retryKey struct {
+	chat types.JID
+	id   types.MessageID
+}
+
+// pendingRetry is a retry request that waits for its answer.
+type pendingRetry struct {
+	info    types.MessageInfo
+	kind    msgkind.Kind
+	msg     mediaMessage
+	expires time.Time
+}
+
+// RetryCoordinator follows up on the retry requests of a Downloader: it remembers the media for
+// which a retry was requested, decrypts the MediaRetry events that answer the requests, and
+// downloads the media again from their new location. Media that still can't be downloaded are
+// reported to RetryOpts.OnFailure. The zero value isn't usable, use NewRetryCoordinator.
+type RetryCoordinator struct {
+	d    *Downloader
+	opts RetryOpts
+
+	mu        sync.Mutex
+	pending   map[retryKey]*pendingRetry
+	nextSweep time.Time
+}
+
+// NewRetryCoordinator returns a coordinator for the retry requests of `d`, which needs
+// DownloaderOpts.RequestRetry to make them. Register both for their events.
+//
+//	d := media.NewDownloader(store, media.DownloaderOpts{Client: client, RequestRetry: client.SendMediaRetryReceipt})
+//	d.Register()
+//	media.NewRetryCoordinator(d, media.RetryOpts{OnFailure: gone}).Register()
+func NewRetryCoordinator(d *Downloader, opts RetryOpts) *RetryCoordinator {
+	if opts.Decrypt == nil {
+		opts.Decrypt = whatsmeow.DecryptMediaRetryNotification
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultRetryTTL
+	}
+	c := &RetryCoordinator{d: d, opts: opts, pending: map[retryKey]*pendingRetry{}}
+	d.retries = c
+	return c
+}
+
+// Register registers the coordinator for MediaRetry events.
+func (c *RetryCoordinator) Register() {
+	handlers.Register(handlers.MediaRetry, c)
+}
+
+// track remembers media for which a retry was requested.
+func (c *RetryCoordinator) track(info *types.MessageInfo, kind msgkind.Kind, m mediaMessage) {
+	c.mu.Lock()
+	expired := c.sweep()
+	c.pending[retryKey{info.Chat.ToNonAD(), info.ID}] = &pendingRetry{
+		info:    *info,
+		kind:    kind,
+		msg:     m,
+		expires: now().Add(c.opts.TTL),
+	}
+	c.mu.Unlock()
+	c.fail(expired...)
+}
+
+// sweep drops the requests that weren't answered in time, at most every TTL/2, and returns
+// them. The caller holds c.mu.
+func (c *RetryCoordinator) sweep() []*pendingRetry {
+	t := now()
+	if t.Before(c.nextSweep) {
+		return nil
+	}
+	c.nextSweep = t.Add(c.opts.TTL / 2)
+	var expired []*pendingRetry
+	for k, p := range c.pending {
+		if !t.Before(p.expires) {
+			expired = append(expired, p)
+			delete(c.pending, k)
+		}
+	}
+	return expired
+}
+
+// fail reports expired requests.
+func (c *RetryCoordinator) fail(expired ...*pendingRetry) {
+	if c.opts.OnFailure == nil {
+		return
+	}
+	for _, p := range expired {
+		c.opts.OnFailure(p.info, fmt.Errorf("%v of %v: %w", p.kind, p.info.ID, ErrRetryExpired))
+	}
+}
+
+// Pending returns the number of retry requests that wait for an answer.
+func (c *RetryCoordinator) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, p := range c.pending {
+		if now().Before(p.expires) {
+			n++
+		}
+	}
+	return n
+}
+
+// Handle implements handlers.handler for MediaRetry events.
+func (c *RetryCoordinator) Handle(ev interface{}) error {
+	return c.HandleCtx(context.Background(), ev)
+}
+
+// HandleCtx implements handlers.ContextHandler. Answers to requests that this coordinator didn't
+// track, or that expired, are ignored. Failures are reported to RetryOpts.OnFailure, since they
+// are about the earlier message rather than this event.
+func (c *RetryCoordinator) HandleCtx(ctx context.Context, ev interface{}) error {
+	retry, ok := ev.(*events.MediaRetry)
+	if !ok {
+		return fmt.Errorf("media.RetryCoordinator.HandleCtx: unexpected event %T", ev)
+	}
+	c.mu.Lock()
+	expired := c.sweep()
+	key := retryKey{retry.ChatID.ToNonAD(), retry.MessageID}
+	p, ok := c.pending[key]
+	if ok {
+		delete(c.pending, key)
+		ok = now().Before(p.expires)
+		if !ok {
+			expired = append(expired, p)
+		}
+	}
+	c.mu.Unlock()
+	c.fail(expired...)
+	if !ok {
+		return nil
+	}
+
+	if err := c.redownload(ctx, p, retry); err != nil && c.opts.OnFailure != nil {
+		c.opts.OnFailure(p.info, fmt.Errorf("%v of %v: %w", p.kind, p.info.ID, err))
+	}
+	return nil
+}
+
+// redownload downloads media again from the location in the answer to a retry request.
+func (c *RetryCoordinator) redownload(ctx context.Context, p *pendingRetry, retry *events.MediaRetry) error {
+	notif, err := c.opts.Decrypt(retry, p.msg.GetMediaKey())
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRetryFailed, err)
+	}
+	if notif.GetResult() != waMmsRetry.MediaRetryNotification_SUCCESS {
+		return fmt.Errorf("%w: %v", ErrRetryFailed, notif.GetResult())
+	}
+	if notif.GetDirectPath() == "" {
+		return fmt.Errorf("%w: no direct path", ErrRetryFailed)
+	}
+	// A second retry request would be answered the same way.
+	_, err = c.d.download(ctx, &p.info, p.kind, withDirectPath(p.msg, notif.GetDirectPath()), false)
+	return err
+}
+
+// withDirectPath returns a copy of the media of a message with another direct path.
+func withDirectPath(m mediaMessage, path string) mediaMessage {
+	m = proto.Clone(m.(proto.Message)).(mediaMessage)
+	switch v := m.(type) {
+	case *waE2E.ImageMessage:
+		v.DirectPath = proto.String(path)
+	case *waE2E.VideoMessage:
+		v.DirectPath = proto.String(path)
+	case *waE2E.AudioMessage:
+		v.DirectPath = proto.String(path)
+	case *waE2E.DocumentMessage:
+		v.DirectPath = proto.String(path)
+	case *waE2E.StickerMessage:
+		v.DirectPath = proto.String(path)
+	}
+	return m
+}
@@ -0,0 +1,195 @@
+package media
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeDecrypt "decrypts" a MediaRetry whose ciphertext is the result and the new direct path,
+// e.g. "SUCCESS /new", and fails for "garbage".
+func fakeDecrypt(ev *events.MediaRetry, mediaKey []byte) (*waMmsRetry.MediaRetryNotification, error) {
+	if string(mediaKey) != "key" {
+		return nil, errors.New("wrong media key")
+	}
+	result, path, _ := strings.Cut(string(ev.Ciphertext), " ")
+	r, ok := waMmsRetry.MediaRetryNotification_ResultType_value[result]
+	if !ok {
+		return nil, errors.New("failed to decrypt notification")
+	}
+	return &waMmsRetry.MediaRetryNotification{
+		StanzaID:   proto.String(ev.MessageID),
+		Result:     waMmsRetry.MediaRetryNotification_ResultType(r).Enum(),
+		DirectPath: proto.String(path),
+	}, nil
+}
+
+func expiredImage(id string) *events.Message {
+	return mediaEvent(id, chat, &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+		DirectPath: proto.String("/gone"), Mimetype: proto.String("image/jpeg"), MediaKey: []byte("key"),
+	}})
+}
+
+func answer(id, ciphertext string) *events.MediaRetry {
+	return &events.MediaRetry{MessageID: id, ChatID: chat, Ciphertext: []byte(ciphertext)}
+}
+
+func TestRetryCoordinator(t *testing.T) {
+	client := &fakeClient{
+		media: map[string][]byte{"/new": []byte("jpeg")},
+		errs:  map[string]error{"/gone": whatsmeow.ErrMediaDownloadFailedWith404, "/gone-too": whatsmeow.ErrMediaDownloadFailedWith410},
+	}
+	store := &memStorage{files: map[string]string{}}
+	var requests int
+	d := NewDownloader(store, DownloaderOpts{
+		Client:       client,
+		RequestRetry: func(info *types.MessageInfo, mediaKey []byte) error { requests++; return nil },
+	})
+	var failures []error
+	c := NewRetryCoordinator(d, RetryOpts{
+		Decrypt:   fakeDecrypt,
+		OnFailure: func(info types.MessageInfo, err error) { failures = append(failures, err) },
+	})
+
+	for _, test := range []struct {
+		description  string
+		answer       *events.MediaRetry
+		wantFile     string
+		wantFailure  error // nil when no failure is expected
+		wantRequests int
+	}{
+		{
+			description:  "uploaded again",
+			answer:       answer("I1", "SUCCESS /new"),
+			wantFile:     "I1.jpg",
+			wantRequests: 1,
+		},
+		{
+			description:  "deleted from the phone",
+			answer:       answer("I2", "NOT_FOUND"),
+			wantFailure:  ErrRetryFailed,
+			wantRequests: 2,
+		},
+		{
+			description:  "undecryptable",
+			answer:       answer("I3", "garbage"),
+			wantFailure:  ErrRetryFailed,
+			wantRequests: 3,
+		},
+		{
+			description:  "gone again isn't retried again",
+			answer:       answer("I4", "SUCCESS /gone-too"),
+			wantFailure:  whatsmeow.ErrMediaDownloadFailedWith410,
+			wantRequests: 4,
+		},
+	} {
+		failures = nil
+		id := test.answer.MessageID
+		if err := d.Handle(expiredImage(id)); !errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) {
+			t.Errorf("%v: Downloader.Handle(_) = %v, want %v", test.description, err, whatsmeow.ErrMediaDownloadFailedWith404)
+		}
+		if n := c.Pending(); n != 1 {
+			t.Errorf("%v: Pending() = %d after the request, want 1", test.description, n)
+		}
+		if err := c.Handle(test.answer); err != nil {
+			t.Errorf("%v: Handle(_) = %v, need nil error", test.description, err)
+		}
+		if n := c.Pending(); n != 0 {
+			t.Errorf("%v: Pending() = %d after the answer, want 0", test.description, n)
+		}
+		if test.wantFile != "" && store.files[test.wantFile] != "jpeg" {
+			t.Errorf("%v: stored %q as %v, want %q", test.description, store.files[test.wantFile], test.wantFile, "jpeg")
+		}
+		switch {
+		case test.wantFailure == nil && len(failures) > 0:
+			t.Errorf("%v: failures %v, want none", test.description, failures)
+		case test.wantFailure != nil && (len(failures) != 1 || !errors.Is(failures[0], test.wantFailure)):
+			t.Errorf("%v: failures %v, want %v", test.description, failures, test.wantFailure)
+		}
+		if requests != test.wantRequests {
+			t.Errorf("%v: %d retry requests, want %d", test.description, requests, test.wantRequests)
+		}
+	}
+
+	// Answers to unknown or already answered requests are ignored.
+	for _, ev := range []*events.MediaRetry{answer("I1", "SUCCESS /new"), answer("X1", "SUCCESS /new")} {
+		if err := c.Handle(ev); err != nil {
+			t.Errorf("Handle(%v) = %v, need nil error", ev.MessageID, err)
+		}
+	}
+	if client.downloads != 6 { // four requests, and two answers with a new path
+		t.Errorf("%d downloads, want 6", client.downloads)
+	}
+	if err := c.Handle(&events.Connected{}); err == nil {
+		t.Errorf("Handle(*events.Connected) = nil, need error")
+	}
+}
+
+func TestRetryCoordinatorExpires(t *testing.T) {
+	clock := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+
+	client := &fakeClient{
+		media: map[string][]byte{"/new": []byte("jpeg")},
+		errs:  map[string]error{"/gone": whatsmeow.ErrMediaDownloadFailedWith404},
+	}
+	store := &memStorage{files: map[string]string{}}
+	d := NewDownloader(store, DownloaderOpts{
+		Client:       client,
+		RequestRetry: func(info *types.MessageInfo, mediaKey []byte) error { return nil },
+	})
+	var failures []string
+	c := NewRetryCoordinator(d, RetryOpts{
+		Decrypt: fakeDecrypt,
+		TTL:     time.Minute,
+		OnFailure: func(info types.MessageInfo, err error) {
+			if errors.Is(err, ErrRetryExpired) {
+				failures = append(failures, info.ID)
+			}
+		},
+	})
+
+	d.Handle(expiredImage("I1"))
+	clock = clock.Add(30 * time.Second)
+	d.Handle(expiredImage("I2"))
+	clock = clock.Add(40 * time.Second) // I1 expired, I2 not yet
+	if n := c.Pending(); n != 1 {
+		t.Errorf("Pending() = %d, want 1", n)
+	}
+	if err := c.Handle(answer("I1", "SUCCESS /new")); err != nil {
+		t.Errorf("Handle(_) = %v, need nil error", err)
+	}
+	if got := strings.Join(failures, " "); got != "I1" {
+		t.Errorf("expired %q, want I1", got)
+	}
+	if len(store.files) != 0 {
+		t.Errorf("stored %v for an expired request, want nothing", store.files)
+	}
+	if err := c.Handle(answer("I2", "SUCCESS /new")); err != nil || store.files["I2.jpg"] != "jpeg" {
+		t.Errorf("Handle(_) = %v, stored %v, want I2.jpg", err, store.files)
+	}
+}
+
+func TestRetryCoordinatorRequestFails(t *testing.T) {
+	client := &fakeClient{errs: map[string]error{"/gone": whatsmeow.ErrMediaDownloadFailedWith404}}
+	d := NewDownloader(&memStorage{files: map[string]string{}}, DownloaderOpts{
+		Client:       client,
+		RequestRetry: func(info *types.MessageInfo, mediaKey []byte) error { return errors.New("not connected") },
+	})
+	c := NewRetryCoordinator(d, RetryOpts{Decrypt: fakeDecrypt})
+	if err := d.Handle(expiredImage("I1")); err == nil || !strings.Contains(err.Error(), "not connected") {
+		t.Errorf("Downloader.Handle(_) = %v, want the request error", err)
+	}
+	if n := c.Pending(); n != 0 {
+		t.Errorf("Pending() = %d after a failed request, want 0", n)
+	}
+}
@@ -0,0 +1,264 @@
+// Package metrics exports the statistics of the other packages in the Prometheus text exposition
+// format, without depending on the Prometheus client library.
+//
+// The metric names and labels are stable:
+//
+//	whatsmeow_dispatch_events_total{event, result}     counter    dispatched events; result is "ok",
+//	                                                              "no_handler", "handler_failed",
+//	                                                              "handler_panicked" or
+//	                                                              "unknown_event" (with event "")
+//	whatsmeow_dispatch_duration_seconds{event}         histogram  time taken by the handlers of an event
+//	whatsmeow_send_messages_total{outcome}             counter    messages sent by package send; outcome
+//	                                                              is "sent" or "failed"
+//	whatsmeow_send_queue_depth                         gauge      messages in the send queue, see WatchQueue
+//	whatsmeow_connected                                gauge      1 when connected, see WatchConnection
+//	whatsmeow_disconnects_total                        counter    Disconnected events
+//	whatsmeow_reconnects_total                         counter    reconnects after a disconnect
+//	whatsmeow_keepalive_timeouts_total                 counter    keepalive outages
+//	whatsmeow_log_messages_total{level}                counter    messages of package logger; level is
+//	                                                              "error" or "warn"
+//
+// The queue and connection metrics are only present once they are watched.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/connmetrics"
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/logger"
+	"github.com/KarelKubat/whatsmeow/send"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Buckets are the upper bounds of the dispatch duration histogram, in seconds.
+var Buckets = []float64{.001, .005, .01, .05, .1, .5, 1, 5}
+
+// Depther is what WatchQueue needs of a send queue, such as a `*queue.Queue`.
+type Depther interface {
+	Depth(ctx context.Context) (int, error)
+}
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	counts []int64 // per bucket of Buckets, not cumulative
+	count  int64
+	sum    float64
+}
+
+func (h *histogram) observe(secs float64) {
+	for i, b := range Buckets {
+		if secs <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += secs
+}
+
+type eventResult struct {
+	event  string
+	result string
+}
+
+// Exporter collects the metrics and serves them. The zero value isn't usable, use New.
+type Exporter struct {
+	mu        sync.Mutex
+	events    map[eventResult]int64
+	durations map[string]*histogram
+	outcomes  map[string]int64
+	queue     Depther
+	conn      *connmetrics.Metrics
+}
+
+// New returns an exporter without metrics.
+func New() *Exporter {
+	return &Exporter{
+		events:    map[eventResult]int64{},
+		durations: map[string]*histogram{},
+		outcomes:  map[string]int64{"sent": 0, "failed": 0},
+	}
+}
+
+// Register adds the hooks of handlers and send that the exporter feeds from. Call it once, since
+// hooks can't be removed.
+func (e *Exporter) Register() {
+	handlers.AddDispatchHook(e.observeDispatch)
+	send.AddAfterHook(func(types.JID, *waE2E.Message, send.Response) {
+		e.countOutcome("sent")
+	})
+	send.AddErrorHook(func(types.JID, *waE2E.Message, error) {
+		e.countOutcome("failed")
+	})
+}
+
+// WatchQueue exports the depth of a send queue, which is queried at every scrape.
+func (e *Exporter) WatchQueue(q Depther) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.queue = q
+}
+
+// WatchConnection exports the connection state and totals of connection metrics. The metrics
+// must be registered themselves, see `connmetrics.Metrics.Register`.
+func (e *Exporter) WatchConnection(m *connmetrics.Metrics) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conn = m
+}
+
+func (e *Exporter) observeDispatch(t handlers.EventType, d time.Duration, err *handlers.DispatchError) {
+	result := "ok"
+	if err != nil {
+		switch err.Type {
+		case handlers.NoHandlerFound:
+			result = "no_handler"
+		case handlers.HandlerFailed:
+			result = "handler_failed"
+		case handlers.HandlerPanicked:
+			result = "handler_panicked"
+		case handlers.UnknownEvent:
+			result = "unknown_event"
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if result == "unknown_event" {
+		// The event has no type, and no handlers ran.
+		e.events[eventResult{event: "", result: result}]++
+		return
+	}
+	e.events[eventResult{event: t.String(), result: result}]++
+	h, ok := e.durations[t.String()]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(Buckets))}
+		e.durations[t.String()] = h
+	}
+	h.observe(d.Seconds())
+}
+
+func (e *Exporter) countOutcome(outcome string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.outcomes[outcome]++
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	q, conn := e.queue, e.conn
+	e.mu.Unlock()
+
+	// Gather what needs no lock first, the queue query may take a while.
+	depth := -1
+	if q != nil {
+		n, err := q.Depth(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("metrics: %v", err), http.StatusInternalServerError)
+			return
+		}
+		depth = n
+	}
+	var stats *connmetrics.Stats
+	if conn != nil {
+		s := conn.Stats()
+		stats = &s
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.write(w, depth, stats)
+}
+
+// write writes all metrics, sorted by name and labels so that the output is deterministic.
+// depth is -1 and stats is nil when they aren't watched.
+func (e *Exporter) write(w io.Writer, depth int, stats *connmetrics.Stats) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	header(w, "whatsmeow_dispatch_events_total", "counter", "Dispatched events by event type and result.")
+	var keys []eventResult
+	for k := range e.events {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].event != keys[j].event {
+			return keys[i].event < keys[j].event
+		}
+		return keys[i].result < keys[j].result
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "whatsmeow_dispatch_events_total{event=%s,result=%s} %d\n", quote(k.event), quote(k.result), e.events[k])
+	}
+
+	header(w, "whatsmeow_dispatch_duration_seconds", "histogram", "Time taken by the handlers of an event.")
+	var events []string
+	for ev := range e.durations {
+		events = append(events, ev)
+	}
+	sort.Strings(events)
+	for _, ev := range events {
+		h := e.durations[ev]
+		var cum int64
+		for i, b := range Buckets {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "whatsmeow_dispatch_duration_seconds_bucket{event=%s,le=%s} %d\n", quote(ev), quote(formatFloat(b)), cum)
+		}
+		fmt.Fprintf(w, "whatsmeow_dispatch_duration_seconds_bucket{event=%s,le=\"+Inf\"} %d\n", quote(ev), h.count)
+		fmt.Fprintf(w, "whatsmeow_dispatch_duration_seconds_sum{event=%s} %s\n", quote(ev), formatFloat(h.sum))
+		fmt.Fprintf(w, "whatsmeow_dispatch_duration_seconds_count{event=%s} %d\n", quote(ev), h.count)
+	}
+
+	header(w, "whatsmeow_send_messages_total", "counter", "Messages sent by package send, by outcome.")
+	for _, o := range []string{"failed", "sent"} {
+		fmt.Fprintf(w, "whatsmeow_send_messages_total{outcome=%s} %d\n", quote(o), e.outcomes[o])
+	}
+
+	if depth >= 0 {
+		header(w, "whatsmeow_send_queue_depth", "gauge", "Messages waiting in the send queue.")
+		fmt.Fprintf(w, "whatsmeow_send_queue_depth %d\n", depth)
+	}
+
+	if stats != nil {
+		connected := 0
+		if stats.Connected {
+			connected = 1
+		}
+		header(w, "whatsmeow_connected", "gauge", "Whether the client is connected.")
+		fmt.Fprintf(w, "whatsmeow_connected %d\n", connected)
+		header(w, "whatsmeow_disconnects_total", "counter", "Disconnects from the server.")
+		fmt.Fprintf(w, "whatsmeow_disconnects_total %d\n", stats.Totals.Disconnects)
+		header(w, "whatsmeow_reconnects_total", "counter", "Reconnects after a disconnect.")
+		fmt.Fprintf(w, "whatsmeow_reconnects_total %d\n", stats.Totals.Reconnects)
+		header(w, "whatsmeow_keepalive_timeouts_total", "counter", "Keepalive outages.")
+		fmt.Fprintf(w, "whatsmeow_keepalive_timeouts_total %d\n", stats.Totals.KeepAliveTimeouts)
+	}
+
+	header(w, "whatsmeow_log_messages_total", "counter", "Messages logged by package logger, by level.")
+	for _, l := range []string{"error", "warn"} {
+		fmt.Fprintf(w, "whatsmeow_log_messages_total{level=%s} %d\n", quote(l), logger.Count(strings.ToUpper(l)))
+	}
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// quote quotes a label value, escaping as the exposition format requires.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
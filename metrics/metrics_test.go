@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/connmetrics"
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/send"
+	"github.com/KarelKubat/whatsmeow/waifacetest"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+type okHandler struct{}
+
+func (okHandler) Handle(ev interface{}) error { return nil }
+
+type fixedDepth int
+
+func (d fixedDepth) Depth(ctx context.Context) (int, error) { return int(d), nil }
+
+// scrape fetches the metrics and parses the samples into values by "name{labels}". It checks
+// that every sample is preceded by its TYPE.
+func scrape(t *testing.T, e *Exporter) map[string]float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text exposition format", ct)
+	}
+	samples := map[string]float64{}
+	typed := map[string]bool{}
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "# TYPE ") {
+			typed[strings.Fields(line)[2]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			t.Fatalf("malformed sample %q", line)
+		}
+		key, value := line[:i], line[i+1:]
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("sample %q: %v", line, err)
+		}
+		name := key
+		if j := strings.Index(key, "{"); j >= 0 {
+			name = key[:j]
+		}
+		base := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, "_bucket"), "_sum"), "_count")
+		if !typed[name] && !typed[base] {
+			t.Errorf("sample %q without TYPE", line)
+		}
+		samples[key] = v
+	}
+	return samples
+}
+
+func TestScrape(t *testing.T) {
+	e := New()
+	e.Register()
+	handlers.Register(handlers.Connected, okHandler{})
+
+	handlers.Dispatch(&events.Connected{})
+	handlers.Dispatch(&events.Connected{})
+	handlers.Dispatch(&events.PushName{}) // no handler
+	handlers.Dispatch(&struct{}{})        // unknown
+
+	fake := waifacetest.New()
+	fake.SendMessageFunc = func(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+		if message.GetConversation() == "fail" {
+			return whatsmeow.SendResponse{}, errors.New("offline")
+		}
+		return whatsmeow.SendResponse{ID: "X"}, nil
+	}
+	to := types.NewJID("123", types.DefaultUserServer)
+	for _, text := range []string{"a", "b", "fail"} {
+		send.Message(context.Background(), fake, to, &waE2E.Message{Conversation: proto.String(text)})
+	}
+
+	conn := connmetrics.New()
+	for _, ev := range []interface{}{&events.Connected{}, &events.Disconnected{}, &events.Connected{}} {
+		if err := conn.Handle(ev); err != nil {
+			t.Fatalf("Handle(%T) = %v, need nil error", ev, err)
+		}
+	}
+
+	got := scrape(t, e)
+	for _, key := range []string{"whatsmeow_send_queue_depth", "whatsmeow_connected"} {
+		if _, ok := got[key]; ok {
+			t.Errorf("%v is exported before it is watched", key)
+		}
+	}
+
+	e.WatchQueue(fixedDepth(4))
+	e.WatchConnection(conn)
+	got = scrape(t, e)
+	for _, test := range []struct {
+		key  string
+		want float64
+	}{
+		{`whatsmeow_dispatch_events_total{event="Connected",result="ok"}`, 2},
+		{`whatsmeow_dispatch_events_total{event="PushName",result="no_handler"}`, 1},
+		{`whatsmeow_dispatch_events_total{event="",result="unknown_event"}`, 1},
+		{`whatsmeow_dispatch_duration_seconds_bucket{event="Connected",le="+Inf"}`, 2},
+		{`whatsmeow_dispatch_duration_seconds_bucket{event="Connected",le="5"}`, 2},
+		{`whatsmeow_dispatch_duration_seconds_count{event="Connected"}`, 2},
+		{`whatsmeow_dispatch_duration_seconds_count{event="PushName"}`, 1},
+		{`whatsmeow_send_messages_total{outcome="sent"}`, 2},
+		{`whatsmeow_send_messages_total{outcome="failed"}`, 1},
+		{`whatsmeow_send_queue_depth`, 4},
+		{`whatsmeow_connected`, 1},
+		{`whatsmeow_disconnects_total`, 1},
+		{`whatsmeow_reconnects_total`, 1},
+		{`whatsmeow_keepalive_timeouts_total`, 0},
+	} {
+		v, ok := got[test.key]
+		if !ok {
+			t.Errorf("%v is missing", test.key)
+			continue
+		}
+		if v != test.want {
+			t.Errorf("%v = %v, want %v", test.key, v, test.want)
+		}
+	}
+	if _, ok := got[`whatsmeow_log_messages_total{level="error"}`]; !ok {
+		t.Errorf("log message counts are missing")
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got, want := quote("a\"b\\c\nd"), `"a\"b\\c\nd"`; got != want {
+		t.Errorf("quote(_) = %s, want %s", got, want)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	e := New()
+	e.observeDispatch(handlers.Message, 0, nil)
+	e.observeDispatch(handlers.Connected, 0, nil)
+	var first, second strings.Builder
+	e.write(&first, -1, nil)
+	e.write(&second, -1, nil)
+	if first.String() != second.String() {
+		t.Errorf("two writes differ:\n%v\n%v", first.String(), second.String())
+	}
+	if i, j := strings.Index(first.String(), `event="Connected"`), strings.Index(first.String(), `event="Message"`); i > j {
+		t.Errorf("events aren't sorted:\n%v", first.String())
+	}
+}
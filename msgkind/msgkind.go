@@ -0,0 +1,164 @@
+// Package msgkind dispatches Message events by the kind of their content, such as text, image or
+// poll, so that handlers don't start with a ladder of nil checks.
+package msgkind
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Kind is the kind of the content of a message.
+type Kind int
+
+const (
+	Unknown Kind = iota
+	TextMessage
+	ImageMessage
+	VideoMessage
+	AudioMessage
+	DocumentMessage
+	StickerMessage
+	ReactionMessage
+	PollMessage
+	LocationMessage
+	ContactMessage
+	MessageRevoked // a message was deleted for everyone, see handlers.AsRevoke
+	EditedMessage  // a message was edited, see handlers.AsEdit
+
+	lastKind // Keep at last slot for tests
+)
+
+// String returns the string representation of a Kind.
+func (k Kind) String() string {
+	return []string{
+		"Unknown",
+		"TextMessage",
+		"ImageMessage",
+		"VideoMessage",
+		"AudioMessage",
+		"DocumentMessage",
+		"StickerMessage",
+		"ReactionMessage",
+		"PollMessage",
+		"LocationMessage",
+		"ContactMessage",
+		"MessageRevoked",
+		"EditedMessage",
+	}[k]
+}
+
+// Unwrap returns the content of a message inside its wrappers: ephemeral (disappearing),
+// view-once, document-with-caption and edited messages wrap the actual content. The content of an
+// edit is a protocol message, see handlers.AsEdit.
+func Unwrap(msg *waE2E.Message) *waE2E.Message {
+	for msg != nil {
+		var inner *waE2E.FutureProofMessage
+		switch {
+		case msg.EphemeralMessage != nil:
+			inner = msg.EphemeralMessage
+		case msg.ViewOnceMessage != nil:
+			inner = msg.ViewOnceMessage
+		case msg.ViewOnceMessageV2 != nil:
+			inner = msg.ViewOnceMessageV2
+		case msg.ViewOnceMessageV2Extension != nil:
+			inner = msg.ViewOnceMessageV2Extension
+		case msg.DocumentWithCaptionMessage != nil:
+			inner = msg.DocumentWithCaptionMessage
+		case msg.EditedMessage != nil:
+			inner = msg.EditedMessage
+		default:
+			return msg
+		}
+		msg = inner.GetMessage()
+	}
+	return nil
+}
+
+// Classify returns the kind of the content of a message, after unwrapping it.
+func Classify(msg *waE2E.Message) Kind {
+	msg = Unwrap(msg)
+	switch {
+	case msg == nil:
+		return Unknown
+	case msg.Conversation != nil || msg.ExtendedTextMessage != nil:
+		return TextMessage
+	case msg.ImageMessage != nil:
+		return ImageMessage
+	case msg.VideoMessage != nil:
+		return VideoMessage
+	case msg.AudioMessage != nil:
+		return AudioMessage
+	case msg.DocumentMessage != nil:
+		return DocumentMessage
+	case msg.StickerMessage != nil:
+		return StickerMessage
+	case msg.ReactionMessage != nil:
+		return ReactionMessage
+	case msg.PollCreationMessage != nil || msg.PollCreationMessageV2 != nil ||
+		msg.PollCreationMessageV3 != nil || msg.PollUpdateMessage != nil:
+		return PollMessage
+	case msg.LocationMessage != nil || msg.LiveLocationMessage != nil:
+		return LocationMessage
+	case msg.ContactMessage != nil || msg.ContactsArrayMessage != nil:
+		return ContactMessage
+	case msg.ProtocolMessage != nil && msg.ProtocolMessage.GetType() == waE2E.ProtocolMessage_REVOKE:
+		return MessageRevoked
+	case msg.ProtocolMessage.GetType() == waE2E.ProtocolMessage_MESSAGE_EDIT:
+		return EditedMessage
+	}
+	return Unknown
+}
+
+type handler interface {
+	Handle(evt interface{}) error
+}
+
+// Dispatcher dispatches Message events to the handlers of their kind. The handlers get the
+// original *events.Message; use Unwrap to get at the content. Messages of kinds without handlers
+// are ignored. The zero value isn't usable, use New.
+type Dispatcher struct {
+	mu       sync.RWMutex
+	registry map[Kind][]handler
+}
+
+// New returns a dispatcher without handlers.
+func New() *Dispatcher {
+	return &Dispatcher{registry: map[Kind][]handler{}}
+}
+
+// RegisterMessageKind registers a handler for the messages of a kind. Like with
+// `handlers.Register`, more than one handler may be registered for a kind, and they are invoked
+// in order until one fails.
+func (d *Dispatcher) RegisterMessageKind(kind Kind, h handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.registry[kind] = append(d.registry[kind], h)
+}
+
+// Register registers the dispatcher for Message events.
+func (d *Dispatcher) Register() {
+	handlers.Register(handlers.Message, d)
+}
+
+// Handle implements handlers.handler for Message events.
+func (d *Dispatcher) Handle(ev interface{}) error {
+	m, ok := ev.(*events.Message)
+	if !ok {
+		return fmt.Errorf("msgkind.Dispatcher.Handle: unexpected event %T", ev)
+	}
+	kind := Classify(m.Message)
+	d.mu.RLock()
+	hs := d.registry[kind]
+	d.mu.RUnlock()
+	for _, h := range hs {
+		if err := h.Handle(m); err != nil {
+			return fmt.Errorf("msgkind.Dispatcher.Handle: %v: %w", kind, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package msgkind
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestKindString checks that there are strings for all kinds.
+func TestKindString(t *testing.T) {
+	for k := Unknown; k < lastKind; k++ {
+		t.Log(int(k), k.String())
+	}
+}
+
+func TestClassify(t *testing.T) {
+	image := &waE2E.Message{ImageMessage: &waE2E.ImageMessage{}}
+	edit := &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+		Type:          waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+		Key:           &waCommon.MessageKey{ID: proto.String("typo")},
+		EditedMessage: &waE2E.Message{Conversation: proto.String("fixed")},
+	}}
+	revoke := &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+		Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+		Key:  &waCommon.MessageKey{ID: proto.String("gone")},
+	}}
+	for _, test := range []struct {
+		description string
+		msg         *waE2E.Message
+		want        Kind
+	}{
+		{"nil", nil, Unknown},
+		{"empty", &waE2E.Message{}, Unknown},
+		{"conversation", &waE2E.Message{Conversation: proto.String("hi")}, TextMessage},
+		{"extended text", &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: proto.String("hi")}}, TextMessage},
+		{"image", image, ImageMessage},
+		{"video", &waE2E.Message{VideoMessage: &waE2E.VideoMessage{}}, VideoMessage},
+		{"audio", &waE2E.Message{AudioMessage: &waE2E.AudioMessage{}}, AudioMessage},
+		{"document", &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{}}, DocumentMessage},
+		{"sticker", &waE2E.Message{StickerMessage: &waE2E.StickerMessage{}}, StickerMessage},
+		{"reaction", &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{}}, ReactionMessage},
+		{"poll", &waE2E.Message{PollCreationMessageV3: &waE2E.PollCreationMessage{}}, PollMessage},
+		{"live location", &waE2E.Message{LiveLocationMessage: &waE2E.LiveLocationMessage{}}, LocationMessage},
+		{"contacts", &waE2E.Message{ContactsArrayMessage: &waE2E.ContactsArrayMessage{}}, ContactMessage},
+		{"ephemeral image", &waE2E.Message{EphemeralMessage: &waE2E.FutureProofMessage{Message: image}}, ImageMessage},
+		{
+			"ephemeral view-once image",
+			&waE2E.Message{EphemeralMessage: &waE2E.FutureProofMessage{Message: &waE2E.Message{
+				ViewOnceMessageV2: &waE2E.FutureProofMessage{Message: image},
+			}}},
+			ImageMessage,
+		},
+		{
+			"document with caption",
+			&waE2E.Message{DocumentWithCaptionMessage: &waE2E.FutureProofMessage{Message: &waE2E.Message{
+				DocumentMessage: &waE2E.DocumentMessage{Caption: proto.String("invoice")},
+			}}},
+			DocumentMessage,
+		},
+		{"empty wrapper", &waE2E.Message{ViewOnceMessage: &waE2E.FutureProofMessage{}}, Unknown},
+		{"revoke", revoke, MessageRevoked},
+		{"edit", edit, EditedMessage},
+		{"edit as sent", &waE2E.Message{EditedMessage: &waE2E.FutureProofMessage{Message: edit}}, EditedMessage},
+		{"other protocol message", &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{Type: waE2E.ProtocolMessage_EPHEMERAL_SETTING.Enum()}}, Unknown},
+	} {
+		if got := Classify(test.msg); got != test.want {
+			t.Errorf("%v: Classify(_) = %v, want %v", test.description, got, test.want)
+		}
+	}
+}
+
+type handlerFunc func(ev interface{}) error
+
+func (f handlerFunc) Handle(ev interface{}) error { return f(ev) }
+
+func TestDispatcher(t *testing.T) {
+	d := New()
+	var got []string
+	for _, kind := range []Kind{TextMessage, ImageMessage, PollMessage} {
+		kind := kind
+		d.RegisterMessageKind(kind, handlerFunc(func(ev interface{}) error {
+			got = append(got, kind.String()+" "+ev.(*events.Message).Info.ID)
+			return nil
+		}))
+	}
+	errBoom := errors.New("boom")
+	d.RegisterMessageKind(AudioMessage, handlerFunc(func(ev interface{}) error { return errBoom }))
+
+	for _, test := range []struct {
+		id      string
+		msg     *waE2E.Message
+		wantErr error
+	}{
+		{id: "T", msg: &waE2E.Message{Conversation: proto.String("hi")}},
+		{id: "I", msg: &waE2E.Message{ViewOnceMessage: &waE2E.FutureProofMessage{Message: &waE2E.Message{ImageMessage: &waE2E.ImageMessage{}}}}},
+		{id: "P", msg: &waE2E.Message{PollCreationMessage: &waE2E.PollCreationMessage{}}},
+		{id: "V", msg: &waE2E.Message{VideoMessage: &waE2E.VideoMessage{}}}, // no handler
+		{id: "A", msg: &waE2E.Message{AudioMessage: &waE2E.AudioMessage{}}, wantErr: errBoom},
+	} {
+		m := &events.Message{Message: test.msg}
+		m.Info.ID = test.id
+		if err := d.Handle(m); !errors.Is(err, test.wantErr) || (test.wantErr == nil && err != nil) {
+			t.Errorf("Handle(%v) = %v, want %v", test.id, err, test.wantErr)
+		}
+	}
+	want := []string{"TextMessage T", "ImageMessage I", "PollMessage P"}
+	if len(got) != len(want) {
+		t.Fatalf("handlers saw %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("handlers saw %q, want %q", got, want)
+			break
+		}
+	}
+	if err := d.Handle(&events.Receipt{}); err == nil {
+		t.Errorf("Handle(*events.Receipt) = nil, need error")
+	}
+}
+
+func TestDispatcherRevoke(t *testing.T) {
+	admin := types.NewJID("3", types.DefaultUserServer)
+	member := types.NewJID("2", types.DefaultUserServer)
+	group := types.NewJID("4", types.GroupServer)
+
+	d := New()
+	var got []*handlers.Revoke
+	d.RegisterMessageKind(MessageRevoked, handlerFunc(func(ev interface{}) error {
+		r, ok := handlers.AsRevoke(ev.(*events.Message))
+		if !ok {
+			return errors.New("not a revoke")
+		}
+		got = append(got, r)
+		return nil
+	}))
+	// An admin deletes the message of a member.
+	m := &events.Message{
+		Info: types.MessageInfo{MessageSource: types.MessageSource{Chat: group, Sender: admin, IsGroup: true}},
+		Message: &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+			Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+			Key:  &waCommon.MessageKey{ID: proto.String("gone"), Participant: proto.String(member.String())},
+		}},
+	}
+	if err := d.Handle(m); err != nil {
+		t.Fatalf("Handle(_) = %v, need nil error", err)
+	}
+	if len(got) != 1 || got[0].Target.ID != "gone" || got[0].Target.Sender != member || got[0].Actor != admin {
+		t.Errorf("MessageRevoked handler saw %+v, want the revoke of %v's message by %v", got, member, admin)
+	}
+}
+
+func TestDispatcherEdit(t *testing.T) {
+	other := types.NewJID("2", types.DefaultUserServer)
+	d := New()
+	var got []*handlers.Edit
+	d.RegisterMessageKind(EditedMessage, handlerFunc(func(ev interface{}) error {
+		e, ok := handlers.AsEdit(ev.(*events.Message))
+		if !ok {
+			return errors.New("not an edit")
+		}
+		got = append(got, e)
+		return nil
+	}))
+	d.RegisterMessageKind(TextMessage, handlerFunc(func(ev interface{}) error {
+		return errors.New("an edit is not a text")
+	}))
+	m := &events.Message{
+		Info: types.MessageInfo{MessageSource: types.MessageSource{Chat: other, Sender: other}, Edit: types.EditAttributeMessageEdit},
+		Message: &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+			Type:          waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+			Key:           &waCommon.MessageKey{ID: proto.String("typo")},
+			EditedMessage: &waE2E.Message{Conversation: proto.String("fixed")},
+		}},
+	}
+	if err := d.Handle(m); err != nil {
+		t.Fatalf("Handle(_) = %v, need nil error", err)
+	}
+	if len(got) != 1 || got[0].Target.ID != "typo" || got[0].NewContent.GetConversation() != "fixed" || got[0].Editor != other {
+		t.Errorf("EditedMessage handler saw %+v, want the edit of typo by %v", got, other)
+	}
+}
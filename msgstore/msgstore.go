@@ -0,0 +1,329 @@
+// Package msgstore keeps received messages in an SQLite database, e.g. to render conversations
+// in a user interface. Edits and revokes update the stored messages.
+package msgstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/internal/sqlmigrate"
+	"github.com/KarelKubat/whatsmeow/media"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// migrations are the schema of the store, see sqlmigrate.
+var migrations = []string{
+	`CREATE TABLE messages (
+		chat                 TEXT    NOT NULL,
+		id                   TEXT    NOT NULL,
+		sender               TEXT    NOT NULL,
+		from_me              INTEGER NOT NULL,
+		timestamp            INTEGER NOT NULL,
+		text                 TEXT    NOT NULL,
+		media_kind           TEXT,
+		media_mimetype       TEXT,
+		media_size           INTEGER,
+		media_sha256         TEXT,
+		media_path           TEXT,
+		reply_to_id          TEXT,
+		reply_to_sender      TEXT,
+		edited_at            INTEGER,
+		revoked_at           INTEGER,
+		revoked_for_everyone INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (chat, id)
+	);
+	CREATE INDEX messages_chat_timestamp ON messages (chat, timestamp);`,
+}
+
+// Media describes the media of a message.
+type Media struct {
+	Kind     string // "image", "video", "audio", "document" or "sticker"
+	Mimetype string
+	Size     int64
+	SHA256   string // hex
+	Path     string // of the cached file, empty when not cached
+}
+
+// Message is a stored message.
+type Message struct {
+	Chat               types.JID
+	ID                 types.MessageID
+	Sender             types.JID
+	FromMe             bool
+	Timestamp          time.Time
+	Text               string // the text, or the caption of media; the new text after an edit
+	Media              *Media // nil for text messages
+	ReplyTo            *handlers.MessageRef
+	Edited             time.Time // zero when not edited
+	Revoked            time.Time // zero when not revoked
+	RevokedForEveryone bool      // false when deleted for me only
+}
+
+// Opts configures a Store.
+type Opts struct {
+	Cache *media.Cache // when set, consulted for the local paths of media
+}
+
+// Store keeps messages in an SQLite database.
+type Store struct {
+	db   *sql.DB
+	opts Opts
+}
+
+// New returns a store in `db`, which must be an SQLite database. The tables are created or
+// migrated when needed.
+func New(ctx context.Context, db *sql.DB, opts Opts) (*Store, error) {
+	if err := sqlmigrate.Up(ctx, db, "msgstore_version", migrations); err != nil {
+		return nil, fmt.Errorf("msgstore.New: %w", err)
+	}
+	return &Store{db: db, opts: opts}, nil
+}
+
+// Register registers the store for Message events, and for the synthetic EditMessage and
+// MessageRevoked events.
+func (s *Store) Register() {
+	handlers.Register(handlers.Message, s)
+	handlers.Register(handlers.EditMessage, s)
+	handlers.Register(handlers.MessageRevoked, s)
+}
+
+// Handle implements handlers.handler. Messages are stored, edits and revokes update them.
+func (s *Store) Handle(ev interface{}) error {
+	switch v := ev.(type) {
+	case *events.Message:
+		return s.put(v)
+	case *handlers.Edit:
+		return s.edit(v)
+	case *handlers.Revoke:
+		return s.revoke(v)
+	}
+	return fmt.Errorf("msgstore.Store.Handle: unexpected event %T", ev)
+}
+
+// put stores a message. Storing a message again updates it, but keeps the text of an edit.
+// Protocol messages and reactions aren't stored; edits and revokes are seen as their own events.
+func (s *Store) put(m *events.Message) error {
+	msg := m.Message
+	if msg == nil || msg.ProtocolMessage != nil || msg.ReactionMessage != nil {
+		return nil
+	}
+	var kind, mimetype, sha, path sql.NullString
+	var size sql.NullInt64
+	if k, md := mediaOf(msg); md != nil {
+		kind = sql.NullString{String: k, Valid: true}
+		mimetype = sql.NullString{String: md.GetMimetype(), Valid: true}
+		size = sql.NullInt64{Int64: int64(md.GetFileLength()), Valid: true}
+		sha = sql.NullString{String: hex.EncodeToString(md.GetFileSHA256()), Valid: true}
+		if s.opts.Cache != nil && len(md.GetFileSHA256()) > 0 {
+			if p, ok := s.opts.Cache.Lookup(md.GetFileSHA256()); ok {
+				path = sql.NullString{String: p, Valid: true}
+			}
+		}
+	}
+	var replyID, replySender sql.NullString
+	if ci := contextInfo(msg); ci.GetStanzaID() != "" {
+		replyID = sql.NullString{String: ci.GetStanzaID(), Valid: true}
+		replySender = sql.NullString{String: ci.GetParticipant(), Valid: true}
+	}
+	_, err := s.db.Exec(`INSERT INTO messages
+			(chat, id, sender, from_me, timestamp, text, media_kind, media_mimetype, media_size,
+			 media_sha256, media_path, reply_to_id, reply_to_sender)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat, id) DO UPDATE SET
+			sender          = excluded.sender,
+			from_me         = excluded.from_me,
+			timestamp       = excluded.timestamp,
+			text            = CASE WHEN edited_at IS NULL THEN excluded.text ELSE text END,
+			media_kind      = excluded.media_kind,
+			media_mimetype  = excluded.media_mimetype,
+			media_size      = excluded.media_size,
+			media_sha256    = excluded.media_sha256,
+			media_path      = COALESCE(excluded.media_path, media_path),
+			reply_to_id     = excluded.reply_to_id,
+			reply_to_sender = excluded.reply_to_sender`,
+		m.Info.Chat.String(), m.Info.ID, m.Info.Sender.String(), m.Info.IsFromMe, m.Info.Timestamp.UnixMilli(),
+		textOf(msg), kind, mimetype, size, sha, path, replyID, replySender)
+	if err != nil {
+		return fmt.Errorf("msgstore.Store: storing %v: %w", m.Info.ID, err)
+	}
+	return nil
+}
+
+// edit replaces the text of a stored message. A replayed or older edit doesn't undo a later one.
+func (s *Store) edit(e *handlers.Edit) error {
+	_, err := s.db.Exec(`UPDATE messages SET text = ?, edited_at = ?
+		WHERE chat = ? AND id = ? AND (edited_at IS NULL OR edited_at <= ?)`,
+		textOf(e.NewContent), e.Timestamp.UnixMilli(), e.Target.Chat.String(), e.Target.ID, e.Timestamp.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("msgstore.Store: editing %v: %w", e.Target.ID, err)
+	}
+	return nil
+}
+
+// revoke marks a stored message as deleted. The content is kept; the user interface decides
+// what to show.
+func (s *Store) revoke(r *handlers.Revoke) error {
+	_, err := s.db.Exec(`UPDATE messages SET
+			revoked_at           = COALESCE(revoked_at, ?),
+			revoked_for_everyone = MAX(revoked_for_everyone, ?)
+		WHERE chat = ? AND id = ?`,
+		r.Timestamp.UnixMilli(), r.ForEveryone, r.Target.Chat.String(), r.Target.ID)
+	if err != nil {
+		return fmt.Errorf("msgstore.Store: revoking %v: %w", r.Target.ID, err)
+	}
+	return nil
+}
+
+// Cursor is a position in a chat, in the order of Page: by timestamp, and by ID for messages
+// with the same timestamp. The zero Cursor is the position after the newest message.
+type Cursor struct {
+	Timestamp time.Time
+	ID        types.MessageID
+}
+
+// Cursor returns the position of a message, to page back from it.
+func (m Message) Cursor() Cursor {
+	return Cursor{Timestamp: m.Timestamp, ID: m.ID}
+}
+
+// Page returns up to `limit` messages of a chat that come before `before`, newest first. A zero
+// `before` starts at the newest message. To page back, pass the Cursor of the oldest returned
+// message; messages with the same timestamp are neither skipped nor repeated.
+func (s *Store) Page(chat types.JID, before Cursor, limit int) ([]Message, error) {
+	const columns = `SELECT id, sender, from_me, timestamp, text, media_kind, media_mimetype,
+			media_size, media_sha256, media_path, reply_to_id, reply_to_sender, edited_at, revoked_at,
+			revoked_for_everyone
+		FROM messages`
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if before == (Cursor{}) {
+		rows, err = s.db.Query(columns+` WHERE chat = ? ORDER BY timestamp DESC, id DESC LIMIT ?`,
+			chat.String(), limit)
+	} else {
+		ts := before.Timestamp.UnixMilli()
+		rows, err = s.db.Query(columns+` WHERE chat = ? AND (timestamp < ? OR (timestamp = ? AND id < ?))
+			ORDER BY timestamp DESC, id DESC LIMIT ?`,
+			chat.String(), ts, ts, before.ID, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("msgstore.Store.Page: %w", err)
+	}
+	defer rows.Close()
+	var out []Message
+	for rows.Next() {
+		var (
+			id, sender, text          string
+			fromMe, forEveryone       bool
+			ts                        int64
+			kind, mimetype, sha, path sql.NullString
+			size, edited, revoked     sql.NullInt64
+			replyID, replySender      sql.NullString
+		)
+		if err := rows.Scan(&id, &sender, &fromMe, &ts, &text, &kind, &mimetype, &size, &sha, &path,
+			&replyID, &replySender, &edited, &revoked, &forEveryone); err != nil {
+			return nil, fmt.Errorf("msgstore.Store.Page: %w", err)
+		}
+		m := Message{
+			Chat:               chat,
+			ID:                 id,
+			FromMe:             fromMe,
+			Timestamp:          time.UnixMilli(ts),
+			Text:               text,
+			RevokedForEveryone: forEveryone,
+		}
+		if m.Sender, err = types.ParseJID(sender); err != nil {
+			return nil, fmt.Errorf("msgstore.Store.Page: %w", err)
+		}
+		if kind.Valid {
+			m.Media = &Media{Kind: kind.String, Mimetype: mimetype.String, Size: size.Int64, SHA256: sha.String, Path: path.String}
+		}
+		if replyID.Valid {
+			m.ReplyTo = &handlers.MessageRef{Chat: chat, ID: replyID.String}
+			if replySender.String != "" {
+				if m.ReplyTo.Sender, err = types.ParseJID(replySender.String); err != nil {
+					return nil, fmt.Errorf("msgstore.Store.Page: %w", err)
+				}
+			}
+		}
+		if edited.Valid {
+			m.Edited = time.UnixMilli(edited.Int64)
+		}
+		if revoked.Valid {
+			m.Revoked = time.UnixMilli(revoked.Int64)
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("msgstore.Store.Page: %w", err)
+	}
+	return out, nil
+}
+
+// mediaFile is what the media messages have in common.
+type mediaFile interface {
+	GetMimetype() string
+	GetFileLength() uint64
+	GetFileSHA256() []byte
+}
+
+// mediaOf returns the kind and the media of a message, or nil when it carries none.
+func mediaOf(msg *waE2E.Message) (string, mediaFile) {
+	switch {
+	case msg.ImageMessage != nil:
+		return "image", msg.ImageMessage
+	case msg.VideoMessage != nil:
+		return "video", msg.VideoMessage
+	case msg.AudioMessage != nil:
+		return "audio", msg.AudioMessage
+	case msg.DocumentMessage != nil:
+		return "document", msg.DocumentMessage
+	case msg.StickerMessage != nil:
+		return "sticker", msg.StickerMessage
+	}
+	return "", nil
+}
+
+// textOf returns the text of a message, or the caption of its media.
+func textOf(msg *waE2E.Message) string {
+	switch {
+	case msg.GetConversation() != "":
+		return msg.GetConversation()
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetText()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetCaption()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetCaption()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetCaption()
+	}
+	return ""
+}
+
+// contextInfo returns the context info of a message, which holds the quoted message of a reply.
+func contextInfo(msg *waE2E.Message) *waE2E.ContextInfo {
+	switch {
+	case msg.ExtendedTextMessage != nil:
+		return msg.ExtendedTextMessage.GetContextInfo()
+	case msg.ImageMessage != nil:
+		return msg.ImageMessage.GetContextInfo()
+	case msg.VideoMessage != nil:
+		return msg.VideoMessage.GetContextInfo()
+	case msg.AudioMessage != nil:
+		return msg.AudioMessage.GetContextInfo()
+	case msg.DocumentMessage != nil:
+		return msg.DocumentMessage.GetContextInfo()
+	case msg.StickerMessage != nil:
+		return msg.StickerMessage.GetContextInfo()
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package msgstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open(_) = _, %v; need nil error", err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own in-memory database
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var (
+	chat  = types.NewJID("123", types.DefaultUserServer)
+	me    = types.NewJID("999", types.DefaultUserServer)
+	start = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func message(id types.MessageID, sender types.JID, secs int, msg *waE2E.Message) *events.Message {
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: sender, IsFromMe: sender == me},
+			ID:            id,
+			Timestamp:     start.Add(time.Duration(secs) * time.Second),
+		},
+		Message: msg,
+	}
+}
+
+func TestConversation(t *testing.T) {
+	s, err := New(context.Background(), openDB(t), Opts{})
+	if err != nil {
+		t.Fatalf("New(_) = _, %v; need nil error", err)
+	}
+	s.Register()
+	t.Cleanup(func() {
+		handlers.Unregister(handlers.Message, s)
+		handlers.Unregister(handlers.EditMessage, s)
+		handlers.Unregister(handlers.MessageRevoked, s)
+	})
+
+	hello := message("A1", chat, 1, &waE2E.Message{Conversation: proto.String("hello")})
+	for _, ev := range []*events.Message{
+		hello,
+		message("M1", me, 2, &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:        proto.String("hi"),
+			ContextInfo: &waE2E.ContextInfo{StanzaID: proto.String("A1"), Participant: proto.String(chat.String())},
+		}}),
+		message("A2", chat, 3, &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			Caption:    proto.String("look"),
+			Mimetype:   proto.String("image/jpeg"),
+			FileLength: proto.Uint64(1234),
+			FileSHA256: []byte{0xab, 0xcd},
+		}}),
+		message("E1", chat, 4, &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+			Type:          waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+			Key:           &waCommon.MessageKey{ID: proto.String("A1")},
+			EditedMessage: &waE2E.Message{Conversation: proto.String("hello there")},
+			TimestampMS:   proto.Int64(start.Add(4 * time.Second).UnixMilli()),
+		}}),
+		message("R1", chat, 5, &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+			Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+			Key:  &waCommon.MessageKey{ID: proto.String("A2")},
+		}}),
+		message("X1", chat, 6, &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{
+			Key:  &waCommon.MessageKey{ID: proto.String("M1")},
+			Text: proto.String("👍"),
+		}}),
+		hello, // replayed, doesn't undo the edit
+	} {
+		if err := handlers.Dispatch(ev); err != nil {
+			t.Fatalf("Dispatch(%v) = %v, need nil error", ev.Info.ID, err)
+		}
+	}
+
+	got, err := s.Page(chat, Cursor{}, 10)
+	if err != nil {
+		t.Fatalf("Page(_) = _, %v; need nil error", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Page(_) returned %v messages, want 3: %+v", len(got), got)
+	}
+	a2, m1, a1 := got[0], got[1], got[2]
+
+	if a2.ID != "A2" || a2.Text != "look" || a2.Media == nil ||
+		*a2.Media != (Media{Kind: "image", Mimetype: "image/jpeg", Size: 1234, SHA256: "abcd"}) {
+		t.Errorf("image = %+v (media %+v), want A2 with caption and media", a2, a2.Media)
+	}
+	if !a2.Revoked.Equal(start.Add(5*time.Second)) || !a2.RevokedForEveryone {
+		t.Errorf("image revoked at %v for everyone %v, want %v and true", a2.Revoked, a2.RevokedForEveryone, start.Add(5*time.Second))
+	}
+	if m1.ID != "M1" || !m1.FromMe || m1.Sender != me || m1.ReplyTo == nil || m1.ReplyTo.ID != "A1" || m1.ReplyTo.Sender != chat {
+		t.Errorf("reply = %+v (reply to %+v), want M1 from me in reply to A1", m1, m1.ReplyTo)
+	}
+	if a1.ID != "A1" || a1.Text != "hello there" || !a1.Edited.Equal(start.Add(4*time.Second)) || !a1.Revoked.IsZero() {
+		t.Errorf("edited = %+v, want A1 with the new text, edited and not revoked", a1)
+	}
+
+	// Paging back.
+	older, err := s.Page(chat, m1.Cursor(), 10)
+	if err != nil {
+		t.Fatalf("Page(_) = _, %v; need nil error", err)
+	}
+	if len(older) != 1 || older[0].ID != "A1" {
+		t.Errorf("Page(before M1) = %+v, want A1", older)
+	}
+	newest, err := s.Page(chat, Cursor{}, 1)
+	if err != nil {
+		t.Fatalf("Page(_) = _, %v; need nil error", err)
+	}
+	if len(newest) != 1 || newest[0].ID != "A2" {
+		t.Errorf("Page(limit 1) = %+v, want A2", newest)
+	}
+}
+
+func TestPageSameTimestamp(t *testing.T) {
+	s, err := New(context.Background(), openDB(t), Opts{})
+	if err != nil {
+		t.Fatalf("New(_) = _, %v; need nil error", err)
+	}
+	// Five messages in the same second, and one before.
+	for _, id := range []types.MessageID{"B", "D", "A", "E", "C"} {
+		if err := s.Handle(message(id, chat, 2, &waE2E.Message{Conversation: proto.String(id)})); err != nil {
+			t.Fatalf("Handle(%v) = %v, need nil error", id, err)
+		}
+	}
+	if err := s.Handle(message("Z", chat, 1, &waE2E.Message{Conversation: proto.String("Z")})); err != nil {
+		t.Fatalf("Handle(Z) = %v, need nil error", err)
+	}
+
+	var ids []types.MessageID
+	cursor := Cursor{}
+	for i := 0; i < 10; i++ {
+		page, err := s.Page(chat, cursor, 2)
+		if err != nil {
+			t.Fatalf("Page(_) = _, %v; need nil error", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, m := range page {
+			ids = append(ids, m.ID)
+		}
+		cursor = page[len(page)-1].Cursor()
+	}
+	if got, want := fmt.Sprint(ids), "[E D C B A Z]"; got != want {
+		t.Errorf("pages = %v, want %v", got, want)
+	}
+}
+
+func TestHandleUnexpected(t *testing.T) {
+	s, err := New(context.Background(), openDB(t), Opts{})
+	if err != nil {
+		t.Fatalf("New(_) = _, %v; need nil error", err)
+	}
+	if err := s.Handle(&events.Connected{}); err == nil {
+		t.Errorf("Handle(*events.Connected) = nil, need error")
+	}
+}
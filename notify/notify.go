@@ -0,0 +1,287 @@
+// Package notify sends notifications about operational events, such as a temporary ban or
+// failing handlers, to an admin chat: the own number or a private group.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/logger"
+	"github.com/KarelKubat/whatsmeow/send"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Severity is the importance of a notification.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+// String returns the string representation of a Severity.
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "INFO"
+	case Warning:
+		return "WARNING"
+	case Critical:
+		return "CRITICAL"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// maxLines is the number of distinct notifications that a batch lists.
+const maxLines = 10
+
+// now and afterFunc are swapped in tests.
+var (
+	now       = time.Now
+	afterFunc = func(d time.Duration, f func()) { time.AfterFunc(d, f) }
+)
+
+// Opts configures an AdminNotifier.
+type Opts struct {
+	MinSeverity Severity                   // lower severities are ignored
+	Interval    time.Duration              // at most one message per severity per interval, 1 minute when zero, unlimited when negative
+	Intervals   map[Severity]time.Duration // overrides Interval for a severity
+	Prefix      string                     // put in front of every message, e.g. the name of the bot
+	Timeout     time.Duration              // of sending a message, 30 seconds when zero
+}
+
+// batch holds the notifications of a severity that wait for the rate limit.
+type batch struct {
+	last      time.Time // when the last message was sent
+	pending   []string
+	scheduled bool // a flush is scheduled
+}
+
+// AdminNotifier sends notifications to an admin chat. Per severity, it sends at most one message
+// per interval; notifications that come in faster are collapsed into one message at the end of
+// the interval.
+//
+// Notifications never recurse: notifications that arise in the goroutine that sends a
+// notification, e.g. because the failing send is logged, are dropped. Notifications of other
+// goroutines are handled as usual. The zero value isn't usable, use NewAdminNotifier.
+type AdminNotifier struct {
+	cli  send.Sender
+	chat types.JID
+	opts Opts
+
+	mu      sync.Mutex
+	sending map[int64]bool // goroutines that are sending
+	batches map[Severity]*batch
+	dropped int
+}
+
+// NewAdminNotifier returns a notifier that sends to `chat` using `cli`.
+func NewAdminNotifier(cli send.Sender, chat types.JID, opts Opts) *AdminNotifier {
+	if opts.Interval == 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	return &AdminNotifier{
+		cli:     cli,
+		chat:    chat,
+		opts:    opts,
+		sending: map[int64]bool{},
+		batches: map[Severity]*batch{},
+	}
+}
+
+// Dropped returns the number of notifications that were dropped because they arose while
+// sending a notification.
+func (n *AdminNotifier) Dropped() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.dropped
+}
+
+func (n *AdminNotifier) interval(sev Severity) time.Duration {
+	if d, ok := n.opts.Intervals[sev]; ok {
+		return d
+	}
+	return n.opts.Interval
+}
+
+// Notify sends a notification, or batches it when the rate limit of the severity was reached.
+// Sending is synchronous.
+func (n *AdminNotifier) Notify(sev Severity, format string, args ...interface{}) {
+	if sev < n.opts.MinSeverity {
+		return
+	}
+	text := fmt.Sprintf(format, args...)
+
+	n.mu.Lock()
+	if n.sending[goid()] {
+		n.dropped++
+		n.mu.Unlock()
+		return
+	}
+	b, ok := n.batches[sev]
+	if !ok {
+		b = &batch{}
+		n.batches[sev] = b
+	}
+	t := now()
+	wait := b.last.Add(n.interval(sev)).Sub(t)
+	if wait > 0 || b.scheduled {
+		b.pending = append(b.pending, text)
+		if !b.scheduled {
+			b.scheduled = true
+			afterFunc(wait, func() { n.flush(sev) })
+		}
+		n.mu.Unlock()
+		return
+	}
+	b.last = t
+	n.mu.Unlock()
+
+	n.send(sev, []string{text})
+}
+
+// flush sends the pending notifications of a severity.
+func (n *AdminNotifier) flush(sev Severity) {
+	n.mu.Lock()
+	b := n.batches[sev]
+	pending := b.pending
+	b.pending = nil
+	b.scheduled = false
+	b.last = now()
+	n.mu.Unlock()
+
+	if len(pending) > 0 {
+		n.send(sev, pending)
+	}
+}
+
+// send sends notifications as one message.
+func (n *AdminNotifier) send(sev Severity, texts []string) {
+	id := goid()
+	n.mu.Lock()
+	n.sending[id] = true
+	n.mu.Unlock()
+
+	defer func() {
+		n.mu.Lock()
+		delete(n.sending, id)
+		n.mu.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), n.opts.Timeout)
+	defer cancel()
+	send.Text(ctx, n.cli, n.chat, format(n.opts.Prefix, sev, texts)) // failures can't be reported
+}
+
+// goid returns the ID of the current goroutine, from the header of its stack trace
+// ("goroutine 42 [running]:"). Go has no other way to tell whether a call is re-entrant.
+func goid() int64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// format renders notifications. Repeated notifications are listed once, with a count.
+func format(prefix string, sev Severity, texts []string) string {
+	head := "[" + sev.String() + "]"
+	if prefix != "" {
+		head += " " + prefix + ":"
+	}
+	if len(texts) == 1 {
+		return head + " " + texts[0]
+	}
+
+	var order []string
+	counts := map[string]int{}
+	for _, t := range texts {
+		if counts[t] == 0 {
+			order = append(order, t)
+		}
+		counts[t]++
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %d notifications", head, len(texts))
+	for i, t := range order {
+		if i == maxLines {
+			fmt.Fprintf(&sb, "\n… and %d more", len(order)-maxLines)
+			break
+		}
+		sb.WriteString("\n- " + t)
+		if counts[t] > 1 {
+			fmt.Fprintf(&sb, " (×%d)", counts[t])
+		}
+	}
+	return sb.String()
+}
+
+// DispatchHook returns a hook for `handlers.AddDispatchHook` that notifies Warning when a handler
+// fails, and Critical when a handler panics.
+func (n *AdminNotifier) DispatchHook() handlers.DispatchHook {
+	return func(t handlers.EventType, d time.Duration, err *handlers.DispatchError) {
+		switch {
+		case err == nil:
+		case err.Type == handlers.HandlerFailed:
+			n.Notify(Warning, "handling %v failed: %v", t, err.Err)
+		case err.Type == handlers.HandlerPanicked:
+			var pe *handlers.PanicError
+			if errors.As(err, &pe) {
+				n.Notify(Critical, "handling %v panicked: %v", t, pe.Value) // without the stack
+			} else {
+				n.Notify(Critical, "handling %v panicked: %v", t, err.Err)
+			}
+		}
+	}
+}
+
+// LogHook returns a hook for `logger.AddHook` that notifies Warning for logged errors and Info
+// for logged warnings.
+func (n *AdminNotifier) LogHook() logger.Hook {
+	return func(level, module, msg string) {
+		switch level {
+		case "ERROR":
+			n.Notify(Warning, "%s: %s", module, msg)
+		case "WARN":
+			n.Notify(Info, "%s: %s", module, msg)
+		}
+	}
+}
+
+// Register registers the notifier for the events that it reports as Critical: TemporaryBan,
+// LoggedOut and StreamReplaced.
+func (n *AdminNotifier) Register() {
+	handlers.Register(handlers.TemporaryBan, n)
+	handlers.Register(handlers.LoggedOut, n)
+	handlers.Register(handlers.StreamReplaced, n)
+}
+
+// Handle implements handlers.handler for TemporaryBan, LoggedOut and StreamReplaced events.
+func (n *AdminNotifier) Handle(ev interface{}) error {
+	switch v := ev.(type) {
+	case *events.TemporaryBan:
+		n.Notify(Critical, "temporarily banned (code %d), expires in %v", v.Code, v.Expire)
+	case *events.LoggedOut:
+		n.Notify(Critical, "logged out (reason %d)", v.Reason)
+	case *events.StreamReplaced:
+		n.Notify(Critical, "the connection was taken over by another client")
+	default:
+		return fmt.Errorf("notify.AdminNotifier.Handle: unexpected event %T", ev)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/waifacetest"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+var admin = types.NewJID("999", types.DefaultUserServer)
+
+// clock is a fake clock with manually fired timers.
+type clock struct {
+	t      time.Time
+	timers []func()
+}
+
+func fakeClock(t *testing.T) *clock {
+	c := &clock{t: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	oldNow, oldAfter := now, afterFunc
+	now = func() time.Time { return c.t }
+	afterFunc = func(d time.Duration, f func()) { c.timers = append(c.timers, f) }
+	t.Cleanup(func() { now, afterFunc = oldNow, oldAfter })
+	return c
+}
+
+// fire advances the clock and runs the scheduled timers.
+func (c *clock) fire(d time.Duration) {
+	c.t = c.t.Add(d)
+	timers := c.timers
+	c.timers = nil
+	for _, f := range timers {
+		f()
+	}
+}
+
+func texts(f *waifacetest.Fake) []string {
+	var out []string
+	for _, s := range f.Sent() {
+		out = append(out, s.Message.GetConversation())
+	}
+	return out
+}
+
+func TestBatching(t *testing.T) {
+	c := fakeClock(t)
+	f := waifacetest.New()
+	n := NewAdminNotifier(f, admin, Opts{Prefix: "bot", MinSeverity: Warning})
+
+	n.Notify(Info, "ignored")
+	n.Notify(Warning, "disk %s", "full")
+	n.Notify(Warning, "handler failed")
+	n.Notify(Warning, "handler failed")
+	n.Notify(Critical, "banned") // other severity, not rate limited by the warnings
+	if got, want := texts(f), []string{"[WARNING] bot: disk full", "[CRITICAL] bot: banned"}; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+	if len(c.timers) != 1 {
+		t.Fatalf("%v flushes scheduled, want 1", len(c.timers))
+	}
+
+	c.fire(time.Minute)
+	got := texts(f)
+	if len(got) != 3 || got[2] != "[WARNING] bot: 2 notifications\n- handler failed (×2)" {
+		t.Errorf("batch = %q, want the collapsed handler failures", got[len(got)-1])
+	}
+	for _, s := range f.Sent() {
+		if s.To != admin {
+			t.Errorf("sent to %v, want %v", s.To, admin)
+		}
+	}
+
+	// After the interval, a notification is sent right away again.
+	c.t = c.t.Add(time.Minute)
+	n.Notify(Warning, "again")
+	if got := texts(f); len(got) != 4 || got[3] != "[WARNING] bot: again" {
+		t.Errorf("sent %q, want the last notification right away", got)
+	}
+}
+
+func TestFormatTruncates(t *testing.T) {
+	var in []string
+	for i := 0; i < maxLines+3; i++ {
+		in = append(in, strings.Repeat("x", i+1))
+	}
+	got := format("", Info, in)
+	if !strings.HasPrefix(got, "[INFO] 13 notifications\n") || !strings.HasSuffix(got, "\n… and 3 more") {
+		t.Errorf("format(_) = %q, want 13 notifications of which 3 left out", got)
+	}
+}
+
+func TestRecursionGuard(t *testing.T) {
+	c := fakeClock(t)
+	f := waifacetest.New()
+	n := NewAdminNotifier(f, admin, Opts{})
+	attempts := 0
+	var last string
+	f.SendMessageFunc = func(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+		attempts++
+		last = message.GetConversation()
+		if attempts == 1 {
+			// A failing send that is logged, through a log hook, leads to a new notification
+			// in the sending goroutine.
+			n.LogHook()("ERROR", "Send", "offline")
+
+			// Another goroutine notifies meanwhile.
+			done := make(chan struct{})
+			go func() {
+				n.Notify(Critical, "other")
+				close(done)
+			}()
+			<-done
+		}
+		return whatsmeow.SendResponse{}, errors.New("offline")
+	}
+
+	n.Notify(Critical, "banned")
+	if attempts != 1 {
+		t.Errorf("%v send attempts, want 1", attempts)
+	}
+	if n.Dropped() != 1 {
+		t.Errorf("Dropped() = %v, want 1", n.Dropped())
+	}
+
+	// The notification of the other goroutine was batched, not dropped.
+	c.fire(time.Minute)
+	if attempts != 2 || last != "[CRITICAL] other" {
+		t.Errorf("%v send attempts, last %q, want 2 with the notification of the other goroutine", attempts, last)
+	}
+}
+
+func TestGoid(t *testing.T) {
+	id := goid()
+	if id <= 0 {
+		t.Fatalf("goid() = %v, want a positive ID", id)
+	}
+	if goid() != id {
+		t.Errorf("goid() changed within a goroutine")
+	}
+	other := make(chan int64)
+	go func() { other <- goid() }()
+	if got := <-other; got == id || got <= 0 {
+		t.Errorf("goid() in another goroutine = %v, want a positive ID other than %v", got, id)
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	fakeClock(t)
+	f := waifacetest.New()
+	n := NewAdminNotifier(f, admin, Opts{Interval: -1}) // no rate limit
+
+	hook := n.DispatchHook()
+	hook(handlers.Message, time.Millisecond, nil)
+	hook(handlers.Message, time.Millisecond, &handlers.DispatchError{Type: handlers.NoHandlerFound, Err: errors.New("none")})
+	hook(handlers.Message, time.Millisecond, &handlers.DispatchError{Type: handlers.HandlerFailed, Err: errors.New("boom")})
+	hook(handlers.Receipt, time.Millisecond, &handlers.DispatchError{Type: handlers.HandlerPanicked, Err: &handlers.PanicError{Value: "oops", Stack: []byte("stack")}})
+	n.LogHook()("ERROR", "Client", "socket closed")
+	n.LogHook()("DEBUG", "Client", "ignored")
+	if err := n.Handle(&events.TemporaryBan{Expire: time.Hour}); err != nil {
+		t.Errorf("Handle(*events.TemporaryBan) = %v, need nil error", err)
+	}
+	if err := n.Handle(&events.Connected{}); err == nil {
+		t.Errorf("Handle(*events.Connected) = nil, need error")
+	}
+
+	want := []string{
+		"[WARNING] handling Message failed: boom",
+		"[CRITICAL] handling Receipt panicked: oops",
+		"[WARNING] Client: socket closed",
+		"[CRITICAL] temporarily banned (code 0), expires in 1h0m0s",
+	}
+	if got := texts(f); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
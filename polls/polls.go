@@ -0,0 +1,232 @@
+// Package polls follows the votes on polls. Votes are end-to-end encrypted with a secret of the
+// poll and name the selected options only by their SHA-256 hash, so counting them needs the
+// poll itself: a Tracker remembers the polls that were sent and received, and keeps a tally of
+// their votes.
+package polls
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/msgkind"
+	"github.com/KarelKubat/whatsmeow/send"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// DecryptFunc decrypts the vote in a poll update message, normally the DecryptPollVote method
+// of a whatsmeow.Client.
+type DecryptFunc func(ev *events.Message) (*waE2E.PollVoteMessage, error)
+
+// Vote is a vote that was cast, changed or taken back.
+type Vote struct {
+	PollID    types.MessageID
+	Chat      types.JID
+	Voter     types.JID // without the device
+	Options   []string  // as now selected, empty when the vote was taken back
+	Previous  []string  // as selected before, empty for a first vote
+	Timestamp time.Time // of the vote
+}
+
+// Result is the tally of one option of a poll.
+type Result struct {
+	Option string
+	Voters []types.JID // sorted
+}
+
+// Opts configures a Tracker.
+type Opts struct {
+	OnVote func(Vote) // invoked on every vote of a tracked poll, optional
+}
+
+// ballot is the current vote of a voter.
+type ballot struct {
+	options []string
+	at      time.Time
+}
+
+// poll is a tracked poll.
+type poll struct {
+	chat    types.JID
+	options []string          // in the order of the poll
+	hashes  map[string]string // option hash to option
+	ballots map[types.JID]ballot
+}
+
+// Tracker keeps the tally of polls in memory. Every vote update of a voter carries all the
+// options that they select now, so a change replaces their previous vote, and an update that
+// selects nothing takes it back. Updates that arrive out of order, i.e. that are older than the
+// vote they'd replace, are ignored, as are votes for polls that aren't tracked: without the
+// poll, the options can't be told from their hashes. The zero value isn't usable, use
+// NewTracker.
+type Tracker struct {
+	decrypt DecryptFunc
+	opts    Opts
+
+	mu    sync.Mutex
+	polls map[types.MessageID]*poll
+}
+
+// NewTracker returns a poll tracker that decrypts votes using `decrypt`.
+//
+//	pt := polls.NewTracker(client.DecryptPollVote, polls.Opts{OnVote: func(v polls.Vote) {
+//		log.Printf("%v votes %q in poll %v", v.Voter, v.Options, v.PollID)
+//	}})
+//	pt.Register()
+//	pt.AutoTrack()
+func NewTracker(decrypt DecryptFunc, opts Opts) *Tracker {
+	return &Tracker{
+		decrypt: decrypt,
+		opts:    opts,
+		polls:   map[types.MessageID]*poll{},
+	}
+}
+
+// Register registers the tracker for Message events, for the polls that are received and the
+// votes on tracked polls.
+func (t *Tracker) Register() {
+	handlers.Register(handlers.Message, t)
+}
+
+// AutoTrack tracks all polls that are sent by package send.
+func (t *Tracker) AutoTrack() {
+	send.AddAfterHook(func(to types.JID, msg *waE2E.Message, resp send.Response) {
+		if pm := pollCreation(msg); pm != nil {
+			t.Track(resp.ID, to, pm)
+		}
+	})
+}
+
+// Track starts tracking a poll, with no votes yet. Tracking the same poll twice is a no-op.
+func (t *Tracker) Track(id types.MessageID, chat types.JID, pm *waE2E.PollCreationMessage) {
+	p := &poll{
+		chat:    chat.ToNonAD(),
+		hashes:  map[string]string{},
+		ballots: map[types.JID]ballot{},
+	}
+	for _, o := range pm.GetOptions() {
+		p.options = append(p.options, o.GetOptionName())
+		p.hashes[hash(o.GetOptionName())] = o.GetOptionName()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.polls[id]; !ok {
+		t.polls[id] = p
+	}
+}
+
+// Forget stops tracking a poll.
+func (t *Tracker) Forget(id types.MessageID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.polls, id)
+}
+
+// Results returns the tally of a tracked poll, with a Result for every option in the order of
+// the poll, or false when the poll isn't tracked.
+func (t *Tracker) Results(id types.MessageID) ([]Result, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.polls[id]
+	if !ok {
+		return nil, false
+	}
+	voters := map[string][]types.JID{}
+	for voter, b := range p.ballots {
+		for _, o := range b.options {
+			voters[o] = append(voters[o], voter)
+		}
+	}
+	results := make([]Result, len(p.options))
+	for i, o := range p.options {
+		sort.Slice(voters[o], func(i, j int) bool { return voters[o][i].String() < voters[o][j].String() })
+		results[i] = Result{Option: o, Voters: voters[o]}
+	}
+	return results, true
+}
+
+// Handle implements handlers.handler for Message events. Polls are tracked, and votes update
+// the tally. Other messages are ignored.
+func (t *Tracker) Handle(ev interface{}) error {
+	m, ok := ev.(*events.Message)
+	if !ok {
+		return fmt.Errorf("polls.Tracker.Handle: unexpected event %T", ev)
+	}
+	if pm := pollCreation(m.Message); pm != nil {
+		t.Track(m.Info.ID, m.Info.Chat, pm)
+		return nil
+	}
+	update := msgkind.Unwrap(m.Message).GetPollUpdateMessage()
+	if update == nil {
+		return nil
+	}
+	id := update.GetPollCreationMessageKey().GetID()
+	t.mu.Lock()
+	_, ok = t.polls[id]
+	t.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	pv, err := t.decrypt(m)
+	if err != nil {
+		return fmt.Errorf("polls.Tracker.Handle: vote %v for poll %v: %w", m.Info.ID, id, err)
+	}
+
+	at := m.Info.Timestamp
+	if ms := update.GetSenderTimestampMS(); ms > 0 {
+		at = time.UnixMilli(ms)
+	}
+	voter := m.Info.Sender.ToNonAD()
+	t.mu.Lock()
+	p, ok := t.polls[id] // unless forgotten meanwhile
+	if !ok {
+		t.mu.Unlock()
+		return nil
+	}
+	prev := p.ballots[voter]
+	if at.Before(prev.at) {
+		t.mu.Unlock()
+		return nil
+	}
+	var options []string
+	for _, h := range pv.GetSelectedOptions() {
+		if o, ok := p.hashes[string(h)]; ok {
+			options = append(options, o)
+		}
+	}
+	// A vote that was taken back keeps its time, so that an older vote doesn't come back.
+	p.ballots[voter] = ballot{options: options, at: at}
+	v := Vote{PollID: id, Chat: p.chat, Voter: voter, Options: options, Previous: prev.options, Timestamp: at}
+	t.mu.Unlock()
+
+	if t.opts.OnVote != nil {
+		t.opts.OnVote(v)
+	}
+	return nil
+}
+
+// pollCreation returns the poll in a message, or nil when it's not a poll.
+func pollCreation(msg *waE2E.Message) *waE2E.PollCreationMessage {
+	msg = msgkind.Unwrap(msg)
+	switch {
+	case msg.GetPollCreationMessage() != nil:
+		return msg.GetPollCreationMessage()
+	case msg.GetPollCreationMessageV2() != nil:
+		return msg.GetPollCreationMessageV2()
+	case msg.GetPollCreationMessageV3() != nil:
+		return msg.GetPollCreationMessageV3()
+	}
+	return nil
+}
+
+// hash returns the hash by which a vote refers to an option, as whatsmeow.HashPollOptions does.
+func hash(option string) string {
+	h := sha256.Sum256([]byte(option))
+	return string(h[:])
+}
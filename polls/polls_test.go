@@ -0,0 +1,209 @@
+package polls
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	group = types.NewJID("120363000000000000", types.GroupServer)
+	alice = types.NewJID("31611111111", types.DefaultUserServer)
+	bob   = types.NewJID("31622222222", types.DefaultUserServer)
+	start = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// fakeDecrypt "decrypts" a vote whose payload lists the selected options, e.g. "pizza,sushi",
+// and fails for "garbage".
+func fakeDecrypt(ev *events.Message) (*waE2E.PollVoteMessage, error) {
+	payload := string(ev.Message.GetPollUpdateMessage().GetVote().GetEncPayload())
+	if payload == "garbage" {
+		return nil, errors.New("failed to decrypt poll vote")
+	}
+	pv := &waE2E.PollVoteMessage{}
+	for _, o := range strings.Split(payload, ",") {
+		if o != "" {
+			h := sha256.Sum256([]byte(o))
+			pv.SelectedOptions = append(pv.SelectedOptions, h[:])
+		}
+	}
+	return pv, nil
+}
+
+func pollEvent(id types.MessageID, options ...string) *events.Message {
+	pm := &waE2E.PollCreationMessage{Name: proto.String("Lunch?")}
+	for _, o := range options {
+		pm.Options = append(pm.Options, &waE2E.PollCreationMessage_Option{OptionName: proto.String(o)})
+	}
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: group, Sender: alice, IsGroup: true},
+			ID:            id,
+		},
+		Message: &waE2E.Message{PollCreationMessageV3: pm},
+	}
+}
+
+// voteEvent returns a vote of `voter` for poll P1, cast `sec` seconds after the start.
+func voteEvent(voter types.JID, sec int, payload string) *events.Message {
+	return voteFor("P1", voter, sec, payload)
+}
+
+// voteFor returns a vote of `voter` for a poll, cast `sec` seconds after the start.
+func voteFor(poll types.MessageID, voter types.JID, sec int, payload string) *events.Message {
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: group, Sender: types.NewADJID(voter.User, 0, 2), IsGroup: true},
+			ID:            fmt.Sprintf("V%d", sec),
+			Timestamp:     start.Add(time.Duration(sec) * time.Second),
+		},
+		Message: &waE2E.Message{PollUpdateMessage: &waE2E.PollUpdateMessage{
+			PollCreationMessageKey: &waCommon.MessageKey{ID: proto.String(poll)},
+			Vote:                   &waE2E.PollEncValue{EncPayload: []byte(payload)},
+		}},
+	}
+}
+
+// tally returns the results of a poll as "option:voter,voter option:..." with only the users of
+// the voters.
+func tally(results []Result) string {
+	var parts []string
+	for _, r := range results {
+		var voters []string
+		for _, v := range r.Voters {
+			voters = append(voters, v.User)
+		}
+		parts = append(parts, r.Option+":"+strings.Join(voters, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestTracker(t *testing.T) {
+	var votes []Vote
+	tr := NewTracker(fakeDecrypt, Opts{OnVote: func(v Vote) { votes = append(votes, v) }})
+	if err := tr.Handle(pollEvent("P1", "pizza", "sushi", "salad")); err != nil {
+		t.Fatalf("Handle(poll) = %v, need nil error", err)
+	}
+	if got, ok := tr.Results("P1"); !ok || tally(got) != "pizza: sushi: salad:" {
+		t.Errorf("Results(P1) = %q, %v before any vote, want no votes", tally(got), ok)
+	}
+
+	for _, test := range []struct {
+		description string
+		vote        *events.Message
+		wantVote    *Vote // nil when the vote is ignored
+		wantTally   string
+	}{
+		{
+			description: "first vote",
+			vote:        voteEvent(alice, 1, "pizza"),
+			wantVote:    &Vote{Options: []string{"pizza"}},
+			wantTally:   "pizza:31611111111 sushi: salad:",
+		},
+		{
+			description: "multiple options",
+			vote:        voteEvent(bob, 2, "pizza,sushi"),
+			wantVote:    &Vote{Options: []string{"pizza", "sushi"}},
+			wantTally:   "pizza:31611111111,31622222222 sushi:31622222222 salad:",
+		},
+		{
+			description: "changed vote",
+			vote:        voteEvent(alice, 3, "sushi"),
+			wantVote:    &Vote{Options: []string{"sushi"}, Previous: []string{"pizza"}},
+			wantTally:   "pizza:31622222222 sushi:31611111111,31622222222 salad:",
+		},
+		{
+			description: "older vote, arriving late",
+			vote:        voteEvent(bob, 1, "salad"),
+			wantTally:   "pizza:31622222222 sushi:31611111111,31622222222 salad:",
+		},
+		{
+			description: "vote taken back",
+			vote:        voteEvent(bob, 4, ""),
+			wantVote:    &Vote{Previous: []string{"pizza", "sushi"}},
+			wantTally:   "pizza: sushi:31611111111 salad:",
+		},
+		{
+			description: "older vote doesn't undo taking it back",
+			vote:        voteEvent(bob, 3, "pizza"),
+			wantTally:   "pizza: sushi:31611111111 salad:",
+		},
+		{
+			description: "vote again",
+			vote:        voteEvent(bob, 5, "salad"),
+			wantVote:    &Vote{Options: []string{"salad"}},
+			wantTally:   "pizza: sushi:31611111111 salad:31622222222",
+		},
+		{
+			description: "unknown option",
+			vote:        voteEvent(alice, 6, "sushi,fries"),
+			wantVote:    &Vote{Options: []string{"sushi"}, Previous: []string{"sushi"}},
+			wantTally:   "pizza: sushi:31611111111 salad:31622222222",
+		},
+	} {
+		votes = nil
+		if err := tr.Handle(test.vote); err != nil {
+			t.Errorf("%v: Handle(_) = %v, need nil error", test.description, err)
+		}
+		if test.wantVote != nil {
+			want := *test.wantVote
+			want.PollID, want.Chat, want.Voter, want.Timestamp = "P1", group, test.vote.Info.Sender.ToNonAD(), test.vote.Info.Timestamp
+			if len(votes) != 1 || !reflect.DeepEqual(votes[0], want) {
+				t.Errorf("%v: OnVote got %+v, want %+v", test.description, votes, want)
+			}
+		} else if len(votes) != 0 {
+			t.Errorf("%v: OnVote got %+v, want nothing", test.description, votes)
+		}
+		if got, _ := tr.Results("P1"); tally(got) != test.wantTally {
+			t.Errorf("%v: Results(P1) = %q, want %q", test.description, tally(got), test.wantTally)
+		}
+	}
+
+	// Polls are tracked once; tracking again doesn't reset the tally.
+	tr.Handle(pollEvent("P1", "pizza", "sushi", "salad"))
+	if got, _ := tr.Results("P1"); tally(got) != "pizza: sushi:31611111111 salad:31622222222" {
+		t.Errorf("Results(P1) = %q after tracking again, want the tally unchanged", tally(got))
+	}
+	tr.Forget("P1")
+	if _, ok := tr.Results("P1"); ok {
+		t.Errorf("Results(P1) = _, true after Forget, want false")
+	}
+}
+
+func TestTrackerUntracked(t *testing.T) {
+	var decrypts, votes int
+	tr := NewTracker(func(ev *events.Message) (*waE2E.PollVoteMessage, error) {
+		decrypts++
+		return fakeDecrypt(ev)
+	}, Opts{OnVote: func(Vote) { votes++ }})
+	tr.Handle(pollEvent("P1", "pizza", "sushi"))
+
+	if err := tr.Handle(voteFor("P2", alice, 1, "pizza")); err != nil {
+		t.Errorf("Handle(vote for an unknown poll) = %v, need nil error", err)
+	}
+	if err := tr.Handle(voteEvent(alice, 1, "garbage")); err == nil {
+		t.Errorf("Handle(undecryptable vote) = nil, need error")
+	}
+	if err := tr.Handle(&events.Message{Message: &waE2E.Message{Conversation: proto.String("hi")}}); err != nil {
+		t.Errorf("Handle(text) = %v, need nil error", err)
+	}
+	if err := tr.Handle(&events.Receipt{}); err == nil {
+		t.Errorf("Handle(*events.Receipt) = nil, need error")
+	}
+	if decrypts != 1 || votes != 0 {
+		t.Errorf("%d decrypts and %d votes, want 1 and 0", decrypts, votes)
+	}
+	if _, ok := tr.Results("P2"); ok {
+		t.Errorf("Results(P2) = _, true for an unknown poll, want false")
+	}
+}
@@ -0,0 +1,221 @@
+// Package presence sends typing indicators without flooding chats with them.
+package presence
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/waiface"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// clock abstracts time for tests.
+type clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) stopper
+}
+
+type stopper interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) stopper { return time.AfterFunc(d, f) }
+
+// Opts configures a Governor.
+type Opts struct {
+	Interval       time.Duration // at most one "composing" per chat per interval, 10s when zero
+	SuppressWithin time.Duration // "composing" waits this long, and is dropped when the reply comes sooner
+}
+
+// chatState is what a Governor knows about one chat.
+type chatState struct {
+	pending       stopper   // scheduled "composing"
+	composing     bool      // "composing" was sent and not yet "paused"
+	lastComposing time.Time // when "composing" was last sent
+	cleanup       stopper   // scheduled removal of the state, see forget
+}
+
+// Governor sends typing indicators, but at most one "composing" per chat per interval. A
+// "composing" is only sent when the reply doesn't follow within SuppressWithin, and "paused" is
+// only sent after a "composing". Presence is sent without holding the lock, so that a slow
+// connection doesn't hold up other chats. On disconnect, the state of all chats is dropped.
+type Governor struct {
+	cli   waiface.PresenceAPI
+	opts  Opts
+	clock clock
+
+	mu    sync.Mutex
+	chats map[types.JID]*chatState
+}
+
+// NewGovernor returns a governor that sends presence using `cli`, typically the
+// `*whatsmeow.Client`.
+func NewGovernor(cli waiface.PresenceAPI, opts Opts) *Governor {
+	if opts.Interval == 0 {
+		opts.Interval = 10 * time.Second
+	}
+	return &Governor{
+		cli:   cli,
+		opts:  opts,
+		clock: realClock{},
+		chats: map[types.JID]*chatState{},
+	}
+}
+
+// Register registers the governor for Disconnected events.
+func (g *Governor) Register() {
+	handlers.Register(handlers.Disconnected, g)
+}
+
+// Handle implements handlers.handler for Disconnected events: the state of all chats is
+// dropped, without sending "paused", which can't be sent anyway. Pending "composing" are
+// cancelled.
+func (g *Governor) Handle(ev interface{}) error {
+	if _, ok := ev.(*events.Disconnected); !ok {
+		return fmt.Errorf("presence.Governor.Handle: unexpected event %T", ev)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, st := range g.chats {
+		if st.pending != nil {
+			st.pending.Stop()
+			st.pending = nil
+		}
+		if st.cleanup != nil {
+			st.cleanup.Stop()
+			st.cleanup = nil
+		}
+	}
+	g.chats = map[types.JID]*chatState{}
+	return nil
+}
+
+// Composing signals that a reply for a chat is being prepared.
+func (g *Governor) Composing(chat types.JID) error {
+	g.mu.Lock()
+	st := g.state(chat)
+	if st.pending != nil || st.composing && g.clock.Now().Sub(st.lastComposing) < g.opts.Interval {
+		g.mu.Unlock()
+		return nil
+	}
+	if g.opts.SuppressWithin <= 0 {
+		send := g.compose(st)
+		g.mu.Unlock()
+		if !send {
+			return nil
+		}
+		return g.send(chat, types.ChatPresenceComposing)
+	}
+	st.pending = g.clock.AfterFunc(g.opts.SuppressWithin, func() {
+		g.mu.Lock()
+		if st.pending == nil {
+			g.mu.Unlock()
+			return // cancelled meanwhile
+		}
+		st.pending = nil
+		send := g.compose(st)
+		g.mu.Unlock()
+		if send {
+			g.send(chat, types.ChatPresenceComposing) // there's no caller to report to
+		}
+	})
+	g.mu.Unlock()
+	return nil
+}
+
+// Paused signals that the reply for a chat was sent or abandoned.
+func (g *Governor) Paused(chat types.JID) error {
+	g.mu.Lock()
+	send := g.pause(chat)
+	g.mu.Unlock()
+	if !send {
+		return nil
+	}
+	return g.send(chat, types.ChatPresencePaused)
+}
+
+// Typing shows "composing" in a chat while `reply` runs, and "paused" afterwards.
+func (g *Governor) Typing(chat types.JID, reply func() error) error {
+	if err := g.Composing(chat); err != nil {
+		return fmt.Errorf("presence.Governor.Typing: %w", err)
+	}
+	err := reply()
+	if perr := g.Paused(chat); perr != nil && err == nil {
+		err = fmt.Errorf("presence.Governor.Typing: %w", perr)
+	}
+	return err
+}
+
+// state returns the state of a chat. The caller holds the lock.
+func (g *Governor) state(chat types.JID) *chatState {
+	st, ok := g.chats[chat]
+	if !ok {
+		st = &chatState{}
+		g.chats[chat] = st
+	}
+	return st
+}
+
+// compose marks a chat as composing, and returns whether "composing" must be sent: not when
+// it was sent less than an interval ago. The caller holds the lock.
+func (g *Governor) compose(st *chatState) bool {
+	now := g.clock.Now()
+	if !st.lastComposing.IsZero() && now.Sub(st.lastComposing) < g.opts.Interval {
+		return false
+	}
+	st.lastComposing = now
+	st.composing = true
+	return true
+}
+
+// pause cancels a pending "composing", and returns whether "paused" must be sent: only after a
+// "composing". The caller holds the lock.
+func (g *Governor) pause(chat types.JID) bool {
+	st, ok := g.chats[chat]
+	if !ok {
+		return false
+	}
+	if st.pending != nil {
+		st.pending.Stop()
+		st.pending = nil
+	}
+	send := st.composing
+	st.composing = false
+	g.forget(chat, st)
+	return send
+}
+
+// forget drops the state of a paused chat. Until an interval has passed since the last
+// "composing", the state is still needed for the rate limit, so then the removal is scheduled.
+// The caller holds the lock.
+func (g *Governor) forget(chat types.JID, st *chatState) {
+	wait := st.lastComposing.Add(g.opts.Interval).Sub(g.clock.Now())
+	if st.lastComposing.IsZero() || wait <= 0 {
+		delete(g.chats, chat)
+		return
+	}
+	if st.cleanup != nil {
+		return
+	}
+	st.cleanup = g.clock.AfterFunc(wait, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		st.cleanup = nil
+		if g.chats[chat] == st && st.pending == nil && !st.composing {
+			delete(g.chats, chat)
+		}
+	})
+}
+
+// send sends a presence for a chat. The caller doesn't hold the lock.
+func (g *Governor) send(chat types.JID, state types.ChatPresence) error {
+	return g.cli.SendChatPresence(chat, state, types.ChatPresenceMediaText)
+}
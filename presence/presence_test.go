@@ -0,0 +1,235 @@
+package presence
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// fakeClock runs timers when advanced.
+type fakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	was := !t.stopped
+	t.stopped = true
+	return was
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) stopper {
+	t := &fakeTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	end := c.now.Add(d)
+	for {
+		sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			break
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.at
+		if !t.stopped {
+			t.stopped = true
+			t.f()
+		}
+	}
+	c.now = end
+}
+
+// fakeSender records presence as "<seconds since start>:<chat>:<state>".
+type fakeSender struct {
+	clock *fakeClock
+	start time.Time
+	sent  []string
+}
+
+func (f *fakeSender) SendChatPresence(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
+	f.sent = append(f.sent, fmt.Sprintf("%v:%v:%v", f.clock.now.Sub(f.start).Seconds(), jid.User, state))
+	return nil
+}
+
+func newTestGovernor(opts Opts) (*Governor, *fakeClock, *fakeSender) {
+	c := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	s := &fakeSender{clock: c, start: c.now}
+	g := NewGovernor(s, opts)
+	g.clock = c
+	return g, c, s
+}
+
+func TestGovernor(t *testing.T) {
+	a := types.NewJID("a", types.GroupServer)
+	b := types.NewJID("b", types.GroupServer)
+
+	type step struct {
+		after time.Duration
+		chat  types.JID
+		typ   string // "composing" or "paused"
+	}
+	for _, test := range []struct {
+		description string
+		opts        Opts
+		steps       []step
+		want        string
+	}{
+		{
+			description: "one reply",
+			opts:        Opts{Interval: 10 * time.Second},
+			steps:       []step{{0, a, "composing"}, {2 * time.Second, a, "paused"}},
+			want:        "[0:a:composing 2:a:paused]",
+		},
+		{
+			description: "burst of replies gets one pair per interval",
+			opts:        Opts{Interval: 10 * time.Second},
+			steps: []step{
+				{0, a, "composing"}, {time.Second, a, "paused"},
+				{time.Second, a, "composing"}, {time.Second, a, "paused"},
+				{time.Second, a, "composing"}, {time.Second, a, "paused"},
+				{5 * time.Second, a, "composing"}, {time.Second, a, "paused"},
+			},
+			want: "[0:a:composing 1:a:paused 10:a:composing 11:a:paused]",
+		},
+		{
+			description: "repeated composing while typing",
+			opts:        Opts{Interval: 10 * time.Second},
+			steps: []step{
+				{0, a, "composing"}, {3 * time.Second, a, "composing"}, {3 * time.Second, a, "composing"},
+				{5 * time.Second, a, "composing"}, {time.Second, a, "paused"},
+			},
+			want: "[0:a:composing 11:a:composing 12:a:paused]",
+		},
+		{
+			description: "chats are independent",
+			opts:        Opts{Interval: 10 * time.Second},
+			steps:       []step{{0, a, "composing"}, {0, b, "composing"}, {time.Second, a, "paused"}, {0, b, "paused"}},
+			want:        "[0:a:composing 0:b:composing 1:a:paused 1:b:paused]",
+		},
+		{
+			description: "fast replies are not announced",
+			opts:        Opts{Interval: 10 * time.Second, SuppressWithin: time.Second},
+			steps: []step{
+				{0, a, "composing"}, {500 * time.Millisecond, a, "paused"},
+				{time.Second, a, "composing"}, {3 * time.Second, a, "paused"},
+			},
+			want: "[2.5:a:composing 4.5:a:paused]",
+		},
+	} {
+		g, c, s := newTestGovernor(test.opts)
+		for _, st := range test.steps {
+			c.advance(st.after)
+			if st.typ == "composing" {
+				g.Composing(st.chat)
+			} else {
+				g.Paused(st.chat)
+			}
+		}
+		c.advance(time.Minute)
+		if got := fmt.Sprint(s.sent); got != test.want {
+			t.Errorf("%v: sent %v, want %v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestGovernorDisconnect(t *testing.T) {
+	a := types.NewJID("a", types.GroupServer)
+	b := types.NewJID("b", types.GroupServer)
+	g, c, s := newTestGovernor(Opts{SuppressWithin: time.Second})
+	g.Composing(a)
+	c.advance(2 * time.Second)
+	g.Composing(b) // still pending at disconnect
+	if err := g.Handle(&events.Disconnected{}); err != nil {
+		t.Fatalf("Handle(Disconnected) = %v, need nil error", err)
+	}
+	c.advance(time.Minute)
+	if want := "[1:a:composing]"; fmt.Sprint(s.sent) != want {
+		t.Errorf("sent %v, want %v", s.sent, want)
+	}
+	if len(g.chats) != 0 {
+		t.Errorf("%v chats known after disconnect, want 0", len(g.chats))
+	}
+
+	// After reconnecting, "composing" isn't rate limited by what was sent before.
+	g.Composing(a)
+	c.advance(2 * time.Second)
+	if want := "[1:a:composing 63:a:composing]"; fmt.Sprint(s.sent) != want {
+		t.Errorf("sent %v, want %v", s.sent, want)
+	}
+}
+
+func TestGovernorForgetsPausedChats(t *testing.T) {
+	a := types.NewJID("a", types.GroupServer)
+	b := types.NewJID("b", types.GroupServer)
+	g, c, _ := newTestGovernor(Opts{Interval: 10 * time.Second})
+	g.Composing(a)
+	g.Paused(a)
+	g.Paused(b) // never composed
+	if _, ok := g.chats[b]; ok {
+		t.Errorf("state of %v kept after a pause without composing", b)
+	}
+	if _, ok := g.chats[a]; !ok {
+		t.Fatalf("state of %v dropped within the interval, it's needed for the rate limit", a)
+	}
+	c.advance(10 * time.Second)
+	if len(g.chats) != 0 {
+		t.Errorf("%v chats known an interval after pausing, want 0", len(g.chats))
+	}
+}
+
+// lockCheckingSender fails when presence is sent while the governor holds its lock.
+type lockCheckingSender struct {
+	t *testing.T
+	g *Governor
+}
+
+func (s *lockCheckingSender) SendChatPresence(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
+	if !s.g.mu.TryLock() {
+		s.t.Errorf("%v sent while holding the lock", state)
+		return nil
+	}
+	s.g.mu.Unlock()
+	return nil
+}
+
+func TestGovernorSendsWithoutLock(t *testing.T) {
+	a := types.NewJID("a", types.GroupServer)
+	c := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	s := &lockCheckingSender{t: t}
+	g := NewGovernor(s, Opts{SuppressWithin: time.Second})
+	g.clock = c
+	s.g = g
+	g.Composing(a)
+	c.advance(2 * time.Second) // sent from the timer
+	g.Paused(a)
+}
+
+func TestTyping(t *testing.T) {
+	a := types.NewJID("a", types.GroupServer)
+	g, c, s := newTestGovernor(Opts{})
+	err := g.Typing(a, func() error {
+		c.advance(3 * time.Second)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Typing(_) = %v, need nil error", err)
+	}
+	if want := "[0:a:composing 3:a:paused]"; fmt.Sprint(s.sent) != want {
+		t.Errorf("sent %v, want %v", s.sent, want)
+	}
+}
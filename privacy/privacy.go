@@ -0,0 +1,134 @@
+// Package privacy manages the list of blocked contacts.
+package privacy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/send"
+	"github.com/KarelKubat/whatsmeow/waiface"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ErrBlocked is returned when sending to a blocked contact is refused, see GuardSends.
+var ErrBlocked = errors.New("contact is blocked")
+
+// Global cache of blocked JIDs, fed by the functions of this package and by Blocklist events.
+var (
+	mu      sync.RWMutex
+	blocked = make(map[types.JID]bool)
+	client  waiface.BlocklistAPI // for refetching, set by Register
+)
+
+// Block blocks a contact.
+func Block(ctx context.Context, cli waiface.BlocklistAPI, jid types.JID) error {
+	return update(ctx, cli, jid, events.BlocklistChangeActionBlock)
+}
+
+// Unblock unblocks a contact.
+func Unblock(ctx context.Context, cli waiface.BlocklistAPI, jid types.JID) error {
+	return update(ctx, cli, jid, events.BlocklistChangeActionUnblock)
+}
+
+func update(ctx context.Context, cli waiface.BlocklistAPI, jid types.JID, action events.BlocklistChangeAction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	bl, err := cli.UpdateBlocklist(jid.ToNonAD(), action)
+	if err != nil {
+		return fmt.Errorf("privacy: %s %v: %w", action, jid, err)
+	}
+	replace(bl.JIDs)
+	return nil
+}
+
+// Blocklist fetches the list of blocked contacts.
+func Blocklist(ctx context.Context, cli waiface.BlocklistAPI) ([]types.JID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bl, err := cli.GetBlocklist()
+	if err != nil {
+		return nil, fmt.Errorf("privacy: fetching blocklist: %w", err)
+	}
+	replace(bl.JIDs)
+	return bl.JIDs, nil
+}
+
+// IsBlocked returns true when a contact is known to be blocked.
+func IsBlocked(jid types.JID) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return blocked[jid.ToNonAD()]
+}
+
+func replace(jids []types.JID) {
+	mu.Lock()
+	defer mu.Unlock()
+	blocked = make(map[types.JID]bool)
+	for _, jid := range jids {
+		blocked[jid.ToNonAD()] = true
+	}
+}
+
+type handler struct{}
+
+// Register binds the cache to Blocklist events. When the server signals that the whole list
+// was modified, the list is refetched using `cli`, which may be nil to skip refetching.
+func Register(cli waiface.BlocklistAPI) {
+	mu.Lock()
+	client = cli
+	mu.Unlock()
+	handlers.Register(handlers.Blocklist, &handler{})
+}
+
+// Handle processes Blocklist events.
+func (h *handler) Handle(ev interface{}) error {
+	bl, ok := ev.(*events.Blocklist)
+	if !ok {
+		return nil
+	}
+	if bl.Action == events.BlocklistActionModify {
+		mu.RLock()
+		cli := client
+		mu.RUnlock()
+		if cli == nil {
+			return nil
+		}
+		_, err := Blocklist(context.Background(), cli)
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, ch := range bl.Changes {
+		switch ch.Action {
+		case events.BlocklistChangeActionBlock:
+			blocked[ch.JID.ToNonAD()] = true
+		case events.BlocklistChangeActionUnblock:
+			delete(blocked, ch.JID.ToNonAD())
+		}
+	}
+	return nil
+}
+
+var guardOnce sync.Once
+
+// GuardSends adds a `send` hook that refuses to send messages to blocked contacts; the error
+// wraps ErrBlocked. Calling it more than once has no further effect.
+func GuardSends() {
+	guardOnce.Do(func() {
+		send.AddHook(func(to types.JID, msg *waE2E.Message) error {
+			if IsBlocked(to) {
+				return fmt.Errorf("privacy: not sending to %v: %w", to, ErrBlocked)
+			}
+			return nil
+		})
+	})
+}
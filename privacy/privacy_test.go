@@ -0,0 +1,112 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/send"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+var (
+	alice = types.NewJID("111", types.DefaultUserServer)
+	bob   = types.NewJID("222", types.DefaultUserServer)
+)
+
+type fakeClient struct {
+	list []types.JID
+}
+
+func (f *fakeClient) GetBlocklist() (*types.Blocklist, error) {
+	return &types.Blocklist{JIDs: f.list}, nil
+}
+
+func (f *fakeClient) UpdateBlocklist(jid types.JID, action events.BlocklistChangeAction) (*types.Blocklist, error) {
+	var list []types.JID
+	for _, j := range f.list {
+		if j != jid {
+			list = append(list, j)
+		}
+	}
+	if action == events.BlocklistChangeActionBlock {
+		list = append(list, jid)
+	}
+	f.list = list
+	return &types.Blocklist{JIDs: f.list}, nil
+}
+
+type fakeSender struct {
+	sent int
+}
+
+func (f *fakeSender) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	f.sent++
+	return whatsmeow.SendResponse{}, nil
+}
+
+// TestBlockUnblock checks that the cache follows Block and Unblock.
+func TestBlockUnblock(t *testing.T) {
+	replace(nil)
+	cli := &fakeClient{}
+	if err := Block(context.Background(), cli, alice); err != nil {
+		t.Fatalf("Block(_) = %v, need nil error", err)
+	}
+	if !IsBlocked(alice) || IsBlocked(bob) {
+		t.Errorf("after Block(alice): IsBlocked(alice)=%v, IsBlocked(bob)=%v", IsBlocked(alice), IsBlocked(bob))
+	}
+	if err := Unblock(context.Background(), cli, alice); err != nil {
+		t.Fatalf("Unblock(_) = %v, need nil error", err)
+	}
+	if IsBlocked(alice) {
+		t.Errorf("after Unblock(alice): alice is still blocked")
+	}
+}
+
+// TestChangeEvents drives the cache through Blocklist events.
+func TestChangeEvents(t *testing.T) {
+	replace(nil)
+	cli := &fakeClient{list: []types.JID{bob}}
+	client = cli
+	h := &handler{}
+
+	h.Handle(&events.Blocklist{Changes: []events.BlocklistChange{
+		{JID: alice, Action: events.BlocklistChangeActionBlock},
+	}})
+	if !IsBlocked(alice) {
+		t.Errorf("alice not blocked after block change")
+	}
+	h.Handle(&events.Blocklist{Changes: []events.BlocklistChange{
+		{JID: alice, Action: events.BlocklistChangeActionUnblock},
+	}})
+	if IsBlocked(alice) {
+		t.Errorf("alice blocked after unblock change")
+	}
+	if err := h.Handle(&events.Blocklist{Action: events.BlocklistActionModify}); err != nil {
+		t.Fatalf("Handle(modify) = %v, need nil error", err)
+	}
+	if !IsBlocked(bob) {
+		t.Errorf("bob not blocked after the list was refetched")
+	}
+}
+
+// TestGuardSends checks that sending to blocked contacts is refused.
+func TestGuardSends(t *testing.T) {
+	replace([]types.JID{alice})
+	GuardSends()
+
+	s := &fakeSender{}
+	if _, err := send.Text(context.Background(), s, alice, "hi"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("send.Text(_, _, alice, _) = %v, want ErrBlocked", err)
+	}
+	if _, err := send.Text(context.Background(), s, bob, "hi"); err != nil {
+		t.Errorf("send.Text(_, _, bob, _) = %v, need nil error", err)
+	}
+	if s.sent != 1 {
+		t.Errorf("%v messages sent, want 1", s.sent)
+	}
+}
@@ -0,0 +1,212 @@
+// Package queue keeps outgoing messages in an SQLite database until they are sent, so that they
+// survive disconnects and restarts.
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/internal/sqlmigrate"
+	"github.com/KarelKubat/whatsmeow/send"
+	"github.com/KarelKubat/whatsmeow/tracking"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// migrations are the schema of the queue, see sqlmigrate.
+var migrations = []string{
+	`CREATE TABLE queued_messages (
+		seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat        TEXT    NOT NULL,
+		id          TEXT    NOT NULL UNIQUE,
+		message     BLOB    NOT NULL,
+		enqueued_at INTEGER NOT NULL
+	);`,
+}
+
+// Swapped in tests.
+var (
+	now   = time.Now
+	newID = whatsmeow.GenerateMessageID
+)
+
+// Item is a queued message.
+type Item struct {
+	To       types.JID
+	ID       types.MessageID // assigned when queueing, used when sending
+	Message  *waE2E.Message
+	Enqueued time.Time
+}
+
+// sentChecker tells whether a message was sent. `tracking.SQLStore` is one.
+type sentChecker interface {
+	State(chat types.JID, id types.MessageID) (tracking.State, bool, error)
+}
+
+// Opts configures a Queue.
+type Opts struct {
+	TTL       time.Duration              // when set, messages that wait longer are dropped
+	OnExpired func(item Item)            // called for dropped messages
+	Sent      sentChecker                // when set, consulted to skip messages that were already sent
+	Permanent func(err error) bool       // when set, tells which send errors retrying won't fix
+	OnFailed  func(item Item, err error) // called for messages dropped after a permanent error
+}
+
+// Queue sends messages in the order of queueing. Each message gets its ID when it's queued, and
+// keeps it when sending is retried, so that recipients see one message even when a crash
+// happened between sending and removing it from the queue. When a tracker store is configured
+// (Opts.Sent), such messages aren't sent again at all.
+type Queue struct {
+	db     *sql.DB
+	sender send.Sender
+	opts   Opts
+
+	flushMu sync.Mutex // one flush at a time, to keep the order
+}
+
+// New returns a queue in `db`, which must be an SQLite database. The tables are created or
+// migrated when needed. Messages that were queued before a restart are sent by the next Flush.
+func New(ctx context.Context, db *sql.DB, s send.Sender, opts Opts) (*Queue, error) {
+	if err := sqlmigrate.Up(ctx, db, "queue_version", migrations); err != nil {
+		return nil, fmt.Errorf("queue.New: %w", err)
+	}
+	return &Queue{db: db, sender: s, opts: opts}, nil
+}
+
+// Register registers the queue for Connected events, which trigger a flush.
+func (q *Queue) Register() {
+	handlers.Register(handlers.Connected, q)
+}
+
+// Handle implements handlers.handler for Connected events. The flush runs in the background,
+// since it may take long; failures leave the messages queued for the next connect.
+func (q *Queue) Handle(ev interface{}) error {
+	if _, ok := ev.(*events.Connected); !ok {
+		return fmt.Errorf("queue.Queue.Handle: unexpected event %T", ev)
+	}
+	go q.Flush(context.Background())
+	return nil
+}
+
+var _ send.Enqueuer = (*Queue)(nil)
+
+// Enqueue stores a message and then flushes the queue. The returned ID is that of the message
+// once it's sent. Failing to send is not an error: the message stays queued for a later Flush.
+func (q *Queue) Enqueue(ctx context.Context, to types.JID, msg *waE2E.Message) (types.MessageID, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("queue.Queue.Enqueue: %w", err)
+	}
+	id := newID()
+	_, err = q.db.ExecContext(ctx, `INSERT INTO queued_messages (chat, id, message, enqueued_at) VALUES (?, ?, ?, ?)`,
+		to.String(), id, data, now().UnixMilli())
+	if err != nil {
+		return "", fmt.Errorf("queue.Queue.Enqueue: %w", err)
+	}
+	q.Flush(ctx)
+	return id, nil
+}
+
+// Pending returns the queued messages, in order.
+func (q *Queue) Pending(ctx context.Context) ([]Item, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT chat, id, message, enqueued_at FROM queued_messages ORDER BY seq`)
+	if err != nil {
+		return nil, fmt.Errorf("queue.Queue.Pending: %w", err)
+	}
+	defer rows.Close()
+	var out []Item
+	for rows.Next() {
+		var chat string
+		var data []byte
+		var enqueued int64
+		item := Item{Message: &waE2E.Message{}}
+		if err := rows.Scan(&chat, &item.ID, &data, &enqueued); err != nil {
+			return nil, fmt.Errorf("queue.Queue.Pending: %w", err)
+		}
+		if item.To, err = types.ParseJID(chat); err != nil {
+			return nil, fmt.Errorf("queue.Queue.Pending: %w", err)
+		}
+		if err := proto.Unmarshal(data, item.Message); err != nil {
+			return nil, fmt.Errorf("queue.Queue.Pending: message %v: %w", item.ID, err)
+		}
+		item.Enqueued = time.UnixMilli(enqueued)
+		out = append(out, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("queue.Queue.Pending: %w", err)
+	}
+	return out, nil
+}
+
+// Depth returns the number of queued messages.
+func (q *Queue) Depth(ctx context.Context) (int, error) {
+	var n int
+	if err := q.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM queued_messages`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("queue.Queue.Depth: %w", err)
+	}
+	return n, nil
+}
+
+// Flush sends the queued messages in order. It stops at the first message that can't be sent
+// for a transient reason, so that later messages don't overtake it, and returns the error.
+// Messages that fail permanently are dropped and passed to Opts.OnFailed: those that a send
+// hook vetoed (see send.VetoError), and those for which Opts.Permanent is true.
+func (q *Queue) Flush(ctx context.Context) error {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+
+	items, err := q.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		switch {
+		case q.opts.TTL > 0 && now().Sub(item.Enqueued) > q.opts.TTL:
+			if q.opts.OnExpired != nil {
+				q.opts.OnExpired(item)
+			}
+		case q.alreadySent(item):
+		default:
+			if _, err := send.Message(ctx, q.sender, item.To, item.Message, whatsmeow.SendRequestExtra{ID: item.ID}); err != nil {
+				if !q.permanent(err) {
+					return fmt.Errorf("queue.Queue.Flush: sending %v to %v: %w", item.ID, item.To, err)
+				}
+				if q.opts.OnFailed != nil {
+					q.opts.OnFailed(item, err)
+				}
+			}
+		}
+		if _, err := q.db.ExecContext(ctx, `DELETE FROM queued_messages WHERE id = ?`, item.ID); err != nil {
+			return fmt.Errorf("queue.Queue.Flush: %w", err)
+		}
+	}
+	return nil
+}
+
+// permanent returns true for send errors that retrying won't fix.
+func (q *Queue) permanent(err error) bool {
+	var veto *send.VetoError
+	if errors.As(err, &veto) {
+		return true
+	}
+	return q.opts.Permanent != nil && q.opts.Permanent(err)
+}
+
+// alreadySent returns true when the tracker knows the message. Errors are taken as "no": sending
+// twice with the same ID is better than not sending.
+func (q *Queue) alreadySent(item Item) bool {
+	if q.opts.Sent == nil {
+		return false
+	}
+	_, ok, err := q.opts.Sent.State(item.To.ToNonAD(), item.ID)
+	return err == nil && ok
+}
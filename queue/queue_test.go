@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/send"
+	"github.com/KarelKubat/whatsmeow/tracking"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeSender fails while disconnected, and records what it sent.
+type fakeSender struct {
+	connected bool
+	sent      []string // "id:text"
+}
+
+func (f *fakeSender) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if !f.connected {
+		return whatsmeow.SendResponse{}, errors.New("not connected")
+	}
+	f.sent = append(f.sent, fmt.Sprintf("%v:%v", extra[0].ID, msg.GetConversation()))
+	return whatsmeow.SendResponse{ID: extra[0].ID}, nil
+}
+
+// fakeChecker knows some IDs as sent.
+type fakeChecker struct {
+	sent map[types.MessageID]bool
+}
+
+func (f *fakeChecker) State(chat types.JID, id types.MessageID) (tracking.State, bool, error) {
+	if f.sent[id] {
+		return tracking.Sent, true, nil
+	}
+	return 0, false, nil
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open(_) = _, %v; need nil error", err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own in-memory database
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func sequentialIDs() func() {
+	n := 0
+	newID = func() types.MessageID {
+		n++
+		return types.MessageID(fmt.Sprintf("ID%v", n))
+	}
+	return func() { newID = whatsmeow.GenerateMessageID }
+}
+
+func text(s string) *waE2E.Message {
+	return &waE2E.Message{Conversation: proto.String(s)}
+}
+
+func TestCrashRestart(t *testing.T) {
+	defer sequentialIDs()()
+	ctx := context.Background()
+	db := openDB(t)
+	to := types.NewJID("123", types.DefaultUserServer)
+
+	// Disconnected: everything stays queued.
+	s := &fakeSender{}
+	q, err := New(ctx, db, s, Opts{})
+	if err != nil {
+		t.Fatalf("New(_) = _, %v; need nil error", err)
+	}
+	for _, msg := range []string{"one", "two", "three"} {
+		if _, err := q.Enqueue(ctx, to, text(msg)); err != nil {
+			t.Fatalf("Enqueue(%q) = _, %v; need nil error", msg, err)
+		}
+	}
+	if len(s.sent) != 0 {
+		t.Fatalf("sent %v while disconnected", s.sent)
+	}
+	if n, err := q.Depth(ctx); err != nil || n != 3 {
+		t.Errorf("Depth(_) = %v, %v; want 3, nil", n, err)
+	}
+
+	// Restart: a new queue on the same database sends in order, with the IDs of queueing.
+	s = &fakeSender{connected: true}
+	q, err = New(ctx, db, s, Opts{})
+	if err != nil {
+		t.Fatalf("New(_) after restart = _, %v; need nil error", err)
+	}
+	if err := q.Flush(ctx); err != nil {
+		t.Fatalf("Flush(_) = %v, need nil error", err)
+	}
+	if want := "[ID1:one ID2:two ID3:three]"; fmt.Sprint(s.sent) != want {
+		t.Errorf("sent %v, want %v", s.sent, want)
+	}
+	if pending, _ := q.Pending(ctx); len(pending) != 0 {
+		t.Errorf("Pending(_) = %v after flush, want none", pending)
+	}
+}
+
+func TestDedupAfterCrash(t *testing.T) {
+	defer sequentialIDs()()
+	ctx := context.Background()
+	db := openDB(t)
+	to := types.NewJID("123", types.DefaultUserServer)
+
+	q, _ := New(ctx, db, &fakeSender{}, Opts{})
+	q.Enqueue(ctx, to, text("one"))
+	q.Enqueue(ctx, to, text("two"))
+
+	// ID1 was sent, but the process crashed before it was removed from the queue.
+	s := &fakeSender{connected: true}
+	q, _ = New(ctx, db, s, Opts{Sent: &fakeChecker{sent: map[types.MessageID]bool{"ID1": true}}})
+	if err := q.Flush(ctx); err != nil {
+		t.Fatalf("Flush(_) = %v, need nil error", err)
+	}
+	if want := "[ID2:two]"; fmt.Sprint(s.sent) != want {
+		t.Errorf("sent %v, want %v", s.sent, want)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	defer sequentialIDs()()
+	ctx := context.Background()
+	db := openDB(t)
+	to := types.NewJID("123", types.DefaultUserServer)
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return base }
+	defer func() { now = time.Now }()
+
+	var expired []types.MessageID
+	opts := Opts{TTL: time.Hour, OnExpired: func(item Item) { expired = append(expired, item.ID) }}
+	q, _ := New(ctx, db, &fakeSender{}, opts)
+	q.Enqueue(ctx, to, text("stale"))
+	now = func() time.Time { return base.Add(50 * time.Minute) }
+	q.Enqueue(ctx, to, text("fresh"))
+
+	now = func() time.Time { return base.Add(90 * time.Minute) }
+	s := &fakeSender{connected: true}
+	q, _ = New(ctx, db, s, opts)
+	if err := q.Flush(ctx); err != nil {
+		t.Fatalf("Flush(_) = %v, need nil error", err)
+	}
+	if fmt.Sprint(expired) != "[ID1]" || fmt.Sprint(s.sent) != "[ID2:fresh]" {
+		t.Errorf("expired %v and sent %v, want [ID1] and [ID2:fresh]", expired, s.sent)
+	}
+}
+
+func TestOrderKeptOnFailure(t *testing.T) {
+	defer sequentialIDs()()
+	ctx := context.Background()
+	db := openDB(t)
+	to := types.NewJID("123", types.DefaultUserServer)
+
+	s := &fakeSender{}
+	q, _ := New(ctx, db, s, Opts{})
+	q.Enqueue(ctx, to, text("one"))
+	if err := q.Flush(ctx); err == nil {
+		t.Errorf("Flush(_) while disconnected = nil, want error")
+	}
+	s.connected = true
+	q.Enqueue(ctx, to, text("two"))
+	if want := "[ID1:one ID2:two]"; fmt.Sprint(s.sent) != want {
+		t.Errorf("sent %v, want %v", s.sent, want)
+	}
+}
+
+var errVetoed = errors.New("vetoed")
+
+func TestPermanentFailureDropped(t *testing.T) {
+	defer sequentialIDs()()
+	ctx := context.Background()
+	db := openDB(t)
+	to := types.NewJID("123", types.DefaultUserServer)
+	// Hooks can't be removed, so this one only vetoes its own messages.
+	send.AddHook(func(to types.JID, msg *waE2E.Message) error {
+		if msg.GetConversation() == "veto me" {
+			return errVetoed
+		}
+		return nil
+	})
+
+	var failed []string
+	s := &fakeSender{}
+	q, _ := New(ctx, db, s, Opts{
+		Permanent: func(err error) bool { return err.Error() == "not connected" }, // for this test
+		OnFailed:  func(item Item, err error) { failed = append(failed, fmt.Sprintf("%v:%v", item.ID, err)) },
+	})
+	q.Enqueue(ctx, to, text("veto me"))
+	q.Enqueue(ctx, to, text("unreachable"))
+	s.connected = true
+	q.Enqueue(ctx, to, text("after"))
+	if err := q.Flush(ctx); err != nil {
+		t.Fatalf("Flush(_) = %v, need nil error", err)
+	}
+	if want := "[ID1:vetoed ID2:not connected]"; fmt.Sprint(failed) != want {
+		t.Errorf("failed %v, want %v", failed, want)
+	}
+	if want := "[ID3:after]"; fmt.Sprint(s.sent) != want {
+		t.Errorf("sent %v, want %v", s.sent, want)
+	}
+	if n, err := q.Depth(ctx); err != nil || n != 0 {
+		t.Errorf("Depth(_) = %v, %v; want 0, nil", n, err)
+	}
+}
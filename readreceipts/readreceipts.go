@@ -0,0 +1,169 @@
+// Package readreceipts marks incoming messages as read automatically, e.g. for a support-desk bot.
+package readreceipts
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// now and afterFunc are swapped in tests.
+var (
+	now       = time.Now
+	afterFunc = func(d time.Duration, f func()) (stop func() bool) { return time.AfterFunc(d, f).Stop }
+)
+
+// MarkReadFunc sends read receipts, such as the MarkRead method of a *whatsmeow.Client.
+type MarkReadFunc func(ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error
+
+// Opts configures an AutoReader.
+type Opts struct {
+	Chats      []types.JID   // whose messages are marked as read, all chats when empty
+	Delay      time.Duration // before marking, to look human; the messages that come in meanwhile are batched
+	MaxBatch   int           // message IDs per receipt, after which a batch is marked right away; unlimited when zero
+	SkipFromMe bool          // don't mark the messages that this account sent, e.g. from the phone
+
+	// OnError is invoked when marking a delayed batch fails, since there is no caller to return
+	// the error to. Optional.
+	OnError func(chat, sender types.JID, ids []types.MessageID, err error)
+}
+
+// batchKey identifies the messages that go in one receipt: WhatsApp marks the messages of one
+// sender at a time, so in groups the batches are per chat and sender, and in DMs per chat.
+type batchKey struct {
+	chat, sender types.JID
+}
+
+// batch is the message IDs that wait to be marked.
+type batch struct {
+	ids    []types.MessageID
+	cancel func() bool
+}
+
+// AutoReader is a handler for Message events that marks them as read. Register it for the
+// Message events of the client. The zero value isn't usable, use New.
+type AutoReader struct {
+	markRead MarkReadFunc
+	opts     Opts
+	chats    map[types.JID]bool
+
+	mu      sync.Mutex
+	pending map[batchKey]*batch
+}
+
+// New returns an auto reader that sends the receipts with `markRead`, typically client.MarkRead.
+//
+//	r := readreceipts.New(client.MarkRead, readreceipts.Opts{Chats: desk, Delay: 2 * time.Second, SkipFromMe: true})
+//	handlers.Register(handlers.Message, r)
+//	defer r.Flush()
+func New(markRead MarkReadFunc, opts Opts) *AutoReader {
+	r := &AutoReader{
+		markRead: markRead,
+		opts:     opts,
+		pending:  map[batchKey]*batch{},
+	}
+	if len(opts.Chats) > 0 {
+		r.chats = map[types.JID]bool{}
+		for _, c := range opts.Chats {
+			r.chats[c.ToNonAD()] = true
+		}
+	}
+	return r
+}
+
+// sender returns the JID that goes with the receipt for a message: in DMs none, and in groups,
+// broadcasts and other chats with several participants the sender, without the device.
+func sender(info *types.MessageInfo) types.JID {
+	switch info.Chat.Server {
+	case types.DefaultUserServer, types.MessengerServer:
+		return types.EmptyJID
+	}
+	return info.Sender.ToNonAD()
+}
+
+// Handle implements handlers.handler for Message events. Without a delay, the message is marked
+// right away, and the error of marking it is returned.
+func (r *AutoReader) Handle(ev interface{}) error {
+	m, ok := ev.(*events.Message)
+	if !ok {
+		return fmt.Errorf("readreceipts.AutoReader.Handle: unexpected event %T", ev)
+	}
+	if m.Info.IsFromMe && r.opts.SkipFromMe || r.chats != nil && !r.chats[m.Info.Chat.ToNonAD()] {
+		return nil
+	}
+	key := batchKey{chat: m.Info.Chat, sender: sender(&m.Info)}
+	if r.opts.Delay <= 0 {
+		return r.handleErr(r.mark(key, []types.MessageID{m.Info.ID}))
+	}
+
+	r.mu.Lock()
+	b := r.pending[key]
+	if b == nil {
+		b = &batch{}
+		r.pending[key] = b
+		b.cancel = afterFunc(r.opts.Delay, func() { r.flushDelayed(key, b) })
+	}
+	b.ids = append(b.ids, m.Info.ID)
+	if r.opts.MaxBatch <= 0 || len(b.ids) < r.opts.MaxBatch {
+		r.mu.Unlock()
+		return nil
+	}
+	b.cancel()
+	delete(r.pending, key)
+	r.mu.Unlock()
+	return r.handleErr(r.mark(key, b.ids))
+}
+
+// handleErr returns an error of marking from Handle.
+func (r *AutoReader) handleErr(err error) error {
+	if err != nil {
+		return fmt.Errorf("readreceipts.AutoReader.Handle: %w", err)
+	}
+	return nil
+}
+
+// flushDelayed marks a batch once its delay is over, unless it was marked meanwhile.
+func (r *AutoReader) flushDelayed(key batchKey, b *batch) {
+	r.mu.Lock()
+	if r.pending[key] != b {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.pending, key)
+	r.mu.Unlock()
+	if err := r.mark(key, b.ids); err != nil && r.opts.OnError != nil {
+		r.opts.OnError(key.chat, key.sender, b.ids, err)
+	}
+}
+
+// Flush marks the messages that wait for their delay right away, e.g. before disconnecting.
+func (r *AutoReader) Flush() error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = map[batchKey]*batch{}
+	r.mu.Unlock()
+
+	var errs []error
+	for key, b := range pending {
+		b.cancel()
+		if err := r.mark(key, b.ids); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("readreceipts.AutoReader.Flush: %w", err)
+	}
+	return nil
+}
+
+// mark sends the receipt for a batch.
+func (r *AutoReader) mark(key batchKey, ids []types.MessageID) error {
+	if err := r.markRead(ids, now(), key.chat, key.sender); err != nil {
+		return fmt.Errorf("marking %d message(s) in %v as read: %w", len(ids), key.chat, err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package readreceipts
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+var (
+	dm      = types.NewJID("31611111111", types.DefaultUserServer)
+	group   = types.NewJID("120363000000000000", types.GroupServer)
+	alice   = types.NewJID("31622222222", types.DefaultUserServer)
+	bob     = types.NewJID("31633333333", types.DefaultUserServer)
+	aliceAD = types.NewADJID("31622222222", 0, 3)
+)
+
+func message(id string, chat, sender types.JID, fromMe bool) *events.Message {
+	m := &events.Message{}
+	m.Info.ID, m.Info.Chat, m.Info.Sender, m.Info.IsFromMe = id, chat, sender, fromMe
+	m.Info.IsGroup = chat.Server == types.GroupServer
+	return m
+}
+
+// fakeTimers is swapped in for `afterFunc`, and the tests fire its timers.
+type fakeTimers struct {
+	fs []func()
+}
+
+func withFakeTimers(t *testing.T) *fakeTimers {
+	ft := &fakeTimers{}
+	old := afterFunc
+	afterFunc = func(d time.Duration, f func()) func() bool {
+		ft.fs = append(ft.fs, f)
+		return func() bool { return true }
+	}
+	t.Cleanup(func() { afterFunc = old })
+	return ft
+}
+
+// fireAll fires all timers, as if their delay was over, also the cancelled ones.
+func (ft *fakeTimers) fireAll() {
+	for _, f := range ft.fs {
+		f()
+	}
+}
+
+// receipts records the receipts that are sent, as "chat/sender:id,id".
+type receipts struct {
+	sent []string
+	err  error
+}
+
+func (r *receipts) markRead(ids []types.MessageID, ts time.Time, chat, sender types.JID, extra ...types.ReceiptType) error {
+	r.sent = append(r.sent, fmt.Sprintf("%v/%v:%v", chat.User, sender.User, strings.Join(ids, ",")))
+	return r.err
+}
+
+func (r *receipts) String() string {
+	sort.Strings(r.sent)
+	return strings.Join(r.sent, " ")
+}
+
+func TestAutoReader(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		opts        Opts
+		messages    []*events.Message
+		wantHandled string // receipts sent while handling
+		want        string // receipts sent in all
+	}{
+		{
+			description: "DM right away",
+			messages:    []*events.Message{message("M1", dm, dm, false), message("M2", dm, dm, false)},
+			wantHandled: "31611111111/:M1 31611111111/:M2",
+			want:        "31611111111/:M1 31611111111/:M2",
+		},
+		{
+			description: "group right away, with the sender without device",
+			messages:    []*events.Message{message("M1", group, aliceAD, false)},
+			wantHandled: "120363000000000000/31622222222:M1",
+			want:        "120363000000000000/31622222222:M1",
+		},
+		{
+			description: "batched per chat",
+			opts:        Opts{Delay: time.Second},
+			messages: []*events.Message{
+				message("M1", dm, dm, false), message("M2", dm, dm, false), message("M3", alice, alice, false),
+			},
+			want: "31611111111/:M1,M2 31622222222/:M3",
+		},
+		{
+			description: "batched per group sender",
+			opts:        Opts{Delay: time.Second},
+			messages: []*events.Message{
+				message("M1", group, alice, false), message("M2", group, bob, false),
+				message("M3", group, aliceAD, false), message("M4", dm, dm, false),
+			},
+			want: "120363000000000000/31622222222:M1,M3 120363000000000000/31633333333:M2 31611111111/:M4",
+		},
+		{
+			description: "full batches right away",
+			opts:        Opts{Delay: time.Second, MaxBatch: 2},
+			messages: []*events.Message{
+				message("M1", dm, dm, false), message("M2", dm, dm, false), message("M3", dm, dm, false),
+			},
+			wantHandled: "31611111111/:M1,M2",
+			want:        "31611111111/:M1,M2 31611111111/:M3",
+		},
+		{
+			description: "allow-listed chats",
+			opts:        Opts{Chats: []types.JID{group}},
+			messages:    []*events.Message{message("M1", dm, dm, false), message("M2", group, bob, false)},
+			wantHandled: "120363000000000000/31633333333:M2",
+			want:        "120363000000000000/31633333333:M2",
+		},
+		{
+			description: "skipping from me",
+			opts:        Opts{SkipFromMe: true},
+			messages:    []*events.Message{message("M1", dm, alice, true), message("M2", dm, dm, false)},
+			wantHandled: "31611111111/:M2",
+			want:        "31611111111/:M2",
+		},
+		{
+			description: "marking from me",
+			messages:    []*events.Message{message("M1", dm, alice, true)},
+			wantHandled: "31611111111/:M1",
+			want:        "31611111111/:M1",
+		},
+	} {
+		timers := withFakeTimers(t)
+		rec := &receipts{}
+		r := New(rec.markRead, test.opts)
+		for _, m := range test.messages {
+			if err := r.Handle(m); err != nil {
+				t.Errorf("%v: Handle(%v) = %v, need nil error", test.description, m.Info.ID, err)
+			}
+		}
+		if got := rec.String(); got != test.wantHandled {
+			t.Errorf("%v: marked %q while handling, want %q", test.description, got, test.wantHandled)
+		}
+		timers.fireAll()
+		if got := rec.String(); got != test.want {
+			t.Errorf("%v: marked %q, want %q", test.description, got, test.want)
+		}
+	}
+}
+
+func TestAutoReaderErrors(t *testing.T) {
+	timers := withFakeTimers(t)
+	rec := &receipts{err: errors.New("not connected")}
+	if err := New(rec.markRead, Opts{}).Handle(message("M1", dm, dm, false)); err == nil || !strings.Contains(err.Error(), "not connected") {
+		t.Errorf("Handle(_) = %v, want the error of MarkRead", err)
+	}
+
+	var failed []string
+	r := New(rec.markRead, Opts{Delay: time.Second, OnError: func(chat, sender types.JID, ids []types.MessageID, err error) {
+		failed = append(failed, fmt.Sprintf("%v/%v:%v", chat.User, sender.User, strings.Join(ids, ",")))
+	}})
+	r.Handle(message("M2", group, bob, false))
+	timers.fireAll()
+	if got, want := strings.Join(failed, " "), "120363000000000000/31633333333:M2"; got != want {
+		t.Errorf("OnError got %q, want %q", got, want)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	timers := withFakeTimers(t)
+	rec := &receipts{}
+	r := New(rec.markRead, Opts{Delay: time.Hour})
+	r.Handle(message("M1", dm, dm, false))
+	r.Handle(message("M2", group, alice, false))
+	if err := r.Flush(); err != nil {
+		t.Errorf("Flush() = %v, need nil error", err)
+	}
+	timers.fireAll() // the cancelled timers are stale
+	if got, want := rec.String(), "120363000000000000/31622222222:M2 31611111111/:M1"; got != want {
+		t.Errorf("marked %q, want %q", got, want)
+	}
+}
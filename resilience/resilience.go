@@ -0,0 +1,266 @@
+// Package resilience keeps a client connected: it reconnects with backoff after transient
+// disconnects, and gives up when reconnecting would make things worse, such as after the session
+// was logged out or replaced by another client.
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// State is the state of the connection, as far as the Reconnector knows.
+type State int
+
+const (
+	Connected State = iota
+	Reconnecting
+	GaveUp
+)
+
+// String returns the string representation of a State.
+func (s State) String() string {
+	switch s {
+	case Connected:
+		return "Connected"
+	case Reconnecting:
+		return "Reconnecting"
+	case GaveUp:
+		return "GaveUp"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Defaults of Opts.
+const (
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 5 * time.Minute
+	DefaultMultiplier     = 2.0
+	DefaultJitter         = 0.2
+)
+
+// ErrMaxAttempts is the reason to give up when the client couldn't reconnect in Opts.MaxAttempts.
+var ErrMaxAttempts = errors.New("resilience: too many failed reconnects")
+
+// afterFunc and jitter are swapped in tests.
+var (
+	afterFunc = func(d time.Duration, f func()) (stop func() bool) { return time.AfterFunc(d, f).Stop }
+	jitter    = rand.Float64
+)
+
+// Client is the part of a *whatsmeow.Client that reconnects. Turn off the client's own
+// reconnecting with `client.EnableAutoReconnect = false`, so that the two don't race.
+type Client interface {
+	Connect() error
+}
+
+// Opts configures a Reconnector.
+type Opts struct {
+	Dispatcher     *handlers.Dispatcher            // that gets the client's events, the default dispatcher when nil
+	InitialBackoff time.Duration                   // before the first reconnect, DefaultInitialBackoff when zero
+	MaxBackoff     time.Duration                   // cap of the backoff, DefaultMaxBackoff when zero
+	Multiplier     float64                         // of the backoff after each failed reconnect, DefaultMultiplier when zero
+	Jitter         float64                         // random fraction taken off the backoff, DefaultJitter when zero, none when negative
+	MaxAttempts    int                             // of reconnecting before giving up, unlimited when zero
+	OnStateChange  func(old, new State, err error) // invoked on changes, with the reason of reconnecting or giving up
+}
+
+// Reconnector reconnects a client after transient failures: Disconnected, StreamError, and
+// ConnectFailure with a 5xx reason. It doesn't reconnect, and gives up, after LoggedOut,
+// StreamReplaced (reconnecting would fight the other client in a login loop), TemporaryBan,
+// ClientOutdated, and ConnectFailure with other reasons. A Connected event, e.g. after connecting
+// by hand, resets it. The zero value isn't usable, use NewReconnector.
+type Reconnector struct {
+	client Client
+	opts   Opts
+
+	mu       sync.Mutex
+	state    State
+	err      error // why it reconnects or gave up
+	attempts int   // reconnects since the last Connected
+	gen      int   // of the scheduled reconnect; a reconnect of an older generation is stale
+	cancel   func() bool
+	changes  []func() // OnStateChange calls, made by unlock
+}
+
+// unlock unlocks r.mu, and then reports the state changes, so that OnStateChange can use the
+// reconnector.
+func (r *Reconnector) unlock() {
+	changes := r.changes
+	r.changes = nil
+	r.mu.Unlock()
+	for _, f := range changes {
+		f()
+	}
+}
+
+// NewReconnector returns a reconnector for a client, and registers it for the connection events of
+// the dispatcher. It starts out Connected.
+//
+//	client.EnableAutoReconnect = false
+//	r := resilience.NewReconnector(client, resilience.Opts{MaxAttempts: 10, OnStateChange: report})
+func NewReconnector(client Client, opts Opts) *Reconnector {
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = DefaultInitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.Multiplier <= 0 {
+		opts.Multiplier = DefaultMultiplier
+	}
+	if opts.Jitter == 0 {
+		opts.Jitter = DefaultJitter
+	}
+	r := &Reconnector{client: client, opts: opts}
+	types := []handlers.EventType{
+		handlers.Connected, handlers.Disconnected, handlers.StreamError, handlers.ConnectFailure,
+		handlers.LoggedOut, handlers.StreamReplaced, handlers.TemporaryBan, handlers.ClientOutdated,
+	}
+	if opts.Dispatcher != nil {
+		opts.Dispatcher.RegisterMany(types, r)
+	} else {
+		handlers.RegisterMany(types, r)
+	}
+	return r
+}
+
+// State returns the state, and the reason of reconnecting or giving up.
+func (r *Reconnector) State() (State, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state, r.err
+}
+
+// Stop cancels a scheduled reconnect, and gives up.
+func (r *Reconnector) Stop() {
+	r.mu.Lock()
+	defer r.unlock()
+	r.giveUp(errors.New("resilience: stopped"))
+}
+
+// Handle implements handlers.handler for the connection events.
+func (r *Reconnector) Handle(ev interface{}) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	switch v := ev.(type) {
+	case *events.Connected:
+		r.unschedule()
+		r.attempts = 0
+		r.setState(Connected, nil)
+	case *events.Disconnected:
+		r.reconnect(errors.New("disconnected"))
+	case *events.StreamError:
+		r.reconnect(fmt.Errorf("stream error %s", v.Code))
+	case *events.ConnectFailure:
+		err := fmt.Errorf("connect failure %v", v.Reason)
+		if v.Reason >= 500 {
+			r.reconnect(err)
+		} else {
+			r.giveUp(err)
+		}
+	case *events.LoggedOut:
+		r.giveUp(errors.New("logged out"))
+	case *events.StreamReplaced:
+		r.giveUp(errors.New("stream replaced by another client"))
+	case *events.TemporaryBan:
+		r.giveUp(fmt.Errorf("temporarily banned: %v", v))
+	case *events.ClientOutdated:
+		r.giveUp(errors.New("client outdated"))
+	default:
+		return fmt.Errorf("resilience.Reconnector.Handle: unexpected event %T", ev)
+	}
+	return nil
+}
+
+// setState changes the state. The caller holds r.mu.
+func (r *Reconnector) setState(s State, err error) {
+	old := r.state
+	r.state, r.err = s, err
+	if old != s && r.opts.OnStateChange != nil {
+		r.changes = append(r.changes, func() { r.opts.OnStateChange(old, s, err) })
+	}
+}
+
+// giveUp stops reconnecting. The caller holds r.mu.
+func (r *Reconnector) giveUp(err error) {
+	r.unschedule()
+	r.setState(GaveUp, err)
+}
+
+// unschedule cancels a scheduled reconnect. The caller holds r.mu.
+func (r *Reconnector) unschedule() {
+	r.gen++
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+// reconnect schedules a reconnect after a transient failure, unless the reconnector gave up, or
+// one is scheduled. The caller holds r.mu.
+func (r *Reconnector) reconnect(err error) {
+	if r.state == GaveUp || r.cancel != nil {
+		return
+	}
+	r.setState(Reconnecting, err)
+	r.schedule()
+}
+
+// schedule schedules the next reconnect, or gives up after MaxAttempts. The caller holds r.mu.
+func (r *Reconnector) schedule() {
+	if r.opts.MaxAttempts > 0 && r.attempts >= r.opts.MaxAttempts {
+		r.giveUp(fmt.Errorf("%w (%d): %v", ErrMaxAttempts, r.attempts, r.err))
+		return
+	}
+	r.gen++
+	gen := r.gen
+	r.cancel = afterFunc(r.backoff(), func() { r.attempt(gen) })
+}
+
+// backoff returns the delay before the next reconnect. The caller holds r.mu.
+func (r *Reconnector) backoff() time.Duration {
+	d := float64(r.opts.InitialBackoff)
+	for i := 0; i < r.attempts && d < float64(r.opts.MaxBackoff); i++ {
+		d *= r.opts.Multiplier
+	}
+	if d > float64(r.opts.MaxBackoff) {
+		d = float64(r.opts.MaxBackoff)
+	}
+	if r.opts.Jitter > 0 {
+		d -= d * r.opts.Jitter * jitter()
+	}
+	return time.Duration(d)
+}
+
+// attempt reconnects, unless the reconnect is stale. When connecting fails, the next reconnect is
+// scheduled; when it succeeds, the Connected event completes it.
+func (r *Reconnector) attempt(gen int) {
+	r.mu.Lock()
+	if gen != r.gen {
+		r.mu.Unlock()
+		return
+	}
+	r.cancel = nil
+	r.attempts++
+	r.mu.Unlock()
+
+	err := r.client.Connect() // unlocked, since it may dispatch events
+
+	r.mu.Lock()
+	defer r.unlock()
+	if gen != r.gen || r.state != Reconnecting {
+		return // e.g. Connected or LoggedOut came in
+	}
+	if err != nil {
+		r.err = err
+		r.schedule()
+	}
+}
@@ -0,0 +1,241 @@
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// timer is a reconnect that the fake clock scheduled.
+type timer struct {
+	d       time.Duration
+	f       func()
+	stopped bool
+}
+
+// fakeClock is swapped in for `afterFunc`, and the tests fire its timers.
+type fakeClock struct {
+	timers []*timer
+}
+
+func withFakeClock(t *testing.T) *fakeClock {
+	c := &fakeClock{}
+	oldAfter, oldJitter := afterFunc, jitter
+	afterFunc = func(d time.Duration, f func()) func() bool {
+		tm := &timer{d: d, f: f}
+		c.timers = append(c.timers, tm)
+		return func() bool {
+			tm.stopped = true
+			return true
+		}
+	}
+	jitter = func() float64 { return 0 }
+	t.Cleanup(func() { afterFunc, jitter = oldAfter, oldJitter })
+	return c
+}
+
+// fire fires the last timer, as if its time came, also when it was stopped.
+func (c *fakeClock) fire(t *testing.T) {
+	t.Helper()
+	if len(c.timers) == 0 {
+		t.Fatalf("no reconnect was scheduled")
+	}
+	c.timers[len(c.timers)-1].f()
+}
+
+// fakeClient fails to connect with the given errors in turn, and then succeeds.
+type fakeClient struct {
+	errs     []error
+	connects int
+}
+
+func (c *fakeClient) Connect() error {
+	c.connects++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	return nil
+}
+
+// step is an event to dispatch, or "fire" to fire the last timer.
+const fire = "fire"
+
+func TestReconnector(t *testing.T) {
+	refused := errors.New("connection refused")
+	for _, test := range []struct {
+		description  string
+		opts         Opts
+		connectErrs  []error
+		steps        []interface{}
+		wantDelays   string
+		wantConnects int
+		wantState    State
+		wantChanges  string
+	}{
+		{
+			description:  "reconnected after a disconnect",
+			steps:        []interface{}{&events.Disconnected{}, fire, &events.Connected{}},
+			wantDelays:   "1s",
+			wantConnects: 1,
+			wantState:    Connected,
+			wantChanges:  "Connected>Reconnecting Reconnecting>Connected",
+		},
+		{
+			description:  "backing off",
+			opts:         Opts{MaxBackoff: 5 * time.Second},
+			connectErrs:  []error{refused, refused, refused, refused},
+			steps:        []interface{}{&events.StreamError{Code: "999"}, fire, fire, fire, fire, fire, &events.Connected{}, &events.Disconnected{}},
+			wantDelays:   "1s 2s 4s 5s 5s 1s",
+			wantConnects: 5,
+			wantState:    Reconnecting,
+			wantChanges:  "Connected>Reconnecting Reconnecting>Connected Connected>Reconnecting",
+		},
+		{
+			description:  "giving up after max attempts",
+			opts:         Opts{MaxAttempts: 2, Multiplier: 3},
+			connectErrs:  []error{refused, refused},
+			steps:        []interface{}{&events.Disconnected{}, fire, fire},
+			wantDelays:   "1s 3s",
+			wantConnects: 2,
+			wantState:    GaveUp,
+			wantChanges:  "Connected>Reconnecting Reconnecting>GaveUp",
+		},
+		{
+			description: "one reconnect for several disconnects",
+			steps:       []interface{}{&events.Disconnected{}, &events.StreamError{}, &events.Disconnected{}},
+			wantDelays:  "1s",
+			wantState:   Reconnecting,
+			wantChanges: "Connected>Reconnecting",
+		},
+		{
+			description: "not after a replaced stream",
+			steps:       []interface{}{&events.StreamReplaced{}, &events.Disconnected{}},
+			wantState:   GaveUp,
+			wantChanges: "Connected>GaveUp",
+		},
+		{
+			description:  "not after logging out while reconnecting",
+			steps:        []interface{}{&events.Disconnected{}, &events.LoggedOut{}, fire},
+			wantDelays:   "1s",
+			wantConnects: 0,
+			wantState:    GaveUp,
+			wantChanges:  "Connected>Reconnecting Reconnecting>GaveUp",
+		},
+		{
+			description: "not after a temporary ban",
+			steps:       []interface{}{&events.TemporaryBan{Code: events.TempBanSentToTooManyPeople}},
+			wantState:   GaveUp,
+			wantChanges: "Connected>GaveUp",
+		},
+		{
+			description: "not when outdated",
+			steps:       []interface{}{&events.ClientOutdated{}, &events.Disconnected{}},
+			wantState:   GaveUp,
+			wantChanges: "Connected>GaveUp",
+		},
+		{
+			description:  "after a server failure",
+			steps:        []interface{}{&events.ConnectFailure{Reason: events.ConnectFailureServiceUnavailable}, fire},
+			wantDelays:   "1s",
+			wantConnects: 1,
+			wantState:    Reconnecting,
+			wantChanges:  "Connected>Reconnecting",
+		},
+		{
+			description: "not after another failure",
+			steps:       []interface{}{&events.ConnectFailure{Reason: events.ConnectFailureBadUserAgent}},
+			wantState:   GaveUp,
+			wantChanges: "Connected>GaveUp",
+		},
+		{
+			description:  "after connecting by hand",
+			steps:        []interface{}{&events.StreamReplaced{}, &events.Connected{}, &events.Disconnected{}, fire},
+			wantDelays:   "1s",
+			wantConnects: 1,
+			wantState:    Reconnecting,
+			wantChanges:  "Connected>GaveUp GaveUp>Connected Connected>Reconnecting",
+		},
+	} {
+		clock := withFakeClock(t)
+		client := &fakeClient{errs: test.connectErrs}
+		d := handlers.New()
+		var changes []string
+		test.opts.Dispatcher = d
+		test.opts.OnStateChange = func(old, new State, err error) {
+			changes = append(changes, fmt.Sprintf("%v>%v", old, new))
+		}
+		r := NewReconnector(client, test.opts)
+
+		for _, step := range test.steps {
+			if step == fire {
+				clock.fire(t)
+				continue
+			}
+			if err := d.Dispatch(step); err != nil {
+				t.Errorf("%v: Dispatch(%T) = %v, need nil error", test.description, step, err)
+			}
+		}
+		var delays []string
+		for _, tm := range clock.timers {
+			delays = append(delays, tm.d.String())
+		}
+		if got := strings.Join(delays, " "); got != test.wantDelays {
+			t.Errorf("%v: reconnects scheduled after %q, want %q", test.description, got, test.wantDelays)
+		}
+		if client.connects != test.wantConnects {
+			t.Errorf("%v: %d connects, want %d", test.description, client.connects, test.wantConnects)
+		}
+		if got, err := r.State(); got != test.wantState {
+			t.Errorf("%v: State() = %v, %v, want %v", test.description, got, err, test.wantState)
+		}
+		if got := strings.Join(changes, " "); got != test.wantChanges {
+			t.Errorf("%v: state changes %q, want %q", test.description, got, test.wantChanges)
+		}
+	}
+}
+
+func TestReconnectorMaxAttemptsError(t *testing.T) {
+	clock := withFakeClock(t)
+	d := handlers.New()
+	r := NewReconnector(&fakeClient{errs: []error{errors.New("refused")}}, Opts{Dispatcher: d, MaxAttempts: 1})
+	d.Dispatch(&events.Disconnected{})
+	clock.fire(t)
+	if s, err := r.State(); s != GaveUp || !errors.Is(err, ErrMaxAttempts) {
+		t.Errorf("State() = %v, %v, want %v, %v", s, err, GaveUp, ErrMaxAttempts)
+	}
+}
+
+func TestReconnectorJitter(t *testing.T) {
+	clock := withFakeClock(t)
+	jitter = func() float64 { return 0.5 }
+	d := handlers.New()
+	NewReconnector(&fakeClient{}, Opts{Dispatcher: d, InitialBackoff: 10 * time.Second, Jitter: 0.2})
+	d.Dispatch(&events.Disconnected{})
+	if len(clock.timers) != 1 || clock.timers[0].d != 9*time.Second {
+		t.Errorf("scheduled %v, want one reconnect after 9s", clock.timers)
+	}
+}
+
+func TestStop(t *testing.T) {
+	clock := withFakeClock(t)
+	client := &fakeClient{}
+	d := handlers.New()
+	r := NewReconnector(client, Opts{Dispatcher: d})
+	d.Dispatch(&events.Disconnected{})
+	r.Stop()
+	clock.fire(t)
+	if client.connects != 0 || !clock.timers[0].stopped {
+		t.Errorf("connected %d times after Stop, want the reconnect cancelled", client.connects)
+	}
+	if s, _ := r.State(); s != GaveUp {
+		t.Errorf("State() = %v, want %v", s, GaveUp)
+	}
+}
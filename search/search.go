@@ -0,0 +1,299 @@
+// Package search finds messages in the SQLite database of package msgstore. It uses an FTS5
+// full-text index when the SQLite driver supports it, and falls back to LIKE queries otherwise.
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// index is the FTS5 index of the messages of msgstore. It is an external-content index: the
+// text is kept in the messages table, and triggers keep the index in sync. Revoked messages
+// are removed from the index.
+var index = []string{
+	`CREATE VIRTUAL TABLE messages_fts USING fts5(text, content='messages', content_rowid='rowid')`,
+	`CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages WHEN new.revoked_at IS NULL BEGIN
+		INSERT INTO messages_fts (rowid, text) VALUES (new.rowid, new.text);
+	END`,
+	`CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages WHEN old.revoked_at IS NULL BEGIN
+		INSERT INTO messages_fts (messages_fts, rowid, text) VALUES ('delete', old.rowid, old.text);
+	END`,
+	`CREATE TRIGGER messages_fts_update AFTER UPDATE OF text, revoked_at ON messages BEGIN
+		INSERT INTO messages_fts (messages_fts, rowid, text) SELECT 'delete', old.rowid, old.text WHERE old.revoked_at IS NULL;
+		INSERT INTO messages_fts (rowid, text) SELECT new.rowid, new.text WHERE new.revoked_at IS NULL;
+	END`,
+	`INSERT INTO messages_fts (rowid, text) SELECT rowid, text FROM messages WHERE revoked_at IS NULL`,
+}
+
+// EnsureIndex creates the full-text index when it doesn't exist, and indexes the stored
+// messages. Call it after `msgstore.New`. It returns false when the driver lacks FTS5; for
+// `github.com/mattn/go-sqlite3`, build with `-tags sqlite_fts5`. Queries work either way.
+func EnsureIndex(ctx context.Context, db *sql.DB) (bool, error) {
+	ok, err := hasIndex(ctx, db)
+	if err != nil || ok {
+		return ok, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("search.EnsureIndex: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, index[0]); err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return false, nil
+		}
+		return false, fmt.Errorf("search.EnsureIndex: %w", err)
+	}
+	for _, stmt := range index[1:] {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return false, fmt.Errorf("search.EnsureIndex: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("search.EnsureIndex: %w", err)
+	}
+	return true, nil
+}
+
+func hasIndex(ctx context.Context, db *sql.DB) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'messages_fts'`).Scan(&n)
+	return n > 0, err
+}
+
+// Opts filters and formats the matches of Query.
+type Opts struct {
+	Chat      types.JID // only this chat, when set
+	Sender    types.JID // only this sender, when set
+	Since     time.Time // only messages sent at or after, when set
+	Until     time.Time // only messages sent before, when set
+	Limit     int       // at most this many matches, 20 when zero
+	Highlight [2]string // around matched terms in snippets, "[" and "]" when empty
+}
+
+// Match is a message that matches a query.
+type Match struct {
+	Chat      types.JID
+	Sender    types.JID
+	ID        types.MessageID
+	Timestamp time.Time
+	Snippet   string // the matching part of the text, with highlighted terms
+}
+
+// snippetWords is the length of snippets.
+const snippetWords = 12
+
+// Query returns the messages that contain all words of `q`, best matches first. Revoked
+// messages aren't found; edited messages are found by their new text.
+func Query(ctx context.Context, db *sql.DB, q string, opts Opts) ([]Match, error) {
+	terms := strings.Fields(q)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 20
+	}
+	if opts.Highlight == [2]string{} {
+		opts.Highlight = [2]string{"[", "]"}
+	}
+	ok, err := hasIndex(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("search.Query: %w", err)
+	}
+	var out []Match
+	if ok {
+		out, err = queryFTS(ctx, db, terms, opts)
+	} else {
+		out, err = queryLike(ctx, db, terms, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("search.Query: %w", err)
+	}
+	return out, nil
+}
+
+// filters returns the WHERE clauses and arguments for the filters of opts, on the messages
+// table aliased as m.
+func filters(opts Opts) ([]string, []interface{}) {
+	where := []string{"m.revoked_at IS NULL"}
+	var args []interface{}
+	if !opts.Chat.IsEmpty() {
+		where = append(where, "m.chat = ?")
+		args = append(args, opts.Chat.String())
+	}
+	if !opts.Sender.IsEmpty() {
+		where = append(where, "m.sender = ?")
+		args = append(args, opts.Sender.String())
+	}
+	if !opts.Since.IsZero() {
+		where = append(where, "m.timestamp >= ?")
+		args = append(args, opts.Since.UnixMilli())
+	}
+	if !opts.Until.IsZero() {
+		where = append(where, "m.timestamp < ?")
+		args = append(args, opts.Until.UnixMilli())
+	}
+	return where, args
+}
+
+// queryFTS ranks using bm25, and lets FTS5 make the snippets.
+func queryFTS(ctx context.Context, db *sql.DB, terms []string, opts Opts) ([]Match, error) {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"` // literal terms, not FTS5 syntax
+	}
+	where, args := filters(opts)
+	where = append([]string{"messages_fts MATCH ?"}, where...)
+	args = append([]interface{}{opts.Highlight[0], opts.Highlight[1], "…", snippetWords, strings.Join(quoted, " ")}, args...)
+	args = append(args, opts.Limit)
+	rows, err := db.QueryContext(ctx, `SELECT m.chat, m.sender, m.id, m.timestamp,
+			snippet(messages_fts, 0, ?, ?, ?, ?)
+		FROM messages_fts JOIN messages m ON m.rowid = messages_fts.rowid
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY bm25(messages_fts), m.timestamp DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Match
+	for rows.Next() {
+		m, _, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// queryLike finds messages with LIKE, and ranks them by the density of the terms in the text:
+// like bm25, short messages full of the terms rank first.
+func queryLike(ctx context.Context, db *sql.DB, terms []string, opts Opts) ([]Match, error) {
+	where, args := filters(opts)
+	for _, t := range terms {
+		where = append(where, `m.text LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(t)+"%")
+	}
+	rows, err := db.QueryContext(ctx, `SELECT m.chat, m.sender, m.id, m.timestamp, m.text
+		FROM messages m WHERE `+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type scored struct {
+		Match
+		score float64
+	}
+	var all []scored
+	for rows.Next() {
+		m, text, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		words := strings.Fields(text)
+		hits := 0
+		for _, w := range words {
+			if matchesAny(w, terms) {
+				hits++
+			}
+		}
+		m.Snippet = snippet(words, terms, opts.Highlight)
+		all = append(all, scored{Match: m, score: float64(hits) / float64(len(words)+1)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].score != all[j].score {
+			return all[i].score > all[j].score
+		}
+		return all[i].Timestamp.After(all[j].Timestamp)
+	})
+	var out []Match
+	for i := 0; i < len(all) && i < opts.Limit; i++ {
+		out = append(out, all[i].Match)
+	}
+	return out, nil
+}
+
+// scan reads a match; the last column is the snippet for FTS5, or the text for LIKE.
+func scan(rows *sql.Rows) (Match, string, error) {
+	var chat, sender, last string
+	var m Match
+	var ts int64
+	if err := rows.Scan(&chat, &sender, &m.ID, &ts, &last); err != nil {
+		return m, "", err
+	}
+	var err error
+	if m.Chat, err = types.ParseJID(chat); err != nil {
+		return m, "", err
+	}
+	if m.Sender, err = types.ParseJID(sender); err != nil {
+		return m, "", err
+	}
+	m.Timestamp = time.UnixMilli(ts)
+	m.Snippet = last
+	return m, last, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func matchesAny(word string, terms []string) bool {
+	for _, t := range terms {
+		if strings.Contains(strings.ToLower(word), strings.ToLower(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// snippet returns up to snippetWords words around the first matching word, with the terms
+// highlighted, and with ellipses where words are left out.
+func snippet(words []string, terms []string, hl [2]string) string {
+	first := 0
+	for i, w := range words {
+		if matchesAny(w, terms) {
+			first = i
+			break
+		}
+	}
+	start := first - 2
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetWords
+	if end > len(words) {
+		end = len(words)
+	}
+	var parts []string
+	if start > 0 {
+		parts = append(parts, "…")
+	}
+	for _, w := range words[start:end] {
+		parts = append(parts, highlight(w, terms, hl))
+	}
+	if end < len(words) {
+		parts = append(parts, "…")
+	}
+	return strings.Join(parts, " ")
+}
+
+// highlight marks the first occurrence of a term in a word.
+func highlight(word string, terms []string, hl [2]string) string {
+	lower := strings.ToLower(word)
+	for _, t := range terms {
+		if i := strings.Index(lower, strings.ToLower(t)); i >= 0 && len(lower) == len(word) {
+			j := i + len(strings.ToLower(t))
+			return word[:i] + hl[0] + word[i:j] + hl[1] + word[j:]
+		}
+	}
+	return word
+}
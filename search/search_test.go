@@ -0,0 +1,199 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/msgstore"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	alice = types.NewJID("111", types.DefaultUserServer)
+	bob   = types.NewJID("222", types.DefaultUserServer)
+	start = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func at(secs int) time.Time { return start.Add(time.Duration(secs) * time.Second) }
+
+func message(id types.MessageID, from types.JID, secs int, text string) *events.Message {
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: from, Sender: from},
+			ID:            id,
+			Timestamp:     at(secs),
+		},
+		Message: &waE2E.Message{Conversation: proto.String(text)},
+	}
+}
+
+// fixture stores a conversation. With fts, the index is created halfway, so that both the
+// initial indexing and the triggers are exercised. It returns false when FTS5 isn't available.
+func fixture(t *testing.T, fts bool) (*sql.DB, bool) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open(_) = _, %v; need nil error", err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own in-memory database
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	s, err := msgstore.New(ctx, db, msgstore.Opts{})
+	if err != nil {
+		t.Fatalf("msgstore.New(_) = _, %v; need nil error", err)
+	}
+	handle := func(ev interface{}) {
+		t.Helper()
+		if err := s.Handle(ev); err != nil {
+			t.Fatalf("Handle(%T) = %v, need nil error", ev, err)
+		}
+	}
+
+	handle(message("A1", alice, 1, "invoice 2024"))
+	handle(message("A2", alice, 2, "Here is the long overdue invoice for the work that we did together in 2024, please pay"))
+	if fts {
+		ok, err := EnsureIndex(ctx, db)
+		if err != nil {
+			t.Fatalf("EnsureIndex(_) = _, %v; need nil error", err)
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	handle(message("B1", bob, 3, "lunch?"))
+	handle(message("B2", bob, 4, "invoice 2023"))
+	handle(message("B3", bob, 5, "2024 invoice resent"))
+	handle(message("B4", bob, 6, "draft invoice 2024"))
+	handle(message("B5", bob, 7, "the INVOICE of 2024"))
+	handle(&handlers.Revoke{Target: handlers.MessageRef{Chat: bob, ID: "B3"}, ForEveryone: true, Timestamp: at(8)})
+	handle(&handlers.Edit{
+		Target:     handlers.MessageRef{Chat: bob, ID: "B4"},
+		NewContent: &waE2E.Message{Conversation: proto.String("nothing here")},
+		Timestamp:  at(9),
+	})
+	return db, true
+}
+
+func TestQuery(t *testing.T) {
+	for _, mode := range []struct {
+		name string
+		fts  bool
+	}{
+		{"fts5", true},
+		{"like", false},
+	} {
+		t.Run(mode.name, func(t *testing.T) {
+			db, ok := fixture(t, mode.fts)
+			if !ok {
+				t.Skip("the SQLite driver lacks FTS5, build with -tags sqlite_fts5")
+			}
+			for _, test := range []struct {
+				description string
+				q           string
+				opts        Opts
+				want        []types.MessageID
+			}{
+				{
+					description: "ranked, shortest first",
+					q:           "invoice 2024",
+					want:        []types.MessageID{"A1", "B5", "A2"},
+				},
+				{
+					description: "limited",
+					q:           "invoice 2024",
+					opts:        Opts{Limit: 1},
+					want:        []types.MessageID{"A1"},
+				},
+				{
+					description: "in a chat",
+					q:           "invoice 2024",
+					opts:        Opts{Chat: bob},
+					want:        []types.MessageID{"B5"},
+				},
+				{
+					description: "by a sender",
+					q:           "invoice 2024",
+					opts:        Opts{Sender: alice},
+					want:        []types.MessageID{"A1", "A2"},
+				},
+				{
+					description: "in a date range",
+					q:           "invoice 2024",
+					opts:        Opts{Since: at(2), Until: at(7)},
+					want:        []types.MessageID{"A2"},
+				},
+				{
+					description: "edited text is found",
+					q:           "nothing",
+					want:        []types.MessageID{"B4"},
+				},
+				{
+					description: "edited away text isn't",
+					q:           "draft",
+				},
+				{
+					description: "revoked messages aren't",
+					q:           "resent",
+				},
+				{
+					description: "empty query",
+					q:           " ",
+				},
+			} {
+				got, err := Query(context.Background(), db, test.q, test.opts)
+				if err != nil {
+					t.Fatalf("%v: Query(%q) = _, %v; need nil error", test.description, test.q, err)
+				}
+				var ids []types.MessageID
+				for _, m := range got {
+					ids = append(ids, m.ID)
+				}
+				if len(ids) != len(test.want) {
+					t.Errorf("%v: Query(%q) = %v, want %v", test.description, test.q, ids, test.want)
+					continue
+				}
+				for i := range ids {
+					if ids[i] != test.want[i] {
+						t.Errorf("%v: Query(%q) = %v, want %v", test.description, test.q, ids, test.want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSnippets(t *testing.T) {
+	for _, fts := range []bool{true, false} {
+		db, ok := fixture(t, fts)
+		if !ok {
+			continue
+		}
+		got, err := Query(context.Background(), db, "invoice 2024", Opts{Chat: bob})
+		if err != nil || len(got) != 1 {
+			t.Fatalf("Query(_) = %v, %v; want 1 match and nil error", got, err)
+		}
+		if want := "the [INVOICE] of [2024]"; got[0].Snippet != want {
+			t.Errorf("fts %v: snippet = %q, want %q", fts, got[0].Snippet, want)
+		}
+		if m := got[0]; m.Chat != bob || m.Sender != bob || !m.Timestamp.Equal(at(7)) {
+			t.Errorf("fts %v: match = %+v, want B5 of bob at %v", fts, m, at(7))
+		}
+	}
+}
+
+func TestSnippetLong(t *testing.T) {
+	words := []string{"a", "b", "c", "d", "invoice", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n"}
+	want := "… c d <invoice> e f g h i j k l m …"
+	if got := snippet(words, []string{"invoice"}, [2]string{"<", ">"}); got != want {
+		t.Errorf("snippet(_) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package send
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"golang.org/x/time/rate"
+)
+
+// Enqueuer queues a message for sending later, and returns the ID that the message will have.
+// *queue.Queue is one.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, to types.JID, msg *waE2E.Message) (types.MessageID, error)
+}
+
+// BroadcastOpts configures Broadcast.
+type BroadcastOpts struct {
+	Concurrency     int           // number of parallel sends, 1 when zero
+	PerMessageDelay time.Duration // minimum time between the starts of two sends
+	Limiter         *rate.Limiter // shared with other senders to limit the overall rate, optional
+	Queue           Enqueuer      // when set, messages are queued instead of sent, optional
+}
+
+// BroadcastResult is the outcome of sending to one recipient.
+type BroadcastResult struct {
+	To  types.JID
+	ID  types.MessageID // set when sending succeeded
+	Err error           // set when building or sending failed
+}
+
+// Broadcast sends a message to each of the recipients. The message is composed per recipient
+// by `build`. Duplicate recipients get only one message. All sends go through Message(), so
+// hooks apply.
+//
+// Each send waits for the Limiter when there is one. With a Queue, the messages are queued
+// instead of sent, and `s` isn't used. The queue sends them through Message() later. The
+// results then hold the IDs that the messages will have.
+//
+// The returned results are in the order of the recipients. Failures for one recipient don't
+// stop the broadcast; they are reported in the result for that recipient. When the context is
+// cancelled, no new sends are started, and the results so far are returned with the context's
+// error.
+func Broadcast(ctx context.Context, s Sender, recipients []types.JID, build func(to types.JID) (*waE2E.Message, error), opts BroadcastOpts) ([]BroadcastResult, error) {
+	var unique []types.JID
+	seen := map[types.JID]bool{}
+	for _, r := range recipients {
+		r = r.ToNonAD()
+		if !seen[r] {
+			seen[r] = true
+			unique = append(unique, r)
+		}
+	}
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]*BroadcastResult, len(unique))
+	todo := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range todo {
+				if ctx.Err() == nil {
+					results[n] = broadcastOne(ctx, s, unique[n], build, opts)
+				}
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for n := range unique {
+		if n > 0 && opts.PerMessageDelay > 0 {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				break feed
+			case <-time.After(opts.PerMessageDelay):
+			}
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		case todo <- n:
+		}
+	}
+	close(todo)
+	wg.Wait()
+
+	var out []BroadcastResult
+	for _, r := range results {
+		if r != nil {
+			out = append(out, *r)
+		}
+	}
+	if err == nil && len(out) < len(unique) {
+		// Cancelled while the last handed out recipients were waiting.
+		err = ctx.Err()
+	}
+	if err != nil {
+		return out, fmt.Errorf("send.Broadcast: stopped after %v of %v recipients: %w", len(out), len(unique), err)
+	}
+	return out, nil
+}
+
+func broadcastOne(ctx context.Context, s Sender, to types.JID, build func(to types.JID) (*waE2E.Message, error), opts BroadcastOpts) *BroadcastResult {
+	msg, err := build(to)
+	if err != nil {
+		return &BroadcastResult{To: to, Err: fmt.Errorf("building message: %w", err)}
+	}
+	if opts.Limiter != nil {
+		if err := opts.Limiter.Wait(ctx); err != nil {
+			return &BroadcastResult{To: to, Err: fmt.Errorf("waiting for the limiter: %w", err)}
+		}
+	}
+	if opts.Queue != nil {
+		id, err := opts.Queue.Enqueue(ctx, to, msg)
+		if err != nil {
+			return &BroadcastResult{To: to, Err: err}
+		}
+		return &BroadcastResult{To: to, ID: id}
+	}
+	resp, err := Message(ctx, s, to, msg)
+	if err != nil {
+		return &BroadcastResult{To: to, Err: err}
+	}
+	return &BroadcastResult{To: to, ID: resp.ID}
+}
@@ -0,0 +1,161 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"golang.org/x/time/rate"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeBroadcaster fails sends to recipients in `fail` and cancels after `cancelAfter` sends.
+type fakeBroadcaster struct {
+	mu          sync.Mutex
+	sends       int
+	fail        map[string]bool
+	cancelAfter int
+	cancel      context.CancelFunc
+}
+
+func (f *fakeBroadcaster) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sends++
+	if f.cancel != nil && f.sends == f.cancelAfter {
+		f.cancel()
+	}
+	if f.fail[to.User] {
+		return whatsmeow.SendResponse{}, errors.New("failed")
+	}
+	return whatsmeow.SendResponse{ID: "id-" + to.User}, nil
+}
+
+func textTo(to types.JID) (*waE2E.Message, error) {
+	return &waE2E.Message{Conversation: proto.String("hi " + to.User)}, nil
+}
+
+func jids(users ...string) []types.JID {
+	var out []types.JID
+	for _, u := range users {
+		out = append(out, types.NewJID(u, types.DefaultUserServer))
+	}
+	return out
+}
+
+func TestBroadcastPartialFailure(t *testing.T) {
+	hooks = nil
+	f := &fakeBroadcaster{fail: map[string]bool{"2": true}}
+	results, err := Broadcast(context.Background(), f, jids("1", "2", "3", "1"), textTo, BroadcastOpts{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Broadcast(_) = _, %v; need nil error", err)
+	}
+	if len(results) != 3 || f.sends != 3 {
+		t.Fatalf("Broadcast(_) = %v results after %v sends, want 3 and 3", len(results), f.sends)
+	}
+	for i, want := range []struct {
+		user    string
+		id      types.MessageID
+		wantErr bool
+	}{
+		{"1", "id-1", false},
+		{"2", "", true},
+		{"3", "id-3", false},
+	} {
+		got := results[i]
+		if got.To.User != want.user || got.ID != want.id || (got.Err != nil) != want.wantErr {
+			t.Errorf("results[%v] = %+v, want user %v, ID %q, error: %v", i, got, want.user, want.id, want.wantErr)
+		}
+	}
+}
+
+func TestBroadcastBuildError(t *testing.T) {
+	hooks = nil
+	f := &fakeBroadcaster{}
+	build := func(to types.JID) (*waE2E.Message, error) {
+		if to.User == "1" {
+			return nil, errors.New("no template")
+		}
+		return textTo(to)
+	}
+	results, err := Broadcast(context.Background(), f, jids("1", "2"), build, BroadcastOpts{})
+	if err != nil {
+		t.Fatalf("Broadcast(_) = _, %v; need nil error", err)
+	}
+	if results[0].Err == nil || results[1].Err != nil || f.sends != 1 {
+		t.Errorf("Broadcast(_) = %+v after %v sends, want only the first to fail", results, f.sends)
+	}
+}
+
+func TestBroadcastCancel(t *testing.T) {
+	hooks = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := &fakeBroadcaster{cancelAfter: 2, cancel: cancel}
+	results, err := Broadcast(ctx, f, jids("1", "2", "3", "4", "5"), textTo, BroadcastOpts{PerMessageDelay: time.Millisecond})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Broadcast(_) = _, %v; want context.Canceled", err)
+	}
+	if len(results) != 2 || results[0].To.User != "1" || results[1].To.User != "2" {
+		t.Errorf("Broadcast(_) = %+v, want results for the first 2 recipients", results)
+	}
+}
+
+// fakeEnqueuer queues messages in memory.
+type fakeEnqueuer struct {
+	mu     sync.Mutex
+	queued []types.JID
+}
+
+func (f *fakeEnqueuer) Enqueue(ctx context.Context, to types.JID, msg *waE2E.Message) (types.MessageID, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queued = append(f.queued, to)
+	if to.User == "2" {
+		return "", errors.New("queue full")
+	}
+	return "q-" + to.User, nil
+}
+
+func TestBroadcastQueue(t *testing.T) {
+	hooks = nil
+	f := &fakeBroadcaster{}
+	q := &fakeEnqueuer{}
+	results, err := Broadcast(context.Background(), f, jids("1", "2", "3"), textTo, BroadcastOpts{Queue: q})
+	if err != nil {
+		t.Fatalf("Broadcast(_) = _, %v; need nil error", err)
+	}
+	if f.sends != 0 || len(q.queued) != 3 {
+		t.Errorf("Broadcast(_) sent %v and queued %v messages, want 0 and 3", f.sends, len(q.queued))
+	}
+	for i, want := range []BroadcastResult{{ID: "q-1"}, {}, {ID: "q-3"}} {
+		if results[i].ID != want.ID || (results[i].Err != nil) != (want.ID == "") {
+			t.Errorf("result %v = %+v, want ID %q", i, results[i], want.ID)
+		}
+	}
+}
+
+func TestBroadcastLimiter(t *testing.T) {
+	hooks = nil
+	f := &fakeBroadcaster{}
+	// 50 per second with a burst of 1: the second and third sends wait 20ms each.
+	start := time.Now()
+	_, err := Broadcast(context.Background(), f, jids("1", "2", "3"), textTo, BroadcastOpts{
+		Concurrency: 3,
+		Limiter:     rate.NewLimiter(50, 1),
+	})
+	if err != nil {
+		t.Fatalf("Broadcast(_) = _, %v; need nil error", err)
+	}
+	if took := time.Since(start); took < 40*time.Millisecond {
+		t.Errorf("3 sends at 50/s took %v, want at least 40ms", took)
+	}
+	if f.sends != 3 {
+		t.Errorf("Broadcast(_) sent %v messages, want 3", f.sends)
+	}
+}
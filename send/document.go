@@ -0,0 +1,69 @@
+package send
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// DocumentOpts configures Document.
+type DocumentOpts struct {
+	FileName string // shown to the recipient and used when they save the file
+	Caption  string
+	Mimetype string // sniffed when empty, see Mimetype
+}
+
+// Document uploads and sends a file as a document, which clients offer to open or save instead
+// of showing it inline.
+func Document(ctx context.Context, u Uploader, to types.JID, doc io.Reader, opts DocumentOpts) (Response, error) {
+	data, err := io.ReadAll(doc)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Document: reading document: %w", err)
+	}
+	mimetype := opts.Mimetype
+	if mimetype == "" {
+		mimetype = Mimetype(opts.FileName, data)
+	}
+	up, err := u.Upload(ctx, data, whatsmeow.MediaDocument)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Document: uploading: %w", err)
+	}
+	dm := &waE2E.DocumentMessage{
+		URL:               proto.String(up.URL),
+		DirectPath:        proto.String(up.DirectPath),
+		MediaKey:          up.MediaKey,
+		FileEncSHA256:     up.FileEncSHA256,
+		FileSHA256:        up.FileSHA256,
+		FileLength:        proto.Uint64(up.FileLength),
+		Mimetype:          proto.String(mimetype),
+		MediaKeyTimestamp: proto.Int64(now().Unix()),
+	}
+	if opts.FileName != "" {
+		dm.FileName = proto.String(opts.FileName)
+		dm.Title = proto.String(opts.FileName)
+	}
+	if opts.Caption != "" {
+		dm.Caption = proto.String(opts.Caption)
+	}
+	return Message(ctx, u, to, &waE2E.Message{DocumentMessage: dm})
+}
+
+// Mimetype returns the mimetype of a file: by the extension of its name when that is known,
+// and otherwise by sniffing its content, which gives "application/octet-stream" when nothing
+// matches.
+func Mimetype(fileName string, data []byte) string {
+	if ext := filepath.Ext(fileName); ext != "" {
+		if mt := mime.TypeByExtension(ext); mt != "" {
+			return mt
+		}
+	}
+	return http.DetectContentType(data)
+}
@@ -0,0 +1,84 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDocument(t *testing.T) {
+	hooks = nil
+	sent := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return sent }
+	defer func() { now = time.Now }()
+	to := types.NewJID("123", types.DefaultUserServer)
+	pdf := []byte("%PDF-1.7\n...")
+
+	for _, test := range []struct {
+		description string
+		data        []byte
+		opts        DocumentOpts
+		want        *waE2E.DocumentMessage
+	}{
+		{
+			description: "mimetype by extension",
+			data:        pdf,
+			opts:        DocumentOpts{FileName: "invoice.pdf", Caption: "June"},
+			want: &waE2E.DocumentMessage{
+				Mimetype: proto.String("application/pdf"),
+				FileName: proto.String("invoice.pdf"),
+				Title:    proto.String("invoice.pdf"),
+				Caption:  proto.String("June"),
+			},
+		},
+		{
+			description: "mimetype by content",
+			data:        pdf,
+			opts:        DocumentOpts{FileName: "invoice"},
+			want: &waE2E.DocumentMessage{
+				Mimetype: proto.String("application/pdf"),
+				FileName: proto.String("invoice"),
+				Title:    proto.String("invoice"),
+			},
+		},
+		{
+			description: "unknown content",
+			data:        []byte{0, 1, 2, 3},
+			want:        &waE2E.DocumentMessage{Mimetype: proto.String("application/octet-stream")},
+		},
+		{
+			description: "given mimetype",
+			data:        pdf,
+			opts:        DocumentOpts{FileName: "invoice.pdf", Mimetype: "application/x-pdf"},
+			want: &waE2E.DocumentMessage{
+				Mimetype: proto.String("application/x-pdf"),
+				FileName: proto.String("invoice.pdf"),
+				Title:    proto.String("invoice.pdf"),
+			},
+		},
+	} {
+		f := &fakeForwarder{}
+		if _, err := Document(context.Background(), f, to, bytes.NewReader(test.data), test.opts); err != nil {
+			t.Errorf("%v: Document(_) = _, %v; need nil error", test.description, err)
+			continue
+		}
+		// The fields of the upload are the same for every document.
+		test.want.DirectPath = proto.String("/new")
+		test.want.URL = proto.String("")
+		test.want.MediaKey = []byte("newkey")
+		test.want.FileLength = proto.Uint64(uint64(len(test.data)))
+		test.want.MediaKeyTimestamp = proto.Int64(sent.Unix())
+		if got := f.sent[0].GetDocumentMessage(); !proto.Equal(got, test.want) {
+			t.Errorf("%v: sent\n%v\nwant\n%v", test.description, prototext.Format(got), prototext.Format(test.want))
+		}
+		if !bytes.Equal(f.uploaded, test.data) {
+			t.Errorf("%v: uploaded %q, want %q", test.description, f.uploaded, test.data)
+		}
+	}
+}
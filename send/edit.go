@@ -0,0 +1,100 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// EditWindow is how long after sending a message it may be edited.
+var EditWindow = 15 * time.Minute
+
+// ErrEditWindow is returned when a message is too old to be edited.
+var ErrEditWindow = errors.New("message is too old to edit")
+
+// ErrEditRefused is returned when the server refuses an edit. Typically, the message is older
+// than the EditWindow by the server's clock, while Edit couldn't tell its age.
+var ErrEditRefused = errors.New("server refused the edit")
+
+// EditRefusedCodes are the error codes by which the server refuses an edit. Other server errors,
+// such as rate limits, are returned as they are.
+var EditRefusedCodes = []int{479}
+
+// now is swapped in tests.
+var now = time.Now
+
+// Edit replaces the text of a message that was sent earlier. Only own messages can be edited,
+// and only within the EditWindow. The age of the message is taken from the time that this
+// package sent it (see SentAt) or, when it wasn't sent recently, from `original.Timestamp`. When
+// neither is known, the server decides; its refusal is an error wrapping ErrEditRefused.
+func Edit(ctx context.Context, s Sender, original handlers.MessageRef, newText string) error {
+	if !original.FromMe {
+		return fmt.Errorf("send.Edit: message %v in %v was not sent by me", original.ID, original.Chat)
+	}
+	sent, ok := SentAt(original.ID)
+	if !ok {
+		sent = original.Timestamp
+	}
+	if !sent.IsZero() {
+		if age := now().Sub(sent); age > EditWindow {
+			return fmt.Errorf("send.Edit: message %v is %v old, window is %v: %w", original.ID, age.Round(time.Second), EditWindow, ErrEditWindow)
+		}
+	}
+	_, err := Message(ctx, s, original.Chat, buildEdit(original, &waE2E.Message{
+		Conversation: proto.String(newText),
+	}))
+	if code, ok := serverErrorCode(err); ok && slices.Contains(EditRefusedCodes, code) {
+		return fmt.Errorf("send.Edit: message %v: %w: %w", original.ID, ErrEditRefused, err)
+	}
+	return err
+}
+
+// serverErrorCode returns the code of an error that the server returned for a sent message.
+// whatsmeow only puts it in the text: "server returned error 479".
+func serverErrorCode(err error) (int, bool) {
+	if !errors.Is(err, whatsmeow.ErrServerReturnedError) {
+		return 0, false
+	}
+	_, after, ok := strings.Cut(err.Error(), whatsmeow.ErrServerReturnedError.Error()+" ")
+	if !ok {
+		return 0, false
+	}
+	end := strings.IndexFunc(after, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(after)
+	}
+	code, err := strconv.Atoi(after[:end])
+	return code, err == nil
+}
+
+// buildEdit returns the protocol message that edits a message. It's the same as
+// `whatsmeow.Client.BuildEdit()`, which can't be used on a Sender.
+func buildEdit(original handlers.MessageRef, content *waE2E.Message) *waE2E.Message {
+	return &waE2E.Message{
+		EditedMessage: &waE2E.FutureProofMessage{
+			Message: &waE2E.Message{
+				ProtocolMessage: &waE2E.ProtocolMessage{
+					Key: &waCommon.MessageKey{
+						FromMe:    proto.Bool(true),
+						ID:        proto.String(original.ID),
+						RemoteJID: proto.String(original.Chat.String()),
+					},
+					Type:          waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+					EditedMessage: content,
+					TimestampMS:   proto.Int64(now().UnixMilli()),
+				},
+			},
+		},
+	}
+}
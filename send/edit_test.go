@@ -0,0 +1,132 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// TestEditWindow checks that edits past the window are refused, using the tracked send time or
+// the timestamp of the reference.
+func TestEditWindow(t *testing.T) {
+	hooks = nil
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return base }
+	defer func() { now = time.Now }()
+
+	chat := types.NewJID("123", types.DefaultUserServer)
+	recordSent(Response{ID: "tracked-old", Timestamp: base.Add(-time.Hour)})
+	recordSent(Response{ID: "tracked-new", Timestamp: base.Add(-time.Minute)})
+
+	for _, test := range []struct {
+		description string
+		ref         handlers.MessageRef
+		wantErr     error
+		wantSent    bool
+	}{
+		{
+			description: "recent by timestamp",
+			ref:         handlers.MessageRef{Chat: chat, ID: "a", FromMe: true, Timestamp: base.Add(-5 * time.Minute)},
+			wantSent:    true,
+		},
+		{
+			description: "old by timestamp",
+			ref:         handlers.MessageRef{Chat: chat, ID: "b", FromMe: true, Timestamp: base.Add(-20 * time.Minute)},
+			wantErr:     ErrEditWindow,
+		},
+		{
+			description: "old by tracked send time",
+			ref:         handlers.MessageRef{Chat: chat, ID: "tracked-old", FromMe: true},
+			wantErr:     ErrEditWindow,
+		},
+		{
+			description: "recent by tracked send time",
+			ref:         handlers.MessageRef{Chat: chat, ID: "tracked-new", FromMe: true},
+			wantSent:    true,
+		},
+		{
+			description: "tracked send time over an older timestamp",
+			ref:         handlers.MessageRef{Chat: chat, ID: "tracked-new", FromMe: true, Timestamp: base.Add(-20 * time.Minute)},
+			wantSent:    true,
+		},
+		{
+			description: "tracked send time over a newer timestamp",
+			ref:         handlers.MessageRef{Chat: chat, ID: "tracked-old", FromMe: true, Timestamp: base},
+			wantErr:     ErrEditWindow,
+		},
+		{
+			description: "unknown age",
+			ref:         handlers.MessageRef{Chat: chat, ID: "c", FromMe: true},
+			wantSent:    true,
+		},
+	} {
+		s := &fakeSender{}
+		err := Edit(context.Background(), s, test.ref, "fixed")
+		if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+			t.Errorf("%v: Edit(_) = %v, want %v", test.description, err, test.wantErr)
+		}
+		if test.wantErr == nil && err != nil {
+			t.Errorf("%v: Edit(_) = %v, need nil error", test.description, err)
+		}
+		if sent := len(s.sent) == 1; sent != test.wantSent {
+			t.Errorf("%v: sent = %v, want %v", test.description, sent, test.wantSent)
+		}
+	}
+
+	s := &fakeSender{}
+	if err := Edit(context.Background(), s, handlers.MessageRef{Chat: chat, ID: "d"}, "x"); err == nil {
+		t.Errorf("Edit(_) of someone else's message = nil, need error")
+	}
+}
+
+// TestEditProto checks the protocol message of an edit.
+func TestEditProto(t *testing.T) {
+	hooks = nil
+	chat := types.NewJID("123", types.DefaultUserServer)
+	s := &fakeSender{}
+	if err := Edit(context.Background(), s, handlers.MessageRef{Chat: chat, ID: "abc", FromMe: true}, "fixed"); err != nil {
+		t.Fatalf("Edit(_) = %v, need nil error", err)
+	}
+	pm := s.sent[0].GetEditedMessage().GetMessage().GetProtocolMessage()
+	if pm.GetType() != waE2E.ProtocolMessage_MESSAGE_EDIT {
+		t.Errorf("type = %v, want MESSAGE_EDIT", pm.GetType())
+	}
+	if pm.GetKey().GetID() != "abc" || !pm.GetKey().GetFromMe() || pm.GetKey().GetRemoteJID() != chat.String() {
+		t.Errorf("key = %v, unexpected", pm.GetKey())
+	}
+	if pm.GetEditedMessage().GetConversation() != "fixed" {
+		t.Errorf("new content = %v, want conversation %q", pm.GetEditedMessage(), "fixed")
+	}
+}
+
+// TestEditRefused checks that the server's refusal of an edit is recognizable.
+func TestEditRefused(t *testing.T) {
+	hooks = nil
+	chat := types.NewJID("123", types.DefaultUserServer)
+	ref := handlers.MessageRef{Chat: chat, ID: "old", FromMe: true}
+	for _, test := range []struct {
+		description string
+		sendErr     error
+		wantRefused bool
+	}{
+		{"edit window", fmt.Errorf("%w 479", whatsmeow.ErrServerReturnedError), true},
+		{"wrapped", fmt.Errorf("sending: %w", fmt.Errorf("%w 479", whatsmeow.ErrServerReturnedError)), true},
+		{"rate limit", fmt.Errorf("%w 429", whatsmeow.ErrServerReturnedError), false},
+		{"no code", whatsmeow.ErrServerReturnedError, false},
+		{"connection", errors.New("websocket closed"), false},
+	} {
+		f := &fakeForwarder{sendErrs: []error{test.sendErr}}
+		err := Edit(context.Background(), f, ref, "fixed")
+		if !errors.Is(err, test.sendErr) || errors.Is(err, ErrEditRefused) != test.wantRefused {
+			t.Errorf("%v: Edit(_) = %v, want the send error, wrapped in ErrEditRefused: %v", test.description, err, test.wantRefused)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/KarelKubat/whatsmeow/waiface"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrMediaExpired can be wrapped by a Sender to signal that the media of a message can no longer
+// be fetched by the recipient. The download errors 404 and 410 of whatsmeow mean the same.
+var ErrMediaExpired = errors.New("media expired")
+
+// Forwarder is what Forward needs: an Uploader that can also download media, to re-upload them.
+// `*whatsmeow.Client` is a Forwarder.
+type Forwarder interface {
+	Uploader
+	waiface.Downloader
+}
+
+// Forward sends a copy of a received message to another chat, marked as forwarded. The reply
+// context of the original is dropped. Media are sent using the existing keys and paths; when
+// these have expired, the media are downloaded and uploaded again, and sending is retried once.
+func Forward(ctx context.Context, f Forwarder, to types.JID, original *events.Message) (Response, error) {
+	if original.Message == nil {
+		return Response{}, fmt.Errorf("send.Forward: message %v has no content", original.Info.ID)
+	}
+	msg := proto.Clone(original.Message).(*waE2E.Message)
+	msg.MessageContextInfo = nil
+
+	ci := ContextInfo(msg)
+	if ci == nil {
+		return Response{}, fmt.Errorf("send.Forward: message %v can't be forwarded", original.Info.ID)
+	}
+	*ci = waE2E.ContextInfo{
+		IsForwarded:     proto.Bool(true),
+		ForwardingScore: proto.Uint32(ci.GetForwardingScore() + 1),
+		MentionedJID:    ci.GetMentionedJID(),
+	}
+
+	if m, _, _ := media(msg); m != nil && (len(m.GetMediaKey()) == 0 || m.GetDirectPath() == "") {
+		if err := reupload(ctx, f, msg); err != nil {
+			return Response{}, fmt.Errorf("send.Forward: %w", err)
+		}
+	}
+	resp, err := Message(ctx, f, to, msg)
+	if err == nil || !mediaExpired(err) {
+		return resp, err
+	}
+	if err := reupload(ctx, f, msg); err != nil {
+		return Response{}, fmt.Errorf("send.Forward: %w", err)
+	}
+	return Message(ctx, f, to, msg)
+}
+
+func mediaExpired(err error) bool {
+	return errors.Is(err, ErrMediaExpired) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410)
+}
+
+// reupload downloads the media of a message and uploads them again, updating the message.
+func reupload(ctx context.Context, f Forwarder, msg *waE2E.Message) error {
+	m, mediaType, update := media(msg)
+	if m == nil {
+		return errors.New("no media to re-upload")
+	}
+	data, err := f.Download(m)
+	if err != nil {
+		return fmt.Errorf("downloading media to re-upload: %w", err)
+	}
+	up, err := f.Upload(ctx, data, mediaType)
+	if err != nil {
+		return fmt.Errorf("re-uploading media: %w", err)
+	}
+	update(up)
+	return nil
+}
+
+// media returns the media of a message, its type and a function to update it after uploading.
+// The returned message is nil when there are no media.
+func media(msg *waE2E.Message) (whatsmeow.DownloadableMessage, whatsmeow.MediaType, func(whatsmeow.UploadResponse)) {
+	switch {
+	case msg.GetImageMessage() != nil:
+		m := msg.GetImageMessage()
+		return m, whatsmeow.MediaImage, func(up whatsmeow.UploadResponse) {
+			m.URL, m.DirectPath, m.MediaKey = proto.String(up.URL), proto.String(up.DirectPath), up.MediaKey
+			m.FileEncSHA256, m.FileSHA256, m.FileLength = up.FileEncSHA256, up.FileSHA256, proto.Uint64(up.FileLength)
+			m.MediaKeyTimestamp = nil
+		}
+	case msg.GetVideoMessage() != nil:
+		m := msg.GetVideoMessage()
+		return m, whatsmeow.MediaVideo, func(up whatsmeow.UploadResponse) {
+			m.URL, m.DirectPath, m.MediaKey = proto.String(up.URL), proto.String(up.DirectPath), up.MediaKey
+			m.FileEncSHA256, m.FileSHA256, m.FileLength = up.FileEncSHA256, up.FileSHA256, proto.Uint64(up.FileLength)
+			m.MediaKeyTimestamp = nil
+		}
+	case msg.GetAudioMessage() != nil:
+		m := msg.GetAudioMessage()
+		return m, whatsmeow.MediaAudio, func(up whatsmeow.UploadResponse) {
+			m.URL, m.DirectPath, m.MediaKey = proto.String(up.URL), proto.String(up.DirectPath), up.MediaKey
+			m.FileEncSHA256, m.FileSHA256, m.FileLength = up.FileEncSHA256, up.FileSHA256, proto.Uint64(up.FileLength)
+			m.MediaKeyTimestamp = nil
+		}
+	case msg.GetDocumentMessage() != nil:
+		m := msg.GetDocumentMessage()
+		return m, whatsmeow.MediaDocument, func(up whatsmeow.UploadResponse) {
+			m.URL, m.DirectPath, m.MediaKey = proto.String(up.URL), proto.String(up.DirectPath), up.MediaKey
+			m.FileEncSHA256, m.FileSHA256, m.FileLength = up.FileEncSHA256, up.FileSHA256, proto.Uint64(up.FileLength)
+			m.MediaKeyTimestamp = nil
+		}
+	case msg.GetStickerMessage() != nil:
+		m := msg.GetStickerMessage()
+		return m, whatsmeow.MediaImage, func(up whatsmeow.UploadResponse) {
+			m.URL, m.DirectPath, m.MediaKey = proto.String(up.URL), proto.String(up.DirectPath), up.MediaKey
+			m.FileEncSHA256, m.FileSHA256, m.FileLength = up.FileEncSHA256, up.FileSHA256, proto.Uint64(up.FileLength)
+			m.MediaKeyTimestamp = nil
+		}
+	}
+	return nil, "", nil
+}
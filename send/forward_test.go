@@ -0,0 +1,137 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeForwarder is a fakeSender that fails the first sends with sendErrs, and that can
+// download and upload.
+type fakeForwarder struct {
+	fakeSender
+	sendErrs  []error
+	downloads int
+	uploads   int
+	uploaded  []byte
+}
+
+func (f *fakeForwarder) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if len(f.sendErrs) > 0 {
+		err := f.sendErrs[0]
+		f.sendErrs = f.sendErrs[1:]
+		return whatsmeow.SendResponse{}, err
+	}
+	return f.fakeSender.SendMessage(ctx, to, msg, extra...)
+}
+
+func (f *fakeForwarder) Download(msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	f.downloads++
+	return []byte("image"), nil
+}
+
+func (f *fakeForwarder) Upload(ctx context.Context, data []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	f.uploads++
+	f.uploaded = data
+	return whatsmeow.UploadResponse{DirectPath: "/new", MediaKey: []byte("newkey"), FileLength: uint64(len(data))}, nil
+}
+
+func imageEvent() *events.Message {
+	return &events.Message{
+		Message: &waE2E.Message{
+			ImageMessage: &waE2E.ImageMessage{
+				Caption:    proto.String("look"),
+				DirectPath: proto.String("/old"),
+				MediaKey:   []byte("oldkey"),
+				ContextInfo: &waE2E.ContextInfo{
+					StanzaID:        proto.String("quoted"),
+					QuotedMessage:   &waE2E.Message{Conversation: proto.String("earlier")},
+					ForwardingScore: proto.Uint32(2),
+				},
+			},
+		},
+	}
+}
+
+func TestForwardText(t *testing.T) {
+	hooks = nil
+	to := types.NewJID("123", types.DefaultUserServer)
+	f := &fakeForwarder{}
+	original := &events.Message{Message: &waE2E.Message{Conversation: proto.String("hello")}}
+	if _, err := Forward(context.Background(), f, to, original); err != nil {
+		t.Fatalf("Forward(_) = %v, need nil error", err)
+	}
+	got := f.sent[0].GetExtendedTextMessage()
+	if got.GetText() != "hello" || !got.GetContextInfo().GetIsForwarded() || got.GetContextInfo().GetForwardingScore() != 1 {
+		t.Errorf("Forward(_) sent %v, want forwarded text", f.sent[0])
+	}
+	if original.Message.GetConversation() != "hello" || original.Message.GetExtendedTextMessage() != nil {
+		t.Errorf("Forward(_) modified the original: %v", original.Message)
+	}
+}
+
+func TestForwardMedia(t *testing.T) {
+	hooks = nil
+	to := types.NewJID("123", types.DefaultUserServer)
+
+	for _, test := range []struct {
+		description string
+		sendErrs    []error
+		wantErr     bool
+		wantUploads int
+		wantPath    string
+	}{
+		{
+			description: "valid media are reused",
+			wantPath:    "/old",
+		},
+		{
+			description: "expired media are re-uploaded",
+			sendErrs:    []error{fmt.Errorf("server says: %w", ErrMediaExpired)},
+			wantUploads: 1,
+			wantPath:    "/new",
+		},
+		{
+			description: "other errors are not retried",
+			sendErrs:    []error{errors.New("boom")},
+			wantErr:     true,
+		},
+		{
+			description: "retrying happens once",
+			sendErrs:    []error{ErrMediaExpired, ErrMediaExpired},
+			wantErr:     true,
+			wantUploads: 1,
+		},
+	} {
+		f := &fakeForwarder{sendErrs: test.sendErrs}
+		original := imageEvent()
+		_, err := Forward(context.Background(), f, to, original)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%v: Forward(_) = %v, want error: %v", test.description, err, test.wantErr)
+		}
+		if f.uploads != test.wantUploads {
+			t.Errorf("%v: %v uploads, want %v", test.description, f.uploads, test.wantUploads)
+		}
+		if test.wantErr {
+			continue
+		}
+		img := f.sent[0].GetImageMessage()
+		if img.GetDirectPath() != test.wantPath || img.GetCaption() != "look" {
+			t.Errorf("%v: sent %v, want path %q", test.description, img, test.wantPath)
+		}
+		ci := img.GetContextInfo()
+		if !ci.GetIsForwarded() || ci.GetForwardingScore() != 3 || ci.GetStanzaID() != "" || ci.GetQuotedMessage() != nil {
+			t.Errorf("%v: context info %v, want forwarded with score 3 and no reply", test.description, ci)
+		}
+		if original.Message.GetImageMessage().GetDirectPath() != "/old" {
+			t.Errorf("%v: Forward(_) modified the original", test.description)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	_ "image/png" // register PNG decoding
+	"io"
+
+	"github.com/KarelKubat/whatsmeow/sticker"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register WebP decoding
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrAnimated is returned when an image is animated; send these as video or sticker instead.
+var ErrAnimated = errors.New("animated images are not supported")
+
+// ErrImageTooLarge is returned when an image can't be recompressed to fit the byte budget.
+var ErrImageTooLarge = errors.New("image can't be made small enough")
+
+// ImageOpts configures Image.
+type ImageOpts struct {
+	Caption         string
+	MaxDimension    int   // when set, larger images are downscaled to fit MaxDimension x MaxDimension
+	MaxEncodedBytes int64 // when set, larger images are recompressed to fit
+}
+
+// Quality range for recompressing images.
+const (
+	minJPEGQuality = 40
+	maxJPEGQuality = 92
+)
+
+// Image uploads and sends a JPEG, PNG, GIF or WebP image, with a thumbnail that clients show
+// while downloading. When the image exceeds the limits in `opts`, it is downscaled and/or
+// re-encoded as JPEG. Re-encoding drops the EXIF, so the EXIF orientation is applied to the
+// pixels. Images that fit are sent as-is.
+func Image(ctx context.Context, u Uploader, to types.JID, img io.Reader, opts ImageOpts) (Response, error) {
+	data, err := io.ReadAll(img)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Image: reading image: %w", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Image: %w", err)
+	}
+	if animated(data, format) {
+		return Response{}, fmt.Errorf("send.Image: %w", ErrAnimated)
+	}
+	mimetype := "image/" + format
+	width, height := cfg.Width, cfg.Height
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	var out image.Image // the image as sent, when it was decoded
+
+	tooWide := opts.MaxDimension > 0 && (width > opts.MaxDimension || height > opts.MaxDimension)
+	tooLarge := opts.MaxEncodedBytes > 0 && int64(len(data)) > opts.MaxEncodedBytes
+	if tooWide || tooLarge {
+		data, out, err = recompress(data, orientation, opts.MaxDimension, opts.MaxEncodedBytes)
+		if err != nil {
+			return Response{}, fmt.Errorf("send.Image: %w", err)
+		}
+		mimetype = "image/jpeg"
+		width, height = out.Bounds().Dx(), out.Bounds().Dy()
+	}
+
+	up, err := u.Upload(ctx, data, whatsmeow.MediaImage)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Image: uploading: %w", err)
+	}
+	im := &waE2E.ImageMessage{
+		URL:               proto.String(up.URL),
+		DirectPath:        proto.String(up.DirectPath),
+		MediaKey:          up.MediaKey,
+		FileEncSHA256:     up.FileEncSHA256,
+		FileSHA256:        up.FileSHA256,
+		FileLength:        proto.Uint64(up.FileLength),
+		Mimetype:          proto.String(mimetype),
+		Width:             proto.Uint32(uint32(width)),
+		Height:            proto.Uint32(uint32(height)),
+		MediaKeyTimestamp: proto.Int64(now().Unix()),
+	}
+	if opts.Caption != "" {
+		im.Caption = proto.String(opts.Caption)
+	}
+	if out == nil {
+		if out, _, err = image.Decode(bytes.NewReader(data)); err == nil {
+			out = orient(out, orientation)
+		}
+	}
+	if out != nil {
+		// Without a thumbnail, clients show a grey box, so that's no reason to fail.
+		im.JPEGThumbnail, _ = thumbnail(out)
+	}
+	return Message(ctx, u, to, &waE2E.Message{ImageMessage: im})
+}
+
+// animated returns true for animated GIFs, PNGs and WebPs.
+func animated(data []byte, format string) bool {
+	switch format {
+	case "gif":
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		return err == nil && len(g.Image) > 1
+	case "png":
+		// APNG has an acTL chunk before the image data.
+		i := bytes.Index(data, []byte("IDAT"))
+		return i > 0 && bytes.Contains(data[:i], []byte("acTL"))
+	case "webp":
+		info, err := sticker.Inspect(data)
+		return err == nil && info.Animated
+	}
+	return false
+}
+
+// recompress decodes an image, fits it into maxDim, applies the orientation and encodes it as
+// JPEG with the highest quality that fits maxBytes. When even the lowest quality is too large,
+// the image is shrunk further.
+func recompress(data []byte, orientation int, maxDim int, maxBytes int64) ([]byte, image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	b := img.Bounds()
+	longest := b.Dx()
+	if b.Dy() > longest {
+		longest = b.Dy()
+	}
+	if maxDim <= 0 || maxDim > longest {
+		maxDim = longest
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		out := orient(resize(img, maxDim), orientation)
+		enc, err := encodeJPEG(out, maxBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if enc != nil {
+			return enc, out, nil
+		}
+		maxDim = maxDim * 3 / 4
+	}
+	return nil, nil, fmt.Errorf("%v bytes: %w", maxBytes, ErrImageTooLarge)
+}
+
+// encodeJPEG searches for the highest quality whose encoding fits maxBytes. It returns nil
+// when even the lowest quality doesn't fit.
+func encodeJPEG(img image.Image, maxBytes int64) ([]byte, error) {
+	encode := func(q int) ([]byte, error) {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: q})
+		return buf.Bytes(), err
+	}
+	best, err := encode(maxJPEGQuality)
+	if err != nil || maxBytes <= 0 || int64(len(best)) <= maxBytes {
+		return best, err
+	}
+	best = nil
+	lo, hi := minJPEGQuality, maxJPEGQuality-1
+	for lo <= hi {
+		q := (lo + hi) / 2
+		enc, err := encode(q)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(enc)) <= maxBytes {
+			best, lo = enc, q+1
+		} else {
+			hi = q - 1
+		}
+	}
+	return best, nil
+}
+
+// resize scales an image to fit maxDim x maxDim, keeping the aspect ratio.
+func resize(img image.Image, maxDim int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxDim && h <= maxDim {
+		return img
+	}
+	nw, nh := maxDim, h*maxDim/w
+	if h > w {
+		nw, nh = w*maxDim/h, maxDim
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(nw, 1), max(nh, 1)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8) to the pixels of an image.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	swap := orientation >= 5 // orientations 5-8 transpose
+	ow, oh := w, h
+	if swap {
+		ow, oh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			out.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return out
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG, or 1 when there is none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+	for p := 2; p+4 <= len(data); {
+		if data[p] != 0xff {
+			return 1
+		}
+		marker := data[p+1]
+		n := int(binary.BigEndian.Uint16(data[p+2:]))
+		if marker == 0xda || n < 2 || p+2+n > len(data) { // start of scan: no more metadata
+			return 1
+		}
+		seg := data[p+4 : p+2+n]
+		if marker == 0xe1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(seg[6:])
+		}
+		p += 2 + n
+	}
+	return 1
+}
+
+// tiffOrientation returns the orientation tag of the first IFD of a TIFF structure.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 0 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		e := ifd + 2 + 12*i
+		if e+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[e:]) == 0x0112 { // orientation, a SHORT stored inline
+			return int(order.Uint16(tiff[e+8:]))
+		}
+	}
+	return 1
+}
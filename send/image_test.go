@@ -0,0 +1,206 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// noisy returns an image that compresses badly.
+func noisy(w, h int) image.Image {
+	r := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	r.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+func encodeJPEGFixture(t *testing.T, img image.Image, orientation int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("jpeg.Encode(_) = %v, need nil error", err)
+	}
+	data := buf.Bytes()
+	if orientation == 0 {
+		return data
+	}
+	// Insert an APP1 segment with a big-endian TIFF holding only the orientation.
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, 0, 0, 0, 0}
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(seg)+2))
+	out := append([]byte{0xff, 0xd8}, app1...)
+	out = append(out, seg...)
+	return append(out, data[2:]...)
+}
+
+func TestImage(t *testing.T) {
+	hooks = nil
+	to := types.NewJID("123", types.DefaultUserServer)
+
+	var small bytes.Buffer
+	png.Encode(&small, image.NewGray(image.Rect(0, 0, 40, 30)))
+
+	for _, test := range []struct {
+		description  string
+		data         []byte
+		opts         ImageOpts
+		wantWidth    int
+		wantHeight   int
+		wantMimetype string
+		wantMaxBytes int
+		wantOriginal bool
+	}{
+		{
+			description:  "small image is sent as-is",
+			data:         small.Bytes(),
+			opts:         ImageOpts{MaxDimension: 1600, MaxEncodedBytes: 1 << 20},
+			wantWidth:    40,
+			wantHeight:   30,
+			wantMimetype: "image/png",
+			wantOriginal: true,
+		},
+		{
+			description:  "large image is downscaled",
+			data:         encodeJPEGFixture(t, noisy(2000, 1000), 0),
+			opts:         ImageOpts{MaxDimension: 800},
+			wantWidth:    800,
+			wantHeight:   400,
+			wantMimetype: "image/jpeg",
+		},
+		{
+			description:  "heavy image is recompressed",
+			data:         encodeJPEGFixture(t, noisy(500, 500), 0),
+			opts:         ImageOpts{MaxEncodedBytes: 60000},
+			wantMimetype: "image/jpeg",
+			wantMaxBytes: 60000,
+		},
+		{
+			description:  "orientation is baked in",
+			data:         encodeJPEGFixture(t, noisy(400, 200), 6),
+			opts:         ImageOpts{MaxDimension: 100},
+			wantWidth:    50,
+			wantHeight:   100,
+			wantMimetype: "image/jpeg",
+		},
+	} {
+		f := &fakeForwarder{}
+		if _, err := Image(context.Background(), f, to, bytes.NewReader(test.data), test.opts); err != nil {
+			t.Errorf("%v: Image(_) = _, %v; need nil error", test.description, err)
+			continue
+		}
+		im := f.sent[0].GetImageMessage()
+		if im.GetMimetype() != test.wantMimetype {
+			t.Errorf("%v: mimetype = %q, want %q", test.description, im.GetMimetype(), test.wantMimetype)
+		}
+		if test.wantOriginal && !bytes.Equal(f.uploaded, test.data) {
+			t.Errorf("%v: uploaded data differs from the original", test.description)
+		}
+		if test.wantMaxBytes > 0 && len(f.uploaded) > test.wantMaxBytes {
+			t.Errorf("%v: uploaded %v bytes, want at most %v", test.description, len(f.uploaded), test.wantMaxBytes)
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(f.uploaded))
+		if err != nil {
+			t.Errorf("%v: uploaded image doesn't decode: %v", test.description, err)
+			continue
+		}
+		if int(im.GetWidth()) != cfg.Width || int(im.GetHeight()) != cfg.Height {
+			t.Errorf("%v: proto says %vx%v, image is %vx%v", test.description, im.GetWidth(), im.GetHeight(), cfg.Width, cfg.Height)
+		}
+		if test.wantWidth > 0 && (cfg.Width != test.wantWidth || cfg.Height != test.wantHeight) {
+			t.Errorf("%v: image is %vx%v, want %vx%v", test.description, cfg.Width, cfg.Height, test.wantWidth, test.wantHeight)
+		}
+		thumb, err := jpeg.DecodeConfig(bytes.NewReader(im.GetJPEGThumbnail()))
+		if err != nil || thumb.Width > ThumbnailSize || thumb.Height > ThumbnailSize || (thumb.Width > thumb.Height) != (cfg.Width > cfg.Height) {
+			t.Errorf("%v: thumbnail is %vx%v, %v, want a JPEG of at most %v shaped like the %vx%v image", test.description, thumb.Width, thumb.Height, err, ThumbnailSize, cfg.Width, cfg.Height)
+		}
+	}
+}
+
+func TestImageOrientation(t *testing.T) {
+	// A 2x1 image with a red left and blue right pixel, rotated 90 degrees clockwise,
+	// becomes 1x2 with red on top.
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 0xff, A: 0xff})
+	img.Set(1, 0, color.RGBA{B: 0xff, A: 0xff})
+	out := orient(img, 6)
+	if b := out.Bounds(); b.Dx() != 1 || b.Dy() != 2 {
+		t.Fatalf("orient(_, 6) is %vx%v, want 1x2", b.Dx(), b.Dy())
+	}
+	if r, _, _, _ := out.At(0, 0).RGBA(); r != 0xffff {
+		t.Errorf("orient(_, 6) top pixel = %v, want red", out.At(0, 0))
+	}
+	if o := jpegOrientation(encodeJPEGFixture(t, img, 6)); o != 6 {
+		t.Errorf("jpegOrientation(_) = %v, want 6", o)
+	}
+}
+
+func TestJPEGOrientationMalformed(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		data        []byte
+	}{
+		{
+			description: "segment length 0",
+			data:        []byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x00, 0xff, 0xd9},
+		},
+		{
+			description: "segment length 1",
+			data:        []byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01, 0xff, 0xd9},
+		},
+		{
+			description: "segment beyond the data",
+			data:        []byte{0xff, 0xd8, 0xff, 0xe1, 0x10, 0x00, 0xff},
+		},
+		{
+			description: "EXIF with an IFD beyond the data",
+			data:        append([]byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x10}, "Exif\x00\x00MM\x00\x2a\xff\xff\xff\xff"...),
+		},
+	} {
+		if o := jpegOrientation(test.data); o != 1 {
+			t.Errorf("%v: jpegOrientation(_) = %v, want 1", test.description, o)
+		}
+	}
+}
+
+func FuzzJPEGOrientation(f *testing.F) {
+	f.Add([]byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01})
+	f.Add(append([]byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x10}, "Exif\x00\x00II\x2a\x00\x08\x00\x00\x00"...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		jpegOrientation(data) // must not panic
+	})
+}
+
+func TestImageAnimated(t *testing.T) {
+	hooks = nil
+	to := types.NewJID("123", types.DefaultUserServer)
+	pal := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{
+		Image: []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 4, 4), pal), image.NewPaletted(image.Rect(0, 0, 4, 4), pal)},
+		Delay: []int{10, 10},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("gif.EncodeAll(_) = %v, need nil error", err)
+	}
+	f := &fakeForwarder{}
+	if _, err := Image(context.Background(), f, to, &buf, ImageOpts{}); !errors.Is(err, ErrAnimated) {
+		t.Errorf("Image(animated gif) = _, %v; want ErrAnimated", err)
+	}
+	if f.uploads != 0 {
+		t.Errorf("Image(animated gif) uploaded")
+	}
+}
@@ -0,0 +1,67 @@
+package send
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Limits to the options of a poll, as WhatsApp enforces them.
+const (
+	MinPollOptions = 2
+	MaxPollOptions = 12
+)
+
+// Poll sends a poll to a chat. Voters may select up to `selectableCount` of the options; zero
+// means any number of them. The options must be distinct, since votes refer to them by a hash of
+// their text. See package polls for following the votes.
+//
+//	resp, err := send.Poll(ctx, client, chat, "Lunch?", []string{"pizza", "sushi", "salad"}, 1)
+func Poll(ctx context.Context, s Sender, chat types.JID, question string, options []string, selectableCount int) (Response, error) {
+	msg, err := buildPoll(question, options, selectableCount)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Poll: %w", err)
+	}
+	return Message(ctx, s, chat, msg)
+}
+
+// buildPoll returns the message that Poll sends. Like whatsmeow's Client.BuildPollCreation, it
+// carries a fresh message secret, from which the voters derive the key to encrypt their votes.
+func buildPoll(question string, options []string, selectableCount int) (*waE2E.Message, error) {
+	if question == "" {
+		return nil, fmt.Errorf("empty question")
+	}
+	if len(options) < MinPollOptions || len(options) > MaxPollOptions {
+		return nil, fmt.Errorf("%d options, need %d to %d", len(options), MinPollOptions, MaxPollOptions)
+	}
+	if selectableCount < 0 || selectableCount > len(options) {
+		return nil, fmt.Errorf("%d selectable options out of %d", selectableCount, len(options))
+	}
+	seen := map[string]bool{}
+	pm := &waE2E.PollCreationMessage{
+		Name:                   proto.String(question),
+		SelectableOptionsCount: proto.Uint32(uint32(selectableCount)),
+	}
+	for _, o := range options {
+		switch {
+		case o == "":
+			return nil, fmt.Errorf("empty option")
+		case seen[o]:
+			return nil, fmt.Errorf("duplicate option %q", o)
+		}
+		seen[o] = true
+		pm.Options = append(pm.Options, &waE2E.PollCreationMessage_Option{OptionName: proto.String(o)})
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generating the message secret: %w", err)
+	}
+	return &waE2E.Message{
+		PollCreationMessage: pm,
+		MessageContextInfo:  &waE2E.MessageContextInfo{MessageSecret: secret},
+	}, nil
+}
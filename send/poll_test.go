@@ -0,0 +1,55 @@
+package send
+
+import (
+	"context"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPoll(t *testing.T) {
+	hooks = nil
+	chat := types.NewJID("120363000000000000", types.GroupServer)
+	s := &fakeSender{}
+	if _, err := Poll(context.Background(), s, chat, "Lunch?", []string{"pizza", "sushi"}, 1); err != nil {
+		t.Fatalf("Poll(_) = _, %v; need nil error", err)
+	}
+	got := s.sent[0]
+	if n := len(got.GetMessageContextInfo().GetMessageSecret()); n != 32 {
+		t.Errorf("message secret of %d bytes, want 32", n)
+	}
+	want := &waE2E.PollCreationMessage{
+		Name: proto.String("Lunch?"),
+		Options: []*waE2E.PollCreationMessage_Option{
+			{OptionName: proto.String("pizza")},
+			{OptionName: proto.String("sushi")},
+		},
+		SelectableOptionsCount: proto.Uint32(1),
+	}
+	if !proto.Equal(got.GetPollCreationMessage(), want) {
+		t.Errorf("sent\n%v\nwant\n%v", prototext.Format(got.GetPollCreationMessage()), prototext.Format(want))
+	}
+
+	for _, test := range []struct {
+		description     string
+		question        string
+		options         []string
+		selectableCount int
+	}{
+		{description: "no question", options: []string{"a", "b"}},
+		{description: "one option", question: "?", options: []string{"a"}},
+		{description: "too many options", question: "?", options: []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13"}},
+		{description: "duplicate option", question: "?", options: []string{"a", "b", "a"}},
+		{description: "empty option", question: "?", options: []string{"a", ""}},
+		{description: "too many selectable", question: "?", options: []string{"a", "b"}, selectableCount: 3},
+		{description: "negative selectable", question: "?", options: []string{"a", "b"}, selectableCount: -1},
+	} {
+		s := &fakeSender{}
+		if _, err := Poll(context.Background(), s, chat, test.question, test.options, test.selectableCount); err == nil || len(s.sent) != 0 {
+			t.Errorf("%v: Poll(_) = %v and sent %d messages, need error and none sent", test.description, err, len(s.sent))
+		}
+	}
+}
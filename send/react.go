@@ -0,0 +1,43 @@
+package send
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// React reacts to a message with an emoji, replacing an earlier reaction of mine. An empty
+// emoji removes the reaction, see RemoveReaction.
+func React(ctx context.Context, s Sender, target *events.Message, emoji string) (Response, error) {
+	return Message(ctx, s, target.Info.Chat, buildReaction(target.Info, emoji))
+}
+
+// RemoveReaction removes my reaction to a message.
+func RemoveReaction(ctx context.Context, s Sender, target *events.Message) (Response, error) {
+	return Message(ctx, s, target.Info.Chat, buildReaction(target.Info, ""))
+}
+
+// buildReaction returns the reaction to a message. The key is the same as that of
+// `whatsmeow.Client.BuildReaction()`, which can't be used on a Sender: in groups, the
+// participant identifies whose message it is.
+func buildReaction(target types.MessageInfo, emoji string) *waE2E.Message {
+	key := &waCommon.MessageKey{
+		FromMe:    proto.Bool(target.IsFromMe),
+		ID:        proto.String(target.ID),
+		RemoteJID: proto.String(target.Chat.String()),
+	}
+	if !target.IsFromMe && target.Chat.Server != types.DefaultUserServer && target.Chat.Server != types.MessengerServer {
+		key.Participant = proto.String(target.Sender.ToNonAD().String())
+	}
+	return &waE2E.Message{
+		ReactionMessage: &waE2E.ReactionMessage{
+			Key:               key,
+			Text:              proto.String(emoji),
+			SenderTimestampMS: proto.Int64(now().UnixMilli()),
+		},
+	}
+}
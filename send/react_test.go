@@ -0,0 +1,101 @@
+package send
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestReact(t *testing.T) {
+	hooks = nil
+	sent := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return sent }
+	defer func() { now = time.Now }()
+
+	me := types.NewJID("1", types.DefaultUserServer)
+	other := types.NewJID("2", types.DefaultUserServer)
+	group := types.NewJID("4", types.GroupServer)
+	received := func(chat, sender types.JID, id string) *events.Message {
+		return &events.Message{Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: sender, IsFromMe: sender == me, IsGroup: chat == group},
+			ID:            id,
+		}}
+	}
+
+	for _, test := range []struct {
+		description     string
+		target          *events.Message
+		emoji           string
+		wantFromMe      bool
+		wantParticipant string
+		// What the other party sees, see handlers.AsReaction.
+		wantTarget handlers.MessageRef
+	}{
+		{
+			description: "their message in a DM",
+			target:      received(other, types.NewADJID(other.User, 0, 3), "a"),
+			emoji:       "👍",
+			wantTarget:  handlers.MessageRef{Chat: me, ID: "a", FromMe: true},
+		},
+		{
+			description: "my message in a DM",
+			target:      received(other, me, "b"),
+			emoji:       "🙈",
+			wantFromMe:  true,
+			wantTarget:  handlers.MessageRef{Chat: me, Sender: me, ID: "b"},
+		},
+		{
+			description:     "their message in a group",
+			target:          received(group, types.NewADJID(other.User, 0, 3), "c"),
+			emoji:           "🎉",
+			wantParticipant: other.String(),
+			wantTarget:      handlers.MessageRef{Chat: group, Sender: other, ID: "c"},
+		},
+		{
+			description: "my message in a group",
+			target:      received(group, me, "d"),
+			wantFromMe:  true,
+			wantTarget:  handlers.MessageRef{Chat: group, Sender: me, ID: "d"},
+		},
+	} {
+		s := &fakeSender{}
+		var err error
+		if test.emoji == "" {
+			_, err = RemoveReaction(context.Background(), s, test.target)
+		} else {
+			_, err = React(context.Background(), s, test.target, test.emoji)
+		}
+		if err != nil {
+			t.Errorf("%v: React(_) = _, %v; need nil error", test.description, err)
+			continue
+		}
+		if s.to[0] != test.target.Info.Chat {
+			t.Errorf("%v: sent to %v, want %v", test.description, s.to[0], test.target.Info.Chat)
+		}
+		rm := s.sent[0].GetReactionMessage()
+		key := rm.GetKey()
+		if key.GetID() != test.target.Info.ID || key.GetFromMe() != test.wantFromMe || key.GetParticipant() != test.wantParticipant ||
+			key.GetRemoteJID() != test.target.Info.Chat.String() || rm.GetText() != test.emoji || rm.GetSenderTimestampMS() != sent.UnixMilli() {
+			t.Errorf("%v: sent %v, unexpected", test.description, rm)
+		}
+
+		// The other party receives it in their chat with me, or in the group.
+		chat := test.target.Info.Chat
+		if chat.Server != types.GroupServer {
+			chat = me
+		}
+		r, ok := handlers.AsReaction(&events.Message{
+			Info:    types.MessageInfo{MessageSource: types.MessageSource{Chat: chat, Sender: me, IsGroup: chat == group}},
+			Message: &waE2E.Message{ReactionMessage: rm},
+		})
+		if !ok || r.Target != test.wantTarget || r.Removed != (test.emoji == "") {
+			t.Errorf("%v: the other party sees %+v, want target %+v", test.description, r, test.wantTarget)
+		}
+	}
+}
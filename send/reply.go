@@ -0,0 +1,89 @@
+package send
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/KarelKubat/whatsmeow/msgkind"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// placeholder matches the mention placeholders in a reply: @{1} is the first mention.
+var placeholder = regexp.MustCompile(`@\{(\d+)\}`)
+
+// ReplyText sends a text to a chat that quotes a received message, and mentions users. In the
+// text, @{1} stands for the first mention, @{2} for the second, etc.; they become the "@number"
+// that WhatsApp shows as the name of the user. Mentions that have no placeholder are highlighted
+// where the text has their "@number" already. When `quoting` is nil, the text quotes nothing.
+//
+// `to` is normally the chat of the quoted message. Replying to a group message in a DM, i.e.
+// replying privately, works too: the quote then refers to the group.
+//
+//	send.ReplyText(ctx, client, msg.Info.Chat, "@{1}, noted", msg, msg.Info.Sender)
+func ReplyText(ctx context.Context, s Sender, to types.JID, text string, quoting *events.Message, mentions ...types.JID) (Response, error) {
+	msg, err := buildReply(to, text, quoting, mentions)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.ReplyText: %w", err)
+	}
+	return Message(ctx, s, to, msg)
+}
+
+// buildReply returns the message that ReplyText sends.
+func buildReply(to types.JID, text string, quoting *events.Message, mentions []types.JID) (*waE2E.Message, error) {
+	var bad error
+	text = placeholder.ReplaceAllStringFunc(text, func(p string) string {
+		n, err := strconv.Atoi(placeholder.FindStringSubmatch(p)[1])
+		if err != nil || n < 1 || n > len(mentions) {
+			bad = fmt.Errorf("placeholder %v: there are %d mentions", p, len(mentions))
+			return p
+		}
+		return "@" + mentions[n-1].User
+	})
+	if bad != nil {
+		return nil, bad
+	}
+
+	ci := &waE2E.ContextInfo{}
+	seen := map[types.JID]bool{}
+	for _, m := range mentions {
+		if m = m.ToNonAD(); !seen[m] {
+			seen[m] = true
+			ci.MentionedJID = append(ci.MentionedJID, m.String())
+		}
+	}
+	if quoting != nil {
+		ci.StanzaID = proto.String(quoting.Info.ID)
+		ci.Participant = proto.String(quoting.Info.Sender.ToNonAD().String())
+		if quoting.Info.Chat.ToNonAD() != to.ToNonAD() {
+			ci.RemoteJID = proto.String(quoting.Info.Chat.String())
+		}
+		ci.QuotedMessage = quoted(quoting.Message)
+	}
+	return &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+		Text:        proto.String(text),
+		ContextInfo: ci,
+	}}, nil
+}
+
+// quoted returns the content of a message as it's quoted: without the wrappers, the quote of the
+// message itself, and the message secrets.
+func quoted(msg *waE2E.Message) *waE2E.Message {
+	msg = msgkind.Unwrap(msg)
+	if msg == nil {
+		return nil
+	}
+	msg = proto.Clone(msg).(*waE2E.Message)
+	msg.MessageContextInfo = nil
+	if msg.Conversation == nil { // ContextInfo would make it an ExtendedTextMessage
+		if ci := ContextInfo(msg); ci != nil {
+			*ci = waE2E.ContextInfo{MentionedJID: ci.GetMentionedJID()}
+		}
+	}
+	return msg
+}
@@ -0,0 +1,147 @@
+package send
+
+import (
+	"context"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestReplyText(t *testing.T) {
+	hooks = nil
+	alice := types.NewJID("31611111111", types.DefaultUserServer)
+	bob := types.NewJID("31622222222", types.DefaultUserServer)
+	group := types.NewJID("120363000000000000", types.GroupServer)
+
+	dm := &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: alice, Sender: types.NewADJID(alice.User, 0, 3)},
+			ID:            "DM1",
+		},
+		Message: &waE2E.Message{Conversation: proto.String("can you call me?")},
+	}
+	inGroup := &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: group, Sender: types.NewADJID(bob.User, 0, 12), IsGroup: true},
+			ID:            "G1",
+		},
+		Message: &waE2E.Message{
+			EphemeralMessage: &waE2E.FutureProofMessage{Message: &waE2E.Message{
+				ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+					Text: proto.String("@31611111111 what about you?"),
+					ContextInfo: &waE2E.ContextInfo{
+						StanzaID:      proto.String("G0"),
+						MentionedJID:  []string{alice.String()},
+						QuotedMessage: &waE2E.Message{Conversation: proto.String("older")},
+					},
+				},
+				MessageContextInfo: &waE2E.MessageContextInfo{MessageSecret: []byte("secret")},
+			}},
+		},
+	}
+
+	for _, test := range []struct {
+		description string
+		to          types.JID
+		text        string
+		quoting     *events.Message
+		mentions    []types.JID
+		want        *waE2E.Message
+	}{
+		{
+			description: "DM",
+			to:          alice,
+			text:        "sure",
+			quoting:     dm,
+			want: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+				Text: proto.String("sure"),
+				ContextInfo: &waE2E.ContextInfo{
+					StanzaID:      proto.String("DM1"),
+					Participant:   proto.String(alice.String()),
+					QuotedMessage: &waE2E.Message{Conversation: proto.String("can you call me?")},
+				},
+			}},
+		},
+		{
+			description: "group, mentioning the sender",
+			to:          group,
+			text:        "@{1} I'm in, @{2} too",
+			quoting:     inGroup,
+			mentions:    []types.JID{inGroup.Info.Sender, alice, bob},
+			want: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+				Text: proto.String("@31622222222 I'm in, @31611111111 too"),
+				ContextInfo: &waE2E.ContextInfo{
+					StanzaID:     proto.String("G1"),
+					Participant:  proto.String(bob.String()),
+					MentionedJID: []string{bob.String(), alice.String()},
+					QuotedMessage: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+						Text:        proto.String("@31611111111 what about you?"),
+						ContextInfo: &waE2E.ContextInfo{MentionedJID: []string{alice.String()}},
+					}},
+				},
+			}},
+		},
+		{
+			description: "group message, replied privately",
+			to:          bob,
+			text:        "between us: yes",
+			quoting:     inGroup,
+			want: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+				Text: proto.String("between us: yes"),
+				ContextInfo: &waE2E.ContextInfo{
+					StanzaID:    proto.String("G1"),
+					Participant: proto.String(bob.String()),
+					RemoteJID:   proto.String(group.String()),
+					QuotedMessage: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+						Text:        proto.String("@31611111111 what about you?"),
+						ContextInfo: &waE2E.ContextInfo{MentionedJID: []string{alice.String()}},
+					}},
+				},
+			}},
+		},
+		{
+			description: "no quote",
+			to:          group,
+			text:        "hi @31611111111",
+			mentions:    []types.JID{alice},
+			want: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+				Text:        proto.String("hi @31611111111"),
+				ContextInfo: &waE2E.ContextInfo{MentionedJID: []string{alice.String()}},
+			}},
+		},
+	} {
+		s := &fakeSender{}
+		resp, err := ReplyText(context.Background(), s, test.to, test.text, test.quoting, test.mentions...)
+		if err != nil || resp.ID != "id" {
+			t.Errorf("%v: ReplyText(_) = %v, %v, want the response and nil error", test.description, resp, err)
+			continue
+		}
+		if len(s.sent) != 1 || s.to[0] != test.to {
+			t.Errorf("%v: sent %d messages to %v, want 1 to %v", test.description, len(s.sent), s.to, test.to)
+			continue
+		}
+		if !proto.Equal(s.sent[0], test.want) {
+			t.Errorf("%v: sent\n%v\nwant\n%v", test.description, prototext.Format(s.sent[0]), prototext.Format(test.want))
+		}
+	}
+	if inGroup.Message.GetEphemeralMessage().GetMessage().GetExtendedTextMessage().GetContextInfo().GetStanzaID() != "G0" {
+		t.Errorf("ReplyText(_) modified the quoted message")
+	}
+}
+
+func TestReplyTextBadPlaceholder(t *testing.T) {
+	hooks = nil
+	s := &fakeSender{}
+	for _, text := range []string{"@{0}", "@{2}", "@{99999999999999999999}"} {
+		if _, err := ReplyText(context.Background(), s, types.NewJID("1", types.DefaultUserServer), text, nil, types.NewJID("2", types.DefaultUserServer)); err == nil {
+			t.Errorf("ReplyText(%q) = nil for one mention, need error", text)
+		}
+	}
+	if len(s.sent) != 0 {
+		t.Errorf("sent %d messages, want none", len(s.sent))
+	}
+}
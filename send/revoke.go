@@ -0,0 +1,44 @@
+package send
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Revoke deletes a message for everyone. Own messages can be revoked in any chat. Someone else's
+// message can only be revoked in a group, and only when I'm an admin; the server enforces that.
+func Revoke(ctx context.Context, s Sender, target handlers.MessageRef) error {
+	if !target.FromMe && target.Chat.Server != types.GroupServer {
+		return fmt.Errorf("send.Revoke: message %v in %v was not sent by me and the chat is not a group", target.ID, target.Chat)
+	}
+	_, err := Message(ctx, s, target.Chat, buildRevoke(target))
+	return err
+}
+
+// buildRevoke returns the protocol message that revokes a message. It's the same as
+// `whatsmeow.Client.BuildRevoke()`, which can't be used on a Sender.
+func buildRevoke(target handlers.MessageRef) *waE2E.Message {
+	key := &waCommon.MessageKey{
+		FromMe:    proto.Bool(true),
+		ID:        proto.String(target.ID),
+		RemoteJID: proto.String(target.Chat.String()),
+	}
+	if !target.FromMe {
+		// Admin revoke.
+		key.FromMe = proto.Bool(false)
+		key.Participant = proto.String(target.Sender.ToNonAD().String())
+	}
+	return &waE2E.Message{
+		ProtocolMessage: &waE2E.ProtocolMessage{
+			Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+			Key:  key,
+		},
+	}
+}
@@ -0,0 +1,59 @@
+package send
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestRevoke(t *testing.T) {
+	hooks = nil
+	user := types.NewJID("123", types.DefaultUserServer)
+	group := types.NewJID("456", types.GroupServer)
+
+	for _, test := range []struct {
+		description     string
+		ref             handlers.MessageRef
+		wantErr         bool
+		wantFromMe      bool
+		wantParticipant string
+	}{
+		{
+			description: "own message",
+			ref:         handlers.MessageRef{Chat: user, ID: "a", FromMe: true},
+			wantFromMe:  true,
+		},
+		{
+			description:     "admin revoke in group",
+			ref:             handlers.MessageRef{Chat: group, Sender: user, ID: "b"},
+			wantParticipant: user.String(),
+		},
+		{
+			description: "someone else's message in 1:1 chat",
+			ref:         handlers.MessageRef{Chat: user, Sender: user, ID: "c"},
+			wantErr:     true,
+		},
+	} {
+		s := &fakeSender{}
+		err := Revoke(context.Background(), s, test.ref)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%v: Revoke(_) = %v, want error: %v", test.description, err, test.wantErr)
+		}
+		if test.wantErr {
+			continue
+		}
+		pm := s.sent[0].GetProtocolMessage()
+		if pm.GetType() != waE2E.ProtocolMessage_REVOKE {
+			t.Errorf("%v: type = %v, want REVOKE", test.description, pm.GetType())
+		}
+		key := pm.GetKey()
+		if key.GetID() != test.ref.ID || key.GetFromMe() != test.wantFromMe || key.GetParticipant() != test.wantParticipant ||
+			key.GetRemoteJID() != test.ref.Chat.String() || s.to[0] != test.ref.Chat {
+			t.Errorf("%v: key = %v, unexpected", test.description, key)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Package send implements helpers to compose and send messages using `go.mau.fi/whatsmeow`.
+package send
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/waiface"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Sender is the part of a `*whatsmeow.Client` that is needed to send messages. Accepting an
+// interface instead of the client makes the helpers testable.
+type Sender = waiface.Sender
+
+// Response is what the server returns for a sent message: the message ID and the timestamp.
+type Response = whatsmeow.SendResponse
+
+// Hook is invoked for every outgoing message before it is sent. A hook may modify the message
+// (e.g. to add context info), or veto sending it by returning an error.
+type Hook func(to types.JID, msg *waE2E.Message) error
+
+var hooks []Hook
+var hooksMutex sync.Mutex
+
+// AddHook adds a hook that is run for all messages that are sent by the helpers of this
+// package. Hooks run in the order of adding; when a hook returns an error, the message isn't
+// sent and the error is returned to the caller.
+func AddHook(h Hook) {
+	hooksMutex.Lock()
+	defer hooksMutex.Unlock()
+
+	hooks = append(hooks, h)
+}
+
+// AfterHook is invoked for every message after it was successfully sent.
+type AfterHook func(to types.JID, msg *waE2E.Message, resp Response)
+
+var afterHooks []AfterHook
+
+// AddAfterHook adds a hook that is run for all messages that were sent by the helpers of this
+// package, e.g. to track their delivery.
+func AddAfterHook(h AfterHook) {
+	hooksMutex.Lock()
+	defer hooksMutex.Unlock()
+
+	afterHooks = append(afterHooks, h)
+}
+
+// ErrorHook is invoked for every message that couldn't be sent, because a hook vetoed it or
+// because sending failed.
+type ErrorHook func(to types.JID, msg *waE2E.Message, err error)
+
+var errorHooks []ErrorHook
+
+// AddErrorHook adds a hook that is run for all messages that the helpers of this package
+// failed to send, e.g. to count failures.
+func AddErrorHook(h ErrorHook) {
+	hooksMutex.Lock()
+	defer hooksMutex.Unlock()
+
+	errorHooks = append(errorHooks, h)
+}
+
+// VetoError is returned by Message when a hook vetoed sending. Retrying won't help, unlike for
+// errors of sending itself. It unwraps to the error of the hook.
+type VetoError struct {
+	Err error
+}
+
+func (v *VetoError) Error() string {
+	return v.Err.Error()
+}
+
+func (v *VetoError) Unwrap() error {
+	return v.Err
+}
+
+// Message sends a composed message to a chat, after running the hooks. When a hook vetoes the
+// message, the error is a *VetoError.
+func Message(ctx context.Context, s Sender, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (Response, error) {
+	hooksMutex.Lock()
+	hks, after, failed := hooks, afterHooks, errorHooks
+	hooksMutex.Unlock()
+
+	for _, h := range hks {
+		if err := h(to, msg); err != nil {
+			for _, fh := range failed {
+				fh(to, msg, err)
+			}
+			return Response{}, &VetoError{Err: err}
+		}
+	}
+	resp, err := s.SendMessage(ctx, to, msg, extra...)
+	if err != nil {
+		for _, fh := range failed {
+			fh(to, msg, err)
+		}
+		return resp, err
+	}
+	recordSent(resp)
+	for _, h := range after {
+		h(to, msg, resp)
+	}
+	return resp, nil
+}
+
+// maxSent is the number of sent messages whose send time is remembered.
+const maxSent = 1000
+
+var (
+	sentAt      = make(map[types.MessageID]time.Time)
+	sentOrder   []types.MessageID
+	sentAtMutex sync.Mutex
+)
+
+func recordSent(resp Response) {
+	sentAtMutex.Lock()
+	defer sentAtMutex.Unlock()
+
+	if _, ok := sentAt[resp.ID]; !ok {
+		sentOrder = append(sentOrder, resp.ID)
+	}
+	sentAt[resp.ID] = resp.Timestamp
+	if len(sentOrder) > maxSent {
+		delete(sentAt, sentOrder[0])
+		sentOrder = sentOrder[1:]
+	}
+}
+
+// SentAt returns when a message was sent, if it was recently sent using this package.
+func SentAt(id types.MessageID) (time.Time, bool) {
+	sentAtMutex.Lock()
+	defer sentAtMutex.Unlock()
+	t, ok := sentAt[id]
+	return t, ok
+}
+
+// Text sends a plain text message to a chat.
+func Text(ctx context.Context, s Sender, to types.JID, text string) (Response, error) {
+	return Message(ctx, s, to, &waE2E.Message{
+		Conversation: proto.String(text),
+	})
+}
+
+// ContextInfo returns the context info of the content of a message, creating it when the
+// content can carry one. A plain `Conversation` text can't, so it is converted into an
+// `ExtendedTextMessage`. The return value is nil for content without context info, such as
+// reactions and protocol messages.
+func ContextInfo(msg *waE2E.Message) *waE2E.ContextInfo {
+	if msg.Conversation != nil {
+		msg.ExtendedTextMessage = &waE2E.ExtendedTextMessage{
+			Text: msg.Conversation,
+		}
+		msg.Conversation = nil
+	}
+	var ci **waE2E.ContextInfo
+	switch {
+	case msg.ExtendedTextMessage != nil:
+		ci = &msg.ExtendedTextMessage.ContextInfo
+	case msg.ImageMessage != nil:
+		ci = &msg.ImageMessage.ContextInfo
+	case msg.VideoMessage != nil:
+		ci = &msg.VideoMessage.ContextInfo
+	case msg.AudioMessage != nil:
+		ci = &msg.AudioMessage.ContextInfo
+	case msg.DocumentMessage != nil:
+		ci = &msg.DocumentMessage.ContextInfo
+	case msg.StickerMessage != nil:
+		ci = &msg.StickerMessage.ContextInfo
+	case msg.LocationMessage != nil:
+		ci = &msg.LocationMessage.ContextInfo
+	case msg.LiveLocationMessage != nil:
+		ci = &msg.LiveLocationMessage.ContextInfo
+	case msg.ContactMessage != nil:
+		ci = &msg.ContactMessage.ContextInfo
+	case msg.ContactsArrayMessage != nil:
+		ci = &msg.ContactsArrayMessage.ContextInfo
+	case msg.PollCreationMessage != nil:
+		ci = &msg.PollCreationMessage.ContextInfo
+	default:
+		return nil
+	}
+	if *ci == nil {
+		*ci = &waE2E.ContextInfo{}
+	}
+	return *ci
+}
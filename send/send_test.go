@@ -0,0 +1,148 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeSender captures sent messages.
+type fakeSender struct {
+	sent []*waE2E.Message
+	to   []types.JID
+}
+
+func (f *fakeSender) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	f.sent = append(f.sent, msg)
+	f.to = append(f.to, to)
+	return whatsmeow.SendResponse{ID: "id"}, nil
+}
+
+// TestHooks checks that hooks run in order and can veto sending.
+func TestHooks(t *testing.T) {
+	hooks = nil
+	defer func() { hooks = nil }()
+
+	var order []int
+	AddHook(func(to types.JID, msg *waE2E.Message) error {
+		order = append(order, 1)
+		return nil
+	})
+	AddHook(func(to types.JID, msg *waE2E.Message) error {
+		order = append(order, 2)
+		if to.User == "blocked" {
+			return errors.New("vetoed")
+		}
+		return nil
+	})
+
+	s := &fakeSender{}
+	if _, err := Text(context.Background(), s, types.NewJID("123", types.DefaultUserServer), "hi"); err != nil {
+		t.Fatalf("Text(_) = %v, need nil error", err)
+	}
+	if _, err := Text(context.Background(), s, types.NewJID("blocked", types.DefaultUserServer), "hi"); err == nil {
+		t.Fatalf("Text(_) = nil, need error from vetoing hook")
+	}
+	if len(s.sent) != 1 {
+		t.Errorf("%v messages sent, want 1", len(s.sent))
+	}
+	if want := []int{1, 2, 1, 2}; fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("hooks ran in order %v, want %v", order, want)
+	}
+}
+
+// TestAfterHooks checks that after-hooks see successful sends only.
+func TestAfterHooks(t *testing.T) {
+	hooks, afterHooks = nil, nil
+	defer func() { hooks, afterHooks = nil, nil }()
+
+	var seen []types.MessageID
+	AddAfterHook(func(to types.JID, msg *waE2E.Message, resp Response) {
+		seen = append(seen, resp.ID)
+	})
+	AddHook(func(to types.JID, msg *waE2E.Message) error {
+		if to.User == "blocked" {
+			return errors.New("vetoed")
+		}
+		return nil
+	})
+	s := &fakeSender{}
+	Text(context.Background(), s, types.NewJID("blocked", types.DefaultUserServer), "hi")
+	Text(context.Background(), s, types.NewJID("123", types.DefaultUserServer), "hi")
+	if len(seen) != 1 || seen[0] != "id" {
+		t.Errorf("after-hooks saw %v, want [id]", seen)
+	}
+}
+
+// failingSender fails every send.
+type failingSender struct{}
+
+func (failingSender) SendMessage(ctx context.Context, to types.JID, msg *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	return whatsmeow.SendResponse{}, errors.New("offline")
+}
+
+// TestErrorHooks checks that error hooks see vetoed and failed sends only.
+func TestErrorHooks(t *testing.T) {
+	hooks, errorHooks = nil, nil
+	defer func() { hooks, errorHooks = nil, nil }()
+
+	var seen []string
+	AddErrorHook(func(to types.JID, msg *waE2E.Message, err error) {
+		seen = append(seen, err.Error())
+	})
+	AddHook(func(to types.JID, msg *waE2E.Message) error {
+		if to.User == "blocked" {
+			return errors.New("vetoed")
+		}
+		return nil
+	})
+	Text(context.Background(), &fakeSender{}, types.NewJID("123", types.DefaultUserServer), "hi")
+	Text(context.Background(), &fakeSender{}, types.NewJID("blocked", types.DefaultUserServer), "hi")
+	Text(context.Background(), failingSender{}, types.NewJID("123", types.DefaultUserServer), "hi")
+	if want := []string{"vetoed", "offline"}; fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Errorf("error hooks saw %v, want %v", seen, want)
+	}
+}
+
+// TestContextInfo checks that context info can be attached to text and media.
+func TestContextInfo(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		msg         *waE2E.Message
+		wantNil     bool
+	}{
+		{
+			description: "conversation",
+			msg:         &waE2E.Message{Conversation: proto.String("hi")},
+		},
+		{
+			description: "image",
+			msg:         &waE2E.Message{ImageMessage: &waE2E.ImageMessage{}},
+		},
+		{
+			description: "reaction",
+			msg:         &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{}},
+			wantNil:     true,
+		},
+	} {
+		ci := ContextInfo(test.msg)
+		if (ci == nil) != test.wantNil {
+			t.Errorf("%v: ContextInfo(_) = %v, want nil: %v", test.description, ci, test.wantNil)
+		}
+	}
+
+	msg := &waE2E.Message{Conversation: proto.String("hi")}
+	ContextInfo(msg).Expiration = proto.Uint32(60)
+	if msg.GetExtendedTextMessage().GetText() != "hi" || msg.Conversation != nil {
+		t.Errorf("conversation not converted to extended text: %v", msg)
+	}
+	if got := msg.GetExtendedTextMessage().GetContextInfo().GetExpiration(); got != 60 {
+		t.Errorf("expiration = %v, want 60", got)
+	}
+}
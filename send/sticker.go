@@ -0,0 +1,59 @@
+package send
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/KarelKubat/whatsmeow/sticker"
+	"github.com/KarelKubat/whatsmeow/waiface"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Uploader is a Sender that can also upload media. `*whatsmeow.Client` is an Uploader.
+type Uploader interface {
+	Sender
+	waiface.Uploader
+}
+
+// StickerMeta is the pack metadata of a sticker.
+type StickerMeta = sticker.Meta
+
+// Sticker sends a WebP image as a sticker. The image must be 512x512 and small enough (see
+// package sticker). The pack and author are stored in the image. `meta.Animated` must match the
+// image.
+func Sticker(ctx context.Context, u Uploader, to types.JID, webp []byte, meta StickerMeta) (Response, error) {
+	info, err := sticker.Validate(webp)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Sticker: %w", err)
+	}
+	if info.Animated != meta.Animated {
+		return Response{}, fmt.Errorf("send.Sticker: image animated: %v, metadata says animated: %v: %w", info.Animated, meta.Animated, sticker.ErrInvalid)
+	}
+	data, err := sticker.WithMeta(webp, meta)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Sticker: %w", err)
+	}
+	up, err := u.Upload(ctx, data, whatsmeow.MediaImage)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Sticker: uploading: %w", err)
+	}
+	return Message(ctx, u, to, &waE2E.Message{
+		StickerMessage: &waE2E.StickerMessage{
+			URL:               proto.String(up.URL),
+			DirectPath:        proto.String(up.DirectPath),
+			MediaKey:          up.MediaKey,
+			FileEncSHA256:     up.FileEncSHA256,
+			FileSHA256:        up.FileSHA256,
+			FileLength:        proto.Uint64(up.FileLength),
+			Mimetype:          proto.String("image/webp"),
+			Width:             proto.Uint32(uint32(info.Width)),
+			Height:            proto.Uint32(uint32(info.Height)),
+			IsAnimated:        proto.Bool(info.Animated),
+			MediaKeyTimestamp: proto.Int64(now().Unix()),
+		},
+	})
+}
@@ -0,0 +1,66 @@
+package send
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/sticker"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// webp512 is a 512x512 lossless WebP with an empty bitstream.
+var webp512 = []byte{
+	'R', 'I', 'F', 'F', 18, 0, 0, 0, 'W', 'E', 'B', 'P',
+	'V', 'P', '8', 'L', 5, 0, 0, 0, 0x2f, 0xff, 0xc1, 0x7f, 0x10, 0,
+}
+
+func TestSticker(t *testing.T) {
+	hooks = nil
+	to := types.NewJID("123", types.DefaultUserServer)
+
+	for _, test := range []struct {
+		description string
+		webp        []byte
+		meta        StickerMeta
+		wantErr     bool
+	}{
+		{
+			description: "valid",
+			webp:        webp512,
+			meta:        StickerMeta{Pack: "Cats", Author: "Karel"},
+		},
+		{
+			description: "not animated",
+			webp:        webp512,
+			meta:        StickerMeta{Pack: "Cats", Animated: true},
+			wantErr:     true,
+		},
+		{
+			description: "garbage",
+			webp:        []byte("GIF89a"),
+			wantErr:     true,
+		},
+	} {
+		f := &fakeForwarder{}
+		_, err := Sticker(context.Background(), f, to, test.webp, test.meta)
+		if test.wantErr {
+			if !errors.Is(err, sticker.ErrInvalid) {
+				t.Errorf("%v: Sticker(_) = _, %v; want ErrInvalid", test.description, err)
+			}
+			if f.uploads != 0 || len(f.sent) != 0 {
+				t.Errorf("%v: Sticker(_) uploaded or sent an invalid sticker", test.description)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: Sticker(_) = _, %v; need nil error", test.description, err)
+			continue
+		}
+		sm := f.sent[0].GetStickerMessage()
+		if sm.GetDirectPath() != "/new" || sm.GetMimetype() != "image/webp" || sm.GetWidth() != 512 || sm.GetHeight() != 512 {
+			t.Errorf("%v: Sticker(_) sent %v, unexpected", test.description, sm)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"os/exec"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// ThumbnailSize is the maximum width and height of the thumbnail of an image or video.
+const ThumbnailSize = 100
+
+// Thumbnailer returns a JPEG still of a video.
+type Thumbnailer interface {
+	Thumbnail(ctx context.Context, r io.Reader) ([]byte, error)
+}
+
+// VideoOpts configures Video.
+type VideoOpts struct {
+	Caption     string
+	Mimetype    string       // "video/mp4" when empty
+	Thumbnailer Thumbnailer  // NoThumbnailer when nil
+	Log         waLog.Logger // when set, thumbnail failures are logged as warnings
+}
+
+// NoThumbnailer doesn't make thumbnails; clients show a grey box instead.
+type NoThumbnailer struct{}
+
+// Thumbnail implements Thumbnailer.
+func (NoThumbnailer) Thumbnail(ctx context.Context, r io.Reader) ([]byte, error) {
+	return nil, nil
+}
+
+// FFmpegThumbnailer runs `ffmpeg` to grab the first frame of a video.
+type FFmpegThumbnailer struct {
+	Path string // path to ffmpeg, "ffmpeg" (looked up in $PATH) when empty
+}
+
+// Thumbnail implements Thumbnailer.
+func (f FFmpegThumbnailer) Thumbnail(ctx context.Context, r io.Reader) ([]byte, error) {
+	// Many MP4s have their index at the end, so ffmpeg can't read them from a pipe.
+	tmp, err := os.CreateTemp("", "thumbnail-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	path := f.Path
+	if path == "" {
+		path = "ffmpeg"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "-v", "error", "-i", tmp.Name(), "-frames:v", "1", "-f", "image2", "-c:v", "mjpeg", "pipe:1")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %v: %s", path, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Video uploads and sends a video. When a thumbnailer is configured, a downscaled thumbnail
+// is attached. Failing to make a thumbnail doesn't fail the send; the video is sent without.
+func Video(ctx context.Context, u Uploader, to types.JID, video io.Reader, opts VideoOpts) (Response, error) {
+	data, err := io.ReadAll(video)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Video: reading video: %w", err)
+	}
+	up, err := u.Upload(ctx, data, whatsmeow.MediaVideo)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.Video: uploading: %w", err)
+	}
+	mimetype := opts.Mimetype
+	if mimetype == "" {
+		mimetype = "video/mp4"
+	}
+	vm := &waE2E.VideoMessage{
+		URL:               proto.String(up.URL),
+		DirectPath:        proto.String(up.DirectPath),
+		MediaKey:          up.MediaKey,
+		FileEncSHA256:     up.FileEncSHA256,
+		FileSHA256:        up.FileSHA256,
+		FileLength:        proto.Uint64(up.FileLength),
+		Mimetype:          proto.String(mimetype),
+		MediaKeyTimestamp: proto.Int64(now().Unix()),
+	}
+	if opts.Caption != "" {
+		vm.Caption = proto.String(opts.Caption)
+	}
+	thumb, err := videoThumbnail(ctx, opts.Thumbnailer, data)
+	if err != nil && opts.Log != nil {
+		opts.Log.Warnf("send.Video: no thumbnail: %v", err)
+	}
+	vm.JPEGThumbnail = thumb
+	return Message(ctx, u, to, &waE2E.Message{VideoMessage: vm})
+}
+
+// videoThumbnail returns the downscaled thumbnail of a video, or nil.
+func videoThumbnail(ctx context.Context, t Thumbnailer, video []byte) ([]byte, error) {
+	if t == nil {
+		return nil, nil
+	}
+	jpg, err := t.Thumbnail(ctx, bytes.NewReader(video))
+	if err != nil || jpg == nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(jpg))
+	if err != nil {
+		return nil, fmt.Errorf("decoding thumbnail: %w", err)
+	}
+	return thumbnail(img)
+}
+
+// thumbnail returns an image downscaled to ThumbnailSize, as JPEG.
+func thumbnail(img image.Image) ([]byte, error) {
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, resize(img, ThumbnailSize), &jpeg.Options{Quality: 75}); err != nil {
+		return nil, fmt.Errorf("encoding thumbnail: %w", err)
+	}
+	return out.Bytes(), nil
+}
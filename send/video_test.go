@@ -0,0 +1,92 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// fakeThumbnailer returns a JPEG of the given size, or an error.
+type fakeThumbnailer struct {
+	width, height int
+	err           error
+}
+
+func (f *fakeThumbnailer) Thumbnail(ctx context.Context, r io.Reader) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, f.width, f.height)), nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func TestVideo(t *testing.T) {
+	hooks = nil
+	to := types.NewJID("123", types.DefaultUserServer)
+
+	for _, test := range []struct {
+		description string
+		thumbnailer Thumbnailer
+		wantWidth   int // of the thumbnail, 0 for none
+		wantHeight  int
+	}{
+		{
+			description: "no thumbnailer",
+		},
+		{
+			description: "no-op thumbnailer",
+			thumbnailer: NoThumbnailer{},
+		},
+		{
+			description: "landscape thumbnail is downscaled",
+			thumbnailer: &fakeThumbnailer{width: 640, height: 360},
+			wantWidth:   100,
+			wantHeight:  56,
+		},
+		{
+			description: "small thumbnail is kept",
+			thumbnailer: &fakeThumbnailer{width: 50, height: 80},
+			wantWidth:   50,
+			wantHeight:  80,
+		},
+		{
+			description: "failing thumbnailer",
+			thumbnailer: &fakeThumbnailer{err: errors.New("ffmpeg not found")},
+		},
+	} {
+		f := &fakeForwarder{}
+		opts := VideoOpts{Caption: "look", Thumbnailer: test.thumbnailer}
+		if _, err := Video(context.Background(), f, to, bytes.NewReader([]byte("video")), opts); err != nil {
+			t.Errorf("%v: Video(_) = _, %v; need nil error", test.description, err)
+			continue
+		}
+		vm := f.sent[0].GetVideoMessage()
+		if vm.GetCaption() != "look" || vm.GetMimetype() != "video/mp4" || vm.GetDirectPath() != "/new" {
+			t.Errorf("%v: Video(_) sent %v, unexpected", test.description, vm)
+		}
+		thumb := vm.GetJPEGThumbnail()
+		if test.wantWidth == 0 {
+			if thumb != nil {
+				t.Errorf("%v: Video(_) attached a thumbnail, want none", test.description)
+			}
+			continue
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+		if err != nil {
+			t.Errorf("%v: thumbnail doesn't decode: %v", test.description, err)
+			continue
+		}
+		if cfg.Width != test.wantWidth || cfg.Height != test.wantHeight {
+			t.Errorf("%v: thumbnail is %vx%v, want %vx%v", test.description, cfg.Width, cfg.Height, test.wantWidth, test.wantHeight)
+		}
+	}
+}
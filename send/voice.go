@@ -0,0 +1,184 @@
+package send
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotOpus is returned when a voice note is not Ogg/Opus. Transcoding is up to the caller.
+var ErrNotOpus = errors.New("not an Ogg/Opus stream")
+
+// VoiceMimetype is the mimetype of voice notes.
+const VoiceMimetype = "audio/ogg; codecs=opus"
+
+// WaveformSamples is the number of samples in the waveform of a voice note.
+const WaveformSamples = 64
+
+// AudioProber returns the duration of audio, and its waveform: WaveformSamples values of 0 to
+// 100, or nil when unknown. Other formats than Ogg/Opus need an external tool such as ffprobe.
+type AudioProber interface {
+	Probe(ctx context.Context, audio []byte) (duration time.Duration, waveform []byte, err error)
+}
+
+// OggOpusProber probes Ogg/Opus audio without external tools. Other audio gives an error
+// wrapping ErrNotOpus.
+type OggOpusProber struct{}
+
+// Probe implements AudioProber.
+func (OggOpusProber) Probe(ctx context.Context, audio []byte) (time.Duration, []byte, error) {
+	ogg, err := parseOggOpus(audio)
+	if err != nil {
+		return 0, nil, err
+	}
+	return ogg.duration, waveform(ogg.packetSizes), nil
+}
+
+// VoiceOpts configures VoiceNote.
+type VoiceOpts struct {
+	Waveform bool        // add the waveform of the prober, which clients show instead of a flat line
+	Mimetype string      // VoiceMimetype when empty
+	Prober   AudioProber // OggOpusProber when nil
+}
+
+// VoiceNote sends audio as a voice note (push-to-talk), with its duration and optionally a
+// waveform. WhatsApp clients play Ogg/Opus; other formats need their mimetype and a prober.
+func VoiceNote(ctx context.Context, u Uploader, to types.JID, audio io.Reader, opts VoiceOpts) (Response, error) {
+	data, err := io.ReadAll(audio)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.VoiceNote: reading audio: %w", err)
+	}
+	prober := opts.Prober
+	if prober == nil {
+		prober = OggOpusProber{}
+	}
+	duration, wf, err := prober.Probe(ctx, data)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.VoiceNote: %w", err)
+	}
+	mimetype := opts.Mimetype
+	if mimetype == "" {
+		mimetype = VoiceMimetype
+	}
+	up, err := u.Upload(ctx, data, whatsmeow.MediaAudio)
+	if err != nil {
+		return Response{}, fmt.Errorf("send.VoiceNote: uploading: %w", err)
+	}
+	am := &waE2E.AudioMessage{
+		URL:               proto.String(up.URL),
+		DirectPath:        proto.String(up.DirectPath),
+		MediaKey:          up.MediaKey,
+		FileEncSHA256:     up.FileEncSHA256,
+		FileSHA256:        up.FileSHA256,
+		FileLength:        proto.Uint64(up.FileLength),
+		Mimetype:          proto.String(mimetype),
+		PTT:               proto.Bool(true),
+		Seconds:           proto.Uint32(seconds(duration)),
+		MediaKeyTimestamp: proto.Int64(now().Unix()),
+	}
+	if opts.Waveform {
+		am.Waveform = wf
+	}
+	return Message(ctx, u, to, &waE2E.Message{AudioMessage: am})
+}
+
+// seconds rounds a duration to whole seconds, but at least 1.
+func seconds(d time.Duration) uint32 {
+	s := uint32(math.Round(d.Seconds()))
+	if s == 0 {
+		s = 1
+	}
+	return s
+}
+
+// oggOpus is what OggOpusProber needs to know about an Ogg/Opus stream.
+type oggOpus struct {
+	duration    time.Duration
+	packetSizes []int // sizes of the audio packets, without the headers
+}
+
+// parseOggOpus reads the pages of an Ogg stream. The duration is the granule position of the
+// last page minus the pre-skip in the Opus header; Opus always runs at 48kHz.
+func parseOggOpus(data []byte) (*oggOpus, error) {
+	var (
+		packets [][]byte
+		partial []byte
+		granule int64
+	)
+	for page := 0; len(data) > 0; page++ {
+		if len(data) < 27 || string(data[0:4]) != "OggS" {
+			return nil, fmt.Errorf("no Ogg page #%v: %w", page, ErrNotOpus)
+		}
+		granule = int64(binary.LittleEndian.Uint64(data[6:14]))
+		nSegs := int(data[26])
+		if len(data) < 27+nSegs {
+			return nil, fmt.Errorf("truncated Ogg page: %w", ErrNotOpus)
+		}
+		body := data[27+nSegs:]
+		for _, lace := range data[27 : 27+nSegs] {
+			n := int(lace)
+			if n > len(body) {
+				return nil, fmt.Errorf("truncated Ogg page: %w", ErrNotOpus)
+			}
+			partial = append(partial, body[:n]...)
+			body = body[n:]
+			if n < 255 {
+				packets = append(packets, partial)
+				partial = nil
+			}
+		}
+		data = body
+	}
+	if len(packets) < 2 || len(packets[0]) < 19 || string(packets[0][0:8]) != "OpusHead" {
+		return nil, fmt.Errorf("no OpusHead: %w", ErrNotOpus)
+	}
+	preSkip := int64(binary.LittleEndian.Uint16(packets[0][10:12]))
+	out := &oggOpus{}
+	if samples := granule - preSkip; samples > 0 {
+		out.duration = time.Duration(samples) * time.Second / 48000
+	}
+	for _, p := range packets[2:] { // skip OpusHead and OpusTags
+		out.packetSizes = append(out.packetSizes, len(p))
+	}
+	return out, nil
+}
+
+// waveform approximates the loudness over time as WaveformSamples values of 0 to 100. Decoding
+// Opus is out of scope, so the sizes of the packets serve as a measure: louder audio needs more
+// bits.
+func waveform(packetSizes []int) []byte {
+	out := make([]byte, WaveformSamples)
+	if len(packetSizes) == 0 {
+		return out
+	}
+	var sums [WaveformSamples]float64
+	var counts [WaveformSamples]int
+	for i, n := range packetSizes {
+		b := i * WaveformSamples / len(packetSizes)
+		sums[b] += float64(n)
+		counts[b]++
+	}
+	max := 0.0
+	for b := range sums {
+		if counts[b] > 0 {
+			sums[b] /= float64(counts[b])
+		}
+		max = math.Max(max, sums[b])
+	}
+	if max == 0 {
+		return out
+	}
+	for b := range sums {
+		out[b] = byte(math.Round(sums[b] / max * 100))
+	}
+	return out
+}
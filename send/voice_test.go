@@ -0,0 +1,96 @@
+package send
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestVoiceNote(t *testing.T) {
+	hooks = nil
+	to := types.NewJID("123", types.DefaultUserServer)
+	// 3 seconds of 20ms packets, getting larger towards the middle.
+	fixture, err := os.ReadFile("testdata/voice.opus")
+	if err != nil {
+		t.Fatalf("os.ReadFile(_) = _, %v; need nil error", err)
+	}
+
+	for _, opts := range []VoiceOpts{{}, {Waveform: true}} {
+		f := &fakeForwarder{}
+		if _, err := VoiceNote(context.Background(), f, to, bytes.NewReader(fixture), opts); err != nil {
+			t.Fatalf("VoiceNote(_, %+v) = _, %v; need nil error", opts, err)
+		}
+		audio := f.sent[0].GetAudioMessage()
+		if !audio.GetPTT() || audio.GetSeconds() != 3 || audio.GetMimetype() != VoiceMimetype || audio.GetDirectPath() != "/new" {
+			t.Errorf("VoiceNote(_, %+v) sent %v, want a 3 second PTT", opts, audio)
+		}
+		wf := audio.GetWaveform()
+		if !opts.Waveform {
+			if wf != nil {
+				t.Errorf("VoiceNote(_, %+v) sent waveform %v, want none", opts, wf)
+			}
+			continue
+		}
+		if len(wf) != WaveformSamples {
+			t.Fatalf("VoiceNote(_, %+v) sent %v waveform samples, want %v", opts, len(wf), WaveformSamples)
+		}
+		if mid := wf[WaveformSamples/2]; mid < 90 || wf[0] >= mid || wf[WaveformSamples-1] >= mid {
+			t.Errorf("VoiceNote(_, %+v) sent waveform %v, want loudest in the middle", opts, wf)
+		}
+	}
+}
+
+func TestVoiceNoteNotOpus(t *testing.T) {
+	hooks = nil
+	to := types.NewJID("123", types.DefaultUserServer)
+	fixture, err := os.ReadFile("testdata/voice.opus")
+	if err != nil {
+		t.Fatalf("os.ReadFile(_) = _, %v; need nil error", err)
+	}
+	vorbis := append([]byte(nil), fixture...)
+	copy(vorbis[28:], "\x01vorbis\x00")
+
+	for _, test := range []struct {
+		description string
+		data        []byte
+	}{
+		{description: "mp3", data: []byte("ID3\x04\x00\x00\x00\x00\x00\x00")},
+		{description: "vorbis", data: vorbis},
+		{description: "truncated", data: fixture[:100]},
+	} {
+		f := &fakeForwarder{}
+		_, err := VoiceNote(context.Background(), f, to, bytes.NewReader(test.data), VoiceOpts{})
+		if !errors.Is(err, ErrNotOpus) {
+			t.Errorf("%v: VoiceNote(_) = _, %v; want ErrNotOpus", test.description, err)
+		}
+		if f.uploads != 0 {
+			t.Errorf("%v: VoiceNote(_) uploaded invalid audio", test.description)
+		}
+	}
+}
+
+// fakeProber probes any audio as 61 seconds.
+type fakeProber struct{}
+
+func (fakeProber) Probe(ctx context.Context, audio []byte) (time.Duration, []byte, error) {
+	return 61 * time.Second, []byte{0, 50, 100}, nil
+}
+
+func TestVoiceNoteProber(t *testing.T) {
+	hooks = nil
+	to := types.NewJID("123", types.DefaultUserServer)
+	f := &fakeForwarder{}
+	opts := VoiceOpts{Waveform: true, Mimetype: "audio/mpeg", Prober: fakeProber{}}
+	if _, err := VoiceNote(context.Background(), f, to, bytes.NewReader([]byte("ID3\x04")), opts); err != nil {
+		t.Fatalf("VoiceNote(_) = _, %v; need nil error", err)
+	}
+	audio := f.sent[0].GetAudioMessage()
+	if audio.GetSeconds() != 61 || audio.GetMimetype() != "audio/mpeg" || !bytes.Equal(audio.GetWaveform(), []byte{0, 50, 100}) || !audio.GetPTT() {
+		t.Errorf("VoiceNote(_) sent %v, want the probed 61 second PTT", audio)
+	}
+}
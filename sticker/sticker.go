@@ -0,0 +1,294 @@
+// Package sticker validates WebP stickers and reads and writes their pack metadata.
+package sticker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Size is the width and height that stickers must have.
+const Size = 512
+
+// Maximum file sizes that WhatsApp accepts.
+const (
+	MaxStaticBytes   = 100 * 1024
+	MaxAnimatedBytes = 500 * 1024
+)
+
+// ErrInvalid is wrapped by all validation errors.
+var ErrInvalid = errors.New("invalid sticker")
+
+// ErrNoMeta is returned when a sticker has no pack metadata.
+var ErrNoMeta = errors.New("sticker has no pack metadata")
+
+// Meta is the pack metadata of a sticker.
+type Meta struct {
+	Pack     string
+	Author   string
+	Animated bool
+}
+
+// Info describes a WebP image.
+type Info struct {
+	Width, Height int
+	Animated      bool
+}
+
+// VP8X flags.
+const (
+	flagAnimation = 0x02
+	flagEXIF      = 0x08
+	flagAlpha     = 0x10
+)
+
+// EXIF tag that WhatsApp uses to store the sticker pack as JSON.
+const exifPackTag = 0x5741
+
+type chunk struct {
+	fourCC string
+	data   []byte
+}
+
+// exifJSON is the JSON that WhatsApp stores in the EXIF of a sticker.
+type exifJSON struct {
+	PackID    string   `json:"sticker-pack-id,omitempty"`
+	Pack      string   `json:"sticker-pack-name"`
+	Publisher string   `json:"sticker-pack-publisher"`
+	Emojis    []string `json:"emojis,omitempty"`
+}
+
+// Inspect describes a WebP image.
+func Inspect(webp []byte) (Info, error) {
+	chunks, err := parse(webp)
+	if err != nil {
+		return Info{}, err
+	}
+	return describe(chunks)
+}
+
+// Validate checks that `webp` is a WebP image that can be sent as a sticker, and describes it.
+func Validate(webp []byte) (Info, error) {
+	info, err := Inspect(webp)
+	if err != nil {
+		return Info{}, err
+	}
+	if info.Width != Size || info.Height != Size {
+		return Info{}, fmt.Errorf("sticker.Validate: image is %vx%v, need %vx%v: %w", info.Width, info.Height, Size, Size, ErrInvalid)
+	}
+	max := MaxStaticBytes
+	if info.Animated {
+		max = MaxAnimatedBytes
+	}
+	if len(webp) > max {
+		return Info{}, fmt.Errorf("sticker.Validate: image is %v bytes, max is %v: %w", len(webp), max, ErrInvalid)
+	}
+	return info, nil
+}
+
+// WithMeta returns a copy of `webp` with the pack metadata stored in its EXIF. An existing
+// EXIF is replaced. `meta.Animated` is not stored; it follows from the image.
+func WithMeta(webp []byte, meta Meta) ([]byte, error) {
+	chunks, err := parse(webp)
+	if err != nil {
+		return nil, err
+	}
+	info, err := describe(chunks)
+	if err != nil {
+		return nil, err
+	}
+	exif, err := buildEXIF(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []chunk
+	if chunks[0].fourCC != "VP8X" {
+		// Simple format: an extended header is needed to announce the EXIF.
+		vp8x := make([]byte, 10)
+		if chunks[0].fourCC == "VP8L" && chunks[0].data[4]&0x10 != 0 {
+			vp8x[0] |= flagAlpha
+		}
+		putUint24(vp8x[4:], uint32(info.Width-1))
+		putUint24(vp8x[7:], uint32(info.Height-1))
+		out = append(out, chunk{fourCC: "VP8X", data: vp8x})
+	}
+	for _, c := range chunks {
+		if c.fourCC == "EXIF" {
+			continue
+		}
+		if c.fourCC == "VP8X" {
+			c.data = append([]byte(nil), c.data...)
+		}
+		out = append(out, c)
+	}
+	out[0].data[0] |= flagEXIF
+	out = append(out, chunk{fourCC: "EXIF", data: exif})
+	return serialize(out), nil
+}
+
+// MetaOf returns the pack metadata of a sticker.
+func MetaOf(webp []byte) (Meta, error) {
+	chunks, err := parse(webp)
+	if err != nil {
+		return Meta{}, err
+	}
+	info, err := describe(chunks)
+	if err != nil {
+		return Meta{}, err
+	}
+	for _, c := range chunks {
+		if c.fourCC != "EXIF" {
+			continue
+		}
+		js, err := parseEXIF(c.data)
+		if err != nil {
+			return Meta{}, err
+		}
+		return Meta{Pack: js.Pack, Author: js.Publisher, Animated: info.Animated}, nil
+	}
+	return Meta{}, ErrNoMeta
+}
+
+// parse splits a WebP file into its chunks.
+func parse(webp []byte) ([]chunk, error) {
+	if len(webp) < 12 || string(webp[0:4]) != "RIFF" || string(webp[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("sticker: no RIFF/WEBP header: %w", ErrInvalid)
+	}
+	size := int(binary.LittleEndian.Uint32(webp[4:8]))
+	if size+8 > len(webp) || size < 4 {
+		return nil, fmt.Errorf("sticker: RIFF size %v doesn't match file size %v: %w", size, len(webp), ErrInvalid)
+	}
+	var chunks []chunk
+	rest := webp[12 : size+8]
+	for len(rest) > 0 {
+		if len(rest) < 8 {
+			return nil, fmt.Errorf("sticker: truncated chunk header: %w", ErrInvalid)
+		}
+		fourCC := string(rest[0:4])
+		n := int(binary.LittleEndian.Uint32(rest[4:8]))
+		if 8+n > len(rest) {
+			return nil, fmt.Errorf("sticker: chunk %q of %v bytes is truncated: %w", fourCC, n, ErrInvalid)
+		}
+		chunks = append(chunks, chunk{fourCC: fourCC, data: rest[8 : 8+n]})
+		rest = rest[8+n:]
+		if n%2 == 1 && len(rest) > 0 {
+			rest = rest[1:] // padding
+		}
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("sticker: no chunks: %w", ErrInvalid)
+	}
+	return chunks, nil
+}
+
+// describe returns the dimensions and animation of a parsed WebP.
+func describe(chunks []chunk) (Info, error) {
+	c := chunks[0]
+	switch c.fourCC {
+	case "VP8X":
+		if len(c.data) < 10 {
+			return Info{}, fmt.Errorf("sticker: short VP8X chunk: %w", ErrInvalid)
+		}
+		return Info{
+			Width:    int(uint24(c.data[4:])) + 1,
+			Height:   int(uint24(c.data[7:])) + 1,
+			Animated: c.data[0]&flagAnimation != 0,
+		}, nil
+	case "VP8 ":
+		if len(c.data) < 10 || !bytes.Equal(c.data[3:6], []byte{0x9d, 0x01, 0x2a}) {
+			return Info{}, fmt.Errorf("sticker: bad VP8 frame header: %w", ErrInvalid)
+		}
+		return Info{
+			Width:  int(binary.LittleEndian.Uint16(c.data[6:]) & 0x3fff),
+			Height: int(binary.LittleEndian.Uint16(c.data[8:]) & 0x3fff),
+		}, nil
+	case "VP8L":
+		if len(c.data) < 5 || c.data[0] != 0x2f {
+			return Info{}, fmt.Errorf("sticker: bad VP8L header: %w", ErrInvalid)
+		}
+		bits := binary.LittleEndian.Uint32(c.data[1:])
+		return Info{
+			Width:  int(bits&0x3fff) + 1,
+			Height: int((bits>>14)&0x3fff) + 1,
+		}, nil
+	}
+	return Info{}, fmt.Errorf("sticker: unexpected first chunk %q: %w", c.fourCC, ErrInvalid)
+}
+
+func serialize(chunks []chunk) []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, c := range chunks {
+		body.WriteString(c.fourCC)
+		binary.Write(&body, binary.LittleEndian, uint32(len(c.data)))
+		body.Write(c.data)
+		if len(c.data)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	out := make([]byte, 8, 8+body.Len())
+	copy(out, "RIFF")
+	binary.LittleEndian.PutUint32(out[4:], uint32(body.Len()))
+	return append(out, body.Bytes()...)
+}
+
+// buildEXIF returns a little-endian TIFF structure with one IFD entry holding the pack JSON.
+func buildEXIF(meta Meta) ([]byte, error) {
+	js, err := json.Marshal(exifJSON{Pack: meta.Pack, Publisher: meta.Author})
+	if err != nil {
+		return nil, fmt.Errorf("sticker: encoding metadata: %w", err)
+	}
+	const dataOffset = 8 + 2 + 12 + 4 // header, entry count, one entry, next IFD offset
+	out := make([]byte, dataOffset, dataOffset+len(js))
+	copy(out, "II*\x00")
+	binary.LittleEndian.PutUint32(out[4:], 8)            // offset of the IFD
+	binary.LittleEndian.PutUint16(out[8:], 1)            // number of entries
+	binary.LittleEndian.PutUint16(out[10:], exifPackTag) // tag
+	binary.LittleEndian.PutUint16(out[12:], 7)           // type: undefined
+	binary.LittleEndian.PutUint32(out[14:], uint32(len(js)))
+	binary.LittleEndian.PutUint32(out[18:], dataOffset)
+	return append(out, js...), nil
+}
+
+// parseEXIF finds the pack JSON in a little-endian TIFF structure.
+func parseEXIF(exif []byte) (exifJSON, error) {
+	var js exifJSON
+	if len(exif) < 10 || string(exif[0:4]) != "II*\x00" {
+		return js, fmt.Errorf("sticker: unsupported EXIF header: %w", ErrInvalid)
+	}
+	ifd := int(binary.LittleEndian.Uint32(exif[4:]))
+	if ifd+2 > len(exif) {
+		return js, fmt.Errorf("sticker: EXIF IFD out of range: %w", ErrInvalid)
+	}
+	entries := int(binary.LittleEndian.Uint16(exif[ifd:]))
+	for i := 0; i < entries; i++ {
+		e := ifd + 2 + 12*i
+		if e+12 > len(exif) {
+			break
+		}
+		if binary.LittleEndian.Uint16(exif[e:]) != exifPackTag {
+			continue
+		}
+		n := int(binary.LittleEndian.Uint32(exif[e+4:]))
+		off := int(binary.LittleEndian.Uint32(exif[e+8:]))
+		if off+n > len(exif) {
+			return js, fmt.Errorf("sticker: EXIF pack data out of range: %w", ErrInvalid)
+		}
+		if err := json.Unmarshal(exif[off:off+n], &js); err != nil {
+			return js, fmt.Errorf("sticker: decoding pack metadata: %w", err)
+		}
+		return js, nil
+	}
+	return js, ErrNoMeta
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
@@ -0,0 +1,143 @@
+package sticker
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// riff wraps chunks into a WebP file.
+func riff(chunks ...chunk) []byte {
+	return serialize(chunks)
+}
+
+// vp8l returns a lossless image chunk of the given size, with an empty bitstream.
+func vp8l(w, h int) chunk {
+	data := make([]byte, 5)
+	data[0] = 0x2f
+	binary.LittleEndian.PutUint32(data[1:], uint32(w-1)|uint32(h-1)<<14|1<<28)
+	return chunk{fourCC: "VP8L", data: data}
+}
+
+// vp8 returns a lossy image chunk of the given size, with an empty bitstream.
+func vp8(w, h int) chunk {
+	data := []byte{0, 0, 0, 0x9d, 0x01, 0x2a, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint16(data[6:], uint16(w))
+	binary.LittleEndian.PutUint16(data[8:], uint16(h))
+	return chunk{fourCC: "VP8 ", data: data}
+}
+
+// vp8x returns an extended header chunk.
+func vp8x(w, h int, flags byte) chunk {
+	data := make([]byte, 10)
+	data[0] = flags
+	putUint24(data[4:], uint32(w-1))
+	putUint24(data[7:], uint32(h-1))
+	return chunk{fourCC: "VP8X", data: data}
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		webp        []byte
+		want        Info
+		wantErr     bool
+	}{
+		{
+			description: "lossless",
+			webp:        riff(vp8l(512, 512)),
+			want:        Info{Width: 512, Height: 512},
+		},
+		{
+			description: "lossy",
+			webp:        riff(vp8(512, 512)),
+			want:        Info{Width: 512, Height: 512},
+		},
+		{
+			description: "animated",
+			webp:        riff(vp8x(512, 512, flagAnimation), chunk{fourCC: "ANIM", data: make([]byte, 6)}),
+			want:        Info{Width: 512, Height: 512, Animated: true},
+		},
+		{
+			description: "wrong size",
+			webp:        riff(vp8l(512, 256)),
+			wantErr:     true,
+		},
+		{
+			description: "not a webp",
+			webp:        []byte("\x89PNG\r\n\x1a\n0000"),
+			wantErr:     true,
+		},
+		{
+			description: "truncated",
+			webp:        riff(vp8l(512, 512))[:20],
+			wantErr:     true,
+		},
+		{
+			description: "too large",
+			webp:        riff(vp8l(512, 512), chunk{fourCC: "XTRA", data: make([]byte, MaxStaticBytes)}),
+			wantErr:     true,
+		},
+	} {
+		got, err := Validate(test.webp)
+		if test.wantErr {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("%v: Validate(_) = _, %v; want ErrInvalid", test.description, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: Validate(_) = _, %v; need nil error", test.description, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%v: Validate(_) = %+v, want %+v", test.description, got, test.want)
+		}
+	}
+}
+
+func TestMetaRoundTrip(t *testing.T) {
+	meta := Meta{Pack: "Cats", Author: "Karel"}
+	for _, test := range []struct {
+		description string
+		webp        []byte
+		animated    bool
+	}{
+		{description: "simple format", webp: riff(vp8l(512, 512))},
+		{description: "lossy", webp: riff(vp8(512, 512))},
+		{description: "extended animated", webp: riff(vp8x(512, 512, flagAnimation)), animated: true},
+		{description: "existing EXIF", webp: riff(vp8x(512, 512, flagEXIF), vp8l(512, 512), chunk{fourCC: "EXIF", data: []byte("old")})},
+	} {
+		if _, err := MetaOf(test.webp); !errors.Is(err, ErrNoMeta) && test.description != "existing EXIF" {
+			t.Errorf("%v: MetaOf(original) = _, %v; want ErrNoMeta", test.description, err)
+		}
+		out, err := WithMeta(test.webp, meta)
+		if err != nil {
+			t.Errorf("%v: WithMeta(_) = _, %v; need nil error", test.description, err)
+			continue
+		}
+		if _, err := Validate(out); err != nil {
+			t.Errorf("%v: Validate(WithMeta(_)) = _, %v; need nil error", test.description, err)
+		}
+		got, err := MetaOf(out)
+		if err != nil {
+			t.Errorf("%v: MetaOf(WithMeta(_)) = _, %v; need nil error", test.description, err)
+			continue
+		}
+		want := meta
+		want.Animated = test.animated
+		if got != want {
+			t.Errorf("%v: MetaOf(WithMeta(_)) = %+v, want %+v", test.description, got, want)
+		}
+		chunks, _ := parse(out)
+		exifs := 0
+		for _, c := range chunks {
+			if c.fourCC == "EXIF" {
+				exifs++
+			}
+		}
+		if chunks[0].fourCC != "VP8X" || chunks[0].data[0]&flagEXIF == 0 || exifs != 1 {
+			t.Errorf("%v: WithMeta(_) chunks = %v, want VP8X with EXIF flag and one EXIF chunk", test.description, chunks)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package tracking
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/send"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// DefaultTTL is how long a ReceiptTracker remembers a message after its last change, unless set
+// in ReceiptOpts.
+const DefaultTTL = 24 * time.Hour
+
+// Transition is a change of the state of a tracked message.
+type Transition struct {
+	ID       types.MessageID
+	Chat     types.JID
+	From, To State
+	At       time.Time // of the receipt
+}
+
+// ReceiptOpts configures a ReceiptTracker.
+type ReceiptOpts struct {
+	TTL      time.Duration    // after its last change, a message is forgotten; DefaultTTL when zero
+	OnChange func(Transition) // invoked on every transition, optional
+}
+
+// receiptEntry is the state of a message that a ReceiptTracker tracks.
+type receiptEntry struct {
+	chat    types.JID
+	state   State
+	expires time.Time
+}
+
+// receiptSub is a channel that gets the transitions, see ReceiptTracker.Subscribe.
+type receiptSub struct {
+	ch chan Transition
+}
+
+// ReceiptTracker follows sent messages through their receipts in memory, for code that wants to
+// know when a message was delivered, read or played, without a Store. Messages are keyed by
+// their IDs, which are unique. Receipts for messages that aren't tracked (or no longer, after the
+// TTL), retry receipts and receipts for messages that this account read on another device are
+// ignored. The zero value isn't usable, use NewReceiptTracker.
+type ReceiptTracker struct {
+	opts ReceiptOpts
+
+	mu        sync.Mutex
+	entries   map[types.MessageID]*receiptEntry
+	subs      map[*receiptSub]bool
+	nextSweep time.Time // of the expired entries
+}
+
+// NewReceiptTracker returns a receipt tracker.
+//
+//	rt := tracking.NewReceiptTracker(tracking.ReceiptOpts{OnChange: func(tr tracking.Transition) {
+//		log.Printf("%v: %v -> %v", tr.ID, tr.From, tr.To)
+//	}})
+//	rt.Register()
+//	rt.AutoTrack()
+func NewReceiptTracker(opts ReceiptOpts) *ReceiptTracker {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	return &ReceiptTracker{
+		opts:    opts,
+		entries: map[types.MessageID]*receiptEntry{},
+		subs:    map[*receiptSub]bool{},
+	}
+}
+
+// Register registers the tracker for Receipt events.
+func (r *ReceiptTracker) Register() {
+	handlers.Register(handlers.Receipt, r)
+}
+
+// AutoTrack tracks all messages that are sent by package send, except for edits, revokes and
+// reactions, which get no receipts.
+func (r *ReceiptTracker) AutoTrack() {
+	send.AddAfterHook(func(to types.JID, msg *waE2E.Message, resp send.Response) {
+		if tracked(msg) {
+			r.Track(resp.ID, to)
+		}
+	})
+}
+
+// Track starts tracking a sent message, in state Sent. Tracking the same message twice is a
+// no-op.
+func (r *ReceiptTracker) Track(id types.MessageID, chat types.JID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := now()
+	r.sweep(t)
+	if e, ok := r.entries[id]; !ok || !t.Before(e.expires) {
+		r.entries[id] = &receiptEntry{chat: chat.ToNonAD(), state: Sent, expires: t.Add(r.opts.TTL)}
+	}
+}
+
+// Status returns the state of a tracked message, or false when it isn't tracked.
+func (r *ReceiptTracker) Status(id types.MessageID) (State, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[id]
+	if !ok || !now().Before(e.expires) {
+		return 0, false
+	}
+	return e.state, true
+}
+
+// Subscribe returns a channel that gets the transitions. Sending never holds up the tracker:
+// when the channel's buffer is full, the oldest transition in it is dropped to make room. A
+// buffer below 1 is taken as 1. The returned func unsubscribes and closes the channel.
+func (r *ReceiptTracker) Subscribe(buffer int) (<-chan Transition, func()) {
+	if buffer < 1 {
+		buffer = 1
+	}
+	s := &receiptSub{ch: make(chan Transition, buffer)}
+	r.mu.Lock()
+	r.subs[s] = true
+	r.mu.Unlock()
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			r.mu.Lock()
+			delete(r.subs, s)
+			close(s.ch)
+			r.mu.Unlock()
+		})
+	}
+}
+
+// Handle implements handlers.handler for Receipt events.
+func (r *ReceiptTracker) Handle(ev interface{}) error {
+	rc, ok := ev.(*events.Receipt)
+	if !ok {
+		return fmt.Errorf("tracking.ReceiptTracker.Handle: unexpected event %T", ev)
+	}
+	state, ok := StateOf(rc.Type)
+	if !ok || rc.IsFromMe {
+		return nil
+	}
+
+	var changes []Transition
+	r.mu.Lock()
+	t := now()
+	r.sweep(t)
+	for _, id := range rc.MessageIDs {
+		e, ok := r.entries[id]
+		if ok && !t.Before(e.expires) {
+			delete(r.entries, id) // expired, but not yet swept
+			ok = false
+		}
+		if !ok || e.state.Advance(state) == e.state {
+			continue
+		}
+		tr := Transition{ID: id, Chat: e.chat, From: e.state, To: state, At: rc.Timestamp}
+		e.state, e.expires = state, t.Add(r.opts.TTL)
+		changes = append(changes, tr)
+		for s := range r.subs {
+			s.send(tr)
+		}
+	}
+	r.mu.Unlock()
+
+	if r.opts.OnChange != nil {
+		for _, tr := range changes {
+			r.opts.OnChange(tr)
+		}
+	}
+	return nil
+}
+
+// send sends a transition without blocking, dropping the oldest one when the buffer is full. The
+// caller holds the tracker's lock, so that the channel isn't closed meanwhile.
+func (s *receiptSub) send(tr Transition) {
+	for {
+		select {
+		case s.ch <- tr:
+			return
+		default:
+		}
+		select {
+		case <-s.ch:
+		default: // the receiver made room meanwhile
+		}
+	}
+}
+
+// sweep forgets the expired messages, at most twice per TTL. The caller holds r.mu.
+func (r *ReceiptTracker) sweep(t time.Time) {
+	if t.Before(r.nextSweep) {
+		return
+	}
+	for id, e := range r.entries {
+		if !t.Before(e.expires) {
+			delete(r.entries, id)
+		}
+	}
+	r.nextSweep = t.Add(r.opts.TTL / 2)
+}
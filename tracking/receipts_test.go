@@ -0,0 +1,154 @@
+package tracking
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func receipt(typ types.ReceiptType, ids ...types.MessageID) *events.Receipt {
+	r := &events.Receipt{MessageIDs: ids, Type: typ}
+	r.Chat = types.NewJID("123", types.DefaultUserServer)
+	return r
+}
+
+func TestReceiptTracker(t *testing.T) {
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return base }
+	defer func() { now = time.Now }()
+
+	var changes []string
+	rt := NewReceiptTracker(ReceiptOpts{OnChange: func(tr Transition) {
+		changes = append(changes, fmt.Sprintf("%v:%v>%v", tr.ID, tr.From, tr.To))
+	}})
+	ch, unsubscribe := rt.Subscribe(10)
+	defer unsubscribe()
+	chat := types.NewJID("123", types.DefaultUserServer)
+	rt.Track("a", chat)
+	rt.Track("b", chat)
+	rt.Track("a", chat) // no-op
+
+	fromMe := receipt(types.ReceiptTypeRead, "b")
+	fromMe.IsFromMe = true
+	for _, test := range []struct {
+		description string
+		receipt     *events.Receipt
+		wantChanges string
+		want        map[types.MessageID]State
+	}{
+		{
+			description: "delivered",
+			receipt:     receipt(types.ReceiptTypeDelivered, "a", "b"),
+			wantChanges: "a:Sent>Delivered b:Sent>Delivered",
+			want:        map[types.MessageID]State{"a": Delivered, "b": Delivered},
+		},
+		{
+			description: "read",
+			receipt:     receipt(types.ReceiptTypeRead, "a"),
+			wantChanges: "a:Delivered>Read",
+			want:        map[types.MessageID]State{"a": Read, "b": Delivered},
+		},
+		{
+			description: "late delivery doesn't go back",
+			receipt:     receipt(types.ReceiptTypeDelivered, "a"),
+			want:        map[types.MessageID]State{"a": Read, "b": Delivered},
+		},
+		{
+			description: "retry receipts are ignored",
+			receipt:     receipt(types.ReceiptTypeRetry, "b"),
+			want:        map[types.MessageID]State{"a": Read, "b": Delivered},
+		},
+		{
+			description: "own reads are ignored",
+			receipt:     fromMe,
+			want:        map[types.MessageID]State{"a": Read, "b": Delivered},
+		},
+		{
+			description: "untracked messages are ignored",
+			receipt:     receipt(types.ReceiptTypeRead, "c", "b"),
+			wantChanges: "b:Delivered>Read",
+			want:        map[types.MessageID]State{"a": Read, "b": Read},
+		},
+		{
+			description: "played",
+			receipt:     receipt(types.ReceiptTypePlayed, "a"),
+			wantChanges: "a:Read>Played",
+			want:        map[types.MessageID]State{"a": Played, "b": Read},
+		},
+	} {
+		changes = nil
+		if err := rt.Handle(test.receipt); err != nil {
+			t.Errorf("%v: Handle(_) = %v, need nil error", test.description, err)
+		}
+		if got := strings.Join(changes, " "); got != test.wantChanges {
+			t.Errorf("%v: transitions %q, want %q", test.description, got, test.wantChanges)
+		}
+		var sent []string
+		for len(ch) > 0 {
+			tr := <-ch
+			sent = append(sent, fmt.Sprintf("%v:%v>%v", tr.ID, tr.From, tr.To))
+		}
+		if got := strings.Join(sent, " "); got != test.wantChanges {
+			t.Errorf("%v: subscription got %q, want %q", test.description, got, test.wantChanges)
+		}
+		for id, want := range test.want {
+			if got, ok := rt.Status(id); got != want || !ok {
+				t.Errorf("%v: Status(%v) = %v, %v, want %v, true", test.description, id, got, ok, want)
+			}
+		}
+		if _, ok := rt.Status("c"); ok {
+			t.Errorf("%v: Status(c) = _, true for an untracked message, want false", test.description)
+		}
+	}
+}
+
+func TestReceiptTrackerTTL(t *testing.T) {
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return base }
+	defer func() { now = time.Now }()
+
+	rt := NewReceiptTracker(ReceiptOpts{TTL: time.Hour})
+	chat := types.NewJID("123", types.DefaultUserServer)
+	rt.Track("old", chat)
+	rt.Track("active", chat)
+	base = base.Add(50 * time.Minute)
+	rt.Handle(receipt(types.ReceiptTypeDelivered, "active")) // extends the TTL of "active"
+	base = base.Add(20 * time.Minute)
+
+	if _, ok := rt.Status("old"); ok {
+		t.Errorf("Status(old) = _, true after the TTL, want false")
+	}
+	if s, ok := rt.Status("active"); s != Delivered || !ok {
+		t.Errorf("Status(active) = %v, %v, want %v, true", s, ok, Delivered)
+	}
+	rt.Handle(receipt(types.ReceiptTypeRead, "old"))
+	if _, ok := rt.Status("old"); ok {
+		t.Errorf("Status(old) = _, true after a receipt past the TTL, want false")
+	}
+	base = base.Add(15 * time.Minute)
+	rt.Track("new", chat)
+	if len(rt.entries) != 2 {
+		t.Errorf("%d entries after the sweep, want 2 (active, new)", len(rt.entries))
+	}
+}
+
+func TestReceiptTrackerSubscribeDropsOldest(t *testing.T) {
+	rt := NewReceiptTracker(ReceiptOpts{})
+	ch, unsubscribe := rt.Subscribe(1)
+	chat := types.NewJID("123", types.DefaultUserServer)
+	rt.Track("a", chat)
+	rt.Handle(receipt(types.ReceiptTypeDelivered, "a"))
+	rt.Handle(receipt(types.ReceiptTypeRead, "a"))
+	if tr := <-ch; tr.To != Read {
+		t.Errorf("<-ch = %+v, want the newest transition to Read", tr)
+	}
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-ch; ok {
+		t.Errorf("channel is open after unsubscribing, want closed")
+	}
+}
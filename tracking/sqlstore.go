@@ -0,0 +1,142 @@
+package tracking
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/internal/sqlmigrate"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// migrations are the schema of SQLStore, see sqlmigrate.
+var migrations = []string{
+	`CREATE TABLE tracked_messages (
+		chat         TEXT    NOT NULL,
+		id           TEXT    NOT NULL,
+		sent_at      INTEGER NOT NULL,
+		state        INTEGER NOT NULL,
+		delivered_at INTEGER,
+		read_at      INTEGER,
+		played_at    INTEGER,
+		PRIMARY KEY (chat, id)
+	);
+	CREATE INDEX tracked_messages_sent_at ON tracked_messages (sent_at);`,
+}
+
+// now is swapped in tests.
+var now = time.Now
+
+// SQLStore is a Store in an SQLite database, which can be queried for delivery statistics.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a store in `db`, which must be an SQLite database. The tables are created
+// or migrated when needed.
+func NewSQLStore(ctx context.Context, db *sql.DB) (*SQLStore, error) {
+	if err := sqlmigrate.Up(ctx, db, "tracking_version", migrations); err != nil {
+		return nil, fmt.Errorf("tracking.NewSQLStore: %w", err)
+	}
+	return &SQLStore{db: db}, nil
+}
+
+// Sent implements Store.
+func (s *SQLStore) Sent(ref handlers.MessageRef) error {
+	ts := ref.Timestamp
+	if ts.IsZero() {
+		ts = now()
+	}
+	_, err := s.db.Exec(`INSERT INTO tracked_messages (chat, id, sent_at, state) VALUES (?, ?, ?, ?)
+		ON CONFLICT (chat, id) DO NOTHING`,
+		ref.Chat.String(), ref.ID, ts.UnixMilli(), Sent)
+	if err != nil {
+		return fmt.Errorf("tracking.SQLStore.Sent: %w", err)
+	}
+	return nil
+}
+
+// Advance implements Store. Replayed receipts don't change anything: the state only advances,
+// and the first time that a state was reached is kept.
+func (s *SQLStore) Advance(chat types.JID, id types.MessageID, state State, at time.Time) error {
+	_, err := s.db.Exec(`UPDATE tracked_messages SET
+			state        = MAX(state, ?1),
+			delivered_at = COALESCE(delivered_at, CASE WHEN ?1 >= ?3 THEN ?2 END),
+			read_at      = COALESCE(read_at, CASE WHEN ?1 >= ?4 THEN ?2 END),
+			played_at    = COALESCE(played_at, CASE WHEN ?1 >= ?5 THEN ?2 END)
+		WHERE chat = ?6 AND id = ?7`,
+		state, at.UnixMilli(), Delivered, Read, Played, chat.String(), id)
+	if err != nil {
+		return fmt.Errorf("tracking.SQLStore.Advance: %w", err)
+	}
+	return nil
+}
+
+// State returns the state of a tracked message, and false when it's not tracked.
+func (s *SQLStore) State(chat types.JID, id types.MessageID) (State, bool, error) {
+	var state State
+	err := s.db.QueryRow(`SELECT state FROM tracked_messages WHERE chat = ? AND id = ?`, chat.String(), id).Scan(&state)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("tracking.SQLStore.State: %w", err)
+	}
+	return state, true, nil
+}
+
+// Undelivered returns the messages that were sent since `since` and that aren't delivered yet,
+// oldest first.
+func (s *SQLStore) Undelivered(since time.Time) ([]handlers.MessageRef, error) {
+	rows, err := s.db.Query(`SELECT chat, id, sent_at FROM tracked_messages
+		WHERE state < ? AND sent_at >= ? ORDER BY sent_at, id`, Delivered, since.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("tracking.SQLStore.Undelivered: %w", err)
+	}
+	defer rows.Close()
+	var out []handlers.MessageRef
+	for rows.Next() {
+		var chat, id string
+		var sentAt int64
+		if err := rows.Scan(&chat, &id, &sentAt); err != nil {
+			return nil, fmt.Errorf("tracking.SQLStore.Undelivered: %w", err)
+		}
+		jid, err := types.ParseJID(chat)
+		if err != nil {
+			return nil, fmt.Errorf("tracking.SQLStore.Undelivered: %w", err)
+		}
+		out = append(out, handlers.MessageRef{Chat: jid, ID: id, FromMe: true, Timestamp: time.UnixMilli(sentAt)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("tracking.SQLStore.Undelivered: %w", err)
+	}
+	return out, nil
+}
+
+// ReadRate returns the fraction of messages sent to a chat during the last `window` that were
+// read, between 0 and 1. When no messages were sent, the rate is 0.
+func (s *SQLStore) ReadRate(chat types.JID, window time.Duration) (float64, error) {
+	var total, read int
+	err := s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(state >= ?), 0) FROM tracked_messages
+		WHERE chat = ? AND sent_at >= ?`, Read, chat.ToNonAD().String(), now().Add(-window).UnixMilli()).Scan(&total, &read)
+	if err != nil {
+		return 0, fmt.Errorf("tracking.SQLStore.ReadRate: %w", err)
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return float64(read) / float64(total), nil
+}
+
+// Prune stops tracking messages that were sent longer than `retention` ago, and returns how
+// many were dropped.
+func (s *SQLStore) Prune(retention time.Duration) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM tracked_messages WHERE sent_at < ?`, now().Add(-retention).UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("tracking.SQLStore.Prune: %w", err)
+	}
+	return res.RowsAffected()
+}
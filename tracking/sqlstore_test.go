@@ -0,0 +1,123 @@
+package tracking
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func newTestStore(t *testing.T) (*SQLStore, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open(_) = _, %v; need nil error", err)
+	}
+	db.SetMaxOpenConns(1) // every connection would get its own in-memory database
+	t.Cleanup(func() { db.Close() })
+	s, err := NewSQLStore(context.Background(), db)
+	if err != nil {
+		t.Fatalf("NewSQLStore(_) = _, %v; need nil error", err)
+	}
+	return s, db
+}
+
+func TestSQLStoreMigrations(t *testing.T) {
+	s, db := newTestStore(t)
+	if _, err := NewSQLStore(context.Background(), db); err != nil {
+		t.Fatalf("NewSQLStore(_) on a migrated database = _, %v; need nil error", err)
+	}
+	var version int
+	if err := s.db.QueryRow(`SELECT version FROM tracking_version`).Scan(&version); err != nil || version != len(migrations) {
+		t.Errorf("version = %v, %v; want %v", version, err, len(migrations))
+	}
+}
+
+func TestSQLStore(t *testing.T) {
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return base }
+	defer func() { now = time.Now }()
+
+	s, _ := newTestStore(t)
+	alice := types.NewJID("111", types.DefaultUserServer)
+	bob := types.NewJID("222", types.DefaultUserServer)
+	sent := func(chat types.JID, id types.MessageID, ago time.Duration) {
+		t.Helper()
+		if err := s.Sent(handlers.MessageRef{Chat: chat, ID: id, FromMe: true, Timestamp: base.Add(-ago)}); err != nil {
+			t.Fatalf("Sent(%v) = %v, need nil error", id, err)
+		}
+	}
+	advance := func(chat types.JID, id types.MessageID, state State) {
+		t.Helper()
+		if err := s.Advance(chat, id, state, base); err != nil {
+			t.Fatalf("Advance(%v, %v) = %v, need nil error", id, state, err)
+		}
+	}
+
+	sent(alice, "old", 48*time.Hour)
+	sent(alice, "a1", 3*time.Hour)
+	sent(alice, "a2", 2*time.Hour)
+	sent(alice, "a3", time.Hour)
+	sent(alice, "a3", time.Minute) // replayed
+	sent(bob, "b1", time.Hour)
+
+	advance(alice, "a1", Read)
+	advance(alice, "a1", Delivered) // late, doesn't go back
+	advance(alice, "a1", Read)      // replayed
+	advance(alice, "a2", Delivered)
+	advance(alice, "unknown", Read) // untracked, ignored
+
+	if st, ok, err := s.State(alice, "a1"); err != nil || !ok || st != Read {
+		t.Errorf("State(a1) = %v, %v, %v; want Read", st, ok, err)
+	}
+	if _, ok, _ := s.State(alice, "unknown"); ok {
+		t.Errorf("State(unknown) is tracked, want not")
+	}
+	var deliveredAt, readAt int64
+	s.db.QueryRow(`SELECT delivered_at, read_at FROM tracked_messages WHERE id = 'a1'`).Scan(&deliveredAt, &readAt)
+	if deliveredAt != base.UnixMilli() || readAt != base.UnixMilli() {
+		t.Errorf("a1 delivered at %v, read at %v; want both %v", deliveredAt, readAt, base.UnixMilli())
+	}
+
+	undelivered, err := s.Undelivered(base.Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("Undelivered(_) = _, %v; need nil error", err)
+	}
+	var ids []types.MessageID
+	for _, ref := range undelivered {
+		ids = append(ids, ref.ID)
+	}
+	if len(ids) != 2 || ids[0] != "a3" || ids[1] != "b1" {
+		t.Errorf("Undelivered(_) = %v, want [a3 b1]", ids)
+	}
+	if undelivered[0].Chat != alice || !undelivered[0].Timestamp.Equal(base.Add(-time.Hour)) {
+		t.Errorf("Undelivered(_)[0] = %+v, want alice's message of an hour ago", undelivered[0])
+	}
+
+	for _, test := range []struct {
+		chat   types.JID
+		window time.Duration
+		want   float64
+	}{
+		{alice, 24 * time.Hour, 1.0 / 3},
+		{alice, 72 * time.Hour, 1.0 / 4},
+		{bob, 24 * time.Hour, 0},
+		{types.NewJID("333", types.DefaultUserServer), 24 * time.Hour, 0},
+	} {
+		if got, err := s.ReadRate(test.chat, test.window); err != nil || got != test.want {
+			t.Errorf("ReadRate(%v, %v) = %v, %v; want %v", test.chat, test.window, got, err, test.want)
+		}
+	}
+
+	if n, err := s.Prune(24 * time.Hour); err != nil || n != 1 {
+		t.Errorf("Prune(_) = %v, %v; want 1", n, err)
+	}
+	if _, ok, _ := s.State(alice, "old"); ok {
+		t.Errorf("State(old) is tracked after pruning, want not")
+	}
+}
@@ -0,0 +1,121 @@
+// Package tracking follows the delivery of sent messages, based on the receipts that WhatsApp
+// sends back: a message is sent, then delivered, then read and, for voice notes, played.
+package tracking
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/send"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// State is the delivery state of a message. States only advance: a late delivery receipt
+// doesn't undo a read receipt.
+type State int
+
+const (
+	Sent State = iota + 1
+	Delivered
+	Read
+	Played
+)
+
+// String returns the name of a state.
+func (s State) String() string {
+	switch s {
+	case Sent:
+		return "Sent"
+	case Delivered:
+		return "Delivered"
+	case Read:
+		return "Read"
+	case Played:
+		return "Played"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Advance returns the state after a receipt for `to`.
+func (s State) Advance(to State) State {
+	if to > s {
+		return to
+	}
+	return s
+}
+
+// StateOf returns the state that a receipt type signals. Receipts that say nothing about
+// delivery (retries, own reads on other devices and such) return false.
+func StateOf(t types.ReceiptType) (State, bool) {
+	switch t {
+	case types.ReceiptTypeDelivered:
+		return Delivered, true
+	case types.ReceiptTypeRead:
+		return Read, true
+	case types.ReceiptTypePlayed:
+		return Played, true
+	}
+	return 0, false
+}
+
+// Store keeps the state of tracked messages.
+type Store interface {
+	// Sent starts tracking a message. Tracking the same message twice is a no-op.
+	Sent(ref handlers.MessageRef) error
+	// Advance moves a tracked message to a later state. Untracked messages are ignored.
+	Advance(chat types.JID, id types.MessageID, s State, at time.Time) error
+}
+
+// Tracker feeds a Store from sent messages and receipts.
+type Tracker struct {
+	store Store
+}
+
+// New returns a tracker that keeps its state in `store`.
+func New(store Store) *Tracker {
+	return &Tracker{store: store}
+}
+
+// Register registers the tracker for Receipt events, and tracks all messages that are sent by
+// package send.
+func (t *Tracker) Register() {
+	handlers.Register(handlers.Receipt, t)
+	send.AddAfterHook(func(to types.JID, msg *waE2E.Message, resp send.Response) {
+		if tracked(msg) {
+			// Errors can't be returned to the sender, who already succeeded.
+			t.store.Sent(handlers.MessageRef{
+				Chat:      to.ToNonAD(),
+				ID:        resp.ID,
+				FromMe:    true,
+				Timestamp: resp.Timestamp,
+			})
+		}
+	})
+}
+
+// tracked returns true for messages that get receipts: not for edits, revokes and reactions.
+func tracked(msg *waE2E.Message) bool {
+	return msg.GetProtocolMessage() == nil && msg.GetEditedMessage() == nil && msg.GetReactionMessage() == nil
+}
+
+// Handle implements handlers.handler for Receipt events.
+func (t *Tracker) Handle(ev interface{}) error {
+	r, ok := ev.(*events.Receipt)
+	if !ok {
+		return fmt.Errorf("tracking.Tracker.Handle: unexpected event %T", ev)
+	}
+	state, ok := StateOf(r.Type)
+	if !ok || r.IsFromMe {
+		return nil
+	}
+	for _, id := range r.MessageIDs {
+		if err := t.store.Advance(r.Chat.ToNonAD(), id, state, r.Timestamp); err != nil {
+			return fmt.Errorf("tracking.Tracker.Handle: %w", err)
+		}
+	}
+	return nil
+}
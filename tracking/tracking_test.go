@@ -0,0 +1,84 @@
+package tracking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// fakeStore records what the tracker tells it.
+type fakeStore struct {
+	states map[types.MessageID]State
+}
+
+func (f *fakeStore) Sent(ref handlers.MessageRef) error {
+	if _, ok := f.states[ref.ID]; !ok {
+		f.states[ref.ID] = Sent
+	}
+	return nil
+}
+
+func (f *fakeStore) Advance(chat types.JID, id types.MessageID, s State, at time.Time) error {
+	if old, ok := f.states[id]; ok {
+		f.states[id] = old.Advance(s)
+	}
+	return nil
+}
+
+func TestTracker(t *testing.T) {
+	store := &fakeStore{states: map[types.MessageID]State{}}
+	tr := New(store)
+	chat := types.NewJID("123", types.DefaultUserServer)
+	store.Sent(handlers.MessageRef{Chat: chat, ID: "a"})
+	store.Sent(handlers.MessageRef{Chat: chat, ID: "b"})
+
+	for _, test := range []struct {
+		description string
+		receipt     *events.Receipt
+		want        map[types.MessageID]State
+	}{
+		{
+			description: "delivered",
+			receipt:     &events.Receipt{MessageIDs: []types.MessageID{"a", "b"}, Type: types.ReceiptTypeDelivered},
+			want:        map[types.MessageID]State{"a": Delivered, "b": Delivered},
+		},
+		{
+			description: "read",
+			receipt:     &events.Receipt{MessageIDs: []types.MessageID{"a"}, Type: types.ReceiptTypeRead},
+			want:        map[types.MessageID]State{"a": Read, "b": Delivered},
+		},
+		{
+			description: "late delivery doesn't go back",
+			receipt:     &events.Receipt{MessageIDs: []types.MessageID{"a"}, Type: types.ReceiptTypeDelivered},
+			want:        map[types.MessageID]State{"a": Read, "b": Delivered},
+		},
+		{
+			description: "retry receipts are ignored",
+			receipt:     &events.Receipt{MessageIDs: []types.MessageID{"b"}, Type: types.ReceiptTypeRetry},
+			want:        map[types.MessageID]State{"a": Read, "b": Delivered},
+		},
+		{
+			description: "own reads are ignored",
+			receipt: &events.Receipt{
+				MessageSource: types.MessageSource{IsFromMe: true},
+				MessageIDs:    []types.MessageID{"b"},
+				Type:          types.ReceiptTypeRead,
+			},
+			want: map[types.MessageID]State{"a": Read, "b": Delivered},
+		},
+	} {
+		test.receipt.Chat = chat
+		if err := tr.Handle(test.receipt); err != nil {
+			t.Errorf("%v: Handle(_) = %v, need nil error", test.description, err)
+		}
+		for id, want := range test.want {
+			if got := store.states[id]; got != want {
+				t.Errorf("%v: state of %v = %v, want %v", test.description, id, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Package waiface defines the parts of a `*whatsmeow.Client` that the packages of this module
+// use. The helpers accept these narrow interfaces instead of the client, so that they can be
+// tested without a WhatsApp account; see package waifacetest for a fake.
+package waiface
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Sender sends messages.
+type Sender interface {
+	SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+}
+
+// Downloader downloads and decrypts media.
+type Downloader interface {
+	Download(msg whatsmeow.DownloadableMessage) ([]byte, error)
+}
+
+// Uploader encrypts and uploads media.
+type Uploader interface {
+	Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
+}
+
+// PresenceAPI sends chat presence, i.e. typing indicators.
+type PresenceAPI interface {
+	SendChatPresence(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error
+}
+
+// ChatSettingsAPI changes the settings of chats.
+type ChatSettingsAPI interface {
+	SetDisappearingTimer(chat types.JID, timer time.Duration) error
+}
+
+// ProfileAPI fetches information about users and business accounts.
+type ProfileAPI interface {
+	GetUserInfo(jids []types.JID) (map[types.JID]types.UserInfo, error)
+	GetBusinessProfile(jid types.JID) (*types.BusinessProfile, error)
+}
+
+// BlocklistAPI reads and changes the list of blocked contacts.
+type BlocklistAPI interface {
+	GetBlocklist() (*types.Blocklist, error)
+	UpdateBlocklist(jid types.JID, action events.BlocklistChangeAction) (*types.Blocklist, error)
+}
+
+// EventSource emits events to handlers, typically `handlers.Dispatch`.
+type EventSource interface {
+	AddEventHandler(handler whatsmeow.EventHandler) uint32
+	RemoveEventHandler(id uint32) bool
+}
+
+// Client is everything that the packages of this module use.
+type Client interface {
+	Sender
+	Downloader
+	Uploader
+	PresenceAPI
+	ChatSettingsAPI
+	ProfileAPI
+	BlocklistAPI
+	EventSource
+}
+
+var _ Client = (*whatsmeow.Client)(nil)
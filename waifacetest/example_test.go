@@ -0,0 +1,65 @@
+package waifacetest_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/KarelKubat/whatsmeow/handlers"
+	"github.com/KarelKubat/whatsmeow/send"
+	"github.com/KarelKubat/whatsmeow/waiface"
+	"github.com/KarelKubat/whatsmeow/waifacetest"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// router is a small command router: it answers "/ping" with "pong".
+type router struct {
+	cli waiface.Sender
+}
+
+func (r *router) Handle(ev interface{}) error {
+	m, ok := ev.(*events.Message)
+	if !ok {
+		return fmt.Errorf("unexpected event %T", ev)
+	}
+	if strings.TrimSpace(m.Message.GetConversation()) != "/ping" {
+		return nil
+	}
+	_, err := send.Text(context.Background(), r.cli, m.Info.Chat, "pong")
+	return err
+}
+
+// TestEndToEnd wires the fake like a real client: events go through handlers.Dispatch to the
+// router, which replies using the fake.
+func TestEndToEnd(t *testing.T) {
+	fake := waifacetest.New()
+	fake.AddEventHandler(func(ev interface{}) {
+		if err := handlers.Dispatch(ev); err != nil {
+			t.Errorf("Dispatch(%T) = %v, need nil error", ev, err)
+		}
+	})
+	handlers.Register(handlers.Message, &router{cli: fake})
+
+	chat := types.NewJID("123", types.DefaultUserServer)
+	fake.Inject(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+			ID:            "IN1",
+		},
+		Message: &waE2E.Message{Conversation: proto.String("/ping")},
+	})
+
+	sent := fake.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("Sent() = %v, want 1 reply", sent)
+	}
+	want := &waE2E.Message{Conversation: proto.String("pong")}
+	if sent[0].To != chat || !proto.Equal(sent[0].Message, want) {
+		t.Errorf("sent %v to %v, want %v to %v", sent[0].Message, sent[0].To, want, chat)
+	}
+}
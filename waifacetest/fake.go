@@ -0,0 +1,253 @@
+// Package waifacetest provides a fake WhatsApp client for tests. The fake implements
+// waiface.Client: it records the calls, answers them from scripted functions or sensible
+// defaults, and emits injected events to its event handlers.
+package waifacetest
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KarelKubat/whatsmeow/waiface"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ErrNotScripted is returned by calls that have no scripted function and no sensible default.
+var ErrNotScripted = errors.New("waifacetest: no scripted response")
+
+// Call is a recorded call to the fake.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Sent is a message that was sent using the fake.
+type Sent struct {
+	To      types.JID
+	Message *waE2E.Message
+	Extra   []whatsmeow.SendRequestExtra
+}
+
+// Fake is a scriptable waiface.Client. When a ...Func field is set, the corresponding call is
+// answered by it; otherwise the default that the method describes applies. Calls are recorded
+// either way. The zero value isn't usable, use New.
+type Fake struct {
+	SendMessageFunc          func(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	DownloadFunc             func(msg whatsmeow.DownloadableMessage) ([]byte, error)
+	UploadFunc               func(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
+	SendChatPresenceFunc     func(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error
+	SetDisappearingTimerFunc func(chat types.JID, timer time.Duration) error
+	GetUserInfoFunc          func(jids []types.JID) (map[types.JID]types.UserInfo, error)
+	GetBusinessProfileFunc   func(jid types.JID) (*types.BusinessProfile, error)
+	GetBlocklistFunc         func() (*types.Blocklist, error)
+	UpdateBlocklistFunc      func(jid types.JID, action events.BlocklistChangeAction) (*types.Blocklist, error)
+
+	mu       sync.Mutex
+	calls    []Call
+	sent     []Sent
+	uploads  map[string][]byte // plaintext by direct path
+	blocked  []types.JID
+	handlers []whatsmeow.EventHandler
+}
+
+var _ waiface.Client = (*Fake)(nil)
+
+// New returns a fake without scripted responses.
+func New() *Fake {
+	return &Fake{uploads: map[string][]byte{}}
+}
+
+func (f *Fake) record(method string, args ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the recorded calls, oldest first.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Sent returns the messages that were sent successfully, oldest first.
+func (f *Fake) Sent() []Sent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Sent(nil), f.sent...)
+}
+
+// SendMessage implements waiface.Sender. By default, sending succeeds with the ID of `extra`,
+// or a generated one.
+func (f *Fake) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	f.record("SendMessage", to, message, extra)
+	var resp whatsmeow.SendResponse
+	var err error
+	if f.SendMessageFunc != nil {
+		resp, err = f.SendMessageFunc(ctx, to, message, extra...)
+	} else {
+		resp = whatsmeow.SendResponse{Timestamp: time.Now()}
+		if len(extra) > 0 && extra[0].ID != "" {
+			resp.ID = extra[0].ID
+		} else {
+			f.mu.Lock()
+			resp.ID = fmt.Sprintf("FAKE%04d", len(f.sent)+1)
+			f.mu.Unlock()
+		}
+	}
+	if err == nil {
+		f.mu.Lock()
+		f.sent = append(f.sent, Sent{To: to, Message: message, Extra: extra})
+		f.mu.Unlock()
+	}
+	return resp, err
+}
+
+// Download implements waiface.Downloader. By default, media that were uploaded using the fake
+// can be downloaded; others fail with ErrNotScripted.
+func (f *Fake) Download(msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	f.record("Download", msg)
+	if f.DownloadFunc != nil {
+		return f.DownloadFunc(msg)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.uploads[msg.GetDirectPath()]
+	if !ok {
+		return nil, fmt.Errorf("Download(%q): %w", msg.GetDirectPath(), ErrNotScripted)
+	}
+	return data, nil
+}
+
+// Upload implements waiface.Uploader. By default, uploading succeeds and the media can be
+// downloaded using the fake. The hashes are those of the plaintext; nothing is encrypted.
+func (f *Fake) Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	f.record("Upload", plaintext, appInfo)
+	if f.UploadFunc != nil {
+		return f.UploadFunc(ctx, plaintext, appInfo)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := fmt.Sprintf("/fake/%d", len(f.uploads)+1)
+	f.uploads[path] = append([]byte(nil), plaintext...)
+	sum := sha256.Sum256(plaintext)
+	return whatsmeow.UploadResponse{
+		URL:           "https://mmg.whatsapp.net" + path,
+		DirectPath:    path,
+		MediaKey:      sum[:],
+		FileEncSHA256: sum[:],
+		FileSHA256:    sum[:],
+		FileLength:    uint64(len(plaintext)),
+	}, nil
+}
+
+// SendChatPresence implements waiface.PresenceAPI. By default, it succeeds.
+func (f *Fake) SendChatPresence(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
+	f.record("SendChatPresence", jid, state, media)
+	if f.SendChatPresenceFunc != nil {
+		return f.SendChatPresenceFunc(jid, state, media)
+	}
+	return nil
+}
+
+// SetDisappearingTimer implements waiface.ChatSettingsAPI. By default, it succeeds.
+func (f *Fake) SetDisappearingTimer(chat types.JID, timer time.Duration) error {
+	f.record("SetDisappearingTimer", chat, timer)
+	if f.SetDisappearingTimerFunc != nil {
+		return f.SetDisappearingTimerFunc(chat, timer)
+	}
+	return nil
+}
+
+// GetUserInfo implements waiface.ProfileAPI. By default, it fails with ErrNotScripted.
+func (f *Fake) GetUserInfo(jids []types.JID) (map[types.JID]types.UserInfo, error) {
+	f.record("GetUserInfo", jids)
+	if f.GetUserInfoFunc != nil {
+		return f.GetUserInfoFunc(jids)
+	}
+	return nil, fmt.Errorf("GetUserInfo: %w", ErrNotScripted)
+}
+
+// GetBusinessProfile implements waiface.ProfileAPI. By default, it fails with ErrNotScripted.
+func (f *Fake) GetBusinessProfile(jid types.JID) (*types.BusinessProfile, error) {
+	f.record("GetBusinessProfile", jid)
+	if f.GetBusinessProfileFunc != nil {
+		return f.GetBusinessProfileFunc(jid)
+	}
+	return nil, fmt.Errorf("GetBusinessProfile: %w", ErrNotScripted)
+}
+
+// GetBlocklist implements waiface.BlocklistAPI. By default, it returns the contacts that were
+// blocked using the fake.
+func (f *Fake) GetBlocklist() (*types.Blocklist, error) {
+	f.record("GetBlocklist")
+	if f.GetBlocklistFunc != nil {
+		return f.GetBlocklistFunc()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &types.Blocklist{JIDs: append([]types.JID(nil), f.blocked...)}, nil
+}
+
+// UpdateBlocklist implements waiface.BlocklistAPI. By default, it blocks or unblocks the contact
+// and returns the new list.
+func (f *Fake) UpdateBlocklist(jid types.JID, action events.BlocklistChangeAction) (*types.Blocklist, error) {
+	f.record("UpdateBlocklist", jid, action)
+	if f.UpdateBlocklistFunc != nil {
+		return f.UpdateBlocklistFunc(jid, action)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var kept []types.JID
+	for _, b := range f.blocked {
+		if b != jid {
+			kept = append(kept, b)
+		}
+	}
+	if action == events.BlocklistChangeActionBlock {
+		kept = append(kept, jid)
+	}
+	f.blocked = kept
+	return &types.Blocklist{JIDs: append([]types.JID(nil), kept...)}, nil
+}
+
+// AddEventHandler implements waiface.EventSource. Handlers receive the events of Inject.
+func (f *Fake) AddEventHandler(handler whatsmeow.EventHandler) uint32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers = append(f.handlers, handler)
+	return uint32(len(f.handlers))
+}
+
+// RemoveEventHandler implements waiface.EventSource, and returns whether the handler was there.
+func (f *Fake) RemoveEventHandler(id uint32) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id == 0 || int(id) > len(f.handlers) || f.handlers[id-1] == nil {
+		return false
+	}
+	f.handlers[id-1] = nil // keeps the IDs of the others
+	return true
+}
+
+// Inject emits events to the event handlers, in order and synchronously, as if they came from
+// WhatsApp.
+func (f *Fake) Inject(evs ...interface{}) {
+	f.mu.Lock()
+	hs := append([]whatsmeow.EventHandler(nil), f.handlers...)
+	f.mu.Unlock()
+	for _, ev := range evs {
+		for _, h := range hs {
+			if h != nil {
+				h(ev)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package waifacetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestUploadDownload(t *testing.T) {
+	ctx := context.Background()
+	f := New()
+	data := []byte("picture")
+	up, err := f.Upload(ctx, data, whatsmeow.MediaImage)
+	if err != nil {
+		t.Fatalf("Upload(_) = %v, need nil error", err)
+	}
+	got, err := f.Download(&waE2E.ImageMessage{DirectPath: proto.String(up.DirectPath)})
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Download(uploaded) = %q, %v, want %q and nil error", got, err, data)
+	}
+	if _, err := f.Download(&waE2E.ImageMessage{DirectPath: proto.String("/elsewhere")}); !errors.Is(err, ErrNotScripted) {
+		t.Errorf("Download(unknown) = %v, want %v", err, ErrNotScripted)
+	}
+}
+
+func TestSendMessage(t *testing.T) {
+	ctx := context.Background()
+	f := New()
+	to := types.NewJID("123", types.DefaultUserServer)
+	msg := &waE2E.Message{Conversation: proto.String("hi")}
+
+	if resp, err := f.SendMessage(ctx, to, msg, whatsmeow.SendRequestExtra{ID: "ID1"}); err != nil || resp.ID != "ID1" {
+		t.Errorf("SendMessage(_) = %v, %v, want ID1 and nil error", resp.ID, err)
+	}
+	errScripted := errors.New("scripted")
+	f.SendMessageFunc = func(context.Context, types.JID, *waE2E.Message, ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+		return whatsmeow.SendResponse{}, errScripted
+	}
+	if _, err := f.SendMessage(ctx, to, msg); err != errScripted {
+		t.Errorf("SendMessage(_) = %v, want %v", err, errScripted)
+	}
+	if sent := f.Sent(); len(sent) != 1 || sent[0].To != to || sent[0].Message != msg {
+		t.Errorf("Sent() = %v, want the first message only", sent)
+	}
+	if calls := f.Calls(); len(calls) != 2 || calls[1].Method != "SendMessage" {
+		t.Errorf("Calls() = %v, want 2 calls of SendMessage", calls)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	f := New()
+	a := types.NewJID("1", types.DefaultUserServer)
+	b := types.NewJID("2", types.DefaultUserServer)
+	f.UpdateBlocklist(a, events.BlocklistChangeActionBlock)
+	f.UpdateBlocklist(b, events.BlocklistChangeActionBlock)
+	f.UpdateBlocklist(a, events.BlocklistChangeActionUnblock)
+	bl, err := f.GetBlocklist()
+	if err != nil || len(bl.JIDs) != 1 || bl.JIDs[0] != b {
+		t.Errorf("GetBlocklist() = %v, %v, want [%v] and nil error", bl, err, b)
+	}
+}
+
+func TestInject(t *testing.T) {
+	f := New()
+	var got []interface{}
+	f.AddEventHandler(func(ev interface{}) { got = append(got, ev) })
+	f.Inject(&events.Connected{}, &events.Disconnected{})
+	if len(got) != 2 {
+		t.Errorf("handler saw %v, want 2 events", got)
+	}
+}
+
+func TestRemoveEventHandler(t *testing.T) {
+	f := New()
+	var got []string
+	first := f.AddEventHandler(func(ev interface{}) { got = append(got, "first") })
+	f.AddEventHandler(func(ev interface{}) { got = append(got, "second") })
+	if !f.RemoveEventHandler(first) {
+		t.Errorf("RemoveEventHandler(%d) = false, want true", first)
+	}
+	if f.RemoveEventHandler(first) {
+		t.Errorf("RemoveEventHandler(%d) again = true, want false", first)
+	}
+	f.Inject(&events.Connected{})
+	if len(got) != 1 || got[0] != "second" {
+		t.Errorf("handlers saw %v, want [second]", got)
+	}
+}